@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -23,6 +24,25 @@ type MongoDBConfig struct {
 	TLSCAFile string
 }
 
+// PostgresConfig holds the PostgreSQL (PostGIS) connection settings, used when
+// STORAGE_BACKEND=postgres.
+type PostgresConfig struct {
+	// DSN is a libpq connection string or URL (POSTGRES_DSN).
+	DSN string
+	// Schema, when set, is put first on the search_path (POSTGRES_SCHEMA).
+	Schema string
+	// MaxConns caps the pool size (POSTGRES_MAX_CONNS); 0 uses the pgx default.
+	MaxConns       int
+	ConnectTimeout int
+}
+
+// SQLiteConfig holds the embedded SQLite settings, used when
+// STORAGE_BACKEND=sqlite.
+type SQLiteConfig struct {
+	// Path is the database file (SQLITE_PATH); it is created if missing.
+	Path string
+}
+
 // Config represents the application configuration. It is populated entirely from
 // environment variables (see Load); there is no config file. The Logger struct
 // must stay structurally identical to logger.Config so cfg.Logger can be passed
@@ -45,8 +65,16 @@ type Config struct {
 		SyslogPort     string `json:"syslogPort"`
 		SyslogTag      string `json:"syslogTag"`
 	}
-	MongoDB MongoDBConfig
-	Sentry  struct {
+	Storage struct {
+		// Backend selects the storage backend: "mongodb", "postgres" or
+		// "memory" (STORAGE_BACKEND). The memory backend keeps everything in
+		// process and loses it on restart.
+		Backend string
+	}
+	MongoDB  MongoDBConfig
+	Postgres PostgresConfig
+	SQLite   SQLiteConfig
+	Sentry   struct {
 		DSN              string
 		Environment      string
 		EnableTracing    bool
@@ -57,16 +85,167 @@ type Config struct {
 		// APIKeys is the allowlist of valid X-API-Key values (from API_KEYS,
 		// comma-separated). Empty disables write authentication.
 		APIKeys []string
+		// ExportKeys are API keys that may export (EXPORT_API_KEYS,
+		// comma-separated; GET /export). They are read-only unless also in
+		// APIKeys.
+		ExportKeys []string
+		// ContactKeys are API keys that may read reporter contact fields
+		// (CONTACT_API_KEYS, comma-separated). They are read-only unless also
+		// in APIKeys.
+		ContactKeys []string
+	}
+	RateLimit  RateLimitConfig
+	Privacy    PrivacyConfig
+	ChangeFeed ChangeFeedConfig
+	Webhooks   WebhooksConfig
+	Stream     StreamConfig
+	ImportJobs ImportJobsConfig
+	// DictionaryDir holds the data dictionaries (*.yaml) that
+	// POST /requests/bulk?dictionary=<jurisdiction> maps rows with
+	// (DICTIONARY_DIR). Empty disables the parameter.
+	DictionaryDir string
+	ValueSets     struct {
+		// Dictionary names the dictionary (jurisdiction) whose value sets
+		// writes are checked against (VALUE_SET_DICTIONARY). Empty disables.
+		Dictionary string
+		// Mode overrides the dictionary's enforcement mode: off, warn or
+		// reject (VALUE_SET_MODE). Empty keeps the dictionary's.
+		Mode string
 	}
-	RateLimit struct {
-		// RequestsPerMinute is the per-client request cap (from RATE_LIMIT_RPM).
-		// 0 disables rate limiting.
-		RequestsPerMinute int
+	// PropertySchemaFile is the properties schema (schemas/properties.yaml)
+	// every write's properties are validated against (PROPERTY_SCHEMA_FILE).
+	// Empty disables validation.
+	PropertySchemaFile string
+	// PropertyIndexKeys are the properties keys given a secondary index on
+	// startup, for the property filters queried most (PROPERTY_INDEX_KEYS).
+	PropertyIndexKeys []string
+	// HarvestSourcesFile lists the remote Open311 endpoints harvested into
+	// storage (HARVEST_SOURCES_FILE, see harvest/sources.example.yaml).
+	// Empty disables the harvester.
+	HarvestSourcesFile string
+	Retention          struct {
+		// SoftDeleteDays is how long soft-deleted tombstones are kept before the
+		// purge job hard-deletes them (SOFT_DELETE_RETENTION_DAYS). 0 keeps them
+		// forever.
+		SoftDeleteDays int
+		// PurgeIntervalMinutes is how often the purge job runs
+		// (PURGE_INTERVAL_MINUTES).
+		PurgeIntervalMinutes int
 	}
 }
 
+// WebhooksConfig holds the webhook subscription delivery settings.
+type WebhooksConfig struct {
+	// MaxAttempts is how often a delivery is tried before it is dead-lettered
+	// (WEBHOOK_MAX_ATTEMPTS).
+	MaxAttempts int
+	// RetryBaseSeconds is the delay before the first retry; it doubles with
+	// every further attempt (WEBHOOK_RETRY_BASE_SECONDS).
+	RetryBaseSeconds int
+	// TimeoutSeconds bounds each delivery POST (WEBHOOK_TIMEOUT_SECONDS).
+	TimeoutSeconds int
+	// AllowPrivateTargets permits subscription URLs on loopback, private and
+	// reserved addresses (WEBHOOK_ALLOW_PRIVATE_TARGETS; development only).
+	AllowPrivateTargets bool
+}
+
+// ImportJobsConfig holds the settings of background import jobs
+// (POST /jobs/imports).
+type ImportJobsConfig struct {
+	// Dir keeps the uploaded files until their jobs succeed (IMPORT_JOB_DIR);
+	// replicas must share it.
+	Dir string
+	// Workers is how many jobs run at once per replica (IMPORT_JOB_WORKERS).
+	Workers int
+	// MaxUploadMB caps an uploaded file, after decompression
+	// (IMPORT_JOB_MAX_UPLOAD_MB).
+	MaxUploadMB int
+}
+
+// StreamConfig holds the settings of the Server-Sent Events live feed.
+type StreamConfig struct {
+	// History is how many recent events are kept for clients resuming with
+	// Last-Event-ID (STREAM_HISTORY).
+	History int
+	// Buffer is how many events may queue for one client before it is
+	// disconnected as too slow (STREAM_CLIENT_BUFFER).
+	Buffer int
+	// MaxClients caps concurrent stream connections (STREAM_MAX_CLIENTS).
+	MaxClients int
+	// HeartbeatSeconds is the interval of the keep-alive comment sent on idle
+	// streams (STREAM_HEARTBEAT_SECONDS).
+	HeartbeatSeconds int
+}
+
+// RateLimitConfig holds the token-bucket rate limiting settings. Limits are
+// requests per minute; 0 disables limiting for that route class.
+type RateLimitConfig struct {
+	// RequestsPerMinute is the default per-client cap (from RATE_LIMIT_RPM),
+	// used for any route class without its own setting. 0 disables.
+	RequestsPerMinute int
+	// ReadRPM, WriteRPM and BulkRPM override RequestsPerMinute per route class
+	// (RATE_LIMIT_READ_RPM, RATE_LIMIT_WRITE_RPM, RATE_LIMIT_BULK_RPM).
+	ReadRPM  int
+	WriteRPM int
+	BulkRPM  int
+	// Burst is the bucket size (RATE_LIMIT_BURST). 0 means one minute's
+	// allowance.
+	Burst int
+	// KeyPolicies overrides the class limits for individual API keys
+	// (RATE_LIMIT_KEY_POLICIES, "key:class=rpm,..."): key -> class -> rpm.
+	KeyPolicies map[string]map[string]int
+	// TrustedProxies are the CIDRs whose X-Forwarded-For is believed
+	// (TRUSTED_PROXIES). Defaults to loopback.
+	TrustedProxies []string
+	// Store selects where buckets live: "memory" (per replica) or "mongodb"
+	// (shared across replicas) (RATE_LIMIT_STORE).
+	Store string
+}
+
+// PrivacyConfig holds the reporter-privacy settings.
+type PrivacyConfig struct {
+	// ContactEncryptionKey is a base64 AES key (16, 24 or 32 bytes) used to
+	// encrypt reporter contact fields at rest (CONTACT_ENCRYPTION_KEY). Empty
+	// stores them in plaintext.
+	ContactEncryptionKey string
+	// SensitiveServiceCodes get blurred coordinates in public responses
+	// (PRIVACY_SENSITIVE_SERVICE_CODES, comma-separated).
+	SensitiveServiceCodes []string
+	// CoordinateMode is off, round or jitter (PRIVACY_COORDINATE_MODE).
+	CoordinateMode string
+	// CoordinatePrecision is the decimals kept in round mode
+	// (PRIVACY_COORDINATE_PRECISION).
+	CoordinatePrecision int
+	// JitterMeters is the maximum displacement in jitter mode
+	// (PRIVACY_JITTER_METERS).
+	JitterMeters float64
+	// JitterSecret keys the per-request displacement (PRIVACY_JITTER_SECRET).
+	// Empty uses a random secret per process, so offsets change on restart.
+	JitterSecret string
+}
+
+// ChangeFeedConfig holds the change feed consumer settings (MongoDB only).
+type ChangeFeedConfig struct {
+	// Sink is where changes are published: "file", "webhook" or "nats"
+	// (CHANGEFEED_SINK). Empty disables the change feed.
+	Sink string
+	// Consumer names the consumer's saved resume token (CHANGEFEED_CONSUMER).
+	Consumer string
+	// FilePath is the NDJSON file of the file sink (CHANGEFEED_FILE_PATH).
+	FilePath string
+	// WebhookURL receives a POST per change (CHANGEFEED_WEBHOOK_URL).
+	WebhookURL string
+	// NATSURL is the nats://host:port server of the nats sink
+	// (CHANGEFEED_NATS_URL).
+	NATSURL string
+	// NATSSubject prefixes the subjects published to; the operation is
+	// appended (CHANGEFEED_NATS_SUBJECT).
+	NATSSubject string
+}
+
 // Load builds the configuration from environment variables, applying sensible
-// defaults. Only MONGODB_URI is required. Call LoadDotEnv first if you want to
+// defaults. Only the selected backend's connection string is required
+// (MONGODB_URI or POSTGRES_DSN). Call LoadDotEnv first if you want to
 // source a local .env file.
 func Load() (*Config, error) {
 	cfg := &Config{}
@@ -77,6 +256,7 @@ func Load() (*Config, error) {
 	cfg.Server.IdleTimeoutSeconds = getEnvInt("IDLE_TIMEOUT_SECONDS", 120)
 	cfg.Server.ShutdownTimeoutSeconds = getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 30)
 
+	cfg.Storage.Backend = getEnv("STORAGE_BACKEND", "mongodb")
 	cfg.MongoDB.URI = getEnv("MONGODB_URI", "")
 	cfg.MongoDB.Database = getEnv("MONGODB_DATABASE", "open311")
 	cfg.MongoDB.Collection = getEnv("MONGODB_COLLECTION", "service_requests")
@@ -85,6 +265,13 @@ func Load() (*Config, error) {
 	cfg.MongoDB.TLSCertificateKeyFile = getEnv("MONGODB_TLS_CERT_KEY_FILE", "")
 	cfg.MongoDB.TLSCAFile = getEnv("MONGODB_TLS_CA_FILE", "")
 
+	cfg.Postgres.DSN = getEnv("POSTGRES_DSN", "")
+	cfg.Postgres.Schema = getEnv("POSTGRES_SCHEMA", "")
+	cfg.Postgres.MaxConns = getEnvInt("POSTGRES_MAX_CONNS", 0)
+	cfg.Postgres.ConnectTimeout = getEnvInt("POSTGRES_CONNECT_TIMEOUT_SECONDS", 10)
+
+	cfg.SQLite.Path = getEnv("SQLITE_PATH", "open311.db")
+
 	cfg.Logger.Level = getEnv("LOG_LEVEL", "info")
 	cfg.Logger.Format = getEnv("LOG_FORMAT", "text")
 	cfg.Logger.ApacheLogPath = getEnv("LOG_APACHE_PATH", "")
@@ -101,11 +288,118 @@ func Load() (*Config, error) {
 	cfg.Sentry.SendDefaultPII = getEnvBool("SENTRY_SEND_DEFAULT_PII", false)
 
 	cfg.Auth.APIKeys = splitAndTrim(getEnv("API_KEYS", ""))
+	cfg.Auth.ExportKeys = splitAndTrim(getEnv("EXPORT_API_KEYS", ""))
+	cfg.Auth.ContactKeys = splitAndTrim(getEnv("CONTACT_API_KEYS", ""))
 
 	cfg.RateLimit.RequestsPerMinute = getEnvInt("RATE_LIMIT_RPM", 0)
+	cfg.RateLimit.ReadRPM = getEnvInt("RATE_LIMIT_READ_RPM", cfg.RateLimit.RequestsPerMinute)
+	cfg.RateLimit.WriteRPM = getEnvInt("RATE_LIMIT_WRITE_RPM", cfg.RateLimit.RequestsPerMinute)
+	cfg.RateLimit.BulkRPM = getEnvInt("RATE_LIMIT_BULK_RPM", cfg.RateLimit.RequestsPerMinute)
+	cfg.RateLimit.Burst = getEnvInt("RATE_LIMIT_BURST", 0)
+	cfg.RateLimit.TrustedProxies = splitAndTrim(getEnv("TRUSTED_PROXIES", "127.0.0.1/32,::1/128"))
+	cfg.RateLimit.Store = getEnv("RATE_LIMIT_STORE", "memory")
+	if cfg.RateLimit.Store != "memory" && cfg.RateLimit.Store != "mongodb" {
+		return nil, fmt.Errorf("RATE_LIMIT_STORE: unknown store %q (expected memory or mongodb)", cfg.RateLimit.Store)
+	}
+	keyPolicies, err := parseKeyPolicies(getEnv("RATE_LIMIT_KEY_POLICIES", ""))
+	if err != nil {
+		return nil, err
+	}
+	// A policy for a key nobody can present would silently never apply. The
+	// key itself is a secret, so the error does not name it.
+	for key := range keyPolicies {
+		if !slices.Contains(cfg.Auth.APIKeys, key) && !slices.Contains(cfg.Auth.ExportKeys, key) && !slices.Contains(cfg.Auth.ContactKeys, key) {
+			return nil, fmt.Errorf("RATE_LIMIT_KEY_POLICIES names a key that is not in API_KEYS, EXPORT_API_KEYS or CONTACT_API_KEYS")
+		}
+	}
+	cfg.RateLimit.KeyPolicies = keyPolicies
 
-	if cfg.MongoDB.URI == "" {
-		return nil, fmt.Errorf("MONGODB_URI is required")
+	cfg.Privacy.ContactEncryptionKey = getEnv("CONTACT_ENCRYPTION_KEY", "")
+	cfg.Privacy.SensitiveServiceCodes = splitAndTrim(getEnv("PRIVACY_SENSITIVE_SERVICE_CODES", ""))
+	cfg.Privacy.CoordinateMode = getEnv("PRIVACY_COORDINATE_MODE", "off")
+	cfg.Privacy.CoordinatePrecision = getEnvInt("PRIVACY_COORDINATE_PRECISION", 3)
+	cfg.Privacy.JitterMeters = getEnvFloat("PRIVACY_JITTER_METERS", 250)
+	cfg.Privacy.JitterSecret = getEnv("PRIVACY_JITTER_SECRET", "")
+	switch cfg.Privacy.CoordinateMode {
+	case "off", "round", "jitter":
+	default:
+		return nil, fmt.Errorf("PRIVACY_COORDINATE_MODE: unknown mode %q (expected off, round or jitter)", cfg.Privacy.CoordinateMode)
+	}
+
+	cfg.ChangeFeed.Sink = getEnv("CHANGEFEED_SINK", "")
+	cfg.ChangeFeed.Consumer = getEnv("CHANGEFEED_CONSUMER", "changefeed")
+	cfg.ChangeFeed.FilePath = getEnv("CHANGEFEED_FILE_PATH", "")
+	cfg.ChangeFeed.WebhookURL = getEnv("CHANGEFEED_WEBHOOK_URL", "")
+	cfg.ChangeFeed.NATSURL = getEnv("CHANGEFEED_NATS_URL", "nats://localhost:4222")
+	cfg.ChangeFeed.NATSSubject = getEnv("CHANGEFEED_NATS_SUBJECT", "open311.requests")
+	switch {
+	case cfg.ChangeFeed.Sink == "" || cfg.ChangeFeed.Sink == "nats":
+	case cfg.ChangeFeed.Sink == "file" && cfg.ChangeFeed.FilePath == "":
+		return nil, fmt.Errorf("CHANGEFEED_FILE_PATH is required for CHANGEFEED_SINK=file")
+	case cfg.ChangeFeed.Sink == "webhook" && cfg.ChangeFeed.WebhookURL == "":
+		return nil, fmt.Errorf("CHANGEFEED_WEBHOOK_URL is required for CHANGEFEED_SINK=webhook")
+	case cfg.ChangeFeed.Sink != "file" && cfg.ChangeFeed.Sink != "webhook":
+		return nil, fmt.Errorf("CHANGEFEED_SINK: unknown sink %q (expected file, webhook or nats)", cfg.ChangeFeed.Sink)
+	}
+
+	cfg.Webhooks.MaxAttempts = getEnvInt("WEBHOOK_MAX_ATTEMPTS", 8)
+	cfg.Webhooks.RetryBaseSeconds = getEnvInt("WEBHOOK_RETRY_BASE_SECONDS", 30)
+	cfg.Webhooks.TimeoutSeconds = getEnvInt("WEBHOOK_TIMEOUT_SECONDS", 10)
+	cfg.Webhooks.AllowPrivateTargets = getEnvBool("WEBHOOK_ALLOW_PRIVATE_TARGETS", false)
+	if cfg.Webhooks.MaxAttempts < 1 || cfg.Webhooks.RetryBaseSeconds < 1 || cfg.Webhooks.TimeoutSeconds < 1 {
+		return nil, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS, WEBHOOK_RETRY_BASE_SECONDS and WEBHOOK_TIMEOUT_SECONDS must be positive")
+	}
+
+	cfg.ImportJobs.Dir = getEnv("IMPORT_JOB_DIR", "import-jobs")
+	cfg.ImportJobs.Workers = getEnvInt("IMPORT_JOB_WORKERS", 2)
+	cfg.ImportJobs.MaxUploadMB = getEnvInt("IMPORT_JOB_MAX_UPLOAD_MB", 1024)
+	if cfg.ImportJobs.Workers < 1 || cfg.ImportJobs.MaxUploadMB < 1 {
+		return nil, fmt.Errorf("IMPORT_JOB_WORKERS and IMPORT_JOB_MAX_UPLOAD_MB must be positive")
+	}
+
+	cfg.Stream.History = getEnvInt("STREAM_HISTORY", 1000)
+	cfg.Stream.Buffer = getEnvInt("STREAM_CLIENT_BUFFER", 64)
+	cfg.Stream.MaxClients = getEnvInt("STREAM_MAX_CLIENTS", 500)
+	cfg.Stream.HeartbeatSeconds = getEnvInt("STREAM_HEARTBEAT_SECONDS", 15)
+	if cfg.Stream.History < 1 || cfg.Stream.Buffer < 1 || cfg.Stream.MaxClients < 1 || cfg.Stream.HeartbeatSeconds < 1 {
+		return nil, fmt.Errorf("STREAM_HISTORY, STREAM_CLIENT_BUFFER, STREAM_MAX_CLIENTS and STREAM_HEARTBEAT_SECONDS must be positive")
+	}
+
+	cfg.DictionaryDir = os.Getenv("DICTIONARY_DIR")
+	cfg.ValueSets.Dictionary = strings.ToLower(os.Getenv("VALUE_SET_DICTIONARY"))
+	cfg.ValueSets.Mode = os.Getenv("VALUE_SET_MODE")
+	switch {
+	case cfg.ValueSets.Mode != "" && cfg.ValueSets.Mode != "off" && cfg.ValueSets.Mode != "warn" && cfg.ValueSets.Mode != "reject":
+		return nil, fmt.Errorf("VALUE_SET_MODE: unknown mode %q (expected off, warn or reject)", cfg.ValueSets.Mode)
+	case cfg.ValueSets.Dictionary != "" && cfg.DictionaryDir == "":
+		return nil, fmt.Errorf("VALUE_SET_DICTIONARY needs DICTIONARY_DIR")
+	}
+	cfg.PropertySchemaFile = os.Getenv("PROPERTY_SCHEMA_FILE")
+	cfg.PropertyIndexKeys = splitAndTrim(os.Getenv("PROPERTY_INDEX_KEYS"))
+	cfg.HarvestSourcesFile = os.Getenv("HARVEST_SOURCES_FILE")
+
+	cfg.Retention.SoftDeleteDays = getEnvInt("SOFT_DELETE_RETENTION_DAYS", 0)
+	cfg.Retention.PurgeIntervalMinutes = getEnvInt("PURGE_INTERVAL_MINUTES", 60)
+	if cfg.Retention.SoftDeleteDays < 0 || cfg.Retention.PurgeIntervalMinutes < 1 {
+		return nil, fmt.Errorf("SOFT_DELETE_RETENTION_DAYS must not be negative and PURGE_INTERVAL_MINUTES must be positive")
+	}
+
+	switch cfg.Storage.Backend {
+	case "mongodb":
+		if cfg.MongoDB.URI == "" {
+			return nil, fmt.Errorf("MONGODB_URI is required")
+		}
+	case "postgres":
+		if cfg.Postgres.DSN == "" {
+			return nil, fmt.Errorf("POSTGRES_DSN is required for STORAGE_BACKEND=postgres")
+		}
+	case "sqlite":
+		if cfg.SQLite.Path == "" {
+			return nil, fmt.Errorf("SQLITE_PATH is required for STORAGE_BACKEND=sqlite")
+		}
+	case "memory":
+	default:
+		return nil, fmt.Errorf("STORAGE_BACKEND: unknown backend %q (expected mongodb, postgres, sqlite or memory)", cfg.Storage.Backend)
 	}
 
 	return cfg, nil
@@ -146,6 +440,39 @@ func LoadDotEnv(path string) error {
 	return scanner.Err()
 }
 
+// parseKeyPolicies parses RATE_LIMIT_KEY_POLICIES: comma-separated
+// "key:class=rpm" entries, e.g. "feeder-key:bulk=600,feeder-key:write=1200".
+// class is read, write or bulk. Returns nil for an empty input.
+func parseKeyPolicies(s string) (map[string]map[string]int, error) {
+	entries := splitAndTrim(s)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]map[string]int)
+	for _, e := range entries {
+		lhs, rpmStr, ok := strings.Cut(e, "=")
+		i := strings.LastIndexByte(lhs, ':')
+		if !ok || i <= 0 {
+			return nil, fmt.Errorf("RATE_LIMIT_KEY_POLICIES: malformed entry %q (expected key:class=rpm)", e)
+		}
+		key, class := lhs[:i], lhs[i+1:]
+		switch class {
+		case "read", "write", "bulk":
+		default:
+			return nil, fmt.Errorf("RATE_LIMIT_KEY_POLICIES: unknown route class %q (expected read, write or bulk)", class)
+		}
+		rpm, err := strconv.Atoi(strings.TrimSpace(rpmStr))
+		if err != nil {
+			return nil, fmt.Errorf("RATE_LIMIT_KEY_POLICIES: invalid rpm in %q", e)
+		}
+		if out[key] == nil {
+			out[key] = make(map[string]int)
+		}
+		out[key][class] = rpm
+	}
+	return out, nil
+}
+
 // splitAndTrim splits a comma-separated string into a slice, trimming whitespace
 // and dropping empty entries. Returns nil for an empty input.
 func splitAndTrim(s string) []string {
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRetention(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "memory")
+	t.Setenv("SOFT_DELETE_RETENTION_DAYS", "30")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, 30, cfg.Retention.SoftDeleteDays)
+	assert.Equal(t, 60, cfg.Retention.PurgeIntervalMinutes)
+
+	for _, interval := range []string{"0", "-5"} {
+		t.Setenv("PURGE_INTERVAL_MINUTES", interval)
+		_, err := Load()
+		assert.ErrorContains(t, err, "PURGE_INTERVAL_MINUTES", interval)
+	}
+
+	t.Setenv("PURGE_INTERVAL_MINUTES", "15")
+	t.Setenv("SOFT_DELETE_RETENTION_DAYS", "-1")
+	_, err = Load()
+	assert.ErrorContains(t, err, "SOFT_DELETE_RETENTION_DAYS")
+}
+
+func TestLoadRateLimit(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "memory")
+	t.Setenv("API_KEYS", "admin-key")
+	t.Setenv("EXPORT_API_KEYS", "lake-key")
+	t.Setenv("RATE_LIMIT_KEY_POLICIES", "admin-key:write=600,lake-key:bulk=60")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "memory", cfg.RateLimit.Store)
+	assert.Equal(t, map[string]map[string]int{"admin-key": {"write": 600}, "lake-key": {"bulk": 60}}, cfg.RateLimit.KeyPolicies)
+
+	t.Setenv("RATE_LIMIT_STORE", "redis")
+	_, err = Load()
+	assert.ErrorContains(t, err, "RATE_LIMIT_STORE")
+
+	t.Setenv("RATE_LIMIT_STORE", "mongodb")
+	t.Setenv("RATE_LIMIT_KEY_POLICIES", "typo-key:write=600")
+	_, err = Load()
+	assert.ErrorContains(t, err, "RATE_LIMIT_KEY_POLICIES")
+	assert.NotContains(t, err.Error(), "typo-key", "keys are secrets")
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Import job states. A queued job is claimed by a worker and runs until it
+// succeeds, fails or is cancelled; failed and cancelled jobs can be resumed
+// (queued again), continuing after the last written batch.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Import job file formats.
+const (
+	ImportFormatJSON   = "json"   // a JSON array
+	ImportFormatNDJSON = "ndjson" // one JSON object per line
+	ImportFormatCSV    = "csv"    // needs a dictionary
+)
+
+// ImportCounts are the progress counters of an import job; they only cover
+// written batches, so they never run ahead of what is stored.
+type ImportCounts struct {
+	// Rows is the number of records consumed from the file.
+	Rows      int `json:"rows" xml:"rows"`
+	Created   int `json:"created" xml:"created"`
+	Updated   int `json:"updated" xml:"updated"`
+	Unchanged int `json:"unchanged" xml:"unchanged"`
+	Skipped   int `json:"skipped" xml:"skipped"`
+	Failed    int `json:"failed" xml:"failed"`
+}
+
+// ImportJob is an uploaded file imported in the background
+// (POST /jobs/imports).
+type ImportJob struct {
+	XMLName xml.Name `xml:"import_job" json:"-"`
+	ID      string   `json:"id" xml:"id"`
+	Status  string   `json:"status" xml:"status"`
+	Format  string   `json:"format" xml:"format"`
+	// Dictionary maps the records (source rows) when set; otherwise they are
+	// service requests in the API's own form.
+	Dictionary  string `json:"dictionary,omitempty" xml:"dictionary,omitempty"`
+	OnlyIfNewer bool   `json:"only_if_newer" xml:"only_if_newer"`
+	// File is the stored upload, a name in IMPORT_JOB_DIR; Size is its size
+	// in bytes.
+	File   string       `json:"-" xml:"-"`
+	Size   int64        `json:"size" xml:"size"`
+	Counts ImportCounts `json:"counts" xml:"counts"`
+	// Samples describes the first skipped or failed records.
+	Samples []string `json:"samples,omitempty" xml:"samples>sample,omitempty"`
+	// Error says why a failed job failed.
+	Error string `json:"error,omitempty" xml:"error,omitempty"`
+	// CancelRequested is set while a running job is stopping.
+	CancelRequested bool `json:"cancel_requested,omitempty" xml:"cancel_requested,omitempty"`
+	// Attempts counts the runs (claims) of the job. It fences progress
+	// updates: a worker whose claim was taken over can no longer write.
+	Attempts   int        `json:"attempts" xml:"attempts"`
+	CreatedAt  time.Time  `json:"created_at" xml:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" xml:"updated_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty" xml:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" xml:"finished_at,omitempty"`
+	// LeaseUntil is when a running job's claim lapses; another worker then
+	// takes it over (its worker died).
+	LeaseUntil *time.Time `json:"-" xml:"-"`
+}
@@ -92,9 +92,35 @@ type ServiceRequest struct {
 	FeatureID         *string   `json:"featureId,omitempty" xml:"feature_id,omitempty"`
 	FeatureGuid       *string   `json:"featureGuid,omitempty" xml:"feature_guid,omitempty"`
 	OrganizationID    string    `json:"organizationId,omitempty" xml:"organization_id,omitempty"`
+	// Reporter contact (GeoReport POST fields). Personal data: never returned on
+	// public reads (see internal/privacy) and optionally encrypted at rest.
+	Email     string `json:"email,omitempty" xml:"email,omitempty"`
+	FirstName string `json:"first_name,omitempty" xml:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty" xml:"last_name,omitempty"`
+	Phone     string `json:"phone,omitempty" xml:"phone,omitempty"`
+	DeviceID  string `json:"device_id,omitempty" xml:"device_id,omitempty"`
+	AccountID string `json:"account_id,omitempty" xml:"account_id,omitempty"`
 	// Properties carries jurisdiction-specific fields with no Open311 equivalent
 	// (e.g. Boston extras) and PSK 5970 annotations. See dictionaries/.
 	Properties Properties `json:"properties,omitempty" xml:"properties,omitempty"`
+	// PropertiesSchemaVersion is the version of the properties schema the
+	// properties conform to (see internal/propschema); 0 when written without
+	// one.
+	PropertiesSchemaVersion int `json:"properties_schema_version,omitempty" xml:"properties_schema_version,omitempty"`
+	// DeletedAt is set on soft-deleted tombstones, which only admin reads
+	// (include_deleted) return. Ignored on writes.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" xml:"deleted_at,omitempty"`
+	// ErasedAt records when personal data was erased. Ignored on writes.
+	ErasedAt *time.Time `json:"erased_at,omitempty" xml:"erased_at,omitempty"`
+	// Version is the optimistic-concurrency counter, bumped on every write. It is
+	// not part of the body; handlers expose it as the ETag header.
+	Version int64 `json:"-" xml:"-"`
+}
+
+// ContactFields returns pointers to the reporter contact fields, for code that
+// treats them uniformly (redaction, encryption at rest).
+func (r *ServiceRequest) ContactFields() []*string {
+	return []*string{&r.Email, &r.FirstName, &r.LastName, &r.Phone, &r.DeviceID, &r.AccountID}
 }
 
 // Requests is a collection of Request items for XML marshaling
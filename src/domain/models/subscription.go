@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Subscription is a webhook subscription: service request events matching its
+// filters are POSTed to URL, signed with Secret. Empty filters match every
+// request.
+type Subscription struct {
+	XMLName xml.Name `xml:"subscription" json:"-"`
+	ID      string   `json:"id" xml:"id"`
+	URL     string   `json:"url" xml:"url"`
+	// Secret keys the HMAC-SHA256 signature of each delivery. It is
+	// write-only: the API returns it once, in the response to the POST.
+	Secret           string `json:"secret,omitempty" xml:"secret,omitempty"`
+	ServiceRequestID string `json:"service_request_id,omitempty" xml:"service_request_id,omitempty"`
+	ServiceCode      string `json:"service_code,omitempty" xml:"service_code,omitempty"`
+	OrganizationID   string `json:"organizationId,omitempty" xml:"organization_id,omitempty"`
+	// BBox is minLong,minLat,maxLong,maxLat (WGS84), as the bbox query
+	// parameter of GET /requests.
+	BBox      string    `json:"bbox,omitempty" xml:"bbox,omitempty"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+}
+
+// Subscriptions is a collection of Subscription for XML marshaling
+type Subscriptions struct {
+	XMLName xml.Name       `xml:"subscriptions" json:"-"`
+	Items   []Subscription `xml:"subscription" json:"subscriptions"`
+}
+
+// Webhook delivery states. A pending delivery is retried with backoff until
+// it is delivered or, after the last attempt, dead (the dead-letter list).
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is one event queued for, or sent to, a subscription.
+type WebhookDelivery struct {
+	XMLName          xml.Name `xml:"delivery" json:"-"`
+	ID               string   `json:"id" xml:"id"`
+	SubscriptionID   string   `json:"subscription_id" xml:"subscription_id"`
+	Event            string   `json:"event" xml:"event"`
+	ServiceRequestID string   `json:"service_request_id" xml:"service_request_id"`
+	Status           string   `json:"status" xml:"status"`
+	Attempts         int      `json:"attempts" xml:"attempts"`
+	// ResponseStatus is the HTTP status of the last attempt (0 when it got
+	// no response); LastError says why it failed.
+	ResponseStatus int        `json:"response_status,omitempty" xml:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty" xml:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" xml:"created_at"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty" xml:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty" xml:"delivered_at,omitempty"`
+	// Payload is the signed JSON body, fixed when the event is queued.
+	Payload []byte `json:"-" xml:"-"`
+}
+
+// WebhookDeliveries is a collection of WebhookDelivery for XML marshaling
+type WebhookDeliveries struct {
+	XMLName xml.Name          `xml:"deliveries" json:"-"`
+	Items   []WebhookDelivery `xml:"delivery" json:"deliveries"`
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/importer"
+	"github.com/timoruohomaki/open311-to-Go/internal/privacy"
+	"github.com/timoruohomaki/open311-to-Go/internal/propschema"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+const importUsage = `usage: open311api [-env FILE] import boston -csv FILE [flags]
+       open311api [-env FILE] import csv -csv FILE -dictionary FILE [flags]
+
+  Streams a CSV export into the storage backend STORAGE_BACKEND selects, in
+  BulkUpsert batches keyed on service_request_id: a data.boston.gov 311 export
+  (legacy or new-system columns), or any export a data dictionary
+  (dictionaries/*.yaml) describes. Progress is saved after every batch;
+  rerunning the same command resumes after the last written batch.
+
+flags:`
+
+// runImport implements the import subcommand.
+func runImport(cfg *config.Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() {
+		fmt.Fprintln(out, importUsage)
+		fs.PrintDefaults()
+	}
+	csvPath := fs.String("csv", "", "path of the CSV export (required)")
+	batch := fs.Int("batch", importer.DefaultBatchSize, "records per bulk write")
+	progressPath := fs.String("progress", "", "progress file (default <csv>.progress.json)")
+	restart := fs.Bool("restart", false, "ignore saved progress and import from the first row")
+	onlyIfNewer := fs.Bool("only-if-newer", false, "keep stored records whose updated_datetime is as new or newer")
+	dryRun := fs.Bool("dry-run", false, "map and count rows without writing")
+	limit := fs.Int("limit", 0, "stop after this many rows (0 = all)")
+	bbox := fs.String("bbox", "", "minLong,minLat,maxLong,maxLat; coordinates outside are dropped (default: around Boston for boston)")
+	dictPath := fs.String("dictionary", "", "map columns with this data dictionary instead of the built-in Boston layouts")
+	// Flags may come before or after the source name.
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing source")
+	}
+	source := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+	switch {
+	case source != "boston" && source != "csv":
+		fs.Usage()
+		return fmt.Errorf("unknown source %q (expected boston or csv)", source)
+	case source == "csv" && *dictPath == "":
+		fs.Usage()
+		return fmt.Errorf("-dictionary is required for csv")
+	case fs.NArg() > 0:
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	case *csvPath == "":
+		fs.Usage()
+		return fmt.Errorf("-csv is required")
+	case *batch < 1 || *batch > 10000:
+		return fmt.Errorf("-batch must be between 1 and 10000")
+	}
+	var bounds *repository.GeoBBox
+	if source == "boston" {
+		bounds = &importer.BostonBBox
+	}
+	if *bbox != "" {
+		b, err := repository.ParseGeoBBox(*bbox)
+		if err != nil {
+			return fmt.Errorf("-bbox: %w", err)
+		}
+		bounds = &b
+	}
+	var dict *dictionary.Dictionary
+	if *dictPath != "" {
+		var err error
+		if dict, err = dictionary.Load(*dictPath); err != nil {
+			return err
+		}
+		if cfg.ValueSets.Mode != "" {
+			dict.Enforcement.Mode = cfg.ValueSets.Mode
+		}
+	}
+
+	f, err := os.Open(*csvPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	src, err := importer.NewCSVSource(f)
+	if err != nil {
+		return err
+	}
+	var mapper importer.Mapper
+	if dict != nil {
+		mapper = importer.NewDictionaryMapper(dict, bounds)
+		fmt.Fprintf(out, "Importing %s (%s dictionary)\n", *csvPath, dict.Name)
+	} else {
+		boston, err := importer.NewBostonMapper(src.Header(), *bounds)
+		if err != nil {
+			return err
+		}
+		mapper = boston
+		fmt.Fprintf(out, "Importing %s (%s export)\n", *csvPath, boston.Layout())
+	}
+
+	opts := importer.Options{
+		BatchSize:   *batch,
+		OnlyIfNewer: *onlyIfNewer,
+		DryRun:      *dryRun,
+		Limit:       *limit,
+		Logf:        func(format string, args ...interface{}) { fmt.Fprintf(out, format+"\n", args...) },
+	}
+	if !*dryRun {
+		abs, err := filepath.Abs(*csvPath)
+		if err != nil {
+			return err
+		}
+		progress := &importer.ProgressFile{Path: *progressPath, Source: abs, SourceSize: info.Size()}
+		if progress.Path == "" {
+			progress.Path = *csvPath + ".progress.json"
+		}
+		if *restart {
+			if err := os.Remove(progress.Path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		opts.Progress = progress
+	}
+
+	// A dry run only maps rows: no storage is needed.
+	var repo repository.ServiceRequestRepository
+	if !*dryRun {
+		log, err := logger.New(cfg.Logger)
+		if err != nil {
+			return err
+		}
+		defer log.Close()
+		store, err := openStorage(cfg, log)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		if repo, err = contactEncryption(cfg, store.ServiceRequests); err != nil {
+			return err
+		}
+		if repo, err = propertySchema(cfg, repo); err != nil {
+			return err
+		}
+	}
+
+	// Ctrl-C stops the import; rerunning resumes after the last written batch.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stats, err := importer.New(repo, opts).Run(ctx, src, mapper)
+	for _, s := range stats.Samples {
+		fmt.Fprintf(out, "  %s\n", s)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Done: %d rows, created=%d updated=%d unchanged=%d skipped=%d failed=%d\n",
+		stats.Rows, stats.Created, stats.Updated, stats.Unchanged, stats.Skipped, stats.Failed)
+	return nil
+}
+
+// contactEncryption wraps repo like the server does when
+// CONTACT_ENCRYPTION_KEY is set, so imported contact fields are encrypted too.
+func contactEncryption(cfg *config.Config, repo repository.ServiceRequestRepository) (repository.ServiceRequestRepository, error) {
+	if cfg.Privacy.ContactEncryptionKey == "" {
+		return repo, nil
+	}
+	key, err := privacy.DecodeKey(cfg.Privacy.ContactEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("CONTACT_ENCRYPTION_KEY: %w", err)
+	}
+	cipher, err := privacy.NewAESCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("CONTACT_ENCRYPTION_KEY: %w", err)
+	}
+	return repository.NewEncryptedServiceRequestRepository(repo, cipher), nil
+}
+
+// propertySchema wraps repo like the server does when PROPERTY_SCHEMA_FILE is
+// set, so imported properties are validated and converted too; rows that do
+// not conform are reported as failed.
+func propertySchema(cfg *config.Config, repo repository.ServiceRequestRepository) (repository.ServiceRequestRepository, error) {
+	if cfg.PropertySchemaFile == "" {
+		return repo, nil
+	}
+	schema, err := propschema.Load(cfg.PropertySchemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("PROPERTY_SCHEMA_FILE: %w", err)
+	}
+	return repository.NewSchemaServiceRequestRepository(repo, schema), nil
+}
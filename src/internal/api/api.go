@@ -1,13 +1,25 @@
 package api
 
 import (
+	"crypto/rand"
 	"net/http"
+	"slices"
+	"time"
 
 	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
 	"github.com/timoruohomaki/open311-to-Go/internal/handlers"
+	"github.com/timoruohomaki/open311-to-Go/internal/harvest"
+	"github.com/timoruohomaki/open311-to-Go/internal/jobs"
+	"github.com/timoruohomaki/open311-to-Go/internal/privacy"
+	"github.com/timoruohomaki/open311-to-Go/internal/propschema"
 	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/internal/stream"
+	"github.com/timoruohomaki/open311-to-Go/internal/webhooks"
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
 	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
 	"github.com/timoruohomaki/open311-to-Go/pkg/middleware"
+	"github.com/timoruohomaki/open311-to-Go/pkg/ratelimit"
 	"github.com/timoruohomaki/open311-to-Go/pkg/router"
 )
 
@@ -17,55 +29,220 @@ type API struct {
 	config       *config.Config
 	logger       logger.Logger
 	accessLogger logger.Logger
+	webhooks     *webhooks.Dispatcher
+	stream       *stream.Hub
+	jobs         *jobs.Runner
+	harvester    *harvest.Harvester
 }
 
 // New creates a new API
-func New(cfg *config.Config, log logger.Logger, accessLog logger.Logger, db *repository.MongoDB) *API {
+func New(cfg *config.Config, log logger.Logger, accessLog logger.Logger, store *repository.Storage) *API {
 	// Create router
 	r := router.New()
 
+	rateLimit := rateLimitOptions(cfg.RateLimit, validKeys(cfg), log)
+	if cfg.RateLimit.Store == "mongodb" {
+		if store.RateLimitStore != nil {
+			rateLimit.Store = store.RateLimitStore
+		} else {
+			log.Warnf("RATE_LIMIT_STORE=mongodb needs the MongoDB backend; using per-replica memory buckets")
+		}
+	}
+
 	// Add middleware (outermost first): access log -> rate limit -> API key -> content type
 	r.Use(middleware.LoggingMiddleware(accessLog))
-	r.Use(middleware.RateLimitMiddleware(cfg.RateLimit.RequestsPerMinute))
-	r.Use(middleware.APIKeyMiddleware(cfg.Auth.APIKeys))
+	r.Use(middleware.RateLimitMiddleware(rateLimit))
+	r.Use(middleware.APIKeyMiddleware(cfg.Auth.APIKeys, keyScopes(cfg)))
 	r.Use(middleware.ContentTypeMiddleware)
 
 	if len(cfg.Auth.APIKeys) == 0 {
 		log.Warnf("API_KEYS is not set; write endpoints (POST/PUT/DELETE) are unauthenticated")
 	}
-	if cfg.RateLimit.RequestsPerMinute <= 0 {
+	if !rateLimit.Enabled() {
 		log.Infof("Rate limiting disabled (RATE_LIMIT_RPM unset)")
 	} else {
-		log.Infof("Rate limiting enabled: %d requests/min per client", cfg.RateLimit.RequestsPerMinute)
+		log.Infof("Rate limiting enabled: read %d, write %d, bulk %d requests/min per client (%s store)",
+			cfg.RateLimit.ReadRPM, cfg.RateLimit.WriteRPM, cfg.RateLimit.BulkRPM, cfg.RateLimit.Store)
 	}
 
 	// Initialize repositories
-	userRepo := repository.NewMongoUserRepository(db)
-	serviceRepo := repository.NewMongoServiceRepository(db)
-	serviceRequestRepo := repository.NewMongoServiceRequestRepository(db, cfg.MongoDB.Collection)
+	userRepo := store.Users
+	serviceRepo := store.Services
+	serviceRequestRepo := store.ServiceRequests
+	if cfg.Privacy.ContactEncryptionKey != "" {
+		key, err := privacy.DecodeKey(cfg.Privacy.ContactEncryptionKey)
+		if err != nil {
+			log.Fatalf("CONTACT_ENCRYPTION_KEY: %v", err)
+		}
+		cipher, err := privacy.NewAESCipher(key)
+		if err != nil {
+			log.Fatalf("CONTACT_ENCRYPTION_KEY: %v", err)
+		}
+		serviceRequestRepo = repository.NewEncryptedServiceRequestRepository(serviceRequestRepo, cipher)
+		log.Info("Reporter contact fields are encrypted at rest")
+	}
+	var schema *propschema.Schema
+	if cfg.PropertySchemaFile != "" {
+		var err error
+		if schema, err = propschema.Load(cfg.PropertySchemaFile); err != nil {
+			log.Fatalf("PROPERTY_SCHEMA_FILE: %v", err)
+		}
+		serviceRequestRepo = repository.NewSchemaServiceRequestRepository(serviceRequestRepo, schema)
+		log.Infof("Validating properties against schema version %d (%d keys)", schema.Version, len(schema.Properties))
+	}
+
+	// Webhook subscriptions and the live stream see every write made through
+	// the API.
+	policy := privacyPolicy(cfg.Privacy, log)
+	dispatcher := webhooks.NewDispatcher(store.Subscriptions, policy, cfg.Webhooks, log)
+	hub := stream.NewHub(cfg.Stream.History, cfg.Stream.Buffer, cfg.Stream.MaxClients)
+	serviceRequestRepo = repository.NewObservedServiceRequestRepository(serviceRequestRepo, dispatcher.Observe, hub.Observe)
+
+	requestOpts := []handlers.ServiceRequestHandlerOption{
+		handlers.WithPrivacyPolicy(policy),
+		handlers.WithStream(hub, time.Duration(cfg.Stream.HeartbeatSeconds)*time.Second),
+		handlers.WithPropertySchema(schema),
+	}
+	var dicts dictionary.Registry
+	var valueSets *dictionary.Dictionary
+	if cfg.DictionaryDir != "" {
+		var err error
+		if dicts, err = dictionary.LoadDir(cfg.DictionaryDir); err != nil {
+			log.Fatalf("DICTIONARY_DIR: %v", err)
+		}
+		log.Infof("Loaded %d data dictionaries from %s", len(dicts), cfg.DictionaryDir)
+		if cfg.ValueSets.Dictionary != "" {
+			if valueSets = dicts[cfg.ValueSets.Dictionary]; valueSets == nil {
+				log.Fatalf("VALUE_SET_DICTIONARY: no dictionary %q in %s", cfg.ValueSets.Dictionary, cfg.DictionaryDir)
+			}
+			mode := cfg.ValueSets.Mode
+			if mode == "" {
+				mode = valueSets.Enforcement.Mode
+			}
+			log.Infof("Checking written values against the %s value sets (%s)", valueSets.Name, mode)
+		}
+		requestOpts = append(requestOpts, handlers.WithDictionaries(dicts), handlers.WithValueSets(valueSets, cfg.ValueSets.Mode))
+	}
+
+	// Import jobs write through the same repository chain as the API.
+	runner := jobs.NewRunner(store.ImportJobs, serviceRequestRepo, cfg.ImportJobs, log,
+		jobs.WithDictionaries(dicts), jobs.WithValueSets(valueSets, cfg.ValueSets.Mode))
+
+	// Harvested remote requests, too.
+	var harvester *harvest.Harvester
+	if cfg.HarvestSourcesFile != "" {
+		sources, err := harvest.LoadSources(cfg.HarvestSourcesFile)
+		if err != nil {
+			log.Fatalf("HARVEST_SOURCES_FILE: %v", err)
+		}
+		if store.ChangeCheckpoints == nil {
+			log.Warnf("The %s backend cannot save harvest watermarks; after a restart each source is harvested again from its start", store.Backend)
+		}
+		harvester = harvest.New(sources, serviceRequestRepo, store.ChangeCheckpoints, log)
+	}
 
 	// Initialize handlers
 	userHandler := handlers.NewUserHandler(log, userRepo)
 	serviceHandler := handlers.NewServiceHandler(log, serviceRepo)
-	serviceRequestHandler := handlers.NewServiceRequestHandler(log, serviceRequestRepo)
-	healthHandler := handlers.NewHealthHandler(log, db)
+	serviceRequestHandler := handlers.NewServiceRequestHandler(log, serviceRequestRepo, requestOpts...)
+	subscriptionHandler := handlers.NewSubscriptionHandler(log, store.Subscriptions, dispatcher, webhooks.NewSecret)
+	jobHandler := handlers.NewJobHandler(log, store.ImportJobs, runner, dicts, int64(cfg.ImportJobs.MaxUploadMB)<<20)
+	healthHandler := handlers.NewHealthHandler(log, store.Pinger)
 
 	api := &API{
 		router:       r,
 		config:       cfg,
 		logger:       log,
 		accessLogger: accessLog,
+		webhooks:     dispatcher,
+		stream:       hub,
+		jobs:         runner,
+		harvester:    harvester,
 	}
 
 	// Register routes
-	api.registerRoutes(userHandler, serviceHandler, serviceRequestHandler, healthHandler)
+	api.registerRoutes(userHandler, serviceHandler, serviceRequestHandler, subscriptionHandler, jobHandler, healthHandler)
 
 	return api
 }
 
+// privacyPolicy builds the public-response policy. Without PRIVACY_JITTER_SECRET
+// a random per-process secret is used for jitter mode.
+func privacyPolicy(cfg config.PrivacyConfig, log logger.Logger) *privacy.Policy {
+	secret := []byte(cfg.JitterSecret)
+	if cfg.CoordinateMode == privacy.CoordinatesJitter && len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("Failed to generate jitter secret: %v", err)
+		}
+		log.Warnf("PRIVACY_JITTER_SECRET is not set; jittered coordinates will change on restart")
+	}
+	if cfg.CoordinateMode != privacy.CoordinatesExact && len(cfg.SensitiveServiceCodes) > 0 {
+		log.Infof("Blurring public coordinates (%s) for service codes %v", cfg.CoordinateMode, cfg.SensitiveServiceCodes)
+	}
+	return privacy.NewPolicy(cfg.SensitiveServiceCodes, cfg.CoordinateMode, cfg.CoordinatePrecision, cfg.JitterMeters, secret)
+}
+
+// rateLimitOptions translates the rate limit config into middleware options.
+// Invalid TRUSTED_PROXIES entries are logged and ignored.
+func rateLimitOptions(cfg config.RateLimitConfig, apiKeys []string, log logger.Logger) middleware.RateLimitOptions {
+	policy := func(rpm int) ratelimit.Policy {
+		p := ratelimit.PerMinute(rpm)
+		if cfg.Burst > 0 {
+			p.Burst = cfg.Burst
+		}
+		return p
+	}
+
+	opts := middleware.RateLimitOptions{
+		Policies: map[string]ratelimit.Policy{
+			middleware.RouteClassRead:  policy(cfg.ReadRPM),
+			middleware.RouteClassWrite: policy(cfg.WriteRPM),
+			middleware.RouteClassBulk:  policy(cfg.BulkRPM),
+		},
+		KeyPolicies: make(map[string]map[string]ratelimit.Policy, len(cfg.KeyPolicies)),
+		APIKeys:     apiKeys,
+		Logger:      log,
+	}
+	for key, classes := range cfg.KeyPolicies {
+		opts.KeyPolicies[key] = make(map[string]ratelimit.Policy, len(classes))
+		for class, rpm := range classes {
+			opts.KeyPolicies[key][class] = policy(rpm)
+		}
+	}
+
+	trusted, err := middleware.ParseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		log.Warnf("Ignoring TRUSTED_PROXIES: %v", err)
+	}
+	opts.TrustedProxies = trusted
+	return opts
+}
+
+// keyScopes gives the export keys (EXPORT_API_KEYS) the export scope and the
+// contact keys (CONTACT_API_KEYS) the contact scope; a key in both has both.
+func keyScopes(cfg *config.Config) map[string][]string {
+	scoped := make(map[string][]string, len(cfg.Auth.ExportKeys)+len(cfg.Auth.ContactKeys))
+	for _, k := range cfg.Auth.ExportKeys {
+		scoped[k] = append(scoped[k], httputil.ScopeExport)
+	}
+	for _, k := range cfg.Auth.ContactKeys {
+		scoped[k] = append(scoped[k], httputil.ScopeContact)
+	}
+	return scoped
+}
+
+// validKeys lists every configured API key, scoped ones included: each is a
+// client identity for rate limiting and may have a key policy.
+func validKeys(cfg *config.Config) []string {
+	keys := slices.Concat(cfg.Auth.APIKeys, cfg.Auth.ExportKeys, cfg.Auth.ContactKeys)
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
 // registerRoutes sets up all API routes
-func (a *API) registerRoutes(userHandler *handlers.UserHandler, serviceHandler *handlers.ServiceHandler, serviceRequestHandler *handlers.ServiceRequestHandler, healthHandler *handlers.HealthHandler) {
-	// Health check (public, used for liveness + MongoDB connectivity). Registered
+func (a *API) registerRoutes(userHandler *handlers.UserHandler, serviceHandler *handlers.ServiceHandler, serviceRequestHandler *handlers.ServiceRequestHandler, subscriptionHandler *handlers.SubscriptionHandler, jobHandler *handlers.JobHandler, healthHandler *handlers.HealthHandler) {
+	// Health check (public, used for liveness + storage connectivity). Registered
 	// both at the top level and under the API prefix, since the fronting proxy
 	// routes only /open311/v2/* to this service.
 	a.router.Handle("GET", "/health", healthHandler.Health)
@@ -90,14 +267,60 @@ func (a *API) registerRoutes(userHandler *handlers.UserHandler, serviceHandler *
 	// Service Request routes (Open311 GeoReport v2).
 	// Register the specific sub-paths before the {id} wildcard so they win.
 	a.router.Handle("GET", "/open311/v2/requests/search", serviceRequestHandler.SearchServiceRequestsByFeature)
+	a.router.Handle("GET", "/open311/v2/requests/stream", serviceRequestHandler.StreamServiceRequests)
+	a.router.Handle("GET", "/open311/v2/requests/value_report", serviceRequestHandler.GetValueReport)
+	a.router.Handle("GET", "/open311/v2/export", serviceRequestHandler.ExportServiceRequests)
 	a.router.Handle("GET", "/open311/v2/requests/by_organization", serviceRequestHandler.SearchServiceRequestsByOrganization)
 	a.router.Handle("GET", "/open311/v2/requests", serviceRequestHandler.GetServiceRequests)
+	a.router.Handle("GET", "/open311/v2/requests.atom", serviceRequestHandler.GetServiceRequestsAtom)
+	a.router.Handle("GET", "/open311/v2/requests.rss", serviceRequestHandler.GetServiceRequestsRSS)
 	a.router.Handle("GET", "/open311/v2/requests/", serviceRequestHandler.GetServiceRequests) // Trailing slash version
 	a.router.Handle("POST", "/open311/v2/requests/bulk", serviceRequestHandler.BulkUpsertServiceRequests)
+	a.router.Handle("POST", "/open311/v2/requests/{id}/erasure", serviceRequestHandler.EraseServiceRequest)
 	a.router.Handle("POST", "/open311/v2/requests", serviceRequestHandler.CreateServiceRequest)
 	a.router.Handle("GET", "/open311/v2/requests/{id}", serviceRequestHandler.GetServiceRequest)
 	a.router.Handle("PUT", "/open311/v2/requests/{id}", serviceRequestHandler.UpsertServiceRequest)
+	a.router.Handle("PATCH", "/open311/v2/requests/{id}", serviceRequestHandler.PatchServiceRequest)
 	a.router.Handle("DELETE", "/open311/v2/requests/{id}", serviceRequestHandler.DeleteServiceRequest)
+
+	// Webhook subscriptions to service request events.
+	a.router.Handle("GET", "/open311/v2/subscriptions", subscriptionHandler.GetSubscriptions)
+	a.router.Handle("POST", "/open311/v2/subscriptions", subscriptionHandler.CreateSubscription)
+	a.router.Handle("GET", "/open311/v2/subscriptions/{id}", subscriptionHandler.GetSubscription)
+	a.router.Handle("DELETE", "/open311/v2/subscriptions/{id}", subscriptionHandler.DeleteSubscription)
+	a.router.Handle("GET", "/open311/v2/subscriptions/{id}/deliveries", subscriptionHandler.GetDeliveries)
+	a.router.Handle("POST", "/open311/v2/subscriptions/{id}/deliveries/{delivery_id}/retry", subscriptionHandler.RetryDelivery)
+
+	// Background import jobs.
+	a.router.Handle("POST", "/open311/v2/jobs/imports", jobHandler.CreateImportJob)
+	a.router.Handle("GET", "/open311/v2/jobs/{id}", jobHandler.GetJob)
+	a.router.Handle("POST", "/open311/v2/jobs/{id}/cancel", jobHandler.CancelJob)
+	a.router.Handle("POST", "/open311/v2/jobs/{id}/resume", jobHandler.ResumeJob)
+}
+
+// Webhooks returns the webhook dispatcher; its Run delivers queued events and
+// must be started alongside the server.
+func (a *API) Webhooks() *webhooks.Dispatcher {
+	return a.webhooks
+}
+
+// Jobs returns the import job runner; its Run processes queued imports and
+// must be started alongside the server.
+func (a *API) Jobs() *jobs.Runner {
+	return a.jobs
+}
+
+// Harvester returns the remote Open311 harvester, nil when
+// HARVEST_SOURCES_FILE is unset; its Run must be started alongside the
+// server.
+func (a *API) Harvester() *harvest.Harvester {
+	return a.harvester
+}
+
+// Stream returns the live stream hub; close it on shutdown so open streams
+// end.
+func (a *API) Stream() *stream.Hub {
+	return a.stream
 }
 
 // Handler returns the HTTP handler for the API
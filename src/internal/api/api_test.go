@@ -0,0 +1,440 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/internal/webhooks"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+// newMemoryAPI serves the full middleware stack and routes on the in-memory
+// backend.
+func newMemoryAPI(t *testing.T) http.Handler {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Storage.Backend = repository.BackendMemory
+	cfg.Privacy.CoordinateMode = "off"
+	log, err := logger.New(logger.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+	return New(cfg, log, log, repository.NewMemoryStorage()).Handler()
+}
+
+func TestAPIOnMemoryStorage(t *testing.T) {
+	h := newMemoryAPI(t)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	body := `{"service_code":"pothole","description":"Hole","lat":60.1699,"long":24.9384}`
+	req := httptest.NewRequest(http.MethodPost, "/open311/v2/requests", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	list := func(query string) []models.ServiceRequest {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/open311/v2/requests?"+query, nil))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var got []models.ServiceRequest
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+		return got
+	}
+	assert.Len(t, list("lat=60.17&long=24.938&radius=200"), 1)
+	assert.Empty(t, list("lat=60.25&long=25.1&radius=200"))
+	assert.Len(t, list("bbox=24.9,60.1,25.0,60.2"), 1)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/open311/v2/requests?bbox=25,60,24,61", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/open311/v2/requests?lat=60&long=24", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "radius is required with lat/long")
+}
+
+// TestSpoofedEncryptedContactField: a contact value that mimics the
+// encrypted prefix is encrypted like any other, so it cannot poison reads.
+func TestSpoofedEncryptedContactField(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Storage.Backend = repository.BackendMemory
+	cfg.Privacy.CoordinateMode = "off"
+	cfg.Privacy.ContactEncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	cfg.Auth.APIKeys = []string{"admin-key"}
+	cfg.Auth.ContactKeys = []string{"admin-key"}
+	log, err := logger.New(logger.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+	h := New(cfg, log, log, repository.NewMemoryStorage()).Handler()
+
+	body := `{"service_code":"pothole","address":"Main St 1","email":"enc:v1:garbage"}`
+	req := httptest.NewRequest(http.MethodPost, "/open311/v2/requests", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "admin-key")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+	for _, key := range []string{"", "admin-key"} {
+		req := httptest.NewRequest(http.MethodGet, "/open311/v2/requests", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var got []models.ServiceRequest
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+		require.Len(t, got, 1)
+		if key != "" {
+			assert.Equal(t, "enc:v1:garbage", got[0].Email)
+		}
+	}
+}
+
+// TestKeylessModeAdminEndpoints: with API_KEYS unset writes are open, but
+// import jobs and subscriptions are refused outright rather than created
+// where they cannot be read back.
+func TestKeylessModeAdminEndpoints(t *testing.T) {
+	h := newMemoryAPI(t)
+	for _, tc := range []struct{ path, contentType, body string }{
+		{"/open311/v2/jobs/imports", "application/json", `[]`},
+		{"/open311/v2/subscriptions", "application/json", `{"url":"https://93.184.215.14/hook"}`},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, tc.path)
+		assert.Empty(t, rec.Header().Get("Location"), tc.path)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/open311/v2/subscriptions", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestWebhookSubscriptionTargets(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Storage.Backend = repository.BackendMemory
+	cfg.Privacy.CoordinateMode = "off"
+	cfg.Auth.APIKeys = []string{"admin-key"}
+	log, err := logger.New(logger.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+	h := New(cfg, log, log, repository.NewMemoryStorage()).Handler()
+	create := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/open311/v2/subscriptions", strings.NewReader(`{"url":"`+target+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "admin-key")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	for _, target := range []string{
+		"http://127.0.0.1:9000/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data/iam/",
+		"http://[fd00:ec2::254]/",
+		"http://10.1.2.3/hook",
+	} {
+		rec := create(target)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, target)
+		assert.Contains(t, rec.Body.String(), "private or reserved address", target)
+	}
+	assert.Equal(t, http.StatusCreated, create("https://93.184.215.14/hook").Code)
+}
+
+func TestWebhookSubscriptions(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		delivered [][]byte
+		headers   []http.Header
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		delivered = append(delivered, body)
+		headers = append(headers, r.Header.Clone())
+	}))
+	defer receiver.Close()
+
+	cfg := &config.Config{}
+	cfg.Storage.Backend = repository.BackendMemory
+	cfg.Privacy.CoordinateMode = "off"
+	cfg.Auth.APIKeys = []string{"admin-key"}
+	// The receiver is on loopback.
+	cfg.Webhooks = config.WebhooksConfig{MaxAttempts: 3, RetryBaseSeconds: 30, TimeoutSeconds: 5, AllowPrivateTargets: true}
+	log, err := logger.New(logger.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+	a := New(cfg, log, log, repository.NewMemoryStorage())
+	h := a.Handler()
+
+	do := func(method, path, body string, authenticated bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if authenticated {
+			req.Header.Set("X-API-Key", "admin-key")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusBadRequest,
+		do(http.MethodPost, "/open311/v2/subscriptions", `{"url":"ftp://example.com"}`, true).Code)
+	assert.Equal(t, http.StatusBadRequest,
+		do(http.MethodPost, "/open311/v2/subscriptions", `{"url":"https://example.com","bbox":"1,2"}`, true).Code)
+	assert.Equal(t, http.StatusUnauthorized,
+		do(http.MethodPost, "/open311/v2/subscriptions", `{"url":"`+receiver.URL+`"}`, false).Code)
+
+	rec := do(http.MethodPost, "/open311/v2/subscriptions",
+		`{"url":"`+receiver.URL+`","service_code":"pothole","bbox":"24.9,60.1,25.0,60.2"}`, true)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var sub models.Subscription
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&sub))
+	assert.Len(t, sub.Secret, 64, "a secret is generated")
+
+	rec = do(http.MethodGet, "/open311/v2/subscriptions/"+sub.ID, "", true)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), sub.Secret, "the secret is write-only")
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/open311/v2/subscriptions", "", false).Code)
+
+	rec = do(http.MethodPost, "/open311/v2/requests",
+		`{"service_code":"pothole","description":"Hole","lat":60.1699,"long":24.9384}`, true)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created []models.ServiceRequest
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	require.Len(t, created, 1)
+	require.Equal(t, http.StatusCreated, do(http.MethodPost, "/open311/v2/requests",
+		`{"service_code":"graffiti","description":"Tag","lat":60.1699,"long":24.9384}`, true).Code)
+	require.Equal(t, http.StatusOK, do(http.MethodPatch, "/open311/v2/requests/"+created[0].ServiceRequestID,
+		`{"status":"closed"}`, true).Code)
+
+	n, err := a.Webhooks().RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n, "created and status_changed for the pothole only")
+	mu.Lock()
+	require.Len(t, delivered, 2)
+	for i, body := range delivered {
+		ts, err := strconv.ParseInt(headers[i].Get(webhooks.HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+		assert.Equal(t, webhooks.Sign(sub.Secret, ts, body), headers[i].Get(webhooks.HeaderSignature))
+	}
+	mu.Unlock()
+
+	rec = do(http.MethodGet, "/open311/v2/subscriptions/"+sub.ID+"/deliveries?status=delivered", "", true)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var history []models.WebhookDelivery
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&history))
+	require.Len(t, history, 2)
+	assert.Equal(t, webhooks.EventStatusChanged, history[0].Event)
+
+	assert.Equal(t, http.StatusConflict, do(http.MethodPost,
+		"/open311/v2/subscriptions/"+sub.ID+"/deliveries/"+history[0].ID+"/retry", "", true).Code)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/open311/v2/subscriptions/"+sub.ID, "", true).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/open311/v2/subscriptions/"+sub.ID+"/deliveries", "", true).Code)
+}
+
+// sseEvent is one event read from a Server-Sent Events stream.
+type sseEvent struct {
+	id, event, data string
+}
+
+// readSSE parses events from a stream until it ends.
+func readSSE(body io.Reader, events chan<- sseEvent) {
+	defer close(events)
+	var e sseEvent
+	sc := bufio.NewScanner(body)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if e.event != "" {
+				events <- e
+			}
+			e = sseEvent{}
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestRequestStream(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Storage.Backend = repository.BackendMemory
+	cfg.Privacy.CoordinateMode = "off"
+	cfg.Auth.APIKeys = []string{"admin-key"}
+	cfg.Stream = config.StreamConfig{History: 100, Buffer: 16, MaxClients: 3, HeartbeatSeconds: 60}
+	log, err := logger.New(logger.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+	a := New(cfg, log, log, repository.NewMemoryStorage())
+	srv := httptest.NewServer(a.Handler())
+	defer srv.Close()
+
+	open := func(query, lastEventID string) (*http.Response, <-chan sseEvent) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/open311/v2/requests/stream?"+query, nil)
+		require.NoError(t, err)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return resp, nil
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		events := make(chan sseEvent, 16)
+		go readSSE(resp.Body, events)
+		return resp, events
+	}
+	next := func(events <-chan sseEvent) sseEvent {
+		t.Helper()
+		select {
+		case e, ok := <-events:
+			require.True(t, ok, "stream ended")
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+			return sseEvent{}
+		}
+	}
+	write := func(method, path, body string) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "admin-key")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Less(t, resp.StatusCode, 300, "%s %s", method, path)
+	}
+
+	resp, _ := open("bbox=25,60,24,61", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "filters are validated like the listing")
+
+	// Potholes inside the Helsinki box only.
+	resp, events := open("service_code=pothole&bbox=24.9,60.1,25.0,60.2", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	write(http.MethodPost, "/open311/v2/requests", `{"service_code":"graffiti","lat":60.17,"long":24.94}`)
+	write(http.MethodPost, "/open311/v2/requests", `{"service_code":"pothole","lat":61.5,"long":23.76}`)
+	write(http.MethodPut, "/open311/v2/requests/sr-1",
+		`{"service_request_id":"sr-1","service_code":"pothole","lat":60.17,"long":24.94,"email":"reporter@example.com"}`)
+
+	created := next(events)
+	assert.Equal(t, repository.ChangeCreate, created.event)
+	assert.NotEmpty(t, created.id)
+	var req models.ServiceRequest
+	require.NoError(t, json.Unmarshal([]byte(created.data), &req))
+	assert.Equal(t, "sr-1", req.ServiceRequestID)
+	assert.Empty(t, req.Email, "unauthenticated streams carry the public view")
+
+	write(http.MethodPatch, "/open311/v2/requests/sr-1", `{"status":"closed"}`)
+	updated := next(events)
+	assert.Equal(t, repository.ChangeUpdate, updated.event)
+	write(http.MethodDelete, "/open311/v2/requests/sr-1", "")
+	deleted := next(events)
+	assert.Equal(t, repository.ChangeDelete, deleted.event)
+	require.NoError(t, json.Unmarshal([]byte(deleted.data), &req))
+	assert.NotNil(t, req.DeletedAt)
+
+	// A reconnect after the create event replays what it missed; an ID
+	// the hub no longer knows asks the client to reload instead.
+	resp, events = open("service_code=pothole", created.id)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, updated.id, next(events).id)
+	assert.Equal(t, deleted.id, next(events).id)
+	_, reset := open("", "0-1")
+	assert.Equal(t, "reset", next(reset).event)
+
+	// A fourth client is over the limit.
+	resp, _ = open("", "")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	// Closing the hub ends the streams.
+	a.Stream().Close()
+	for range events {
+	}
+	resp, _ = open("", "")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestRequestFeeds(t *testing.T) {
+	h := newMemoryAPI(t)
+	for _, body := range []string{
+		`{"service_code":"pothole","service_name":"Pothole","lat":60.1699,"long":24.9384,"email":"reporter@example.com"}`,
+		`{"service_code":"pothole","lat":61.4978,"long":23.761}`,
+		`{"service_code":"graffiti","lat":60.17,"long":24.94}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/open311/v2/requests", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/open311/v2/requests.atom?service_code=pothole&bbox=24.9,60.1,25.0,60.2")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "application/atom+xml; charset=utf-8", rec.Header().Get("Content-Type"))
+	var atom struct {
+		ID      string `xml:"id"`
+		Title   string `xml:"title"`
+		Entries []struct {
+			ID    string `xml:"id"`
+			Point string `xml:"http://www.georss.org/georss point"`
+			Links []struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	require.NoError(t, xml.Unmarshal(rec.Body.Bytes(), &atom))
+	assert.Equal(t, "http://example.com/open311/v2/requests.atom?service_code=pothole&bbox=24.9,60.1,25.0,60.2", atom.ID)
+	assert.Equal(t, "Service requests (bbox=24.9,60.1,25.0,60.2, service_code=pothole)", atom.Title)
+	require.Len(t, atom.Entries, 1)
+	assert.Equal(t, "60.1699 24.9384", atom.Entries[0].Point)
+	require.NotEmpty(t, atom.Entries[0].Links)
+	assert.Regexp(t, `^http://example.com/open311/v2/requests/[^/]+$`, atom.Entries[0].Links[0].Href)
+	assert.NotContains(t, rec.Body.String(), "reporter@example.com")
+
+	rec = get("/open311/v2/requests.rss?service_code=pothole")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "application/rss+xml; charset=utf-8", rec.Header().Get("Content-Type"))
+	var rss struct {
+		Items []struct {
+			GUID string `xml:"guid"`
+		} `xml:"channel>item"`
+	}
+	require.NoError(t, xml.Unmarshal(rec.Body.Bytes(), &rss))
+	assert.Len(t, rss.Items, 2)
+
+	assert.Equal(t, http.StatusBadRequest, get("/open311/v2/requests.rss?bbox=1,2").Code)
+}
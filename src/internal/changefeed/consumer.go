@@ -0,0 +1,138 @@
+// Package changefeed publishes the writes to service requests to downstream
+// sinks (a file, a webhook, a message broker) as they are committed, so
+// consumers such as the data lake need not poll with updated_after.
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/privacy"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+// Event is the published form of a change.
+type Event struct {
+	// ID is the change's resume token: unique, and the same when a change is
+	// redelivered, so sinks can deduplicate.
+	ID string `json:"id"`
+	// Operation is "create", "update" or "delete" (a soft delete).
+	Operation        string    `json:"operation"`
+	ServiceRequestID string    `json:"service_request_id"`
+	Time             time.Time `json:"time"`
+	// Version is the version of ServiceRequest, which may be later than the
+	// change itself (updates are looked up when read). Order and de-duplicate
+	// by it: a consumer drops an event no newer than what it already has.
+	Version        int64                 `json:"version"`
+	ServiceRequest models.ServiceRequest `json:"service_request"`
+}
+
+// NewEvent builds the Event of a change. Reporter contact fields are removed:
+// they are personal data (possibly encrypted at rest) and no sink needs them.
+func NewEvent(c repository.ServiceRequestChange) Event {
+	req := c.Request
+	privacy.Redact(&req)
+	return Event{
+		ID:               c.ResumeToken,
+		Operation:        c.Operation,
+		ServiceRequestID: c.ServiceRequestID,
+		Time:             c.At,
+		Version:          req.Version,
+		ServiceRequest:   req,
+	}
+}
+
+// Sink receives published events. Publish returns once the event is durably
+// handed over; an error makes the consumer retry it.
+type Sink interface {
+	Publish(ctx context.Context, e Event) error
+	Close() error
+}
+
+// Retry delays after a failure, doubling up to the maximum.
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+)
+
+// Consumer feeds a change feed to a sink. Delivery is at least once: the
+// resume token is saved after each published event, so after a failure or
+// restart the consumer resumes with the first unsaved one.
+type Consumer struct {
+	name        string
+	feed        repository.ChangeFeed
+	checkpoints repository.CheckpointStore
+	sink        Sink
+	log         logger.Logger
+	minDelay    time.Duration
+	maxDelay    time.Duration
+}
+
+// NewConsumer creates a Consumer; name keys its checkpoint, so two consumers
+// of the same feed need different names.
+func NewConsumer(name string, feed repository.ChangeFeed, checkpoints repository.CheckpointStore, sink Sink, log logger.Logger) *Consumer {
+	return &Consumer{
+		name:        name,
+		feed:        feed,
+		checkpoints: checkpoints,
+		sink:        sink,
+		log:         log,
+		minDelay:    minRetryDelay,
+		maxDelay:    maxRetryDelay,
+	}
+}
+
+// RunOnce watches the feed from the saved checkpoint and publishes every
+// change until ctx is cancelled or something fails. It returns how many
+// events were published.
+func (c *Consumer) RunOnce(ctx context.Context) (int, error) {
+	token, err := c.checkpoints.LoadCheckpoint(ctx, c.name)
+	if err != nil {
+		return 0, err
+	}
+	published := 0
+	err = c.feed.Watch(ctx, token, func(change repository.ServiceRequestChange) error {
+		if err := c.sink.Publish(ctx, NewEvent(change)); err != nil {
+			return err
+		}
+		published++
+		return c.checkpoints.SaveCheckpoint(ctx, c.name, change.ResumeToken)
+	})
+	return published, err
+}
+
+// Run consumes the feed until ctx is cancelled, retrying failures with
+// exponential backoff. When the checkpoint has fallen out of the change
+// history, it is dropped and the consumer continues from now; the gap must be
+// backfilled with updated_after.
+func (c *Consumer) Run(ctx context.Context) {
+	delay := c.minDelay
+	for {
+		n, err := c.RunOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if n > 0 {
+			delay = c.minDelay
+		}
+		switch {
+		case errors.Is(err, repository.ErrChangeHistoryLost):
+			c.log.Errorf("Change feed %s: checkpoint lost (%v); continuing from now, backfill the gap with updated_after", c.name, err)
+			if err := c.checkpoints.SaveCheckpoint(ctx, c.name, ""); err != nil {
+				c.log.Errorf("Change feed %s: failed to clear checkpoint: %v", c.name, err)
+			}
+		case err != nil:
+			c.log.Errorf("Change feed %s failed, retrying in %s: %v", c.name, delay, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, c.maxDelay)
+	}
+}
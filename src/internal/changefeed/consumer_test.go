@@ -0,0 +1,165 @@
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+// fakeFeed replays a fixed list of changes; tokens are their positions.
+type fakeFeed struct {
+	changes []repository.ServiceRequestChange
+	// lost makes the next Watch from a checkpoint fail with
+	// ErrChangeHistoryLost.
+	lost bool
+}
+
+func (f *fakeFeed) Watch(ctx context.Context, resumeAfter string, handle func(repository.ServiceRequestChange) error) error {
+	start := 0
+	if resumeAfter != "" {
+		if f.lost {
+			f.lost = false
+			return repository.ErrChangeHistoryLost
+		}
+		for i, c := range f.changes {
+			if c.ResumeToken == resumeAfter {
+				start = i + 1
+			}
+		}
+	}
+	for _, c := range f.changes[start:] {
+		if err := handle(c); err != nil {
+			return err
+		}
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type memoryCheckpoints struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func (m *memoryCheckpoints) LoadCheckpoint(_ context.Context, consumer string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tokens[consumer], nil
+}
+
+func (m *memoryCheckpoints) SaveCheckpoint(_ context.Context, consumer, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[consumer] = token
+	return nil
+}
+
+// recordingSink records events and fails the publishes listed in failOn once.
+type recordingSink struct {
+	mu     sync.Mutex
+	events []Event
+	failOn map[string]bool
+}
+
+func (s *recordingSink) Publish(_ context.Context, e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failOn[e.ID] {
+		delete(s.failOn, e.ID)
+		return errors.New("sink unavailable")
+	}
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func (s *recordingSink) ids() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, len(s.events))
+	for i, e := range s.events {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func testChanges(n int) []repository.ServiceRequestChange {
+	changes := make([]repository.ServiceRequestChange, n)
+	for i := range changes {
+		id := fmt.Sprintf("sr-%d", i)
+		changes[i] = repository.ServiceRequestChange{
+			ResumeToken:      fmt.Sprintf("t%d", i),
+			Operation:        repository.ChangeUpdate,
+			ServiceRequestID: id,
+			Request:          models.ServiceRequest{ServiceRequestID: id, Email: "reporter@example.com", Version: int64(i + 1)},
+		}
+	}
+	return changes
+}
+
+func newTestConsumer(t *testing.T, feed repository.ChangeFeed, checkpoints repository.CheckpointStore, sink Sink) *Consumer {
+	log, err := logger.New(logger.Config{Level: "fatal", Format: "text"})
+	require.NoError(t, err)
+	c := NewConsumer("lake", feed, checkpoints, sink, log)
+	c.minDelay, c.maxDelay = time.Millisecond, 5*time.Millisecond
+	return c
+}
+
+func TestNewEventRedactsContact(t *testing.T) {
+	e := NewEvent(testChanges(1)[0])
+	assert.Equal(t, "t0", e.ID)
+	assert.Equal(t, "sr-0", e.ServiceRequestID)
+	assert.Equal(t, int64(1), e.Version)
+	assert.Empty(t, e.ServiceRequest.Email)
+}
+
+func TestConsumerResumesFromCheckpoint(t *testing.T) {
+	feed := &fakeFeed{changes: testChanges(3)}
+	checkpoints := &memoryCheckpoints{tokens: map[string]string{"lake": "t0"}}
+	sink := &recordingSink{failOn: map[string]bool{"t2": true}}
+	c := newTestConsumer(t, feed, checkpoints, sink)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return len(sink.ids()) == 2 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	// t0 was already delivered; the failed t2 is retried without repeating t1.
+	assert.Equal(t, []string{"t1", "t2"}, sink.ids())
+	token, _ := checkpoints.LoadCheckpoint(ctx, "lake")
+	assert.Equal(t, "t2", token)
+}
+
+func TestConsumerRestartsWhenHistoryLost(t *testing.T) {
+	feed := &fakeFeed{changes: testChanges(2), lost: true}
+	checkpoints := &memoryCheckpoints{tokens: map[string]string{"lake": "gone"}}
+	sink := &recordingSink{}
+	c := newTestConsumer(t, feed, checkpoints, sink)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return len(sink.ids()) == 2 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, []string{"t0", "t1"}, sink.ids())
+}
@@ -0,0 +1,208 @@
+package changefeed
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsTimeout bounds connecting and each publish round trip.
+const natsTimeout = 10 * time.Second
+
+// NATSSink publishes events to a NATS server, on subject <prefix>.<operation>
+// (e.g. open311.requests.update), speaking the core client protocol directly.
+// Each publish is followed by a PING, and the sink waits for the PONG, so an
+// event counts as published only once the server has processed it (or
+// reported an -ERR). Core NATS does not store messages: for durable delivery
+// put a JetStream stream (or a NATS-to-Kafka bridge) on the subjects. The
+// connection is re-established on the next publish after a failure.
+type NATSSink struct {
+	addr    string
+	connect natsConnect
+	prefix  string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// natsConnect is the CONNECT message.
+type natsConnect struct {
+	Verbose   bool   `json:"verbose"`
+	Pedantic  bool   `json:"pedantic"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	Version   string `json:"version"`
+	User      string `json:"user,omitempty"`
+	Pass      string `json:"pass,omitempty"`
+	AuthToken string `json:"auth_token,omitempty"`
+}
+
+// natsInfo is the part of the server's INFO message the sink checks.
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// NewNATSSink creates a NATSSink for a nats://[user:pass@|token@]host[:port]
+// URL. It connects on the first publish.
+func NewNATSSink(rawURL, subjectPrefix string) (*NATSSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "nats" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q (expected nats://host:port)", rawURL)
+	}
+	if strings.ContainsAny(subjectPrefix, " \t\r\n") || subjectPrefix == "" {
+		return nil, fmt.Errorf("invalid NATS subject prefix %q", subjectPrefix)
+	}
+	s := &NATSSink{
+		addr:   u.Host,
+		prefix: subjectPrefix,
+		connect: natsConnect{
+			Name:    "open311api",
+			Lang:    "go",
+			Version: "1.0.0",
+		},
+	}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if pass, ok := u.User.Password(); ok {
+		s.connect.User, s.connect.Pass = u.User.Username(), pass
+	} else if u.User != nil {
+		s.connect.AuthToken = u.User.Username()
+	}
+	return s, nil
+}
+
+// Publish sends e and waits for the server to acknowledge it.
+func (s *NATSSink) Publish(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.publish(ctx, s.prefix+"."+e.Operation, payload); err != nil {
+		s.closeConn()
+		return fmt.Errorf("nats: %w", err)
+	}
+	return nil
+}
+
+func (s *NATSSink) publish(ctx context.Context, subject string, payload []byte) error {
+	if s.conn == nil {
+		if err := s.dial(ctx); err != nil {
+			return err
+		}
+	}
+	s.setDeadline(ctx)
+	msg := fmt.Sprintf("PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload)
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		return err
+	}
+	return s.awaitPong()
+}
+
+// dial connects, checks the server's INFO and sends CONNECT, confirmed with a
+// PING.
+func (s *NATSSink) dial(ctx context.Context) error {
+	var d net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, natsTimeout)
+	defer cancel()
+	conn, err := d.DialContext(dialCtx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+	s.setDeadline(ctx)
+
+	line, err := s.readLine()
+	if err != nil {
+		return err
+	}
+	op, args, _ := strings.Cut(line, " ")
+	if !strings.EqualFold(op, "INFO") {
+		return fmt.Errorf("expected INFO, got %q", line)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(args), &info); err != nil {
+		return fmt.Errorf("malformed INFO: %v", err)
+	}
+	if info.TLSRequired {
+		return errors.New("server requires TLS, which this sink does not support")
+	}
+
+	connect, err := json.Marshal(s.connect)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		return err
+	}
+	return s.awaitPong()
+}
+
+// awaitPong reads until the PONG answering our PING, answering server PINGs
+// and failing on -ERR.
+func (s *NATSSink) awaitPong() error {
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			return err
+		}
+		op, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(op) {
+		case "PONG":
+			return nil
+		case "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case "-ERR":
+			return fmt.Errorf("server error %s", args)
+		case "+OK", "INFO":
+		default:
+			return fmt.Errorf("unexpected %q", line)
+		}
+	}
+}
+
+func (s *NATSSink) readLine() (string, error) {
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (s *NATSSink) setDeadline(ctx context.Context) {
+	deadline := time.Now().Add(natsTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = s.conn.SetDeadline(deadline)
+}
+
+func (s *NATSSink) closeConn() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn, s.reader = nil, nil
+	}
+}
+
+// Close closes the connection.
+func (s *NATSSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeConn()
+	return nil
+}
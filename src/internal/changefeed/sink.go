@@ -0,0 +1,110 @@
+package changefeed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/config"
+)
+
+// FileSink appends events to a file as newline-delimited JSON.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens (creating if needed) the file to append to.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: f}, nil
+}
+
+// Publish writes e as one line and syncs it to disk before the checkpoint
+// moves past it.
+func (s *FileSink) Publish(_ context.Context, e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// webhookTimeout bounds one webhook delivery.
+const webhookTimeout = 10 * time.Second
+
+// WebhookSink POSTs each event as JSON to a URL. Any 2xx response accepts the
+// event; the X-Event-ID header repeats the event id for deduplication.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink creates a WebhookSink for url.
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// Publish delivers e.
+func (s *WebhookSink) Publish(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", e.ID)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s responded %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+// Close releases idle connections.
+func (s *WebhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// NewSink creates the sink cfg.Sink selects.
+func NewSink(cfg config.ChangeFeedConfig) (Sink, error) {
+	switch cfg.Sink {
+	case "file":
+		return NewFileSink(cfg.FilePath)
+	case "webhook":
+		return NewWebhookSink(cfg.WebhookURL), nil
+	case "nats":
+		return NewNATSSink(cfg.NATSURL, cfg.NATSSubject)
+	default:
+		return nil, fmt.Errorf("unknown change feed sink %q", cfg.Sink)
+	}
+}
@@ -0,0 +1,164 @@
+package changefeed
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent(id, operation string) Event {
+	e := NewEvent(testChanges(1)[0])
+	e.ID, e.Operation = id, operation
+	return e
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "changes.ndjson")
+	sink, err := NewFileSink(path)
+	require.NoError(t, err)
+	require.NoError(t, sink.Publish(context.Background(), testEvent("t1", "create")))
+	require.NoError(t, sink.Close())
+
+	// Reopening appends.
+	sink, err = NewFileSink(path)
+	require.NoError(t, err)
+	require.NoError(t, sink.Publish(context.Background(), testEvent("t2", "update")))
+	require.NoError(t, sink.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	var e Event
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &e))
+	assert.Equal(t, "t2", e.ID)
+	assert.Equal(t, "sr-0", e.ServiceRequest.ServiceRequestID)
+}
+
+func TestWebhookSink(t *testing.T) {
+	var got []Event
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var e Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		assert.Equal(t, e.ID, r.Header.Get("X-Event-ID"))
+		if status == http.StatusOK {
+			got = append(got, e)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookSink(srv.URL)
+	defer sink.Close()
+	assert.Error(t, sink.Publish(context.Background(), testEvent("t1", "create")), "a 503 is a failure")
+	status = http.StatusOK
+	require.NoError(t, sink.Publish(context.Background(), testEvent("t1", "create")))
+	require.Len(t, got, 1)
+	assert.Equal(t, "create", got[0].Operation)
+}
+
+// natsStandIn is a minimal NATS server: it greets with INFO, answers PING,
+// records PUBs and rejects subjects listed in deny with -ERR.
+type natsStandIn struct {
+	ln       net.Listener
+	messages chan string
+	deny     string
+}
+
+func newNATSStandIn(t *testing.T) *natsStandIn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &natsStandIn{ln: ln, messages: make(chan string, 10)}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *natsStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "INFO {\"server_id\":\"stand-in\",\"max_payload\":1048576}\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "CONNECT":
+			if !strings.Contains(line, `"auth_token":"secret"`) {
+				fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n")
+				return
+			}
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case "PUB":
+			n, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			if fields[1] == s.deny {
+				fmt.Fprint(conn, "-ERR 'Permissions Violation for Publish'\r\n")
+				return
+			}
+			s.messages <- fields[1] + " " + string(payload[:n])
+		}
+	}
+}
+
+func TestNATSSink(t *testing.T) {
+	server := newNATSStandIn(t)
+	server.deny = "open311.requests.delete"
+	addr := server.ln.Addr().String()
+
+	sink, err := NewNATSSink("nats://secret@"+addr, "open311.requests")
+	require.NoError(t, err)
+	defer sink.Close()
+
+	require.NoError(t, sink.Publish(context.Background(), testEvent("t1", "update")))
+	subject, payload, _ := strings.Cut(<-server.messages, " ")
+	assert.Equal(t, "open311.requests.update", subject)
+	var e Event
+	require.NoError(t, json.Unmarshal([]byte(payload), &e))
+	assert.Equal(t, "t1", e.ID)
+
+	// A rejected publish fails, and the sink reconnects for the next one.
+	assert.ErrorContains(t, sink.Publish(context.Background(), testEvent("t2", "delete")), "Permissions Violation")
+	require.NoError(t, sink.Publish(context.Background(), testEvent("t3", "create")))
+	subject, _, _ = strings.Cut(<-server.messages, " ")
+	assert.Equal(t, "open311.requests.create", subject)
+
+	unauthorized, err := NewNATSSink("nats://"+addr, "open311.requests")
+	require.NoError(t, err)
+	assert.ErrorContains(t, unauthorized.Publish(context.Background(), testEvent("t4", "create")), "Authorization Violation")
+
+	_, err = NewNATSSink("http://"+addr, "open311.requests")
+	assert.Error(t, err)
+}
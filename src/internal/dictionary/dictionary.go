@@ -0,0 +1,386 @@
+// Package dictionary loads jurisdiction data dictionaries (dictionaries/*.yaml)
+// and applies them to source rows: native columns to Open311 fields, native
+// columns to properties keys, and value normalization (e.g. "In progress" ->
+// open) from the dictionary's value sets.
+package dictionary
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // dictionary time zones do not depend on the host's zoneinfo
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// Fields are the service request fields a field mapping may target, by their
+// Open311 names.
+var Fields = []string{
+	"service_request_id", "status", "status_notes", "service_name", "service_code",
+	"description", "agency_responsible", "service_notice",
+	"requested_datetime", "updated_datetime", "expected_datetime",
+	"address", "address_id", "zipcode", "lat", "long", "media_url",
+}
+
+// Mapping maps one native column to a service request field or property key.
+type Mapping struct {
+	Column string
+	Target string
+}
+
+// ValueSet enumerates a field's or property's values. The list form only
+// names the values; the map form also normalizes a native value to the stored
+// one.
+type ValueSet struct {
+	// Values are the stored values: the list entries, or the distinct map
+	// values.
+	Values []string
+	// Normalize maps a native value to its stored value (map form only).
+	Normalize map[string]string
+}
+
+// Dictionary is a parsed data dictionary.
+type Dictionary struct {
+	// Name selects the dictionary (e.g. ?dictionary=boston): the
+	// jurisdiction.
+	Name         string
+	SourceSystem string
+	// Location is the time zone of timestamps without an offset (timezone;
+	// UTC when unset).
+	Location *time.Location
+	// Fields are the field mappings in file order; when several columns map
+	// to one field the first non-empty one wins.
+	Fields []Mapping
+	// Properties are the columns carried under properties.
+	Properties []Mapping
+	// ValueSets are keyed by field or property name.
+	ValueSets map[string]ValueSet
+	// Enforcement constrains ingested values to value sets.
+	Enforcement Enforcement
+}
+
+// document is the YAML form. The mappings are nodes so their order is kept.
+type document struct {
+	Jurisdiction  string               `yaml:"jurisdiction"`
+	SourceSystem  string               `yaml:"source_system"`
+	TimeZone      string               `yaml:"timezone"`
+	FieldMappings yaml.Node            `yaml:"field_mappings"`
+	Properties    yaml.Node            `yaml:"properties"`
+	ValueSets     map[string]yaml.Node `yaml:"value_sets"`
+	Enforcement   enforcementDoc       `yaml:"enforcement"`
+}
+
+// Parse reads a dictionary from YAML.
+func Parse(data []byte) (*Dictionary, error) {
+	var doc document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Jurisdiction == "" {
+		return nil, fmt.Errorf("jurisdiction is required")
+	}
+	d := &Dictionary{
+		Name:         strings.ToLower(doc.Jurisdiction),
+		SourceSystem: doc.SourceSystem,
+		Location:     time.UTC,
+		ValueSets:    map[string]ValueSet{},
+	}
+	if doc.TimeZone != "" {
+		loc, err := time.LoadLocation(doc.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("timezone: %w", err)
+		}
+		d.Location = loc
+	}
+
+	var err error
+	if d.Fields, err = mappings(&doc.FieldMappings, "field_mappings"); err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, f := range Fields {
+		known[f] = true
+	}
+	hasID := false
+	for _, m := range d.Fields {
+		if !known[m.Target] {
+			return nil, fmt.Errorf("field_mappings: %s: unknown field %q", m.Column, m.Target)
+		}
+		hasID = hasID || m.Target == "service_request_id"
+	}
+	if !hasID {
+		return nil, fmt.Errorf("field_mappings: no column maps to service_request_id")
+	}
+	if d.Properties, err = mappings(&doc.Properties, "properties"); err != nil {
+		return nil, err
+	}
+
+	for name, node := range doc.ValueSets {
+		var vs ValueSet
+		switch node.Kind {
+		case yaml.SequenceNode:
+			if err := node.Decode(&vs.Values); err != nil {
+				return nil, fmt.Errorf("value_sets.%s: %w", name, err)
+			}
+		case yaml.MappingNode:
+			pairs, err := mappings(&node, "value_sets."+name)
+			if err != nil {
+				return nil, err
+			}
+			vs.Normalize = make(map[string]string, len(pairs))
+			seen := map[string]bool{}
+			for _, p := range pairs {
+				vs.Normalize[p.Column] = p.Target
+				if !seen[p.Target] {
+					seen[p.Target] = true
+					vs.Values = append(vs.Values, p.Target)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("value_sets.%s: expected a list or a map", name)
+		}
+		d.ValueSets[name] = vs
+	}
+	if err := d.parseEnforcement(doc.Enforcement); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// mappings reads a YAML map of scalars in order; an absent node is empty.
+func mappings(node *yaml.Node, name string) ([]Mapping, error) {
+	if node.Kind == 0 {
+		return nil, nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: expected a map", name)
+	}
+	out := make([]Mapping, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		k, v := node.Content[i], node.Content[i+1]
+		if k.Kind != yaml.ScalarNode || v.Kind != yaml.ScalarNode || k.Value == "" || v.Value == "" {
+			return nil, fmt.Errorf("%s: line %d: expected column: name", name, k.Line)
+		}
+		out = append(out, Mapping{Column: k.Value, Target: v.Value})
+	}
+	return out, nil
+}
+
+// Load reads a dictionary file.
+func Load(path string) (*Dictionary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	d, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return d, nil
+}
+
+// Registry holds the loaded dictionaries by name.
+type Registry map[string]*Dictionary
+
+// LoadDir loads every *.yaml and *.yml file in dir, keyed by jurisdiction.
+func LoadDir(dir string) (Registry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	reg := Registry{}
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		d, err := Load(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := reg[d.Name]; dup {
+			return nil, fmt.Errorf("%s: jurisdiction %q is defined twice", filepath.Join(dir, e.Name()), d.Name)
+		}
+		reg[d.Name] = d
+	}
+	return reg, nil
+}
+
+// Normalize maps a native value to its stored value when the value set named
+// name has a map form: by its native value, or by a stored value in another
+// case ("Closed" -> closed). Other values are returned unchanged.
+func (d *Dictionary) Normalize(name, value string) string {
+	vs, ok := d.ValueSets[name]
+	if !ok || vs.Normalize == nil {
+		return value
+	}
+	for native, stored := range vs.Normalize {
+		if strings.EqualFold(native, value) {
+			return stored
+		}
+	}
+	for _, stored := range vs.Values {
+		if strings.EqualFold(stored, value) {
+			return stored
+		}
+	}
+	return value
+}
+
+// clean trims and HTML-decodes a value (city exports often carry entities such
+// as "&amp;").
+func clean(s string) string {
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+// Map converts a source row keyed by column name into a service request:
+// mapped columns become fields (normalized through their value sets), property
+// columns become properties, and empty values are left out. Timestamps without
+// an offset are read in the dictionary's time zone and stored in UTC; a missing
+// updated_datetime defaults to requested_datetime. It fails when the row has
+// no service request id or a value cannot be parsed.
+func (d *Dictionary) Map(row map[string]string) (models.ServiceRequest, error) {
+	var req models.ServiceRequest
+	set := map[string]bool{}
+	for _, m := range d.Fields {
+		v := clean(row[m.Column])
+		if v == "" || set[m.Target] {
+			continue
+		}
+		set[m.Target] = true
+		v = d.Normalize(m.Target, v)
+		if err := d.setField(&req, m.Target, v); err != nil {
+			return req, fmt.Errorf("%s: %w", m.Column, err)
+		}
+	}
+	if req.ServiceRequestID == "" {
+		return req, fmt.Errorf("no service_request_id")
+	}
+	if req.ServiceName == "" {
+		req.ServiceName = req.ServiceCode
+	}
+	if req.ServiceCode == "" {
+		req.ServiceCode = req.ServiceName
+	}
+	if req.UpdatedDatetime.IsZero() {
+		req.UpdatedDatetime = req.RequestedDatetime
+	}
+
+	for _, p := range d.Properties {
+		if v := clean(row[p.Column]); v != "" {
+			if req.Properties == nil {
+				req.Properties = models.Properties{}
+			}
+			req.Properties[p.Target] = d.Normalize(p.Target, v)
+		}
+	}
+	return req, nil
+}
+
+// setField assigns one mapped value.
+func (d *Dictionary) setField(req *models.ServiceRequest, field, v string) error {
+	var err error
+	switch field {
+	case "service_request_id":
+		req.ServiceRequestID = v
+	case "status":
+		req.Status = v
+	case "status_notes":
+		req.StatusNotes = v
+	case "service_name":
+		req.ServiceName = v
+	case "service_code":
+		req.ServiceCode = v
+	case "description":
+		req.Description = v
+	case "agency_responsible":
+		req.AgencyResponsible = v
+	case "service_notice":
+		req.ServiceNotice = v
+	case "requested_datetime":
+		req.RequestedDatetime, err = ParseTime(v, d.Location)
+	case "updated_datetime":
+		req.UpdatedDatetime, err = ParseTime(v, d.Location)
+	case "expected_datetime":
+		req.ExpectedDatetime, err = ParseTime(v, d.Location)
+	case "address":
+		req.Address = v
+	case "address_id":
+		req.AddressID = v
+	case "zipcode":
+		req.Zipcode = v
+	case "lat":
+		req.Latitude, err = strconv.ParseFloat(v, 64)
+	case "long":
+		req.Longitude, err = strconv.ParseFloat(v, 64)
+	case "media_url":
+		if strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://") {
+			req.MediaURL = v
+		}
+	}
+	return err
+}
+
+// localTimeLayouts are the offset-less timestamp formats seen in city exports.
+var localTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"01/02/2006 03:04:05 PM",
+	"1/2/2006 3:04:05 PM",
+	"1/2/2006 15:04",
+	"2006-01-02",
+}
+
+// ParseTime reads a source timestamp and returns it in UTC; the zero time when
+// empty. Timestamps with an explicit offset are taken as given, others are
+// local to loc (DST-aware). In the repeated hour when DST ends the earlier
+// (daylight) instant is chosen.
+func ParseTime(s string, loc *time.Location) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse("2006-01-02 15:04:05-07", s); err == nil {
+		return t.UTC(), nil
+	}
+	for _, layout := range localTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", s)
+}
+
+// JSONRow converts a decoded JSON object into a source row: strings as they
+// are, numbers and booleans formatted, null as empty, anything else as JSON.
+func JSONRow(obj map[string]any) map[string]string {
+	row := make(map[string]string, len(obj))
+	for k, v := range obj {
+		switch v := v.(type) {
+		case nil:
+			row[k] = ""
+		case string:
+			row[k] = v
+		case float64:
+			row[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			row[k] = strconv.FormatBool(v)
+		default:
+			b, _ := json.Marshal(v)
+			row[k] = string(b)
+		}
+	}
+	return row
+}
@@ -0,0 +1,136 @@
+package dictionary
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+func TestLoadDirBoston(t *testing.T) {
+	reg, err := LoadDir(filepath.Join("..", "..", "..", "dictionaries"))
+	require.NoError(t, err)
+	d := reg["boston"]
+	require.NotNil(t, d)
+	assert.Equal(t, "America/New_York", d.Location.String())
+	assert.Equal(t, Mapping{Column: "Case ID", Target: "service_request_id"}, d.Fields[0], "file order is kept")
+	assert.Equal(t, []string{"open", "closed"}, d.ValueSets["status"].Values)
+	assert.Equal(t, []string{"ONTIME", "OVERDUE"}, d.ValueSets["on_time"].Values)
+
+	req, err := d.Map(map[string]string{
+		"Case ID":             "BCS-00059336",
+		"Service Name":        "Pothole",
+		"Case Topic":          "Street Repair",
+		"Case Status":         "In progress",
+		"Open Date":           "11/02/2025 01:30:00 AM",
+		"Full Street Address": "1 City Hall Sq &amp; Congress St",
+		"Latitude (Y)":        "42.3603",
+		"Longitude (X)":       "-71.0580",
+		"Neighborhood":        "Downtown",
+		"Ward":                "",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "BCS-00059336", req.ServiceRequestID)
+	assert.Equal(t, "Street Repair", req.ServiceCode)
+	assert.Equal(t, "Pothole", req.ServiceName)
+	assert.Equal(t, "open", req.Status)
+	assert.Equal(t, "1 City Hall Sq & Congress St", req.Address)
+	assert.Equal(t, 42.3603, req.Latitude)
+	assert.Equal(t, time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC), req.RequestedDatetime)
+	assert.Equal(t, req.RequestedDatetime, req.UpdatedDatetime, "an open case last changed when it opened")
+	assert.Equal(t, map[string]string{"neighborhood": "Downtown"}, map[string]string(req.Properties))
+}
+
+func TestParse(t *testing.T) {
+	d, err := Parse([]byte(`
+jurisdiction: Example
+field_mappings:
+  id:      service_request_id
+  type:    service_code
+  reason:  service_code
+  state:   status
+  lat:     lat
+  lon:     long
+  updated: updated_datetime
+properties:
+  ward: ward
+value_sets:
+  status:
+    New: open
+    Done: closed
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "example", d.Name)
+	assert.Equal(t, time.UTC, d.Location)
+
+	req, err := d.Map(map[string]string{"id": "7", "type": "", "reason": "Graffiti", "state": "DONE", "lat": "1.5", "lon": "2", "updated": "2026-03-01T10:00:00+02:00"})
+	require.NoError(t, err)
+	assert.Equal(t, "Graffiti", req.ServiceCode, "the first non-empty column wins")
+	assert.Equal(t, "closed", req.Status)
+	assert.Equal(t, time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC), req.UpdatedDatetime)
+
+	req, err = d.Map(map[string]string{"id": "8", "state": "Closed"})
+	require.NoError(t, err)
+	assert.Equal(t, "closed", req.Status, "stored values match in any case")
+
+	_, err = d.Map(map[string]string{"id": "9", "lat": "north"})
+	assert.ErrorContains(t, err, "lat")
+	_, err = d.Map(map[string]string{"type": "x"})
+	assert.ErrorContains(t, err, "service_request_id")
+
+	_, err = Parse([]byte("jurisdiction: x\nfield_mappings:\n  id: service_request_id\n  a: colour\n"))
+	assert.ErrorContains(t, err, `unknown field "colour"`)
+	_, err = Parse([]byte("jurisdiction: x\nfield_mappings:\n  a: status\n"))
+	assert.ErrorContains(t, err, "service_request_id")
+}
+
+func TestJSONRow(t *testing.T) {
+	row := JSONRow(map[string]any{"s": "a", "n": 42.5, "i": float64(7), "b": true, "z": nil, "o": map[string]any{"k": "v"}})
+	assert.Equal(t, map[string]string{"s": "a", "n": "42.5", "i": "7", "b": "true", "z": "", "o": `{"k":"v"}`}, row)
+}
+
+func TestCheck(t *testing.T) {
+	d, err := Parse([]byte(`
+jurisdiction: x
+field_mappings:
+  id: service_request_id
+value_sets:
+  on_time: [ONTIME, OVERDUE]
+  zip_codes: ["02108"]
+  land_usage:
+    R1: Residential 1 Family
+enforcement:
+  mode: reject
+  rules:
+    on_time: on_time
+    zipcode: zip_codes
+    land_usage: land_usage
+`))
+	require.NoError(t, err)
+	assert.Equal(t, EnforceReject, d.Enforcement.Mode)
+
+	ok := models.ServiceRequest{Zipcode: "02108", Properties: models.Properties{"on_time": "ONTIME", "land_usage": "R1", "ward": "7"}}
+	assert.Empty(t, d.Check(ok))
+	ok.Properties["land_usage"] = "Residential 1 Family"
+	assert.Empty(t, d.Check(ok), "stored values of a map form conform too")
+
+	bad := models.ServiceRequest{Zipcode: "99999", Properties: models.Properties{"on_time": "ONTME"}}
+	assert.Equal(t, []Violation{
+		{Key: "properties.on_time", Value: "ONTME", ValueSet: "on_time"},
+		{Key: "zipcode", Value: "99999", ValueSet: "zip_codes"},
+	}, d.Check(bad))
+	assert.Equal(t, `properties.on_time: "ONTME" is not in value set on_time`, d.Check(bad)[0].String())
+
+	assert.Len(t, d.CheckValues(nil, map[string]string{"on_time": "late"}), 1)
+	var none *Dictionary
+	assert.Empty(t, none.Check(bad))
+
+	_, err = Parse([]byte("jurisdiction: x\nfield_mappings:\n  id: service_request_id\nenforcement:\n  rules:\n    on_time: missing\n"))
+	assert.ErrorContains(t, err, `no value set "missing"`)
+	_, err = Parse([]byte("jurisdiction: x\nfield_mappings:\n  id: service_request_id\nenforcement:\n  mode: strict\n"))
+	assert.ErrorContains(t, err, "unknown mode")
+}
@@ -0,0 +1,153 @@
+package dictionary
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// Enforcement modes: what a write with a value outside its value set gets.
+const (
+	// EnforceOff accepts any value.
+	EnforceOff = "off"
+	// EnforceWarn accepts the value and reports a warning.
+	EnforceWarn = "warn"
+	// EnforceReject refuses the record.
+	EnforceReject = "reject"
+)
+
+// ValidMode reports whether mode is one of the enforcement modes.
+func ValidMode(mode string) bool {
+	return mode == EnforceOff || mode == EnforceWarn || mode == EnforceReject
+}
+
+// Rule constrains a field or properties key to a value set.
+type Rule struct {
+	// Key is an Open311 string field (e.g. zipcode) or a properties key.
+	Key      string
+	ValueSet string
+}
+
+// Enforcement is a dictionary's value-set enforcement.
+type Enforcement struct {
+	// Mode is EnforceOff (the default), EnforceWarn or EnforceReject.
+	Mode  string
+	Rules []Rule
+}
+
+// enforcementDoc is the YAML form of the enforcement section.
+type enforcementDoc struct {
+	Mode  string    `yaml:"mode"`
+	Rules yaml.Node `yaml:"rules"`
+}
+
+// checkableFields are the string fields a rule may constrain.
+var checkableFields = map[string]func(models.ServiceRequest) string{
+	"status":             func(r models.ServiceRequest) string { return r.Status },
+	"service_name":       func(r models.ServiceRequest) string { return r.ServiceName },
+	"service_code":       func(r models.ServiceRequest) string { return r.ServiceCode },
+	"agency_responsible": func(r models.ServiceRequest) string { return r.AgencyResponsible },
+	"zipcode":            func(r models.ServiceRequest) string { return r.Zipcode },
+}
+
+// parseEnforcement validates the enforcement section against the value sets.
+func (d *Dictionary) parseEnforcement(doc enforcementDoc) error {
+	d.Enforcement.Mode = EnforceOff
+	if doc.Mode != "" {
+		if !ValidMode(doc.Mode) {
+			return fmt.Errorf("enforcement.mode: unknown mode %q (expected off, warn or reject)", doc.Mode)
+		}
+		d.Enforcement.Mode = doc.Mode
+	}
+	rules, err := mappings(&doc.Rules, "enforcement.rules")
+	if err != nil {
+		return err
+	}
+	known := map[string]bool{}
+	for _, f := range Fields {
+		known[f] = true
+	}
+	for _, m := range rules {
+		if _, ok := d.ValueSets[m.Target]; !ok {
+			return fmt.Errorf("enforcement.rules: %s: no value set %q", m.Column, m.Target)
+		}
+		if known[m.Column] && checkableFields[m.Column] == nil {
+			return fmt.Errorf("enforcement.rules: %s is not a checkable field", m.Column)
+		}
+		d.Enforcement.Rules = append(d.Enforcement.Rules, Rule{Key: m.Column, ValueSet: m.Target})
+	}
+	return nil
+}
+
+// Violation is a value outside the value set of its rule.
+type Violation struct {
+	// Key is the field name, or "properties.<key>".
+	Key      string
+	Value    string
+	ValueSet string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %q is not in value set %s", v.Key, v.Value, v.ValueSet)
+}
+
+// Allowed reports whether value belongs to the value set: one of its values
+// or, for the map form, one of its native values.
+func (vs ValueSet) Allowed(value string) bool {
+	if _, ok := vs.Normalize[value]; ok {
+		return true
+	}
+	return slices.Contains(vs.Values, value)
+}
+
+// Check returns the values of req outside the value sets of the enforcement
+// rules. Empty values are not checked; a nil dictionary checks nothing.
+func (d *Dictionary) Check(req models.ServiceRequest) []Violation {
+	if d == nil {
+		return nil
+	}
+	fields := map[string]string{}
+	for _, rule := range d.Enforcement.Rules {
+		if get := checkableFields[rule.Key]; get != nil {
+			fields[rule.Key] = get(req)
+		}
+	}
+	return d.CheckValues(fields, req.Properties)
+}
+
+// CheckValues is Check for loose values, e.g. the fields and properties a
+// merge patch sets. A rule's key is looked up in fields when it names a field,
+// in properties otherwise.
+func (d *Dictionary) CheckValues(fields, properties map[string]string) []Violation {
+	if d == nil {
+		return nil
+	}
+	var out []Violation
+	for _, rule := range d.Enforcement.Rules {
+		key, value := rule.Key, ""
+		if checkableFields[rule.Key] != nil {
+			value = fields[rule.Key]
+		} else {
+			value = properties[rule.Key]
+			key = "properties." + rule.Key
+		}
+		if value == "" || d.ValueSets[rule.ValueSet].Allowed(value) {
+			continue
+		}
+		out = append(out, Violation{Key: key, Value: value, ValueSet: rule.ValueSet})
+	}
+	return out
+}
+
+// Summary joins violations into one message.
+func Summary(vs []Violation) string {
+	msgs := make([]string, len(vs))
+	for i, v := range vs {
+		msgs[i] = v.String()
+	}
+	return strings.Join(msgs, "; ")
+}
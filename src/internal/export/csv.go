@@ -0,0 +1,112 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+)
+
+// csvColumns are the leading CSV columns, named like the JSON fields.
+var csvColumns = []string{
+	"id", "service_request_id", "status", "status_notes", "service_name", "service_code",
+	"description", "agency_responsible", "service_notice",
+	"requested_datetime", "updated_datetime", "expected_datetime",
+	"address", "address_id", "zipcode", "lat", "long", "media_url",
+	"featureId", "featureGuid", "organizationId",
+	"properties_schema_version", "deleted_at", "erased_at",
+}
+
+// csvWriter writes a header row and one row per request. The properties keys
+// of the dictionary get a properties.<key> column each, in dictionary order;
+// a last properties column holds the remaining keys as a JSON object.
+type csvWriter struct {
+	w    *csv.Writer
+	keys []string
+	row  []string // reused between records
+}
+
+func newCSVWriter(w io.Writer, dict *dictionary.Dictionary) (*csvWriter, error) {
+	c := &csvWriter{w: csv.NewWriter(w)}
+	header := append([]string(nil), csvColumns...)
+	if dict != nil {
+		seen := make(map[string]bool)
+		for _, m := range dict.Properties {
+			if !seen[m.Target] {
+				seen[m.Target] = true
+				c.keys = append(c.keys, m.Target)
+				header = append(header, "properties."+m.Target)
+			}
+		}
+	}
+	header = append(header, "properties")
+	if err := c.w.Write(header); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// formatTime formats a timestamp as RFC 3339 in UTC; unset is empty.
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func (c *csvWriter) Write(req models.ServiceRequest) error {
+	var lat, long string
+	if req.Latitude != 0 || req.Longitude != 0 {
+		lat, long = formatFloat(req.Latitude), formatFloat(req.Longitude)
+	}
+	var version string
+	if req.PropertiesSchemaVersion != 0 {
+		version = strconv.Itoa(req.PropertiesSchemaVersion)
+	}
+	c.row = append(c.row[:0],
+		req.ID, req.ServiceRequestID, req.Status, req.StatusNotes, req.ServiceName, req.ServiceCode,
+		req.Description, req.AgencyResponsible, req.ServiceNotice,
+		formatTime(&req.RequestedDatetime), formatTime(&req.UpdatedDatetime), formatTime(&req.ExpectedDatetime),
+		req.Address, req.AddressID, req.Zipcode, lat, long, req.MediaURL,
+		deref(req.FeatureID), deref(req.FeatureGuid), req.OrganizationID,
+		version, formatTime(req.DeletedAt), formatTime(req.ErasedAt),
+	)
+
+	rest := make(map[string]string, len(req.Properties))
+	for k, v := range req.Properties {
+		rest[k] = v
+	}
+	for _, k := range c.keys {
+		c.row = append(c.row, rest[k])
+		delete(rest, k)
+	}
+	var other string
+	if len(rest) > 0 {
+		raw, err := json.Marshal(rest)
+		if err != nil {
+			return err
+		}
+		other = string(raw)
+	}
+	return c.w.Write(append(c.row, other))
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,99 @@
+// Package export encodes service requests for bulk consumers such as the
+// data lake: NDJSON, CSV (properties flattened into columns) or Parquet. A
+// Writer takes one record at a time, so an export streamed from a database
+// cursor never holds the result set in memory. Reporter contact fields are
+// never written: exports leave the API's privacy boundary.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/privacy"
+)
+
+// Export formats.
+const (
+	FormatNDJSON  = "ndjson"
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// ContentType returns the media type of format, or "" for an unknown format.
+func ContentType(format string) string {
+	switch format {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return ""
+}
+
+// Writer encodes the records of an export.
+type Writer interface {
+	Write(req models.ServiceRequest) error
+	// Close completes the output (e.g. the Parquet footer); it does not close
+	// the underlying writer.
+	Close() error
+}
+
+// NewWriter returns a Writer of format writing to w. dict, when set, selects
+// the property columns of a CSV export.
+func NewWriter(w io.Writer, format string, dict *dictionary.Dictionary) (Writer, error) {
+	var out Writer
+	switch format {
+	case FormatNDJSON:
+		out = &ndjsonWriter{enc: json.NewEncoder(w)}
+	case FormatCSV:
+		c, err := newCSVWriter(w, dict)
+		if err != nil {
+			return nil, err
+		}
+		out = c
+	case FormatParquet:
+		out = newParquetWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+	return redacting{out}, nil
+}
+
+// redacting drops the reporter contact fields before a record is written.
+type redacting struct {
+	Writer
+}
+
+func (r redacting) Write(req models.ServiceRequest) error {
+	privacy.Redact(&req)
+	return r.Writer.Write(req)
+}
+
+// ndjsonWriter writes one JSON service request per line, as the API serves
+// them.
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(req models.ServiceRequest) error {
+	return w.enc.Encode(req)
+}
+
+func (w *ndjsonWriter) Close() error {
+	return nil
+}
+
+// optionalTime returns nil for the zero time (an unset timestamp).
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
@@ -0,0 +1,116 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+)
+
+func sampleRequests() []models.ServiceRequest {
+	updated := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	deleted := updated.Add(time.Hour)
+	return []models.ServiceRequest{
+		{
+			ID: "1", ServiceRequestID: "BCS-1", Status: "open", ServiceCode: "POTHOLE",
+			Description: "Deep, \"wide\" hole", Email: "a@example.com", Phone: "555-0100",
+			RequestedDatetime: updated.Add(-time.Hour), UpdatedDatetime: updated,
+			Latitude: 42.35, Longitude: -71.06,
+			Properties: map[string]string{"neighborhood": "Dorchester", "on_time": "ONTIME", "legacy_code": "7"},
+		},
+		{
+			ID: "2", ServiceRequestID: "BCS-2", Status: "closed", ServiceCode: "GRAFFITI",
+			RequestedDatetime: updated, UpdatedDatetime: updated.Add(time.Minute), DeletedAt: &deleted,
+		},
+	}
+}
+
+func writeAll(t *testing.T, format string, dict *dictionary.Dictionary) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format, dict)
+	require.NoError(t, err)
+	for _, req := range sampleRequests() {
+		require.NoError(t, w.Write(req))
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestNDJSON(t *testing.T) {
+	out := writeAll(t, FormatNDJSON, nil)
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	require.Len(t, lines, 2)
+	var first models.ServiceRequest
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.Equal(t, "BCS-1", first.ServiceRequestID)
+	assert.Equal(t, "Dorchester", first.Properties["neighborhood"])
+	assert.NotContains(t, string(out), "a@example.com", "contact fields are redacted")
+	assert.NotContains(t, string(out), "555-0100")
+}
+
+func TestCSV(t *testing.T) {
+	dict, err := dictionary.Load("../../../dictionaries/boston-311.yaml")
+	require.NoError(t, err)
+
+	rows, err := csv.NewReader(bytes.NewReader(writeAll(t, FormatCSV, dict))).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	header := rows[0]
+	col := func(row []string, name string) string {
+		for i, h := range header {
+			if h == name {
+				return row[i]
+			}
+		}
+		t.Fatalf("no column %q in %v", name, header)
+		return ""
+	}
+
+	assert.Equal(t, "properties", header[len(header)-1])
+	assert.Equal(t, `Deep, "wide" hole`, col(rows[1], "description"))
+	assert.Equal(t, "2026-03-01T12:00:00Z", col(rows[1], "updated_datetime"))
+	assert.Equal(t, "", col(rows[1], "expected_datetime"))
+	assert.Equal(t, "42.35", col(rows[1], "lat"))
+	assert.Equal(t, "Dorchester", col(rows[1], "properties.neighborhood"))
+	assert.Equal(t, "ONTIME", col(rows[1], "properties.on_time"))
+	assert.JSONEq(t, `{"legacy_code":"7"}`, col(rows[1], "properties"), "keys outside the dictionary stay as JSON")
+	assert.Equal(t, "", col(rows[2], "lat"), "no coordinates")
+	assert.Equal(t, "2026-03-01T13:00:00Z", col(rows[2], "deleted_at"))
+	assert.Equal(t, "", col(rows[2], "properties"))
+
+	rows, err = csv.NewReader(bytes.NewReader(writeAll(t, FormatCSV, nil))).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, append(append([]string(nil), csvColumns...), "properties"), rows[0])
+}
+
+func TestParquet(t *testing.T) {
+	out := writeAll(t, FormatParquet, nil)
+	recs, err := parquet.Read[parquetRecord](bytes.NewReader(out), int64(len(out)))
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+
+	assert.Equal(t, "BCS-1", recs[0].ServiceRequestID)
+	assert.True(t, recs[0].UpdatedDatetime.Equal(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)))
+	require.NotNil(t, recs[0].Latitude)
+	assert.Equal(t, 42.35, *recs[0].Latitude)
+	assert.Equal(t, "Dorchester", recs[0].Properties["neighborhood"])
+	assert.Nil(t, recs[0].ExpectedDatetime)
+	assert.Nil(t, recs[1].Latitude)
+	require.NotNil(t, recs[1].DeletedAt)
+	assert.NotContains(t, string(out), "a@example.com")
+}
+
+func TestUnknownFormat(t *testing.T) {
+	assert.Empty(t, ContentType("xlsx"))
+	_, err := NewWriter(&bytes.Buffer{}, "xlsx", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,126 @@
+package export
+
+import (
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+const (
+	// parquetBatchSize is how many records are handed to the Parquet writer
+	// at once.
+	parquetBatchSize = 500
+	// parquetRowGroupSize bounds the rows buffered in memory before a row
+	// group is written out.
+	parquetRowGroupSize = 20000
+)
+
+// parquetRecord is the Parquet schema of a service request. Columns are
+// named like the JSON fields; properties is a MAP<string,string>.
+type parquetRecord struct {
+	ID                      string            `parquet:"id"`
+	ServiceRequestID        string            `parquet:"service_request_id"`
+	Status                  string            `parquet:"status,dict"`
+	StatusNotes             string            `parquet:"status_notes"`
+	ServiceName             string            `parquet:"service_name,dict"`
+	ServiceCode             string            `parquet:"service_code,dict"`
+	Description             string            `parquet:"description"`
+	AgencyResponsible       string            `parquet:"agency_responsible,dict"`
+	ServiceNotice           string            `parquet:"service_notice"`
+	RequestedDatetime       time.Time         `parquet:"requested_datetime,timestamp(millisecond)"`
+	UpdatedDatetime         time.Time         `parquet:"updated_datetime,timestamp(millisecond)"`
+	ExpectedDatetime        *time.Time        `parquet:"expected_datetime,optional,timestamp(millisecond)"`
+	Address                 string            `parquet:"address"`
+	AddressID               string            `parquet:"address_id"`
+	Zipcode                 string            `parquet:"zipcode"`
+	Latitude                *float64          `parquet:"lat,optional"`
+	Longitude               *float64          `parquet:"long,optional"`
+	MediaURL                string            `parquet:"media_url"`
+	FeatureID               *string           `parquet:"featureId,optional"`
+	FeatureGuid             *string           `parquet:"featureGuid,optional"`
+	OrganizationID          string            `parquet:"organizationId"`
+	Properties              map[string]string `parquet:"properties"`
+	PropertiesSchemaVersion int32             `parquet:"properties_schema_version"`
+	DeletedAt               *time.Time        `parquet:"deleted_at,optional,timestamp(millisecond)"`
+	ErasedAt                *time.Time        `parquet:"erased_at,optional,timestamp(millisecond)"`
+}
+
+func toParquet(req models.ServiceRequest) parquetRecord {
+	rec := parquetRecord{
+		ID:                      req.ID,
+		ServiceRequestID:        req.ServiceRequestID,
+		Status:                  req.Status,
+		StatusNotes:             req.StatusNotes,
+		ServiceName:             req.ServiceName,
+		ServiceCode:             req.ServiceCode,
+		Description:             req.Description,
+		AgencyResponsible:       req.AgencyResponsible,
+		ServiceNotice:           req.ServiceNotice,
+		RequestedDatetime:       req.RequestedDatetime.UTC(),
+		UpdatedDatetime:         req.UpdatedDatetime.UTC(),
+		ExpectedDatetime:        optionalTime(req.ExpectedDatetime),
+		Address:                 req.Address,
+		AddressID:               req.AddressID,
+		Zipcode:                 req.Zipcode,
+		MediaURL:                req.MediaURL,
+		FeatureID:               req.FeatureID,
+		FeatureGuid:             req.FeatureGuid,
+		OrganizationID:          req.OrganizationID,
+		Properties:              req.Properties,
+		PropertiesSchemaVersion: int32(req.PropertiesSchemaVersion),
+	}
+	if req.Latitude != 0 || req.Longitude != 0 {
+		lat, long := req.Latitude, req.Longitude
+		rec.Latitude, rec.Longitude = &lat, &long
+	}
+	if req.DeletedAt != nil {
+		rec.DeletedAt = optionalTime(*req.DeletedAt)
+	}
+	if req.ErasedAt != nil {
+		rec.ErasedAt = optionalTime(*req.ErasedAt)
+	}
+	return rec
+}
+
+// parquetWriter writes a Snappy-compressed Parquet file. Rows are buffered
+// up to a row group; Close writes the last one and the footer.
+type parquetWriter struct {
+	w     *parquet.GenericWriter[parquetRecord]
+	batch []parquetRecord
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	return &parquetWriter{
+		w: parquet.NewGenericWriter[parquetRecord](w,
+			parquet.Compression(&parquet.Snappy),
+			parquet.MaxRowsPerRowGroup(parquetRowGroupSize)),
+		batch: make([]parquetRecord, 0, parquetBatchSize),
+	}
+}
+
+func (p *parquetWriter) flush() error {
+	if len(p.batch) == 0 {
+		return nil
+	}
+	_, err := p.w.Write(p.batch)
+	clear(p.batch)
+	p.batch = p.batch[:0]
+	return err
+}
+
+func (p *parquetWriter) Write(req models.ServiceRequest) error {
+	p.batch = append(p.batch, toParquet(req))
+	if len(p.batch) < parquetBatchSize {
+		return nil
+	}
+	return p.flush()
+}
+
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	return p.w.Close()
+}
@@ -0,0 +1,268 @@
+// Package feeds renders service request listings as Atom 1.0 and RSS 2.0
+// syndication feeds with GeoRSS-Simple points, for feed readers following
+// recent reports.
+package feeds
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// XML namespaces of the feeds.
+const (
+	atomNS   = "http://www.w3.org/2005/Atom"
+	geoRSSNS = "http://www.georss.org/georss"
+)
+
+// Content types of the rendered feeds.
+const (
+	AtomContentType = "application/atom+xml; charset=utf-8"
+	RSSContentType  = "application/rss+xml; charset=utf-8"
+)
+
+// Feed describes the listing a feed renders.
+type Feed struct {
+	// Title names the feed, e.g. including its filters.
+	Title string
+	// SelfURL is the absolute URL of the feed itself; it is also the Atom
+	// feed id, so a feed is identified by its filters.
+	SelfURL string
+	// AlternateURL is the absolute URL of the same listing as JSON.
+	AlternateURL string
+	// RequestURL returns the absolute URL of one request.
+	RequestURL func(serviceRequestID string) string
+	// Now is the feed's update time when it has no entries.
+	Now time.Time
+}
+
+// EntryID is the stable id of a request's entry: it depends on the
+// service_request_id only, not on the host serving the feed.
+func EntryID(serviceRequestID string) string {
+	return "urn:open311:service_request:" + serviceRequestID
+}
+
+// updated is the time a request last changed.
+func updated(req models.ServiceRequest) time.Time {
+	if !req.UpdatedDatetime.IsZero() {
+		return req.UpdatedDatetime
+	}
+	return req.RequestedDatetime
+}
+
+// title is the headline of a request's entry, e.g. "Pothole at 1 Main St".
+func title(req models.ServiceRequest) string {
+	name := req.ServiceName
+	if name == "" {
+		name = req.ServiceCode
+	}
+	if name == "" {
+		name = "Service request " + req.ServiceRequestID
+	}
+	if req.Address != "" {
+		name += " at " + req.Address
+	}
+	if req.Status != "" {
+		name += " (" + req.Status + ")"
+	}
+	return name
+}
+
+// point renders GeoRSS-Simple "lat long", or "" for a request without a
+// location.
+func point(req models.ServiceRequest) string {
+	if req.Latitude == 0 && req.Longitude == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(req.Latitude, 'f', -1, 64) + " " + strconv.FormatFloat(req.Longitude, 'f', -1, 64)
+}
+
+// summary is the entry text: the description, then the status notes.
+func summary(req models.ServiceRequest) string {
+	parts := make([]string, 0, 2)
+	for _, s := range []string{req.Description, req.StatusNotes} {
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// AtomFeed is an Atom 1.0 feed document.
+type AtomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	NS       string      `xml:"xmlns,attr"`
+	GeoRSSNS string      `xml:"xmlns:georss,attr"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Updated  string      `xml:"updated"`
+	Author   AtomPerson  `xml:"author"`
+	Links    []AtomLink  `xml:"link"`
+	Entries  []AtomEntry `xml:"entry"`
+}
+
+// AtomPerson is an Atom author.
+type AtomPerson struct {
+	Name string `xml:"name"`
+}
+
+// AtomLink is an Atom link.
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+// AtomCategory is an Atom category.
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+// AtomEntry is one request in an Atom feed.
+type AtomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Author     *AtomPerson    `xml:"author,omitempty"`
+	Links      []AtomLink     `xml:"link"`
+	Categories []AtomCategory `xml:"category"`
+	Summary    string         `xml:"summary,omitempty"`
+	Point      string         `xml:"georss:point,omitempty"`
+}
+
+// Atom renders reqs as an Atom feed. The feed is updated when its newest
+// entry was.
+func Atom(f Feed, reqs []models.ServiceRequest) AtomFeed {
+	feed := AtomFeed{
+		NS:       atomNS,
+		GeoRSSNS: geoRSSNS,
+		ID:       f.SelfURL,
+		Title:    f.Title,
+		Author:   AtomPerson{Name: "Open311"},
+		Links: []AtomLink{
+			{Href: f.SelfURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.AlternateURL, Rel: "alternate", Type: "application/json"},
+		},
+		Entries: make([]AtomEntry, 0, len(reqs)),
+	}
+	last := time.Time{}
+	for _, req := range reqs {
+		changed := updated(req)
+		if changed.After(last) {
+			last = changed
+		}
+		e := AtomEntry{
+			ID:      EntryID(req.ServiceRequestID),
+			Title:   title(req),
+			Updated: changed.UTC().Format(time.RFC3339),
+			Links:   []AtomLink{{Href: f.RequestURL(req.ServiceRequestID), Rel: "alternate", Type: "application/json"}},
+			Summary: summary(req),
+			Point:   point(req),
+		}
+		if !req.RequestedDatetime.IsZero() {
+			e.Published = req.RequestedDatetime.UTC().Format(time.RFC3339)
+		}
+		if req.AgencyResponsible != "" {
+			e.Author = &AtomPerson{Name: req.AgencyResponsible}
+		}
+		if req.ServiceCode != "" {
+			e.Categories = []AtomCategory{{Term: req.ServiceCode, Label: req.ServiceName}}
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+	if last.IsZero() {
+		last = f.Now
+	}
+	feed.Updated = last.UTC().Format(time.RFC3339)
+	return feed
+}
+
+// RSSFeed is an RSS 2.0 document.
+type RSSFeed struct {
+	XMLName  xml.Name   `xml:"rss"`
+	Version  string     `xml:"version,attr"`
+	AtomNS   string     `xml:"xmlns:atom,attr"`
+	GeoRSSNS string     `xml:"xmlns:georss,attr"`
+	Channel  RSSChannel `xml:"channel"`
+}
+
+// RSSChannel is the channel of an RSS feed.
+type RSSChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          RSSLink   `xml:"atom:link"`
+	Items         []RSSItem `xml:"item"`
+}
+
+// RSSLink is the atom:link rel="self" of an RSS channel.
+type RSSLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// RSSGUID is an item guid; entry ids are not URLs, so never a permalink.
+type RSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSSCategory is an item category.
+type RSSCategory struct {
+	Domain string `xml:"domain,attr,omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+// RSSItem is one request in an RSS feed. pubDate is the time it last
+// changed, so readers surface updates.
+type RSSItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        RSSGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Description string        `xml:"description,omitempty"`
+	Categories  []RSSCategory `xml:"category"`
+	Point       string        `xml:"georss:point,omitempty"`
+}
+
+// RSS renders reqs as an RSS 2.0 feed.
+func RSS(f Feed, reqs []models.ServiceRequest) RSSFeed {
+	channel := RSSChannel{
+		Title:       f.Title,
+		Link:        f.AlternateURL,
+		Description: f.Title,
+		Self:        RSSLink{Href: f.SelfURL, Rel: "self", Type: "application/rss+xml"},
+		Items:       make([]RSSItem, 0, len(reqs)),
+	}
+	last := time.Time{}
+	for _, req := range reqs {
+		changed := updated(req)
+		if changed.After(last) {
+			last = changed
+		}
+		item := RSSItem{
+			Title:       title(req),
+			Link:        f.RequestURL(req.ServiceRequestID),
+			GUID:        RSSGUID{Value: EntryID(req.ServiceRequestID)},
+			PubDate:     changed.UTC().Format(time.RFC1123Z),
+			Description: summary(req),
+			Point:       point(req),
+		}
+		if req.ServiceCode != "" {
+			item.Categories = []RSSCategory{{Domain: "service_code", Value: req.ServiceCode}}
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	if last.IsZero() {
+		last = f.Now
+	}
+	channel.LastBuildDate = last.UTC().Format(time.RFC1123Z)
+	return RSSFeed{Version: "2.0", AtomNS: atomNS, GeoRSSNS: geoRSSNS, Channel: channel}
+}
@@ -0,0 +1,85 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+func testFeed() Feed {
+	return Feed{
+		Title:        "Service requests (service_code=pothole)",
+		SelfURL:      "https://api.example.com/open311/v2/requests.atom?service_code=pothole",
+		AlternateURL: "https://api.example.com/open311/v2/requests?service_code=pothole",
+		RequestURL:   func(id string) string { return "https://api.example.com/open311/v2/requests/" + id },
+		Now:          time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func testRequests() []models.ServiceRequest {
+	return []models.ServiceRequest{
+		{
+			ServiceRequestID:  "sr-2",
+			ServiceCode:       "pothole",
+			ServiceName:       "Pothole",
+			Status:            "open",
+			Address:           "1 Main St",
+			Description:       "Deep <hole> & cracks",
+			AgencyResponsible: "Public Works",
+			Latitude:          42.3601,
+			Longitude:         -71.0589,
+			RequestedDatetime: time.Date(2025, 2, 1, 8, 0, 0, 0, time.UTC),
+			UpdatedDatetime:   time.Date(2025, 2, 3, 9, 30, 0, 0, time.UTC),
+		},
+		{
+			ServiceRequestID:  "sr-1",
+			ServiceCode:       "pothole",
+			RequestedDatetime: time.Date(2025, 1, 5, 8, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestAtom(t *testing.T) {
+	out, err := xml.Marshal(Atom(testFeed(), testRequests()))
+	require.NoError(t, err)
+	doc := string(out)
+
+	assert.Contains(t, doc, `<feed xmlns="http://www.w3.org/2005/Atom" xmlns:georss="http://www.georss.org/georss">`)
+	assert.Contains(t, doc, `<updated>2025-02-03T09:30:00Z</updated><author>`, "the feed is as new as its newest entry")
+	assert.Contains(t, doc, `<link href="https://api.example.com/open311/v2/requests.atom?service_code=pothole" rel="self" type="application/atom+xml">`)
+	assert.Contains(t, doc, `<id>urn:open311:service_request:sr-2</id><title>Pothole at 1 Main St (open)</title><updated>2025-02-03T09:30:00Z</updated><published>2025-02-01T08:00:00Z</published>`)
+	assert.Contains(t, doc, `<summary>Deep &lt;hole&gt; &amp; cracks</summary><georss:point>42.3601 -71.0589</georss:point>`)
+	assert.Contains(t, doc, `<category term="pothole" label="Pothole">`)
+	assert.Contains(t, doc, `<id>urn:open311:service_request:sr-1</id><title>pothole</title><updated>2025-01-05T08:00:00Z</updated>`,
+		"without updated_datetime the entry is as old as the request")
+	assert.Equal(t, 1, strings.Count(doc, "<georss:point>"), "requests without a location have no point")
+
+	var parsed struct {
+		Entries []struct {
+			ID string `xml:"id"`
+		} `xml:"entry"`
+	}
+	require.NoError(t, xml.Unmarshal(out, &parsed))
+	assert.Len(t, parsed.Entries, 2)
+
+	empty := Atom(testFeed(), nil)
+	assert.Equal(t, "2025-03-01T12:00:00Z", empty.Updated)
+	assert.Equal(t, testFeed().SelfURL, empty.ID)
+}
+
+func TestRSS(t *testing.T) {
+	out, err := xml.Marshal(RSS(testFeed(), testRequests()))
+	require.NoError(t, err)
+	doc := string(out)
+
+	assert.Contains(t, doc, `<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom" xmlns:georss="http://www.georss.org/georss">`)
+	assert.Contains(t, doc, `<lastBuildDate>Mon, 03 Feb 2025 09:30:00 +0000</lastBuildDate>`)
+	assert.Contains(t, doc, `<atom:link href="https://api.example.com/open311/v2/requests.atom?service_code=pothole" rel="self" type="application/rss+xml">`)
+	assert.Contains(t, doc, `<link>https://api.example.com/open311/v2/requests/sr-2</link><guid isPermaLink="false">urn:open311:service_request:sr-2</guid><pubDate>Mon, 03 Feb 2025 09:30:00 +0000</pubDate>`)
+	assert.Contains(t, doc, `<category domain="service_code">pothole</category><georss:point>42.3601 -71.0589</georss:point>`)
+}
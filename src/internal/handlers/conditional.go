@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
+)
+
+// setViewCaching marks a response whose body depends on the caller's view
+// (public, or with contact fields and exact locations): it varies by
+// X-API-Key, and a response to an API key is private, so a shared cache never
+// stores a privileged body or answers public clients' If-None-Match from it.
+func setViewCaching(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	if !slices.Contains(h.Values("Vary"), "X-API-Key") {
+		h.Add("Vary", "X-API-Key")
+	}
+	if httputil.Authenticated(r) {
+		h.Set("Cache-Control", "private")
+	}
+}
+
+// etag renders a service request version as a strong entity tag, e.g. "v3".
+func etag(version int64) string {
+	return `"v` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseETags splits an If-Match / If-None-Match header into its entity tags.
+// Weak tags (W/"v3") are accepted and compared by value.
+func parseETags(header string) []string {
+	var tags []string
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		t = strings.TrimPrefix(t, "W/")
+		if t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// preconditionFromRequest translates If-Match into a repository precondition.
+// "*" requires the request to exist; a list of tags requires one of those
+// versions. Tags that are not ours can never match, so a header made only of
+// foreign tags yields ok=false and the caller should answer 412 directly.
+func preconditionFromRequest(r *http.Request) (pre repository.Precondition, ok bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return pre, true
+	}
+	for _, t := range parseETags(header) {
+		if t == "*" {
+			pre.MustExist = true
+			continue
+		}
+		v, err := strconv.ParseInt(strings.TrimPrefix(strings.Trim(t, `"`), "v"), 10, 64)
+		if err != nil || !strings.HasPrefix(t, `"v`) {
+			continue
+		}
+		pre.IfVersions = append(pre.IfVersions, v)
+	}
+	if !pre.Conditional() {
+		return pre, false
+	}
+	// An explicit version list already implies existence.
+	if len(pre.IfVersions) > 0 {
+		pre.MustExist = false
+	}
+	return pre, true
+}
+
+// notModified reports whether If-None-Match matches the current entity tag, in
+// which case a GET should answer 304.
+func notModified(r *http.Request, current string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, t := range parseETags(header) {
+		if t == "*" || t == current {
+			return true
+		}
+	}
+	return false
+}
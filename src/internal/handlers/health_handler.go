@@ -19,22 +19,23 @@ type healthResponse struct {
 	Timestamp string   `json:"timestamp" xml:"timestamp"`
 }
 
-// HealthHandler reports service liveness and MongoDB connectivity.
+// HealthHandler reports service liveness and storage backend connectivity.
 type HealthHandler struct {
 	BaseHandler
-	db *repository.MongoDB
+	db repository.Pinger
 }
 
 // NewHealthHandler creates a new HealthHandler.
-func NewHealthHandler(log logger.Logger, db *repository.MongoDB) *HealthHandler {
+func NewHealthHandler(log logger.Logger, db repository.Pinger) *HealthHandler {
 	return &HealthHandler{
 		BaseHandler: BaseHandler{log: log},
 		db:          db,
 	}
 }
 
-// Health handles GET /health. It pings MongoDB and returns 200 when reachable,
-// 503 otherwise, so it doubles as a connectivity check for load balancers.
+// Health handles GET /health. It pings the storage backend and returns 200 when
+// reachable, 503 otherwise, so it doubles as a connectivity check for load
+// balancers.
 func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
 	defer cancel()
@@ -46,7 +47,7 @@ func (h *HealthHandler) Health(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.db.Ping(ctx); err != nil {
-		h.log.Errorf("health check: MongoDB ping failed: %v", err)
+		h.log.Errorf("health check: storage ping failed: %v", err)
 		resp.Status = "unhealthy"
 		resp.Database = "unreachable"
 		h.SendResponse(w, r, http.StatusServiceUnavailable, resp)
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+// uploadIdleTimeout bounds each read of an import upload; the server's
+// ReadTimeout would otherwise end every large upload.
+const uploadIdleTimeout = 60 * time.Second
+
+// ImportQueue stores uploaded files as import jobs and controls their runs
+// (implemented by jobs.Runner).
+type ImportQueue interface {
+	Enqueue(ctx context.Context, job models.ImportJob, body io.Reader) (models.ImportJob, error)
+	Cancel(ctx context.Context, id string) (models.ImportJob, error)
+	Resume(ctx context.Context, id string) (models.ImportJob, error)
+}
+
+// JobHandler handles the background import job endpoints. Every one requires
+// an API key, even with API_KEYS unset, so a job can always be followed.
+type JobHandler struct {
+	BaseHandler
+	repo     repository.ImportJobRepository
+	queue    ImportQueue
+	dicts    dictionary.Registry
+	maxBytes int64
+}
+
+// NewJobHandler creates a JobHandler. dicts are the dictionaries uploads may
+// name; maxBytes caps an upload after decompression.
+func NewJobHandler(log logger.Logger, repo repository.ImportJobRepository, queue ImportQueue, dicts dictionary.Registry, maxBytes int64) *JobHandler {
+	return &JobHandler{
+		BaseHandler: BaseHandler{log: log},
+		repo:        repo,
+		queue:       queue,
+		dicts:       dicts,
+		maxBytes:    maxBytes,
+	}
+}
+
+// sendJobError maps a repository error of a job lookup or action.
+func (h *JobHandler) sendJobError(w http.ResponseWriter, r *http.Request, err error, action string) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		h.SendError(w, r, http.StatusNotFound, "Job not found")
+	case errors.Is(err, repository.ErrInvalidID):
+		h.SendError(w, r, http.StatusBadRequest, "Invalid job ID format")
+	case errors.Is(err, repository.ErrInvalidState):
+		h.SendError(w, r, http.StatusConflict, "Cannot "+action+" a job in this state")
+	default:
+		h.log.Errorf("Failed to %s job: %v", action, err)
+		h.SendError(w, r, http.StatusInternalServerError, "Failed to "+action+" job")
+	}
+}
+
+// importFormat picks the format of an upload from its Content-Type.
+func importFormat(contentType string) string {
+	ct := strings.ToLower(contentType)
+	switch {
+	case strings.Contains(ct, "ndjson"):
+		return models.ImportFormatNDJSON
+	case strings.Contains(ct, "json"):
+		return models.ImportFormatJSON
+	case strings.Contains(ct, "csv"):
+		return models.ImportFormatCSV
+	}
+	return ""
+}
+
+// deadlineReader extends the read deadline of the request before every read,
+// so an upload only times out when it stalls.
+type deadlineReader struct {
+	r  io.Reader
+	rc *http.ResponseController
+}
+
+func (d deadlineReader) Read(p []byte) (int, error) {
+	_ = d.rc.SetReadDeadline(time.Now().Add(uploadIdleTimeout))
+	return d.r.Read(p)
+}
+
+// CreateImportJob handles POST /open311/v2/jobs/imports: the body is a file
+// to import in the background — a JSON array (application/json) or NDJSON
+// (application/x-ndjson) of service requests, or with ?dictionary=<name> of
+// native source rows, or a CSV export (text/csv, dictionary required).
+// only_if_newer=true keeps stored records that are as new or newer, and the
+// body may be gzip-compressed (Content-Encoding: gzip). The file is stored
+// and the response is 202 with the queued job; GET /jobs/{id} follows it.
+func (h *JobHandler) CreateImportJob(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAPIKey(w, r, "jobs") {
+		return
+	}
+	job := models.ImportJob{Format: importFormat(r.Header.Get("Content-Type"))}
+	if job.Format == "" {
+		h.SendError(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json, application/x-ndjson or text/csv")
+		return
+	}
+	q := r.URL.Query()
+	if v := q.Get("only_if_newer"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			h.SendError(w, r, http.StatusBadRequest, "invalid only_if_newer (expected true or false)")
+			return
+		}
+		job.OnlyIfNewer = b
+	}
+	if name := q.Get("dictionary"); name != "" {
+		job.Dictionary = strings.ToLower(name)
+		if h.dicts[job.Dictionary] == nil {
+			h.SendError(w, r, http.StatusBadRequest, "unknown dictionary "+strconv.Quote(name))
+			return
+		}
+	}
+	if job.Format == models.ImportFormatCSV && job.Dictionary == "" {
+		h.SendError(w, r, http.StatusBadRequest, "a CSV import needs ?dictionary=<name>")
+		return
+	}
+
+	var body io.ReadCloser = r.Body
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			h.SendError(w, r, http.StatusBadRequest, "Invalid gzip request body")
+			return
+		}
+		defer zr.Close()
+		body = zr
+	}
+	body = http.MaxBytesReader(w, body, h.maxBytes)
+
+	created, err := h.queue.Enqueue(r.Context(), job, deadlineReader{r: body, rc: http.NewResponseController(w)})
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		h.SendError(w, r, http.StatusRequestEntityTooLarge, "upload larger than "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes")
+		return
+	case err != nil:
+		h.log.Errorf("Failed to queue import job: %v", err)
+		h.SendError(w, r, http.StatusInternalServerError, "Failed to queue import job")
+		return
+	}
+	w.Header().Set("Location", "/open311/v2/jobs/"+created.ID)
+	h.SendResponse(w, r, http.StatusAccepted, created)
+}
+
+// GetJob handles GET /open311/v2/jobs/{id} (API key required): the job's
+// status, counts and the first skipped or failed records.
+func (h *JobHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAPIKey(w, r, "jobs") {
+		return
+	}
+	job, err := h.repo.FindByID(r.Context(), httputil.GetPathParam(r, "id"))
+	if err != nil {
+		h.sendJobError(w, r, err, "get")
+		return
+	}
+	h.SendResponse(w, r, http.StatusOK, job)
+}
+
+// CancelJob handles POST /open311/v2/jobs/{id}/cancel: a queued job is
+// cancelled at once, a running one stops after its current batch
+// (cancel_requested until then). 409 for finished jobs.
+func (h *JobHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAPIKey(w, r, "jobs") {
+		return
+	}
+	job, err := h.queue.Cancel(r.Context(), httputil.GetPathParam(r, "id"))
+	if err != nil {
+		h.sendJobError(w, r, err, "cancel")
+		return
+	}
+	h.SendResponse(w, r, http.StatusAccepted, job)
+}
+
+// ResumeJob handles POST /open311/v2/jobs/{id}/resume: a failed or cancelled
+// job is queued again and continues after its last written batch. 409 for
+// jobs in any other state.
+func (h *JobHandler) ResumeJob(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAPIKey(w, r, "jobs") {
+		return
+	}
+	job, err := h.queue.Resume(r.Context(), httputil.GetPathParam(r, "id"))
+	if err != nil {
+		h.sendJobError(w, r, err, "resume")
+		return
+	}
+	h.SendResponse(w, r, http.StatusAccepted, job)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/jobs"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
+)
+
+func TestImportJobEndpoints(t *testing.T) {
+	repo := repository.NewMemoryImportJobRepository()
+	runner := jobs.NewRunner(repo, repository.NewMemoryServiceRequestRepository(),
+		config.ImportJobsConfig{Dir: t.TempDir(), Workers: 1}, nil)
+	handler := NewJobHandler(nil, repo, runner, dictionary.Registry{"boston": {Name: "boston"}}, 128)
+	authenticated := func(r *http.Request) *http.Request {
+		return r.WithContext(httputil.WithPrincipal(r.Context(), httputil.Principal{KeyID: "k"}))
+	}
+
+	upload := func(contentType, query string, body []byte, gz bool) *httptest.ResponseRecorder {
+		r := authenticated(httptest.NewRequest(http.MethodPost, "/open311/v2/jobs/imports"+query, bytes.NewReader(body)))
+		r.Header.Set("Content-Type", contentType)
+		if gz {
+			r.Header.Set("Content-Encoding", "gzip")
+		}
+		w := httptest.NewRecorder()
+		handler.CreateImportJob(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, upload("text/plain", "", nil, false).Code)
+	assert.Equal(t, http.StatusBadRequest, upload("text/csv", "", nil, false).Code, "CSV needs a dictionary")
+	assert.Equal(t, http.StatusBadRequest, upload("text/csv", "?dictionary=nope", nil, false).Code)
+	assert.Equal(t, http.StatusBadRequest, upload("application/json", "?only_if_newer=maybe", nil, false).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload("application/json", "", []byte(strings.Repeat(" ", 129)), false).Code)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(`{"service_request_id":"1","service_code":"pothole","address":"x"}` + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	w := upload("application/x-ndjson", "?only_if_newer=true", buf.Bytes(), true)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var job models.ImportJob
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&job))
+	assert.Equal(t, models.JobQueued, job.Status)
+	assert.Equal(t, models.ImportFormatNDJSON, job.Format)
+	assert.True(t, job.OnlyIfNewer)
+	assert.Equal(t, "/open311/v2/jobs/"+job.ID, w.Header().Get("Location"))
+
+	// Reading a job needs an API key.
+	r := withPathParam(httptest.NewRequest(http.MethodGet, "/open311/v2/jobs/"+job.ID, nil), "id", job.ID)
+	w = httptest.NewRecorder()
+	handler.GetJob(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = httptest.NewRecorder()
+	handler.GetJob(w, authenticated(r))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	action := func(h http.HandlerFunc, id string) int {
+		r := authenticated(withPathParam(httptest.NewRequest(http.MethodPost, "/open311/v2/jobs/"+id, nil), "id", id))
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusConflict, action(handler.ResumeJob, job.ID), "a queued job cannot be resumed")
+	assert.Equal(t, http.StatusAccepted, action(handler.CancelJob, job.ID))
+	assert.Equal(t, http.StatusConflict, action(handler.CancelJob, job.ID))
+	assert.Equal(t, http.StatusAccepted, action(handler.ResumeJob, job.ID))
+	assert.Equal(t, http.StatusBadRequest, action(handler.CancelJob, "nope"))
+	assert.Equal(t, http.StatusNotFound, action(handler.CancelJob, "65f000000000000000000000"))
+
+	// Writes need an API key too, even where API_KEYS is unset and the
+	// middleware lets them through: a job nobody can read is never created.
+	r = httptest.NewRequest(http.MethodPost, "/open311/v2/jobs/imports", strings.NewReader("[]"))
+	r.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	handler.CreateImportJob(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	for _, h := range []http.HandlerFunc{handler.CancelJob, handler.ResumeJob} {
+		r := withPathParam(httptest.NewRequest(http.MethodPost, "/open311/v2/jobs/"+job.ID, nil), "id", job.ID)
+		w := httptest.NewRecorder()
+		h(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+}
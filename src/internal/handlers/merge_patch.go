@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+)
+
+// Merge patch media types (RFC 7386). The XML form is this project's
+// equivalent: see decodeXMLMergePatch.
+const (
+	mediaTypeMergePatchJSON = "application/merge-patch+json"
+	mediaTypeMergePatchXML  = "application/merge-patch+xml"
+)
+
+// xmlPatchFieldNames maps XML element names that differ from the JSON names
+// used by repository.PatchableServiceRequestFields. All other elements share
+// their JSON name.
+var xmlPatchFieldNames = map[string]string{
+	"feature_id":      "featureId",
+	"feature_guid":    "featureGuid",
+	"organization_id": "organizationId",
+}
+
+// patchValue is one scalar member of a merge patch before it is typed: either
+// null (remove) or its text.
+type patchValue struct {
+	null bool
+	text string
+}
+
+// decodeMergePatch reads a merge patch body as JSON or XML according to
+// contentType and converts it to a repository.ServiceRequestPatch.
+func decodeMergePatch(contentType string, body io.Reader) (repository.ServiceRequestPatch, error) {
+	switch {
+	case strings.Contains(contentType, "json"):
+		return decodeJSONMergePatch(body)
+	case strings.Contains(contentType, "xml"):
+		return decodeXMLMergePatch(body)
+	}
+	return repository.ServiceRequestPatch{}, fmt.Errorf("unsupported Content-Type %q", contentType)
+}
+
+// decodeJSONMergePatch decodes an RFC 7386 merge patch. null removes a field;
+// "properties" is merged key by key, and "properties": null removes them all.
+func decodeJSONMergePatch(body io.Reader) (repository.ServiceRequestPatch, error) {
+	var members map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&members); err != nil {
+		return repository.ServiceRequestPatch{}, fmt.Errorf("merge patch must be a JSON object: %v", err)
+	}
+
+	values := make(map[string]patchValue, len(members))
+	var props map[string]patchValue
+	clearProps := false
+	for name, raw := range members {
+		if name == "properties" {
+			if isJSONNull(raw) {
+				clearProps = true
+				continue
+			}
+			var obj map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &obj); err != nil {
+				return repository.ServiceRequestPatch{}, fmt.Errorf("properties must be an object or null")
+			}
+			props = make(map[string]patchValue, len(obj))
+			for k, v := range obj {
+				pv, err := jsonPatchValue(v)
+				if err != nil {
+					return repository.ServiceRequestPatch{}, fmt.Errorf("properties.%s: %v", k, err)
+				}
+				props[k] = pv
+			}
+			continue
+		}
+		pv, err := jsonPatchValue(raw)
+		if err != nil {
+			return repository.ServiceRequestPatch{}, fmt.Errorf("%s: %v", name, err)
+		}
+		values[name] = pv
+	}
+	return buildPatch(values, props, clearProps)
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return string(bytes.TrimSpace(raw)) == "null"
+}
+
+// jsonPatchValue accepts null, strings and numbers; objects, arrays and
+// booleans are not valid for any patchable field.
+func jsonPatchValue(raw json.RawMessage) (patchValue, error) {
+	if isJSONNull(raw) {
+		return patchValue{null: true}, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return patchValue{text: s}, nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return patchValue{text: n.String()}, nil
+	}
+	return patchValue{}, fmt.Errorf("must be a string, a number or null")
+}
+
+// xmlPatchElement is a generic element used to walk an XML merge patch.
+type xmlPatchElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr        `xml:",any,attr"`
+	Text     string            `xml:",chardata"`
+	Children []xmlPatchElement `xml:",any"`
+}
+
+// isNil reports a nil="true" attribute in any namespace (so xsi:nil works).
+func (e xmlPatchElement) isNil() bool {
+	for _, a := range e.Attrs {
+		if a.Name.Local == "nil" && a.Value == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+func (e xmlPatchElement) attr(name string) string {
+	for _, a := range e.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// decodeXMLMergePatch decodes the XML equivalent of a merge patch: a
+// <request> whose child elements are the fields to change, using the same
+// element names as the XML representation. An element with nil="true" removes
+// the field. <properties> lists the <property key="…"> entries to set (or to
+// remove, with nil="true"); <properties nil="true"/> removes them all.
+//
+//	<request>
+//	  <status>closed</status>
+//	  <status_notes nil="true"/>
+//	  <properties><property key="closure_reason">Case Resolved</property></properties>
+//	</request>
+func decodeXMLMergePatch(body io.Reader) (repository.ServiceRequestPatch, error) {
+	var root xmlPatchElement
+	if err := xml.NewDecoder(body).Decode(&root); err != nil {
+		return repository.ServiceRequestPatch{}, fmt.Errorf("invalid XML merge patch: %v", err)
+	}
+
+	values := make(map[string]patchValue, len(root.Children))
+	var props map[string]patchValue
+	clearProps := false
+	for _, child := range root.Children {
+		name := child.XMLName.Local
+		if name == "properties" {
+			if child.isNil() {
+				clearProps = true
+				continue
+			}
+			if props == nil {
+				props = make(map[string]patchValue, len(child.Children))
+			}
+			for _, p := range child.Children {
+				if p.XMLName.Local != "property" {
+					return repository.ServiceRequestPatch{}, fmt.Errorf("unexpected <%s> in <properties>", p.XMLName.Local)
+				}
+				props[p.attr("key")] = patchValue{null: p.isNil(), text: p.Text}
+			}
+			continue
+		}
+		if mapped, ok := xmlPatchFieldNames[name]; ok {
+			name = mapped
+		}
+		values[name] = patchValue{null: child.isNil(), text: child.Text}
+	}
+	return buildPatch(values, props, clearProps)
+}
+
+// buildPatch types the decoded members according to
+// repository.PatchableServiceRequestFields.
+func buildPatch(values, props map[string]patchValue, clearProps bool) (repository.ServiceRequestPatch, error) {
+	patch := repository.ServiceRequestPatch{
+		Fields:          make(map[string]interface{}, len(values)),
+		ClearProperties: clearProps,
+	}
+	for name, pv := range values {
+		kind, ok := repository.PatchableServiceRequestFields[name]
+		if !ok {
+			return repository.ServiceRequestPatch{}, fmt.Errorf("field %q cannot be patched", name)
+		}
+		if pv.null {
+			patch.Fields[name] = nil
+			continue
+		}
+		switch kind {
+		case repository.PatchTime:
+			t, err := time.Parse(time.RFC3339, strings.TrimSpace(pv.text))
+			if err != nil {
+				return repository.ServiceRequestPatch{}, fmt.Errorf("%s must be an ISO 8601 timestamp", name)
+			}
+			patch.Fields[name] = t
+		case repository.PatchFloat:
+			f, err := strconv.ParseFloat(strings.TrimSpace(pv.text), 64)
+			if err != nil {
+				return repository.ServiceRequestPatch{}, fmt.Errorf("%s must be a number", name)
+			}
+			patch.Fields[name] = f
+		default:
+			patch.Fields[name] = pv.text
+		}
+	}
+	if len(props) > 0 {
+		patch.Properties = make(map[string]*string, len(props))
+		for k, pv := range props {
+			if pv.null {
+				patch.Properties[k] = nil
+				continue
+			}
+			v := pv.text
+			patch.Properties[k] = &v
+		}
+	}
+	return patch, patch.Validate()
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+)
+
+const (
+	// ndjsonBatchSize is how many records of a streamed bulk upsert go into
+	// one BulkUpsert call.
+	ndjsonBatchSize = 500
+	// ndjsonMaxLine bounds one line (record) of a streamed bulk upsert.
+	ndjsonMaxLine = 1 << 20
+	// ndjsonTimeout bounds reading each batch from, and each write to, a
+	// streaming client; the server's ReadTimeout and WriteTimeout would
+	// otherwise end every long upload.
+	ndjsonTimeout = 60 * time.Second
+	// bulkLineError is the status of a line that was not written.
+	bulkLineError = "error"
+)
+
+// BulkLineResult reports what a streamed bulk upsert did with one line.
+type BulkLineResult struct {
+	// Line is the 1-based line number in the request body.
+	Line             int    `json:"line"`
+	ServiceRequestID string `json:"service_request_id,omitempty"`
+	// Status is created, updated, skipped or error.
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	// Warning is the value-set warning of a record written in warn mode.
+	Warning string `json:"warning,omitempty"`
+}
+
+// bulkStreamEnd is the last line of a streamed bulk upsert: the totals, or
+// the error that ended the stream early (lines after it were not read).
+type bulkStreamEnd struct {
+	Summary *BulkUpsertResponse `json:"summary,omitempty"`
+	Error   string              `json:"error,omitempty"`
+}
+
+// bulkUpsertNDJSON streams an application/x-ndjson bulk upsert: one service
+// request (or, with dict, one source row) per line, blank lines ignored. The
+// records are validated like those of a JSON array and written in batches of
+// ndjsonBatchSize, so the body can be any size; after each batch the response
+// streams one BulkLineResult per line, in order, and it ends with a
+// {"summary": ...} line. Lines that are not valid JSON are reported and
+// skipped. A body that cannot be read further (e.g. a line over
+// ndjsonMaxLine) or a database error ends the response with an
+// {"error": ...} line instead: the lines reported before it stay written, so
+// feeds resume after the last reported line.
+func (h *ServiceRequestHandler) bulkUpsertNDJSON(w http.ResponseWriter, r *http.Request, dict *dictionary.Dictionary, opts repository.BulkUpsertOptions) {
+	valueSets := h.valueSets
+	if dict != nil {
+		valueSets = dict
+	}
+	mode := h.valueSetMode(valueSets)
+
+	rc := http.NewResponseController(w)
+	// Results are written while the body is still being read, which HTTP/1.x
+	// servers only allow in full-duplex mode. Not every writer supports it
+	// (e.g. in tests, or HTTP/2, which needs no opt-in).
+	_ = rc.EnableFullDuplex()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Accel-Buffering", "no") // no proxy buffering (nginx)
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	send := func(values ...any) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(ndjsonTimeout))
+		for _, v := range values {
+			if err := enc.Encode(v); err != nil {
+				return false
+			}
+		}
+		return rc.Flush() == nil
+	}
+
+	sc := bufio.NewScanner(r.Body)
+	sc.Buffer(make([]byte, 0, 64*1024), ndjsonMaxLine)
+	summary := BulkUpsertResponse{}
+	line := 0
+	for more := true; more; {
+		_ = rc.SetReadDeadline(time.Now().Add(ndjsonTimeout))
+		var pending []BulkLineResult
+		var batch []models.ServiceRequest
+		var slots []int // batch index -> pending index
+		for len(batch) < ndjsonBatchSize {
+			if !sc.Scan() {
+				more = false
+				break
+			}
+			line++
+			data := bytes.TrimSpace(sc.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+			req, unmapped, err := decodeBulkLine(data, dict)
+			if err != nil {
+				pending = append(pending, BulkLineResult{Line: line, Status: bulkLineError, Message: "invalid JSON: " + err.Error()})
+				continue
+			}
+			res := BulkLineResult{Line: line, ServiceRequestID: req.ServiceRequestID}
+			reject, warning := checkBulkRecord(req, unmapped, valueSets, mode)
+			if reject != "" {
+				res.Status, res.Message = bulkLineError, reject
+				pending = append(pending, res)
+				continue
+			}
+			res.Warning = warning
+			slots = append(slots, len(pending))
+			pending = append(pending, res)
+			batch = append(batch, req)
+		}
+
+		if len(batch) > 0 {
+			result, err := h.repo.BulkUpsert(r.Context(), batch, opts)
+			if err != nil {
+				h.log.Errorf("Streamed bulk upsert failed at line %d: %v", line, err)
+				send(bulkStreamEnd{Error: fmt.Sprintf("failed to bulk upsert the batch ending at line %d", line)})
+				return
+			}
+			messages := make(map[int]string, len(result.Errors))
+			for _, e := range result.Errors {
+				messages[e.Index] = e.Message
+			}
+			for j, slot := range slots {
+				outcome := repository.BulkFailed
+				if j < len(result.Outcomes) {
+					outcome = result.Outcomes[j]
+				}
+				pending[slot].Status = string(outcome)
+				if outcome == repository.BulkFailed {
+					pending[slot].Status, pending[slot].Message = bulkLineError, messages[j]
+				}
+			}
+		}
+
+		values := make([]any, len(pending))
+		for i, res := range pending {
+			summary.Requested++
+			switch res.Status {
+			case string(repository.BulkCreated):
+				summary.Created++
+			case string(repository.BulkUpdated):
+				summary.Updated++
+			case string(repository.BulkSkipped):
+				summary.Skipped++
+			default:
+				summary.Failed++
+			}
+			values[i] = res
+		}
+		if !send(values...) {
+			return
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		msg := fmt.Sprintf("reading line %d: %v", line+1, err)
+		if errors.Is(err, bufio.ErrTooLong) {
+			msg = fmt.Sprintf("line %d is longer than %d bytes", line+1, ndjsonMaxLine)
+		}
+		send(bulkStreamEnd{Error: msg})
+		return
+	}
+	send(bulkStreamEnd{Summary: &summary})
+}
+
+// decodeBulkLine decodes one NDJSON line: a service request, or a source row
+// mapped through dict (unmapped is then the mapping error, if any).
+func decodeBulkLine(data []byte, dict *dictionary.Dictionary) (req models.ServiceRequest, unmapped string, err error) {
+	if dict == nil {
+		err = json.Unmarshal(data, &req)
+		return req, "", err
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return req, "", err
+	}
+	req, err = dict.Map(dictionary.JSONRow(obj))
+	if err != nil {
+		unmapped = err.Error()
+	}
+	return req, unmapped, nil
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// readBulkStream splits a streamed bulk response into its line results and
+// its last line.
+func readBulkStream(t *testing.T, body io.Reader) ([]BulkLineResult, bulkStreamEnd) {
+	t.Helper()
+	var lines []BulkLineResult
+	var end bulkStreamEnd
+	sc := bufio.NewScanner(body)
+	for sc.Scan() {
+		if bytes.HasPrefix(sc.Bytes(), []byte(`{"line"`)) {
+			var res BulkLineResult
+			require.NoError(t, json.Unmarshal(sc.Bytes(), &res))
+			lines = append(lines, res)
+			continue
+		}
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &end))
+	}
+	return lines, end
+}
+
+func TestBulkUpsertNDJSON(t *testing.T) {
+	post := func(repo *mockServiceRequestRepo, body io.Reader, gzipped bool) *httptest.ResponseRecorder {
+		handler := NewServiceRequestHandler(nil, repo)
+		r := httptest.NewRequest(http.MethodPost, "/open311/v2/requests/bulk", body)
+		r.Header.Set("Content-Type", "application/x-ndjson")
+		if gzipped {
+			r.Header.Set("Content-Encoding", "gzip")
+		}
+		w := httptest.NewRecorder()
+		handler.BulkUpsertServiceRequests(w, r)
+		return w
+	}
+
+	t.Run("per-line results", func(t *testing.T) {
+		repo := &mockServiceRequestRepo{data: []models.ServiceRequest{{ServiceRequestID: "sr-1", ServiceCode: "OLD"}}}
+		w := post(repo, strings.NewReader(`{"service_request_id":"sr-1","service_code":"POTHOLE","address":"x"}
+{"service_request_id":"sr-2","service_code":"POTHOLE","address":"x"}
+
+{not json}
+{"service_request_id":"sr-3","address":"x"}
+`), false)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+		lines, end := readBulkStream(t, w.Body)
+		require.Len(t, lines, 4)
+		assert.Equal(t, BulkLineResult{Line: 1, ServiceRequestID: "sr-1", Status: "updated"}, lines[0])
+		assert.Equal(t, BulkLineResult{Line: 2, ServiceRequestID: "sr-2", Status: "created"}, lines[1])
+		assert.Equal(t, 4, lines[2].Line, "blank lines are skipped but counted")
+		assert.Equal(t, "error", lines[2].Status)
+		assert.Contains(t, lines[2].Message, "invalid JSON")
+		assert.Equal(t, BulkLineResult{Line: 5, ServiceRequestID: "sr-3", Status: "error", Message: "service_code is required"}, lines[3])
+		require.NotNil(t, end.Summary)
+		assert.Equal(t, 4, end.Summary.Requested)
+		assert.Equal(t, 1, end.Summary.Created)
+		assert.Equal(t, 1, end.Summary.Updated)
+		assert.Equal(t, 2, end.Summary.Failed)
+	})
+
+	t.Run("gzip beyond the array cap", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		n := maxBulkRequests + ndjsonBatchSize + 7
+		for i := 0; i < n; i++ {
+			require.NoError(t, json.NewEncoder(zw).Encode(models.ServiceRequest{
+				ServiceRequestID: "sr-" + strconv.Itoa(i),
+				ServiceCode:      "POTHOLE",
+				Address:          "x",
+			}))
+		}
+		require.NoError(t, zw.Close())
+
+		repo := &mockServiceRequestRepo{}
+		w := post(repo, &buf, true)
+		assert.Equal(t, http.StatusOK, w.Code)
+		lines, end := readBulkStream(t, w.Body)
+		assert.Len(t, lines, n)
+		require.NotNil(t, end.Summary)
+		assert.Equal(t, n, end.Summary.Created)
+		assert.Len(t, repo.data, n)
+	})
+
+	t.Run("line too long ends the stream", func(t *testing.T) {
+		body := `{"service_request_id":"sr-1","service_code":"POTHOLE","address":"x"}` + "\n" +
+			`{"description":"` + strings.Repeat("x", ndjsonMaxLine) + `"}` + "\n"
+		repo := &mockServiceRequestRepo{}
+		w := post(repo, strings.NewReader(body), false)
+		lines, end := readBulkStream(t, w.Body)
+		require.Len(t, lines, 1, "the lines read before the error are written")
+		assert.Equal(t, "created", lines[0].Status)
+		assert.Nil(t, end.Summary)
+		assert.Contains(t, end.Error, "line 2 is longer than")
+	})
+
+	t.Run("bad gzip -> 400", func(t *testing.T) {
+		w := post(&mockServiceRequestRepo{}, strings.NewReader("plain"), true)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestBulkUpsertGzipBodyLimit(t *testing.T) {
+	// A few KB of gzip inflating past maxBulkBodyBytes.
+	bomb := func(prefix string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte(prefix))
+		require.NoError(t, err)
+		chunk := bytes.Repeat([]byte(" "), 1<<20)
+		for written := 0; written <= maxBulkBodyBytes; written += len(chunk) {
+			_, err := zw.Write(chunk)
+			require.NoError(t, err)
+		}
+		require.NoError(t, zw.Close())
+		return &buf
+	}
+	for _, contentType := range []string{"application/json", "application/xml"} {
+		prefix := "["
+		if contentType == "application/xml" {
+			prefix = "<requests>"
+		}
+		body := bomb(prefix)
+		assert.Less(t, body.Len(), 1<<20)
+		handler := NewServiceRequestHandler(nil, &mockServiceRequestRepo{})
+		r := httptest.NewRequest(http.MethodPost, "/open311/v2/requests/bulk", body)
+		r.Header.Set("Content-Type", contentType)
+		r.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		handler.BulkUpsertServiceRequests(w, r)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, contentType)
+		assert.Contains(t, w.Body.String(), "request body larger than", contentType)
+	}
+}
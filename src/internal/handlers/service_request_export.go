@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/export"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
+)
+
+const (
+	// exportFlushEvery is how many records an export writes between flushes
+	// to the client.
+	exportFlushEvery = 500
+	// exportBufferSize is the write buffer of an export.
+	exportBufferSize = 64 << 10
+	// exportWatermarkHeader is the trailer carrying the updated_datetime of
+	// the last exported record, the updated_after of the next incremental
+	// export.
+	exportWatermarkHeader = "X-Export-Watermark"
+	// exportCountHeader is the trailer carrying the number of records.
+	exportCountHeader = "X-Export-Count"
+)
+
+// ExportServiceRequests handles GET /open311/v2/export (API key with the
+// export scope, EXPORT_API_KEYS): every request matching the listing filters
+// (service_code, status, dates, updated_after/before, q, geo, properties),
+// soft-deleted tombstones included unless include_deleted=false, oldest
+// update first, streamed from a database cursor. format selects ndjson (the
+// default), csv or parquet; with csv, dictionary=<name> flattens that
+// dictionary's properties keys into columns. Contact fields are never
+// exported.
+//
+// The response ends with an X-Export-Watermark trailer, the updated_datetime
+// of the last record: pass it as updated_after to continue an interrupted
+// export or fetch the next increment (updated_after is inclusive, so records
+// at the watermark repeat). A failure after the first record cuts the
+// response off, so a truncated export never looks complete.
+func (h *ServiceRequestHandler) ExportServiceRequests(w http.ResponseWriter, r *http.Request) {
+	if !httputil.HasScope(r, httputil.ScopeExport) {
+		if !httputil.Authenticated(r) {
+			h.SendError(w, r, http.StatusUnauthorized, "export requires an API key with the export scope")
+		} else {
+			h.SendError(w, r, http.StatusForbidden, "this API key may not export")
+		}
+		return
+	}
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = export.FormatNDJSON
+	}
+	contentType := export.ContentType(format)
+	if contentType == "" {
+		h.SendError(w, r, http.StatusBadRequest, "format must be ndjson, csv or parquet")
+		return
+	}
+	var dict *dictionary.Dictionary
+	if name := q.Get("dictionary"); name != "" {
+		if format != export.FormatCSV {
+			h.SendError(w, r, http.StatusBadRequest, "dictionary applies to format=csv only")
+			return
+		}
+		if dict = h.dicts[strings.ToLower(name)]; dict == nil {
+			h.SendError(w, r, http.StatusBadRequest, "unknown dictionary "+strconv.Quote(name))
+			return
+		}
+	}
+	for _, p := range []string{"sort", "order", "cursor", "page", "per_page"} {
+		if q.Has(p) {
+			h.SendError(w, r, http.StatusBadRequest, p+" is not supported: an export is ordered by updated_datetime; resume with updated_after")
+			return
+		}
+	}
+	query, ok := h.serviceRequestQuery(w, r)
+	if !ok {
+		return
+	}
+	if q.Get("include_deleted") == "" {
+		query.IncludeDeleted = true
+	}
+	query.Sort, query.Ascending = repository.SortUpdatedDatetime, true
+
+	ew := &exportWriter{w: w, rc: http.NewResponseController(w)}
+	buf := bufio.NewWriterSize(ew, exportBufferSize)
+	out, err := export.NewWriter(buf, format, dict)
+	if err != nil {
+		h.log.Errorf("Failed to start export: %v", err)
+		h.SendError(w, r, http.StatusInternalServerError, "Failed to export service requests")
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="service-requests.`+format+`"`)
+	w.Header().Set("X-Accel-Buffering", "no") // no proxy buffering (nginx)
+	w.Header().Set("Trailer", exportWatermarkHeader+", "+exportCountHeader)
+
+	flush := func() error {
+		if err := buf.Flush(); err != nil {
+			return err
+		}
+		return ew.rc.Flush()
+	}
+	var (
+		n         int
+		watermark *time.Time
+	)
+	err = h.repo.Each(r.Context(), query, func(req models.ServiceRequest) error {
+		if err := out.Write(req); err != nil {
+			return err
+		}
+		n++
+		updated := req.UpdatedDatetime
+		watermark = &updated
+		if n%exportFlushEvery == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		if err = out.Close(); err == nil {
+			err = flush()
+		}
+	}
+	if err != nil {
+		if !ew.started {
+			// Nothing has reached the client yet: a proper error response.
+			h.log.Errorf("Failed to export service requests: %v", err)
+			w.Header().Del("Trailer")
+			w.Header().Del("Content-Disposition")
+			h.SendError(w, r, http.StatusInternalServerError, "Failed to export service requests")
+			return
+		}
+		if r.Context().Err() == nil {
+			h.log.Errorf("Export failed after %d records: %v", n, err)
+		}
+		panic(http.ErrAbortHandler) // cut the response off: it is incomplete
+	}
+
+	if watermark == nil {
+		watermark = query.UpdatedAfter
+	}
+	if watermark != nil {
+		w.Header().Set(exportWatermarkHeader, watermark.UTC().Format(time.RFC3339Nano))
+	}
+	w.Header().Set(exportCountHeader, strconv.Itoa(n))
+}
+
+// exportWriter writes an export to the client, extending the write deadline
+// before every write (the server's WriteTimeout would otherwise end every
+// long export) and noting when the response has started.
+type exportWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	started bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	e.started = true
+	_ = e.rc.SetWriteDeadline(time.Now().Add(ndjsonTimeout))
+	return e.w.Write(p)
+}
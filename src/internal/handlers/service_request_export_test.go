@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
+)
+
+func TestExportServiceRequests(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryServiceRequestRepository()
+	updated := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"sr-1", "sr-2", "sr-3"} {
+		_, _, err := repo.Upsert(ctx, models.ServiceRequest{ServiceRequestID: id, ServiceCode: "POTHOLE", Status: "open", Email: "a@example.com",
+			UpdatedDatetime: updated.Add(time.Duration(i) * time.Hour)}, repository.Precondition{})
+		require.NoError(t, err)
+	}
+	require.NoError(t, repo.Delete(ctx, "sr-2", repository.Precondition{}))
+	handler := NewServiceRequestHandler(nil, repo)
+
+	export := func(query string, scopes ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/open311/v2/export"+query, nil)
+		if scopes != nil {
+			r = r.WithContext(httputil.WithPrincipal(r.Context(), httputil.Principal{KeyID: "k", Scopes: scopes}))
+		}
+		w := httptest.NewRecorder()
+		handler.ExportServiceRequests(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, export("").Code)
+	assert.Equal(t, http.StatusForbidden, export("", "read").Code)
+
+	w := export("", httputil.ScopeExport)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "a@example.com")
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 3, "tombstones are exported")
+	var last models.ServiceRequest
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &last))
+	assert.Equal(t, "sr-2", last.ServiceRequestID, "oldest update first; the delete is the latest")
+	trailer := w.Result().Trailer
+	assert.Equal(t, last.UpdatedDatetime.UTC().Format(time.RFC3339Nano), trailer.Get("X-Export-Watermark"))
+	assert.Equal(t, "3", trailer.Get("X-Export-Count"))
+
+	// Resuming from the watermark repeats the records at it and nothing older.
+	w = export("?updated_after="+trailer.Get("X-Export-Watermark"), httputil.ScopeExport)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"sr-2"`)
+	assert.NotContains(t, w.Body.String(), `"sr-1"`)
+
+	w = export("?include_deleted=false&format=csv", httputil.ScopeExport)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Len(t, strings.Split(strings.TrimSpace(w.Body.String()), "\n"), 3, "header and two rows")
+	assert.Equal(t, "2", w.Result().Trailer.Get("X-Export-Count"))
+
+	w = export("?format=parquet", httputil.ScopeExport)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "PAR1"))
+
+	for _, query := range []string{"?format=xlsx", "?format=ndjson&dictionary=boston", "?format=csv&dictionary=nope", "?sort=status", "?page=2"} {
+		assert.Equal(t, http.StatusBadRequest, export(query, httputil.ScopeExport).Code, query)
+	}
+}
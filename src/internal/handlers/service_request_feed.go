@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/feeds"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+)
+
+// defaultFeedEntries is the feed length without per_page.
+const defaultFeedEntries = 50
+
+// GetServiceRequestsAtom handles GET /open311/v2/requests.atom: the listing as
+// an Atom feed.
+func (h *ServiceRequestHandler) GetServiceRequestsAtom(w http.ResponseWriter, r *http.Request) {
+	h.sendFeed(w, r, feeds.AtomContentType, func(f feeds.Feed, results []models.ServiceRequest) interface{} {
+		return feeds.Atom(f, results)
+	})
+}
+
+// GetServiceRequestsRSS handles GET /open311/v2/requests.rss: the listing as
+// an RSS 2.0 feed.
+func (h *ServiceRequestHandler) GetServiceRequestsRSS(w http.ResponseWriter, r *http.Request) {
+	h.sendFeed(w, r, feeds.RSSContentType, func(f feeds.Feed, results []models.ServiceRequest) interface{} {
+		return feeds.RSS(f, results)
+	})
+}
+
+// sendFeed renders a feed of the requests matching the listing's filters
+// (service_code, status, q, dates, feature/organization, lat/long/radius,
+// bbox), most recently updated first; per_page sets the length (default 50,
+// max 100). Entries are the public view unless an API key is sent.
+func (h *ServiceRequestHandler) sendFeed(w http.ResponseWriter, r *http.Request, contentType string,
+	render func(feeds.Feed, []models.ServiceRequest) interface{}) {
+	query, ok := h.serviceRequestQuery(w, r)
+	if !ok {
+		return
+	}
+	query.PerPage = atoiDefault(r.URL.Query().Get("per_page"), defaultFeedEntries)
+	query.Sort = repository.SortUpdatedDatetime
+
+	base := baseURL(r)
+	listing := *r.URL
+	listing.Path = strings.TrimSuffix(strings.TrimSuffix(listing.Path, ".atom"), ".rss")
+	title := "Service requests"
+	if filters := feedFilters(r.URL.Query()); filters != "" {
+		title += " (" + filters + ")"
+	}
+	f := feeds.Feed{
+		Title:        title,
+		SelfURL:      base + r.URL.RequestURI(),
+		AlternateURL: base + listing.RequestURI(),
+		RequestURL: func(id string) string {
+			return base + listing.Path + "/" + url.PathEscape(id)
+		},
+		Now: time.Now(),
+	}
+
+	results, err := h.repo.Find(r.Context(), query)
+	if err != nil {
+		h.log.Errorf("Failed to list service requests: %v", err)
+		h.SendError(w, r, http.StatusInternalServerError, "Failed to list service requests")
+		return
+	}
+	doc := render(f, h.visible(r, results))
+
+	w.Header().Set("Content-Type", contentType)
+	setViewCaching(w, r)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return
+	}
+	if err := xml.NewEncoder(w).Encode(doc); err != nil {
+		h.log.Errorf("Failed to write feed: %v", err)
+	}
+}
+
+// feedFilters describes the filters of a feed for its title, e.g.
+// "service_code=pothole, status=open". Paging parameters are left out.
+func feedFilters(q url.Values) string {
+	params := url.Values{}
+	for k, v := range q {
+		if k != "per_page" && k != "page" {
+			params[k] = v
+		}
+	}
+	s, _ := url.QueryUnescape(params.Encode())
+	return strings.ReplaceAll(s, "&", ", ")
+}
+
+// baseURL is the scheme and host the client used, for absolute feed links.
+// X-Forwarded-Proto is honoured so feeds behind a TLS-terminating proxy link
+// to https.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
@@ -1,16 +1,26 @@
 package handlers
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/importer"
+	"github.com/timoruohomaki/open311-to-Go/internal/privacy"
+	"github.com/timoruohomaki/open311-to-Go/internal/propschema"
 	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/internal/stream"
 	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
 	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
 )
@@ -19,26 +29,148 @@ import (
 // bound request size and memory. Feeders should chunk larger inputs.
 const maxBulkRequests = 1000
 
+// maxBulkBodyBytes caps a buffered bulk body (a JSON array, XML document or
+// CSV), after decompression: those are decoded whole before the record cap
+// applies.
+const maxBulkBodyBytes = 32 << 20
+
 type ServiceRequestHandler struct {
 	BaseHandler
-	repo repository.ServiceRequestRepository
+	repo      repository.ServiceRequestRepository
+	privacy   *privacy.Policy
+	stream    *stream.Hub
+	heartbeat time.Duration
+	dicts     dictionary.Registry
+	valueSets *dictionary.Dictionary
+	valueMode string
+	schema    *propschema.Schema
+}
+
+// ServiceRequestHandlerOption configures optional ServiceRequestHandler
+// behaviour.
+type ServiceRequestHandlerOption func(*ServiceRequestHandler)
+
+// WithPrivacyPolicy sets the policy that shapes responses for unauthenticated
+// clients (coordinate blurring for sensitive service codes). Without it they
+// still never see reporter contact fields.
+func WithPrivacyPolicy(p *privacy.Policy) ServiceRequestHandlerOption {
+	return func(h *ServiceRequestHandler) { h.privacy = p }
+}
+
+// WithStream enables the live feed at /requests/stream, fed by hub, with a
+// keep-alive comment every heartbeat (default 15s) on idle connections.
+func WithStream(hub *stream.Hub, heartbeat time.Duration) ServiceRequestHandlerOption {
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+	return func(h *ServiceRequestHandler) {
+		h.stream = hub
+		h.heartbeat = heartbeat
+	}
+}
+
+// WithDictionaries enables POST /requests/bulk?dictionary=<name>, which maps
+// native source rows through the named data dictionary.
+func WithDictionaries(reg dictionary.Registry) ServiceRequestHandlerOption {
+	return func(h *ServiceRequestHandler) { h.dicts = reg }
 }
 
-func NewServiceRequestHandler(log logger.Logger, repo repository.ServiceRequestRepository) *ServiceRequestHandler {
-	return &ServiceRequestHandler{
+// WithValueSets checks the values of every write against the enforcement
+// rules of d (see dictionary.Enforcement); mode, when not empty, overrides the
+// dictionary's own mode for all dictionaries.
+func WithValueSets(d *dictionary.Dictionary, mode string) ServiceRequestHandlerOption {
+	return func(h *ServiceRequestHandler) {
+		h.valueSets = d
+		h.valueMode = mode
+	}
+}
+
+// WithPropertySchema types the properties.<key> listing filters by the
+// schema's declarations, so e.g. integers compare as numbers. Writes are
+// validated by the repository (see repository.SchemaServiceRequestRepository).
+func WithPropertySchema(s *propschema.Schema) ServiceRequestHandlerOption {
+	return func(h *ServiceRequestHandler) { h.schema = s }
+}
+
+func NewServiceRequestHandler(log logger.Logger, repo repository.ServiceRequestRepository, opts ...ServiceRequestHandlerOption) *ServiceRequestHandler {
+	h := &ServiceRequestHandler{
 		BaseHandler: BaseHandler{log: log},
 		repo:        repo,
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // GetServiceRequests handles GET /open311/v2/requests — list with Open311
 // filters (service_request_id, service_code, status, start_date/end_date),
 // Boston extensions (q, updated_after/before, page/per_page), and this project's
-// feature/organization extensions.
+// feature/organization, geo (lat/long/radius, bbox) and properties.<key>
+// extensions.
+// include_deleted=true (API key required) also returns soft-deleted tombstones,
+// e.g. for data-lake sync. sort/order select the ordering (sort=relevance ranks
+// a q search); a full page carries the next page's cursor in X-Next-Cursor and
+// a Link rel="next" header, and count=true adds X-Total-Count.
 func (h *ServiceRequestHandler) GetServiceRequests(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
+	query, ok := h.serviceRequestQuery(w, r)
+	if !ok {
+		return
+	}
+	query.Page = atoiDefault(q.Get("page"), 0)
+	query.PerPage = atoiDefault(q.Get("per_page"), 0)
 
-	query := repository.ServiceRequestQuery{
+	var err error
+	if query.Sort, query.Ascending, query.After, err = parseSortParams(q); err != nil {
+		h.SendError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	withCount := q.Get("count") == "true"
+
+	results, err := h.repo.Find(r.Context(), query)
+	if err != nil {
+		h.log.Errorf("Failed to list service requests: %v", err)
+		h.SendError(w, r, http.StatusInternalServerError, "Failed to list service requests")
+		return
+	}
+	if withCount {
+		total, err := h.repo.Count(r.Context(), query)
+		if err != nil {
+			h.log.Errorf("Failed to count service requests: %v", err)
+			h.SendError(w, r, http.StatusInternalServerError, "Failed to list service requests")
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	}
+
+	// A full page may have a successor: point at it with a cursor after the
+	// last result (or, ranked by relevance, the next page number). The final
+	// page of an exact multiple is empty.
+	if len(results) > 0 && len(results) == query.PageSize() {
+		if query.Sort == repository.SortRelevance {
+			w.Header().Set("Link", "<"+nextPageNumberURL(r, query.Page)+`>; rel="next"`)
+		} else {
+			next := query.CursorAfter(results[len(results)-1]).Encode()
+			w.Header().Set("X-Next-Cursor", next)
+			w.Header().Set("Link", "<"+nextPageURL(r, next)+`>; rel="next"`)
+		}
+	}
+
+	h.sendServiceRequests(w, r, results)
+}
+
+// serviceRequestQuery parses the filters shared by the listing and the live
+// stream: Open311 and Boston filters, feature/organization, geo and
+// include_deleted. ok=false means an error response was already sent.
+func (h *ServiceRequestHandler) serviceRequestQuery(w http.ResponseWriter, r *http.Request) (query repository.ServiceRequestQuery, ok bool) {
+	q := r.URL.Query()
+	includeDeleted, ok := h.includeDeleted(w, r)
+	if !ok {
+		return query, false
+	}
+
+	query = repository.ServiceRequestQuery{
 		ServiceRequestIDs: splitCSV(q.Get("service_request_id")),
 		ServiceCodes:      splitCSV(q.Get("service_code")),
 		Statuses:          splitCSV(q.Get("status")),
@@ -46,48 +178,80 @@ func (h *ServiceRequestHandler) GetServiceRequests(w http.ResponseWriter, r *htt
 		FeatureID:         q.Get("featureId"),
 		FeatureGuid:       q.Get("featureGuid"),
 		OrganizationID:    q.Get("organizationId"),
-		Page:              atoiDefault(q.Get("page"), 0),
-		PerPage:           atoiDefault(q.Get("per_page"), 0),
+		IncludeDeleted:    includeDeleted,
 	}
 
 	var err error
 	if query.StartDate, err = parseTimeParam(q.Get("start_date")); err != nil {
 		h.SendError(w, r, http.StatusBadRequest, "invalid start_date (expected ISO 8601)")
-		return
+		return query, false
 	}
 	if query.EndDate, err = parseTimeParam(q.Get("end_date")); err != nil {
 		h.SendError(w, r, http.StatusBadRequest, "invalid end_date (expected ISO 8601)")
-		return
+		return query, false
 	}
 	if query.UpdatedAfter, err = parseTimeParam(q.Get("updated_after")); err != nil {
 		h.SendError(w, r, http.StatusBadRequest, "invalid updated_after (expected ISO 8601)")
-		return
+		return query, false
 	}
 	if query.UpdatedBefore, err = parseTimeParam(q.Get("updated_before")); err != nil {
 		h.SendError(w, r, http.StatusBadRequest, "invalid updated_before (expected ISO 8601)")
-		return
+		return query, false
 	}
-
-	results, err := h.repo.Find(r.Context(), query)
-	if err != nil {
-		h.log.Errorf("Failed to list service requests: %v", err)
-		h.SendError(w, r, http.StatusInternalServerError, "Failed to list service requests")
-		return
+	if query.Near, query.Within, err = parseGeoParams(q); err != nil {
+		h.SendError(w, r, http.StatusBadRequest, err.Error())
+		return query, false
+	}
+	// Geo filters run on the exact location: without the contact scope,
+	// narrowing one down would locate a request whose coordinates are blurred.
+	if (query.Near != nil || query.Within != nil) && !httputil.HasScope(r, httputil.ScopeContact) {
+		query.ExcludeServiceCodes = h.privacy.BlurredServiceCodes()
+	}
+	if query.Properties, err = parsePropertyFilters(q, h.schema); err != nil {
+		h.SendError(w, r, http.StatusBadRequest, err.Error())
+		return query, false
 	}
+	return query, true
+}
 
-	h.sendServiceRequests(w, r, results)
+// nextPageURL is the listing URL of r continuing at cursor: the same filters,
+// no page number.
+func nextPageURL(r *http.Request, cursor string) string {
+	u := *r.URL
+	params := u.Query()
+	params.Del("page")
+	params.Set("cursor", cursor)
+	u.RawQuery = params.Encode()
+	return u.RequestURI()
+}
+
+// nextPageNumberURL is the listing URL of r at the page after page.
+func nextPageNumberURL(r *http.Request, page int) string {
+	if page < 1 {
+		page = 1
+	}
+	u := *r.URL
+	params := u.Query()
+	params.Set("page", strconv.Itoa(page+1))
+	u.RawQuery = params.Encode()
+	return u.RequestURI()
 }
 
 // GetServiceRequest handles GET /open311/v2/requests/{id} where id is the
-// service_request_id.
+// service_request_id. A soft-deleted request is 404 unless include_deleted=true
+// is sent with an API key.
 func (h *ServiceRequestHandler) GetServiceRequest(w http.ResponseWriter, r *http.Request) {
 	id := httputil.GetPathParam(r, "id")
 	if id == "" {
 		h.SendError(w, r, http.StatusBadRequest, "Missing service_request_id")
 		return
 	}
+	includeDeleted, ok := h.includeDeleted(w, r)
+	if !ok {
+		return
+	}
 
-	req, err := h.repo.FindByServiceRequestID(r.Context(), id)
+	req, err := h.findServiceRequest(r, id, includeDeleted)
 	if err != nil {
 		switch {
 		case errors.Is(err, repository.ErrNotFound):
@@ -99,6 +263,14 @@ func (h *ServiceRequestHandler) GetServiceRequest(w http.ResponseWriter, r *http
 		return
 	}
 
+	tag := etag(req.Version)
+	w.Header().Set("ETag", tag)
+	setViewCaching(w, r)
+	if notModified(r, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	// GeoReport returns service requests as a collection even for a single id.
 	h.sendServiceRequests(w, r, []models.ServiceRequest{req})
 }
@@ -122,11 +294,19 @@ func (h *ServiceRequestHandler) CreateServiceRequest(w http.ResponseWriter, r *h
 		h.SendError(w, r, http.StatusBadRequest, "a location is required: provide lat and long, address, or address_id")
 		return
 	}
+	if !h.enforceValueSets(w, r, h.valueSets, h.valueSets.Check(req)) {
+		return
+	}
 
 	created, err := h.repo.Create(r.Context(), req)
 	if err != nil {
-		h.log.Errorf("Failed to create service request: %v", err)
-		h.SendError(w, r, http.StatusInternalServerError, "Failed to create service request")
+		switch {
+		case errors.Is(err, repository.ErrInvalidProperties):
+			h.SendError(w, r, http.StatusBadRequest, err.Error())
+		default:
+			h.log.Errorf("Failed to create service request: %v", err)
+			h.SendError(w, r, http.StatusInternalServerError, "Failed to create service request")
+		}
 		return
 	}
 
@@ -139,13 +319,20 @@ func (h *ServiceRequestHandler) CreateServiceRequest(w http.ResponseWriter, r *h
 // updated_datetime is preserved (defaulting to now only when absent), so the
 // source's own update/close timestamps survive. The URL id is authoritative and
 // overrides any service_request_id in the body. Returns 201 when created, 200
-// when an existing request was updated. Accepts JSON or XML.
+// when an existing request was updated. Accepts JSON or XML. With If-Match the
+// replace only happens when the stored version matches (412 otherwise, and the
+// request is never created).
 func (h *ServiceRequestHandler) UpsertServiceRequest(w http.ResponseWriter, r *http.Request) {
 	id := httputil.GetPathParam(r, "id")
 	if id == "" {
 		h.SendError(w, r, http.StatusBadRequest, "Missing service_request_id")
 		return
 	}
+	pre, ok := preconditionFromRequest(r)
+	if !ok {
+		h.sendPreconditionFailed(w, r)
+		return
+	}
 
 	var req models.ServiceRequest
 	if err := h.DecodeRequest(r, &req); err != nil {
@@ -165,12 +352,19 @@ func (h *ServiceRequestHandler) UpsertServiceRequest(w http.ResponseWriter, r *h
 		h.SendError(w, r, http.StatusBadRequest, "a location is required: provide lat and long, address, or address_id")
 		return
 	}
+	if !h.enforceValueSets(w, r, h.valueSets, h.valueSets.Check(req)) {
+		return
+	}
 
-	stored, created, err := h.repo.Upsert(r.Context(), req)
+	stored, created, err := h.repo.Upsert(r.Context(), req, pre)
 	if err != nil {
 		switch {
 		case errors.Is(err, repository.ErrInvalidID):
 			h.SendError(w, r, http.StatusBadRequest, "Missing service_request_id")
+		case errors.Is(err, repository.ErrPreconditionFailed):
+			h.sendPreconditionFailed(w, r)
+		case errors.Is(err, repository.ErrInvalidProperties):
+			h.SendError(w, r, http.StatusBadRequest, err.Error())
 		default:
 			h.log.Errorf("Failed to upsert service request: %v", err)
 			h.SendError(w, r, http.StatusInternalServerError, "Failed to upsert service request")
@@ -182,25 +376,91 @@ func (h *ServiceRequestHandler) UpsertServiceRequest(w http.ResponseWriter, r *h
 	if created {
 		code = http.StatusCreated
 	}
+	w.Header().Set("ETag", etag(stored.Version))
 	h.sendServiceRequests(w, r, []models.ServiceRequest{stored}, code)
 }
 
+// PatchServiceRequest handles PATCH /open311/v2/requests/{id} where id is the
+// service_request_id. The body is an RFC 7386 merge patch
+// (application/merge-patch+json or application/json) or its XML equivalent
+// (application/merge-patch+xml or application/xml): only the fields present
+// change, null removes a field, and properties are merged key by key.
+// updated_datetime is bumped unless the patch sets it. Returns 200 with the
+// updated request, 404 when it does not exist, 412 when If-Match does not match.
+func (h *ServiceRequestHandler) PatchServiceRequest(w http.ResponseWriter, r *http.Request) {
+	id := httputil.GetPathParam(r, "id")
+	if id == "" {
+		h.SendError(w, r, http.StatusBadRequest, "Missing service_request_id")
+		return
+	}
+	pre, ok := preconditionFromRequest(r)
+	if !ok {
+		h.sendPreconditionFailed(w, r)
+		return
+	}
+
+	patch, err := decodeMergePatch(r.Header.Get("Content-Type"), r.Body)
+	if err != nil {
+		h.SendError(w, r, http.StatusBadRequest, "Invalid merge patch: "+err.Error())
+		return
+	}
+	if patch.Empty() {
+		h.SendError(w, r, http.StatusBadRequest, "Invalid merge patch: no fields to change")
+		return
+	}
+	if !h.enforceValueSets(w, r, h.valueSets, checkPatch(h.valueSets, patch)) {
+		return
+	}
+
+	stored, err := h.repo.Patch(r.Context(), id, patch, pre)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			h.SendError(w, r, http.StatusNotFound, "Service request not found")
+		case errors.Is(err, repository.ErrPreconditionFailed):
+			h.sendPreconditionFailed(w, r)
+		case errors.Is(err, repository.ErrInvalidPatch):
+			h.SendError(w, r, http.StatusBadRequest, "Invalid merge patch: "+err.Error())
+		case errors.Is(err, repository.ErrInvalidProperties):
+			h.SendError(w, r, http.StatusBadRequest, err.Error())
+		case errors.Is(err, repository.ErrInvalidID):
+			h.SendError(w, r, http.StatusBadRequest, "Missing service_request_id")
+		default:
+			h.log.Errorf("Failed to patch service request: %v", err)
+			h.SendError(w, r, http.StatusInternalServerError, "Failed to patch service request")
+		}
+		return
+	}
+
+	w.Header().Set("ETag", etag(stored.Version))
+	h.sendServiceRequests(w, r, []models.ServiceRequest{stored})
+}
+
 // DeleteServiceRequest handles DELETE /open311/v2/requests/{id} where id is the
 // service_request_id. Not part of GeoReport v2; provided for administrative
-// cleanup (e.g. removing test or mis-imported records). Returns 200 on success,
-// 404 when the request does not exist.
+// cleanup (e.g. removing test or mis-imported records). The delete is soft: the
+// request becomes a tombstone (deleted_at) hidden from normal reads until the
+// purge job removes it. Returns 200 on success, 404 when the request does not
+// exist, 412 when If-Match does not match.
 func (h *ServiceRequestHandler) DeleteServiceRequest(w http.ResponseWriter, r *http.Request) {
 	id := httputil.GetPathParam(r, "id")
 	if id == "" {
 		h.SendError(w, r, http.StatusBadRequest, "Missing service_request_id")
 		return
 	}
+	pre, ok := preconditionFromRequest(r)
+	if !ok {
+		h.sendPreconditionFailed(w, r)
+		return
+	}
 
-	err := h.repo.Delete(r.Context(), id)
+	err := h.repo.Delete(r.Context(), id, pre)
 	if err != nil {
 		switch {
 		case errors.Is(err, repository.ErrNotFound):
 			h.SendError(w, r, http.StatusNotFound, "Service request not found")
+		case errors.Is(err, repository.ErrPreconditionFailed):
+			h.sendPreconditionFailed(w, r)
 		case errors.Is(err, repository.ErrInvalidID):
 			h.SendError(w, r, http.StatusBadRequest, "Missing service_request_id")
 		default:
@@ -213,12 +473,45 @@ func (h *ServiceRequestHandler) DeleteServiceRequest(w http.ResponseWriter, r *h
 	h.SendResponse(w, r, http.StatusOK, MessageResponse{Message: "Service request deleted successfully"})
 }
 
+// EraseServiceRequest handles POST /open311/v2/requests/{id}/erasure where id
+// is the service_request_id — the GDPR erasure workflow. Personal data
+// (description text, reporter contact, media) is scrubbed while the statistical
+// record (codes, status, timestamps, location) is kept; erased_at records when.
+// Works on soft-deleted requests too, and is idempotent. Returns 200 with the
+// erased request, 404 when it does not exist.
+func (h *ServiceRequestHandler) EraseServiceRequest(w http.ResponseWriter, r *http.Request) {
+	id := httputil.GetPathParam(r, "id")
+	if id == "" {
+		h.SendError(w, r, http.StatusBadRequest, "Missing service_request_id")
+		return
+	}
+
+	erased, err := h.repo.Erase(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			h.SendError(w, r, http.StatusNotFound, "Service request not found")
+		case errors.Is(err, repository.ErrInvalidID):
+			h.SendError(w, r, http.StatusBadRequest, "Missing service_request_id")
+		default:
+			h.log.Errorf("Failed to erase service request: %v", err)
+			h.SendError(w, r, http.StatusInternalServerError, "Failed to erase service request")
+		}
+		return
+	}
+
+	w.Header().Set("ETag", etag(erased.Version))
+	h.sendServiceRequests(w, r, []models.ServiceRequest{erased})
+}
+
 // BulkItemError reports one record rejected during a bulk upsert (either by
-// pre-validation or by the database).
+// pre-validation or by the database), or, with Warning set, a record written
+// with values outside their value sets.
 type BulkItemError struct {
 	Index            int    `json:"index" xml:"index"`
 	ServiceRequestID string `json:"service_request_id" xml:"service_request_id"`
 	Message          string `json:"message" xml:"message"`
+	Warning          bool   `json:"warning,omitempty" xml:"warning,omitempty"`
 }
 
 // BulkUpsertResponse summarizes a bulk upsert. A struct (not a map) so it
@@ -228,6 +521,7 @@ type BulkUpsertResponse struct {
 	Requested int             `json:"requested" xml:"requested"`
 	Created   int             `json:"created" xml:"created"`
 	Updated   int             `json:"updated" xml:"updated"`
+	Skipped   int             `json:"skipped" xml:"skipped"`
 	Failed    int             `json:"failed" xml:"failed"`
 	Errors    []BulkItemError `json:"errors,omitempty" xml:"errors>error,omitempty"`
 }
@@ -238,21 +532,95 @@ type BulkUpsertResponse struct {
 // BulkWrite, keyed on service_request_id. Each record requires service_request_id,
 // service_code, and a location (lat+long, address, or address_id); invalid
 // records are rejected and reported without aborting the batch. Like PUT, a
-// supplied updated_datetime is preserved. Returns 200 with a per-batch summary;
-// 400 only when the whole payload is malformed, empty, or exceeds the cap.
+// supplied updated_datetime is preserved. With ?only_if_newer=true, records
+// whose updated_datetime is not newer than the stored copy are skipped (counted
+// in "skipped") so stale feed reruns cannot clobber fresher edits. Returns 200
+// with a per-batch summary; 400 only when the whole payload is malformed, empty,
+// or exceeds the cap.
+//
+// With ?dictionary=<name> the body carries native source rows instead — a JSON
+// array of objects keyed by column, or a CSV document (Content-Type text/csv)
+// with a header line — which are mapped through that data dictionary (see
+// DICTIONARY_DIR); rows it cannot map are reported like invalid records.
+//
+// Records are checked against the value sets of the dictionary (the one named
+// by ?dictionary, else VALUE_SET_DICTIONARY): in reject mode offending records
+// are reported and not written, in warn mode they are written and reported
+// with "warning": true (not counted as failed).
+// With a properties schema, records whose properties do not conform are
+// reported as failed.
+//
+// An application/x-ndjson body (one record or source row per line) is
+// streamed instead, without the cap: see bulkUpsertNDJSON. Any body may be
+// gzip-compressed (Content-Encoding: gzip).
 func (h *ServiceRequestHandler) BulkUpsertServiceRequests(w http.ResponseWriter, r *http.Request) {
+	var opts repository.BulkUpsertOptions
+	if v := r.URL.Query().Get("only_if_newer"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			h.SendError(w, r, http.StatusBadRequest, "invalid only_if_newer (expected true or false)")
+			return
+		}
+		opts.OnlyIfNewer = b
+	}
+
+	var dict *dictionary.Dictionary
+	if name := r.URL.Query().Get("dictionary"); name != "" {
+		if dict = h.dicts[strings.ToLower(name)]; dict == nil {
+			h.SendError(w, r, http.StatusBadRequest, "unknown dictionary "+strconv.Quote(name))
+			return
+		}
+	}
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			h.SendError(w, r, http.StatusBadRequest, "Invalid gzip request body")
+			return
+		}
+		defer zr.Close()
+		r.Body = zr
+	}
+	if strings.Contains(r.Header.Get("Content-Type"), "ndjson") {
+		h.bulkUpsertNDJSON(w, r, dict, opts)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBulkBodyBytes)
+
 	var incoming []models.ServiceRequest
+	var unmapped map[int]string // index -> dictionary mapping error
+	valueSets := h.valueSets
 
-	if strings.Contains(r.Header.Get("Content-Type"), "xml") {
+	if dict != nil {
+		valueSets = dict
+		rows, ok := h.sourceRows(w, r)
+		if !ok {
+			return
+		}
+		incoming = make([]models.ServiceRequest, len(rows))
+		for i, row := range rows {
+			req, err := dict.Map(row)
+			if err != nil {
+				if unmapped == nil {
+					unmapped = map[int]string{}
+				}
+				unmapped[i] = err.Error()
+			}
+			incoming[i] = req
+		}
+	} else if strings.Contains(r.Header.Get("Content-Type"), "xml") {
 		var wrapper models.ServiceRequests
 		if err := xml.NewDecoder(r.Body).Decode(&wrapper); err != nil {
-			h.SendError(w, r, http.StatusBadRequest, "Invalid request payload")
+			if !h.sendTooLarge(w, r, err) {
+				h.SendError(w, r, http.StatusBadRequest, "Invalid request payload")
+			}
 			return
 		}
 		incoming = wrapper.Items
 	} else {
 		if err := json.NewDecoder(r.Body).Decode(&incoming); err != nil {
-			h.SendError(w, r, http.StatusBadRequest, "Invalid request payload (expected a JSON array of service requests)")
+			if !h.sendTooLarge(w, r, err) {
+				h.SendError(w, r, http.StatusBadRequest, "Invalid request payload (expected a JSON array of service requests)")
+			}
 			return
 		}
 	}
@@ -268,21 +636,23 @@ func (h *ServiceRequestHandler) BulkUpsertServiceRequests(w http.ResponseWriter,
 
 	// Pre-validate; keep valid records, collect rejects (indexes preserved).
 	valid := make([]models.ServiceRequest, 0, len(incoming))
-	var rejects []BulkItemError
+	validIndexes := make([]int, 0, len(incoming))
+	var rejects, warnings []BulkItemError
+	mode := h.valueSetMode(valueSets)
 	for i, req := range incoming {
-		switch {
-		case req.ServiceRequestID == "":
-			rejects = append(rejects, BulkItemError{Index: i, Message: "service_request_id is required"})
-		case req.ServiceCode == "":
-			rejects = append(rejects, BulkItemError{Index: i, ServiceRequestID: req.ServiceRequestID, Message: "service_code is required"})
-		case req.Latitude == 0 && req.Longitude == 0 && req.Address == "" && req.AddressID == "":
-			rejects = append(rejects, BulkItemError{Index: i, ServiceRequestID: req.ServiceRequestID, Message: "a location is required: provide lat and long, address, or address_id"})
-		default:
-			valid = append(valid, req)
+		reject, warning := checkBulkRecord(req, unmapped[i], valueSets, mode)
+		if reject != "" {
+			rejects = append(rejects, BulkItemError{Index: i, ServiceRequestID: req.ServiceRequestID, Message: reject})
+			continue
+		}
+		if warning != "" {
+			warnings = append(warnings, BulkItemError{Index: i, ServiceRequestID: req.ServiceRequestID, Message: warning, Warning: true})
 		}
+		valid = append(valid, req)
+		validIndexes = append(validIndexes, i)
 	}
 
-	result, err := h.repo.BulkUpsert(r.Context(), valid)
+	result, err := h.repo.BulkUpsert(r.Context(), valid, opts)
 	if err != nil {
 		h.log.Errorf("Bulk upsert failed: %v", err)
 		h.SendError(w, r, http.StatusInternalServerError, "Failed to bulk upsert service requests")
@@ -293,18 +663,99 @@ func (h *ServiceRequestHandler) BulkUpsertServiceRequests(w http.ResponseWriter,
 		Requested: len(incoming),
 		Created:   result.Created,
 		Updated:   result.Updated,
+		Skipped:   result.Skipped,
 		Failed:    result.Failed + len(rejects),
 	}
 	for _, e := range rejects {
 		resp.Errors = append(resp.Errors, e)
 	}
 	for _, e := range result.Errors {
+		// The repository indexes the valid records; report the caller's index.
+		if e.Index >= 0 && e.Index < len(validIndexes) {
+			e.Index = validIndexes[e.Index]
+		}
 		resp.Errors = append(resp.Errors, BulkItemError{Index: e.Index, ServiceRequestID: e.ServiceRequestID, Message: e.Message})
 	}
+	resp.Errors = append(resp.Errors, warnings...)
 
 	h.SendResponse(w, r, http.StatusOK, resp)
 }
 
+// sendTooLarge answers 413 when err is a body exceeding its MaxBytesReader
+// limit, and reports whether it did.
+func (h *ServiceRequestHandler) sendTooLarge(w http.ResponseWriter, r *http.Request, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	h.SendError(w, r, http.StatusRequestEntityTooLarge, "request body larger than "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes")
+	return true
+}
+
+// checkBulkRecord validates one bulk record, given the error of mapping it
+// with a dictionary ("" when it mapped or none was used): it returns why the
+// record is rejected, or else the value-set warning to report with it.
+func checkBulkRecord(req models.ServiceRequest, unmapped string, valueSets *dictionary.Dictionary, mode string) (reject, warning string) {
+	violations := valueSets.Check(req)
+	switch {
+	case unmapped != "":
+		return unmapped, ""
+	case req.ServiceRequestID == "":
+		return "service_request_id is required", ""
+	case req.ServiceCode == "":
+		return "service_code is required", ""
+	case req.Latitude == 0 && req.Longitude == 0 && req.Address == "" && req.AddressID == "":
+		return "a location is required: provide lat and long, address, or address_id", ""
+	case len(violations) > 0 && mode == dictionary.EnforceReject:
+		return dictionary.Summary(violations), ""
+	case len(violations) > 0 && mode == dictionary.EnforceWarn:
+		return "", dictionary.Summary(violations)
+	}
+	return "", ""
+}
+
+// sourceRows decodes the native rows of a dictionary bulk upsert: a CSV
+// document, or a JSON array of objects.
+func (h *ServiceRequestHandler) sourceRows(w http.ResponseWriter, r *http.Request) ([]map[string]string, bool) {
+	var rows []map[string]string
+	if strings.Contains(r.Header.Get("Content-Type"), "csv") {
+		src, err := importer.NewCSVSource(r.Body)
+		if err != nil {
+			if !h.sendTooLarge(w, r, err) {
+				h.SendError(w, r, http.StatusBadRequest, "Invalid CSV payload: "+err.Error())
+			}
+			return nil, false
+		}
+		for {
+			row, err := src.Next()
+			if errors.Is(err, io.EOF) {
+				return rows, true
+			}
+			if err != nil {
+				if !h.sendTooLarge(w, r, err) {
+					h.SendError(w, r, http.StatusBadRequest, "Invalid CSV payload: "+err.Error())
+				}
+				return nil, false
+			}
+			rows = append(rows, row)
+			if len(rows) > maxBulkRequests {
+				return rows, true
+			}
+		}
+	}
+	var objs []map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&objs); err != nil {
+		if !h.sendTooLarge(w, r, err) {
+			h.SendError(w, r, http.StatusBadRequest, "Invalid request payload (expected a JSON array of source rows)")
+		}
+		return nil, false
+	}
+	for _, obj := range objs {
+		rows = append(rows, dictionary.JSONRow(obj))
+	}
+	return rows, true
+}
+
 // SearchServiceRequestsByFeature handles GET /open311/v2/requests/search?featureId=...&featureGuid=...
 func (h *ServiceRequestHandler) SearchServiceRequestsByFeature(w http.ResponseWriter, r *http.Request) {
 	featureId := r.URL.Query().Get("featureId")
@@ -316,7 +767,8 @@ func (h *ServiceRequestHandler) SearchServiceRequestsByFeature(w http.ResponseWr
 		return
 	}
 
-	h.SendResponse(w, r, http.StatusOK, results)
+	setViewCaching(w, r)
+	h.SendResponse(w, r, http.StatusOK, h.visible(r, results))
 }
 
 // SearchServiceRequestsByOrganization handles GET /open311/v2/requests/by_organization?organizationId=...
@@ -331,17 +783,76 @@ func (h *ServiceRequestHandler) SearchServiceRequestsByOrganization(w http.Respo
 		h.SendError(w, r, http.StatusInternalServerError, "Failed to search service requests by organization")
 		return
 	}
-	h.SendResponse(w, r, http.StatusOK, results)
+	setViewCaching(w, r)
+	h.SendResponse(w, r, http.StatusOK, h.visible(r, results))
+}
+
+// includeDeleted parses the include_deleted flag. Tombstones are admin data, so
+// the flag requires an authenticated principal; ok=false means an error
+// response was already sent.
+func (h *ServiceRequestHandler) includeDeleted(w http.ResponseWriter, r *http.Request) (include, ok bool) {
+	raw := r.URL.Query().Get("include_deleted")
+	if raw == "" {
+		return false, true
+	}
+	include, err := strconv.ParseBool(raw)
+	if err != nil {
+		h.SendError(w, r, http.StatusBadRequest, "invalid include_deleted (expected true or false)")
+		return false, false
+	}
+	if include && !httputil.Authenticated(r) {
+		h.SendError(w, r, http.StatusUnauthorized, "include_deleted requires a valid API key")
+		return false, false
+	}
+	return include, true
+}
+
+// findServiceRequest loads one request by service_request_id, including a
+// soft-deleted tombstone when includeDeleted is set.
+func (h *ServiceRequestHandler) findServiceRequest(r *http.Request, id string, includeDeleted bool) (models.ServiceRequest, error) {
+	if !includeDeleted {
+		return h.repo.FindByServiceRequestID(r.Context(), id)
+	}
+	results, err := h.repo.Find(r.Context(), repository.ServiceRequestQuery{
+		ServiceRequestIDs: []string{id},
+		IncludeDeleted:    true,
+		PerPage:           1,
+	})
+	if err != nil {
+		return models.ServiceRequest{}, err
+	}
+	if len(results) == 0 {
+		return models.ServiceRequest{}, repository.ErrNotFound
+	}
+	return results[0], nil
+}
+
+// sendPreconditionFailed answers 412 for a failed If-Match.
+func (h *ServiceRequestHandler) sendPreconditionFailed(w http.ResponseWriter, r *http.Request) {
+	h.SendError(w, r, http.StatusPreconditionFailed, "precondition failed: the service request has changed (refetch and retry with the current ETag)")
+}
+
+// visible returns what the client of r may see of results: everything for a
+// principal with the contact scope, the privacy policy's public view otherwise
+// (contact fields removed, sensitive locations blurred) — also for other keys.
+func (h *ServiceRequestHandler) visible(r *http.Request, results []models.ServiceRequest) []models.ServiceRequest {
+	if httputil.HasScope(r, httputil.ScopeContact) {
+		return results
+	}
+	return h.privacy.PublicAll(results)
 }
 
 // sendServiceRequests writes a list of service requests, wrapping in the XML
 // collection type when the client requested XML. An optional status code
-// defaults to 200.
+// defaults to 200. Results are filtered through visible, and the response is
+// cached per view (setViewCaching).
 func (h *ServiceRequestHandler) sendServiceRequests(w http.ResponseWriter, r *http.Request, results []models.ServiceRequest, status ...int) {
 	code := http.StatusOK
 	if len(status) > 0 {
 		code = status[0]
 	}
+	results = h.visible(r, results)
+	setViewCaching(w, r)
 	if httputil.WantsXML(r) {
 		h.SendResponse(w, r, code, models.ServiceRequests{Items: results})
 		return
@@ -385,3 +896,178 @@ func parseTimeParam(s string) (*time.Time, error) {
 	}
 	return &t, nil
 }
+
+// maxGeoRadiusMeters caps the radius query parameter.
+const maxGeoRadiusMeters = 50000
+
+// parseSortParams reads the listing order: sort (requested_datetime or
+// updated_datetime), order (asc or desc, the default) and the cursor of a
+// previous page. A cursor carries its order; explicit sort and order must
+// agree with it.
+func parseSortParams(q url.Values) (sort string, ascending bool, after *repository.Cursor, err error) {
+	sort = q.Get("sort")
+	if sort != "" && !repository.ValidSort(sort) {
+		return "", false, nil, fmt.Errorf("sort must be %s, %s or %s",
+			repository.SortRequestedDatetime, repository.SortUpdatedDatetime, repository.SortRelevance)
+	}
+	order := q.Get("order")
+	if sort == repository.SortRelevance {
+		// Ranked best first and paged by page number only.
+		switch {
+		case q.Get("q") == "":
+			return "", false, nil, fmt.Errorf("sort=relevance requires q")
+		case order != "":
+			return "", false, nil, fmt.Errorf("order is not supported with sort=relevance")
+		case q.Get("cursor") != "":
+			return "", false, nil, fmt.Errorf("cursor is not supported with sort=relevance")
+		}
+		return sort, false, nil, nil
+	}
+	switch order {
+	case "", "desc":
+	case "asc":
+		ascending = true
+	default:
+		return "", false, nil, fmt.Errorf("order must be asc or desc")
+	}
+
+	if s := q.Get("cursor"); s != "" {
+		c, err := repository.DecodeCursor(s)
+		if err != nil {
+			return "", false, nil, fmt.Errorf("invalid cursor")
+		}
+		if (sort != "" && sort != c.Sort) || (order != "" && ascending != c.Ascending) {
+			return "", false, nil, fmt.Errorf("cursor does not match sort and order")
+		}
+		return c.Sort, c.Ascending, &c, nil
+	}
+	return sort, ascending, nil, nil
+}
+
+// parseGeoParams reads the geo filters: lat, long and radius (meters) select a
+// circle; bbox=minLong,minLat,maxLong,maxLat (WGS84, the OGC axis order)
+// selects a box. Both may be combined. Returns nils when absent.
+func parseGeoParams(q url.Values) (*repository.GeoRadius, *repository.GeoBBox, error) {
+	var near *repository.GeoRadius
+	if q.Get("lat") != "" || q.Get("long") != "" || q.Get("radius") != "" {
+		lat, errLat := strconv.ParseFloat(q.Get("lat"), 64)
+		long, errLong := strconv.ParseFloat(q.Get("long"), 64)
+		if errLat != nil || errLong != nil || lat < -90 || lat > 90 || long < -180 || long > 180 {
+			return nil, nil, fmt.Errorf("lat and long must be WGS84 degrees")
+		}
+		radius, err := strconv.ParseFloat(q.Get("radius"), 64)
+		if err != nil || radius <= 0 || radius > maxGeoRadiusMeters {
+			return nil, nil, fmt.Errorf("radius must be between 0 and %d meters", maxGeoRadiusMeters)
+		}
+		near = &repository.GeoRadius{Lat: lat, Long: long, RadiusMeters: radius}
+	}
+
+	var within *repository.GeoBBox
+	if s := q.Get("bbox"); s != "" {
+		b, err := repository.ParseGeoBBox(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		within = &b
+	}
+	return near, within, nil
+}
+
+// parsePropertyFilters reads the properties filters:
+//
+//   - properties.<key>=a,b matches any of the values and properties.<key>!=a,b
+//     (or [ne]) none of them, including requests without the key; a '\'
+//     escapes a ',' or '\' in a value.
+//   - properties.<key>[op]=value compares with op (lt, lte, gt, gte or eq).
+//   - properties.<key>[exists]=true|false tests for the key alone.
+//
+// A key declared in schema compares by its type — numbers numerically, dates
+// and datetimes chronologically — after the values are converted to their
+// canonical form; other keys compare as strings. Keys ending in '!' or ']'
+// need an explicit operator, e.g. properties.wow![eq]=1.
+func parsePropertyFilters(q url.Values, schema *propschema.Schema) ([]repository.PropertyFilter, error) {
+	var params []string
+	for name := range q {
+		if strings.HasPrefix(name, "properties.") {
+			params = append(params, name)
+		}
+	}
+	sort.Strings(params)
+
+	var filters []repository.PropertyFilter
+	for _, name := range params {
+		key, op := strings.TrimPrefix(name, "properties."), repository.PropertyEq
+		if i := strings.LastIndex(key, "["); i > 0 && strings.HasSuffix(key, "]") {
+			key, op = key[:i], key[i+1:len(key)-1]
+		} else if strings.HasSuffix(key, "!") {
+			key, op = strings.TrimSuffix(key, "!"), repository.PropertyNe
+		}
+		if !repository.ValidPropertyOp(op) || op == repository.PropertyMissing {
+			return nil, fmt.Errorf("invalid %s: unknown operator %q (expected eq, ne, lt, lte, gt, gte or exists)", name, op)
+		}
+		if err := repository.ValidatePropertyKey(key); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		typ := propschema.String
+		if schema != nil {
+			if p, ok := schema.Lookup(key, 0); ok {
+				typ = p.Type
+			}
+		}
+		for _, raw := range q[name] {
+			f := repository.PropertyFilter{Key: key, Op: op, Numeric: typ.Numeric()}
+			if op == repository.PropertyExists {
+				exists := true
+				if raw != "" {
+					var err error
+					if exists, err = strconv.ParseBool(raw); err != nil {
+						return nil, fmt.Errorf("invalid %s: %q is not true or false", name, raw)
+					}
+				}
+				if !exists {
+					f.Op = repository.PropertyMissing
+				}
+				filters = append(filters, f)
+				continue
+			}
+			values := splitPropertyValues(raw)
+			if op != repository.PropertyEq && op != repository.PropertyNe {
+				if !typ.Ordered() {
+					return nil, fmt.Errorf("invalid %s: %s values only compare with eq or ne", name, typ)
+				}
+				if len(values) > 1 {
+					return nil, fmt.Errorf("invalid %s: %s takes one value (escape a ',' in it as '\\,')", name, op)
+				}
+			}
+			for _, v := range values {
+				value, err := typ.Convert(v)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s: %v", name, err)
+				}
+				f.Values = append(f.Values, value)
+			}
+			filters = append(filters, f)
+		}
+	}
+	return filters, nil
+}
+
+// splitPropertyValues splits a comma-separated list of property values, in
+// which '\' escapes the next character (a ',' or '\').
+func splitPropertyValues(s string) []string {
+	var values []string
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		case c == ',':
+			values = append(values, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(values, b.String())
+}
@@ -5,12 +5,19 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/privacy"
+	"github.com/timoruohomaki/open311-to-Go/internal/propschema"
 	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
 	"github.com/timoruohomaki/open311-to-Go/pkg/router"
 )
 
@@ -27,12 +34,27 @@ type mockServiceRequestRepo struct {
 }
 
 func (m *mockServiceRequestRepo) Find(ctx context.Context, q repository.ServiceRequestQuery) ([]models.ServiceRequest, error) {
-	return m.data, nil
+	var results []models.ServiceRequest
+	for _, req := range m.data {
+		if req.DeletedAt != nil && !q.IncludeDeleted {
+			continue
+		}
+		if len(q.ServiceRequestIDs) > 0 && req.ServiceRequestID != q.ServiceRequestIDs[0] {
+			continue
+		}
+		results = append(results, req)
+	}
+	return results, nil
+}
+
+func (m *mockServiceRequestRepo) Count(ctx context.Context, q repository.ServiceRequestQuery) (int64, error) {
+	results, err := m.Find(ctx, q)
+	return int64(len(results)), err
 }
 
 func (m *mockServiceRequestRepo) FindByServiceRequestID(ctx context.Context, id string) (models.ServiceRequest, error) {
 	for _, req := range m.data {
-		if req.ServiceRequestID == id {
+		if req.ServiceRequestID == id && req.DeletedAt == nil {
 			return req, nil
 		}
 	}
@@ -50,7 +72,20 @@ func (m *mockServiceRequestRepo) Create(ctx context.Context, req models.ServiceR
 	return req, nil
 }
 
-func (m *mockServiceRequestRepo) Upsert(ctx context.Context, req models.ServiceRequest) (models.ServiceRequest, bool, error) {
+// matches reports whether a stored version satisfies a precondition.
+func matches(pre repository.Precondition, version int64) bool {
+	if len(pre.IfVersions) == 0 {
+		return true
+	}
+	for _, v := range pre.IfVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *mockServiceRequestRepo) Upsert(ctx context.Context, req models.ServiceRequest, pre repository.Precondition) (models.ServiceRequest, bool, error) {
 	if req.ServiceRequestID == "" {
 		return models.ServiceRequest{}, false, repository.ErrInvalidID
 	}
@@ -59,45 +94,105 @@ func (m *mockServiceRequestRepo) Upsert(ctx context.Context, req models.ServiceR
 	}
 	for i, existing := range m.data {
 		if existing.ServiceRequestID == req.ServiceRequestID {
+			if !matches(pre, existing.Version) {
+				return models.ServiceRequest{}, false, repository.ErrPreconditionFailed
+			}
+			req.Version = existing.Version + 1
 			m.data[i] = req
 			return req, false, nil
 		}
 	}
+	if pre.Conditional() {
+		return models.ServiceRequest{}, false, repository.ErrPreconditionFailed
+	}
+	req.Version = 1
 	m.data = append(m.data, req)
 	return req, true, nil
 }
 
-func (m *mockServiceRequestRepo) BulkUpsert(ctx context.Context, reqs []models.ServiceRequest) (repository.BulkUpsertResult, error) {
+func (m *mockServiceRequestRepo) BulkUpsert(ctx context.Context, reqs []models.ServiceRequest, opts repository.BulkUpsertOptions) (repository.BulkUpsertResult, error) {
 	res := repository.BulkUpsertResult{Requested: len(reqs)}
 	for _, req := range reqs {
-		found := false
+		found, skipped := false, false
 		for i, existing := range m.data {
 			if existing.ServiceRequestID == req.ServiceRequestID {
-				m.data[i] = req
+				if opts.OnlyIfNewer && !req.UpdatedDatetime.After(existing.UpdatedDatetime) {
+					skipped = true
+				} else {
+					m.data[i] = req
+				}
 				found = true
 				break
 			}
 		}
-		if found {
+		if skipped {
+			res.Skipped++
+			res.Outcomes = append(res.Outcomes, repository.BulkSkipped)
+		} else if found {
 			res.Updated++
+			res.Outcomes = append(res.Outcomes, repository.BulkUpdated)
 		} else {
 			m.data = append(m.data, req)
 			res.Created++
+			res.Outcomes = append(res.Outcomes, repository.BulkCreated)
 		}
 	}
 	return res, nil
 }
 
-func (m *mockServiceRequestRepo) Delete(ctx context.Context, serviceRequestID string) error {
+func (m *mockServiceRequestRepo) Patch(ctx context.Context, serviceRequestID string, patch repository.ServiceRequestPatch, pre repository.Precondition) (models.ServiceRequest, error) {
 	for i, existing := range m.data {
 		if existing.ServiceRequestID == serviceRequestID {
-			m.data = append(m.data[:i], m.data[i+1:]...)
+			if !matches(pre, existing.Version) {
+				return models.ServiceRequest{}, repository.ErrPreconditionFailed
+			}
+			if err := repository.ApplyServiceRequestPatch(&existing, patch, time.Now().UTC()); err != nil {
+				return models.ServiceRequest{}, err
+			}
+			existing.Version++
+			m.data[i] = existing
+			return existing, nil
+		}
+	}
+	return models.ServiceRequest{}, repository.ErrNotFound
+}
+
+func (m *mockServiceRequestRepo) Delete(ctx context.Context, serviceRequestID string, pre repository.Precondition) error {
+	for i, existing := range m.data {
+		if existing.ServiceRequestID == serviceRequestID && existing.DeletedAt == nil {
+			if !matches(pre, existing.Version) {
+				return repository.ErrPreconditionFailed
+			}
+			now := time.Now().UTC()
+			m.data[i].DeletedAt = &now
+			m.data[i].Version++
 			return nil
 		}
 	}
 	return repository.ErrNotFound
 }
 
+func (m *mockServiceRequestRepo) Erase(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error) {
+	for i, existing := range m.data {
+		if existing.ServiceRequestID == serviceRequestID {
+			now := time.Now().UTC()
+			existing.Description, existing.MediaURL = "", ""
+			for _, f := range existing.ContactFields() {
+				*f = ""
+			}
+			existing.ErasedAt = &now
+			existing.Version++
+			m.data[i] = existing
+			return existing, nil
+		}
+	}
+	return models.ServiceRequest{}, repository.ErrNotFound
+}
+
+func (m *mockServiceRequestRepo) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
 func (m *mockServiceRequestRepo) FindByFeature(ctx context.Context, featureID, featureGuid string) ([]models.ServiceRequest, error) {
 	var results []models.ServiceRequest
 	for _, req := range m.data {
@@ -120,6 +215,19 @@ func (m *mockServiceRequestRepo) FindByOrganization(ctx context.Context, organiz
 	return results, nil
 }
 
+func (m *mockServiceRequestRepo) Each(ctx context.Context, q repository.ServiceRequestQuery, fn func(models.ServiceRequest) error) error {
+	results, err := m.Find(ctx, q)
+	if err != nil {
+		return err
+	}
+	for _, req := range results {
+		if err := fn(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func TestSearchServiceRequestsByFeature(t *testing.T) {
 	featureID := "https://example.com/ogcapi/collections/parks/items/park-42"
 	featureGuid := "park-42"
@@ -376,7 +484,14 @@ func TestDeleteServiceRequest(t *testing.T) {
 		w := httptest.NewRecorder()
 		handler.DeleteServiceRequest(w, r)
 		assert.Equal(t, http.StatusOK, w.Code)
-		assert.Len(t, repo.data, 0)
+		// Soft delete: the tombstone stays, hidden from normal reads.
+		assert.Len(t, repo.data, 1)
+		assert.NotNil(t, repo.data[0].DeletedAt)
+
+		r = withPathParam(httptest.NewRequest(http.MethodDelete, "/open311/v2/requests/sr-1", nil), "id", "sr-1")
+		w = httptest.NewRecorder()
+		handler.DeleteServiceRequest(w, r)
+		assert.Equal(t, http.StatusNotFound, w.Code)
 	})
 
 	t.Run("missing -> 404", func(t *testing.T) {
@@ -407,3 +522,666 @@ func TestGetServiceRequests(t *testing.T) {
 	json.NewDecoder(w.Body).Decode(&results)
 	assert.Len(t, results, 2)
 }
+
+func TestGetServiceRequestsPagination(t *testing.T) {
+	repo := &mockServiceRequestRepo{
+		data: []models.ServiceRequest{
+			{ID: "000000000000000000000001", ServiceRequestID: "sr-1", RequestedDatetime: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+			{ID: "000000000000000000000002", ServiceRequestID: "sr-2", RequestedDatetime: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+	handler := NewServiceRequestHandler(nil, repo)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.GetServiceRequests(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	t.Run("full page links to the next", func(t *testing.T) {
+		w := get("/open311/v2/requests?status=open&per_page=2&page=3")
+		assert.Equal(t, http.StatusOK, w.Code)
+		next := w.Header().Get("X-Next-Cursor")
+		c, err := repository.DecodeCursor(next)
+		assert.NoError(t, err)
+		assert.Equal(t, repository.SortRequestedDatetime, c.Sort)
+		assert.Equal(t, "000000000000000000000002", c.ID)
+		assert.Equal(t, "</open311/v2/requests?cursor="+next+`&per_page=2&status=open>; rel="next"`, w.Header().Get("Link"))
+		assert.Empty(t, w.Header().Get("X-Total-Count"))
+	})
+
+	t.Run("short page has no next", func(t *testing.T) {
+		w := get("/open311/v2/requests?per_page=3&count=true")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-Next-Cursor"))
+		assert.Empty(t, w.Header().Get("Link"))
+		assert.Equal(t, "2", w.Header().Get("X-Total-Count"))
+	})
+
+	t.Run("cursor keeps its sort", func(t *testing.T) {
+		c := repository.Cursor{Sort: repository.SortUpdatedDatetime, Ascending: true, ID: "000000000000000000000001"}
+		assert.Equal(t, http.StatusOK, get("/open311/v2/requests?cursor="+c.Encode()).Code)
+		assert.Equal(t, http.StatusOK, get("/open311/v2/requests?sort=updated_datetime&order=asc&cursor="+c.Encode()).Code)
+		assert.Equal(t, http.StatusBadRequest, get("/open311/v2/requests?order=desc&cursor="+c.Encode()).Code)
+	})
+
+	t.Run("relevance pages by number", func(t *testing.T) {
+		w := get("/open311/v2/requests?q=pothole&sort=relevance&per_page=2")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-Next-Cursor"))
+		assert.Equal(t, `</open311/v2/requests?page=2&per_page=2&q=pothole&sort=relevance>; rel="next"`, w.Header().Get("Link"))
+	})
+
+	for _, target := range []string{
+		"/open311/v2/requests?sort=relevance",
+		"/open311/v2/requests?q=x&sort=relevance&order=asc",
+		"/open311/v2/requests?sort=status",
+		"/open311/v2/requests?order=up",
+		"/open311/v2/requests?cursor=bm90LWEtY3Vyc29y",
+	} {
+		assert.Equal(t, http.StatusBadRequest, get(target).Code, target)
+	}
+}
+
+func TestServiceRequestConditionalRequests(t *testing.T) {
+	newRepo := func() *mockServiceRequestRepo {
+		return &mockServiceRequestRepo{
+			data: []models.ServiceRequest{{ServiceRequestID: "sr-1", ServiceCode: "POTHOLE", Status: "open", Version: 3}},
+		}
+	}
+
+	t.Run("GET sets ETag and honours If-None-Match", func(t *testing.T) {
+		handler := NewServiceRequestHandler(nil, newRepo())
+		r := withPathParam(httptest.NewRequest(http.MethodGet, "/open311/v2/requests/sr-1", nil), "id", "sr-1")
+		w := httptest.NewRecorder()
+		handler.GetServiceRequest(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"v3"`, w.Header().Get("ETag"))
+
+		r = withPathParam(httptest.NewRequest(http.MethodGet, "/open311/v2/requests/sr-1", nil), "id", "sr-1")
+		r.Header.Set("If-None-Match", `"v3"`)
+		w = httptest.NewRecorder()
+		handler.GetServiceRequest(w, r)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("responses vary by API key and are private to a key", func(t *testing.T) {
+		handler := NewServiceRequestHandler(nil, newRepo())
+		r := withPathParam(httptest.NewRequest(http.MethodGet, "/open311/v2/requests/sr-1", nil), "id", "sr-1")
+		w := httptest.NewRecorder()
+		handler.GetServiceRequest(w, r)
+		assert.Equal(t, []string{"X-API-Key"}, w.Header().Values("Vary"))
+		assert.Empty(t, w.Header().Get("Cache-Control"), "the public view may be shared")
+
+		r = r.WithContext(httputil.WithPrincipal(r.Context(), httputil.Principal{KeyID: "k", Scopes: []string{httputil.ScopeContact}}))
+		r.Header.Set("If-None-Match", `"v3"`)
+		w = httptest.NewRecorder()
+		handler.GetServiceRequest(w, r)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Equal(t, []string{"X-API-Key"}, w.Header().Values("Vary"))
+		assert.Equal(t, "private", w.Header().Get("Cache-Control"))
+
+		w = httptest.NewRecorder()
+		handler.GetServiceRequests(w, httptest.NewRequest(http.MethodGet, "/open311/v2/requests", nil))
+		assert.Equal(t, []string{"X-API-Key"}, w.Header().Values("Vary"))
+	})
+
+	put := func(repo *mockServiceRequestRepo, ifMatch string) *httptest.ResponseRecorder {
+		handler := NewServiceRequestHandler(nil, repo)
+		r := httptest.NewRequest(http.MethodPut, "/open311/v2/requests/sr-1", strings.NewReader(`{"service_code":"POTHOLE","status":"closed","address":"1 City Hall Sq"}`))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("If-Match", ifMatch)
+		r = withPathParam(r, "id", "sr-1")
+		w := httptest.NewRecorder()
+		handler.UpsertServiceRequest(w, r)
+		return w
+	}
+
+	t.Run("PUT with matching If-Match -> 200 and new ETag", func(t *testing.T) {
+		repo := newRepo()
+		w := put(repo, `"v3"`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"v4"`, w.Header().Get("ETag"))
+		assert.Equal(t, "closed", repo.data[0].Status)
+	})
+
+	t.Run("PUT with stale If-Match -> 412", func(t *testing.T) {
+		repo := newRepo()
+		w := put(repo, `"v2"`)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Equal(t, "open", repo.data[0].Status)
+	})
+
+	t.Run("PUT with foreign tag -> 412", func(t *testing.T) {
+		assert.Equal(t, http.StatusPreconditionFailed, put(newRepo(), `"abc"`).Code)
+	})
+
+	t.Run("DELETE with stale If-Match -> 412", func(t *testing.T) {
+		repo := newRepo()
+		handler := NewServiceRequestHandler(nil, repo)
+		r := withPathParam(httptest.NewRequest(http.MethodDelete, "/open311/v2/requests/sr-1", nil), "id", "sr-1")
+		r.Header.Set("If-Match", `"v1"`)
+		w := httptest.NewRecorder()
+		handler.DeleteServiceRequest(w, r)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Len(t, repo.data, 1)
+	})
+}
+
+func TestBulkUpsertOnlyIfNewer(t *testing.T) {
+	stored := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo := &mockServiceRequestRepo{
+		data: []models.ServiceRequest{{ServiceRequestID: "sr-1", ServiceCode: "POTHOLE", Status: "closed", UpdatedDatetime: stored}},
+	}
+	handler := NewServiceRequestHandler(nil, repo)
+	body := `[
+		{"service_request_id":"sr-1","service_code":"POTHOLE","status":"open","address":"x","updated_datetime":"2026-04-01T00:00:00Z"},
+		{"service_request_id":"sr-2","service_code":"POTHOLE","address":"x","updated_datetime":"2026-04-01T00:00:00Z"}
+	]`
+	r := httptest.NewRequest(http.MethodPost, "/open311/v2/requests/bulk?only_if_newer=true", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.BulkUpsertServiceRequests(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp BulkUpsertResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, 1, resp.Skipped)
+	assert.Equal(t, 1, resp.Created)
+	assert.Equal(t, "closed", repo.data[0].Status)
+}
+
+func TestBulkUpsertWithDictionary(t *testing.T) {
+	dict, err := dictionary.Parse([]byte(`
+jurisdiction: boston
+timezone: America/New_York
+field_mappings:
+  Case ID: service_request_id
+  Case Topic: service_code
+  Case Status: status
+  Open Date: requested_datetime
+  Full Street Address: address
+properties:
+  Ward: ward
+value_sets:
+  status:
+    In progress: open
+    Closed: closed
+`))
+	require.NoError(t, err)
+	post := func(repo *mockServiceRequestRepo, query, contentType, body string) *httptest.ResponseRecorder {
+		handler := NewServiceRequestHandler(nil, repo, WithDictionaries(dictionary.Registry{"boston": dict}))
+		r := httptest.NewRequest(http.MethodPost, "/open311/v2/requests/bulk"+query, strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		handler.BulkUpsertServiceRequests(w, r)
+		return w
+	}
+
+	t.Run("JSON rows", func(t *testing.T) {
+		repo := &mockServiceRequestRepo{}
+		w := post(repo, "?dictionary=boston", "application/json", `[
+			{"Case ID":"BCS-1","Case Topic":"Pothole","Case Status":"In progress","Open Date":"2025-07-01 09:00:00","Full Street Address":"1 City Hall Sq","Ward":3},
+			{"Case ID":"BCS-2","Case Topic":"Pothole","Open Date":"yesterday","Full Street Address":"x"},
+			{"Case ID":"BCS-3","Case Topic":"Pothole"}
+		]`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp BulkUpsertResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, 1, resp.Created)
+		assert.Equal(t, 2, resp.Failed)
+		require.Len(t, resp.Errors, 2)
+		assert.Contains(t, resp.Errors[0].Message, "Open Date")
+		assert.Equal(t, "BCS-3", resp.Errors[1].ServiceRequestID)
+
+		require.Len(t, repo.data, 1)
+		got := repo.data[0]
+		assert.Equal(t, "open", got.Status)
+		assert.Equal(t, time.Date(2025, 7, 1, 13, 0, 0, 0, time.UTC), got.RequestedDatetime)
+		assert.Equal(t, "3", got.Properties["ward"])
+	})
+
+	t.Run("CSV rows", func(t *testing.T) {
+		repo := &mockServiceRequestRepo{}
+		w := post(repo, "?dictionary=Boston", "text/csv", "Case ID,Case Topic,Case Status,Full Street Address\nBCS-4,Graffiti,Closed,2 Water St\n")
+		assert.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, repo.data, 1)
+		assert.Equal(t, "closed", repo.data[0].Status)
+	})
+
+	t.Run("unknown dictionary -> 400", func(t *testing.T) {
+		w := post(&mockServiceRequestRepo{}, "?dictionary=paris", "application/json", `[{}]`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestPatchServiceRequest(t *testing.T) {
+	requested := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	newRepo := func() *mockServiceRequestRepo {
+		return &mockServiceRequestRepo{
+			data: []models.ServiceRequest{{
+				ServiceRequestID:  "sr-1",
+				ServiceCode:       "POTHOLE",
+				Status:            "open",
+				StatusNotes:       "queued",
+				Address:           "1 City Hall Sq",
+				RequestedDatetime: requested,
+				UpdatedDatetime:   requested,
+				Properties:        models.Properties{"ward": "3", "assigned_team": "Highway"},
+				Version:           2,
+			}},
+		}
+	}
+	patch := func(repo *mockServiceRequestRepo, contentType, body, ifMatch string) *httptest.ResponseRecorder {
+		handler := NewServiceRequestHandler(nil, repo)
+		r := httptest.NewRequest(http.MethodPatch, "/open311/v2/requests/sr-1", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+		r = withPathParam(r, "id", "sr-1")
+		w := httptest.NewRecorder()
+		handler.PatchServiceRequest(w, r)
+		return w
+	}
+
+	t.Run("JSON merge patch updates fields and properties keys", func(t *testing.T) {
+		repo := newRepo()
+		w := patch(repo, "application/merge-patch+json",
+			`{"status":"closed","status_notes":null,"properties":{"closure_reason":"Case Resolved","assigned_team":null}}`, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"v3"`, w.Header().Get("ETag"))
+
+		got := repo.data[0]
+		assert.Equal(t, "closed", got.Status)
+		assert.Equal(t, "", got.StatusNotes)
+		assert.Equal(t, "1 City Hall Sq", got.Address)
+		assert.Equal(t, models.Properties{"ward": "3", "closure_reason": "Case Resolved"}, got.Properties)
+		assert.True(t, got.UpdatedDatetime.After(requested))
+	})
+
+	t.Run("XML equivalent with nil attribute", func(t *testing.T) {
+		repo := newRepo()
+		body := `<request><status>closed</status><lat>42.36</lat><long>-71.05</long>` +
+			`<properties><property key="ward" nil="true"/></properties></request>`
+		w := patch(repo, "application/merge-patch+xml", body, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		got := repo.data[0]
+		assert.Equal(t, "closed", got.Status)
+		assert.Equal(t, 42.36, got.Latitude)
+		assert.Equal(t, -71.05, got.Longitude)
+		assert.Equal(t, models.Properties{"assigned_team": "Highway"}, got.Properties)
+	})
+
+	t.Run("explicit updated_datetime is kept", func(t *testing.T) {
+		repo := newRepo()
+		w := patch(repo, "application/json", `{"updated_datetime":"2026-06-01T08:00:00Z"}`, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, time.Date(2026, 6, 1, 8, 0, 0, 0, time.UTC), repo.data[0].UpdatedDatetime)
+	})
+
+	t.Run("properties null removes all properties", func(t *testing.T) {
+		repo := newRepo()
+		assert.Equal(t, http.StatusOK, patch(repo, "application/merge-patch+json", `{"properties":null}`, "").Code)
+		assert.Nil(t, repo.data[0].Properties)
+	})
+
+	t.Run("invalid patches -> 400", func(t *testing.T) {
+		for _, body := range []string{
+			`{"service_request_id":"other"}`,
+			`{"service_code":null}`,
+			`{"lat":"north"}`,
+			`{"status":true}`,
+			`{"properties":{"a.b":"x"}}`,
+			`{}`,
+			`[]`,
+		} {
+			repo := newRepo()
+			w := patch(repo, "application/merge-patch+json", body, "")
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+			assert.Equal(t, int64(2), repo.data[0].Version, body)
+		}
+	})
+
+	t.Run("stale If-Match -> 412", func(t *testing.T) {
+		repo := newRepo()
+		w := patch(repo, "application/merge-patch+json", `{"status":"closed"}`, `"v1"`)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		assert.Equal(t, "open", repo.data[0].Status)
+	})
+
+	t.Run("unknown request -> 404", func(t *testing.T) {
+		w := patch(&mockServiceRequestRepo{}, "application/merge-patch+json", `{"status":"closed"}`, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestSoftDeletedServiceRequests(t *testing.T) {
+	deleted := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo := &mockServiceRequestRepo{
+		data: []models.ServiceRequest{
+			{ServiceRequestID: "sr-1", ServiceCode: "POTHOLE"},
+			{ServiceRequestID: "sr-2", ServiceCode: "POTHOLE", DeletedAt: &deleted},
+		},
+	}
+	handler := NewServiceRequestHandler(nil, repo)
+	get := func(target string, authenticated bool, fn http.HandlerFunc, id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if authenticated {
+			r = r.WithContext(httputil.WithPrincipal(r.Context(), httputil.Principal{KeyID: "k"}))
+		}
+		if id != "" {
+			r = withPathParam(r, "id", id)
+		}
+		w := httptest.NewRecorder()
+		fn(w, r)
+		return w
+	}
+
+	t.Run("list hides tombstones", func(t *testing.T) {
+		w := get("/open311/v2/requests", false, handler.GetServiceRequests, "")
+		var results []models.ServiceRequest
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&results))
+		assert.Len(t, results, 1)
+	})
+
+	t.Run("include_deleted requires an API key", func(t *testing.T) {
+		w := get("/open311/v2/requests?include_deleted=true", false, handler.GetServiceRequests, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("include_deleted lists tombstones", func(t *testing.T) {
+		w := get("/open311/v2/requests?include_deleted=true", true, handler.GetServiceRequests, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"deleted_at":"2026-05-01T12:00:00Z"`)
+		var results []models.ServiceRequest
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&results))
+		assert.Len(t, results, 2)
+	})
+
+	t.Run("single tombstone is 404 without include_deleted", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get("/open311/v2/requests/sr-2", false, handler.GetServiceRequest, "sr-2").Code)
+		assert.Equal(t, http.StatusOK, get("/open311/v2/requests/sr-2?include_deleted=true", true, handler.GetServiceRequest, "sr-2").Code)
+	})
+}
+
+func TestEraseServiceRequest(t *testing.T) {
+	repo := &mockServiceRequestRepo{
+		data: []models.ServiceRequest{{
+			ServiceRequestID: "sr-1",
+			ServiceCode:      "POTHOLE",
+			Status:           "closed",
+			Description:      "Reported by Jane at 12 Elm St, call 555-0100",
+			MediaURL:         "https://example.com/photo.jpg",
+			Latitude:         42.36,
+			Longitude:        -71.05,
+		}},
+	}
+	handler := NewServiceRequestHandler(nil, repo)
+	erase := func(id string) *httptest.ResponseRecorder {
+		r := withPathParam(httptest.NewRequest(http.MethodPost, "/open311/v2/requests/"+id+"/erasure", nil), "id", id)
+		w := httptest.NewRecorder()
+		handler.EraseServiceRequest(w, r)
+		return w
+	}
+
+	w := erase("sr-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	got := repo.data[0]
+	assert.Empty(t, got.Description)
+	assert.Empty(t, got.MediaURL)
+	assert.NotNil(t, got.ErasedAt)
+	// The statistical record is kept.
+	assert.Equal(t, "POTHOLE", got.ServiceCode)
+	assert.Equal(t, "closed", got.Status)
+	assert.Equal(t, 42.36, got.Latitude)
+
+	assert.Equal(t, http.StatusNotFound, erase("nope").Code)
+}
+
+func TestServiceRequestPrivacy(t *testing.T) {
+	repo := &mockServiceRequestRepo{
+		data: []models.ServiceRequest{{
+			ServiceRequestID: "sr-1",
+			ServiceCode:      "DOMESTIC_VIOLENCE",
+			Address:          "12 Elm St",
+			Latitude:         42.361234,
+			Longitude:        -71.057891,
+			Email:            "jane@example.com",
+			FirstName:        "Jane",
+			Phone:            "555-0100",
+		}},
+	}
+	policy := privacy.NewPolicy([]string{"DOMESTIC_VIOLENCE"}, privacy.CoordinatesRound, 3, 0, nil)
+	handler := NewServiceRequestHandler(nil, repo, WithPrivacyPolicy(policy))
+
+	list := func(principal *httputil.Principal) models.ServiceRequest {
+		r := httptest.NewRequest(http.MethodGet, "/open311/v2/requests", nil)
+		if principal != nil {
+			r = r.WithContext(httputil.WithPrincipal(r.Context(), *principal))
+		}
+		w := httptest.NewRecorder()
+		handler.GetServiceRequests(w, r)
+		var results []models.ServiceRequest
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&results))
+		assert.Len(t, results, 1)
+		return results[0]
+	}
+
+	t.Run("public read hides contact and blurs location", func(t *testing.T) {
+		got := list(nil)
+		assert.Empty(t, got.Email)
+		assert.Empty(t, got.FirstName)
+		assert.Empty(t, got.Phone)
+		assert.Empty(t, got.Address)
+		assert.Equal(t, 42.361, got.Latitude)
+		assert.Equal(t, -71.058, got.Longitude)
+	})
+
+	t.Run("a key without the contact scope gets the public view", func(t *testing.T) {
+		got := list(&httputil.Principal{KeyID: "feeder"})
+		assert.Empty(t, got.Email)
+		assert.Equal(t, 42.361, got.Latitude)
+	})
+
+	t.Run("contact scope sees everything", func(t *testing.T) {
+		got := list(&httputil.Principal{KeyID: "k", Scopes: []string{httputil.ScopeContact}})
+		assert.Equal(t, "jane@example.com", got.Email)
+		assert.Equal(t, "555-0100", got.Phone)
+		assert.Equal(t, 42.361234, got.Latitude)
+	})
+
+	t.Run("stored data is never modified", func(t *testing.T) {
+		list(nil)
+		assert.Equal(t, "jane@example.com", repo.data[0].Email)
+	})
+}
+
+func TestGeoFiltersDoNotLocateBlurredRequests(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryServiceRequestRepository()
+	for _, req := range []models.ServiceRequest{
+		{ServiceRequestID: "dv", ServiceCode: "DOMESTIC_VIOLENCE", Latitude: 42.361234, Longitude: -71.057891},
+		{ServiceRequestID: "hole", ServiceCode: "pothole", Latitude: 42.361234, Longitude: -71.057891},
+	} {
+		_, err := repo.Create(ctx, req)
+		require.NoError(t, err)
+	}
+	policy := privacy.NewPolicy([]string{"DOMESTIC_VIOLENCE"}, privacy.CoordinatesRound, 3, 0, nil)
+	handler := NewServiceRequestHandler(nil, repo, WithPrivacyPolicy(policy))
+
+	list := func(query string, principal *httputil.Principal) []string {
+		r := httptest.NewRequest(http.MethodGet, "/open311/v2/requests?"+query, nil)
+		if principal != nil {
+			r = r.WithContext(httputil.WithPrincipal(r.Context(), *principal))
+		}
+		w := httptest.NewRecorder()
+		handler.GetServiceRequests(w, r)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var results []models.ServiceRequest
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&results))
+		var ids []string
+		for _, req := range results {
+			ids = append(ids, req.ServiceRequestID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	// A bbox a few meters around the exact point.
+	tight := "bbox=-71.05790,42.36122,-71.05788,42.36125"
+	near := "lat=42.361234&long=-71.057891&radius=5"
+	for _, query := range []string{tight, near, tight + "&service_code=DOMESTIC_VIOLENCE"} {
+		assert.NotContains(t, list(query, nil), "dv", query)
+		assert.NotContains(t, list(query, &httputil.Principal{KeyID: "feeder"}), "dv", query)
+	}
+	assert.Equal(t, []string{"hole"}, list(tight, nil), "other codes still match")
+	assert.Equal(t, []string{"dv", "hole"}, list("", nil), "no geo filter, no exclusion")
+	assert.Equal(t, []string{"dv", "hole"}, list(tight, &httputil.Principal{KeyID: "k", Scopes: []string{httputil.ScopeContact}}))
+}
+
+func TestPropertySchema(t *testing.T) {
+	schema, err := propschema.Parse([]byte(`
+version: 1
+namespaces:
+  psk5970: {closed: true}
+properties:
+  psk5970:event_class: {type: string, required: true}
+  psk5970:condition_grade: {type: integer}
+  psk5970:safety_risk: {type: boolean}
+`))
+	require.NoError(t, err)
+	repo := repository.NewSchemaServiceRequestRepository(repository.NewMemoryServiceRequestRepository(), schema)
+	handler := NewServiceRequestHandler(nil, repo, WithPropertySchema(schema))
+	rt := router.New()
+	rt.Handle("GET", "/open311/v2/requests", handler.GetServiceRequests)
+	rt.Handle("POST", "/open311/v2/requests", handler.CreateServiceRequest)
+	rt.Handle("PATCH", "/open311/v2/requests/{id}", handler.PatchServiceRequest)
+	rt.Handle("POST", "/open311/v2/requests/bulk", handler.BulkUpsertServiceRequests)
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, r)
+		return w
+	}
+
+	w := send("POST", "/open311/v2/requests", `{"service_code":"POTHOLE","address":"x",
+		"properties":{"psk5970:event_class":"inspection","psk5970:condition_grade":" 09","psk5970:safety_risk":"TRUE"}}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created []models.ServiceRequest
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, models.Properties{"psk5970:event_class": "inspection", "psk5970:condition_grade": "9", "psk5970:safety_risk": "true"}, created[0].Properties)
+	assert.Equal(t, 1, created[0].PropertiesSchemaVersion)
+
+	w = send("POST", "/open311/v2/requests", `{"service_code":"POTHOLE","address":"x","properties":{"psk5970:condition_grade":"poor","psk5970:colour":"red"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `psk5970:colour: not in namespace psk5970`)
+	assert.Contains(t, w.Body.String(), `psk5970:condition_grade: \"poor\" is not an integer`)
+	assert.Contains(t, w.Body.String(), `psk5970:event_class: required`)
+
+	w = send("PATCH", "/open311/v2/requests/"+created[0].ServiceRequestID, `{"properties":{"psk5970:condition_grade":"high"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = send("POST", "/open311/v2/requests/bulk", `[
+		{"service_request_id":"b-1","service_code":"POTHOLE","address":"x","properties":{"psk5970:event_class":"repair","psk5970:condition_grade":"10"}},
+		{"service_request_id":"b-2","service_code":"POTHOLE","address":"x","properties":{"psk5970:condition_grade":"3"}},
+		{"service_request_id":"b-3","service_code":"POTHOLE","address":"x","properties":{"psk5970:event_class":"fault","psk5970:condition_grade":"2"}}
+	]`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var bulk BulkUpsertResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&bulk))
+	assert.Equal(t, 2, bulk.Created)
+	require.Len(t, bulk.Errors, 1)
+	assert.Equal(t, 1, bulk.Errors[0].Index)
+
+	list := func(query string) (int, []string) {
+		w := send("GET", "/open311/v2/requests?"+query, "")
+		var results []models.ServiceRequest
+		_ = json.NewDecoder(w.Body).Decode(&results)
+		var ids []string
+		for _, r := range results {
+			ids = append(ids, r.Properties["psk5970:condition_grade"])
+		}
+		return w.Code, ids
+	}
+	code, grades := list("properties.psk5970:condition_grade%5Bgte%5D=9")
+	assert.Equal(t, http.StatusOK, code)
+	assert.ElementsMatch(t, []string{"9", "10"}, grades, "integers compare as numbers")
+	_, grades = list("properties.psk5970:condition_grade=09")
+	assert.Equal(t, []string{"9"}, grades, "the query value is converted too")
+	_, grades = list("properties.psk5970:event_class=fault")
+	assert.Equal(t, []string{"2"}, grades)
+
+	code, _ = list("properties.psk5970:condition_grade%5Bgte%5D=high")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = list("properties.psk5970:safety_risk%5Blt%5D=true")
+	assert.Equal(t, http.StatusBadRequest, code, "booleans only compare with eq")
+	code, _ = list("properties.ward%5Babout%5D=3")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestPropertyFilterSyntax(t *testing.T) {
+	repo := repository.NewMemoryServiceRequestRepository()
+	for id, props := range map[string]models.Properties{
+		"a": {"ward": "7", "closure_reason": "Noted"},
+		"b": {"ward": "12", "closure_reason": "Case Resolved, no action"},
+		"c": {"psk5970:event_class": "repair"},
+	} {
+		_, err := repo.Create(context.Background(), models.ServiceRequest{ServiceRequestID: id, ServiceCode: "x", Properties: props})
+		require.NoError(t, err)
+	}
+	handler := NewServiceRequestHandler(nil, repo)
+	list := func(query string) (int, []string) {
+		r := httptest.NewRequest("GET", "/open311/v2/requests?"+query, nil)
+		w := httptest.NewRecorder()
+		handler.GetServiceRequests(w, r)
+		var results []models.ServiceRequest
+		_ = json.NewDecoder(w.Body).Decode(&results)
+		var ids []string
+		for _, r := range results {
+			ids = append(ids, r.ServiceRequestID)
+		}
+		sort.Strings(ids)
+		return w.Code, ids
+	}
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"properties.ward=7", []string{"a"}},
+		{"properties.ward=7,12", []string{"a", "b"}},
+		{"properties.ward!=7", []string{"b", "c"}},
+		{"properties.ward%5Bne%5D=7,12", []string{"c"}},
+		{"properties.ward%5Bexists%5D=true", []string{"a", "b"}},
+		{"properties.ward%5Bexists%5D=false", []string{"c"}},
+		{`properties.closure_reason=Case+Resolved\,+no+action`, []string{"b"}},
+		{"properties.psk5970:event_class=repair", []string{"c"}},
+		{"properties.psk5970%3Aevent_class=repair,fault", []string{"c"}},
+		{"properties.ward=7&properties.closure_reason=Noted", []string{"a"}},
+	}
+	for _, tc := range cases {
+		code, ids := list(tc.query)
+		require.Equal(t, http.StatusOK, code, tc.query)
+		assert.Equal(t, tc.want, ids, tc.query)
+	}
+
+	for _, query := range []string{
+		"properties.ward%5Bgt%5D=3,4",
+		"properties.ward%5Bexists%5D=maybe",
+		"properties.ward%5Bmissing%5D=true",
+		"properties.$where=1",
+	} {
+		code, _ := list(query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
+func TestSplitPropertyValues(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, splitPropertyValues("a,b"))
+	assert.Equal(t, []string{"a,b", `c\`}, splitPropertyValues(`a\,b,c\\`))
+	assert.Equal(t, []string{""}, splitPropertyValues(""))
+	assert.Equal(t, []string{`trailing\`}, splitPropertyValues(`trailing\`))
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/internal/stream"
+)
+
+const (
+	// streamRetryMillis is the reconnection delay suggested to stream clients.
+	streamRetryMillis = 3000
+	// streamWriteTimeout bounds each write to a stream client; the server's
+	// WriteTimeout would otherwise end every stream.
+	streamWriteTimeout = 30 * time.Second
+	// Stream event names besides the change operations.
+	streamEventReset = "reset"
+)
+
+// StreamServiceRequests handles GET /open311/v2/requests/stream: a
+// Server-Sent Events feed of the requests created, updated and deleted from
+// now on, filtered with the listing's parameters (service_code, status, q,
+// feature/organization, dates, lat/long/radius, bbox, include_deleted).
+// Events are named create, update or delete and carry the request as JSON
+// (the public view for unauthenticated clients, the tombstone for delete).
+// A client reconnecting with Last-Event-ID receives the events it missed; when
+// they are no longer available it gets a reset event and should reload with
+// GET /requests first. Idle streams receive a comment every heartbeat.
+func (h *ServiceRequestHandler) StreamServiceRequests(w http.ResponseWriter, r *http.Request) {
+	if h.stream == nil {
+		h.SendError(w, r, http.StatusNotFound, "Live stream not enabled")
+		return
+	}
+	query, ok := h.serviceRequestQuery(w, r)
+	if !ok {
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id") // for clients that cannot set headers
+	}
+	sub, replay, resumed, err := h.stream.Subscribe(lastEventID)
+	if err != nil {
+		if !errors.Is(err, stream.ErrTooManySubscribers) && !errors.Is(err, stream.ErrClosed) {
+			h.log.Errorf("Failed to subscribe to the request stream: %v", err)
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(streamRetryMillis/1000))
+		h.SendError(w, r, http.StatusServiceUnavailable, "Live stream unavailable, retry later")
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // no proxy buffering (nginx)
+	w.WriteHeader(http.StatusOK)
+
+	send := func(write func() error) bool {
+		// Not every writer supports deadlines (e.g. in tests); then the
+		// server's WriteTimeout applies.
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if err := write(); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	if !send(func() error {
+		if _, err := fmt.Fprintf(w, "retry: %d\n\n", streamRetryMillis); err != nil {
+			return err
+		}
+		if !resumed {
+			_, err := fmt.Fprintf(w, "event: %s\ndata: {}\n\n", streamEventReset)
+			return err
+		}
+		for _, e := range replay {
+			if err := h.writeStreamEvent(w, r, query, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}) {
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if !send(func() error {
+				_, err := fmt.Fprint(w, ": heartbeat\n\n")
+				return err
+			}) {
+				return
+			}
+		case e, ok := <-sub.Events():
+			if !ok {
+				return // fell behind or shutting down: the client resumes
+			}
+			if !send(func() error { return h.writeStreamEvent(w, r, query, e) }) {
+				return
+			}
+		}
+	}
+}
+
+// writeStreamEvent writes e in SSE framing if it passes the client's filters.
+// Deletes are matched by the tombstone, which the listing only returns with
+// include_deleted.
+func (h *ServiceRequestHandler) writeStreamEvent(w http.ResponseWriter, r *http.Request, query repository.ServiceRequestQuery, e stream.Event) error {
+	if e.Operation == repository.ChangeDelete {
+		query.IncludeDeleted = true
+	}
+	if !query.Matches(e.Request) {
+		return nil
+	}
+	data, err := json.Marshal(h.visible(r, []models.ServiceRequest{e.Request})[0])
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Operation, data)
+	return err
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
+)
+
+// maxReportExamples caps the service_request_ids listed per non-conforming
+// value.
+const maxReportExamples = 5
+
+// valueSetMode is the enforcement mode for dict: VALUE_SET_MODE when set, else
+// the dictionary's own; off without a dictionary.
+func (h *ServiceRequestHandler) valueSetMode(dict *dictionary.Dictionary) string {
+	switch {
+	case dict == nil:
+		return dictionary.EnforceOff
+	case h.valueMode != "":
+		return h.valueMode
+	}
+	return dict.Enforcement.Mode
+}
+
+// enforceValueSets applies the enforcement mode of dict to the violations of
+// one write: reject answers 400 (ok=false), warn adds an X-Validation-Warning
+// header per violation and lets the write proceed.
+func (h *ServiceRequestHandler) enforceValueSets(w http.ResponseWriter, r *http.Request, dict *dictionary.Dictionary, violations []dictionary.Violation) bool {
+	if len(violations) == 0 {
+		return true
+	}
+	switch h.valueSetMode(dict) {
+	case dictionary.EnforceReject:
+		h.SendError(w, r, http.StatusBadRequest, "values outside their value sets: "+dictionary.Summary(violations))
+		return false
+	case dictionary.EnforceWarn:
+		for _, v := range violations {
+			w.Header().Add("X-Validation-Warning", v.String())
+		}
+	}
+	return true
+}
+
+// checkPatch checks the string fields and properties a merge patch sets.
+func checkPatch(dict *dictionary.Dictionary, patch repository.ServiceRequestPatch) []dictionary.Violation {
+	fields := map[string]string{}
+	for name, v := range patch.Fields {
+		if s, ok := v.(string); ok {
+			fields[name] = s
+		}
+	}
+	props := map[string]string{}
+	for k, v := range patch.Properties {
+		if v != nil {
+			props[k] = *v
+		}
+	}
+	return dict.CheckValues(fields, props)
+}
+
+// ValueReportEntry is one non-conforming stored value.
+type ValueReportEntry struct {
+	// Key is the field name, or "properties.<key>".
+	Key      string `json:"key" xml:"key"`
+	ValueSet string `json:"value_set" xml:"value_set"`
+	Value    string `json:"value" xml:"value"`
+	Count    int    `json:"count" xml:"count"`
+	// Examples are the first service_request_ids carrying the value.
+	Examples []string `json:"examples" xml:"examples>service_request_id"`
+}
+
+// ValueReport lists the stored values outside their value sets.
+type ValueReport struct {
+	XMLName       xml.Name           `json:"-" xml:"value_report"`
+	Dictionary    string             `json:"dictionary" xml:"dictionary"`
+	Scanned       int                `json:"scanned" xml:"scanned"`
+	Nonconforming []ValueReportEntry `json:"nonconforming" xml:"nonconforming>value"`
+}
+
+// GetValueReport handles GET /open311/v2/requests/value_report — a project
+// extension (API key required) that scans the stored service requests matching
+// the listing filters and lists the values outside the value sets of a
+// dictionary's enforcement rules (?dictionary=, else VALUE_SET_DICTIONARY),
+// most frequent first, e.g. to clean up data written before enforcement was
+// on or in warn mode.
+func (h *ServiceRequestHandler) GetValueReport(w http.ResponseWriter, r *http.Request) {
+	if !httputil.Authenticated(r) {
+		h.SendError(w, r, http.StatusUnauthorized, "the value report requires a valid API key")
+		return
+	}
+	dict := h.valueSets
+	if name := r.URL.Query().Get("dictionary"); name != "" {
+		dict = h.dicts[strings.ToLower(name)]
+	}
+	if dict == nil {
+		h.SendError(w, r, http.StatusBadRequest, "no dictionary: pass ?dictionary= or set VALUE_SET_DICTIONARY")
+		return
+	}
+	query, ok := h.serviceRequestQuery(w, r)
+	if !ok {
+		return
+	}
+
+	report := ValueReport{Dictionary: dict.Name, Nonconforming: []ValueReportEntry{}}
+	entries := map[dictionary.Violation]*ValueReportEntry{}
+	query.PerPage = 100
+	for {
+		page, err := h.repo.Find(r.Context(), query)
+		if err != nil {
+			h.log.Errorf("Value report scan failed: %v", err)
+			h.SendError(w, r, http.StatusInternalServerError, "Failed to scan service requests")
+			return
+		}
+		for _, req := range page {
+			report.Scanned++
+			for _, v := range dict.Check(req) {
+				e := entries[v]
+				if e == nil {
+					e = &ValueReportEntry{Key: v.Key, ValueSet: v.ValueSet, Value: v.Value}
+					entries[v] = e
+				}
+				e.Count++
+				if len(e.Examples) < maxReportExamples {
+					e.Examples = append(e.Examples, req.ServiceRequestID)
+				}
+			}
+		}
+		if len(page) < query.PerPage {
+			break
+		}
+		cursor := query.CursorAfter(page[len(page)-1])
+		query.After = &cursor
+	}
+
+	for _, e := range entries {
+		report.Nonconforming = append(report.Nonconforming, *e)
+	}
+	sort.Slice(report.Nonconforming, func(i, j int) bool {
+		a, b := report.Nonconforming[i], report.Nonconforming[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.Value < b.Value
+	})
+	h.SendResponse(w, r, http.StatusOK, report)
+}
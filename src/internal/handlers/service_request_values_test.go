@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
+	"github.com/timoruohomaki/open311-to-Go/pkg/router"
+)
+
+func valueSetDictionary(t *testing.T) *dictionary.Dictionary {
+	t.Helper()
+	d, err := dictionary.Parse([]byte(`
+jurisdiction: boston
+field_mappings:
+  Case ID: service_request_id
+value_sets:
+  on_time: [ONTIME, OVERDUE]
+enforcement:
+  mode: warn
+  rules:
+    on_time: on_time
+`))
+	require.NoError(t, err)
+	return d
+}
+
+func TestValueSetEnforcement(t *testing.T) {
+	dict := valueSetDictionary(t)
+	send := func(mode, method, path, body string) *httptest.ResponseRecorder {
+		repo := &mockServiceRequestRepo{data: []models.ServiceRequest{{ServiceRequestID: "sr-1", ServiceCode: "POTHOLE", Status: "open", Address: "x"}}}
+		handler := NewServiceRequestHandler(nil, repo, WithValueSets(dict, mode))
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		rt := router.New()
+		rt.Handle("POST", "/open311/v2/requests", handler.CreateServiceRequest)
+		rt.Handle("PUT", "/open311/v2/requests/{id}", handler.UpsertServiceRequest)
+		rt.Handle("PATCH", "/open311/v2/requests/{id}", handler.PatchServiceRequest)
+		rt.ServeHTTP(w, r)
+		return w
+	}
+	typo := `{"service_code":"POTHOLE","address":"x","properties":{"on_time":"ONTME"}}`
+
+	w := send("", "POST", "/open311/v2/requests", typo)
+	assert.Equal(t, http.StatusCreated, w.Code, "the dictionary's warn mode writes")
+	assert.Equal(t, []string{`properties.on_time: "ONTME" is not in value set on_time`}, w.Header().Values("X-Validation-Warning"))
+
+	w = send("", "POST", "/open311/v2/requests", `{"service_code":"POTHOLE","address":"x","properties":{"on_time":"ONTIME"}}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Values("X-Validation-Warning"))
+
+	w = send(dictionary.EnforceReject, "PUT", "/open311/v2/requests/sr-1", typo)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "ONTME")
+
+	w = send(dictionary.EnforceReject, "PATCH", "/open311/v2/requests/sr-1", `{"properties":{"on_time":"late"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = send(dictionary.EnforceOff, "POST", "/open311/v2/requests", typo)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Values("X-Validation-Warning"))
+}
+
+func TestBulkUpsertValueSets(t *testing.T) {
+	dict := valueSetDictionary(t)
+	body := `[
+		{"service_request_id":"sr-1","service_code":"POTHOLE","address":"x","properties":{"on_time":"ONTME"}},
+		{"service_request_id":"sr-2","service_code":"POTHOLE","address":"x","properties":{"on_time":"ONTIME"}}
+	]`
+	post := func(mode string) (BulkUpsertResponse, *mockServiceRequestRepo) {
+		repo := &mockServiceRequestRepo{}
+		handler := NewServiceRequestHandler(nil, repo, WithValueSets(dict, mode))
+		r := httptest.NewRequest(http.MethodPost, "/open311/v2/requests/bulk", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.BulkUpsertServiceRequests(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp BulkUpsertResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp, repo
+	}
+
+	resp, repo := post(dictionary.EnforceWarn)
+	assert.Equal(t, 2, resp.Created)
+	assert.Zero(t, resp.Failed)
+	require.Len(t, resp.Errors, 1)
+	assert.True(t, resp.Errors[0].Warning)
+	assert.Equal(t, "sr-1", resp.Errors[0].ServiceRequestID)
+	assert.Len(t, repo.data, 2)
+
+	resp, repo = post(dictionary.EnforceReject)
+	assert.Equal(t, 1, resp.Created)
+	assert.Equal(t, 1, resp.Failed)
+	require.Len(t, resp.Errors, 1)
+	assert.False(t, resp.Errors[0].Warning)
+	assert.Len(t, repo.data, 1)
+}
+
+func TestGetValueReport(t *testing.T) {
+	dict := valueSetDictionary(t)
+	repo := repository.NewMemoryServiceRequestRepository()
+	var reqs []models.ServiceRequest
+	for i := range 150 {
+		onTime := "ONTIME"
+		switch {
+		case i%10 == 0:
+			onTime = "ONTME"
+		case i == 7:
+			onTime = "late"
+		}
+		reqs = append(reqs, models.ServiceRequest{
+			ServiceRequestID: fmt.Sprintf("sr-%03d", i), ServiceCode: "POTHOLE", Address: "x",
+			Properties: models.Properties{"on_time": onTime},
+		})
+	}
+	_, err := repo.BulkUpsert(t.Context(), reqs, repository.BulkUpsertOptions{})
+	require.NoError(t, err)
+	handler := NewServiceRequestHandler(nil, repo, WithValueSets(dict, ""))
+
+	r := httptest.NewRequest(http.MethodGet, "/open311/v2/requests/value_report", nil)
+	w := httptest.NewRecorder()
+	handler.GetValueReport(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r = r.WithContext(httputil.WithPrincipal(r.Context(), httputil.Principal{KeyID: "k"}))
+	w = httptest.NewRecorder()
+	handler.GetValueReport(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	var report ValueReport
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+	assert.Equal(t, "boston", report.Dictionary)
+	assert.Equal(t, 150, report.Scanned, "the scan pages past the first 100")
+	require.Len(t, report.Nonconforming, 2)
+	assert.Equal(t, "properties.on_time", report.Nonconforming[0].Key)
+	assert.Equal(t, "ONTME", report.Nonconforming[0].Value)
+	assert.Equal(t, 15, report.Nonconforming[0].Count)
+	assert.Len(t, report.Nonconforming[0].Examples, maxReportExamples)
+	assert.Equal(t, ValueReportEntry{Key: "properties.on_time", ValueSet: "on_time", Value: "late", Count: 1, Examples: []string{"sr-007"}}, report.Nonconforming[1])
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+// Limits of the delivery history listing.
+const (
+	defaultDeliveriesPerPage = 50
+	maxDeliveriesPerPage     = 100
+	// minSecretLength is the shortest signing secret a client may choose.
+	minSecretLength = 16
+)
+
+// WebhookDispatcher is what the subscription endpoints need of the webhook
+// dispatcher (implemented by webhooks.Dispatcher).
+type WebhookDispatcher interface {
+	// CheckTarget validates the URL of a new subscription.
+	CheckTarget(ctx context.Context, rawURL string) error
+	// Redeliver puts a delivery back in the queue.
+	Redeliver(ctx context.Context, id string) (models.WebhookDelivery, error)
+	// SubscriptionsChanged drops the dispatcher's cached subscriptions.
+	SubscriptionsChanged()
+}
+
+// SubscriptionHandler handles the webhook subscription endpoints. Every one
+// requires an API key, even with API_KEYS unset: reads return subscriber URLs
+// and delivery history.
+type SubscriptionHandler struct {
+	BaseHandler
+	repo       repository.SubscriptionRepository
+	dispatcher WebhookDispatcher
+	newSecret  func() (string, error)
+}
+
+// NewSubscriptionHandler creates a SubscriptionHandler. newSecret generates the
+// signing secret of subscriptions created without one.
+func NewSubscriptionHandler(log logger.Logger, repo repository.SubscriptionRepository, dispatcher WebhookDispatcher, newSecret func() (string, error)) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		BaseHandler: BaseHandler{log: log},
+		repo:        repo,
+		dispatcher:  dispatcher,
+		newSecret:   newSecret,
+	}
+}
+
+// sendLookupError maps a repository error of a subscription or delivery lookup.
+func (h *SubscriptionHandler) sendLookupError(w http.ResponseWriter, r *http.Request, err error, what string) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		h.SendError(w, r, http.StatusNotFound, what+" not found")
+	case errors.Is(err, repository.ErrInvalidID):
+		h.SendError(w, r, http.StatusBadRequest, "Invalid "+what+" ID format")
+	default:
+		h.log.Errorf("Failed to get %s: %v", what, err)
+		h.SendError(w, r, http.StatusInternalServerError, "Failed to get "+what)
+	}
+}
+
+// CreateSubscription handles POST /open311/v2/subscriptions. url must be an
+// absolute http(s) URL on a public address; service_request_id, service_code,
+// organizationId and bbox (minLong,minLat,maxLong,maxLat) optionally narrow
+// the events sent. The response is the only one that includes the secret,
+// generated when the client sends none.
+func (h *SubscriptionHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAPIKey(w, r, "subscriptions") {
+		return
+	}
+	var sub models.Subscription
+	if err := h.DecodeRequest(r, &sub); err != nil {
+		h.SendError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if err := h.dispatcher.CheckTarget(r.Context(), sub.URL); err != nil {
+		h.SendError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if sub.BBox != "" {
+		if _, err := repository.ParseGeoBBox(sub.BBox); err != nil {
+			h.SendError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	var err error
+	switch {
+	case sub.Secret == "":
+		if sub.Secret, err = h.newSecret(); err != nil {
+			h.log.Errorf("Failed to generate subscription secret: %v", err)
+			h.SendError(w, r, http.StatusInternalServerError, "Failed to create subscription")
+			return
+		}
+	case len(sub.Secret) < minSecretLength:
+		h.SendError(w, r, http.StatusBadRequest, "secret must be at least "+strconv.Itoa(minSecretLength)+" characters")
+		return
+	}
+
+	created, err := h.repo.Create(r.Context(), sub)
+	if err != nil {
+		h.log.Errorf("Failed to create subscription: %v", err)
+		h.SendError(w, r, http.StatusInternalServerError, "Failed to create subscription")
+		return
+	}
+	h.dispatcher.SubscriptionsChanged()
+	h.SendResponse(w, r, http.StatusCreated, created)
+}
+
+// GetSubscriptions handles GET /open311/v2/subscriptions (API key required).
+func (h *SubscriptionHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAPIKey(w, r, "subscriptions") {
+		return
+	}
+	subs, err := h.repo.FindAll(r.Context())
+	if err != nil {
+		h.log.Errorf("Failed to get subscriptions: %v", err)
+		h.SendError(w, r, http.StatusInternalServerError, "Failed to get subscriptions")
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+
+	if httputil.WantsXML(r) {
+		h.SendResponse(w, r, http.StatusOK, models.Subscriptions{Items: subs})
+	} else {
+		h.SendResponse(w, r, http.StatusOK, subs)
+	}
+}
+
+// GetSubscription handles GET /open311/v2/subscriptions/{id} (API key
+// required).
+func (h *SubscriptionHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAPIKey(w, r, "subscriptions") {
+		return
+	}
+	sub, err := h.repo.FindByID(r.Context(), httputil.GetPathParam(r, "id"))
+	if err != nil {
+		h.sendLookupError(w, r, err, "Subscription")
+		return
+	}
+	sub.Secret = ""
+	h.SendResponse(w, r, http.StatusOK, sub)
+}
+
+// DeleteSubscription handles DELETE /open311/v2/subscriptions/{id}; its
+// delivery history and queued deliveries are deleted with it.
+func (h *SubscriptionHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAPIKey(w, r, "subscriptions") {
+		return
+	}
+	if err := h.repo.Delete(r.Context(), httputil.GetPathParam(r, "id")); err != nil {
+		h.sendLookupError(w, r, err, "Subscription")
+		return
+	}
+	h.dispatcher.SubscriptionsChanged()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDeliveries handles GET /open311/v2/subscriptions/{id}/deliveries (API
+// key required): the newest deliveries first, status=pending|delivered|dead
+// filters (status=dead is the dead-letter list), per_page limits (default
+// 50, max 100).
+func (h *SubscriptionHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAPIKey(w, r, "subscriptions") {
+		return
+	}
+	q := r.URL.Query()
+	status := q.Get("status")
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		h.SendError(w, r, http.StatusBadRequest, "invalid status (expected pending, delivered or dead)")
+		return
+	}
+	limit := defaultDeliveriesPerPage
+	if raw := q.Get("per_page"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			h.SendError(w, r, http.StatusBadRequest, "invalid per_page")
+			return
+		}
+		limit = min(n, maxDeliveriesPerPage)
+	}
+
+	id := httputil.GetPathParam(r, "id")
+	if _, err := h.repo.FindByID(r.Context(), id); err != nil {
+		h.sendLookupError(w, r, err, "Subscription")
+		return
+	}
+	deliveries, err := h.repo.FindDeliveries(r.Context(), id, status, limit)
+	if err != nil {
+		h.log.Errorf("Failed to get deliveries: %v", err)
+		h.SendError(w, r, http.StatusInternalServerError, "Failed to get deliveries")
+		return
+	}
+
+	if httputil.WantsXML(r) {
+		h.SendResponse(w, r, http.StatusOK, models.WebhookDeliveries{Items: deliveries})
+	} else {
+		h.SendResponse(w, r, http.StatusOK, deliveries)
+	}
+}
+
+// RetryDelivery handles POST
+// /open311/v2/subscriptions/{id}/deliveries/{delivery_id}/retry: the delivery
+// (typically a dead letter) is queued again with a fresh set of attempts.
+func (h *SubscriptionHandler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAPIKey(w, r, "subscriptions") {
+		return
+	}
+	id := httputil.GetPathParam(r, "delivery_id")
+	delivery, err := h.repo.FindDeliveryByID(r.Context(), id)
+	if err == nil && delivery.SubscriptionID != httputil.GetPathParam(r, "id") {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		h.sendLookupError(w, r, err, "Delivery")
+		return
+	}
+	if delivery.Status == models.DeliveryDelivered {
+		h.SendError(w, r, http.StatusConflict, "Delivery already delivered")
+		return
+	}
+
+	queued, err := h.dispatcher.Redeliver(r.Context(), id)
+	if err != nil {
+		h.sendLookupError(w, r, err, "Delivery")
+		return
+	}
+	h.SendResponse(w, r, http.StatusAccepted, queued)
+}
@@ -0,0 +1,283 @@
+// Package harvest federates other cities' public Open311 GeoReport v2
+// endpoints into this API: each configured source's requests.json is pulled
+// periodically, in date windows and pages, mapped into models.ServiceRequest
+// with a jurisdiction prefix on service_request_id, and upserted through
+// BulkUpsert. Every window is written only if newer, so harvesting a window
+// again is harmless; the end of the last completed window is the source's
+// watermark, where the next harvest starts.
+package harvest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+// Tuning of a harvest.
+const (
+	// settleDelay keeps windows this far behind now, so requests the remote
+	// server stamps just before now are not missed when they become visible
+	// late (replication, clock skew).
+	settleDelay = 5 * time.Minute
+	// maxPages bounds the pages of one window.
+	maxPages = 10000
+	// maxSamples caps the skipped records described in Stats.Samples.
+	maxSamples = 5
+	// checkpointPrefix prefixes the checkpoint names of sources.
+	checkpointPrefix = "harvest:"
+)
+
+// Stats summarizes a harvest.
+type Stats struct {
+	// Records is the number of remote records read.
+	Records   int
+	Created   int
+	Updated   int
+	Unchanged int
+	Skipped   int
+	Failed    int
+	// Samples describes the first skipped or failed records.
+	Samples []string
+}
+
+func (s *Stats) sample(format string, args ...interface{}) {
+	if len(s.Samples) < maxSamples {
+		s.Samples = append(s.Samples, fmt.Sprintf(format, args...))
+	}
+}
+
+func (s *Stats) add(o Stats) {
+	s.Records += o.Records
+	s.Created += o.Created
+	s.Updated += o.Updated
+	s.Unchanged += o.Unchanged
+	s.Skipped += o.Skipped
+	s.Failed += o.Failed
+	for _, m := range o.Samples {
+		s.sample("%s", m)
+	}
+}
+
+// Harvester pulls the configured sources into a repository.
+type Harvester struct {
+	sources []Source
+	repo    repository.ServiceRequestRepository
+	// checkpoints persists watermarks; nil keeps them in memory, so after a
+	// restart each source starts again from its start.
+	checkpoints repository.CheckpointStore
+	log         logger.Logger
+	client      *http.Client
+	now         func() time.Time
+	wait        func(ctx context.Context, d time.Duration) error
+
+	mu         sync.Mutex
+	watermarks map[string]time.Time
+}
+
+// Option configures a Harvester.
+type Option func(*Harvester)
+
+// WithHTTPClient sets the client remote requests are made with.
+func WithHTTPClient(c *http.Client) Option {
+	return func(h *Harvester) { h.client = c }
+}
+
+// New creates a Harvester writing to repo (the same decorated repository the
+// API writes through). checkpoints may be nil.
+func New(sources []Source, repo repository.ServiceRequestRepository, checkpoints repository.CheckpointStore, log logger.Logger, opts ...Option) *Harvester {
+	h := &Harvester{
+		sources:     sources,
+		repo:        repo,
+		checkpoints: checkpoints,
+		log:         log,
+		client:      http.DefaultClient,
+		now:         time.Now,
+		wait:        httputil.Sleep,
+		watermarks:  make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Sources returns the configured sources.
+func (h *Harvester) Sources() []Source {
+	return h.sources
+}
+
+// Run harvests every source at its interval until ctx is done.
+func (h *Harvester) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := range h.sources {
+		wg.Add(1)
+		go func(s *Source) {
+			defer wg.Done()
+			for {
+				stats, err := h.Harvest(ctx, s)
+				switch {
+				case ctx.Err() != nil:
+					return
+				case err != nil:
+					h.log.Errorf("Harvest %s: %v", s.Name, err)
+				case stats.Records > 0:
+					h.log.Infof("Harvest %s: %d records: created=%d updated=%d unchanged=%d skipped=%d failed=%d",
+						s.Name, stats.Records, stats.Created, stats.Updated, stats.Unchanged, stats.Skipped, stats.Failed)
+				}
+				for _, m := range stats.Samples {
+					h.log.Warnf("Harvest %s: %s", s.Name, m)
+				}
+				if httputil.Sleep(ctx, s.Interval) != nil {
+					return
+				}
+			}
+		}(&h.sources[i])
+	}
+	wg.Wait()
+}
+
+// Harvest pulls s from its watermark up to now, a window at a time, saving
+// the watermark after each. On an error the stats cover the windows written
+// so far, and the next harvest repeats the failed window.
+func (h *Harvester) Harvest(ctx context.Context, s *Source) (Stats, error) {
+	var total Stats
+	from, err := h.watermark(ctx, s)
+	if err != nil {
+		return total, err
+	}
+	end := h.now().Add(-settleDelay)
+	for from.Before(end) {
+		to := from.Add(s.Window)
+		if to.After(end) {
+			to = end
+		}
+		stats, err := h.harvestWindow(ctx, s, from, to)
+		total.add(stats)
+		if err != nil {
+			return total, fmt.Errorf("window %s to %s: %w", from.Format(time.RFC3339), to.Format(time.RFC3339), err)
+		}
+		if err := h.saveWatermark(ctx, s, to); err != nil {
+			return total, err
+		}
+		from = to
+	}
+	return total, nil
+}
+
+// watermark returns where the next harvest of s starts.
+func (h *Harvester) watermark(ctx context.Context, s *Source) (time.Time, error) {
+	h.mu.Lock()
+	w, ok := h.watermarks[s.Name]
+	h.mu.Unlock()
+	if ok {
+		return w, nil
+	}
+	if h.checkpoints != nil {
+		saved, err := h.checkpoints.LoadCheckpoint(ctx, checkpointPrefix+s.Name)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("load watermark: %w", err)
+		}
+		if saved != "" {
+			if w, err = time.Parse(time.RFC3339Nano, saved); err != nil {
+				return time.Time{}, fmt.Errorf("saved watermark %q: %w", saved, err)
+			}
+			return w, nil
+		}
+	}
+	if !s.Start.IsZero() {
+		return s.Start.UTC(), nil
+	}
+	return h.now().Add(-defaultLookback).UTC().Truncate(time.Hour), nil
+}
+
+func (h *Harvester) saveWatermark(ctx context.Context, s *Source, w time.Time) error {
+	h.mu.Lock()
+	h.watermarks[s.Name] = w
+	h.mu.Unlock()
+	if h.checkpoints == nil {
+		return nil
+	}
+	if err := h.checkpoints.SaveCheckpoint(ctx, checkpointPrefix+s.Name, w.UTC().Format(time.RFC3339Nano)); err != nil {
+		return fmt.Errorf("save watermark: %w", err)
+	}
+	return nil
+}
+
+// harvestWindow pulls the pages of one window, writing each page. Servers
+// that ignore paging return the first page again; the window is then split in
+// half until its pages are complete or it is minWindow long.
+func (h *Harvester) harvestWindow(ctx context.Context, s *Source, from, to time.Time) (Stats, error) {
+	var stats Stats
+	var first string // remote id of the first record of page 1
+	for page := 1; page <= maxPages; page++ {
+		recs, err := h.fetch(ctx, s, from, to, page)
+		if err != nil {
+			return stats, fmt.Errorf("page %d: %w", page, err)
+		}
+		batch := make([]models.ServiceRequest, 0, len(recs))
+		for i, data := range recs {
+			req, err := s.toServiceRequest(data)
+			if i == 0 {
+				if page == 1 {
+					first = req.ServiceRequestID
+				} else if req.ServiceRequestID != "" && req.ServiceRequestID == first {
+					return h.splitWindow(ctx, s, from, to, stats)
+				}
+			}
+			stats.Records++
+			if err != nil {
+				stats.Skipped++
+				stats.sample("%s", err)
+				continue
+			}
+			batch = append(batch, req)
+		}
+		if len(batch) > 0 {
+			res, err := h.repo.BulkUpsert(ctx, batch, repository.BulkUpsertOptions{OnlyIfNewer: true})
+			if err != nil {
+				return stats, err
+			}
+			stats.Created += res.Created
+			stats.Updated += res.Updated
+			stats.Unchanged += res.Skipped
+			stats.Failed += res.Failed
+			for _, e := range res.Errors {
+				stats.sample("%s: %s", e.ServiceRequestID, e.Message)
+			}
+		}
+		if len(recs) < s.PageSize {
+			return stats, nil
+		}
+	}
+	return stats, fmt.Errorf("more than %d pages; use a shorter window", maxPages)
+}
+
+// splitWindow harvests the halves of a window whose server ignores paging.
+// read are the counts of the pages already written; at minWindow they are
+// all there is to get. Otherwise the halves read those records again, so
+// only the halves' counts are kept (the records already written count as
+// unchanged there).
+func (h *Harvester) splitWindow(ctx context.Context, s *Source, from, to time.Time, read Stats) (Stats, error) {
+	if to.Sub(from) <= minWindow {
+		h.log.Warnf("Harvest %s: the server ignores paging and %s to %s has more than %d requests; some are missed",
+			s.Name, from.Format(time.RFC3339), to.Format(time.RFC3339), s.PageSize)
+		return read, nil
+	}
+	var stats Stats
+	mid := from.Add(to.Sub(from) / 2).Truncate(time.Second)
+	for _, w := range [][2]time.Time{{from, mid}, {mid, to}} {
+		half, err := h.harvestWindow(ctx, s, w[0], w[1])
+		stats.add(half)
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,260 @@
+package harvest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+func TestParseSources(t *testing.T) {
+	t.Setenv("EXAMPLECITY_OPEN311_KEY", "secret")
+	sources, err := LoadSources(filepath.Join("..", "..", "..", "harvest", "sources.example.yaml"))
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+	assert.Equal(t, "secret", sources[0].APIKey)
+	assert.Equal(t, "examplecity", sources[0].Prefix)
+	assert.Equal(t, "America/New_York", sources[0].Location.String())
+	assert.Equal(t, DatesUpdated, sources[1].Dates)
+	assert.Equal(t, "nbr", sources[1].Prefix)
+	assert.Equal(t, 6*time.Hour, sources[1].Window)
+	assert.Equal(t, defaultInterval, sources[1].Interval)
+	assert.True(t, sources[1].Start.IsZero())
+
+	for _, doc := range []string{
+		`sources: []`,
+		`sources: [{name: a, url: "ftp://x"}]`,
+		`sources: [{name: A, url: "https://x"}]`,
+		`sources: [{name: a, url: "https://x"}, {name: a, url: "https://y"}]`,
+		`sources: [{name: a, url: "https://x", api_key_env: HARVEST_TEST_UNSET}]`,
+		`sources: [{name: a, url: "https://x", dates: closed}]`,
+		`sources: [{name: a, url: "https://x", window: 10s}]`,
+		`sources: [{name: a, url: "https://x", prefix: "a:b"}]`,
+	} {
+		_, err := ParseSources([]byte(doc))
+		assert.Error(t, err, doc)
+	}
+}
+
+// remoteRecord is a record served by the stand-in GeoReport server.
+type remoteRecord struct {
+	requested time.Time
+	body      map[string]any
+}
+
+// georeport is a stand-in GeoReport v2 server: it filters its records by
+// start_date/end_date and pages them with page/page_size, unless
+// ignorePaging is set. Failures are served first, one per request.
+type georeport struct {
+	mu           sync.Mutex
+	records      []remoteRecord
+	ignorePaging bool
+	failures     []func(w http.ResponseWriter)
+	queries      []url.Values
+}
+
+func (g *georeport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	q := r.URL.Query()
+	g.queries = append(g.queries, q)
+	if r.URL.Path != "/open311/v2/requests.json" {
+		http.NotFound(w, r)
+		return
+	}
+	if len(g.failures) > 0 {
+		fail := g.failures[0]
+		g.failures = g.failures[1:]
+		fail(w)
+		return
+	}
+	from, _ := time.Parse(time.RFC3339, q.Get("start_date"))
+	to, _ := time.Parse(time.RFC3339, q.Get("end_date"))
+	page, _ := strconv.Atoi(q.Get("page"))
+	size, _ := strconv.Atoi(q.Get("page_size"))
+	var matched []map[string]any
+	for _, rec := range g.records {
+		if !rec.requested.Before(from) && rec.requested.Before(to) {
+			matched = append(matched, rec.body)
+		}
+	}
+	if g.ignorePaging {
+		page = 1
+	}
+	start := min((page-1)*size, len(matched))
+	end := min(start+size, len(matched))
+	_ = json.NewEncoder(w).Encode(append([]map[string]any{}, matched[start:end]...))
+}
+
+// checkpoints is an in-memory repository.CheckpointStore.
+type checkpoints map[string]string
+
+func (c checkpoints) LoadCheckpoint(_ context.Context, consumer string) (string, error) {
+	return c[consumer], nil
+}
+
+func (c checkpoints) SaveCheckpoint(_ context.Context, consumer, token string) error {
+	c[consumer] = token
+	return nil
+}
+
+func newTestHarvester(t *testing.T, g *georeport, store repository.CheckpointStore) (*Harvester, *Source, *repository.MemoryServiceRequestRepository, *time.Time, *[]time.Duration) {
+	t.Helper()
+	srv := httptest.NewServer(g)
+	t.Cleanup(srv.Close)
+	sources, err := ParseSources([]byte(`
+sources:
+  - name: test
+    url: ` + srv.URL + `/open311/v2
+    window: 24h
+    start: 2025-03-01T00:00:00Z
+    page_size: 2
+    timezone: America/New_York
+`))
+	require.NoError(t, err)
+	log, err := logger.New(logger.Config{Level: "fatal", Format: "text"})
+	require.NoError(t, err)
+	repo := repository.NewMemoryServiceRequestRepository()
+	h := New(sources, repo, store, log)
+	now := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+	var waits []time.Duration
+	h.wait = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	return h, &h.sources[0], repo, &now, &waits
+}
+
+func TestHarvest(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	g := &georeport{records: []remoteRecord{
+		{day.Add(13 * time.Hour), map[string]any{"service_request_id": 101, "service_code": "pothole", "status": "Open",
+			"requested_datetime": "2025-03-01T08:00:00-05:00", "lat": "42.35", "long": -71.06}},
+		{day.Add(15 * time.Hour), map[string]any{"service_request_id": "102", "service_code": "graffiti", "status": "closed",
+			"requested_datetime": "2025-03-01 10:00:00", "updated_datetime": "2025-03-01T12:00:00-05:00", "address": "1 City Hall Sq"}},
+		{day.Add(16 * time.Hour), map[string]any{"service_request_id": "103", "service_code": "pothole",
+			"requested_datetime": "2025-03-01T16:00:00Z"}},
+		{day.Add(30 * time.Hour), map[string]any{"service_request_id": "104", "service_code": "pothole",
+			"requested_datetime": "2025-03-02T06:00:00Z", "lat": 42.3, "long": -71.1}},
+	}}
+	store := checkpoints{}
+	h, s, repo, now, _ := newTestHarvester(t, g, store)
+
+	stats, err := h.Harvest(ctx, s)
+	require.NoError(t, err)
+	assert.Equal(t, 4, stats.Records)
+	assert.Equal(t, 3, stats.Created)
+	assert.Equal(t, 1, stats.Skipped)
+	require.Len(t, stats.Samples, 1)
+	assert.Contains(t, stats.Samples[0], "103: no location")
+
+	got, err := repo.FindByServiceRequestID(ctx, "test:101")
+	require.NoError(t, err)
+	assert.Equal(t, "open", got.Status)
+	assert.Equal(t, 42.35, got.Latitude)
+	assert.Equal(t, time.Date(2025, 3, 1, 13, 0, 0, 0, time.UTC), got.RequestedDatetime.UTC())
+	assert.Equal(t, got.RequestedDatetime, got.UpdatedDatetime, "updated defaults to requested")
+	got, err = repo.FindByServiceRequestID(ctx, "test:102")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 3, 1, 15, 0, 0, 0, time.UTC), got.RequestedDatetime.UTC(), "no offset: the source's time zone")
+	assert.Equal(t, time.Date(2025, 3, 1, 17, 0, 0, 0, time.UTC), got.UpdatedDatetime.UTC())
+	_, err = repo.FindByServiceRequestID(ctx, "test:104")
+	assert.NoError(t, err)
+
+	// Two windows, the last ending short of now; the first had two pages.
+	assert.Equal(t, "2025-03-02T23:55:00Z", store["harvest:test"])
+	assert.Equal(t, []string{"1", "2", "1"}, []string{g.queries[0].Get("page"), g.queries[1].Get("page"), g.queries[2].Get("page")})
+	assert.Equal(t, "2025-03-02T00:00:00Z", g.queries[2].Get("start_date"))
+
+	// The next harvest starts at the watermark; a restarted harvester reads it
+	// from the checkpoint.
+	*now = now.Add(time.Hour)
+	g.queries = nil
+	h2, s2, _, _, _ := newTestHarvester(t, g, store)
+	h2.repo = repo
+	h2.now = h.now
+	_, err = h2.Harvest(ctx, s2)
+	require.NoError(t, err)
+	require.Len(t, g.queries, 1)
+	assert.Equal(t, "2025-03-02T23:55:00Z", g.queries[0].Get("start_date"))
+	assert.Equal(t, "2025-03-03T00:55:00Z", g.queries[0].Get("end_date"))
+
+	// Harvesting again from the start changes nothing.
+	delete(store, "harvest:test")
+	h3, s3, _, _, _ := newTestHarvester(t, g, store)
+	h3.repo = repo
+	stats, err = h3.Harvest(ctx, s3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Unchanged)
+	assert.Zero(t, stats.Created+stats.Updated)
+}
+
+func TestHarvestRetries(t *testing.T) {
+	ctx := context.Background()
+	g := &georeport{failures: []func(w http.ResponseWriter){
+		func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		},
+		func(w http.ResponseWriter) { w.WriteHeader(http.StatusServiceUnavailable) },
+	}}
+	h, s, _, _, waits := newTestHarvester(t, g, nil)
+	_, err := h.Harvest(ctx, s)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{7 * time.Second, 2 * retryBase}, *waits, "Retry-After, then backoff")
+	assert.Equal(t, 4, len(g.queries), "two failures, then one request per window")
+
+	// Client errors are not retried; the failed window is repeated next time.
+	g.failures = []func(w http.ResponseWriter){func(w http.ResponseWriter) {
+		http.Error(w, "unknown jurisdiction", http.StatusBadRequest)
+	}}
+	h, s, _, _, waits = newTestHarvester(t, g, nil)
+	_, err = h.Harvest(ctx, s)
+	assert.ErrorContains(t, err, "remote returned 400: unknown jurisdiction")
+	assert.Empty(t, *waits)
+	w, err := h.watermark(ctx, s)
+	require.NoError(t, err)
+	assert.Equal(t, s.Start, w)
+
+	// A Retry-After beyond the cap ends the harvest until the next interval.
+	g.failures = []func(w http.ResponseWriter){func(w http.ResponseWriter) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}}
+	_, err = h.Harvest(ctx, s)
+	assert.ErrorContains(t, err, "retry after 1h0m0s")
+}
+
+func TestHarvestSplitsWindowsWithoutPaging(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	g := &georeport{ignorePaging: true}
+	for _, hour := range []int{1, 7, 13, 19, 20} {
+		at := day.Add(time.Duration(hour) * time.Hour)
+		g.records = append(g.records, remoteRecord{at, map[string]any{
+			"service_request_id": strconv.Itoa(hour), "service_code": "pothole",
+			"requested_datetime": at.Format(time.RFC3339), "address": "x"}})
+	}
+	h, s, repo, _, _ := newTestHarvester(t, g, nil)
+	stats, err := h.Harvest(ctx, s)
+	require.NoError(t, err)
+	n, err := repo.Count(ctx, repository.ServiceRequestQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	// The first page, read before the split, is not counted twice.
+	assert.Equal(t, 5, stats.Records)
+	assert.Equal(t, 5, stats.Created+stats.Unchanged)
+}
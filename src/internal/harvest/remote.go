@@ -0,0 +1,297 @@
+package harvest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
+)
+
+// Tuning of remote requests.
+const (
+	requestTimeout = 60 * time.Second
+	// maxAttempts is how often a page is requested before the harvest of
+	// the source gives up until its next interval.
+	maxAttempts = 5
+	// retryBase is the first retry delay without a Retry-After; it doubles
+	// with every further attempt.
+	retryBase = 2 * time.Second
+	// maxRetryWait caps the wait for one retry: a server asking for more is
+	// tried again at the next interval.
+	maxRetryWait = 15 * time.Minute
+	// maxPageBytes bounds one response.
+	maxPageBytes = 64 << 20
+)
+
+const userAgent = "open311-to-Go harvester"
+
+// requestsURL returns the URL of one page of a window.
+func (s *Source) requestsURL(from, to time.Time, page int) string {
+	q := url.Values{}
+	if s.JurisdictionID != "" {
+		q.Set("jurisdiction_id", s.JurisdictionID)
+	}
+	if s.APIKey != "" {
+		q.Set("api_key", s.APIKey)
+	}
+	after, before := "start_date", "end_date"
+	if s.Dates == DatesUpdated {
+		after, before = "updated_after", "updated_before"
+	}
+	q.Set(after, from.UTC().Format(time.RFC3339))
+	q.Set(before, to.UTC().Format(time.RFC3339))
+	q.Set("page", strconv.Itoa(page))
+	q.Set(s.PageSizeParam, strconv.Itoa(s.PageSize))
+	endpoint := s.URL
+	if !strings.HasSuffix(endpoint, ".json") {
+		endpoint += "/requests.json"
+	}
+	return endpoint + "?" + q.Encode()
+}
+
+// retryable reports whether a response status is worth retrying.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// fetch requests one page, retrying network errors, 429 and 5xx responses.
+// A Retry-After is honoured; otherwise the delay backs off exponentially.
+func (h *Harvester) fetch(ctx context.Context, s *Source, from, to time.Time, page int) ([]json.RawMessage, error) {
+	u := s.requestsURL(from, to, page)
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		delay := retryBase << (attempt - 1)
+		recs, err := h.get(ctx, u)
+		if err == nil {
+			return recs, nil
+		}
+		var statusErr *statusError
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case errors.Is(err, errInvalidResponse):
+			return nil, err
+		case errors.As(err, &statusErr):
+			if !retryable(statusErr.status) {
+				return nil, err
+			}
+			if d, ok := httputil.ParseRetryAfter(statusErr.retryAfter, h.now()); ok {
+				if d > maxRetryWait {
+					return nil, fmt.Errorf("%w; the server asks to retry after %s", err, d)
+				}
+				delay = d
+			}
+		}
+		lastErr = err
+		if attempt == maxAttempts {
+			return nil, fmt.Errorf("%w (gave up after %d attempts)", lastErr, attempt)
+		}
+		h.log.Warnf("Harvest %s: %v; retrying in %s", s.Name, err, delay)
+		if err := h.wait(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// errInvalidResponse is a 200 response that is not a JSON array of
+// requests; retrying would not help.
+var errInvalidResponse = errors.New("invalid response")
+
+// statusError is a non-200 response.
+type statusError struct {
+	status     int
+	retryAfter string
+	body       string
+}
+
+func (e *statusError) Error() string {
+	if e.body == "" {
+		return fmt.Sprintf("remote returned %d", e.status)
+	}
+	return fmt.Sprintf("remote returned %d: %s", e.status, e.body)
+}
+
+// get performs one request and decodes the page, a JSON array, into raw
+// records; toServiceRequest maps them one by one, so a malformed record only
+// skips itself. The URL is left out of errors: it may carry the source's
+// api_key.
+func (h *Harvester) get(ctx context.Context, u string) ([]json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := h.client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return nil, &statusError{
+			status:     resp.StatusCode,
+			retryAfter: resp.Header.Get("Retry-After"),
+			body:       strings.TrimSpace(string(bytes.ToValidUTF8(snippet, nil))),
+		}
+	}
+	var recs []json.RawMessage
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxPageBytes)).Decode(&recs); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidResponse, err)
+	}
+	return recs, nil
+}
+
+// remoteRequest is a service request as GeoReport v2 servers return it. Ids
+// and coordinates are accepted as strings or numbers, and timestamps in the
+// forms servers actually use.
+type remoteRequest struct {
+	ServiceRequestID  flexString `json:"service_request_id"`
+	Status            string     `json:"status"`
+	StatusNotes       string     `json:"status_notes"`
+	ServiceName       string     `json:"service_name"`
+	ServiceCode       flexString `json:"service_code"`
+	Description       string     `json:"description"`
+	AgencyResponsible string     `json:"agency_responsible"`
+	ServiceNotice     string     `json:"service_notice"`
+	RequestedDatetime string     `json:"requested_datetime"`
+	UpdatedDatetime   string     `json:"updated_datetime"`
+	ExpectedDatetime  string     `json:"expected_datetime"`
+	Address           string     `json:"address"`
+	AddressID         flexString `json:"address_id"`
+	Zipcode           flexString `json:"zipcode"`
+	Lat               flexFloat  `json:"lat"`
+	Long              flexFloat  `json:"long"`
+	MediaURL          string     `json:"media_url"`
+}
+
+// flexString decodes a JSON string or number; null is "".
+type flexString string
+
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*f = flexString(s)
+		return nil
+	}
+	if string(data) == "null" {
+		*f = ""
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*f = flexString(n)
+	return nil
+}
+
+// flexFloat decodes a JSON number or numeric string; null and "" are 0.
+type flexFloat float64
+
+func (f *flexFloat) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*f = 0
+		return nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid coordinate %s", data)
+	}
+	*f = flexFloat(v)
+	return nil
+}
+
+// timeLayouts are the timestamp forms accepted, with an offset first.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// parseTime parses a remote timestamp; one without an offset is in loc.
+func parseTime(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
+
+// toServiceRequest maps a remote record into this API's model. Like a bulk
+// upsert, records without an id, service or location are rejected.
+func (s *Source) toServiceRequest(data json.RawMessage) (models.ServiceRequest, error) {
+	var rec remoteRequest
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return models.ServiceRequest{}, fmt.Errorf("invalid record: %v", err)
+	}
+	id := strings.TrimSpace(string(rec.ServiceRequestID))
+	if id == "" {
+		return models.ServiceRequest{}, fmt.Errorf("no service_request_id")
+	}
+	req := models.ServiceRequest{
+		ServiceRequestID:  s.Prefix + ":" + id,
+		Status:            strings.ToLower(strings.TrimSpace(rec.Status)),
+		StatusNotes:       rec.StatusNotes,
+		ServiceName:       rec.ServiceName,
+		ServiceCode:       strings.TrimSpace(string(rec.ServiceCode)),
+		Description:       rec.Description,
+		AgencyResponsible: rec.AgencyResponsible,
+		ServiceNotice:     rec.ServiceNotice,
+		Address:           rec.Address,
+		AddressID:         string(rec.AddressID),
+		Zipcode:           string(rec.Zipcode),
+		Latitude:          float64(rec.Lat),
+		Longitude:         float64(rec.Long),
+		MediaURL:          rec.MediaURL,
+	}
+	var err error
+	if req.RequestedDatetime, err = parseTime(rec.RequestedDatetime, s.Location); err != nil {
+		return req, fmt.Errorf("%s: requested_datetime: %v", id, err)
+	}
+	if req.UpdatedDatetime, err = parseTime(rec.UpdatedDatetime, s.Location); err != nil {
+		return req, fmt.Errorf("%s: updated_datetime: %v", id, err)
+	}
+	if req.ExpectedDatetime, err = parseTime(rec.ExpectedDatetime, s.Location); err != nil {
+		return req, fmt.Errorf("%s: expected_datetime: %v", id, err)
+	}
+	if req.UpdatedDatetime.IsZero() {
+		// Without it every harvest would look newer than the stored copy.
+		req.UpdatedDatetime = req.RequestedDatetime
+	}
+	switch {
+	case req.ServiceCode == "":
+		return req, fmt.Errorf("%s: no service_code", id)
+	case req.Latitude == 0 && req.Longitude == 0 && req.Address == "" && req.AddressID == "":
+		return req, fmt.Errorf("%s: no location", id)
+	case req.UpdatedDatetime.IsZero():
+		return req, fmt.Errorf("%s: no requested_datetime or updated_datetime", id)
+	}
+	return req, nil
+}
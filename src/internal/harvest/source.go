@@ -0,0 +1,191 @@
+package harvest
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Date filters of a source: which timestamp its windows select on.
+const (
+	// DatesRequested windows on requested_datetime (start_date/end_date, as
+	// in GeoReport v2). Later updates of older requests are not seen.
+	DatesRequested = "requested"
+	// DatesUpdated windows on updated_datetime (updated_after/updated_before),
+	// for servers that support it (e.g. this API).
+	DatesUpdated = "updated"
+)
+
+// Source defaults.
+const (
+	defaultInterval      = 15 * time.Minute
+	defaultWindow        = 24 * time.Hour
+	defaultLookback      = 30 * 24 * time.Hour
+	defaultPageSize      = 100
+	defaultPageSizeParam = "page_size"
+	// minWindow bounds how far a window is split when the server ignores
+	// paging.
+	minWindow = time.Minute
+)
+
+// sourceName is the syntax of a source name, used in checkpoint names.
+var sourceName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Source is a remote GeoReport v2 endpoint to harvest.
+type Source struct {
+	// Name identifies the source in logs and its saved watermark.
+	Name string
+	// URL is the endpoint root; requests.json is appended.
+	URL string
+	// JurisdictionID, when set, is sent as jurisdiction_id.
+	JurisdictionID string
+	// APIKey, when set, is sent as api_key.
+	APIKey string
+	// Prefix is prepended to remote ids: service_request_id becomes
+	// "<prefix>:<remote id>". Defaults to Name.
+	Prefix string
+	// Interval is the pause between harvests.
+	Interval time.Duration
+	// Window is the time span requested at once.
+	Window time.Duration
+	// Start is where the first harvest begins; zero means 30 days back.
+	Start time.Time
+	// Dates is DatesRequested or DatesUpdated.
+	Dates string
+	// PageSize is the page size requested; a shorter page is the last one.
+	PageSize int
+	// PageSizeParam names the page size parameter (page_size, per_page...).
+	PageSizeParam string
+	// Location is the time zone of remote timestamps without an offset.
+	Location *time.Location
+}
+
+// sourcesDocument is the YAML form of a sources file.
+type sourcesDocument struct {
+	Sources []struct {
+		Name           string `yaml:"name"`
+		URL            string `yaml:"url"`
+		JurisdictionID string `yaml:"jurisdiction_id"`
+		APIKeyEnv      string `yaml:"api_key_env"`
+		Prefix         string `yaml:"prefix"`
+		Interval       string `yaml:"interval"`
+		Window         string `yaml:"window"`
+		Start          string `yaml:"start"`
+		Dates          string `yaml:"dates"`
+		PageSize       int    `yaml:"page_size"`
+		PageSizeParam  string `yaml:"page_size_param"`
+		Timezone       string `yaml:"timezone"`
+	} `yaml:"sources"`
+}
+
+// ParseSources parses a sources file and applies the defaults. API keys are
+// read from the environment variables the file names, so it holds no secrets.
+func ParseSources(data []byte) ([]Source, error) {
+	var doc sourcesDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Sources) == 0 {
+		return nil, fmt.Errorf("no sources")
+	}
+	seen := make(map[string]bool)
+	sources := make([]Source, 0, len(doc.Sources))
+	for i, d := range doc.Sources {
+		s := Source{
+			Name:           d.Name,
+			URL:            strings.TrimSuffix(d.URL, "/"),
+			JurisdictionID: d.JurisdictionID,
+			Prefix:         d.Prefix,
+			Interval:       defaultInterval,
+			Window:         defaultWindow,
+			Dates:          d.Dates,
+			PageSize:       d.PageSize,
+			PageSizeParam:  d.PageSizeParam,
+			Location:       time.UTC,
+		}
+		fail := func(format string, args ...interface{}) ([]Source, error) {
+			name := s.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return nil, fmt.Errorf("source %s: %s", name, fmt.Sprintf(format, args...))
+		}
+		if !sourceName.MatchString(s.Name) {
+			return fail("name must be lowercase letters, digits, '-' or '_'")
+		}
+		if seen[s.Name] {
+			return fail("duplicate name")
+		}
+		seen[s.Name] = true
+		if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fail("url must be an http(s) URL")
+		}
+		if d.APIKeyEnv != "" {
+			if s.APIKey = os.Getenv(d.APIKeyEnv); s.APIKey == "" {
+				return fail("api_key_env: %s is not set", d.APIKeyEnv)
+			}
+		}
+		if s.Prefix == "" {
+			s.Prefix = s.Name
+		}
+		if strings.Contains(s.Prefix, ":") {
+			return fail("prefix must not contain ':'")
+		}
+		var err error
+		if d.Interval != "" {
+			if s.Interval, err = time.ParseDuration(d.Interval); err != nil || s.Interval < time.Minute {
+				return fail("interval must be a duration of at least 1m")
+			}
+		}
+		if d.Window != "" {
+			if s.Window, err = time.ParseDuration(d.Window); err != nil || s.Window < minWindow {
+				return fail("window must be a duration of at least 1m")
+			}
+		}
+		if d.Start != "" {
+			if s.Start, err = time.Parse(time.RFC3339, d.Start); err != nil {
+				return fail("start must be an RFC 3339 timestamp")
+			}
+		}
+		switch s.Dates {
+		case "":
+			s.Dates = DatesRequested
+		case DatesRequested, DatesUpdated:
+		default:
+			return fail("dates must be %s or %s", DatesRequested, DatesUpdated)
+		}
+		if s.PageSize == 0 {
+			s.PageSize = defaultPageSize
+		} else if s.PageSize < 0 {
+			return fail("page_size must be positive")
+		}
+		if s.PageSizeParam == "" {
+			s.PageSizeParam = defaultPageSizeParam
+		}
+		if d.Timezone != "" {
+			if s.Location, err = time.LoadLocation(d.Timezone); err != nil {
+				return fail("timezone: %v", err)
+			}
+		}
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
+
+// LoadSources reads and parses a sources file (HARVEST_SOURCES_FILE).
+func LoadSources(path string) ([]Source, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := ParseSources(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sources, nil
+}
@@ -0,0 +1,234 @@
+package importer
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Boston times are converted without relying on the host's zoneinfo
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+)
+
+// BostonBBox is the default plausibility box for Boston coordinates
+// (minLong,minLat,maxLong,maxLat). Coordinates outside it (and the 0,0 of
+// unlocated cases) are dropped; the address is kept.
+var BostonBBox = repository.GeoBBox{MinLong: -72.5, MinLat: 41, MaxLong: -70, MaxLat: 43.5}
+
+// bostonLayout names the columns of one Boston CSV export format.
+type bostonLayout struct {
+	name                                          string
+	id                                            string
+	serviceCode                                   []string // first non-empty wins
+	serviceName, status, statusNotes, description string
+	agency, opened, closed, expected              string
+	address, zipcode, lat, long, photo            string
+	properties                                    [][2]string // column, property key
+}
+
+// bostonLayouts are the data.boston.gov exports: the legacy "311 Service
+// Requests" dataset (2011–2025) and the new-system export described in
+// dictionaries/boston-311.yaml.
+var bostonLayouts = []bostonLayout{
+	{
+		name:        "legacy",
+		id:          "case_enquiry_id",
+		serviceCode: []string{"type", "reason"},
+		status:      "case_status",
+		description: "case_title",
+		agency:      "department",
+		opened:      "open_dt",
+		closed:      "closed_dt",
+		address:     "location",
+		zipcode:     "location_zipcode",
+		lat:         "latitude",
+		long:        "longitude",
+		photo:       "submitted_photo",
+		properties: [][2]string{
+			{"subject", "subject"},
+			{"reason", "reason"},
+			{"type", "type"},
+			{"queue", "queue"},
+			{"department", "department"},
+			{"on_time", "on_time"},
+			{"closure_reason", "closure_reason"},
+			{"sla_target_dt", "sla_target_dt"},
+			{"source", "source"},
+			{"fire_district", "fire_district"},
+			{"pwd_district", "pwd_district"},
+			{"city_council_district", "city_council_district"},
+			{"police_district", "police_district"},
+			{"neighborhood", "neighborhood"},
+			{"neighborhood_services_district", "neighborhood_services_district"},
+			{"ward", "ward"},
+			{"precinct", "precinct"},
+			{"location_street_name", "location_street_name"},
+			{"geom_4326", "geom_4326"}, // WKB lineage of the original geometry
+		},
+	},
+	{
+		name:        "new system",
+		id:          "Case ID",
+		serviceCode: []string{"Case Topic", "Service Name"},
+		serviceName: "Service Name",
+		status:      "Case Status",
+		statusNotes: "Closure Comments",
+		agency:      "Assigned Department",
+		opened:      "Open Date",
+		closed:      "Close Date",
+		expected:    "Target Close Date",
+		address:     "Full Street Address",
+		zipcode:     "Zip Code",
+		lat:         "Latitude (Y)",
+		long:        "Longitude (X)",
+		photo:       "Submitted Photo",
+		properties: [][2]string{
+			{"Assigned Team", "assigned_team"},
+			{"Closure Reason", "closure_reason"},
+			{"On Time?", "on_time"},
+			{"Report Source", "report_source"},
+			{"Closed Photo", "closed_photo"},
+			{"Street Number", "street_number"},
+			{"Street Name", "street_name"},
+			{"Neighborhood", "neighborhood"},
+			{"Public Works District", "pwd_district"},
+			{"City Council District", "city_council_district"},
+			{"Fire District", "fire_district"},
+			{"Police District", "police_district"},
+			{"Ward", "ward"},
+			{"Precinct", "precinct"},
+		},
+	},
+}
+
+// BostonMapper maps rows of a Boston 311 CSV export to service requests:
+// Open311 fields top-level, jurisdiction extras under properties (see
+// dictionaries/boston-311.yaml). Local Eastern times become UTC.
+type BostonMapper struct {
+	layout bostonLayout
+	loc    *time.Location
+	bounds repository.GeoBBox
+}
+
+// NewBostonMapper picks the export format from the CSV header. Coordinates
+// outside bounds are dropped.
+func NewBostonMapper(header []string, bounds repository.GeoBBox) (*BostonMapper, error) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range bostonLayouts {
+		for _, col := range header {
+			if col == l.id {
+				return &BostonMapper{layout: l, loc: loc, bounds: bounds}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("not a Boston 311 export: no %q or %q column", bostonLayouts[0].id, bostonLayouts[1].id)
+}
+
+// Layout names the detected export format.
+func (m *BostonMapper) Layout() string {
+	return m.layout.name
+}
+
+// clean trims and HTML-decodes a value (the exports double-encode entities,
+// e.g. "&amp;" in addresses).
+func clean(s string) string {
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+// Map converts one row. Rows without a case id, service or location (valid
+// coordinates or an address) are skipped.
+func (m *BostonMapper) Map(row Row) (models.ServiceRequest, error) {
+	l := m.layout
+	get := func(col string) string {
+		if col == "" {
+			return ""
+		}
+		return clean(row[col])
+	}
+
+	req := models.ServiceRequest{ServiceRequestID: get(l.id)}
+	if req.ServiceRequestID == "" {
+		return req, skipf("no %s", l.id)
+	}
+	for _, col := range l.serviceCode {
+		if req.ServiceCode = get(col); req.ServiceCode != "" {
+			break
+		}
+	}
+	if req.ServiceCode == "" {
+		return req, skipf("%s: no service", req.ServiceRequestID)
+	}
+	req.ServiceName = get(l.serviceName)
+	if req.ServiceName == "" {
+		req.ServiceName = req.ServiceCode
+	}
+
+	req.Status = bostonStatus(get(l.status))
+	req.StatusNotes = get(l.statusNotes)
+	req.Description = get(l.description)
+	req.AgencyResponsible = get(l.agency)
+	req.Address = get(l.address)
+	req.Zipcode = get(l.zipcode)
+	if photo := get(l.photo); strings.HasPrefix(photo, "http://") || strings.HasPrefix(photo, "https://") {
+		req.MediaURL = photo
+	}
+
+	lat, errLat := strconv.ParseFloat(get(l.lat), 64)
+	long, errLong := strconv.ParseFloat(get(l.long), 64)
+	if errLat == nil && errLong == nil && (lat != 0 || long != 0) && m.bounds.Contains(lat, long) {
+		req.Latitude, req.Longitude = lat, long
+	}
+	if req.Latitude == 0 && req.Longitude == 0 && req.Address == "" {
+		return req, skipf("%s: no valid coordinates or address", req.ServiceRequestID)
+	}
+
+	var err error
+	if req.RequestedDatetime, err = m.parseTime(get(l.opened)); err != nil {
+		return req, skipf("%s: %s: %v", req.ServiceRequestID, l.opened, err)
+	}
+	if req.ExpectedDatetime, err = m.parseTime(get(l.expected)); err != nil {
+		return req, skipf("%s: %s: %v", req.ServiceRequestID, l.expected, err)
+	}
+	closed, err := m.parseTime(get(l.closed))
+	if err != nil {
+		return req, skipf("%s: %s: %v", req.ServiceRequestID, l.closed, err)
+	}
+	// The exports have no modification time: a case last changed when it
+	// closed, or else when it opened. Deterministic, so an unchanged rerun
+	// with only-if-newer leaves the stored copy alone.
+	req.UpdatedDatetime = closed
+	if req.UpdatedDatetime.IsZero() {
+		req.UpdatedDatetime = req.RequestedDatetime
+	}
+
+	for _, p := range l.properties {
+		if v := get(p[0]); v != "" {
+			if req.Properties == nil {
+				req.Properties = models.Properties{}
+			}
+			req.Properties[p[1]] = v
+		}
+	}
+	return req, nil
+}
+
+// bostonStatus normalizes a case status to Open311 open|closed; anything not
+// closed ("Open", "In progress", "OVERDUE", ...) is still open.
+func bostonStatus(s string) string {
+	if strings.Contains(strings.ToLower(s), "closed") {
+		return "closed"
+	}
+	return "open"
+}
+
+// parseTime reads an export timestamp as Boston local time (see
+// dictionary.ParseTime).
+func (m *BostonMapper) parseTime(s string) (time.Time, error) {
+	return dictionary.ParseTime(s, m.loc)
+}
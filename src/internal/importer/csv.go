@@ -0,0 +1,62 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// CSVSource streams the rows of a CSV file with a header line.
+type CSVSource struct {
+	r      *csv.Reader
+	header []string
+}
+
+// NewCSVSource reads the header of r. A UTF-8 byte order mark (as written by
+// Excel and some portal exports) is ignored, and quoting is lenient.
+func NewCSVSource(r io.Reader) (*CSVSource, error) {
+	br := bufio.NewReader(r)
+	if bom, err := br.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		_, _ = br.Discard(3)
+	}
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty CSV: no header line")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("CSV header: %w", err)
+	}
+	cols := make([]string, len(header))
+	for i, h := range header {
+		cols[i] = strings.TrimSpace(h)
+	}
+	return &CSVSource{r: cr, header: cols}, nil
+}
+
+// Header returns the column names.
+func (s *CSVSource) Header() []string {
+	return s.header
+}
+
+// Next returns the next row keyed by column name; missing trailing fields are
+// empty.
+func (s *CSVSource) Next() (Row, error) {
+	rec, err := s.r.Read()
+	if err != nil {
+		return nil, err // io.EOF, or a *csv.ParseError with the line
+	}
+	row := make(Row, len(s.header))
+	for i, col := range s.header {
+		if i < len(rec) {
+			row[col] = rec[i]
+		}
+	}
+	return row, nil
+}
@@ -0,0 +1,49 @@
+package importer
+
+import (
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+)
+
+// DictionaryMapper maps rows of any CSV export through a data dictionary
+// (dictionaries/*.yaml).
+type DictionaryMapper struct {
+	dict   *dictionary.Dictionary
+	bounds *repository.GeoBBox
+}
+
+// NewDictionaryMapper maps rows through d. With bounds, coordinates outside
+// it are dropped like the Boston mapper does.
+func NewDictionaryMapper(d *dictionary.Dictionary, bounds *repository.GeoBBox) *DictionaryMapper {
+	return &DictionaryMapper{dict: d, bounds: bounds}
+}
+
+// Map converts one row. Rows the dictionary cannot map, without a service or
+// location (coordinates, address or address id), or, when the dictionary's
+// enforcement mode is reject, with values outside their value sets are
+// skipped.
+func (m *DictionaryMapper) Map(row Row) (models.ServiceRequest, error) {
+	req, err := m.dict.Map(row)
+	if err != nil {
+		if req.ServiceRequestID != "" {
+			return req, skipf("%s: %v", req.ServiceRequestID, err)
+		}
+		return req, skipf("%v", err)
+	}
+	if m.bounds != nil && !m.bounds.Contains(req.Latitude, req.Longitude) {
+		req.Latitude, req.Longitude = 0, 0
+	}
+	switch {
+	case req.ServiceCode == "":
+		return req, skipf("%s: no service", req.ServiceRequestID)
+	case req.Latitude == 0 && req.Longitude == 0 && req.Address == "" && req.AddressID == "":
+		return req, skipf("%s: no valid coordinates or address", req.ServiceRequestID)
+	}
+	if m.dict.Enforcement.Mode == dictionary.EnforceReject {
+		if v := m.dict.Check(req); len(v) > 0 {
+			return req, skipf("%s: %s", req.ServiceRequestID, dictionary.Summary(v))
+		}
+	}
+	return req, nil
+}
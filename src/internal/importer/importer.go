@@ -0,0 +1,242 @@
+// Package importer loads service requests from bulk source files (e.g. a city's
+// 311 CSV export) straight into a ServiceRequestRepository, in batches through
+// BulkUpsert, with resumable progress.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+)
+
+// Row is one source record keyed by column name.
+type Row map[string]string
+
+// Source yields rows until io.EOF.
+type Source interface {
+	Next() (Row, error)
+}
+
+// RequestSource yields service requests that need no mapping (e.g. an export
+// of this API) until io.EOF. A *SkipError skips one record.
+type RequestSource interface {
+	Next() (models.ServiceRequest, error)
+}
+
+// Mapper converts a source row into a service request. A *SkipError means the
+// row cannot be imported (e.g. it has no location) and is counted, not fatal.
+type Mapper interface {
+	Map(row Row) (models.ServiceRequest, error)
+}
+
+// SkipError reports a row the mapper rejects.
+type SkipError struct {
+	Reason string
+}
+
+func (e *SkipError) Error() string { return e.Reason }
+
+// skipf returns a *SkipError.
+func skipf(format string, args ...interface{}) error {
+	return &SkipError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// DefaultBatchSize is the number of records per BulkUpsert call.
+const DefaultBatchSize = 500
+
+// maxSampledErrors caps the skipped/failed rows reported in Stats.Samples.
+const maxSampledErrors = 20
+
+// Options tunes an import.
+type Options struct {
+	// BatchSize is the number of records per BulkUpsert (DefaultBatchSize
+	// when 0).
+	BatchSize int
+	// OnlyIfNewer keeps stored records that are as new or newer (see
+	// repository.BulkUpsertOptions).
+	OnlyIfNewer bool
+	// DryRun maps rows without writing.
+	DryRun bool
+	// Limit stops after this many source rows (0 = all).
+	Limit int
+	// Progress, when set, records how far the import got after every batch
+	// and, on start, skips the rows an earlier run already imported.
+	Progress Progress
+	// Logf receives a line per batch (nil discards them).
+	Logf func(format string, args ...interface{})
+}
+
+func (o Options) logf(format string, args ...interface{}) {
+	if o.Logf != nil {
+		o.Logf(format, args...)
+	}
+}
+
+// Stats summarizes an import. Counts include the rows of resumed runs.
+type Stats struct {
+	// Rows is the number of source rows consumed.
+	Rows      int `json:"rows"`
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+	// Samples describes the first skipped or failed rows.
+	Samples []string `json:"samples,omitempty"`
+}
+
+func (s *Stats) sample(format string, args ...interface{}) {
+	if len(s.Samples) < maxSampledErrors {
+		s.Samples = append(s.Samples, fmt.Sprintf(format, args...))
+	}
+}
+
+// Progress persists the stats of an import after every written batch, so a
+// later run resumes after it (see ProgressFile). A Save error stops the
+// import.
+type Progress interface {
+	// Load returns the recorded stats, zero when nothing was recorded yet.
+	Load() (Stats, error)
+	Save(stats Stats) error
+}
+
+// Importer writes mapped rows to a repository.
+type Importer struct {
+	repo repository.ServiceRequestRepository
+	opts Options
+}
+
+// New creates an Importer writing to repo.
+func New(repo repository.ServiceRequestRepository, opts Options) *Importer {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	return &Importer{repo: repo, opts: opts}
+}
+
+// Run imports src through m. Rows are only counted as done once their batch
+// is written, so an interrupted import resumes (with the same progress file)
+// at the first unwritten batch; re-writing is harmless, as BulkUpsert is keyed
+// on service_request_id.
+func (im *Importer) Run(ctx context.Context, src Source, m Mapper) (Stats, error) {
+	return im.run(ctx, func(skip bool) (models.ServiceRequest, error) {
+		row, err := src.Next()
+		if err != nil || skip {
+			return models.ServiceRequest{}, err
+		}
+		req, err := m.Map(row)
+		var skipErr *SkipError
+		if err != nil && !errors.As(err, &skipErr) {
+			return req, &mapError{err}
+		}
+		return req, err
+	})
+}
+
+// RunRequests imports the records of src like Run does mapped rows.
+func (im *Importer) RunRequests(ctx context.Context, src RequestSource) (Stats, error) {
+	return im.run(ctx, func(bool) (models.ServiceRequest, error) {
+		req, err := src.Next()
+		var skipErr *SkipError
+		if err != nil && !errors.Is(err, io.EOF) && !errors.As(err, &skipErr) {
+			return req, &mapError{err}
+		}
+		return req, err
+	})
+}
+
+// mapError marks an error converting a record (rather than reading the
+// source), which is reported with the record's number.
+type mapError struct{ err error }
+
+func (e *mapError) Error() string { return e.err.Error() }
+func (e *mapError) Unwrap() error { return e.err }
+
+// run imports the records next yields (io.EOF ends them); with skip set, next
+// only consumes a record, to resume after the rows an earlier run imported.
+func (im *Importer) run(ctx context.Context, next func(skip bool) (models.ServiceRequest, error)) (Stats, error) {
+	var stats Stats
+	if im.opts.Progress != nil {
+		saved, err := im.opts.Progress.Load()
+		if err != nil {
+			return stats, err
+		}
+		stats = saved
+		var skipErr *SkipError
+		for i := 0; i < saved.Rows; i++ {
+			if _, err := next(true); err != nil && !errors.As(err, &skipErr) {
+				if errors.Is(err, io.EOF) {
+					return stats, fmt.Errorf("progress records %d rows but the source has %d", saved.Rows, i)
+				}
+				return stats, err
+			}
+		}
+		if saved.Rows > 0 {
+			im.opts.logf("Resuming after %d rows", saved.Rows)
+		}
+	}
+
+	batch := make([]models.ServiceRequest, 0, im.opts.BatchSize)
+	pending := 0 // rows consumed since the last flush
+	flush := func() error {
+		if len(batch) > 0 && !im.opts.DryRun {
+			res, err := im.repo.BulkUpsert(ctx, batch, repository.BulkUpsertOptions{OnlyIfNewer: im.opts.OnlyIfNewer})
+			if err != nil {
+				return err
+			}
+			stats.Created += res.Created
+			stats.Updated += res.Updated
+			stats.Unchanged += res.Skipped
+			stats.Failed += res.Failed
+			for _, e := range res.Errors {
+				stats.sample("%s: %s", e.ServiceRequestID, e.Message)
+			}
+		}
+		stats.Rows += pending
+		im.opts.logf("%d rows: created=%d updated=%d unchanged=%d skipped=%d failed=%d",
+			stats.Rows, stats.Created, stats.Updated, stats.Unchanged, stats.Skipped, stats.Failed)
+		batch, pending = batch[:0], 0
+		if im.opts.Progress != nil && !im.opts.DryRun {
+			return im.opts.Progress.Save(stats)
+		}
+		return nil
+	}
+
+	for im.opts.Limit <= 0 || stats.Rows+pending < im.opts.Limit {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		req, err := next(false)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var skip *SkipError
+		var mapErr *mapError
+		switch {
+		case errors.As(err, &mapErr):
+			return stats, fmt.Errorf("row %d: %w", stats.Rows+pending+1, mapErr.err)
+		case errors.As(err, &skip):
+			pending++
+			stats.Skipped++
+			stats.sample("row %d: %s", stats.Rows+pending, skip.Reason)
+		case err != nil:
+			return stats, err
+		default:
+			pending++
+			batch = append(batch, req)
+		}
+		if len(batch) >= im.opts.BatchSize {
+			if err := flush(); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
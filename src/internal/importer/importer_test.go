@@ -0,0 +1,220 @@
+package importer
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+)
+
+const legacyCSV = "\xef\xbb\xbfcase_enquiry_id,open_dt,closed_dt,case_status,case_title,type,reason,department,location,location_zipcode,latitude,longitude,neighborhood,ward,submitted_photo\n" +
+	"101,2024-07-01 09:15:00,2024-07-02 10:00:00,Closed,Pothole repair,Request for Pothole Repair,Highway Maintenance,PWDx,1 Main St &amp; Elm St,02118,42.3401,-71.0723,South End,Ward 3,https://example.com/p.jpg\n" +
+	"102,2024-01-15 08:00:00,,Open,Graffiti,,Graffiti,PWDx,,,42.35,-71.06,,,\n" +
+	"103,2024-11-03 01:30:00,,Open,No location,Street Light Outages,,PWDx,,,0,0,,,\n" +
+	"104,2024-03-10 12:00:00,,Open,Outside the box,Sign Repair,,BTDT,2 Water St,,48.85,2.35,,,\n" +
+	",2024-03-10 12:00:00,,Open,No id,Sign Repair,,BTDT,3 Water St,,,,,,\n"
+
+func newCSV(t *testing.T, data string) (*CSVSource, *BostonMapper) {
+	t.Helper()
+	src, err := NewCSVSource(strings.NewReader(data))
+	require.NoError(t, err)
+	m, err := NewBostonMapper(src.Header(), BostonBBox)
+	require.NoError(t, err)
+	return src, m
+}
+
+func TestBostonMapperLegacy(t *testing.T) {
+	src, m := newCSV(t, legacyCSV)
+	assert.Equal(t, "legacy", m.Layout())
+
+	row, err := src.Next()
+	require.NoError(t, err)
+	req, err := m.Map(row)
+	require.NoError(t, err)
+	assert.Equal(t, "101", req.ServiceRequestID)
+	assert.Equal(t, "Request for Pothole Repair", req.ServiceCode)
+	assert.Equal(t, "Request for Pothole Repair", req.ServiceName)
+	assert.Equal(t, "closed", req.Status)
+	assert.Equal(t, "Pothole repair", req.Description)
+	assert.Equal(t, "1 Main St & Elm St", req.Address, "entities are decoded")
+	assert.Equal(t, 42.3401, req.Latitude)
+	assert.Equal(t, -71.0723, req.Longitude)
+	assert.Equal(t, "https://example.com/p.jpg", req.MediaURL)
+	// EDT (UTC-4) in July.
+	assert.Equal(t, time.Date(2024, 7, 1, 13, 15, 0, 0, time.UTC), req.RequestedDatetime)
+	assert.Equal(t, time.Date(2024, 7, 2, 14, 0, 0, 0, time.UTC), req.UpdatedDatetime)
+	assert.Equal(t, "South End", req.Properties["neighborhood"])
+	assert.Equal(t, "Ward 3", req.Properties["ward"])
+	assert.Equal(t, "Highway Maintenance", req.Properties["reason"])
+
+	row, err = src.Next()
+	require.NoError(t, err)
+	req, err = m.Map(row)
+	require.NoError(t, err)
+	assert.Equal(t, "Graffiti", req.ServiceCode, "reason is the fallback service")
+	assert.Equal(t, "open", req.Status)
+	// EST (UTC-5) in January; an open case last changed when it opened.
+	assert.Equal(t, time.Date(2024, 1, 15, 13, 0, 0, 0, time.UTC), req.RequestedDatetime)
+	assert.Equal(t, req.RequestedDatetime, req.UpdatedDatetime)
+
+	row, err = src.Next()
+	require.NoError(t, err)
+	_, err = m.Map(row)
+	var skip *SkipError
+	require.ErrorAs(t, err, &skip, "0,0 is no location and there is no address")
+
+	row, err = src.Next()
+	require.NoError(t, err)
+	req, err = m.Map(row)
+	require.NoError(t, err)
+	assert.Zero(t, req.Latitude, "coordinates outside the box are dropped")
+	assert.Equal(t, "2 Water St", req.Address)
+
+	row, err = src.Next()
+	require.NoError(t, err)
+	_, err = m.Map(row)
+	require.ErrorAs(t, err, &skip)
+}
+
+func TestBostonMapperNewSystem(t *testing.T) {
+	src, m := newCSV(t, "Case ID,Service Name,Case Topic,Case Status,Closure Comments,Open Date,Close Date,Full Street Address,Latitude (Y),Longitude (X),On Time?,Neighborhood\n"+
+		"BCS-00059336,Pothole,Street Repair,In progress,,11/02/2025 01:30:00 AM,,1 City Hall Sq,42.3603,-71.0580,ONTIME,Downtown\n")
+	assert.Equal(t, "new system", m.Layout())
+	row, err := src.Next()
+	require.NoError(t, err)
+	req, err := m.Map(row)
+	require.NoError(t, err)
+	assert.Equal(t, "BCS-00059336", req.ServiceRequestID)
+	assert.Equal(t, "Street Repair", req.ServiceCode)
+	assert.Equal(t, "Pothole", req.ServiceName)
+	assert.Equal(t, "open", req.Status)
+	// 01:30 on the night DST ends is read as the earlier, daylight instant.
+	assert.Equal(t, time.Date(2025, 11, 2, 5, 30, 0, 0, time.UTC), req.RequestedDatetime)
+	assert.Equal(t, "ONTIME", req.Properties["on_time"])
+	assert.Equal(t, "Downtown", req.Properties["neighborhood"])
+
+	_, err = NewBostonMapper([]string{"id", "name"}, BostonBBox)
+	assert.Error(t, err)
+}
+
+func TestImporterResumes(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryServiceRequestRepository()
+	dir := t.TempDir()
+	progress := func() *ProgressFile {
+		return &ProgressFile{Path: filepath.Join(dir, "progress.json"), Source: "boston.csv", SourceSize: int64(len(legacyCSV))}
+	}
+
+	// The first run stops after three rows (two batches of two rows).
+	src, m := newCSV(t, legacyCSV)
+	stats, err := New(repo, Options{BatchSize: 2, Limit: 3, Progress: progress()}).Run(ctx, src, m)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Rows)
+	assert.Equal(t, 2, stats.Created)
+	assert.Equal(t, 1, stats.Skipped)
+
+	// The rerun continues with row four.
+	src, m = newCSV(t, legacyCSV)
+	stats, err = New(repo, Options{BatchSize: 2, Progress: progress()}).Run(ctx, src, m)
+	require.NoError(t, err)
+	assert.Equal(t, 5, stats.Rows)
+	assert.Equal(t, 3, stats.Created)
+	assert.Equal(t, 2, stats.Skipped)
+	assert.Len(t, stats.Samples, 2)
+
+	got, err := repo.FindByServiceRequestID(ctx, "104")
+	require.NoError(t, err)
+	assert.Equal(t, "Sign Repair", got.ServiceCode)
+
+	// Progress recorded for another file is refused.
+	other := progress()
+	other.SourceSize++
+	src, m = newCSV(t, legacyCSV)
+	_, err = New(repo, Options{Progress: other}).Run(ctx, src, m)
+	assert.ErrorContains(t, err, "remove it to start over")
+
+	// Rerunning from scratch with only-if-newer writes nothing.
+	require.NoError(t, os.Remove(progress().Path))
+	src, m = newCSV(t, legacyCSV)
+	stats, err = New(repo, Options{OnlyIfNewer: true, Progress: progress()}).Run(ctx, src, m)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Unchanged)
+	assert.Zero(t, stats.Created+stats.Updated)
+}
+
+func TestImporterDryRun(t *testing.T) {
+	repo := repository.NewMemoryServiceRequestRepository()
+	src, m := newCSV(t, legacyCSV)
+	stats, err := New(repo, Options{DryRun: true}).Run(context.Background(), src, m)
+	require.NoError(t, err)
+	assert.Equal(t, 5, stats.Rows)
+	assert.Equal(t, 2, stats.Skipped)
+	n, err := repo.Count(context.Background(), repository.ServiceRequestQuery{})
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestDictionaryMapper(t *testing.T) {
+	dict, err := dictionary.Load(filepath.Join("..", "..", "..", "dictionaries", "boston-311.yaml"))
+	require.NoError(t, err)
+	src, err := NewCSVSource(strings.NewReader("Case ID,Case Topic,Case Status,Open Date,Latitude (Y),Longitude (X),Full Street Address\n" +
+		"BCS-1,Pothole,Closed,2025-07-01 09:00:00,48.85,2.35,1 City Hall Sq\n" +
+		"BCS-2,Pothole,Closed,2025-07-01 09:00:00,48.85,2.35,\n" +
+		"BCS-3,Pothole,Closed,not a date,42.36,-71.06,\n"))
+	require.NoError(t, err)
+	m := NewDictionaryMapper(dict, &BostonBBox)
+
+	row, err := src.Next()
+	require.NoError(t, err)
+	req, err := m.Map(row)
+	require.NoError(t, err)
+	assert.Equal(t, "closed", req.Status)
+	assert.Zero(t, req.Latitude, "coordinates outside the box are dropped")
+
+	var skip *SkipError
+	for range 2 {
+		row, err = src.Next()
+		require.NoError(t, err)
+		_, err = m.Map(row)
+		require.ErrorAs(t, err, &skip)
+	}
+	assert.Contains(t, skip.Reason, "BCS-3")
+}
+
+func TestJSONSources(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewMemoryServiceRequestRepository()
+
+	src := NewNDJSONSource(strings.NewReader(`{"service_request_id":"1","service_code":"pothole","lat":60.1,"long":24.9}` + "\n\n" +
+		"not json\n" +
+		`{"service_request_id":"2","service_code":"pothole"}` + "\n" +
+		`{"service_request_id":"3","service_code":"graffiti","address":"1 Main St"}` + "\n"))
+	stats, err := New(repo, Options{}).RunRequests(ctx, src.Requests(nil))
+	require.NoError(t, err)
+	assert.Equal(t, 4, stats.Rows)
+	assert.Equal(t, 2, stats.Created)
+	assert.Equal(t, 2, stats.Skipped)
+	assert.Len(t, stats.Samples, 2)
+
+	arr, err := NewJSONSource(strings.NewReader(`[{"Case ID":"BCS-1"}, 7]`))
+	require.NoError(t, err)
+	row, err := arr.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "BCS-1", row["Case ID"])
+	_, err = arr.Next()
+	var skip *SkipError
+	assert.ErrorAs(t, err, &skip)
+	_, err = arr.Next()
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, err = NewJSONSource(strings.NewReader(`{"service_request_id":"1"}`))
+	assert.ErrorContains(t, err, "expected an array")
+}
@@ -0,0 +1,132 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+)
+
+// maxJSONLine bounds one record of an NDJSON file.
+const maxJSONLine = 1 << 20
+
+// JSONSource streams the records of a JSON array, or of an NDJSON file (one
+// object per line, blank lines ignored), without holding the file in memory.
+// Its records are source rows (Next, for a Mapper) or service requests in the
+// API's own form (Requests).
+type JSONSource struct {
+	dec  *json.Decoder   // JSON array
+	sc   *bufio.Scanner  // NDJSON
+	line int             // NDJSON line of the last record
+	raw  json.RawMessage // reused between records
+}
+
+// NewJSONSource reads the opening bracket of the JSON array in r.
+func NewJSONSource(r io.Reader) (*JSONSource, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("JSON: %w", err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return nil, fmt.Errorf("JSON: expected an array of records")
+	}
+	return &JSONSource{dec: dec}, nil
+}
+
+// NewNDJSONSource streams the lines of r; lines longer than 1 MiB stop it.
+func NewNDJSONSource(r io.Reader) *JSONSource {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxJSONLine)
+	return &JSONSource{sc: sc}
+}
+
+// next returns the next record undecoded. A malformed NDJSON line is a
+// *SkipError; a malformed array ends the source, as nothing after the error
+// can be read.
+func (s *JSONSource) next() (json.RawMessage, error) {
+	if s.dec != nil {
+		if !s.dec.More() {
+			if _, err := s.dec.Token(); err != nil {
+				return nil, fmt.Errorf("JSON: %w", err)
+			}
+			return nil, io.EOF
+		}
+		s.raw = s.raw[:0]
+		if err := s.dec.Decode(&s.raw); err != nil {
+			return nil, fmt.Errorf("JSON: %w", err)
+		}
+		return s.raw, nil
+	}
+	for s.sc.Scan() {
+		s.line++
+		data := bytes.TrimSpace(s.sc.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		if !json.Valid(data) {
+			return nil, skipf("line %d: invalid JSON", s.line)
+		}
+		return data, nil
+	}
+	if err := s.sc.Err(); err != nil {
+		return nil, fmt.Errorf("NDJSON line %d: %w", s.line+1, err)
+	}
+	return nil, io.EOF
+}
+
+// Next returns the next record as a row (see dictionary.JSONRow). Records
+// that are not objects are skipped.
+func (s *JSONSource) Next() (Row, error) {
+	data, err := s.next()
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(data, &obj); err != nil || obj == nil {
+		return nil, skipf("not a JSON object")
+	}
+	return dictionary.JSONRow(obj), nil
+}
+
+// Requests reads the records as service requests. Like a bulk upsert, records
+// without an id, service or location are skipped, and so are records outside
+// the value sets of valueSets (optional) when its enforcement mode is reject.
+func (s *JSONSource) Requests(valueSets *dictionary.Dictionary) RequestSource {
+	return &jsonRequests{src: s, valueSets: valueSets}
+}
+
+// jsonRequests is the RequestSource of a JSONSource.
+type jsonRequests struct {
+	src       *JSONSource
+	valueSets *dictionary.Dictionary
+}
+
+func (r *jsonRequests) Next() (models.ServiceRequest, error) {
+	var req models.ServiceRequest
+	data, err := r.src.next()
+	if err != nil {
+		return req, err
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return req, skipf("invalid service request: %v", err)
+	}
+	switch {
+	case req.ServiceRequestID == "":
+		return req, skipf("no service_request_id")
+	case req.ServiceCode == "":
+		return req, skipf("%s: no service_code", req.ServiceRequestID)
+	case req.Latitude == 0 && req.Longitude == 0 && req.Address == "" && req.AddressID == "":
+		return req, skipf("%s: no location", req.ServiceRequestID)
+	}
+	if r.valueSets != nil && r.valueSets.Enforcement.Mode == dictionary.EnforceReject {
+		if v := r.valueSets.Check(req); len(v) > 0 {
+			return req, skipf("%s: %s", req.ServiceRequestID, dictionary.Summary(v))
+		}
+	}
+	return req, nil
+}
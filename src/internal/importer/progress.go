@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ProgressFile persists how far an import of one source got, so a rerun
+// resumes after the last written batch.
+type ProgressFile struct {
+	// Path is where the progress is kept.
+	Path string
+	// Source and SourceSize identify the imported file; a progress file
+	// recorded for a different (or changed) source is refused.
+	Source     string
+	SourceSize int64
+}
+
+// progressDoc is the JSON form of a progress file.
+type progressDoc struct {
+	Source     string    `json:"source"`
+	SourceSize int64     `json:"source_size"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Stats      Stats     `json:"stats"`
+}
+
+// Load returns the recorded stats, zero when there is no progress file yet.
+func (p *ProgressFile) Load() (Stats, error) {
+	data, err := os.ReadFile(p.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Stats{}, nil
+	}
+	if err != nil {
+		return Stats{}, err
+	}
+	var doc progressDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Stats{}, fmt.Errorf("progress file %s: %w", p.Path, err)
+	}
+	if doc.Source != p.Source || doc.SourceSize != p.SourceSize {
+		return Stats{}, fmt.Errorf("progress file %s was recorded for %s (%d bytes), not %s (%d bytes); remove it to start over",
+			p.Path, doc.Source, doc.SourceSize, p.Source, p.SourceSize)
+	}
+	return doc.Stats, nil
+}
+
+// Save records stats, replacing the file atomically so an interrupted save
+// leaves the previous progress intact.
+func (p *ProgressFile) Save(stats Stats) error {
+	data, err := json.MarshalIndent(progressDoc{
+		Source:     p.Source,
+		SourceSize: p.SourceSize,
+		UpdatedAt:  time.Now().UTC(),
+		Stats:      stats,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p.Path), filepath.Base(p.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.Path)
+}
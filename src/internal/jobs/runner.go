@@ -0,0 +1,389 @@
+// Package jobs runs background import jobs: an uploaded file is kept in a
+// directory and queued as an ImportJob, and a bounded pool of workers imports
+// it through the importer package. Progress is saved to the job after every
+// written batch, so a cancelled, failed or interrupted job resumes where it
+// stopped, on any replica sharing the directory and the job store.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/importer"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+// Tuning of the workers.
+const (
+	pollInterval = 5 * time.Second
+	// jobLease is how long a claimed job stays hidden from other workers
+	// without progress; every written batch renews it, so it only lapses
+	// when the worker died.
+	jobLease = 5 * time.Minute
+)
+
+// errCancelRequested stops an import whose job was cancelled, possibly on
+// another replica.
+var errCancelRequested = errors.New("cancel requested")
+
+// Runner queues uploaded files as import jobs and runs them.
+type Runner struct {
+	repo     repository.ImportJobRepository
+	requests repository.ServiceRequestRepository
+	log      logger.Logger
+	dir      string
+	workers  int
+	dicts    dictionary.Registry
+	// valueSets checks the records of jobs without a dictionary; mode, when
+	// set, overrides the enforcement mode of every dictionary.
+	valueSets *dictionary.Dictionary
+	mode      string
+	lease     time.Duration
+	poll      time.Duration
+	now       func() time.Time
+	wake      chan struct{}
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc // job id -> cancels its import
+}
+
+// Option configures a Runner.
+type Option func(*Runner)
+
+// WithDictionaries makes the dictionaries (keyed by name) available to jobs
+// that map source rows.
+func WithDictionaries(reg dictionary.Registry) Option {
+	return func(r *Runner) { r.dicts = reg }
+}
+
+// WithValueSets checks the records of jobs without a dictionary against the
+// value sets of d (rejected records are skipped). mode, when set, overrides
+// the enforcement mode of d and of every job's dictionary, as VALUE_SET_MODE
+// does for bulk upserts.
+func WithValueSets(d *dictionary.Dictionary, mode string) Option {
+	return func(r *Runner) { r.valueSets, r.mode = d, mode }
+}
+
+// NewRunner creates a Runner that imports into requests (the same decorated
+// repository the API writes through).
+func NewRunner(repo repository.ImportJobRepository, requests repository.ServiceRequestRepository, cfg config.ImportJobsConfig, log logger.Logger, opts ...Option) *Runner {
+	r := &Runner{
+		repo:     repo,
+		requests: requests,
+		log:      log,
+		dir:      cfg.Dir,
+		workers:  cfg.Workers,
+		lease:    jobLease,
+		poll:     pollInterval,
+		now:      time.Now,
+		wake:     make(chan struct{}, max(cfg.Workers, 1)),
+		running:  make(map[string]context.CancelFunc),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// notify wakes an idle worker without blocking.
+func (r *Runner) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Enqueue stores body as the file of job and queues the job. The caller sets
+// the format, dictionary and only_if_newer.
+func (r *Runner) Enqueue(ctx context.Context, job models.ImportJob, body io.Reader) (models.ImportJob, error) {
+	if err := os.MkdirAll(r.dir, 0o750); err != nil {
+		return models.ImportJob{}, err
+	}
+	f, err := os.CreateTemp(r.dir, "import-*."+job.Format)
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+	size, err := io.Copy(f, body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return models.ImportJob{}, err
+	}
+
+	job.Status = models.JobQueued
+	job.File, job.Size = filepath.Base(f.Name()), size
+	created, err := r.repo.Create(ctx, job)
+	if err != nil {
+		os.Remove(f.Name())
+		return models.ImportJob{}, err
+	}
+	r.notify()
+	return created, nil
+}
+
+// Cancel cancels a queued job, or stops a running one after its current
+// batch: at once when it runs in this process, otherwise at its worker's
+// next progress update.
+func (r *Runner) Cancel(ctx context.Context, id string) (models.ImportJob, error) {
+	job, err := r.repo.Cancel(ctx, id)
+	if err != nil {
+		return job, err
+	}
+	r.mu.Lock()
+	if cancel := r.running[id]; cancel != nil {
+		cancel()
+	}
+	r.mu.Unlock()
+	return job, nil
+}
+
+// Resume queues a failed or cancelled job again; it continues after the last
+// written batch.
+func (r *Runner) Resume(ctx context.Context, id string) (models.ImportJob, error) {
+	job, err := r.repo.Resume(ctx, id)
+	if err != nil {
+		return job, err
+	}
+	r.notify()
+	return job, nil
+}
+
+// Run starts the workers and returns once ctx is cancelled and they have
+// stopped; their jobs are handed back to the queue for the next start.
+func (r *Runner) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < r.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work runs jobs one at a time until ctx is cancelled: right after jobs are
+// queued, and every few seconds for jobs whose worker died.
+func (r *Runner) work(ctx context.Context) {
+	ticker := time.NewTicker(r.poll)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil {
+			ran, err := r.RunOnce(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					r.log.Errorf("Import jobs: claim failed: %v", err)
+				}
+				break
+			}
+			if !ran {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// RunOnce claims one waiting job and runs it to the end. It reports whether
+// there was a job.
+func (r *Runner) RunOnce(ctx context.Context) (bool, error) {
+	job, err := r.repo.Claim(ctx, r.now(), r.lease)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	r.process(ctx, job)
+	return true, nil
+}
+
+// process imports a claimed job and records how it ended.
+func (r *Runner) process(ctx context.Context, job models.ImportJob) {
+	if job.CancelRequested { // cancelled while its previous worker was dying
+		r.finish(ctx, job, models.JobCancelled, "")
+		return
+	}
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r.mu.Lock()
+	r.running[job.ID] = cancel
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.running, job.ID)
+		r.mu.Unlock()
+	}()
+
+	r.log.Infof("Import job %s: started (attempt %d, after %d rows)", job.ID, job.Attempts, job.Counts.Rows)
+	progress := &jobProgress{r: r, ctx: context.WithoutCancel(ctx), job: job}
+	stats, err := r.importFile(jobCtx, job, progress)
+	job = progress.job // what was stored; later rows were not written
+	switch {
+	case errors.Is(err, repository.ErrInvalidState):
+		r.log.Warnf("Import job %s: claim lost to another worker", job.ID)
+	case err == nil:
+		job.Counts, job.Samples = counts(stats), stats.Samples
+		if r.finish(ctx, job, models.JobSucceeded, "") {
+			if err := os.Remove(filepath.Join(r.dir, job.File)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				r.log.Warnf("Import job %s: failed to remove the upload: %v", job.ID, err)
+			}
+		}
+	case ctx.Err() != nil:
+		// Shutting down: hand the job back, to resume on the next start.
+		job.Status, job.LeaseUntil = models.JobQueued, nil
+		if _, err := r.repo.Update(context.WithoutCancel(ctx), job); err != nil {
+			r.log.Errorf("Import job %s: failed to release: %v", job.ID, err)
+		}
+	case errors.Is(err, errCancelRequested) || jobCtx.Err() != nil:
+		r.finish(ctx, job, models.JobCancelled, "")
+	default:
+		r.finish(ctx, job, models.JobFailed, err.Error())
+	}
+}
+
+// finish records the final status of a job, reporting whether it was stored.
+func (r *Runner) finish(ctx context.Context, job models.ImportJob, status, reason string) bool {
+	now := r.now()
+	job.Status, job.Error = status, reason
+	job.LeaseUntil, job.FinishedAt = nil, &now
+	if _, err := r.repo.Update(context.WithoutCancel(ctx), job); err != nil {
+		r.log.Errorf("Import job %s: failed to record %s: %v", job.ID, status, err)
+		return false
+	}
+	c := job.Counts
+	r.log.Infof("Import job %s: %s after %d rows: created=%d updated=%d unchanged=%d skipped=%d failed=%d",
+		job.ID, status, c.Rows, c.Created, c.Updated, c.Unchanged, c.Skipped, c.Failed)
+	if reason != "" {
+		r.log.Warnf("Import job %s: %s", job.ID, reason)
+	}
+	return true
+}
+
+// dictionary returns the named dictionary with the enforcement mode override
+// applied, or nil.
+func (r *Runner) dictionary(name string) *dictionary.Dictionary {
+	d := r.dicts[name]
+	if name == "" {
+		d = r.valueSets
+	}
+	if d == nil || r.mode == "" {
+		return d
+	}
+	c := *d
+	c.Enforcement.Mode = r.mode
+	return &c
+}
+
+// importFile imports the stored upload of job.
+func (r *Runner) importFile(ctx context.Context, job models.ImportJob, progress importer.Progress) (importer.Stats, error) {
+	var dict *dictionary.Dictionary
+	if job.Dictionary != "" {
+		if dict = r.dictionary(job.Dictionary); dict == nil {
+			return importer.Stats{}, fmt.Errorf("unknown dictionary %q", job.Dictionary)
+		}
+	}
+	f, err := os.Open(filepath.Join(r.dir, job.File))
+	if errors.Is(err, fs.ErrNotExist) {
+		return importer.Stats{}, fmt.Errorf("the uploaded file is missing from IMPORT_JOB_DIR")
+	}
+	if err != nil {
+		return importer.Stats{}, err
+	}
+	defer f.Close()
+
+	im := importer.New(r.requests, importer.Options{OnlyIfNewer: job.OnlyIfNewer, Progress: progress})
+	switch job.Format {
+	case models.ImportFormatCSV:
+		if dict == nil {
+			return importer.Stats{}, fmt.Errorf("a CSV import needs a dictionary")
+		}
+		src, err := importer.NewCSVSource(f)
+		if err != nil {
+			return importer.Stats{}, err
+		}
+		return im.Run(ctx, src, importer.NewDictionaryMapper(dict, nil))
+	case models.ImportFormatJSON, models.ImportFormatNDJSON:
+		var src *importer.JSONSource
+		if job.Format == models.ImportFormatJSON {
+			if src, err = importer.NewJSONSource(f); err != nil {
+				return importer.Stats{}, err
+			}
+		} else {
+			src = importer.NewNDJSONSource(f)
+		}
+		if dict != nil {
+			return im.Run(ctx, src, importer.NewDictionaryMapper(dict, nil))
+		}
+		return im.RunRequests(ctx, src.Requests(r.dictionary("")))
+	}
+	return importer.Stats{}, fmt.Errorf("unknown format %q", job.Format)
+}
+
+// jobProgress saves the progress of an import to its job, renewing the
+// lease, and stops the import when the job was cancelled meanwhile.
+type jobProgress struct {
+	r *Runner
+	// ctx outlives a cancelled import, so the last written batch is recorded.
+	ctx context.Context
+	job models.ImportJob
+}
+
+func (p *jobProgress) Load() (importer.Stats, error) {
+	c := p.job.Counts
+	return importer.Stats{
+		Rows:      c.Rows,
+		Created:   c.Created,
+		Updated:   c.Updated,
+		Unchanged: c.Unchanged,
+		Skipped:   c.Skipped,
+		Failed:    c.Failed,
+		Samples:   p.job.Samples,
+	}, nil
+}
+
+func (p *jobProgress) Save(stats importer.Stats) error {
+	job := p.job
+	job.Counts, job.Samples = counts(stats), stats.Samples
+	until := p.r.now().Add(p.r.lease)
+	job.LeaseUntil = &until
+	stored, err := p.r.repo.Update(p.ctx, job)
+	if err != nil {
+		return err
+	}
+	p.job = stored
+	if stored.CancelRequested {
+		return errCancelRequested
+	}
+	return nil
+}
+
+// counts converts importer stats to job counters.
+func counts(s importer.Stats) models.ImportCounts {
+	return models.ImportCounts{
+		Rows:      s.Rows,
+		Created:   s.Created,
+		Updated:   s.Updated,
+		Unchanged: s.Unchanged,
+		Skipped:   s.Skipped,
+		Failed:    s.Failed,
+	}
+}
@@ -0,0 +1,201 @@
+package jobs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/dictionary"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+const requestsNDJSON = `{"service_request_id":"1","service_code":"pothole","lat":60.1,"long":24.9}
+{"service_request_id":"2","service_code":"pothole"}
+{"service_request_id":"3","service_code":"graffiti","address":"1 Main St","updated_datetime":"2026-01-01T00:00:00Z"}
+`
+
+func newTestRunner(t *testing.T, opts ...Option) (*Runner, *repository.MemoryImportJobRepository, *repository.MemoryServiceRequestRepository, *time.Time) {
+	t.Helper()
+	log, err := logger.New(logger.Config{Level: "fatal", Format: "text"})
+	require.NoError(t, err)
+	jobs := repository.NewMemoryImportJobRepository()
+	requests := repository.NewMemoryServiceRequestRepository()
+	r := NewRunner(jobs, requests, config.ImportJobsConfig{Dir: t.TempDir(), Workers: 1}, log, opts...)
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	return r, jobs, requests, &now
+}
+
+// runAll runs queued jobs until none is waiting.
+func runAll(t *testing.T, r *Runner) {
+	t.Helper()
+	for {
+		ran, err := r.RunOnce(context.Background())
+		require.NoError(t, err)
+		if !ran {
+			return
+		}
+	}
+}
+
+func TestRunnerImportsRequests(t *testing.T) {
+	ctx := context.Background()
+	r, jobs, requests, _ := newTestRunner(t)
+
+	job, err := r.Enqueue(ctx, models.ImportJob{Format: models.ImportFormatNDJSON}, strings.NewReader(requestsNDJSON))
+	require.NoError(t, err)
+	assert.Equal(t, models.JobQueued, job.Status)
+	assert.Equal(t, int64(len(requestsNDJSON)), job.Size)
+	runAll(t, r)
+
+	job, err = jobs.FindByID(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobSucceeded, job.Status)
+	assert.Equal(t, models.ImportCounts{Rows: 3, Created: 2, Skipped: 1}, job.Counts)
+	require.Len(t, job.Samples, 1)
+	assert.Contains(t, job.Samples[0], "no location")
+	assert.NotNil(t, job.FinishedAt)
+	_, err = os.Stat(filepath.Join(r.dir, job.File))
+	assert.True(t, os.IsNotExist(err), "the upload is removed")
+
+	got, err := requests.FindByServiceRequestID(ctx, "3")
+	require.NoError(t, err)
+	assert.Equal(t, "graffiti", got.ServiceCode)
+
+	// A JSON array, rerun only if newer, changes nothing.
+	job, err = r.Enqueue(ctx, models.ImportJob{Format: models.ImportFormatJSON, OnlyIfNewer: true},
+		strings.NewReader(`[{"service_request_id":"3","service_code":"graffiti","address":"1 Main St","updated_datetime":"2026-01-01T00:00:00Z"}]`))
+	require.NoError(t, err)
+	runAll(t, r)
+	job, err = jobs.FindByID(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobSucceeded, job.Status)
+	assert.Equal(t, models.ImportCounts{Rows: 1, Unchanged: 1}, job.Counts)
+}
+
+func TestRunnerMapsCSVWithDictionary(t *testing.T) {
+	ctx := context.Background()
+	dict, err := dictionary.Load(filepath.Join("..", "..", "..", "dictionaries", "boston-311.yaml"))
+	require.NoError(t, err)
+	r, jobs, requests, _ := newTestRunner(t, WithDictionaries(dictionary.Registry{"boston-311": dict}))
+
+	job, err := r.Enqueue(ctx, models.ImportJob{Format: models.ImportFormatCSV, Dictionary: "boston-311"},
+		strings.NewReader("Case ID,Case Topic,Case Status,Open Date,Latitude (Y),Longitude (X),Full Street Address\n"+
+			"BCS-1,Pothole,Closed,2025-07-01 09:00:00,42.36,-71.06,1 City Hall Sq\n"+
+			"BCS-2,Pothole,Closed,not a date,42.36,-71.06,\n"))
+	require.NoError(t, err)
+	runAll(t, r)
+
+	job, err = jobs.FindByID(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobSucceeded, job.Status)
+	assert.Equal(t, models.ImportCounts{Rows: 2, Created: 1, Skipped: 1}, job.Counts)
+	got, err := requests.FindByServiceRequestID(ctx, "BCS-1")
+	require.NoError(t, err)
+	assert.Equal(t, "closed", got.Status)
+
+	// A job naming a dictionary the runner no longer has fails.
+	job, err = r.Enqueue(ctx, models.ImportJob{Format: models.ImportFormatCSV, Dictionary: "gone"}, strings.NewReader("a\n"))
+	require.NoError(t, err)
+	runAll(t, r)
+	job, err = jobs.FindByID(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobFailed, job.Status)
+	assert.Contains(t, job.Error, `unknown dictionary "gone"`)
+}
+
+func TestRunnerCancelAndResume(t *testing.T) {
+	ctx := context.Background()
+	r, jobs, requests, _ := newTestRunner(t)
+
+	job, err := r.Enqueue(ctx, models.ImportJob{Format: models.ImportFormatNDJSON}, strings.NewReader(requestsNDJSON))
+	require.NoError(t, err)
+
+	// A queued job is cancelled at once and is not run.
+	job, err = r.Cancel(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobCancelled, job.Status)
+	runAll(t, r)
+	_, err = r.Cancel(ctx, job.ID)
+	assert.ErrorIs(t, err, repository.ErrInvalidState)
+
+	// Resumed, it runs to the end.
+	job, err = r.Resume(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobQueued, job.Status)
+	runAll(t, r)
+	job, err = jobs.FindByID(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobSucceeded, job.Status)
+	_, err = r.Resume(ctx, job.ID)
+	assert.ErrorIs(t, err, repository.ErrInvalidState)
+
+	// A job cancelled while running stops after its current batch.
+	job, err = r.Enqueue(ctx, models.ImportJob{Format: models.ImportFormatNDJSON},
+		strings.NewReader(`{"service_request_id":"9","service_code":"pothole","lat":60.1,"long":24.9}`))
+	require.NoError(t, err)
+	claimed, err := jobs.Claim(ctx, r.now(), r.lease)
+	require.NoError(t, err)
+	job, err = r.Cancel(ctx, job.ID)
+	require.NoError(t, err)
+	assert.True(t, job.CancelRequested)
+	r.process(ctx, claimed)
+	job, err = jobs.FindByID(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobCancelled, job.Status)
+	assert.Equal(t, models.ImportCounts{Rows: 1, Created: 1}, job.Counts)
+	_, err = requests.FindByServiceRequestID(ctx, "9")
+	assert.NoError(t, err)
+}
+
+func TestRunnerTakesOverLapsedJobs(t *testing.T) {
+	ctx := context.Background()
+	r, jobs, _, now := newTestRunner(t)
+
+	job, err := r.Enqueue(ctx, models.ImportJob{Format: models.ImportFormatNDJSON}, strings.NewReader(requestsNDJSON))
+	require.NoError(t, err)
+
+	// A worker claims the job and dies; it is hidden until the lease lapses.
+	dead, err := jobs.Claim(ctx, *now, r.lease)
+	require.NoError(t, err)
+	ran, err := r.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.False(t, ran)
+
+	*now = now.Add(r.lease + time.Second)
+	runAll(t, r)
+	job, err = jobs.FindByID(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobSucceeded, job.Status)
+	assert.Equal(t, 2, job.Attempts)
+
+	// The dead worker's late writes are fenced off.
+	dead.Status = models.JobFailed
+	_, err = jobs.Update(ctx, dead)
+	assert.ErrorIs(t, err, repository.ErrInvalidState)
+}
+
+func TestRunnerReleasesJobsOnShutdown(t *testing.T) {
+	r, jobs, _, _ := newTestRunner(t)
+	job, err := r.Enqueue(context.Background(), models.ImportJob{Format: models.ImportFormatNDJSON}, strings.NewReader(requestsNDJSON))
+	require.NoError(t, err)
+	claimed, err := jobs.Claim(context.Background(), r.now(), r.lease)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.process(ctx, claimed)
+
+	job, err = jobs.FindByID(context.Background(), job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobQueued, job.Status, "handed back for the next start")
+	assert.Zero(t, job.Counts.Created)
+}
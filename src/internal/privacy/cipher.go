@@ -0,0 +1,86 @@
+// Package privacy protects reporter personal data: field encryption at rest and
+// the public view of service requests (contact redaction, coordinate blurring).
+package privacy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedPrefix marks an encrypted field value. Values without it are treated
+// as plaintext, so data written before encryption was enabled stays readable.
+const encryptedPrefix = "enc:v1:"
+
+// AESCipher encrypts individual string fields with AES-GCM. Each value gets a
+// fresh random nonce, so equal plaintexts encrypt differently.
+type AESCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAESCipher creates an AESCipher from a 16, 24 or 32 byte key.
+func NewAESCipher(key []byte) (*AESCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AESCipher{aead: aead}, nil
+}
+
+// DecodeKey decodes a base64 (standard encoding) AES key and checks its length.
+func DecodeKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %v", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("encryption key must be 16, 24 or 32 bytes, got %d", len(key))
+}
+
+// Encrypt returns the encrypted form of plaintext. The empty string stays
+// empty, so absent fields remain absent. A value that already looks encrypted
+// is encrypted again: it is client input (writes only ever carry decrypted
+// values), and storing it as-is would make it undecryptable.
+func (c *AESCipher) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return plaintext, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt. Values without the encrypted prefix are returned
+// unchanged.
+func (c *AESCipher) Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("decoding encrypted field: %v", err)
+	}
+	n := c.aead.NonceSize()
+	if len(sealed) < n {
+		return "", errors.New("encrypted field is truncated")
+	}
+	plain, err := c.aead.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypting field: %v", err)
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,130 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"slices"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// Coordinate blurring modes for sensitive service codes.
+const (
+	CoordinatesExact  = "off"
+	CoordinatesRound  = "round"
+	CoordinatesJitter = "jitter"
+)
+
+// metersPerDegree is the length of one degree of latitude (WGS84, approx.).
+const metersPerDegree = 111320.0
+
+// Policy decides what unauthenticated clients see of a service request.
+type Policy struct {
+	// SensitiveServiceCodes get their location blurred in public responses.
+	SensitiveServiceCodes map[string]bool
+	// CoordinateMode is CoordinatesExact, CoordinatesRound or CoordinatesJitter.
+	CoordinateMode string
+	// Precision is the number of decimals kept in round mode (3 ≈ 110 m).
+	Precision int
+	// JitterMeters is the maximum displacement in jitter mode.
+	JitterMeters float64
+	// JitterSecret keys the per-request displacement, so it is stable across
+	// reads (no averaging attack) but cannot be recomputed and subtracted.
+	JitterSecret []byte
+}
+
+// NewPolicy creates a Policy for the given sensitive service codes.
+func NewPolicy(sensitiveCodes []string, mode string, precision int, jitterMeters float64, jitterSecret []byte) *Policy {
+	codes := make(map[string]bool, len(sensitiveCodes))
+	for _, c := range sensitiveCodes {
+		codes[c] = true
+	}
+	return &Policy{
+		SensitiveServiceCodes: codes,
+		CoordinateMode:        mode,
+		Precision:             precision,
+		JitterMeters:          jitterMeters,
+		JitterSecret:          jitterSecret,
+	}
+}
+
+// Redact clears the reporter contact fields.
+func Redact(req *models.ServiceRequest) {
+	for _, f := range req.ContactFields() {
+		*f = ""
+	}
+}
+
+// Public returns the view of req for unauthenticated clients: contact fields
+// are always removed, and for sensitive service codes the coordinates are
+// blurred and the street address dropped (it would give the location away).
+// A nil Policy only redacts contact fields.
+func (p *Policy) Public(req models.ServiceRequest) models.ServiceRequest {
+	Redact(&req)
+	if p == nil || !p.SensitiveServiceCodes[req.ServiceCode] || p.CoordinateMode == CoordinatesExact || p.CoordinateMode == "" {
+		return req
+	}
+	if req.Latitude == 0 && req.Longitude == 0 {
+		return req
+	}
+
+	switch p.CoordinateMode {
+	case CoordinatesRound:
+		req.Latitude = round(req.Latitude, p.Precision)
+		req.Longitude = round(req.Longitude, p.Precision)
+	case CoordinatesJitter:
+		req.Latitude, req.Longitude = p.jitter(req.ServiceRequestID, req.Latitude, req.Longitude)
+	}
+	req.Address, req.AddressID = "", ""
+	return req
+}
+
+// BlurredServiceCodes returns the service codes whose location Public
+// blurs, sorted; nil when nothing is blurred (also for a nil Policy). A geo
+// filter on the exact location would give a blurred point away, so public
+// geo queries leave these codes out.
+func (p *Policy) BlurredServiceCodes() []string {
+	if p == nil || p.CoordinateMode == CoordinatesExact || p.CoordinateMode == "" {
+		return nil
+	}
+	var codes []string
+	for code, sensitive := range p.SensitiveServiceCodes {
+		if sensitive {
+			codes = append(codes, code)
+		}
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+// PublicAll applies Public to every request.
+func (p *Policy) PublicAll(reqs []models.ServiceRequest) []models.ServiceRequest {
+	out := make([]models.ServiceRequest, len(reqs))
+	for i, req := range reqs {
+		out[i] = p.Public(req)
+	}
+	return out
+}
+
+func round(v float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(v*scale) / scale
+}
+
+// jitter displaces a point uniformly within a disc of JitterMeters, driven by
+// HMAC(secret, service_request_id) so the same request always moves the same way.
+func (p *Policy) jitter(id string, lat, long float64) (float64, float64) {
+	mac := hmac.New(sha256.New, p.JitterSecret)
+	mac.Write([]byte(id))
+	sum := mac.Sum(nil)
+	u1 := float64(binary.BigEndian.Uint64(sum[0:8])) / math.MaxUint64
+	u2 := float64(binary.BigEndian.Uint64(sum[8:16])) / math.MaxUint64
+
+	theta := 2 * math.Pi * u1
+	dist := p.JitterMeters * math.Sqrt(u2)
+	dLat := dist * math.Cos(theta) / metersPerDegree
+	dLong := dist * math.Sin(theta) / (metersPerDegree * math.Cos(lat*math.Pi/180))
+	return lat + dLat, long + dLong
+}
@@ -0,0 +1,104 @@
+package privacy
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+func TestAESCipherRoundTrip(t *testing.T) {
+	key, err := DecodeKey("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	assert.NoError(t, err)
+	c, err := NewAESCipher(key)
+	assert.NoError(t, err)
+
+	enc, err := c.Encrypt("jane@example.com")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(enc, encryptedPrefix))
+	assert.NotContains(t, enc, "jane")
+
+	again, _ := c.Encrypt("jane@example.com")
+	assert.NotEqual(t, enc, again, "fresh nonce per value")
+
+	dec, err := c.Decrypt(enc)
+	assert.NoError(t, err)
+	assert.Equal(t, "jane@example.com", dec)
+
+	// Empty stays empty; legacy plaintext passes through.
+	empty, _ := c.Encrypt("")
+	assert.Equal(t, "", empty)
+	plain, err := c.Decrypt("legacy@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy@example.com", plain)
+
+	_, err = c.Decrypt(encryptedPrefix + "AAAA")
+	assert.Error(t, err)
+
+	// Input that mimics the prefix is encrypted like any other value.
+	spoofed, err := c.Encrypt(encryptedPrefix + "garbage")
+	assert.NoError(t, err)
+	assert.NotEqual(t, encryptedPrefix+"garbage", spoofed)
+	dec, err = c.Decrypt(spoofed)
+	assert.NoError(t, err)
+	assert.Equal(t, encryptedPrefix+"garbage", dec)
+}
+
+func TestDecodeKey(t *testing.T) {
+	_, err := DecodeKey("c2hvcnQ=")
+	assert.Error(t, err)
+	_, err = DecodeKey("not base64!")
+	assert.Error(t, err)
+}
+
+func TestPolicyPublic(t *testing.T) {
+	req := models.ServiceRequest{
+		ServiceRequestID: "sr-1",
+		ServiceCode:      "DOMESTIC_VIOLENCE",
+		Email:            "jane@example.com",
+		Phone:            "555-0100",
+		Address:          "12 Elm St",
+		Latitude:         42.361234,
+		Longitude:        -71.057891,
+	}
+
+	t.Run("contact is always redacted", func(t *testing.T) {
+		var p *Policy
+		got := p.Public(req)
+		assert.Empty(t, got.Email)
+		assert.Empty(t, got.Phone)
+		assert.Equal(t, req.Latitude, got.Latitude)
+		assert.Equal(t, "12 Elm St", got.Address)
+	})
+
+	t.Run("round", func(t *testing.T) {
+		p := NewPolicy([]string{"DOMESTIC_VIOLENCE"}, CoordinatesRound, 3, 0, nil)
+		got := p.Public(req)
+		assert.Equal(t, 42.361, got.Latitude)
+		assert.Equal(t, -71.058, got.Longitude)
+		assert.Empty(t, got.Address)
+	})
+
+	t.Run("jitter is bounded and stable", func(t *testing.T) {
+		p := NewPolicy([]string{"DOMESTIC_VIOLENCE"}, CoordinatesJitter, 0, 250, []byte("secret"))
+		a, b := p.Public(req), p.Public(req)
+		assert.Equal(t, a.Latitude, b.Latitude)
+		assert.Equal(t, a.Longitude, b.Longitude)
+		assert.NotEqual(t, req.Latitude, a.Latitude)
+
+		dLat := (a.Latitude - req.Latitude) * metersPerDegree
+		dLong := (a.Longitude - req.Longitude) * metersPerDegree * math.Cos(req.Latitude*math.Pi/180)
+		assert.LessOrEqual(t, math.Hypot(dLat, dLong), 250.0+1e-6)
+	})
+
+	t.Run("other service codes keep exact coordinates", func(t *testing.T) {
+		p := NewPolicy([]string{"DOMESTIC_VIOLENCE"}, CoordinatesRound, 3, 0, nil)
+		other := req
+		other.ServiceCode = "POTHOLE"
+		got := p.Public(other)
+		assert.Equal(t, req.Latitude, got.Latitude)
+		assert.Empty(t, got.Email)
+	})
+}
@@ -0,0 +1,298 @@
+// Package propschema is the typed, versioned registry of properties keys
+// (schemas/properties.yaml): each key's type, namespace (e.g. psk5970:),
+// whether it is required and the schema version it was introduced in. Writes
+// are validated against it and their values converted to a canonical form, so
+// numbers, booleans and dates stored as strings still compare by type.
+package propschema
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// Type is the value type of a property.
+type Type string
+
+// Property types. Values are stored as strings in canonical form.
+const (
+	// String values are stored as given.
+	String Type = "string"
+	// Integer values are stored in decimal without leading zeros or '+'.
+	Integer Type = "integer"
+	// Number values are stored in plain decimal notation (no exponent).
+	Number Type = "number"
+	// Boolean values are stored as true or false.
+	Boolean Type = "boolean"
+	// Date values are stored as YYYY-MM-DD.
+	Date Type = "date"
+	// DateTime values are stored as RFC 3339 in UTC, to the second
+	// (2025-03-01T12:00:00Z), so they sort as strings.
+	DateTime Type = "datetime"
+)
+
+// dateTimeLayout is the canonical DateTime form.
+const dateTimeLayout = "2006-01-02T15:04:05Z"
+
+// Valid reports whether t is one of the property types.
+func (t Type) Valid() bool {
+	switch t {
+	case String, Integer, Number, Boolean, Date, DateTime:
+		return true
+	}
+	return false
+}
+
+// Numeric reports whether values of t compare as numbers.
+func (t Type) Numeric() bool {
+	return t == Integer || t == Number
+}
+
+// Ordered reports whether values of t can be compared by order (all but
+// booleans).
+func (t Type) Ordered() bool {
+	return t != Boolean
+}
+
+// Convert validates value as a t and returns its canonical form.
+func (t Type) Convert(value string) (string, error) {
+	v := strings.TrimSpace(value)
+	switch t {
+	case Integer:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("%q is not an integer", value)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case Number:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return "", fmt.Errorf("%q is not a number", value)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case Boolean:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a boolean (expected true or false)", value)
+		}
+		return strconv.FormatBool(b), nil
+	case Date:
+		d, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a date (expected YYYY-MM-DD)", value)
+		}
+		return d.Format(time.DateOnly), nil
+	case DateTime:
+		ts, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a datetime (expected RFC 3339 with an offset)", value)
+		}
+		return ts.UTC().Format(dateTimeLayout), nil
+	}
+	return value, nil
+}
+
+// Property declares one properties key.
+type Property struct {
+	Key string
+	// Namespace is the key's prefix before ':' ("" when it has none).
+	Namespace string
+	Type      Type
+	// Required keys must be present on requests at version Since or later
+	// that use the namespace; a required key without a namespace must always
+	// be present.
+	Required bool
+	// Since is the schema version that introduced the key.
+	Since       int
+	Description string
+}
+
+// Namespace groups keys sharing a prefix.
+type Namespace struct {
+	Name string
+	// Closed namespaces only accept the keys the schema declares; keys in
+	// open namespaces, or without one, pass through as strings.
+	Closed      bool
+	Description string
+}
+
+// Schema is a parsed properties schema.
+type Schema struct {
+	// Version is the current schema version, stamped on requests written
+	// without one.
+	Version    int
+	Namespaces map[string]Namespace
+	// Properties are keyed by properties key.
+	Properties map[string]Property
+}
+
+// document is the YAML form.
+type document struct {
+	Version    int `yaml:"version"`
+	Namespaces map[string]struct {
+		Closed      bool   `yaml:"closed"`
+		Description string `yaml:"description"`
+	} `yaml:"namespaces"`
+	Properties map[string]struct {
+		Type        Type   `yaml:"type"`
+		Required    bool   `yaml:"required"`
+		Since       int    `yaml:"since"`
+		Description string `yaml:"description"`
+	} `yaml:"properties"`
+}
+
+// NamespaceOf returns the namespace of a properties key: its prefix before
+// the first ':', or "" when it has none.
+func NamespaceOf(key string) string {
+	ns, _, ok := strings.Cut(key, ":")
+	if !ok {
+		return ""
+	}
+	return ns
+}
+
+// Parse reads a schema from YAML.
+func Parse(data []byte) (*Schema, error) {
+	var doc document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Version < 1 {
+		return nil, fmt.Errorf("version must be 1 or more")
+	}
+	s := &Schema{
+		Version:    doc.Version,
+		Namespaces: make(map[string]Namespace, len(doc.Namespaces)),
+		Properties: make(map[string]Property, len(doc.Properties)),
+	}
+	for name, ns := range doc.Namespaces {
+		if name == "" || strings.ContainsAny(name, ":.") {
+			return nil, fmt.Errorf("namespaces: invalid namespace %q", name)
+		}
+		s.Namespaces[name] = Namespace{Name: name, Closed: ns.Closed, Description: ns.Description}
+	}
+	for key, p := range doc.Properties {
+		if key == "" || strings.Contains(key, ".") || strings.HasPrefix(key, "$") {
+			return nil, fmt.Errorf("properties: invalid key %q", key)
+		}
+		if !p.Type.Valid() {
+			return nil, fmt.Errorf("properties.%s: unknown type %q (expected string, integer, number, boolean, date or datetime)", key, p.Type)
+		}
+		since := p.Since
+		if since == 0 {
+			since = 1
+		}
+		if since < 1 || since > s.Version {
+			return nil, fmt.Errorf("properties.%s: since %d is outside versions 1..%d", key, p.Since, s.Version)
+		}
+		s.Properties[key] = Property{
+			Key:         key,
+			Namespace:   NamespaceOf(key),
+			Type:        p.Type,
+			Required:    p.Required,
+			Since:       since,
+			Description: p.Description,
+		}
+	}
+	return s, nil
+}
+
+// Load reads a schema file.
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Lookup returns the declaration of key at version (the current one when 0);
+// keys introduced later are not declared yet.
+func (s *Schema) Lookup(key string, version int) (Property, bool) {
+	if version == 0 {
+		version = s.Version
+	}
+	p, ok := s.Properties[key]
+	if !ok || p.Since > version {
+		return Property{}, false
+	}
+	return p, true
+}
+
+// Apply validates props against schema version (the current one when 0) and
+// returns them in canonical form along with the version they conform to.
+// Declared keys are converted to their type; undeclared keys are refused in a
+// closed namespace and kept as strings elsewhere. All problems are reported in
+// one error.
+func (s *Schema) Apply(props models.Properties, version int) (models.Properties, int, error) {
+	if version == 0 {
+		version = s.Version
+	}
+	if version < 0 || version > s.Version {
+		return nil, 0, fmt.Errorf("properties_schema_version %d is not between 1 and %d", version, s.Version)
+	}
+
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	out := make(models.Properties, len(props))
+	used := map[string]bool{}
+	for _, k := range keys {
+		v := props[k]
+		ns := NamespaceOf(k)
+		used[ns] = true
+		p, ok := s.Lookup(k, version)
+		if !ok {
+			if s.Namespaces[ns].Closed {
+				problems = append(problems, fmt.Sprintf("%s: not in namespace %s at schema version %d", k, ns, version))
+				continue
+			}
+			out[k] = v
+			continue
+		}
+		c, err := p.Type.Convert(v)
+		if err != nil {
+			problems = append(problems, k+": "+err.Error())
+			continue
+		}
+		out[k] = c
+	}
+
+	var required []string
+	for k, p := range s.Properties {
+		if !p.Required || p.Since > version || (p.Namespace != "" && !used[p.Namespace]) {
+			continue
+		}
+		if _, ok := props[k]; !ok {
+			required = append(required, k)
+		}
+	}
+	sort.Strings(required)
+	for _, k := range required {
+		problems = append(problems, k+": required")
+	}
+
+	if len(problems) > 0 {
+		return nil, 0, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	if len(out) == 0 {
+		out = nil
+	}
+	return out, version, nil
+}
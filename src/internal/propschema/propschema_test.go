@@ -0,0 +1,94 @@
+package propschema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+func TestLoadRepositorySchema(t *testing.T) {
+	s, err := Load("../../../schemas/properties.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, 2, s.Version)
+	assert.True(t, s.Namespaces["psk5970"].Closed)
+
+	p, ok := s.Lookup("psk5970:condition_grade", 1)
+	require.True(t, ok)
+	assert.Equal(t, Integer, p.Type)
+	assert.Equal(t, "psk5970", p.Namespace)
+	_, ok = s.Lookup("psk5970:repair_cost", 1)
+	assert.False(t, ok, "introduced in version 2")
+}
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		typ  Type
+		in   string
+		want string
+		ok   bool
+	}{
+		{String, " as is ", " as is ", true},
+		{Integer, "007", "7", true},
+		{Integer, "+3", "3", true},
+		{Integer, "3.5", "", false},
+		{Number, "1.50", "1.5", true},
+		{Number, "1e3", "1000", true},
+		{Number, "NaN", "", false},
+		{Boolean, "TRUE", "true", true},
+		{Boolean, "0", "false", true},
+		{Boolean, "yes", "", false},
+		{Date, "2025-03-01", "2025-03-01", true},
+		{Date, "1.3.2025", "", false},
+		{DateTime, "2025-03-01T14:00:00.75+02:00", "2025-03-01T12:00:00Z", true},
+		{DateTime, "2025-03-01 12:00", "", false},
+	}
+	for _, tc := range cases {
+		got, err := tc.typ.Convert(tc.in)
+		if !tc.ok {
+			assert.Error(t, err, "%s %q", tc.typ, tc.in)
+			continue
+		}
+		require.NoError(t, err, "%s %q", tc.typ, tc.in)
+		assert.Equal(t, tc.want, got, "%s %q", tc.typ, tc.in)
+	}
+}
+
+func TestApply(t *testing.T) {
+	s, err := Parse([]byte(`
+version: 2
+namespaces:
+  psk5970: {closed: true}
+properties:
+  psk5970:event_class: {type: string, required: true}
+  psk5970:condition_grade: {type: integer, since: 1}
+  psk5970:repair_cost: {type: number, since: 2}
+  ward: {type: integer}
+`))
+	require.NoError(t, err)
+
+	props, version, err := s.Apply(models.Properties{"psk5970:event_class": "repair", "psk5970:repair_cost": "120.50", "neighborhood": "Dorchester"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version, "stamped with the current version")
+	assert.Equal(t, models.Properties{"psk5970:event_class": "repair", "psk5970:repair_cost": "120.5", "neighborhood": "Dorchester"}, props)
+
+	_, _, err = s.Apply(models.Properties{"psk5970:event_class": "repair", "psk5970:repair_cost": "1"}, 1)
+	assert.EqualError(t, err, "psk5970:repair_cost: not in namespace psk5970 at schema version 1")
+
+	_, _, err = s.Apply(models.Properties{"psk5970:condition_grade": "poor", "ward": "x"}, 2)
+	assert.EqualError(t, err, `psk5970:condition_grade: "poor" is not an integer; ward: "x" is not an integer; psk5970:event_class: required`)
+
+	props, version, err = s.Apply(nil, 1)
+	require.NoError(t, err, "required keys only apply when their namespace is used")
+	assert.Nil(t, props)
+	assert.Equal(t, 1, version)
+
+	_, _, err = s.Apply(nil, 3)
+	assert.Error(t, err, "newer than the schema")
+
+	_, err = Parse([]byte("version: 1\nproperties:\n  a: {type: decimal}\n"))
+	assert.Error(t, err)
+	_, err = Parse([]byte("version: 1\nproperties:\n  a: {type: string, since: 2}\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Change operations of a ServiceRequestChange.
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// ErrChangeHistoryLost is returned by ChangeFeed.Watch when the resume token is
+// no longer in the database's change history (the oplog rolled over while the
+// consumer was down). Changes since then must be re-read with updated_after.
+var ErrChangeHistoryLost = errors.New("change history lost")
+
+// ServiceRequestChange is one write to a service request.
+type ServiceRequestChange struct {
+	// ResumeToken identifies the change; Watch resumes after it.
+	ResumeToken string
+	// Operation is ChangeCreate, ChangeUpdate or ChangeDelete (a soft delete).
+	Operation        string
+	ServiceRequestID string
+	// Request is the stored request after the change (a tombstone for
+	// ChangeDelete). From the MongoDB feed it is the request as looked up when
+	// the event is read, which may already include later writes; its Version
+	// tells which.
+	Request models.ServiceRequest
+	// At is when the change was committed.
+	At time.Time
+	// PreviousStatus is the status before an update or delete, when known
+	// (ObservedServiceRequestRepository sets it; the MongoDB change feed
+	// does not).
+	PreviousStatus string
+}
+
+// ChangeFeed streams the writes to service requests as they are committed.
+type ChangeFeed interface {
+	// Watch calls handle for every change after resumeAfter (or, when it is
+	// empty, from now on), in commit order, until ctx is cancelled or handle
+	// returns an error, which Watch returns.
+	Watch(ctx context.Context, resumeAfter string, handle func(ServiceRequestChange) error) error
+}
+
+// CheckpointStore persists how far each change feed consumer got, so it can
+// resume after a restart.
+type CheckpointStore interface {
+	// LoadCheckpoint returns the last saved resume token of consumer, or ""
+	// when there is none.
+	LoadCheckpoint(ctx context.Context, consumer string) (string, error)
+	SaveCheckpoint(ctx context.Context, consumer, resumeToken string) error
+}
+
+// changeCheckpointCollection holds one resume token per change feed consumer.
+const changeCheckpointCollection = "change_stream_checkpoints"
+
+// changeHistoryLostCodes are the server errors for a resume token that has
+// fallen off the oplog.
+var changeHistoryLostCodes = []int{
+	136, // CappedPositionLost
+	280, // ChangeStreamFatalError
+	286, // ChangeStreamHistoryLost
+}
+
+// MongoChangeFeed implements ChangeFeed and CheckpointStore with a MongoDB
+// change stream on the service requests collection. Change streams need a
+// replica set or sharded cluster (a single-node replica set will do).
+type MongoChangeFeed struct {
+	collection  *mongo.Collection
+	checkpoints *mongo.Collection
+}
+
+// NewMongoChangeFeed creates a MongoChangeFeed on the given service requests
+// collection.
+func NewMongoChangeFeed(db *MongoDB, collection string) *MongoChangeFeed {
+	if collection == "" {
+		collection = "service_requests"
+	}
+	return &MongoChangeFeed{
+		collection:  db.GetCollection(collection),
+		checkpoints: db.GetCollection(changeCheckpointCollection),
+	}
+}
+
+// mongoChangeEvent is the part of a change stream event the feed uses.
+type mongoChangeEvent struct {
+	ID            bson.Raw            `bson:"_id"`
+	OperationType string              `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	FullDocument  *serviceRequestDoc  `bson:"fullDocument"`
+}
+
+// Watch streams inserts, updates and replacements with the full document.
+// For updates it is looked up (options.UpdateLookup) when the event is read:
+// the current majority-committed document, which may include later writes,
+// so consumers order and de-duplicate by its Version, not by arrival. Hard
+// deletes are skipped: they only come from PurgeDeleted, and the soft delete
+// before it was already a ChangeDelete.
+func (f *MongoChangeFeed) Watch(ctx context.Context, resumeAfter string, handle func(ServiceRequestChange) error) error {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{
+		"operationType": bson.M{"$in": bson.A{"insert", "update", "replace"}},
+	}}}}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeAfter != "" {
+		opts.SetStartAfter(bson.D{{Key: "_data", Value: resumeAfter}})
+	}
+
+	stream, err := f.collection.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return changeStreamError(err)
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var ev mongoChangeEvent
+		if err := stream.Decode(&ev); err != nil {
+			return fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		// An update looked up after the document was purged has none.
+		if ev.FullDocument == nil {
+			continue
+		}
+		token, ok := ev.ID.Lookup("_data").StringValueOK()
+		if !ok {
+			return fmt.Errorf("%w: unexpected resume token %s", ErrDatabase, ev.ID)
+		}
+		change := ServiceRequestChange{
+			ResumeToken:      token,
+			Operation:        ChangeUpdate,
+			ServiceRequestID: ev.FullDocument.ServiceRequestID,
+			Request:          ev.FullDocument.toModel(),
+			At:               time.Unix(int64(ev.ClusterTime.T), 0).UTC(),
+		}
+		switch {
+		case ev.FullDocument.DeletedAt != nil:
+			change.Operation = ChangeDelete
+		case ev.OperationType == "insert":
+			change.Operation = ChangeCreate
+		}
+		if err := handle(change); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return changeStreamError(stream.Err())
+}
+
+func changeStreamError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var se mongo.ServerError
+	if errors.As(err, &se) {
+		for _, code := range changeHistoryLostCodes {
+			if se.HasErrorCode(code) {
+				return fmt.Errorf("%w: %v", ErrChangeHistoryLost, err)
+			}
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrDatabase, err)
+}
+
+// changeCheckpointDoc is the persisted resume token of one consumer.
+type changeCheckpointDoc struct {
+	Consumer    string    `bson:"_id"`
+	ResumeToken string    `bson:"resume_token"`
+	UpdatedAt   time.Time `bson:"updated_at"`
+}
+
+// LoadCheckpoint returns the saved resume token of consumer.
+func (f *MongoChangeFeed) LoadCheckpoint(ctx context.Context, consumer string) (string, error) {
+	var doc changeCheckpointDoc
+	err := f.checkpoints.FindOne(ctx, bson.M{"_id": consumer}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return doc.ResumeToken, nil
+}
+
+// SaveCheckpoint stores the resume token of consumer; an empty token clears
+// it.
+func (f *MongoChangeFeed) SaveCheckpoint(ctx context.Context, consumer, resumeToken string) error {
+	var err error
+	if resumeToken == "" {
+		_, err = f.checkpoints.DeleteOne(ctx, bson.M{"_id": consumer})
+	} else {
+		_, err = f.checkpoints.ReplaceOne(ctx, bson.M{"_id": consumer},
+			changeCheckpointDoc{Consumer: consumer, ResumeToken: resumeToken, UpdatedAt: time.Now().UTC()},
+			options.Replace().SetUpsert(true))
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return nil
+}
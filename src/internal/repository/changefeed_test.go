@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// TestMongoChangeFeed watches a throwaway database when MONGODB_TEST_URI is
+// set. Change streams need a replica set; on a standalone server it skips.
+func TestMongoChangeFeed(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	db, err := NewMongoDBConnection(config.MongoDBConfig{
+		URI:              uri,
+		Database:         fmt.Sprintf("open311_changefeed_%d", time.Now().UnixNano()),
+		ConnectTimeout:   10,
+		OperationTimeout: 10,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.DropDatabase(context.Background())
+		_ = db.Disconnect()
+	})
+	repo := NewMongoServiceRequestRepository(db, "service_requests")
+	feed := NewMongoChangeFeed(db, "service_requests")
+
+	// watch collects n changes after resumeAfter.
+	watch := func(resumeAfter string, n int, write func()) []ServiceRequestChange {
+		var got []ServiceRequestChange
+		errc := make(chan error, 1)
+		watchCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go func() {
+			errc <- feed.Watch(watchCtx, resumeAfter, func(c ServiceRequestChange) error {
+				got = append(got, c)
+				if len(got) == n {
+					stop()
+				}
+				return nil
+			})
+		}()
+		// Give the stream time to open before writing.
+		time.Sleep(500 * time.Millisecond)
+		if write != nil {
+			write()
+		}
+		err := <-errc
+		if err != nil && strings.Contains(err.Error(), "replica set") {
+			t.Skip("change streams need a replica set")
+		}
+		require.ErrorIs(t, err, context.Canceled)
+		return got
+	}
+
+	got := watch("", 3, func() {
+		_, err := repo.Create(ctx, models.ServiceRequest{ServiceRequestID: "sr-1", Email: "a@example.com"})
+		require.NoError(t, err)
+		_, err = repo.Patch(ctx, "sr-1", ServiceRequestPatch{Fields: map[string]interface{}{"status": "closed"}}, Precondition{})
+		require.NoError(t, err)
+		require.NoError(t, repo.Delete(ctx, "sr-1", Precondition{}))
+	})
+	require.Len(t, got, 3)
+	assert.Equal(t, []string{ChangeCreate, ChangeUpdate, ChangeDelete},
+		[]string{got[0].Operation, got[1].Operation, got[2].Operation})
+	assert.Equal(t, "closed", got[1].Request.Status)
+
+	// Resuming after the first change replays the other two.
+	require.NoError(t, feed.SaveCheckpoint(ctx, "test", got[0].ResumeToken))
+	token, err := feed.LoadCheckpoint(ctx, "test")
+	require.NoError(t, err)
+	resumed := watch(token, 2, nil)
+	assert.Equal(t, got[1].ResumeToken, resumed[0].ResumeToken)
+	assert.Equal(t, got[2].ResumeToken, resumed[1].ResumeToken)
+}
@@ -0,0 +1,94 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository/repositorytest"
+)
+
+// propertyIndexKeys are indexed in the backends that support it, so the
+// property filters run against the indexed expressions too.
+var propertyIndexKeys = []string{"ward", "psk5970:condition_grade", "it's"}
+
+func TestMemoryStorageConformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) *repository.Storage {
+		return repository.NewMemoryStorage()
+	})
+}
+
+func TestSQLiteStorageConformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) *repository.Storage {
+		db, err := repository.NewSQLiteConnection(config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "open311.db")})
+		require.NoError(t, err)
+		_, err = db.MigrateUp(context.Background(), repository.MigrateOptions{})
+		require.NoError(t, err)
+		require.NoError(t, db.EnsurePropertyIndexes(context.Background(), propertyIndexKeys))
+		store := repository.NewSQLiteStorage(db)
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	})
+}
+
+// TestMongoStorageConformance runs the suite against a real MongoDB when
+// MONGODB_TEST_URI is set, using a throwaway database per subtest.
+func TestMongoStorageConformance(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	repositorytest.Run(t, func(t *testing.T) *repository.Storage {
+		cfg := config.MongoDBConfig{
+			URI:              uri,
+			Database:         fmt.Sprintf("open311_conformance_%d", time.Now().UnixNano()),
+			Collection:       "service_requests",
+			ConnectTimeout:   10,
+			OperationTimeout: 10,
+		}
+		db, err := repository.NewMongoDBConnection(cfg)
+		require.NoError(t, err)
+		ctx := context.Background()
+		require.NoError(t, repository.EnsureIndexes(ctx, db, cfg.Collection, propertyIndexKeys))
+		store := repository.NewMongoStorage(db, cfg.Collection)
+		t.Cleanup(func() {
+			_ = db.DropDatabase(ctx)
+			_ = store.Close()
+		})
+		return store
+	})
+}
+
+// TestPostgresStorageConformance runs the suite against a real PostgreSQL with
+// PostGIS when POSTGRES_TEST_DSN is set, using a throwaway schema per subtest.
+func TestPostgresStorageConformance(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN not set")
+	}
+	repositorytest.Run(t, func(t *testing.T) *repository.Storage {
+		cfg := config.PostgresConfig{
+			DSN:            dsn,
+			Schema:         fmt.Sprintf("open311_conformance_%d", time.Now().UnixNano()),
+			ConnectTimeout: 10,
+		}
+		db, err := repository.NewPostgresConnection(cfg)
+		require.NoError(t, err)
+		ctx := context.Background()
+		_, err = db.MigrateUp(ctx, repository.MigrateOptions{})
+		require.NoError(t, err)
+		require.NoError(t, db.EnsurePropertyIndexes(ctx, propertyIndexKeys))
+		store := repository.NewPostgresStorage(db)
+		t.Cleanup(func() {
+			_ = db.DropSchema(ctx)
+			_ = store.Close()
+		})
+		return store
+	})
+}
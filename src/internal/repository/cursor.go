@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sort fields of a service request listing (ServiceRequestQuery.Sort).
+// SortRelevance ranks a q search best match first (newest first among equal
+// scores); it pages by Page only, as a score is no keyset position.
+const (
+	SortRequestedDatetime = "requested_datetime"
+	SortUpdatedDatetime   = "updated_datetime"
+	SortRelevance         = "relevance"
+)
+
+// ValidSort reports whether field is a supported sort field.
+func ValidSort(field string) bool {
+	return keysetSort(field) || field == SortRelevance
+}
+
+// keysetSort reports whether field is a sort field cursors can follow.
+func keysetSort(field string) bool {
+	return field == SortRequestedDatetime || field == SortUpdatedDatetime
+}
+
+// Cursor is a keyset position in a service request listing: the sort value and
+// id of the last request of a page. The next page starts strictly after it,
+// so deep pages cost the same as the first, unlike Page.
+type Cursor struct {
+	Sort      string
+	Ascending bool
+	Value     time.Time
+	ID        string
+}
+
+// cursorJSON is the wire form; the encoded cursor is opaque to clients.
+type cursorJSON struct {
+	Sort  string `json:"s"`
+	Asc   bool   `json:"a,omitempty"`
+	Value int64  `json:"v"`
+	ID    string `json:"i"`
+}
+
+// Encode returns the opaque (URL-safe) form of the cursor.
+func (c Cursor) Encode() string {
+	raw, _ := json.Marshal(cursorJSON{Sort: c.Sort, Asc: c.Ascending, Value: c.Value.UnixMilli(), ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeCursor parses a cursor produced by Encode.
+func DecodeCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var c cursorJSON
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	if !keysetSort(c.Sort) {
+		return Cursor{}, fmt.Errorf("%w: unknown sort %q", ErrInvalidCursor, c.Sort)
+	}
+	if _, err := primitive.ObjectIDFromHex(c.ID); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{Sort: c.Sort, Ascending: c.Asc, Value: time.UnixMilli(c.Value).UTC(), ID: c.ID}, nil
+}
+
+// sortField returns the query's keyset sort field, defaulting to
+// requested_datetime (also for relevance, where it breaks ties, and for
+// unknown fields, so it is always safe to put in a statement).
+func (q ServiceRequestQuery) sortField() string {
+	if !keysetSort(q.Sort) {
+		return SortRequestedDatetime
+	}
+	return q.Sort
+}
+
+// sqlOrder returns the ORDER BY list of the query for the SQL backends and
+// the keyset condition continuing after its cursor, with placeholders for the
+// cursor value and id (empty without a cursor). idColumn is the tie-breaker.
+func (q ServiceRequestQuery) sqlOrder(idColumn, valueArg, idArg string) (orderBy, after string) {
+	field, dir, op := q.sortField(), "DESC", "<"
+	if q.ascending() {
+		dir, op = "ASC", ">"
+	}
+	orderBy = field + " " + dir + ", " + idColumn + " " + dir
+	if q.After != nil {
+		after = "(" + field + ", " + idColumn + ") " + op + " (" + valueArg + ", " + idArg + ")"
+	}
+	return orderBy, after
+}
+
+// ascending reports whether the listing runs oldest first; relevance ranking
+// is always best (then newest) first.
+func (q ServiceRequestQuery) ascending() bool {
+	return q.Ascending && !q.byRelevance()
+}
+
+// sortValue returns the value of field for req.
+func sortValue(req models.ServiceRequest, field string) time.Time {
+	if field == SortUpdatedDatetime {
+		return storedTime(req.UpdatedDatetime)
+	}
+	return storedTime(req.RequestedDatetime)
+}
+
+// CursorAfter returns the cursor continuing the query's listing after req.
+func (q ServiceRequestQuery) CursorAfter(req models.ServiceRequest) Cursor {
+	field := q.sortField()
+	return Cursor{Sort: field, Ascending: q.Ascending, Value: sortValue(req, field), ID: req.ID}
+}
+
+// PageSize returns the number of results a full page of the query holds.
+func (q ServiceRequestQuery) PageSize() int {
+	_, limit := q.window()
+	return limit
+}
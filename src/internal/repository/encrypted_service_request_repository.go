@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// FieldCipher encrypts and decrypts individual string fields (implemented by
+// privacy.AESCipher). Encrypt("") must return "" so absent fields stay absent.
+type FieldCipher interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(value string) (string, error)
+}
+
+// contactPatchFields are the PatchableServiceRequestFields holding reporter
+// contact data.
+var contactPatchFields = []string{"email", "first_name", "last_name", "phone", "device_id", "account_id"}
+
+var _ ServiceRequestRepository = (*EncryptedServiceRequestRepository)(nil)
+
+// EncryptedServiceRequestRepository decorates a ServiceRequestRepository so the
+// reporter contact fields are encrypted before they are stored and decrypted
+// when read back. Everything else (Delete, PurgeDeleted) passes through
+// unchanged, so it works with any backend.
+type EncryptedServiceRequestRepository struct {
+	ServiceRequestRepository
+	cipher FieldCipher
+}
+
+// NewEncryptedServiceRequestRepository wraps inner with contact-field
+// encryption.
+func NewEncryptedServiceRequestRepository(inner ServiceRequestRepository, cipher FieldCipher) *EncryptedServiceRequestRepository {
+	return &EncryptedServiceRequestRepository{ServiceRequestRepository: inner, cipher: cipher}
+}
+
+func (r *EncryptedServiceRequestRepository) encrypt(req *models.ServiceRequest) error {
+	for _, f := range req.ContactFields() {
+		v, err := r.cipher.Encrypt(*f)
+		if err != nil {
+			return fmt.Errorf("encrypting contact field: %w", err)
+		}
+		*f = v
+	}
+	return nil
+}
+
+// decrypt fails with ErrDatabase: an undecryptable value means a wrong key or
+// corrupted data, not a client error.
+func (r *EncryptedServiceRequestRepository) decrypt(req *models.ServiceRequest) error {
+	for _, f := range req.ContactFields() {
+		v, err := r.cipher.Decrypt(*f)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		*f = v
+	}
+	return nil
+}
+
+func (r *EncryptedServiceRequestRepository) decryptAll(reqs []models.ServiceRequest, err error) ([]models.ServiceRequest, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i := range reqs {
+		if err := r.decrypt(&reqs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return reqs, nil
+}
+
+func (r *EncryptedServiceRequestRepository) decryptOne(req models.ServiceRequest, err error) (models.ServiceRequest, error) {
+	if err != nil {
+		return models.ServiceRequest{}, err
+	}
+	if err := r.decrypt(&req); err != nil {
+		return models.ServiceRequest{}, err
+	}
+	return req, nil
+}
+
+func (r *EncryptedServiceRequestRepository) Find(ctx context.Context, q ServiceRequestQuery) ([]models.ServiceRequest, error) {
+	return r.decryptAll(r.ServiceRequestRepository.Find(ctx, q))
+}
+
+func (r *EncryptedServiceRequestRepository) Each(ctx context.Context, q ServiceRequestQuery, fn func(models.ServiceRequest) error) error {
+	return r.ServiceRequestRepository.Each(ctx, q, func(req models.ServiceRequest) error {
+		if err := r.decrypt(&req); err != nil {
+			return err
+		}
+		return fn(req)
+	})
+}
+
+func (r *EncryptedServiceRequestRepository) FindByServiceRequestID(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error) {
+	return r.decryptOne(r.ServiceRequestRepository.FindByServiceRequestID(ctx, serviceRequestID))
+}
+
+func (r *EncryptedServiceRequestRepository) FindByFeature(ctx context.Context, featureID, featureGuid string) ([]models.ServiceRequest, error) {
+	return r.decryptAll(r.ServiceRequestRepository.FindByFeature(ctx, featureID, featureGuid))
+}
+
+func (r *EncryptedServiceRequestRepository) FindByOrganization(ctx context.Context, organizationID string) ([]models.ServiceRequest, error) {
+	return r.decryptAll(r.ServiceRequestRepository.FindByOrganization(ctx, organizationID))
+}
+
+func (r *EncryptedServiceRequestRepository) Create(ctx context.Context, req models.ServiceRequest) (models.ServiceRequest, error) {
+	if err := r.encrypt(&req); err != nil {
+		return models.ServiceRequest{}, err
+	}
+	return r.decryptOne(r.ServiceRequestRepository.Create(ctx, req))
+}
+
+func (r *EncryptedServiceRequestRepository) Upsert(ctx context.Context, req models.ServiceRequest, pre Precondition) (models.ServiceRequest, bool, error) {
+	if err := r.encrypt(&req); err != nil {
+		return models.ServiceRequest{}, false, err
+	}
+	stored, created, err := r.ServiceRequestRepository.Upsert(ctx, req, pre)
+	stored, err = r.decryptOne(stored, err)
+	return stored, created, err
+}
+
+func (r *EncryptedServiceRequestRepository) BulkUpsert(ctx context.Context, reqs []models.ServiceRequest, opts BulkUpsertOptions) (BulkUpsertResult, error) {
+	encrypted := make([]models.ServiceRequest, len(reqs))
+	for i, req := range reqs {
+		if err := r.encrypt(&req); err != nil {
+			return BulkUpsertResult{}, err
+		}
+		encrypted[i] = req
+	}
+	return r.ServiceRequestRepository.BulkUpsert(ctx, encrypted, opts)
+}
+
+func (r *EncryptedServiceRequestRepository) Patch(ctx context.Context, serviceRequestID string, patch ServiceRequestPatch, pre Precondition) (models.ServiceRequest, error) {
+	fields := make(map[string]interface{}, len(patch.Fields))
+	for k, v := range patch.Fields {
+		fields[k] = v
+	}
+	for _, name := range contactPatchFields {
+		if s, ok := fields[name].(string); ok {
+			enc, err := r.cipher.Encrypt(s)
+			if err != nil {
+				return models.ServiceRequest{}, fmt.Errorf("encrypting contact field: %w", err)
+			}
+			fields[name] = enc
+		}
+	}
+	patch.Fields = fields
+	return r.decryptOne(r.ServiceRequestRepository.Patch(ctx, serviceRequestID, patch, pre))
+}
+
+func (r *EncryptedServiceRequestRepository) Erase(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error) {
+	return r.decryptOne(r.ServiceRequestRepository.Erase(ctx, serviceRequestID))
+}
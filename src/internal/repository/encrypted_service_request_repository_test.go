@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// prefixCipher is a reversible stand-in for privacy.AESCipher.
+type prefixCipher struct{}
+
+func (prefixCipher) Encrypt(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	return "x:" + s, nil
+}
+
+func (prefixCipher) Decrypt(s string) (string, error) { return strings.TrimPrefix(s, "x:"), nil }
+
+// storeRepo keeps the last written request, as stored.
+type storeRepo struct {
+	ServiceRequestRepository
+	stored models.ServiceRequest
+	patch  ServiceRequestPatch
+}
+
+func (s *storeRepo) Create(ctx context.Context, req models.ServiceRequest) (models.ServiceRequest, error) {
+	s.stored = req
+	return req, nil
+}
+
+func (s *storeRepo) FindByServiceRequestID(ctx context.Context, id string) (models.ServiceRequest, error) {
+	return s.stored, nil
+}
+
+func (s *storeRepo) Patch(ctx context.Context, id string, patch ServiceRequestPatch, pre Precondition) (models.ServiceRequest, error) {
+	s.patch = patch
+	return s.stored, nil
+}
+
+func TestEncryptedServiceRequestRepository(t *testing.T) {
+	inner := &storeRepo{}
+	repo := NewEncryptedServiceRequestRepository(inner, prefixCipher{})
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, models.ServiceRequest{ServiceRequestID: "sr-1", Email: "jane@example.com", Description: "pothole"})
+	assert.NoError(t, err)
+	assert.Equal(t, "jane@example.com", created.Email)
+	assert.Equal(t, "x:jane@example.com", inner.stored.Email, "stored encrypted")
+	assert.Equal(t, "", inner.stored.Phone, "absent stays absent")
+	assert.Equal(t, "pothole", inner.stored.Description, "non-contact fields untouched")
+
+	got, err := repo.FindByServiceRequestID(ctx, "sr-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "jane@example.com", got.Email)
+
+	_, err = repo.Patch(ctx, "sr-1", ServiceRequestPatch{Fields: map[string]interface{}{"phone": "555-0100", "status": "closed", "email": nil}}, Precondition{})
+	assert.NoError(t, err)
+	assert.Equal(t, "x:555-0100", inner.patch.Fields["phone"])
+	assert.Equal(t, "closed", inner.patch.Fields["status"])
+	assert.Nil(t, inner.patch.Fields["email"])
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// earthRadiusMeters is the mean Earth radius used for radius queries (the value
+// MongoDB's $centerSphere examples use).
+const earthRadiusMeters = 6378100.0
+
+// GeoRadius selects service requests within RadiusMeters of a WGS84 point.
+type GeoRadius struct {
+	Lat          float64
+	Long         float64
+	RadiusMeters float64
+}
+
+// GeoBBox selects service requests inside a WGS84 bounding box, in degrees.
+// Boxes crossing the antimeridian are not supported.
+type GeoBBox struct {
+	MinLong float64
+	MinLat  float64
+	MaxLong float64
+	MaxLat  float64
+}
+
+// ParseGeoBBox parses minLong,minLat,maxLong,maxLat (WGS84 degrees, the OGC
+// axis order), the form of the bbox query parameter.
+func ParseGeoBBox(s string) (GeoBBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return GeoBBox{}, errors.New("bbox must be minLong,minLat,maxLong,maxLat")
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return GeoBBox{}, errors.New("bbox must be minLong,minLat,maxLong,maxLat")
+		}
+		v[i] = f
+	}
+	b := GeoBBox{MinLong: v[0], MinLat: v[1], MaxLong: v[2], MaxLat: v[3]}
+	if b.MinLong >= b.MaxLong || b.MinLat >= b.MaxLat ||
+		b.MinLong < -180 || b.MaxLong > 180 || b.MinLat < -90 || b.MaxLat > 90 {
+		return GeoBBox{}, errors.New("bbox must be minLong,minLat,maxLong,maxLat with min < max")
+	}
+	return b, nil
+}
+
+// Contains reports whether the point lat/long lies within the radius
+// (great-circle distance).
+func (g GeoRadius) Contains(lat, long float64) bool {
+	return haversineMeters(g.Lat, g.Long, lat, long) <= g.RadiusMeters
+}
+
+// Bounds returns a box enclosing the radius, for pre-filtering with a spatial
+// index before the exact Contains check. Longitudes are clamped rather than
+// wrapped at the antimeridian.
+func (g GeoRadius) Bounds() GeoBBox {
+	const deg = 180 / math.Pi
+	delta := g.RadiusMeters / earthRadiusMeters
+	b := GeoBBox{
+		MinLat:  math.Max(-90, g.Lat-delta*deg),
+		MaxLat:  math.Min(90, g.Lat+delta*deg),
+		MinLong: -180,
+		MaxLong: 180,
+	}
+	// The widest longitude span of a spherical cap of angular radius delta.
+	if s := math.Sin(delta) / math.Cos(g.Lat/deg); delta < math.Pi/2 && s < 1 {
+		dLong := math.Asin(s) * deg
+		b.MinLong = math.Max(-180, g.Long-dLong)
+		b.MaxLong = math.Min(180, g.Long+dLong)
+	}
+	return b
+}
+
+// Contains reports whether the point lat/long lies inside the box, edges
+// included.
+func (b GeoBBox) Contains(lat, long float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && long >= b.MinLong && long <= b.MaxLong
+}
+
+// haversineMeters is the great-circle distance between two points.
+func haversineMeters(lat1, long1, lat2, long2 float64) float64 {
+	const rad = math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLong := (long2 - long1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// hasLocation mirrors the stored-location rule: a request has a point only when
+// lat or long is non-zero.
+func hasLocation(lat, long float64) bool {
+	return lat != 0 || long != 0
+}
@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ImportJobRepository stores background import jobs: their state, progress
+// and the lease of the worker running them.
+type ImportJobRepository interface {
+	Repository
+	// Create stores a job, assigning its id, created_at and updated_at.
+	Create(ctx context.Context, job models.ImportJob) (models.ImportJob, error)
+	FindByID(ctx context.Context, id string) (models.ImportJob, error)
+	// Claim takes the oldest queued job, or a running job whose lease lapsed
+	// before now (its worker died), and atomically marks it running under a
+	// new attempt leased until now+lease; started_at is set on the first
+	// claim. ErrNotFound when no job is waiting.
+	Claim(ctx context.Context, now time.Time, lease time.Duration) (models.ImportJob, error)
+	// Update records the progress or outcome of a claimed job: it stores the
+	// status, counts, samples, error, lease_until and finished_at of job and
+	// returns the stored job (with cancel_requested). It fails with
+	// ErrInvalidState unless the job is still running under job.Attempts,
+	// i.e. when another worker took the claim over.
+	Update(ctx context.Context, job models.ImportJob) (models.ImportJob, error)
+	// Cancel cancels a queued job, or sets cancel_requested on a running one
+	// for its worker to stop at the next batch. ErrInvalidState when the job
+	// has finished.
+	Cancel(ctx context.Context, id string) (models.ImportJob, error)
+	// Resume queues a failed or cancelled job again, keeping its progress.
+	// ErrInvalidState for jobs in any other state.
+	Resume(ctx context.Context, id string) (models.ImportJob, error)
+}
+
+// samplesJSON encodes the samples of a job for the SQL backends' JSON column.
+func samplesJSON(samples []string) string {
+	if len(samples) == 0 {
+		return "[]"
+	}
+	raw, _ := json.Marshal(samples) // a []string always encodes
+	return string(raw)
+}
+
+// parseSamples decodes the JSON column samplesJSON writes.
+func parseSamples(raw []byte) ([]string, error) {
+	var samples []string
+	if err := json.Unmarshal(raw, &samples); err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, nil
+	}
+	return samples, nil
+}
+
+// importJobsCollection is the collection of the MongoDB ImportJobRepository.
+const importJobsCollection = "import_jobs"
+
+// importJobDoc is the persistence representation of an ImportJob.
+type importJobDoc struct {
+	ID              primitive.ObjectID  `bson:"_id,omitempty"`
+	Status          string              `bson:"status"`
+	Format          string              `bson:"format"`
+	Dictionary      string              `bson:"dictionary,omitempty"`
+	OnlyIfNewer     bool                `bson:"only_if_newer"`
+	File            string              `bson:"file"`
+	Size            int64               `bson:"size"`
+	Counts          models.ImportCounts `bson:"counts"`
+	Samples         []string            `bson:"samples,omitempty"`
+	Error           string              `bson:"error,omitempty"`
+	CancelRequested bool                `bson:"cancel_requested,omitempty"`
+	Attempts        int                 `bson:"attempts"`
+	CreatedAt       time.Time           `bson:"created_at"`
+	UpdatedAt       time.Time           `bson:"updated_at"`
+	StartedAt       *time.Time          `bson:"started_at,omitempty"`
+	FinishedAt      *time.Time          `bson:"finished_at,omitempty"`
+	LeaseUntil      *time.Time          `bson:"lease_until,omitempty"`
+}
+
+func (d importJobDoc) toModel() models.ImportJob {
+	return models.ImportJob{
+		ID:              d.ID.Hex(),
+		Status:          d.Status,
+		Format:          d.Format,
+		Dictionary:      d.Dictionary,
+		OnlyIfNewer:     d.OnlyIfNewer,
+		File:            d.File,
+		Size:            d.Size,
+		Counts:          d.Counts,
+		Samples:         d.Samples,
+		Error:           d.Error,
+		CancelRequested: d.CancelRequested,
+		Attempts:        d.Attempts,
+		CreatedAt:       d.CreatedAt.UTC(),
+		UpdatedAt:       d.UpdatedAt.UTC(),
+		StartedAt:       storedTimePtr(d.StartedAt),
+		FinishedAt:      storedTimePtr(d.FinishedAt),
+		LeaseUntil:      storedTimePtr(d.LeaseUntil),
+	}
+}
+
+// MongoImportJobRepository implements ImportJobRepository on MongoDB.
+type MongoImportJobRepository struct {
+	jobs *mongo.Collection
+}
+
+// NewMongoImportJobRepository creates a MongoImportJobRepository.
+func NewMongoImportJobRepository(db *MongoDB) ImportJobRepository {
+	return &MongoImportJobRepository{jobs: db.GetCollection(importJobsCollection)}
+}
+
+// Create stores a job, assigning its id, created_at and updated_at.
+func (r *MongoImportJobRepository) Create(ctx context.Context, job models.ImportJob) (models.ImportJob, error) {
+	now := storedTime(time.Now())
+	doc := importJobDoc{
+		ID:              primitive.NewObjectID(),
+		Status:          job.Status,
+		Format:          job.Format,
+		Dictionary:      job.Dictionary,
+		OnlyIfNewer:     job.OnlyIfNewer,
+		File:            job.File,
+		Size:            job.Size,
+		Counts:          job.Counts,
+		Samples:         job.Samples,
+		Error:           job.Error,
+		CancelRequested: job.CancelRequested,
+		Attempts:        job.Attempts,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		StartedAt:       storedTimePtr(job.StartedAt),
+		FinishedAt:      storedTimePtr(job.FinishedAt),
+		LeaseUntil:      storedTimePtr(job.LeaseUntil),
+	}
+	if _, err := r.jobs.InsertOne(ctx, doc); err != nil {
+		return models.ImportJob{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return doc.toModel(), nil
+}
+
+// FindByID returns the job with the given id.
+func (r *MongoImportJobRepository) FindByID(ctx context.Context, id string) (models.ImportJob, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.ImportJob{}, ErrInvalidID
+	}
+	return r.findOne(ctx, oid)
+}
+
+func (r *MongoImportJobRepository) findOne(ctx context.Context, oid primitive.ObjectID) (models.ImportJob, error) {
+	var doc importJobDoc
+	if err := r.jobs.FindOne(ctx, bson.M{"_id": oid}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.ImportJob{}, ErrNotFound
+		}
+		return models.ImportJob{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return doc.toModel(), nil
+}
+
+// transition applies update to the job when it matches filter and returns
+// the updated job. A job that exists but does not match is ErrInvalidState.
+func (r *MongoImportJobRepository) transition(ctx context.Context, oid primitive.ObjectID, filter bson.M, update interface{}) (models.ImportJob, error) {
+	filter["_id"] = oid
+	var doc importJobDoc
+	err := r.jobs.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := r.findOne(ctx, oid); err != nil {
+			return models.ImportJob{}, err
+		}
+		return models.ImportJob{}, ErrInvalidState
+	}
+	if err != nil {
+		return models.ImportJob{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return doc.toModel(), nil
+}
+
+// Claim claims with one findOneAndUpdate, so concurrent workers never claim
+// the same job. The update is a pipeline to keep an earlier started_at.
+func (r *MongoImportJobRepository) Claim(ctx context.Context, now time.Time, lease time.Duration) (models.ImportJob, error) {
+	at := storedTime(now)
+	var doc importJobDoc
+	err := r.jobs.FindOneAndUpdate(ctx,
+		bson.M{"$or": bson.A{
+			bson.M{"status": models.JobQueued},
+			bson.M{"status": models.JobRunning, "lease_until": bson.M{"$lt": at}},
+		}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"status":      models.JobRunning,
+			"attempts":    bson.M{"$add": bson.A{"$attempts", 1}},
+			"lease_until": storedTime(now.Add(lease)),
+			"started_at":  bson.M{"$ifNull": bson.A{"$started_at", at}},
+			"updated_at":  at,
+		}}}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.ImportJob{}, ErrNotFound
+	}
+	if err != nil {
+		return models.ImportJob{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return doc.toModel(), nil
+}
+
+// Update records the progress or outcome of a claimed job.
+func (r *MongoImportJobRepository) Update(ctx context.Context, job models.ImportJob) (models.ImportJob, error) {
+	oid, err := primitive.ObjectIDFromHex(job.ID)
+	if err != nil {
+		return models.ImportJob{}, ErrInvalidID
+	}
+	set := bson.M{
+		"status":     job.Status,
+		"counts":     job.Counts,
+		"samples":    job.Samples,
+		"error":      job.Error,
+		"updated_at": storedTime(time.Now()),
+	}
+	unset := bson.M{}
+	for field, t := range map[string]*time.Time{"lease_until": job.LeaseUntil, "finished_at": job.FinishedAt} {
+		if t != nil {
+			set[field] = storedTime(*t)
+		} else {
+			unset[field] = ""
+		}
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	return r.transition(ctx, oid, bson.M{"status": models.JobRunning, "attempts": job.Attempts}, update)
+}
+
+// Cancel cancels a queued job or asks a running one to stop.
+func (r *MongoImportJobRepository) Cancel(ctx context.Context, id string) (models.ImportJob, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.ImportJob{}, ErrInvalidID
+	}
+	now := storedTime(time.Now())
+	job, err := r.transition(ctx, oid, bson.M{"status": models.JobQueued},
+		bson.M{"$set": bson.M{"status": models.JobCancelled, "finished_at": now, "updated_at": now}})
+	if !errors.Is(err, ErrInvalidState) {
+		return job, err
+	}
+	return r.transition(ctx, oid, bson.M{"status": models.JobRunning},
+		bson.M{"$set": bson.M{"cancel_requested": true, "updated_at": now}})
+}
+
+// Resume queues a failed or cancelled job again.
+func (r *MongoImportJobRepository) Resume(ctx context.Context, id string) (models.ImportJob, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.ImportJob{}, ErrInvalidID
+	}
+	return r.transition(ctx, oid,
+		bson.M{"status": bson.M{"$in": bson.A{models.JobFailed, models.JobCancelled}}},
+		bson.M{
+			"$set":   bson.M{"status": models.JobQueued, "updated_at": storedTime(time.Now())},
+			"$unset": bson.M{"error": "", "cancel_requested": "", "finished_at": "", "lease_until": ""},
+		})
+}
+
+// Close is a no-op; the connection is closed with the Storage.
+func (r *MongoImportJobRepository) Close() error {
+	return nil
+}
@@ -11,14 +11,23 @@ import (
 
 // EnsureIndexes creates the indexes the application relies on. It is idempotent:
 // re-creating an existing index is a no-op. serviceRequestsCollection is the
-// configured collection name for service requests (e.g. "open311-boston").
+// configured collection name for service requests (e.g. "open311-boston");
+// propertyIndexKeys are the properties keys the property filters query often
+// enough to index (PROPERTY_INDEX_KEYS).
+//
+// EnsureIndexes only ever adds: renames, backfills and dropped indexes are
+// versioned migrations (MongoMigrator), applied before it on startup.
 //
 // Note: imported documents must carry a GeoJSON `location` field to be covered
-// by the 2dsphere index; documents missing it are simply not geo-indexed.
-func EnsureIndexes(ctx context.Context, db *MongoDB, serviceRequestsCollection string) error {
+// by the 2dsphere index; documents missing it are simply not geo-indexed
+// (migration 2 backfills it from lat/long).
+func EnsureIndexes(ctx context.Context, db *MongoDB, serviceRequestsCollection string, propertyIndexKeys []string) error {
 	if serviceRequestsCollection == "" {
 		serviceRequestsCollection = "service_requests"
 	}
+	if err := validPropertyIndexKeys(propertyIndexKeys); err != nil {
+		return err
+	}
 
 	serviceRequestIndexes := []mongo.IndexModel{
 		{
@@ -32,8 +41,20 @@ func EnsureIndexes(ctx context.Context, db *MongoDB, serviceRequestsCollection s
 		{Keys: bson.D{{Key: "status", Value: 1}}, Options: options.Index().SetName("status")},
 		{Keys: bson.D{{Key: "organizationId", Value: 1}}, Options: options.Index().SetName("organizationId")},
 		{Keys: bson.D{{Key: "featureId", Value: 1}}, Options: options.Index().SetName("featureId")},
-		{Keys: bson.D{{Key: "requested_datetime", Value: -1}}, Options: options.Index().SetName("requested_datetime")},
-		{Keys: bson.D{{Key: "updated_datetime", Value: -1}}, Options: options.Index().SetName("updated_datetime")},
+		// Listing sorts, cursors and date ranges: (field, _id), walked in
+		// either direction.
+		{Keys: bson.D{{Key: "requested_datetime", Value: -1}, {Key: "_id", Value: -1}}, Options: options.Index().SetName("requested_datetime_id")},
+		{Keys: bson.D{{Key: "updated_datetime", Value: -1}, {Key: "_id", Value: -1}}, Options: options.Index().SetName("updated_datetime_id")},
+		textSearchIndex(),
+		// Sparse: only tombstones carry deleted_at, so the purge job's scan stays small.
+		{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true).SetName("deleted_at")},
+	}
+	for _, k := range propertyIndexKeys {
+		// Sparse: most requests carry only some of the keys.
+		serviceRequestIndexes = append(serviceRequestIndexes, mongo.IndexModel{
+			Keys:    bson.D{{Key: "properties." + k, Value: 1}},
+			Options: options.Index().SetSparse(true).SetName(propertyIndexName(k)),
+		})
 	}
 	if _, err := db.GetCollection(serviceRequestsCollection).Indexes().CreateMany(ctx, serviceRequestIndexes); err != nil {
 		return fmt.Errorf("creating indexes on %q: %w", serviceRequestsCollection, err)
@@ -48,12 +69,60 @@ func EnsureIndexes(ctx context.Context, db *MongoDB, serviceRequestsCollection s
 	}
 
 	// users: unique email (sparse so documents without an email are allowed)
-	if _, err := db.GetCollection("Users").Indexes().CreateOne(ctx, mongo.IndexModel{
+	if _, err := db.GetCollection(usersCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys:    bson.D{{Key: "email", Value: 1}},
 		Options: options.Index().SetUnique(true).SetSparse(true).SetName("uniq_email"),
 	}); err != nil {
-		return fmt.Errorf("creating indexes on \"Users\": %w", err)
+		return fmt.Errorf("creating indexes on %q: %w", usersCollection, err)
+	}
+
+	// rate_limits: shared token buckets expire once they would be full again.
+	if _, err := db.GetCollection(rateLimitCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expireAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0).SetName("ttl_expireAt"),
+	}); err != nil {
+		return fmt.Errorf("creating indexes on %q: %w", rateLimitCollection, err)
+	}
+
+	// webhook_deliveries: the due-queue scan and the per-subscription history.
+	if _, err := db.GetCollection(webhookDeliveriesCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("status_next_attempt_at"),
+		},
+		{
+			Keys:    bson.D{{Key: "subscription_id", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("subscription_id_id"),
+		},
+	}); err != nil {
+		return fmt.Errorf("creating indexes on %q: %w", webhookDeliveriesCollection, err)
+	}
+
+	// import_jobs: the claim scan.
+	if _, err := db.GetCollection(importJobsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "_id", Value: 1}},
+		Options: options.Index().SetName("status_id"),
+	}); err != nil {
+		return fmt.Errorf("creating indexes on %q: %w", importJobsCollection, err)
 	}
 
 	return nil
 }
+
+// textSearchIndex is the text index behind the q filter, over the fields and
+// relevance weights of textSearchFields. A collection has at most one text
+// index, so changing the fields means dropping "text_search" first.
+func textSearchIndex() mongo.IndexModel {
+	keys, weights := bson.D{}, bson.D{}
+	for _, f := range textSearchFields {
+		keys = append(keys, bson.E{Key: f.name, Value: "text"})
+		weights = append(weights, bson.E{Key: f.name, Value: f.weight})
+	}
+	return mongo.IndexModel{
+		Keys: keys,
+		// language_override names a field no document has, so a "language"
+		// property never switches the stemmer.
+		Options: options.Index().SetName("text_search").SetWeights(weights).
+			SetDefaultLanguage("english").SetLanguageOverride("_text_language"),
+	}
+}
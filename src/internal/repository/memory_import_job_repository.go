@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryImportJobRepository is an in-process ImportJobRepository mirroring
+// the MongoDB one (ObjectID-style hex ids, claimed oldest first by id).
+type MemoryImportJobRepository struct {
+	mu   sync.Mutex
+	jobs []models.ImportJob
+}
+
+// NewMemoryImportJobRepository creates an empty in-memory repository.
+func NewMemoryImportJobRepository() *MemoryImportJobRepository {
+	return &MemoryImportJobRepository{}
+}
+
+// cloneImportJob copies the slice and pointer fields, so callers never share
+// state with the repository.
+func cloneImportJob(j models.ImportJob) models.ImportJob {
+	j.Samples = append([]string(nil), j.Samples...)
+	j.StartedAt = storedTimePtr(j.StartedAt)
+	j.FinishedAt = storedTimePtr(j.FinishedAt)
+	j.LeaseUntil = storedTimePtr(j.LeaseUntil)
+	return j
+}
+
+// find returns the stored job with the given id; the caller holds the lock.
+func (r *MemoryImportJobRepository) find(id string) (*models.ImportJob, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, ErrInvalidID
+	}
+	for i := range r.jobs {
+		if r.jobs[i].ID == id {
+			return &r.jobs[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Create stores a job, assigning its id, created_at and updated_at.
+func (r *MemoryImportJobRepository) Create(ctx context.Context, job models.ImportJob) (models.ImportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job.ID = primitive.NewObjectID().Hex()
+	job.CreatedAt = storedTime(time.Now())
+	job.UpdatedAt = job.CreatedAt
+	job = cloneImportJob(job)
+	r.jobs = append(r.jobs, job)
+	return cloneImportJob(job), nil
+}
+
+// FindByID returns the job with the given id.
+func (r *MemoryImportJobRepository) FindByID(ctx context.Context, id string) (models.ImportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, err := r.find(id)
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+	return cloneImportJob(*job), nil
+}
+
+// Claim claims the oldest waiting job under the lock.
+func (r *MemoryImportJobRepository) Claim(ctx context.Context, now time.Time, lease time.Duration) (models.ImportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.jobs {
+		job := &r.jobs[i]
+		lapsed := job.Status == models.JobRunning && job.LeaseUntil != nil && job.LeaseUntil.Before(now)
+		if job.Status != models.JobQueued && !lapsed {
+			continue
+		}
+		at, until := storedTime(now), storedTime(now.Add(lease))
+		job.Status = models.JobRunning
+		job.Attempts++
+		job.LeaseUntil = &until
+		if job.StartedAt == nil {
+			job.StartedAt = &at
+		}
+		job.UpdatedAt = at
+		return cloneImportJob(*job), nil
+	}
+	return models.ImportJob{}, ErrNotFound
+}
+
+// Update records the progress or outcome of a claimed job.
+func (r *MemoryImportJobRepository) Update(ctx context.Context, job models.ImportJob) (models.ImportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, err := r.find(job.ID)
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+	if stored.Status != models.JobRunning || stored.Attempts != job.Attempts {
+		return models.ImportJob{}, ErrInvalidState
+	}
+	stored.Status = job.Status
+	stored.Counts = job.Counts
+	stored.Samples = append([]string(nil), job.Samples...)
+	stored.Error = job.Error
+	stored.LeaseUntil = storedTimePtr(job.LeaseUntil)
+	stored.FinishedAt = storedTimePtr(job.FinishedAt)
+	stored.UpdatedAt = storedTime(time.Now())
+	return cloneImportJob(*stored), nil
+}
+
+// Cancel cancels a queued job or asks a running one to stop.
+func (r *MemoryImportJobRepository) Cancel(ctx context.Context, id string) (models.ImportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, err := r.find(id)
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+	now := storedTime(time.Now())
+	switch job.Status {
+	case models.JobQueued:
+		job.Status = models.JobCancelled
+		job.FinishedAt = &now
+	case models.JobRunning:
+		job.CancelRequested = true
+	default:
+		return models.ImportJob{}, ErrInvalidState
+	}
+	job.UpdatedAt = now
+	return cloneImportJob(*job), nil
+}
+
+// Resume queues a failed or cancelled job again.
+func (r *MemoryImportJobRepository) Resume(ctx context.Context, id string) (models.ImportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, err := r.find(id)
+	if err != nil {
+		return models.ImportJob{}, err
+	}
+	if job.Status != models.JobFailed && job.Status != models.JobCancelled {
+		return models.ImportJob{}, ErrInvalidState
+	}
+	job.Status = models.JobQueued
+	job.Error = ""
+	job.CancelRequested = false
+	job.FinishedAt, job.LeaseUntil = nil, nil
+	job.UpdatedAt = storedTime(time.Now())
+	return cloneImportJob(*job), nil
+}
+
+// Close is a no-op.
+func (r *MemoryImportJobRepository) Close() error {
+	return nil
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryServiceRepository is an in-process ServiceRepository mirroring the
+// MongoDB one: ObjectID-style hex ids, insertion order and a unique
+// service_code.
+type MemoryServiceRepository struct {
+	mu       sync.RWMutex
+	services []models.Service
+}
+
+// NewMemoryServiceRepository creates an empty in-memory repository.
+func NewMemoryServiceRepository() *MemoryServiceRepository {
+	return &MemoryServiceRepository{}
+}
+
+func cloneService(s models.Service) models.Service {
+	if s.Attributes != nil {
+		s.Attributes = append([]models.ServiceAttribute(nil), s.Attributes...)
+	}
+	return s
+}
+
+// index returns the position of the service with the given id, or an error
+// when the id is malformed or unknown. Callers hold the lock.
+func (r *MemoryServiceRepository) index(id string) (int, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return -1, ErrInvalidID
+	}
+	for i, s := range r.services {
+		if s.ID == id {
+			return i, nil
+		}
+	}
+	return -1, ErrNotFound
+}
+
+// FindAll returns all services in insertion order.
+func (r *MemoryServiceRepository) FindAll(ctx context.Context) ([]models.Service, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	services := make([]models.Service, 0, len(r.services))
+	for _, s := range r.services {
+		services = append(services, cloneService(s))
+	}
+	return services, nil
+}
+
+// FindByID returns the service with the given id.
+func (r *MemoryServiceRepository) FindByID(ctx context.Context, id string) (models.Service, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i, err := r.index(id)
+	if err != nil {
+		return models.Service{}, err
+	}
+	return cloneService(r.services[i]), nil
+}
+
+// Create adds a service, assigning its id and timestamps.
+func (r *MemoryServiceRepository) Create(ctx context.Context, service models.Service) (models.Service, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.services {
+		if s.ServiceCode == service.ServiceCode {
+			return models.Service{}, fmt.Errorf("%w: duplicate service_code %q", ErrDatabase, service.ServiceCode)
+		}
+	}
+	now := storedTime(time.Now())
+	service.ID = primitive.NewObjectID().Hex()
+	service.CreatedAt = now
+	service.UpdatedAt = now
+	r.services = append(r.services, cloneService(service))
+	return cloneService(service), nil
+}
+
+// Update replaces the mutable fields of a service; service_code and createdAt
+// are kept, as in the MongoDB implementation.
+func (r *MemoryServiceRepository) Update(ctx context.Context, service models.Service) (models.Service, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, err := r.index(service.ID)
+	if err != nil {
+		return models.Service{}, err
+	}
+	stored := r.services[i]
+	stored.ServiceName = service.ServiceName
+	stored.Description = service.Description
+	stored.Metadata = service.Metadata
+	stored.Type = service.Type
+	stored.Keywords = service.Keywords
+	stored.Group = service.Group
+	stored.Attributes = service.Attributes
+	stored.UpdatedAt = storedTime(time.Now())
+	r.services[i] = cloneService(stored)
+	return cloneService(stored), nil
+}
+
+// Delete removes a service.
+func (r *MemoryServiceRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, err := r.index(id)
+	if err != nil {
+		return err
+	}
+	r.services = append(r.services[:i], r.services[i+1:]...)
+	return nil
+}
+
+// Close is a no-op.
+func (r *MemoryServiceRepository) Close() error {
+	return nil
+}
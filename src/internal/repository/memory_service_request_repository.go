@@ -0,0 +1,527 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryServiceRequestRepository is an in-process ServiceRequestRepository with
+// the same semantics as the MongoDB one (defaults, versions, preconditions,
+// tombstones, erasure, filters, pagination and geo queries). Data lives only
+// as long as the process; it backs STORAGE_BACKEND=memory, demos and tests.
+type MemoryServiceRequestRepository struct {
+	mu       sync.RWMutex
+	requests map[string]models.ServiceRequest // keyed by service_request_id
+}
+
+// NewMemoryServiceRequestRepository creates an empty in-memory repository.
+func NewMemoryServiceRequestRepository() *MemoryServiceRequestRepository {
+	return &MemoryServiceRequestRepository{requests: make(map[string]models.ServiceRequest)}
+}
+
+// storedTime normalizes a timestamp the way MongoDB stores it: UTC with
+// millisecond precision, so both backends return identical values.
+func storedTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Millisecond)
+}
+
+// cloneServiceRequest deep-copies req so callers never share maps or pointers
+// with the store, normalizing its timestamps on the way.
+func cloneServiceRequest(req models.ServiceRequest) models.ServiceRequest {
+	c := req
+	c.RequestedDatetime = storedTime(req.RequestedDatetime)
+	c.UpdatedDatetime = storedTime(req.UpdatedDatetime)
+	c.ExpectedDatetime = storedTime(req.ExpectedDatetime)
+	if req.FeatureID != nil && *req.FeatureID != "" {
+		v := *req.FeatureID
+		c.FeatureID = &v
+	} else {
+		c.FeatureID = nil
+	}
+	if req.FeatureGuid != nil && *req.FeatureGuid != "" {
+		v := *req.FeatureGuid
+		c.FeatureGuid = &v
+	} else {
+		c.FeatureGuid = nil
+	}
+	if req.DeletedAt != nil {
+		v := storedTime(*req.DeletedAt)
+		c.DeletedAt = &v
+	}
+	if req.ErasedAt != nil {
+		v := storedTime(*req.ErasedAt)
+		c.ErasedAt = &v
+	}
+	c.Properties = nil
+	if len(req.Properties) > 0 {
+		c.Properties = make(models.Properties, len(req.Properties))
+		for k, v := range req.Properties {
+			c.Properties[k] = v
+		}
+	}
+	return c
+}
+
+// scrubPersonal empties the personalServiceRequestFields of req.
+func scrubPersonal(req *models.ServiceRequest) {
+	req.Description = ""
+	req.MediaURL = ""
+	for _, f := range req.ContactFields() {
+		*f = ""
+	}
+}
+
+// satisfiedBy reports whether a stored entity at version meets the
+// precondition. Callers handle the entity not existing.
+func (p Precondition) satisfiedBy(version int64) bool {
+	if len(p.IfVersions) == 0 {
+		return true
+	}
+	for _, v := range p.IfVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesServiceRequestQuery applies the filters of q (not the pagination);
+// search is q's parsed text search.
+func matchesServiceRequestQuery(req models.ServiceRequest, q ServiceRequestQuery, search TextSearch) bool {
+	if req.DeletedAt != nil && !q.IncludeDeleted {
+		return false
+	}
+	if len(q.ServiceRequestIDs) > 0 && !containsString(q.ServiceRequestIDs, req.ServiceRequestID) {
+		return false
+	}
+	if len(q.ServiceCodes) > 0 && !containsString(q.ServiceCodes, req.ServiceCode) {
+		return false
+	}
+	if containsString(q.ExcludeServiceCodes, req.ServiceCode) {
+		return false
+	}
+	if len(q.Statuses) > 0 && !containsString(q.Statuses, req.Status) {
+		return false
+	}
+	if q.FeatureID != "" && (req.FeatureID == nil || *req.FeatureID != q.FeatureID) {
+		return false
+	}
+	if q.FeatureGuid != "" && (req.FeatureGuid == nil || *req.FeatureGuid != q.FeatureGuid) {
+		return false
+	}
+	if q.OrganizationID != "" && req.OrganizationID != q.OrganizationID {
+		return false
+	}
+	if !inRange(req.RequestedDatetime, q.StartDate, q.EndDate) || !inRange(req.UpdatedDatetime, q.UpdatedAfter, q.UpdatedBefore) {
+		return false
+	}
+	if q.Near != nil || q.Within != nil {
+		if !hasLocation(req.Latitude, req.Longitude) {
+			return false
+		}
+		if q.Near != nil && !q.Near.Contains(req.Latitude, req.Longitude) {
+			return false
+		}
+		if q.Within != nil && !q.Within.Contains(req.Latitude, req.Longitude) {
+			return false
+		}
+	}
+	if !search.IsZero() && !search.matches(&req) {
+		return false
+	}
+	for _, f := range q.Properties {
+		if !f.matches(req.Properties) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// inRange reports whether t lies within the inclusive bounds (nil = open).
+func inRange(t time.Time, from, to *time.Time) bool {
+	if from != nil && t.Before(*from) {
+		return false
+	}
+	if to != nil && t.After(*to) {
+		return false
+	}
+	return true
+}
+
+// compareListed orders a before b (-1), after (1) or equal (0) in a listing
+// sorted by field, ties broken by id in the same direction.
+func compareListed(a, b models.ServiceRequest, field string, ascending bool) int {
+	c := sortValue(a, field).Compare(sortValue(b, field))
+	if c == 0 {
+		c = strings.Compare(a.ID, b.ID)
+	}
+	if !ascending {
+		c = -c
+	}
+	return c
+}
+
+// filter returns copies of the stored requests matching q (and following its
+// cursor), in its sort order. Callers hold the read lock.
+func (r *MemoryServiceRequestRepository) filter(q ServiceRequestQuery) []models.ServiceRequest {
+	field, ascending, search := q.sortField(), q.ascending(), q.textSearch()
+	var after *models.ServiceRequest
+	if c := q.After; c != nil {
+		after = &models.ServiceRequest{ID: c.ID, RequestedDatetime: c.Value, UpdatedDatetime: c.Value}
+	}
+	results := make([]models.ServiceRequest, 0)
+	for _, req := range r.requests {
+		if !matchesServiceRequestQuery(req, q, search) {
+			continue
+		}
+		if after != nil && compareListed(req, *after, field, ascending) <= 0 {
+			continue
+		}
+		results = append(results, cloneServiceRequest(req))
+	}
+	if q.byRelevance() {
+		scores := make(map[string]int, len(results))
+		for i := range results {
+			scores[results[i].ID] = search.score(&results[i])
+		}
+		sort.Slice(results, func(i, j int) bool {
+			if si, sj := scores[results[i].ID], scores[results[j].ID]; si != sj {
+				return si > sj
+			}
+			return compareListed(results[i], results[j], field, false) < 0
+		})
+		return results
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return compareListed(results[i], results[j], field, ascending) < 0
+	})
+	return results
+}
+
+// Find lists service requests matching the query in its sort order, paginated
+// like the MongoDB implementation.
+func (r *MemoryServiceRequestRepository) Find(ctx context.Context, q ServiceRequestQuery) ([]models.ServiceRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := r.filter(q)
+	skip, limit := q.window()
+	if skip >= len(results) {
+		return []models.ServiceRequest{}, nil
+	}
+	end := skip + limit
+	if end > len(results) {
+		end = len(results)
+	}
+	return results[skip:end], nil
+}
+
+// Each calls fn with the requests matching q in the order of Find. They are
+// selected under the lock and handed out after it is released, so fn may
+// write to the repository.
+func (r *MemoryServiceRequestRepository) Each(ctx context.Context, q ServiceRequestQuery, fn func(models.ServiceRequest) error) error {
+	r.mu.RLock()
+	results := r.filter(q)
+	r.mu.RUnlock()
+	for _, req := range results {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Count returns how many requests match the filters of q.
+func (r *MemoryServiceRequestRepository) Count(ctx context.Context, q ServiceRequestQuery) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var n int64
+	search := q.textSearch()
+	for _, req := range r.requests {
+		if matchesServiceRequestQuery(req, q, search) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// FindByServiceRequestID returns the live request with the given id.
+func (r *MemoryServiceRequestRepository) FindByServiceRequestID(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	req, ok := r.requests[serviceRequestID]
+	if !ok || req.DeletedAt != nil {
+		return models.ServiceRequest{}, ErrNotFound
+	}
+	return cloneServiceRequest(req), nil
+}
+
+// Create inserts a new service request with the same defaults as the MongoDB
+// implementation. A duplicate service_request_id is a database error, as the
+// unique index makes it there.
+func (r *MemoryServiceRequestRepository) Create(ctx context.Context, req models.ServiceRequest) (models.ServiceRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	oid := primitive.NewObjectID().Hex()
+	now := time.Now().UTC()
+	if req.ServiceRequestID == "" {
+		req.ServiceRequestID = oid
+	}
+	if _, exists := r.requests[req.ServiceRequestID]; exists {
+		return models.ServiceRequest{}, fmt.Errorf("%w: duplicate service_request_id %q", ErrDatabase, req.ServiceRequestID)
+	}
+	if req.Status == "" {
+		req.Status = "open"
+	}
+	if req.RequestedDatetime.IsZero() {
+		req.RequestedDatetime = now
+	}
+	req.UpdatedDatetime = now
+	req.DeletedAt, req.ErasedAt = nil, nil
+	req.ID = oid
+	req.Version = 1
+
+	stored := cloneServiceRequest(req)
+	r.requests[req.ServiceRequestID] = stored
+	return cloneServiceRequest(stored), nil
+}
+
+// put replaces or inserts req as the full stored state for its id, keeping the
+// existing id and erasure and bumping the version. Callers hold the write lock
+// and have applied defaults.
+func (r *MemoryServiceRequestRepository) put(req models.ServiceRequest) (models.ServiceRequest, bool) {
+	existing, exists := r.requests[req.ServiceRequestID]
+	if exists {
+		req = replacementOf(&existing, req)
+	} else {
+		req = replacementOf(nil, req)
+	}
+	stored := cloneServiceRequest(req)
+	r.requests[req.ServiceRequestID] = stored
+	return cloneServiceRequest(stored), !exists
+}
+
+// replacementOf returns req prepared as the full new state replacing existing
+// (nil when req is new): a live request keeping the existing id and erasure
+// with the version bumped.
+func replacementOf(existing *models.ServiceRequest, req models.ServiceRequest) models.ServiceRequest {
+	req.DeletedAt = nil
+	if existing != nil {
+		req.ID = existing.ID
+		req.ErasedAt = existing.ErasedAt
+		req.Version = existing.Version + 1
+		if req.ErasedAt != nil {
+			scrubPersonal(&req)
+		}
+	} else {
+		req.ID = primitive.NewObjectID().Hex()
+		req.ErasedAt = nil
+		req.Version = 1
+	}
+	return req
+}
+
+// applyUpsertDefaults sets status, requested_datetime and updated_datetime
+// when absent, like the MongoDB Upsert and BulkUpsert.
+func applyUpsertDefaults(req *models.ServiceRequest, now time.Time) {
+	if req.Status == "" {
+		req.Status = "open"
+	}
+	if req.RequestedDatetime.IsZero() {
+		req.RequestedDatetime = now
+	}
+	if req.UpdatedDatetime.IsZero() {
+		req.UpdatedDatetime = now
+	}
+}
+
+// Upsert inserts or fully replaces the request identified by
+// req.ServiceRequestID. See MongoServiceRequestRepository.Upsert.
+func (r *MemoryServiceRequestRepository) Upsert(ctx context.Context, req models.ServiceRequest, pre Precondition) (models.ServiceRequest, bool, error) {
+	if req.ServiceRequestID == "" {
+		return models.ServiceRequest{}, false, ErrInvalidID
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, exists := r.requests[req.ServiceRequestID]
+	if pre.Conditional() && (!exists || !pre.satisfiedBy(existing.Version)) {
+		return models.ServiceRequest{}, false, ErrPreconditionFailed
+	}
+	applyUpsertDefaults(&req, time.Now().UTC())
+	stored, created := r.put(req)
+	return stored, created, nil
+}
+
+// BulkUpsert inserts-or-replaces many requests with the same de-duplication,
+// defaults and OnlyIfNewer semantics as the MongoDB implementation. Counts are
+// always exact.
+func (r *MemoryServiceRequestRepository) BulkUpsert(ctx context.Context, reqs []models.ServiceRequest, opts BulkUpsertOptions) (BulkUpsertResult, error) {
+	res := BulkUpsertResult{Requested: len(reqs)}
+	if len(reqs) == 0 {
+		return res, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	order, byID := dedupeBulk(reqs, opts, &res)
+	outcomes := make(map[string]BulkOutcome, len(order))
+	for _, id := range order {
+		req := byID[id]
+		applyUpsertDefaults(&req, now)
+		if existing, ok := r.requests[id]; ok && opts.OnlyIfNewer &&
+			!existing.UpdatedDatetime.Before(storedTime(req.UpdatedDatetime)) {
+			res.Skipped++
+			outcomes[id] = BulkSkipped
+			continue
+		}
+		if _, created := r.put(req); created {
+			res.Created++
+			outcomes[id] = BulkCreated
+		} else {
+			res.Updated++
+			outcomes[id] = BulkUpdated
+		}
+	}
+	res.setOutcomes(reqs, outcomes)
+	return res, nil
+}
+
+// Patch applies a partial update to a live request. See
+// MongoServiceRequestRepository.Patch.
+func (r *MemoryServiceRequestRepository) Patch(ctx context.Context, serviceRequestID string, patch ServiceRequestPatch, pre Precondition) (models.ServiceRequest, error) {
+	if serviceRequestID == "" {
+		return models.ServiceRequest{}, ErrInvalidID
+	}
+	if err := patch.Validate(); err != nil {
+		return models.ServiceRequest{}, errors.Join(ErrInvalidPatch, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.requests[serviceRequestID]
+	if !ok || existing.DeletedAt != nil {
+		return models.ServiceRequest{}, ErrNotFound
+	}
+	if !pre.satisfiedBy(existing.Version) {
+		return models.ServiceRequest{}, ErrPreconditionFailed
+	}
+
+	req := cloneServiceRequest(existing)
+	if err := ApplyServiceRequestPatch(&req, patch, time.Now().UTC()); err != nil {
+		return models.ServiceRequest{}, err
+	}
+	if req.ErasedAt != nil {
+		scrubPersonal(&req)
+	}
+	req.Version = existing.Version + 1
+	stored := cloneServiceRequest(req)
+	r.requests[serviceRequestID] = stored
+	return cloneServiceRequest(stored), nil
+}
+
+// Delete soft-deletes a live request, leaving a tombstone. See
+// MongoServiceRequestRepository.Delete.
+func (r *MemoryServiceRequestRepository) Delete(ctx context.Context, serviceRequestID string, pre Precondition) error {
+	if serviceRequestID == "" {
+		return ErrInvalidID
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	req, ok := r.requests[serviceRequestID]
+	if !ok || req.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if !pre.satisfiedBy(req.Version) {
+		return ErrPreconditionFailed
+	}
+	now := storedTime(time.Now())
+	req.DeletedAt = &now
+	req.UpdatedDatetime = now
+	req.Version++
+	r.requests[serviceRequestID] = req
+	return nil
+}
+
+// Erase scrubs the personal data of a live request or tombstone. See
+// MongoServiceRequestRepository.Erase.
+func (r *MemoryServiceRequestRepository) Erase(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error) {
+	if serviceRequestID == "" {
+		return models.ServiceRequest{}, ErrInvalidID
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	req, ok := r.requests[serviceRequestID]
+	if !ok {
+		return models.ServiceRequest{}, ErrNotFound
+	}
+	now := storedTime(time.Now())
+	if req.ErasedAt == nil {
+		req.ErasedAt = &now
+	}
+	scrubPersonal(&req)
+	req.UpdatedDatetime = now
+	req.Version++
+	r.requests[serviceRequestID] = req
+	return cloneServiceRequest(req), nil
+}
+
+// PurgeDeleted hard-deletes tombstones soft-deleted before deletedBefore.
+func (r *MemoryServiceRequestRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	for id, req := range r.requests {
+		if req.DeletedAt != nil && req.DeletedAt.Before(deletedBefore) {
+			delete(r.requests, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// FindByFeature returns live requests linked to the feature (unpaginated).
+func (r *MemoryServiceRequestRepository) FindByFeature(ctx context.Context, featureID, featureGuid string) ([]models.ServiceRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.filter(ServiceRequestQuery{FeatureID: featureID, FeatureGuid: featureGuid}), nil
+}
+
+// FindByOrganization returns live requests of the organization (unpaginated).
+// An empty organizationID matches nothing, as organizationId is never stored
+// empty.
+func (r *MemoryServiceRequestRepository) FindByOrganization(ctx context.Context, organizationID string) ([]models.ServiceRequest, error) {
+	if organizationID == "" {
+		return []models.ServiceRequest{}, nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.filter(ServiceRequestQuery{OrganizationID: organizationID}), nil
+}
@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemorySubscriptionRepository is an in-process SubscriptionRepository
+// mirroring the MongoDB one (ObjectID-style hex ids; deliveries newest first
+// by id).
+type MemorySubscriptionRepository struct {
+	mu            sync.Mutex
+	subscriptions []models.Subscription
+	deliveries    []models.WebhookDelivery
+}
+
+// NewMemorySubscriptionRepository creates an empty in-memory repository.
+func NewMemorySubscriptionRepository() *MemorySubscriptionRepository {
+	return &MemorySubscriptionRepository{}
+}
+
+// cloneDelivery copies the pointer fields, so callers never share state
+// with the repository.
+func cloneDelivery(d models.WebhookDelivery) models.WebhookDelivery {
+	d.NextAttemptAt = storedTimePtr(d.NextAttemptAt)
+	d.DeliveredAt = storedTimePtr(d.DeliveredAt)
+	d.Payload = append([]byte(nil), d.Payload...)
+	return d
+}
+
+// FindAll returns all subscriptions, oldest first.
+func (r *MemorySubscriptionRepository) FindAll(ctx context.Context) ([]models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append(make([]models.Subscription, 0, len(r.subscriptions)), r.subscriptions...), nil
+}
+
+// FindByID returns the subscription with the given id.
+func (r *MemorySubscriptionRepository) FindByID(ctx context.Context, id string) (models.Subscription, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.Subscription{}, ErrInvalidID
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.subscriptions {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return models.Subscription{}, ErrNotFound
+}
+
+// Create stores a subscription, assigning its id and created_at.
+func (r *MemorySubscriptionRepository) Create(ctx context.Context, sub models.Subscription) (models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sub.ID = primitive.NewObjectID().Hex()
+	sub.CreatedAt = storedTime(time.Now())
+	r.subscriptions = append(r.subscriptions, sub)
+	return sub, nil
+}
+
+// Delete removes a subscription and its deliveries.
+func (r *MemorySubscriptionRepository) Delete(ctx context.Context, id string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return ErrInvalidID
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, s := range r.subscriptions {
+		if s.ID != id {
+			continue
+		}
+		r.subscriptions = append(r.subscriptions[:i], r.subscriptions[i+1:]...)
+		kept := r.deliveries[:0]
+		for _, d := range r.deliveries {
+			if d.SubscriptionID != id {
+				kept = append(kept, d)
+			}
+		}
+		r.deliveries = kept
+		return nil
+	}
+	return ErrNotFound
+}
+
+// CreateDeliveries queues deliveries, assigning their ids.
+func (r *MemorySubscriptionRepository) CreateDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) ([]models.WebhookDelivery, error) {
+	out := make([]models.WebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		if _, err := primitive.ObjectIDFromHex(d.SubscriptionID); err != nil {
+			return nil, ErrInvalidID
+		}
+		d.ID = primitive.NewObjectID().Hex()
+		d.CreatedAt = storedTime(d.CreatedAt)
+		out = append(out, cloneDelivery(d))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range out {
+		r.deliveries = append(r.deliveries, cloneDelivery(d))
+	}
+	return out, nil
+}
+
+// ClaimDueDeliveries claims due deliveries under the lock.
+func (r *MemorySubscriptionRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due []int
+	for i, d := range r.deliveries {
+		if d.Status == models.DeliveryPending && d.NextAttemptAt != nil && !d.NextAttemptAt.After(now) {
+			due = append(due, i)
+		}
+	}
+	sort.SliceStable(due, func(a, b int) bool {
+		da, db := r.deliveries[due[a]], r.deliveries[due[b]]
+		if !da.NextAttemptAt.Equal(*db.NextAttemptAt) {
+			return da.NextAttemptAt.Before(*db.NextAttemptAt)
+		}
+		return da.ID < db.ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	until := now.Add(lease)
+	claimed := make([]models.WebhookDelivery, 0, len(due))
+	for _, i := range due {
+		r.deliveries[i].NextAttemptAt = storedTimePtr(&until)
+		claimed = append(claimed, cloneDelivery(r.deliveries[i]))
+	}
+	return claimed, nil
+}
+
+// UpdateDelivery records the outcome of an attempt.
+func (r *MemorySubscriptionRepository) UpdateDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	if _, err := primitive.ObjectIDFromHex(d.ID); err != nil {
+		return ErrInvalidID
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.deliveries {
+		stored := &r.deliveries[i]
+		if stored.ID != d.ID {
+			continue
+		}
+		stored.Status = d.Status
+		stored.Attempts = d.Attempts
+		stored.ResponseStatus = d.ResponseStatus
+		stored.LastError = d.LastError
+		stored.NextAttemptAt = storedTimePtr(d.NextAttemptAt)
+		stored.DeliveredAt = storedTimePtr(d.DeliveredAt)
+		return nil
+	}
+	return ErrNotFound
+}
+
+// FindDeliveryByID returns the delivery with the given id.
+func (r *MemorySubscriptionRepository) FindDeliveryByID(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.WebhookDelivery{}, ErrInvalidID
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.deliveries {
+		if d.ID == id {
+			return cloneDelivery(d), nil
+		}
+	}
+	return models.WebhookDelivery{}, ErrNotFound
+}
+
+// FindDeliveries returns the newest deliveries of a subscription.
+func (r *MemorySubscriptionRepository) FindDeliveries(ctx context.Context, subscriptionID, status string, limit int) ([]models.WebhookDelivery, error) {
+	if _, err := primitive.ObjectIDFromHex(subscriptionID); err != nil {
+		return nil, ErrInvalidID
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]models.WebhookDelivery, 0)
+	for i := len(r.deliveries) - 1; i >= 0 && len(out) < limit; i-- {
+		d := r.deliveries[i]
+		if d.SubscriptionID == subscriptionID && (status == "" || d.Status == status) {
+			out = append(out, cloneDelivery(d))
+		}
+	}
+	return out, nil
+}
+
+// Close is a no-op.
+func (r *MemorySubscriptionRepository) Close() error {
+	return nil
+}
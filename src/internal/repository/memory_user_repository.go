@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryUserRepository is an in-process UserRepository mirroring the MongoDB
+// one: ObjectID-style hex ids, insertion order and a unique email.
+type MemoryUserRepository struct {
+	mu    sync.RWMutex
+	users []models.User
+}
+
+// NewMemoryUserRepository creates an empty in-memory repository.
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{}
+}
+
+func cloneUser(u models.User) models.User {
+	if u.Organizations != nil {
+		u.Organizations = append([]models.UserOrganizationLink(nil), u.Organizations...)
+	}
+	return u
+}
+
+// index returns the position of the user with the given id, or an error when
+// the id is malformed or unknown. Callers hold the lock.
+func (r *MemoryUserRepository) index(id string) (int, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return -1, ErrInvalidID
+	}
+	for i, u := range r.users {
+		if u.ID == id {
+			return i, nil
+		}
+	}
+	return -1, ErrNotFound
+}
+
+// emailTaken reports whether another user (not exceptID) has email. Callers
+// hold the lock.
+func (r *MemoryUserRepository) emailTaken(email, exceptID string) bool {
+	for _, u := range r.users {
+		if u.Email == email && u.ID != exceptID {
+			return true
+		}
+	}
+	return false
+}
+
+// FindAll returns all users in insertion order.
+func (r *MemoryUserRepository) FindAll(ctx context.Context) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]models.User, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, cloneUser(u))
+	}
+	return users, nil
+}
+
+// FindByID returns the user with the given id.
+func (r *MemoryUserRepository) FindByID(ctx context.Context, id string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i, err := r.index(id)
+	if err != nil {
+		return models.User{}, err
+	}
+	return cloneUser(r.users[i]), nil
+}
+
+// Create adds a user, assigning its id and timestamps.
+func (r *MemoryUserRepository) Create(ctx context.Context, user models.User) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.emailTaken(user.Email, "") {
+		return models.User{}, fmt.Errorf("%w: duplicate email", ErrDatabase)
+	}
+	now := storedTime(time.Now())
+	user.ID = primitive.NewObjectID().Hex()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	r.users = append(r.users, cloneUser(user))
+	return cloneUser(user), nil
+}
+
+// Update replaces the profile fields of a user; organizations and createdAt
+// are kept, as in the MongoDB implementation.
+func (r *MemoryUserRepository) Update(ctx context.Context, user models.User) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, err := r.index(user.ID)
+	if err != nil {
+		return models.User{}, err
+	}
+	if r.emailTaken(user.Email, user.ID) {
+		return models.User{}, fmt.Errorf("%w: duplicate email", ErrDatabase)
+	}
+	stored := r.users[i]
+	stored.Email = user.Email
+	stored.FirstName = user.FirstName
+	stored.LastName = user.LastName
+	stored.Phone = user.Phone
+	stored.Organization = user.Organization
+	stored.OrgType = user.OrgType
+	stored.UpdatedAt = storedTime(time.Now())
+	r.users[i] = stored
+	return cloneUser(stored), nil
+}
+
+// Delete removes a user.
+func (r *MemoryUserRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, err := r.index(id)
+	if err != nil {
+		return err
+	}
+	r.users = append(r.users[:i], r.users[i+1:]...)
+	return nil
+}
+
+// Close is a no-op.
+func (r *MemoryUserRepository) Close() error {
+	return nil
+}
@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is one versioned schema change, read from
+// migrations/<backend>/<version>_<name>.up.sql (and .down.sql).
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// status returns the migration as not (yet) applied.
+func (m Migration) status() MigrationStatus {
+	return MigrationStatus{Version: m.Version, Name: m.Name}
+}
+
+// MigrationStatus is a migration known to the binary or recorded as applied.
+type MigrationStatus struct {
+	Version int64
+	Name    string
+	// AppliedAt is nil while the migration is pending.
+	AppliedAt *time.Time
+}
+
+// MigrateOptions controls a migrate up or down run.
+type MigrateOptions struct {
+	// Steps limits how many migrations run: 0 means every pending one when
+	// migrating up and the latest applied one when migrating down.
+	Steps int
+	// DryRun reports what would run without changing anything.
+	DryRun bool
+	// Logf receives a line per migration and step (nil discards them).
+	Logf func(format string, args ...interface{})
+}
+
+func (o MigrateOptions) logf(format string, args ...interface{}) {
+	if o.Logf != nil {
+		o.Logf(format, args...)
+	}
+}
+
+// Migrator is implemented by the backends with a versioned schema (all but
+// the memory backend). MigrateUp and MigrateDown return the migrations they
+// applied or reverted — in a dry run, the ones they would have.
+type Migrator interface {
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+	MigrateUp(ctx context.Context, opts MigrateOptions) ([]MigrationStatus, error)
+	MigrateDown(ctx context.Context, opts MigrateOptions) ([]MigrationStatus, error)
+}
+
+// planMigrations picks the versions a run handles: the pending ones in
+// version order when migrating up, or the applied ones newest first when
+// migrating down, limited as MigrateOptions.Steps describes. A version
+// applied by a newer binary cannot be reverted by this one.
+func planMigrations(known []int64, applied map[int64]bool, down bool, steps int) ([]int64, error) {
+	var plan []int64
+	if down {
+		if steps <= 0 {
+			steps = 1
+		}
+		for v := range applied {
+			plan = append(plan, v)
+		}
+		sort.Slice(plan, func(i, j int) bool { return plan[i] > plan[j] })
+	} else {
+		for _, v := range known {
+			if !applied[v] {
+				plan = append(plan, v)
+			}
+		}
+	}
+	if steps > 0 && len(plan) > steps {
+		plan = plan[:steps]
+	}
+	if down {
+		isKnown := make(map[int64]bool, len(known))
+		for _, v := range known {
+			isKnown[v] = true
+		}
+		for _, v := range plan {
+			if !isKnown[v] {
+				return nil, fmt.Errorf("migration %d is not known to this binary (applied by a newer version?)", v)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// mergeMigrationStatus lists the known migrations with their applied time,
+// plus applied ones this binary does not know, in version order.
+func mergeMigrationStatus(known, applied []MigrationStatus) []MigrationStatus {
+	byVersion := map[int64]MigrationStatus{}
+	for _, m := range known {
+		byVersion[m.Version] = m
+	}
+	for _, m := range applied {
+		byVersion[m.Version] = m
+	}
+	all := make([]MigrationStatus, 0, len(byVersion))
+	for _, m := range byVersion {
+		all = append(all, m)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all
+}
+
+// loadMigrations reads the migrations of a backend in version order.
+func loadMigrations(backend string) ([]Migration, error) {
+	dir := path.Join("migrations", backend)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s migrations: %w", backend, err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, label, ok := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration %s: file name must be <version>_<name>.%s.sql", name, direction)
+		}
+		body, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// indexMigrations returns the versions of migrations (in their order) and
+// the migrations by version.
+func indexMigrations(migrations []Migration) ([]int64, map[int64]Migration) {
+	versions := make([]int64, len(migrations))
+	byVersion := make(map[int64]Migration, len(migrations))
+	for i, m := range migrations {
+		versions[i] = m.Version
+		byVersion[m.Version] = m
+	}
+	return versions, byVersion
+}
+
+// script returns the SQL of m in the direction of a run.
+func (m Migration) script(down bool) (string, error) {
+	if !down {
+		return m.Up, nil
+	}
+	if strings.TrimSpace(m.Down) == "" {
+		return "", fmt.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+	}
+	return m.Down, nil
+}
+
+// migrationVerb describes a migration step in a run's log.
+func migrationVerb(down, dryRun bool) string {
+	switch {
+	case down && dryRun:
+		return "would revert"
+	case down:
+		return "reverting"
+	case dryRun:
+		return "would apply"
+	default:
+		return "applying"
+	}
+}
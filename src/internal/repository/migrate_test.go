@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestPlanMigrations(t *testing.T) {
+	known := []int64{1, 2, 3}
+	cases := []struct {
+		name    string
+		applied map[int64]bool
+		down    bool
+		steps   int
+		want    []int64
+	}{
+		{"up all", map[int64]bool{1: true}, false, 0, []int64{2, 3}},
+		{"up steps", nil, false, 2, []int64{1, 2}},
+		{"up fills gaps", map[int64]bool{2: true}, false, 0, []int64{1, 3}},
+		{"down one", map[int64]bool{1: true, 2: true}, true, 0, []int64{2}},
+		{"down steps", map[int64]bool{1: true, 2: true, 3: true}, true, 5, []int64{3, 2, 1}},
+		{"nothing to revert", nil, true, 0, nil},
+	}
+	for _, tc := range cases {
+		got, err := planMigrations(known, tc.applied, tc.down, tc.steps)
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.want, got, tc.name)
+	}
+
+	_, err := planMigrations(known, map[int64]bool{1: true, 4: true}, true, 1)
+	assert.Error(t, err, "a newer binary's migration cannot be reverted")
+	got, err := planMigrations(known, map[int64]bool{4: true}, false, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, got)
+}
+
+func TestSQLiteMigrateDownAndUp(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewSQLiteConnection(config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "open311.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	dry, err := db.MigrateUp(ctx, MigrateOptions{DryRun: true})
+	require.NoError(t, err)
+	all, err := db.MigrationStatus(ctx)
+	require.NoError(t, err)
+	assert.Len(t, dry, len(all))
+	for _, m := range all {
+		assert.Nil(t, m.AppliedAt, "a dry run applies nothing")
+	}
+
+	_, err = db.MigrateUp(ctx, MigrateOptions{})
+	require.NoError(t, err)
+	repo := NewSQLiteServiceRequestRepository(db)
+	_, err = repo.Create(ctx, models.ServiceRequest{ServiceRequestID: "sr-1", ServiceName: "Graffiti removal",
+		RequestedDatetime: time.Now(), Properties: models.Properties{"neighborhood": "Roxbury"}})
+	require.NoError(t, err)
+
+	// Every down script runs back to the first migration, which keeps the data.
+	reverted, err := db.MigrateDown(ctx, MigrateOptions{Steps: len(all) - 1})
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(all)-1)
+	all, err = db.MigrationStatus(ctx)
+	require.NoError(t, err)
+	assert.NotNil(t, all[0].AppliedAt)
+	assert.Nil(t, all[1].AppliedAt)
+
+	// ...and the up scripts rebuild the indexes from it.
+	_, err = db.MigrateUp(ctx, MigrateOptions{})
+	require.NoError(t, err)
+	for _, q := range []string{"graffiti", "roxbury"} {
+		got, err := repo.Find(ctx, ServiceRequestQuery{Q: q})
+		require.NoError(t, err)
+		assert.Len(t, got, 1, q)
+	}
+}
+
+// TestMongoMigrations runs the built-in migrations against a real MongoDB when
+// MONGODB_TEST_URI is set, using a throwaway database.
+func TestMongoMigrations(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	ctx := context.Background()
+	db, err := NewMongoDBConnection(config.MongoDBConfig{
+		URI:              uri,
+		Database:         fmt.Sprintf("open311_migrations_%d", time.Now().UnixNano()),
+		ConnectTimeout:   10,
+		OperationTimeout: 10,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.DropDatabase(ctx)
+		_ = db.Disconnect()
+	})
+
+	// The state before the migrations: a "Users" collection, a request
+	// without location and the single-field datetime indexes.
+	_, err = db.GetCollection("Users").InsertOne(ctx, bson.M{"email": "a@example.com"})
+	require.NoError(t, err)
+	requests := db.GetCollection("service_requests")
+	_, err = requests.InsertMany(ctx, []interface{}{
+		bson.M{"service_request_id": "geo", "lat": 42.35, "long": -71.06},
+		bson.M{"service_request_id": "nogeo", "lat": 0, "long": 0},
+	})
+	require.NoError(t, err)
+	_, err = requests.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "requested_datetime", Value: -1}}, Options: options.Index().SetName("requested_datetime"),
+	})
+	require.NoError(t, err)
+
+	migrator := NewMongoMigrator(db, "service_requests")
+	_, err = migrator.MigrateUp(ctx, MigrateOptions{DryRun: true})
+	require.NoError(t, err)
+	n, err := db.GetCollection("Users").CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n, "a dry run changes nothing")
+
+	applied, err := migrator.MigrateUp(ctx, MigrateOptions{})
+	require.NoError(t, err)
+	assert.Len(t, applied, len(mongoMigrations))
+	require.NoError(t, EnsureIndexes(ctx, db, "service_requests", nil))
+
+	n, err = db.GetCollection(usersCollection).CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = requests.CountDocuments(ctx, bson.M{"location": bson.M{"$exists": true}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	specs, err := requests.Indexes().ListSpecifications(ctx)
+	require.NoError(t, err)
+	for _, s := range specs {
+		assert.NotEqual(t, "requested_datetime", s.Name)
+	}
+
+	again, err := migrator.MigrateUp(ctx, MigrateOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, again)
+
+	reverted, err := migrator.MigrateDown(ctx, MigrateOptions{Steps: len(mongoMigrations)})
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(mongoMigrations))
+	n, err = db.GetCollection("Users").CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
@@ -0,0 +1,84 @@
+-- Initial schema: the same entities, unique keys and secondary indexes as the
+-- MongoDB collections (see EnsureIndexes).
+CREATE EXTENSION IF NOT EXISTS postgis WITH SCHEMA public;
+
+CREATE TABLE service_requests (
+    id                 text PRIMARY KEY,
+    service_request_id text NOT NULL,
+    status             text NOT NULL,
+    status_notes       text NOT NULL DEFAULT '',
+    service_name       text NOT NULL DEFAULT '',
+    service_code       text NOT NULL DEFAULT '',
+    description        text NOT NULL DEFAULT '',
+    agency_responsible text NOT NULL DEFAULT '',
+    service_notice     text NOT NULL DEFAULT '',
+    requested_datetime timestamptz NOT NULL,
+    updated_datetime   timestamptz NOT NULL,
+    expected_datetime  timestamptz,
+    address            text NOT NULL DEFAULT '',
+    address_id         text NOT NULL DEFAULT '',
+    zipcode            text NOT NULL DEFAULT '',
+    lat                double precision NOT NULL DEFAULT 0,
+    long               double precision NOT NULL DEFAULT 0,
+    -- Derived from lat/long; NULL when no coordinates are set.
+    location           public.geography(Point, 4326) GENERATED ALWAYS AS (
+        CASE WHEN lat <> 0 OR long <> 0
+            THEN public.ST_SetSRID(public.ST_MakePoint(long, lat), 4326)::public.geography
+        END
+    ) STORED,
+    media_url          text NOT NULL DEFAULT '',
+    feature_id         text,
+    feature_guid       text,
+    organization_id    text,
+    email              text,
+    first_name         text,
+    last_name          text,
+    phone              text,
+    device_id          text,
+    account_id         text,
+    properties         jsonb,
+    version            bigint NOT NULL DEFAULT 1,
+    deleted_at         timestamptz,
+    erased_at          timestamptz,
+    CONSTRAINT uniq_service_request_id UNIQUE (service_request_id)
+);
+
+CREATE INDEX service_requests_geo_location_idx ON service_requests USING gist (location);
+-- bbox filters compare planar geometry so they match the other backends.
+CREATE INDEX service_requests_geo_location_geometry_idx ON service_requests USING gist ((location::public.geometry));
+CREATE INDEX service_requests_status_idx ON service_requests (status);
+CREATE INDEX service_requests_organization_id_idx ON service_requests (organization_id);
+CREATE INDEX service_requests_feature_id_idx ON service_requests (feature_id);
+CREATE INDEX service_requests_requested_datetime_idx ON service_requests (requested_datetime DESC);
+CREATE INDEX service_requests_updated_datetime_idx ON service_requests (updated_datetime DESC);
+-- Partial: only tombstones carry deleted_at, so the purge job's scan stays small.
+CREATE INDEX service_requests_deleted_at_idx ON service_requests (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE services (
+    id            text PRIMARY KEY,
+    service_code  text NOT NULL,
+    service_name  text NOT NULL DEFAULT '',
+    description   text NOT NULL DEFAULT '',
+    metadata      boolean NOT NULL DEFAULT false,
+    type          text NOT NULL DEFAULT '',
+    keywords      text NOT NULL DEFAULT '',
+    service_group text NOT NULL DEFAULT '',
+    attributes    jsonb,
+    created_at    timestamptz NOT NULL,
+    updated_at    timestamptz NOT NULL,
+    CONSTRAINT uniq_service_code UNIQUE (service_code)
+);
+
+CREATE TABLE users (
+    id            text PRIMARY KEY,
+    email         text NOT NULL,
+    first_name    text NOT NULL DEFAULT '',
+    last_name     text NOT NULL DEFAULT '',
+    phone         text NOT NULL DEFAULT '',
+    organization  text NOT NULL DEFAULT '',
+    org_type      text NOT NULL DEFAULT '',
+    organizations jsonb,
+    created_at    timestamptz NOT NULL,
+    updated_at    timestamptz NOT NULL,
+    CONSTRAINT uniq_email UNIQUE (email)
+);
@@ -0,0 +1,4 @@
+-- Listing sorts and cursors: (sort field, id), walked in either direction.
+-- The id collation is bytewise so it orders like MongoDB ObjectIDs.
+CREATE INDEX service_requests_requested_datetime_id_idx ON service_requests (requested_datetime DESC, id COLLATE "C" DESC);
+CREATE INDEX service_requests_updated_datetime_id_idx ON service_requests (updated_datetime DESC, id COLLATE "C" DESC);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS service_requests_search_idx;
+ALTER TABLE service_requests DROP COLUMN IF EXISTS search;
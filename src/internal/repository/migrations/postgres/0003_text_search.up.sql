@@ -0,0 +1,10 @@
+-- Full-text search for the q filter, mirroring textSearchFields and the
+-- MongoDB text index: English stemming, service_name weighted highest, then
+-- description, then address and the neighborhood property.
+ALTER TABLE service_requests ADD COLUMN search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', service_name), 'A') ||
+    setweight(to_tsvector('english', description), 'B') ||
+    setweight(to_tsvector('english', address || ' ' || coalesce(properties->>'neighborhood', '')), 'C')
+) STORED;
+
+CREATE INDEX service_requests_search_idx ON service_requests USING gin (search);
@@ -0,0 +1,31 @@
+-- Webhook subscriptions and their delivery queue / history.
+
+CREATE TABLE subscriptions (
+    id                 text PRIMARY KEY,
+    url                text NOT NULL,
+    secret             text NOT NULL,
+    service_request_id text NOT NULL DEFAULT '',
+    service_code       text NOT NULL DEFAULT '',
+    organization_id    text NOT NULL DEFAULT '',
+    bbox               text NOT NULL DEFAULT '',
+    created_at         timestamptz NOT NULL
+);
+
+CREATE TABLE webhook_deliveries (
+    id                 text PRIMARY KEY,
+    subscription_id    text NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+    event              text NOT NULL,
+    service_request_id text NOT NULL,
+    status             text NOT NULL,
+    attempts           integer NOT NULL DEFAULT 0,
+    response_status    integer NOT NULL DEFAULT 0,
+    last_error         text NOT NULL DEFAULT '',
+    created_at         timestamptz NOT NULL,
+    next_attempt_at    timestamptz,
+    delivered_at       timestamptz,
+    payload            bytea NOT NULL
+);
+
+-- The due-queue scan only looks at pending deliveries.
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at, id) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_subscription_id_idx ON webhook_deliveries (subscription_id, id DESC);
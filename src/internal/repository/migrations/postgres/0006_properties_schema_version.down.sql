@@ -0,0 +1 @@
+ALTER TABLE service_requests DROP COLUMN IF EXISTS properties_schema_version;
@@ -0,0 +1,3 @@
+-- The version of the properties schema a request's properties conform to;
+-- 0 for requests written without a schema.
+ALTER TABLE service_requests ADD COLUMN properties_schema_version integer NOT NULL DEFAULT 0;
@@ -0,0 +1,30 @@
+-- Background import jobs (POST /jobs/imports): state, progress and the lease
+-- of the worker running them.
+
+CREATE TABLE import_jobs (
+    id               text PRIMARY KEY,
+    status           text NOT NULL,
+    format           text NOT NULL,
+    dictionary       text NOT NULL DEFAULT '',
+    only_if_newer    boolean NOT NULL DEFAULT false,
+    file             text NOT NULL,
+    size             bigint NOT NULL DEFAULT 0,
+    rows_read        integer NOT NULL DEFAULT 0,
+    created          integer NOT NULL DEFAULT 0,
+    updated          integer NOT NULL DEFAULT 0,
+    unchanged        integer NOT NULL DEFAULT 0,
+    skipped          integer NOT NULL DEFAULT 0,
+    failed           integer NOT NULL DEFAULT 0,
+    samples          jsonb NOT NULL DEFAULT '[]',
+    error            text NOT NULL DEFAULT '',
+    cancel_requested boolean NOT NULL DEFAULT false,
+    attempts         integer NOT NULL DEFAULT 0,
+    created_at       timestamptz NOT NULL,
+    updated_at       timestamptz NOT NULL,
+    started_at       timestamptz,
+    finished_at      timestamptz,
+    lease_until      timestamptz
+);
+
+-- The claim scan only looks at jobs waiting for a worker.
+CREATE INDEX import_jobs_claim_idx ON import_jobs (id) WHERE status IN ('queued', 'running');
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS services;
+DROP TABLE IF EXISTS service_requests_fts;
+DROP TABLE IF EXISTS service_requests_rtree;
+DROP TABLE IF EXISTS service_requests;
@@ -0,0 +1,120 @@
+-- Initial schema: the same entities, unique keys and secondary indexes as the
+-- MongoDB collections (see EnsureIndexes). Timestamps are Unix milliseconds
+-- (UTC), the precision every backend stores.
+CREATE TABLE service_requests (
+    pk                 INTEGER PRIMARY KEY,
+    id                 TEXT NOT NULL UNIQUE,
+    service_request_id TEXT NOT NULL,
+    status             TEXT NOT NULL,
+    status_notes       TEXT NOT NULL DEFAULT '',
+    service_name       TEXT NOT NULL DEFAULT '',
+    service_code       TEXT NOT NULL DEFAULT '',
+    description        TEXT NOT NULL DEFAULT '',
+    agency_responsible TEXT NOT NULL DEFAULT '',
+    service_notice     TEXT NOT NULL DEFAULT '',
+    requested_datetime INTEGER NOT NULL,
+    updated_datetime   INTEGER NOT NULL,
+    expected_datetime  INTEGER,
+    address            TEXT NOT NULL DEFAULT '',
+    address_id         TEXT NOT NULL DEFAULT '',
+    zipcode            TEXT NOT NULL DEFAULT '',
+    lat                REAL NOT NULL DEFAULT 0,
+    long               REAL NOT NULL DEFAULT 0,
+    media_url          TEXT NOT NULL DEFAULT '',
+    feature_id         TEXT,
+    feature_guid       TEXT,
+    organization_id    TEXT,
+    email              TEXT,
+    first_name         TEXT,
+    last_name          TEXT,
+    phone              TEXT,
+    device_id          TEXT,
+    account_id         TEXT,
+    properties         TEXT,
+    version            INTEGER NOT NULL DEFAULT 1,
+    deleted_at         INTEGER,
+    erased_at          INTEGER,
+    CONSTRAINT uniq_service_request_id UNIQUE (service_request_id)
+);
+
+CREATE INDEX service_requests_status_idx ON service_requests (status);
+CREATE INDEX service_requests_organization_id_idx ON service_requests (organization_id);
+CREATE INDEX service_requests_feature_id_idx ON service_requests (feature_id);
+CREATE INDEX service_requests_requested_datetime_idx ON service_requests (requested_datetime DESC);
+CREATE INDEX service_requests_updated_datetime_idx ON service_requests (updated_datetime DESC);
+-- Partial: only tombstones carry deleted_at, so the purge job's scan stays small.
+CREATE INDEX service_requests_deleted_at_idx ON service_requests (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Spatial index: one degenerate box per located request (lat or long
+-- non-zero, like the GeoJSON point in MongoDB), kept in sync by triggers.
+CREATE VIRTUAL TABLE service_requests_rtree USING rtree(pk, min_long, max_long, min_lat, max_lat);
+
+CREATE TRIGGER service_requests_rtree_insert AFTER INSERT ON service_requests
+WHEN new.lat <> 0 OR new.long <> 0 BEGIN
+    INSERT INTO service_requests_rtree VALUES (new.pk, new.long, new.long, new.lat, new.lat);
+END;
+
+CREATE TRIGGER service_requests_rtree_update AFTER UPDATE OF lat, long ON service_requests BEGIN
+    DELETE FROM service_requests_rtree WHERE pk = old.pk;
+    INSERT INTO service_requests_rtree
+        SELECT new.pk, new.long, new.long, new.lat, new.lat WHERE new.lat <> 0 OR new.long <> 0;
+END;
+
+CREATE TRIGGER service_requests_rtree_delete AFTER DELETE ON service_requests BEGIN
+    DELETE FROM service_requests_rtree WHERE pk = old.pk;
+END;
+
+-- Full-text index for the q filter. The trigram tokenizer keeps the
+-- case-insensitive substring semantics of the other backends.
+CREATE VIRTUAL TABLE service_requests_fts USING fts5(
+    description, service_name, address,
+    content = 'service_requests', content_rowid = 'pk', tokenize = 'trigram'
+);
+
+CREATE TRIGGER service_requests_fts_insert AFTER INSERT ON service_requests BEGIN
+    INSERT INTO service_requests_fts (rowid, description, service_name, address)
+        VALUES (new.pk, new.description, new.service_name, new.address);
+END;
+
+CREATE TRIGGER service_requests_fts_update AFTER UPDATE OF description, service_name, address ON service_requests BEGIN
+    INSERT INTO service_requests_fts (service_requests_fts, rowid, description, service_name, address)
+        VALUES ('delete', old.pk, old.description, old.service_name, old.address);
+    INSERT INTO service_requests_fts (rowid, description, service_name, address)
+        VALUES (new.pk, new.description, new.service_name, new.address);
+END;
+
+CREATE TRIGGER service_requests_fts_delete AFTER DELETE ON service_requests BEGIN
+    INSERT INTO service_requests_fts (service_requests_fts, rowid, description, service_name, address)
+        VALUES ('delete', old.pk, old.description, old.service_name, old.address);
+END;
+
+CREATE TABLE services (
+    pk            INTEGER PRIMARY KEY,
+    id            TEXT NOT NULL UNIQUE,
+    service_code  TEXT NOT NULL,
+    service_name  TEXT NOT NULL DEFAULT '',
+    description   TEXT NOT NULL DEFAULT '',
+    metadata      INTEGER NOT NULL DEFAULT 0,
+    type          TEXT NOT NULL DEFAULT '',
+    keywords      TEXT NOT NULL DEFAULT '',
+    service_group TEXT NOT NULL DEFAULT '',
+    attributes    TEXT,
+    created_at    INTEGER NOT NULL,
+    updated_at    INTEGER NOT NULL,
+    CONSTRAINT uniq_service_code UNIQUE (service_code)
+);
+
+CREATE TABLE users (
+    pk            INTEGER PRIMARY KEY,
+    id            TEXT NOT NULL UNIQUE,
+    email         TEXT NOT NULL,
+    first_name    TEXT NOT NULL DEFAULT '',
+    last_name     TEXT NOT NULL DEFAULT '',
+    phone         TEXT NOT NULL DEFAULT '',
+    organization  TEXT NOT NULL DEFAULT '',
+    org_type      TEXT NOT NULL DEFAULT '',
+    organizations TEXT,
+    created_at    INTEGER NOT NULL,
+    updated_at    INTEGER NOT NULL,
+    CONSTRAINT uniq_email UNIQUE (email)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS service_requests_updated_datetime_id_idx;
+DROP INDEX IF EXISTS service_requests_requested_datetime_id_idx;
@@ -0,0 +1,3 @@
+-- Listing sorts and cursors: (sort field, id), walked in either direction.
+CREATE INDEX service_requests_requested_datetime_id_idx ON service_requests (requested_datetime DESC, id DESC);
+CREATE INDEX service_requests_updated_datetime_id_idx ON service_requests (updated_datetime DESC, id DESC);
@@ -0,0 +1,27 @@
+DROP TRIGGER service_requests_fts_insert;
+DROP TRIGGER service_requests_fts_update;
+DROP TRIGGER service_requests_fts_delete;
+DROP TABLE service_requests_fts;
+
+CREATE VIRTUAL TABLE service_requests_fts USING fts5(
+    description, service_name, address,
+    content = 'service_requests', content_rowid = 'pk', tokenize = 'trigram'
+);
+INSERT INTO service_requests_fts (service_requests_fts) VALUES ('rebuild');
+
+CREATE TRIGGER service_requests_fts_insert AFTER INSERT ON service_requests BEGIN
+    INSERT INTO service_requests_fts (rowid, description, service_name, address)
+        VALUES (new.pk, new.description, new.service_name, new.address);
+END;
+
+CREATE TRIGGER service_requests_fts_update AFTER UPDATE OF description, service_name, address ON service_requests BEGIN
+    INSERT INTO service_requests_fts (service_requests_fts, rowid, description, service_name, address)
+        VALUES ('delete', old.pk, old.description, old.service_name, old.address);
+    INSERT INTO service_requests_fts (rowid, description, service_name, address)
+        VALUES (new.pk, new.description, new.service_name, new.address);
+END;
+
+CREATE TRIGGER service_requests_fts_delete AFTER DELETE ON service_requests BEGIN
+    INSERT INTO service_requests_fts (service_requests_fts, rowid, description, service_name, address)
+        VALUES ('delete', old.pk, old.description, old.service_name, old.address);
+END;
@@ -0,0 +1,31 @@
+-- The q index now covers every field of textSearchFields, including the
+-- neighborhood property. That is not a column, so the index is contentless
+-- (rows are deleted by rowid) instead of reading from service_requests.
+DROP TRIGGER service_requests_fts_insert;
+DROP TRIGGER service_requests_fts_update;
+DROP TRIGGER service_requests_fts_delete;
+DROP TABLE service_requests_fts;
+
+CREATE VIRTUAL TABLE service_requests_fts USING fts5(
+    service_name, description, address, neighborhood,
+    content = '', contentless_delete = 1, tokenize = 'trigram'
+);
+
+INSERT INTO service_requests_fts (rowid, service_name, description, address, neighborhood)
+    SELECT pk, service_name, description, address, json_extract(properties, '$.neighborhood')
+    FROM service_requests;
+
+CREATE TRIGGER service_requests_fts_insert AFTER INSERT ON service_requests BEGIN
+    INSERT INTO service_requests_fts (rowid, service_name, description, address, neighborhood)
+        VALUES (new.pk, new.service_name, new.description, new.address, json_extract(new.properties, '$.neighborhood'));
+END;
+
+CREATE TRIGGER service_requests_fts_update AFTER UPDATE OF service_name, description, address, properties ON service_requests BEGIN
+    DELETE FROM service_requests_fts WHERE rowid = old.pk;
+    INSERT INTO service_requests_fts (rowid, service_name, description, address, neighborhood)
+        VALUES (new.pk, new.service_name, new.description, new.address, json_extract(new.properties, '$.neighborhood'));
+END;
+
+CREATE TRIGGER service_requests_fts_delete AFTER DELETE ON service_requests BEGIN
+    DELETE FROM service_requests_fts WHERE rowid = old.pk;
+END;
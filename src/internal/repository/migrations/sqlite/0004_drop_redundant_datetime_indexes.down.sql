@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS service_requests_requested_datetime_idx ON service_requests (requested_datetime DESC);
+CREATE INDEX IF NOT EXISTS service_requests_updated_datetime_idx ON service_requests (updated_datetime DESC);
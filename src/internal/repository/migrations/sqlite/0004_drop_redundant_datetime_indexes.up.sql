@@ -0,0 +1,4 @@
+-- The (requested_datetime, id) and (updated_datetime, id) listing indexes
+-- cover every query the single-column ones served (MongoDB migration 3).
+DROP INDEX IF EXISTS service_requests_requested_datetime_idx;
+DROP INDEX IF EXISTS service_requests_updated_datetime_idx;
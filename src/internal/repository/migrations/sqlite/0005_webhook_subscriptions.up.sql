@@ -0,0 +1,34 @@
+-- Webhook subscriptions and their delivery queue / history. Timestamps are
+-- Unix milliseconds; deleting a subscription deletes its deliveries in the
+-- same transaction.
+
+CREATE TABLE subscriptions (
+    pk                 INTEGER PRIMARY KEY,
+    id                 TEXT NOT NULL UNIQUE,
+    url                TEXT NOT NULL,
+    secret             TEXT NOT NULL,
+    service_request_id TEXT NOT NULL DEFAULT '',
+    service_code       TEXT NOT NULL DEFAULT '',
+    organization_id    TEXT NOT NULL DEFAULT '',
+    bbox               TEXT NOT NULL DEFAULT '',
+    created_at         INTEGER NOT NULL
+);
+
+CREATE TABLE webhook_deliveries (
+    pk                 INTEGER PRIMARY KEY,
+    id                 TEXT NOT NULL UNIQUE,
+    subscription_id    TEXT NOT NULL,
+    event              TEXT NOT NULL,
+    service_request_id TEXT NOT NULL,
+    status             TEXT NOT NULL,
+    attempts           INTEGER NOT NULL DEFAULT 0,
+    response_status    INTEGER NOT NULL DEFAULT 0,
+    last_error         TEXT NOT NULL DEFAULT '',
+    created_at         INTEGER NOT NULL,
+    next_attempt_at    INTEGER,
+    delivered_at       INTEGER,
+    payload            BLOB NOT NULL
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at, id) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_subscription_id_idx ON webhook_deliveries (subscription_id, id DESC);
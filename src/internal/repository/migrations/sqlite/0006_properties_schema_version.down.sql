@@ -0,0 +1 @@
+ALTER TABLE service_requests DROP COLUMN properties_schema_version;
@@ -0,0 +1,31 @@
+-- Background import jobs (POST /jobs/imports): state, progress and the lease
+-- of the worker running them. Timestamps are Unix milliseconds; samples is a
+-- JSON array.
+
+CREATE TABLE import_jobs (
+    pk               INTEGER PRIMARY KEY,
+    id               TEXT NOT NULL UNIQUE,
+    status           TEXT NOT NULL,
+    format           TEXT NOT NULL,
+    dictionary       TEXT NOT NULL DEFAULT '',
+    only_if_newer    INTEGER NOT NULL DEFAULT 0,
+    file             TEXT NOT NULL,
+    size             INTEGER NOT NULL DEFAULT 0,
+    rows_read        INTEGER NOT NULL DEFAULT 0,
+    created          INTEGER NOT NULL DEFAULT 0,
+    updated          INTEGER NOT NULL DEFAULT 0,
+    unchanged        INTEGER NOT NULL DEFAULT 0,
+    skipped          INTEGER NOT NULL DEFAULT 0,
+    failed           INTEGER NOT NULL DEFAULT 0,
+    samples          TEXT NOT NULL DEFAULT '[]',
+    error            TEXT NOT NULL DEFAULT '',
+    cancel_requested INTEGER NOT NULL DEFAULT 0,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    created_at       INTEGER NOT NULL,
+    updated_at       INTEGER NOT NULL,
+    started_at       INTEGER,
+    finished_at      INTEGER,
+    lease_until      INTEGER
+);
+
+CREATE INDEX import_jobs_claim_idx ON import_jobs (pk) WHERE status IN ('queued', 'running');
@@ -0,0 +1,345 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoMigrationsCollection records the applied MongoDB migrations, one
+// document per version, plus the lock document of a running migration.
+const mongoMigrationsCollection = "schema_migrations"
+
+// mongoMigrationLockID is the _id of the lock document.
+const mongoMigrationLockID = "lock"
+
+// mongoMigration is one versioned change to the MongoDB collections, indexes
+// or documents. Unlike the SQL backends' scripts these are Go functions; each
+// step checks the current state first, so a migration interrupted half way
+// can simply be run again, and reports what it does (or, in a dry run, would
+// do) through run.logf.
+type mongoMigration struct {
+	Version int64
+	Name    string
+	Up      func(ctx context.Context, run *mongoMigrationRun) error
+	Down    func(ctx context.Context, run *mongoMigrationRun) error
+}
+
+// mongoMigrations are the built-in MongoDB migrations, in version order.
+// Released migrations are never edited — add a new version instead.
+var mongoMigrations = []mongoMigration{
+	{
+		// The user repository always used "Users"; every other collection
+		// is lower case.
+		Version: 1,
+		Name:    "rename_users_collection",
+		Up: func(ctx context.Context, run *mongoMigrationRun) error {
+			return run.renameCollection(ctx, "Users", usersCollection)
+		},
+		Down: func(ctx context.Context, run *mongoMigrationRun) error {
+			return run.renameCollection(ctx, usersCollection, "Users")
+		},
+	},
+	{
+		// Documents imported by external pipelines may carry lat/long but no
+		// GeoJSON location, so the 2dsphere index and geo filters miss them.
+		Version: 2,
+		Name:    "backfill_location",
+		Up: func(ctx context.Context, run *mongoMigrationRun) error {
+			coll := run.db.GetCollection(run.serviceRequests)
+			filter := bson.M{
+				"location": bson.M{"$exists": false},
+				"lat":      bson.M{"$type": "number"},
+				"long":     bson.M{"$type": "number"},
+				"$or":      bson.A{bson.M{"lat": bson.M{"$ne": 0}}, bson.M{"long": bson.M{"$ne": 0}}},
+			}
+			if run.dryRun {
+				n, err := coll.CountDocuments(ctx, filter)
+				if err != nil {
+					return err
+				}
+				run.logf("would set location on %d documents in %q", n, run.serviceRequests)
+				return nil
+			}
+			// GeoJSON order is [long, lat], as Create derives it.
+			res, err := coll.UpdateMany(ctx, filter, bson.A{bson.M{"$set": bson.M{"location": bson.M{
+				"type":        "Point",
+				"coordinates": bson.A{"$long", "$lat"},
+			}}}})
+			if err != nil {
+				return err
+			}
+			run.logf("set location on %d documents in %q", res.ModifiedCount, run.serviceRequests)
+			return nil
+		},
+		Down: func(ctx context.Context, run *mongoMigrationRun) error {
+			// location is derived from lat/long and kept current by every
+			// write, so there is nothing worth undoing.
+			run.logf("location stays on backfilled documents (derived from lat/long)")
+			return nil
+		},
+	},
+	{
+		// The (requested_datetime, _id) and (updated_datetime, _id) listing
+		// indexes cover every query the single-field ones served.
+		Version: 3,
+		Name:    "drop_redundant_datetime_indexes",
+		Up: func(ctx context.Context, run *mongoMigrationRun) error {
+			for _, name := range []string{"requested_datetime", "updated_datetime"} {
+				if err := run.dropIndex(ctx, run.serviceRequests, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, run *mongoMigrationRun) error {
+			for _, name := range []string{"requested_datetime", "updated_datetime"} {
+				if err := run.createIndex(ctx, run.serviceRequests, mongo.IndexModel{
+					Keys:    bson.D{{Key: name, Value: -1}},
+					Options: options.Index().SetName(name),
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// mongoMigrationRun is what a migration step works on.
+type mongoMigrationRun struct {
+	db              *MongoDB
+	serviceRequests string
+	dryRun          bool
+	logf            func(format string, args ...interface{})
+}
+
+// collectionExists reports whether the database has a collection name.
+func (run *mongoMigrationRun) collectionExists(ctx context.Context, name string) (bool, error) {
+	names, err := run.db.database.ListCollectionNames(ctx, bson.M{"name": name})
+	if err != nil {
+		return false, err
+	}
+	return len(names) > 0, nil
+}
+
+// renameCollection renames from to to, keeping its indexes. A missing from is
+// a no-op (already renamed); an empty to, e.g. created by EnsureIndexes
+// before the rename, is dropped first; a non-empty to is an error.
+func (run *mongoMigrationRun) renameCollection(ctx context.Context, from, to string) error {
+	exists, err := run.collectionExists(ctx, from)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		run.logf("collection %q does not exist; nothing to rename", from)
+		return nil
+	}
+	if exists, err := run.collectionExists(ctx, to); err != nil {
+		return err
+	} else if exists {
+		n, err := run.db.GetCollection(to).CountDocuments(ctx, bson.M{})
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("both %q and %q exist and %q holds %d documents; merge them by hand", from, to, to, n)
+		}
+		run.logf("drop empty collection %q", to)
+		if !run.dryRun {
+			if err := run.db.GetCollection(to).Drop(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	run.logf("rename collection %q to %q", from, to)
+	if run.dryRun {
+		return nil
+	}
+	dbName := run.db.database.Name()
+	return run.db.client.Database("admin").RunCommand(ctx, bson.D{
+		{Key: "renameCollection", Value: dbName + "." + from},
+		{Key: "to", Value: dbName + "." + to},
+	}).Err()
+}
+
+// dropIndex drops the index name of collection if it exists.
+func (run *mongoMigrationRun) dropIndex(ctx context.Context, collection, name string) error {
+	specs, err := run.db.GetCollection(collection).Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		if spec.Name != name {
+			continue
+		}
+		run.logf("drop index %q on %q", name, collection)
+		if run.dryRun {
+			return nil
+		}
+		_, err := run.db.GetCollection(collection).Indexes().DropOne(ctx, name)
+		return err
+	}
+	run.logf("index %q on %q does not exist; nothing to drop", name, collection)
+	return nil
+}
+
+// createIndex creates an index (a no-op when an identical one exists).
+func (run *mongoMigrationRun) createIndex(ctx context.Context, collection string, model mongo.IndexModel) error {
+	name := ""
+	if model.Options != nil && model.Options.Name != nil {
+		name = *model.Options.Name
+	}
+	run.logf("create index %q on %q", name, collection)
+	if run.dryRun {
+		return nil
+	}
+	_, err := run.db.GetCollection(collection).Indexes().CreateOne(ctx, model)
+	return err
+}
+
+// MongoMigrator applies the built-in MongoDB migrations, recording them in
+// the schema_migrations collection.
+type MongoMigrator struct {
+	db              *MongoDB
+	serviceRequests string
+}
+
+// NewMongoMigrator creates a MongoMigrator; serviceRequestsCollection is the
+// configured service request collection.
+func NewMongoMigrator(db *MongoDB, serviceRequestsCollection string) *MongoMigrator {
+	if serviceRequestsCollection == "" {
+		serviceRequestsCollection = "service_requests"
+	}
+	return &MongoMigrator{db: db, serviceRequests: serviceRequestsCollection}
+}
+
+// migrationDoc is a schema_migrations document.
+type migrationDoc struct {
+	Version   int64     `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+func (m *MongoMigrator) applied(ctx context.Context) ([]MigrationStatus, error) {
+	cursor, err := m.db.GetCollection(mongoMigrationsCollection).Find(ctx,
+		bson.M{"_id": bson.M{"$ne": mongoMigrationLockID}}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	var docs []migrationDoc
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	applied := make([]MigrationStatus, len(docs))
+	for i, d := range docs {
+		at := d.AppliedAt.UTC()
+		applied[i] = MigrationStatus{Version: d.Version, Name: d.Name, AppliedAt: &at}
+	}
+	return applied, nil
+}
+
+// MigrationStatus lists the built-in migrations and those recorded in
+// schema_migrations.
+func (m *MongoMigrator) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := make([]MigrationStatus, len(mongoMigrations))
+	for i, mm := range mongoMigrations {
+		known[i] = MigrationStatus{Version: mm.Version, Name: mm.Name}
+	}
+	return mergeMigrationStatus(known, applied), nil
+}
+
+// MigrateUp applies the pending migrations in version order. A lock document
+// keeps a second run (another replica starting, say) from interleaving.
+func (m *MongoMigrator) MigrateUp(ctx context.Context, opts MigrateOptions) ([]MigrationStatus, error) {
+	return m.migrate(ctx, false, opts)
+}
+
+// MigrateDown reverts the latest applied migrations.
+func (m *MongoMigrator) MigrateDown(ctx context.Context, opts MigrateOptions) ([]MigrationStatus, error) {
+	return m.migrate(ctx, true, opts)
+}
+
+func (m *MongoMigrator) migrate(ctx context.Context, down bool, opts MigrateOptions) ([]MigrationStatus, error) {
+	coll := m.db.GetCollection(mongoMigrationsCollection)
+	if !opts.DryRun {
+		_, err := coll.InsertOne(ctx, bson.M{"_id": mongoMigrationLockID, "locked_at": time.Now().UTC()})
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("%w: another migration is running (if it died, delete the %q document from %s)",
+				ErrDatabase, mongoMigrationLockID, mongoMigrationsCollection)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		defer func() {
+			_, _ = coll.DeleteOne(context.Background(), bson.M{"_id": mongoMigrationLockID})
+		}()
+	}
+
+	recorded, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int64]bool{}
+	for _, r := range recorded {
+		applied[r.Version] = true
+	}
+	versions := make([]int64, len(mongoMigrations))
+	byVersion := make(map[int64]mongoMigration, len(mongoMigrations))
+	for i, mm := range mongoMigrations {
+		versions[i] = mm.Version
+		byVersion[mm.Version] = mm
+	}
+	plan, err := planMigrations(versions, applied, down, opts.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &mongoMigrationRun{db: m.db, serviceRequests: m.serviceRequests, dryRun: opts.DryRun, logf: opts.logf}
+	var done []MigrationStatus
+	for _, v := range plan {
+		mm := byVersion[v]
+		step := mm.Up
+		if down {
+			step = mm.Down
+		}
+		if step == nil {
+			return done, fmt.Errorf("migration %d_%s cannot be reverted", mm.Version, mm.Name)
+		}
+		opts.logf("%s %d_%s", migrationVerb(down, opts.DryRun), mm.Version, mm.Name)
+		if err := step(ctx, run); err != nil {
+			return done, fmt.Errorf("%w: migration %d_%s: %v", ErrDatabase, mm.Version, mm.Name, err)
+		}
+		if !opts.DryRun {
+			if err := m.record(ctx, mm, down); err != nil {
+				return done, err
+			}
+		}
+		done = append(done, MigrationStatus{Version: mm.Version, Name: mm.Name})
+	}
+	return done, nil
+}
+
+// record marks mm applied (or, migrating down, no longer applied).
+func (m *MongoMigrator) record(ctx context.Context, mm mongoMigration, down bool) error {
+	coll := m.db.GetCollection(mongoMigrationsCollection)
+	var err error
+	if down {
+		_, err = coll.DeleteOne(ctx, bson.M{"_id": mm.Version})
+	} else {
+		_, err = coll.InsertOne(ctx, migrationDoc{Version: mm.Version, Name: mm.Name, AppliedAt: time.Now().UTC()})
+	}
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: recording migration %d_%s: %v", ErrDatabase, mm.Version, mm.Name, err)
+	}
+	return nil
+}
@@ -141,3 +141,9 @@ func (db *MongoDB) GetContext() (context.Context, context.CancelFunc) {
 		time.Duration(db.config.OperationTimeout)*time.Second,
 	)
 }
+
+// DropDatabase deletes the configured database and everything in it. Meant for
+// disposable test databases.
+func (db *MongoDB) DropDatabase(ctx context.Context) error {
+	return db.database.Drop(ctx)
+}
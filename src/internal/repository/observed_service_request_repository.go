@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// ChangeObserver is told about committed writes made through an
+// ObservedServiceRequestRepository. It runs synchronously after the write, on
+// a context that is not cancelled with the request, and must not block.
+type ChangeObserver func(ctx context.Context, changes []ServiceRequestChange)
+
+// observeChunk is how many requests BulkUpsert reads back per query (the
+// largest page Find returns).
+const observeChunk = 100
+
+var _ ServiceRequestRepository = (*ObservedServiceRequestRepository)(nil)
+
+// ObservedServiceRequestRepository decorates a ServiceRequestRepository so
+// every successful write is reported to observers, with the status the
+// request had before. Unlike the MongoDB change feed it works with any
+// backend, but it only sees writes made through this process. PurgeDeleted
+// removes tombstones that were already reported deleted and is not observed.
+type ObservedServiceRequestRepository struct {
+	ServiceRequestRepository
+	observers []ChangeObserver
+}
+
+// NewObservedServiceRequestRepository wraps inner, reporting its writes to
+// observers.
+func NewObservedServiceRequestRepository(inner ServiceRequestRepository, observers ...ChangeObserver) *ObservedServiceRequestRepository {
+	return &ObservedServiceRequestRepository{ServiceRequestRepository: inner, observers: observers}
+}
+
+func (r *ObservedServiceRequestRepository) notify(ctx context.Context, changes ...ServiceRequestChange) {
+	if len(changes) == 0 {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	for _, observe := range r.observers {
+		observe(ctx, changes)
+	}
+}
+
+// change builds the change for a stored request.
+func change(operation string, req models.ServiceRequest, previousStatus string) ServiceRequestChange {
+	return ServiceRequestChange{
+		Operation:        operation,
+		ServiceRequestID: req.ServiceRequestID,
+		Request:          req,
+		At:               req.UpdatedDatetime,
+		PreviousStatus:   previousStatus,
+	}
+}
+
+// previous returns the live request about to be written, or ok=false when
+// there is none.
+func (r *ObservedServiceRequestRepository) previous(ctx context.Context, serviceRequestID string) (models.ServiceRequest, bool, error) {
+	req, err := r.ServiceRequestRepository.FindByServiceRequestID(ctx, serviceRequestID)
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrInvalidID):
+		return models.ServiceRequest{}, false, nil
+	case err != nil:
+		return models.ServiceRequest{}, false, err
+	}
+	return req, true, nil
+}
+
+func (r *ObservedServiceRequestRepository) Create(ctx context.Context, req models.ServiceRequest) (models.ServiceRequest, error) {
+	stored, err := r.ServiceRequestRepository.Create(ctx, req)
+	if err != nil {
+		return models.ServiceRequest{}, err
+	}
+	r.notify(ctx, change(ChangeCreate, stored, ""))
+	return stored, nil
+}
+
+func (r *ObservedServiceRequestRepository) Upsert(ctx context.Context, req models.ServiceRequest, pre Precondition) (models.ServiceRequest, bool, error) {
+	before, _, err := r.previous(ctx, req.ServiceRequestID)
+	if err != nil {
+		return models.ServiceRequest{}, false, err
+	}
+	stored, created, err := r.ServiceRequestRepository.Upsert(ctx, req, pre)
+	if err != nil {
+		return models.ServiceRequest{}, false, err
+	}
+	if created {
+		r.notify(ctx, change(ChangeCreate, stored, ""))
+	} else {
+		r.notify(ctx, change(ChangeUpdate, stored, before.Status))
+	}
+	return stored, created, nil
+}
+
+// BulkUpsert reads the affected requests before and after the write, in
+// chunks, and reports those whose version changed (skipped and failed records
+// are not reported).
+func (r *ObservedServiceRequestRepository) BulkUpsert(ctx context.Context, reqs []models.ServiceRequest, opts BulkUpsertOptions) (BulkUpsertResult, error) {
+	ids := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		if req.ServiceRequestID != "" {
+			ids = append(ids, req.ServiceRequestID)
+		}
+	}
+	before, err := r.findByIDs(ctx, ids)
+	if err != nil {
+		return BulkUpsertResult{}, err
+	}
+	res, err := r.ServiceRequestRepository.BulkUpsert(ctx, reqs, opts)
+	if err != nil || res.Created+res.Updated == 0 {
+		return res, err
+	}
+	after, err := r.findByIDs(ctx, ids)
+	if err != nil {
+		// The write succeeded; only the notification is lost.
+		return res, nil
+	}
+
+	changes := make([]ServiceRequestChange, 0, res.Created+res.Updated)
+	seen := make(map[string]bool, len(after))
+	for _, id := range ids {
+		stored, ok := after[id]
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		prev, existed := before[id]
+		switch {
+		case !existed:
+			changes = append(changes, change(ChangeCreate, stored, ""))
+		case prev.Version != stored.Version:
+			changes = append(changes, change(ChangeUpdate, stored, prev.Status))
+		}
+	}
+	r.notify(ctx, changes...)
+	return res, nil
+}
+
+// findByIDs returns the stored requests (tombstones included) by
+// service_request_id.
+func (r *ObservedServiceRequestRepository) findByIDs(ctx context.Context, ids []string) (map[string]models.ServiceRequest, error) {
+	found := make(map[string]models.ServiceRequest, len(ids))
+	for start := 0; start < len(ids); start += observeChunk {
+		end := min(start+observeChunk, len(ids))
+		reqs, err := r.ServiceRequestRepository.Find(ctx, ServiceRequestQuery{
+			ServiceRequestIDs: ids[start:end],
+			IncludeDeleted:    true,
+			PerPage:           observeChunk,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, req := range reqs {
+			found[req.ServiceRequestID] = req
+		}
+	}
+	return found, nil
+}
+
+func (r *ObservedServiceRequestRepository) Patch(ctx context.Context, serviceRequestID string, patch ServiceRequestPatch, pre Precondition) (models.ServiceRequest, error) {
+	before, _, err := r.previous(ctx, serviceRequestID)
+	if err != nil {
+		return models.ServiceRequest{}, err
+	}
+	stored, err := r.ServiceRequestRepository.Patch(ctx, serviceRequestID, patch, pre)
+	if err != nil {
+		return models.ServiceRequest{}, err
+	}
+	r.notify(ctx, change(ChangeUpdate, stored, before.Status))
+	return stored, nil
+}
+
+// Delete reads the tombstone back after the soft delete, so observers see the
+// deleted request.
+func (r *ObservedServiceRequestRepository) Delete(ctx context.Context, serviceRequestID string, pre Precondition) error {
+	before, _, err := r.previous(ctx, serviceRequestID)
+	if err != nil {
+		return err
+	}
+	if err := r.ServiceRequestRepository.Delete(ctx, serviceRequestID, pre); err != nil {
+		return err
+	}
+	tombstone := before
+	if after, err := r.findByIDs(ctx, []string{serviceRequestID}); err == nil {
+		if t, ok := after[serviceRequestID]; ok {
+			tombstone = t
+		}
+	}
+	if tombstone.DeletedAt == nil {
+		now := storedTime(time.Now())
+		tombstone.DeletedAt, tombstone.UpdatedDatetime = &now, now
+	}
+	r.notify(ctx, change(ChangeDelete, tombstone, before.Status))
+	return nil
+}
+
+// Erase is reported as an update that leaves the status unchanged.
+func (r *ObservedServiceRequestRepository) Erase(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error) {
+	stored, err := r.ServiceRequestRepository.Erase(ctx, serviceRequestID)
+	if err != nil {
+		return models.ServiceRequest{}, err
+	}
+	operation := ChangeUpdate
+	if stored.DeletedAt != nil {
+		operation = ChangeDelete
+	}
+	r.notify(ctx, change(operation, stored, stored.Status))
+	return stored, nil
+}
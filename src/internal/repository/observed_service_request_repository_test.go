@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+func TestObservedServiceRequestRepository(t *testing.T) {
+	ctx := context.Background()
+	var got []ServiceRequestChange
+	repo := NewObservedServiceRequestRepository(NewMemoryServiceRequestRepository(),
+		func(ctx context.Context, changes []ServiceRequestChange) {
+			assert.NoError(t, ctx.Err())
+			got = append(got, changes...)
+		})
+	last := func() ServiceRequestChange {
+		t.Helper()
+		require.NotEmpty(t, got)
+		return got[len(got)-1]
+	}
+
+	created, err := repo.Create(ctx, models.ServiceRequest{ServiceCode: "pothole"})
+	require.NoError(t, err)
+	assert.Equal(t, ChangeCreate, last().Operation)
+	assert.Equal(t, created.ServiceRequestID, last().ServiceRequestID)
+
+	_, err = repo.Patch(ctx, created.ServiceRequestID,
+		ServiceRequestPatch{Fields: map[string]interface{}{"status": "closed"}}, Precondition{})
+	require.NoError(t, err)
+	assert.Equal(t, ChangeUpdate, last().Operation)
+	assert.Equal(t, "open", last().PreviousStatus)
+	assert.Equal(t, "closed", last().Request.Status)
+
+	upserted := created
+	upserted.Status = "open"
+	_, isNew, err := repo.Upsert(ctx, upserted, Precondition{})
+	require.NoError(t, err)
+	assert.False(t, isNew)
+	assert.Equal(t, "closed", last().PreviousStatus)
+
+	_, isNew, err = repo.Upsert(ctx, models.ServiceRequest{ServiceRequestID: "sr-new", ServiceCode: "graffiti"}, Precondition{})
+	require.NoError(t, err)
+	assert.True(t, isNew)
+	assert.Equal(t, ChangeCreate, last().Operation)
+
+	// Only the records actually written are reported.
+	got = nil
+	res, err := repo.BulkUpsert(ctx, []models.ServiceRequest{
+		{ServiceRequestID: "sr-new", ServiceCode: "graffiti", Status: "closed", UpdatedDatetime: time.Now().Add(time.Hour)},
+		{ServiceRequestID: "sr-bulk", ServiceCode: "graffiti"},
+		{ServiceRequestID: created.ServiceRequestID, ServiceCode: "pothole", Status: "open",
+			UpdatedDatetime: created.UpdatedDatetime.Add(-1)},
+	}, BulkUpsertOptions{OnlyIfNewer: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Skipped)
+	require.Len(t, got, 2)
+	assert.Equal(t, ChangeUpdate, got[0].Operation)
+	assert.Equal(t, "open", got[0].PreviousStatus)
+	assert.Equal(t, "closed", got[0].Request.Status)
+	assert.Equal(t, ChangeCreate, got[1].Operation)
+	assert.Equal(t, "sr-bulk", got[1].ServiceRequestID)
+
+	require.NoError(t, repo.Delete(ctx, "sr-bulk", Precondition{}))
+	assert.Equal(t, ChangeDelete, last().Operation)
+	assert.NotNil(t, last().Request.DeletedAt)
+
+	// Failed writes are not reported.
+	got = nil
+	assert.ErrorIs(t, repo.Delete(ctx, "sr-bulk", Precondition{}), ErrNotFound)
+	_, err = repo.Patch(ctx, "missing", ServiceRequestPatch{Fields: map[string]interface{}{"status": "closed"}}, Precondition{})
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Empty(t, got)
+}
@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/timoruohomaki/open311-to-Go/config"
+)
+
+// migrationLockID is the advisory lock key serializing migrations across
+// replicas starting at the same time.
+const migrationLockID = 311_0311
+
+// Postgres represents a PostgreSQL (PostGIS) connection pool.
+type Postgres struct {
+	pool   *pgxpool.Pool
+	config config.PostgresConfig
+}
+
+// NewPostgresConnection opens a connection pool and verifies it with a ping.
+func NewPostgresConnection(cfg config.PostgresConfig) (*Postgres, error) {
+	poolCfg, err := pgxpool.ParseConfig(cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid POSTGRES_DSN: %w", err)
+	}
+	if cfg.Schema != "" {
+		// public stays on the path for the PostGIS types and functions.
+		poolCfg.ConnConfig.RuntimeParams["search_path"] = pgx.Identifier{cfg.Schema}.Sanitize() + ",public"
+	}
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = int32(cfg.MaxConns)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ConnectTimeout)*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping PostgreSQL: %w", err)
+	}
+	return &Postgres{pool: pool, config: cfg}, nil
+}
+
+// Ping verifies the PostgreSQL connection is alive.
+func (db *Postgres) Ping(ctx context.Context) error {
+	return db.pool.Ping(ctx)
+}
+
+// Close closes the connection pool.
+func (db *Postgres) Close() error {
+	db.pool.Close()
+	return nil
+}
+
+// MigrationStatus lists the embedded migrations (migrations/postgres) and
+// those recorded in schema_migrations.
+func (db *Postgres) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(BackendPostgres)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := pgAppliedMigrations(ctx, db.pool)
+	if err != nil {
+		return nil, err
+	}
+	known := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		known[i] = m.status()
+	}
+	return mergeMigrationStatus(known, applied), nil
+}
+
+// MigrateUp applies the pending embedded migrations in version order, each in
+// its own transaction, recording them in schema_migrations. It is safe to run
+// concurrently from several replicas.
+func (db *Postgres) MigrateUp(ctx context.Context, opts MigrateOptions) ([]MigrationStatus, error) {
+	return db.migrate(ctx, false, opts)
+}
+
+// MigrateDown reverts the latest applied migrations with their down scripts.
+func (db *Postgres) MigrateDown(ctx context.Context, opts MigrateOptions) ([]MigrationStatus, error) {
+	return db.migrate(ctx, true, opts)
+}
+
+func (db *Postgres) migrate(ctx context.Context, down bool, opts MigrateOptions) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(BackendPostgres)
+	if err != nil {
+		return nil, err
+	}
+	versions, byVersion := indexMigrations(migrations)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer func() {
+		_, _ = conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+	}()
+
+	if !opts.DryRun {
+		if db.config.Schema != "" {
+			if _, err := conn.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+pgx.Identifier{db.config.Schema}.Sanitize()); err != nil {
+				return nil, fmt.Errorf("%w: creating schema: %v", ErrDatabase, err)
+			}
+		}
+		if _, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    bigint PRIMARY KEY,
+			name       text NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`); err != nil {
+			return nil, fmt.Errorf("%w: creating schema_migrations: %v", ErrDatabase, err)
+		}
+	}
+
+	recorded, err := pgAppliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int64]bool{}
+	for _, m := range recorded {
+		applied[m.Version] = true
+	}
+	plan, err := planMigrations(versions, applied, down, opts.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []MigrationStatus
+	for _, v := range plan {
+		m := byVersion[v]
+		script, err := m.script(down)
+		if err != nil {
+			return done, err
+		}
+		opts.logf("%s %d_%s", migrationVerb(down, opts.DryRun), m.Version, m.Name)
+		if opts.DryRun {
+			opts.logf("%s", strings.TrimSpace(script))
+			done = append(done, m.status())
+			continue
+		}
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, script); err != nil {
+				return err
+			}
+			if down {
+				_, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("%w: migration %d_%s: %v", ErrDatabase, m.Version, m.Name, err)
+		}
+		done = append(done, m.status())
+	}
+	return done, nil
+}
+
+// pgQuerier is satisfied by both the pool and a pooled connection.
+type pgQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// pgAppliedMigrations reads schema_migrations; none when it does not exist.
+func pgAppliedMigrations(ctx context.Context, q pgQuerier) ([]MigrationStatus, error) {
+	var exists bool
+	if err := q.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+	rows, err := q.Query(ctx, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	applied, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (MigrationStatus, error) {
+		var (
+			m  MigrationStatus
+			at time.Time
+		)
+		err := row.Scan(&m.Version, &m.Name, &at)
+		at = at.UTC()
+		m.AppliedAt = &at
+		return m, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return applied, nil
+}
+
+// isUniqueViolation reports a PostgreSQL unique_violation (23505).
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// DropSchema deletes the configured schema and everything in it. Meant for
+// disposable test schemas.
+func (db *Postgres) DropSchema(ctx context.Context) error {
+	if db.config.Schema == "" {
+		return fmt.Errorf("no POSTGRES_SCHEMA configured")
+	}
+	_, err := db.pool.Exec(ctx, "DROP SCHEMA IF EXISTS "+pgx.Identifier{db.config.Schema}.Sanitize()+" CASCADE")
+	return err
+}
+
+// EnsurePropertyIndexes creates a secondary index on each of the properties
+// keys (PROPERTY_INDEX_KEYS), over the byte-ordered expression the property
+// filters compare. It is idempotent and only ever adds: indexes on keys
+// dropped from the list stay until removed by hand.
+func (db *Postgres) EnsurePropertyIndexes(ctx context.Context, keys []string) error {
+	if err := validPropertyIndexKeys(keys); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		sql := `CREATE INDEX IF NOT EXISTS ` + propertyIndexName(k) +
+			` ON service_requests (((properties->>` + sqlPropertyKey(k) + `) COLLATE "C"))`
+		if _, err := db.pool.Exec(ctx, sql); err != nil {
+			return fmt.Errorf("creating index on properties %q: %w", k, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const pgImportJobColumns = `id, status, format, dictionary, only_if_newer, file, size, rows_read, created, updated,
+	unchanged, skipped, failed, samples, error, cancel_requested, attempts, created_at, updated_at, started_at,
+	finished_at, lease_until`
+
+// PostgresImportJobRepository implements ImportJobRepository on PostgreSQL.
+type PostgresImportJobRepository struct {
+	db *Postgres
+}
+
+// NewPostgresImportJobRepository creates a PostgresImportJobRepository.
+func NewPostgresImportJobRepository(db *Postgres) ImportJobRepository {
+	return &PostgresImportJobRepository{db: db}
+}
+
+func scanImportJob(row pgx.Row) (models.ImportJob, error) {
+	var (
+		j       models.ImportJob
+		samples []byte
+	)
+	c := &j.Counts
+	if err := row.Scan(&j.ID, &j.Status, &j.Format, &j.Dictionary, &j.OnlyIfNewer, &j.File, &j.Size,
+		&c.Rows, &c.Created, &c.Updated, &c.Unchanged, &c.Skipped, &c.Failed, &samples, &j.Error,
+		&j.CancelRequested, &j.Attempts, &j.CreatedAt, &j.UpdatedAt, &j.StartedAt, &j.FinishedAt, &j.LeaseUntil); err != nil {
+		return models.ImportJob{}, err
+	}
+	var err error
+	if j.Samples, err = parseSamples(samples); err != nil {
+		return models.ImportJob{}, err
+	}
+	j.CreatedAt, j.UpdatedAt = j.CreatedAt.UTC(), j.UpdatedAt.UTC()
+	j.StartedAt, j.FinishedAt, j.LeaseUntil = storedTimePtr(j.StartedAt), storedTimePtr(j.FinishedAt), storedTimePtr(j.LeaseUntil)
+	return j, nil
+}
+
+// Create stores a job, assigning its id, created_at and updated_at.
+func (r *PostgresImportJobRepository) Create(ctx context.Context, job models.ImportJob) (models.ImportJob, error) {
+	now := storedTime(time.Now())
+	c := job.Counts
+	j, err := scanImportJob(r.db.pool.QueryRow(ctx, `INSERT INTO import_jobs (`+pgImportJobColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $18, $19, $20, $21)
+		RETURNING `+pgImportJobColumns,
+		primitive.NewObjectID().Hex(), job.Status, job.Format, job.Dictionary, job.OnlyIfNewer, job.File, job.Size,
+		c.Rows, c.Created, c.Updated, c.Unchanged, c.Skipped, c.Failed, samplesJSON(job.Samples), job.Error,
+		job.CancelRequested, job.Attempts, now, storedTimePtr(job.StartedAt), storedTimePtr(job.FinishedAt),
+		storedTimePtr(job.LeaseUntil)))
+	if err != nil {
+		return models.ImportJob{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return j, nil
+}
+
+// FindByID returns the job with the given id.
+func (r *PostgresImportJobRepository) FindByID(ctx context.Context, id string) (models.ImportJob, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.ImportJob{}, ErrInvalidID
+	}
+	j, err := scanImportJob(r.db.pool.QueryRow(ctx, "SELECT "+pgImportJobColumns+" FROM import_jobs WHERE id = $1", id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ImportJob{}, ErrNotFound
+	}
+	if err != nil {
+		return models.ImportJob{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return j, nil
+}
+
+// transition runs a conditional UPDATE ... RETURNING on job id (the first
+// argument). A job that exists but does not match is ErrInvalidState.
+func (r *PostgresImportJobRepository) transition(ctx context.Context, sql string, args ...interface{}) (models.ImportJob, error) {
+	id := args[0].(string)
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.ImportJob{}, ErrInvalidID
+	}
+	j, err := scanImportJob(r.db.pool.QueryRow(ctx, sql+" RETURNING "+pgImportJobColumns, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := r.FindByID(ctx, id); err != nil {
+			return models.ImportJob{}, err
+		}
+		return models.ImportJob{}, ErrInvalidState
+	}
+	if err != nil {
+		return models.ImportJob{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return j, nil
+}
+
+// Claim claims the oldest waiting job in one statement; SKIP LOCKED lets
+// concurrent workers claim different jobs.
+func (r *PostgresImportJobRepository) Claim(ctx context.Context, now time.Time, lease time.Duration) (models.ImportJob, error) {
+	j, err := scanImportJob(r.db.pool.QueryRow(ctx, `WITH next AS (
+			SELECT id AS next_id FROM import_jobs
+			WHERE status = 'queued' OR (status = 'running' AND lease_until < $1)
+			ORDER BY id LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE import_jobs SET status = 'running', attempts = attempts + 1, lease_until = $2,
+			started_at = coalesce(started_at, $1), updated_at = $1
+		FROM next WHERE id = next.next_id
+		RETURNING `+pgImportJobColumns,
+		storedTime(now), storedTime(now.Add(lease))))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.ImportJob{}, ErrNotFound
+	}
+	if err != nil {
+		return models.ImportJob{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return j, nil
+}
+
+// Update records the progress or outcome of a claimed job.
+func (r *PostgresImportJobRepository) Update(ctx context.Context, job models.ImportJob) (models.ImportJob, error) {
+	c := job.Counts
+	return r.transition(ctx, `UPDATE import_jobs SET status = $3, rows_read = $4, created = $5, updated = $6,
+		unchanged = $7, skipped = $8, failed = $9, samples = $10, error = $11, lease_until = $12,
+		finished_at = $13, updated_at = $14
+		WHERE id = $1 AND status = 'running' AND attempts = $2`,
+		job.ID, job.Attempts, job.Status, c.Rows, c.Created, c.Updated, c.Unchanged, c.Skipped, c.Failed,
+		samplesJSON(job.Samples), job.Error, storedTimePtr(job.LeaseUntil), storedTimePtr(job.FinishedAt),
+		storedTime(time.Now()))
+}
+
+// Cancel cancels a queued job or asks a running one to stop, in one
+// statement.
+func (r *PostgresImportJobRepository) Cancel(ctx context.Context, id string) (models.ImportJob, error) {
+	return r.transition(ctx, `UPDATE import_jobs SET
+		status = CASE WHEN status = 'queued' THEN 'cancelled' ELSE status END,
+		finished_at = CASE WHEN status = 'queued' THEN $2 ELSE finished_at END,
+		cancel_requested = (status = 'running'), updated_at = $2
+		WHERE id = $1 AND status IN ('queued', 'running')`,
+		id, storedTime(time.Now()))
+}
+
+// Resume queues a failed or cancelled job again.
+func (r *PostgresImportJobRepository) Resume(ctx context.Context, id string) (models.ImportJob, error) {
+	return r.transition(ctx, `UPDATE import_jobs SET status = 'queued', error = '', cancel_requested = false,
+		finished_at = NULL, lease_until = NULL, updated_at = $2
+		WHERE id = $1 AND status IN ('failed', 'cancelled')`,
+		id, storedTime(time.Now()))
+}
+
+// Close is a no-op; the pool is closed with the Storage.
+func (r *PostgresImportJobRepository) Close() error {
+	return nil
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const pgServiceColumns = `id, service_code, service_name, description, metadata, type, keywords,
+	service_group, attributes, created_at, updated_at`
+
+// PostgresServiceRepository implements ServiceRepository on PostgreSQL with the
+// same semantics as the MongoDB implementation (hex ids, unique service_code).
+type PostgresServiceRepository struct {
+	db *Postgres
+}
+
+// NewPostgresServiceRepository creates a PostgresServiceRepository.
+func NewPostgresServiceRepository(db *Postgres) ServiceRepository {
+	return &PostgresServiceRepository{db: db}
+}
+
+func scanService(row pgx.Row) (models.Service, error) {
+	var (
+		s     models.Service
+		attrs []byte
+	)
+	if err := row.Scan(&s.ID, &s.ServiceCode, &s.ServiceName, &s.Description, &s.Metadata, &s.Type,
+		&s.Keywords, &s.Group, &attrs, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return models.Service{}, err
+	}
+	if len(attrs) > 0 {
+		if err := json.Unmarshal(attrs, &s.Attributes); err != nil {
+			return models.Service{}, err
+		}
+	}
+	s.CreatedAt, s.UpdatedAt = s.CreatedAt.UTC(), s.UpdatedAt.UTC()
+	return s, nil
+}
+
+// serviceError maps a single-row service statement error.
+func serviceError(err error, code string) error {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return ErrNotFound
+	case isUniqueViolation(err):
+		return fmt.Errorf("%w: duplicate service_code %q", ErrDatabase, code)
+	default:
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+}
+
+// FindAll returns all services in insertion order.
+func (r *PostgresServiceRepository) FindAll(ctx context.Context) ([]models.Service, error) {
+	rows, err := r.db.pool.Query(ctx, "SELECT "+pgServiceColumns+" FROM services ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer rows.Close()
+
+	services := make([]models.Service, 0)
+	for rows.Next() {
+		s, err := scanService(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		services = append(services, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return services, nil
+}
+
+// FindByID returns the service with the given id.
+func (r *PostgresServiceRepository) FindByID(ctx context.Context, id string) (models.Service, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.Service{}, ErrInvalidID
+	}
+	s, err := scanService(r.db.pool.QueryRow(ctx, "SELECT "+pgServiceColumns+" FROM services WHERE id = $1", id))
+	if err != nil {
+		return models.Service{}, serviceError(err, "")
+	}
+	return s, nil
+}
+
+// Create adds a service, assigning its id and timestamps.
+func (r *PostgresServiceRepository) Create(ctx context.Context, service models.Service) (models.Service, error) {
+	attrs, err := jsonbValue(service.Attributes, len(service.Attributes) == 0)
+	if err != nil {
+		return models.Service{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	now := storedTime(time.Now())
+	s, err := scanService(r.db.pool.QueryRow(ctx, `INSERT INTO services
+		(id, service_code, service_name, description, metadata, type, keywords, service_group, attributes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10) RETURNING `+pgServiceColumns,
+		primitive.NewObjectID().Hex(), service.ServiceCode, service.ServiceName, service.Description,
+		service.Metadata, service.Type, service.Keywords, service.Group, attrs, now))
+	if err != nil {
+		return models.Service{}, serviceError(err, service.ServiceCode)
+	}
+	return s, nil
+}
+
+// Update replaces the mutable fields of a service; service_code and createdAt
+// are kept, as in the MongoDB implementation.
+func (r *PostgresServiceRepository) Update(ctx context.Context, service models.Service) (models.Service, error) {
+	if _, err := primitive.ObjectIDFromHex(service.ID); err != nil {
+		return models.Service{}, ErrInvalidID
+	}
+	attrs, err := jsonbValue(service.Attributes, len(service.Attributes) == 0)
+	if err != nil {
+		return models.Service{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	s, err := scanService(r.db.pool.QueryRow(ctx, `UPDATE services SET service_name = $2, description = $3,
+		metadata = $4, type = $5, keywords = $6, service_group = $7, attributes = $8, updated_at = $9
+		WHERE id = $1 RETURNING `+pgServiceColumns,
+		service.ID, service.ServiceName, service.Description, service.Metadata, service.Type,
+		service.Keywords, service.Group, attrs, storedTime(time.Now())))
+	if err != nil {
+		return models.Service{}, serviceError(err, service.ServiceCode)
+	}
+	return s, nil
+}
+
+// Delete removes a service.
+func (r *PostgresServiceRepository) Delete(ctx context.Context, id string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return ErrInvalidID
+	}
+	tag, err := r.db.pool.Exec(ctx, "DELETE FROM services WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Close is a no-op; the pool is closed with the Storage.
+func (r *PostgresServiceRepository) Close() error {
+	return nil
+}
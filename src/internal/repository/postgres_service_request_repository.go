@@ -0,0 +1,685 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sqlServiceRequestColumns is the service request select list. The SQL
+// backends share the column names; scanServiceRequest reads the PostgreSQL types.
+const sqlServiceRequestColumns = `id, service_request_id, status, status_notes, service_name, service_code,
+	description, agency_responsible, service_notice, requested_datetime, updated_datetime,
+	expected_datetime, address, address_id, zipcode, lat, long, media_url, feature_id,
+	feature_guid, organization_id, email, first_name, last_name, phone, device_id, account_id,
+	properties, properties_schema_version, version, deleted_at, erased_at`
+
+// sqlServiceRequestWriteColumns are the columns a full write sets, in
+// pgWriteArgs order.
+// service_request_id comes first: it is the natural key and never updated.
+var sqlServiceRequestWriteColumns = []string{
+	"service_request_id", "status", "status_notes", "service_name", "service_code",
+	"description", "agency_responsible", "service_notice", "requested_datetime",
+	"updated_datetime", "expected_datetime", "address", "address_id", "zipcode", "lat", "long",
+	"media_url", "feature_id", "feature_guid", "organization_id", "email", "first_name",
+	"last_name", "phone", "device_id", "account_id", "properties", "properties_schema_version",
+}
+
+// sqlPersonalColumns maps the personal-data columns to the value Erase scrubs
+// them to (see personalServiceRequestFields).
+var sqlPersonalColumns = map[string]string{
+	"description": "''",
+	"media_url":   "''",
+	"email":       "NULL",
+	"first_name":  "NULL",
+	"last_name":   "NULL",
+	"phone":       "NULL",
+	"device_id":   "NULL",
+	"account_id":  "NULL",
+}
+
+// nullString maps "" to SQL NULL (the omitempty fields).
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// nullTime maps the zero time to SQL NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	st := storedTime(t)
+	return &st
+}
+
+// jsonbValue encodes v as JSON text for a jsonb column, or NULL when empty.
+func jsonbValue(v interface{}, empty bool) (*string, error) {
+	if empty {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	s := string(raw)
+	return &s, nil
+}
+
+// pgWriteArgs returns the values of sqlServiceRequestWriteColumns for req.
+func pgWriteArgs(req models.ServiceRequest) ([]interface{}, error) {
+	props, err := jsonbValue(req.Properties, len(req.Properties) == 0)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{
+		req.ServiceRequestID, req.Status, req.StatusNotes, req.ServiceName, req.ServiceCode,
+		req.Description, req.AgencyResponsible, req.ServiceNotice, storedTime(req.RequestedDatetime),
+		storedTime(req.UpdatedDatetime), nullTime(req.ExpectedDatetime), req.Address, req.AddressID,
+		req.Zipcode, req.Latitude, req.Longitude, req.MediaURL, nullString(derefString(req.FeatureID)),
+		nullString(derefString(req.FeatureGuid)), nullString(req.OrganizationID), nullString(req.Email),
+		nullString(req.FirstName), nullString(req.LastName), nullString(req.Phone),
+		nullString(req.DeviceID), nullString(req.AccountID), props, req.PropertiesSchemaVersion,
+	}, nil
+}
+
+// scanServiceRequest reads one row selected with sqlServiceRequestColumns.
+func scanServiceRequest(row pgx.Row, extra ...interface{}) (models.ServiceRequest, error) {
+	var (
+		req                                                    models.ServiceRequest
+		expected                                               *time.Time
+		featureID, featureGuid, orgID                          *string
+		email, firstName, lastName, phone, deviceID, accountID *string
+		props                                                  []byte
+	)
+	dest := []interface{}{
+		&req.ID, &req.ServiceRequestID, &req.Status, &req.StatusNotes, &req.ServiceName, &req.ServiceCode,
+		&req.Description, &req.AgencyResponsible, &req.ServiceNotice, &req.RequestedDatetime, &req.UpdatedDatetime,
+		&expected, &req.Address, &req.AddressID, &req.Zipcode, &req.Latitude, &req.Longitude, &req.MediaURL, &featureID,
+		&featureGuid, &orgID, &email, &firstName, &lastName, &phone, &deviceID, &accountID,
+		&props, &req.PropertiesSchemaVersion, &req.Version, &req.DeletedAt, &req.ErasedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return models.ServiceRequest{}, err
+	}
+
+	req.RequestedDatetime = req.RequestedDatetime.UTC()
+	req.UpdatedDatetime = req.UpdatedDatetime.UTC()
+	if expected != nil {
+		req.ExpectedDatetime = expected.UTC()
+	}
+	if req.DeletedAt != nil {
+		t := req.DeletedAt.UTC()
+		req.DeletedAt = &t
+	}
+	if req.ErasedAt != nil {
+		t := req.ErasedAt.UTC()
+		req.ErasedAt = &t
+	}
+	req.FeatureID, req.FeatureGuid = featureID, featureGuid
+	req.OrganizationID = derefString(orgID)
+	req.Email, req.FirstName, req.LastName = derefString(email), derefString(firstName), derefString(lastName)
+	req.Phone, req.DeviceID, req.AccountID = derefString(phone), derefString(deviceID), derefString(accountID)
+	if len(props) > 0 {
+		if err := json.Unmarshal(props, &req.Properties); err != nil {
+			return models.ServiceRequest{}, err
+		}
+		if len(req.Properties) == 0 {
+			req.Properties = nil
+		}
+	}
+	return req, nil
+}
+
+// pgAssignments builds the SET list of a full write: every write column except
+// service_request_id takes value(i, col), personal columns stay scrubbed on
+// erased rows, the version is bumped and a tombstone is resurrected.
+func pgAssignments(value func(i int, col string) string) string {
+	sets := make([]string, 0, len(sqlServiceRequestWriteColumns)+1)
+	for i, col := range sqlServiceRequestWriteColumns {
+		if i == 0 {
+			continue
+		}
+		v := value(i, col)
+		if scrubbed, ok := sqlPersonalColumns[col]; ok {
+			v = "CASE WHEN service_requests.erased_at IS NULL THEN " + v + " ELSE " + scrubbed + " END"
+		}
+		sets = append(sets, col+" = "+v)
+	}
+	return strings.Join(append(sets, "version = service_requests.version + 1", "deleted_at = NULL"), ", ")
+}
+
+// pgUpsertSQL inserts a request or replaces the stored one ($1 is the new id,
+// then sqlServiceRequestWriteColumns). With onlyIfNewer an existing row is only replaced when
+// its updated_datetime is older, otherwise no row is returned.
+func pgUpsertSQL(onlyIfNewer bool, returning string) string {
+	placeholders := make([]string, len(sqlServiceRequestWriteColumns))
+	for i := range sqlServiceRequestWriteColumns {
+		placeholders[i] = "$" + strconv.Itoa(i+2)
+	}
+	sql := "INSERT INTO service_requests (id, " + strings.Join(sqlServiceRequestWriteColumns, ", ") + ", version) VALUES ($1, " +
+		strings.Join(placeholders, ", ") + ", 1) ON CONFLICT (service_request_id) DO UPDATE SET " +
+		pgAssignments(func(_ int, col string) string { return "EXCLUDED." + col })
+	if onlyIfNewer {
+		sql += " WHERE service_requests.updated_datetime < EXCLUDED.updated_datetime"
+	}
+	return sql + " RETURNING " + returning
+}
+
+// pgReplaceSQL replaces the stored row identified by $1 with sqlServiceRequestWriteColumns
+// ($1..), optionally only at one of the versions in the following parameter.
+func pgReplaceSQL(withVersions bool) string {
+	sql := "UPDATE service_requests SET " +
+		pgAssignments(func(i int, _ string) string { return "$" + strconv.Itoa(i+1) }) +
+		" WHERE service_request_id = $1"
+	if withVersions {
+		sql += " AND version = ANY($" + strconv.Itoa(len(sqlServiceRequestWriteColumns)+1) + ")"
+	}
+	return sql + " RETURNING " + sqlServiceRequestColumns
+}
+
+// pgWhere accumulates a WHERE clause with numbered parameters.
+type pgWhere struct {
+	clauses []string
+	args    []interface{}
+	// tsquery is the text search expression, for ranking by relevance.
+	tsquery string
+}
+
+// arg adds a parameter and returns its placeholder.
+func (w *pgWhere) arg(v interface{}) string {
+	w.args = append(w.args, v)
+	return "$" + strconv.Itoa(len(w.args))
+}
+
+func (w *pgWhere) add(clause string) {
+	w.clauses = append(w.clauses, clause)
+}
+
+func (w *pgWhere) String() string {
+	if len(w.clauses) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.clauses, " AND ")
+}
+
+// pgTSQuery builds the tsquery of s ("" when s requires nothing): its
+// phrases ANDed, or its terms ORed, minus its negated terms.
+func pgTSQuery(w *pgWhere, s TextSearch) string {
+	tokens, all := s.required()
+	if len(tokens) == 0 {
+		return ""
+	}
+	fn, op := "plainto_tsquery", " || "
+	if all {
+		fn, op = "phraseto_tsquery", " && "
+	}
+	parts := make([]string, len(tokens))
+	for i, t := range tokens {
+		parts[i] = fn + "('english', " + w.arg(t) + ")"
+	}
+	tsquery := "(" + strings.Join(parts, op) + ")"
+	for _, e := range s.Excluded {
+		tsquery += " && (!! plainto_tsquery('english', " + w.arg(e) + "))"
+	}
+	return "(" + tsquery + ")"
+}
+
+// serviceRequestWhere translates the filters of q (not the pagination).
+func serviceRequestWhere(q ServiceRequestQuery) *pgWhere {
+	w := &pgWhere{}
+	if !q.IncludeDeleted {
+		w.add("deleted_at IS NULL")
+	}
+	if len(q.ServiceRequestIDs) > 0 {
+		w.add("service_request_id = ANY(" + w.arg(q.ServiceRequestIDs) + ")")
+	}
+	if len(q.ServiceCodes) > 0 {
+		w.add("service_code = ANY(" + w.arg(q.ServiceCodes) + ")")
+	}
+	if len(q.ExcludeServiceCodes) > 0 {
+		w.add("NOT (service_code = ANY(" + w.arg(q.ExcludeServiceCodes) + "))")
+	}
+	if len(q.Statuses) > 0 {
+		w.add("status = ANY(" + w.arg(q.Statuses) + ")")
+	}
+	if q.FeatureID != "" {
+		w.add("feature_id = " + w.arg(q.FeatureID))
+	}
+	if q.FeatureGuid != "" {
+		w.add("feature_guid = " + w.arg(q.FeatureGuid))
+	}
+	if q.OrganizationID != "" {
+		w.add("organization_id = " + w.arg(q.OrganizationID))
+	}
+	if q.StartDate != nil {
+		w.add("requested_datetime >= " + w.arg(*q.StartDate))
+	}
+	if q.EndDate != nil {
+		w.add("requested_datetime <= " + w.arg(*q.EndDate))
+	}
+	if q.UpdatedAfter != nil {
+		w.add("updated_datetime >= " + w.arg(*q.UpdatedAfter))
+	}
+	if q.UpdatedBefore != nil {
+		w.add("updated_datetime <= " + w.arg(*q.UpdatedBefore))
+	}
+	if q.Near != nil {
+		point := "public.ST_SetSRID(public.ST_MakePoint(" + w.arg(q.Near.Long) + "::float8, " + w.arg(q.Near.Lat) + "::float8), 4326)::public.geography"
+		w.add("public.ST_DWithin(location, " + point + ", " + w.arg(q.Near.RadiusMeters) + "::float8, false)")
+	}
+	if q.Within != nil {
+		b := q.Within
+		w.add("location::public.geometry OPERATOR(public.&&) public.ST_MakeEnvelope(" + w.arg(b.MinLong) + "::float8, " +
+			w.arg(b.MinLat) + "::float8, " + w.arg(b.MaxLong) + "::float8, " + w.arg(b.MaxLat) + "::float8, 4326)")
+	}
+	if s := q.textSearch(); !s.IsZero() {
+		if w.tsquery = pgTSQuery(w, s); w.tsquery == "" {
+			w.add("false")
+		} else {
+			w.add("search @@ " + w.tsquery)
+		}
+	}
+	for _, f := range q.Properties {
+		w.add(pgPropertyFilter(w, f))
+	}
+	return w
+}
+
+// pgPropertyFilter translates one property filter. Strings compare in byte
+// order (COLLATE "C") like the other backends, on the expression
+// EnsurePropertyIndexes indexes; numeric comparisons cast the values matching
+// numericPattern and skip the rest.
+func pgPropertyFilter(w *pgWhere, f PropertyFilter) string {
+	value := "(properties->>" + sqlPropertyKey(f.Key) + ")"
+	switch f.Op {
+	case PropertyExists:
+		return value + " IS NOT NULL"
+	case PropertyMissing:
+		return value + " IS NULL"
+	case PropertyNe:
+		f.Op = PropertyEq
+		return "NOT coalesce(" + pgPropertyFilter(w, f) + ", false)"
+	}
+	number := func() string {
+		return "CASE WHEN " + value + " ~ " + w.arg(numericPattern) + " THEN " + value + "::float8 END"
+	}
+	if f.Op == PropertyEq {
+		if !f.Numeric {
+			return value + ` COLLATE "C" = ANY(` + w.arg(f.Values) + "::text[])"
+		}
+		return number() + " = ANY(" + w.arg(f.numbers()) + "::float8[])"
+	}
+	op := propertyOperators[f.Op].sql
+	if !f.Numeric {
+		return value + ` COLLATE "C" ` + op + " " + w.arg(f.value())
+	}
+	n, ok := propertyNumber(f.value())
+	if !ok {
+		return "false"
+	}
+	return number() + " " + op + " " + w.arg(n) + "::float8"
+}
+
+// PostgresServiceRequestRepository implements ServiceRequestRepository on
+// PostgreSQL/PostGIS with the same semantics as the MongoDB implementation.
+type PostgresServiceRequestRepository struct {
+	db *Postgres
+}
+
+// NewPostgresServiceRequestRepository creates a PostgresServiceRequestRepository.
+func NewPostgresServiceRequestRepository(db *Postgres) ServiceRequestRepository {
+	return &PostgresServiceRequestRepository{db: db}
+}
+
+func (r *PostgresServiceRequestRepository) query(ctx context.Context, sql string, args ...interface{}) ([]models.ServiceRequest, error) {
+	rows, err := r.db.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer rows.Close()
+
+	results := make([]models.ServiceRequest, 0)
+	for rows.Next() {
+		req, err := scanServiceRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		results = append(results, req)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return results, nil
+}
+
+// queryOne runs a single-row statement, mapping no rows to ErrNotFound.
+func (r *PostgresServiceRequestRepository) queryOne(ctx context.Context, q pgx.Tx, sql string, args ...interface{}) (models.ServiceRequest, error) {
+	var row pgx.Row
+	if q != nil {
+		row = q.QueryRow(ctx, sql, args...)
+	} else {
+		row = r.db.pool.QueryRow(ctx, sql, args...)
+	}
+	req, err := scanServiceRequest(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ServiceRequest{}, ErrNotFound
+		}
+		return models.ServiceRequest{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return req, nil
+}
+
+// pgIDOrder is the tie-breaker of listings: ids compare bytewise, like ObjectIDs.
+const pgIDOrder = `id COLLATE "C"`
+
+// Find lists service requests matching the query in its sort order, with the
+// same pagination as the MongoDB implementation.
+func (r *PostgresServiceRequestRepository) Find(ctx context.Context, q ServiceRequestQuery) ([]models.ServiceRequest, error) {
+	sql, w := pgListing(q)
+	skip, limit := q.window()
+	return r.query(ctx, sql+" LIMIT "+w.arg(limit)+" OFFSET "+w.arg(skip), w.args...)
+}
+
+// Each streams the requests matching q from one query, in the order of Find.
+func (r *PostgresServiceRequestRepository) Each(ctx context.Context, q ServiceRequestQuery, fn func(models.ServiceRequest) error) error {
+	sql, w := pgListing(q)
+	rows, err := r.db.pool.Query(ctx, sql, w.args...)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		req, err := scanServiceRequest(rows)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		if err := fn(req); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return nil
+}
+
+// pgListing builds the ordered listing of q, cursor included, without its
+// page window.
+func pgListing(q ServiceRequestQuery) (string, *pgWhere) {
+	w := serviceRequestWhere(q)
+	var orderBy, after string
+	if q.After != nil {
+		orderBy, after = q.sqlOrder(pgIDOrder, w.arg(storedTime(q.After.Value)), w.arg(q.After.ID))
+		w.add(after)
+	} else {
+		orderBy, _ = q.sqlOrder(pgIDOrder, "", "")
+	}
+	if q.byRelevance() && w.tsquery != "" {
+		orderBy = "ts_rank(search, " + w.tsquery + ") DESC, " + orderBy
+	}
+	return "SELECT " + sqlServiceRequestColumns + " FROM service_requests" + w.String() + " ORDER BY " + orderBy, w
+}
+
+// Count returns how many requests match the filters of q.
+func (r *PostgresServiceRequestRepository) Count(ctx context.Context, q ServiceRequestQuery) (int64, error) {
+	w := serviceRequestWhere(q)
+	var n int64
+	if err := r.db.pool.QueryRow(ctx, "SELECT count(*) FROM service_requests"+w.String(), w.args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return n, nil
+}
+
+// FindByServiceRequestID returns the live request with the given id.
+func (r *PostgresServiceRequestRepository) FindByServiceRequestID(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error) {
+	return r.queryOne(ctx, nil, "SELECT "+sqlServiceRequestColumns+
+		" FROM service_requests WHERE service_request_id = $1 AND deleted_at IS NULL", serviceRequestID)
+}
+
+// Create inserts a new service request with the same defaults as the MongoDB
+// implementation; a duplicate service_request_id is ErrDatabase.
+func (r *PostgresServiceRequestRepository) Create(ctx context.Context, req models.ServiceRequest) (models.ServiceRequest, error) {
+	id := primitive.NewObjectID().Hex()
+	now := time.Now().UTC()
+	if req.ServiceRequestID == "" {
+		req.ServiceRequestID = id
+	}
+	if req.Status == "" {
+		req.Status = "open"
+	}
+	if req.RequestedDatetime.IsZero() {
+		req.RequestedDatetime = now
+	}
+	req.UpdatedDatetime = now
+
+	args, err := pgWriteArgs(req)
+	if err != nil {
+		return models.ServiceRequest{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	placeholders := make([]string, len(sqlServiceRequestWriteColumns))
+	for i := range sqlServiceRequestWriteColumns {
+		placeholders[i] = "$" + strconv.Itoa(i+2)
+	}
+	sql := "INSERT INTO service_requests (id, " + strings.Join(sqlServiceRequestWriteColumns, ", ") + ", version) VALUES ($1, " +
+		strings.Join(placeholders, ", ") + ", 1) RETURNING " + sqlServiceRequestColumns
+	return r.queryOne(ctx, nil, sql, append([]interface{}{id}, args...)...)
+}
+
+// Upsert inserts or fully replaces the request identified by
+// req.ServiceRequestID in one statement. See MongoServiceRequestRepository.Upsert.
+func (r *PostgresServiceRequestRepository) Upsert(ctx context.Context, req models.ServiceRequest, pre Precondition) (models.ServiceRequest, bool, error) {
+	if req.ServiceRequestID == "" {
+		return models.ServiceRequest{}, false, ErrInvalidID
+	}
+	applyUpsertDefaults(&req, time.Now().UTC())
+	args, err := pgWriteArgs(req)
+	if err != nil {
+		return models.ServiceRequest{}, false, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+
+	if pre.Conditional() {
+		sql := pgReplaceSQL(len(pre.IfVersions) > 0)
+		if len(pre.IfVersions) > 0 {
+			args = append(args, pre.IfVersions)
+		}
+		stored, err := r.queryOne(ctx, nil, sql, args...)
+		if errors.Is(err, ErrNotFound) {
+			return models.ServiceRequest{}, false, ErrPreconditionFailed
+		}
+		return stored, false, err
+	}
+
+	var created bool
+	row := r.db.pool.QueryRow(ctx, pgUpsertSQL(false, sqlServiceRequestColumns+", (xmax = 0)"),
+		append([]interface{}{primitive.NewObjectID().Hex()}, args...)...)
+	stored, err := scanServiceRequest(row, &created)
+	if err != nil {
+		return models.ServiceRequest{}, false, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return stored, created, nil
+}
+
+// BulkUpsert inserts-or-replaces many requests in one round trip, with the
+// same de-duplication, defaults and OnlyIfNewer semantics as the MongoDB
+// implementation. The batch runs in a single transaction: a database error
+// fails it as a whole.
+func (r *PostgresServiceRequestRepository) BulkUpsert(ctx context.Context, reqs []models.ServiceRequest, opts BulkUpsertOptions) (BulkUpsertResult, error) {
+	res := BulkUpsertResult{Requested: len(reqs)}
+	if len(reqs) == 0 {
+		return res, nil
+	}
+
+	now := time.Now().UTC()
+	order, byID := dedupeBulk(reqs, opts, &res)
+	if len(order) == 0 {
+		return res, nil
+	}
+
+	sql := pgUpsertSQL(opts.OnlyIfNewer, "(xmax = 0)")
+	batch := &pgx.Batch{}
+	for _, id := range order {
+		req := byID[id]
+		applyUpsertDefaults(&req, now)
+		args, err := pgWriteArgs(req)
+		if err != nil {
+			return res, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		batch.Queue(sql, append([]interface{}{primitive.NewObjectID().Hex()}, args...)...)
+	}
+
+	var outcomes map[string]BulkOutcome
+	err := pgx.BeginFunc(ctx, r.db.pool, func(tx pgx.Tx) error {
+		outcomes = make(map[string]BulkOutcome, len(order))
+		br := tx.SendBatch(ctx, batch)
+		for _, id := range order {
+			var inserted bool
+			if err := br.QueryRow().Scan(&inserted); err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					outcomes[id] = BulkSkipped
+					continue
+				}
+				br.Close()
+				return err
+			}
+			if inserted {
+				outcomes[id] = BulkCreated
+			} else {
+				outcomes[id] = BulkUpdated
+			}
+		}
+		return br.Close()
+	})
+	if err != nil {
+		return res, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	res.count(outcomes)
+	res.setOutcomes(reqs, outcomes)
+	return res, nil
+}
+
+// Patch applies a partial update to a live request: the row is locked, the
+// patch applied in memory (ApplyServiceRequestPatch) and written back with the
+// version bumped. See MongoServiceRequestRepository.Patch.
+func (r *PostgresServiceRequestRepository) Patch(ctx context.Context, serviceRequestID string, patch ServiceRequestPatch, pre Precondition) (models.ServiceRequest, error) {
+	if serviceRequestID == "" {
+		return models.ServiceRequest{}, ErrInvalidID
+	}
+	if err := patch.Validate(); err != nil {
+		return models.ServiceRequest{}, errors.Join(ErrInvalidPatch, err)
+	}
+
+	var stored models.ServiceRequest
+	err := pgx.BeginFunc(ctx, r.db.pool, func(tx pgx.Tx) error {
+		current, err := r.queryOne(ctx, tx, "SELECT "+sqlServiceRequestColumns+
+			" FROM service_requests WHERE service_request_id = $1 AND deleted_at IS NULL FOR UPDATE", serviceRequestID)
+		if err != nil {
+			return err
+		}
+		if !pre.satisfiedBy(current.Version) {
+			return ErrPreconditionFailed
+		}
+		if err := ApplyServiceRequestPatch(&current, patch, time.Now().UTC()); err != nil {
+			return err
+		}
+		args, err := pgWriteArgs(current)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		stored, err = r.queryOne(ctx, tx, pgReplaceSQL(false), args...)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrPreconditionFailed) ||
+			errors.Is(err, ErrInvalidPatch) || errors.Is(err, ErrDatabase) {
+			return models.ServiceRequest{}, err
+		}
+		return models.ServiceRequest{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return stored, nil
+}
+
+// Delete soft-deletes a live request, leaving a tombstone. See
+// MongoServiceRequestRepository.Delete.
+func (r *PostgresServiceRequestRepository) Delete(ctx context.Context, serviceRequestID string, pre Precondition) error {
+	if serviceRequestID == "" {
+		return ErrInvalidID
+	}
+	now := storedTime(time.Now())
+	sql := `UPDATE service_requests SET deleted_at = $2, updated_datetime = $2, version = version + 1
+		WHERE service_request_id = $1 AND deleted_at IS NULL`
+	args := []interface{}{serviceRequestID, now}
+	if len(pre.IfVersions) > 0 {
+		sql += " AND version = ANY($3)"
+		args = append(args, pre.IfVersions)
+	}
+	tag, err := r.db.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if tag.RowsAffected() == 0 {
+		if pre.Conditional() {
+			if _, err := r.FindByServiceRequestID(ctx, serviceRequestID); err == nil {
+				return ErrPreconditionFailed
+			}
+		}
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Erase scrubs the personal data of a live request or tombstone. See
+// MongoServiceRequestRepository.Erase.
+func (r *PostgresServiceRequestRepository) Erase(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error) {
+	if serviceRequestID == "" {
+		return models.ServiceRequest{}, ErrInvalidID
+	}
+	sets := []string{"erased_at = COALESCE(erased_at, $2)", "updated_datetime = $2", "version = version + 1"}
+	for col, scrubbed := range sqlPersonalColumns {
+		sets = append(sets, col+" = "+scrubbed)
+	}
+	sql := "UPDATE service_requests SET " + strings.Join(sets, ", ") +
+		" WHERE service_request_id = $1 RETURNING " + sqlServiceRequestColumns
+	return r.queryOne(ctx, nil, sql, serviceRequestID, storedTime(time.Now()))
+}
+
+// PurgeDeleted hard-deletes tombstones soft-deleted before deletedBefore.
+func (r *PostgresServiceRequestRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	tag, err := r.db.pool.Exec(ctx, "DELETE FROM service_requests WHERE deleted_at < $1", deletedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// FindByFeature returns live requests linked to the feature (unpaginated).
+func (r *PostgresServiceRequestRepository) FindByFeature(ctx context.Context, featureID, featureGuid string) ([]models.ServiceRequest, error) {
+	w := serviceRequestWhere(ServiceRequestQuery{FeatureID: featureID, FeatureGuid: featureGuid})
+	return r.query(ctx, "SELECT "+sqlServiceRequestColumns+" FROM service_requests"+w.String()+
+		" ORDER BY requested_datetime DESC, "+pgIDOrder+" DESC", w.args...)
+}
+
+// FindByOrganization returns live requests of the organization (unpaginated).
+func (r *PostgresServiceRequestRepository) FindByOrganization(ctx context.Context, organizationID string) ([]models.ServiceRequest, error) {
+	return r.query(ctx, "SELECT "+sqlServiceRequestColumns+
+		" FROM service_requests WHERE organization_id = $1 AND deleted_at IS NULL"+
+		" ORDER BY requested_datetime DESC, "+pgIDOrder+" DESC", organizationID)
+}
@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	pgSubscriptionColumns = `id, url, secret, service_request_id, service_code, organization_id, bbox, created_at`
+	pgDeliveryColumns     = `id, subscription_id, event, service_request_id, status, attempts, response_status,
+	last_error, created_at, next_attempt_at, delivered_at, payload`
+)
+
+// PostgresSubscriptionRepository implements SubscriptionRepository on
+// PostgreSQL; deliveries go with their subscription (ON DELETE CASCADE).
+type PostgresSubscriptionRepository struct {
+	db *Postgres
+}
+
+// NewPostgresSubscriptionRepository creates a PostgresSubscriptionRepository.
+func NewPostgresSubscriptionRepository(db *Postgres) SubscriptionRepository {
+	return &PostgresSubscriptionRepository{db: db}
+}
+
+func scanSubscription(row pgx.Row) (models.Subscription, error) {
+	var s models.Subscription
+	if err := row.Scan(&s.ID, &s.URL, &s.Secret, &s.ServiceRequestID, &s.ServiceCode,
+		&s.OrganizationID, &s.BBox, &s.CreatedAt); err != nil {
+		return models.Subscription{}, err
+	}
+	s.CreatedAt = s.CreatedAt.UTC()
+	return s, nil
+}
+
+func scanDelivery(row pgx.Row) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	if err := row.Scan(&d.ID, &d.SubscriptionID, &d.Event, &d.ServiceRequestID, &d.Status, &d.Attempts,
+		&d.ResponseStatus, &d.LastError, &d.CreatedAt, &d.NextAttemptAt, &d.DeliveredAt, &d.Payload); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	d.CreatedAt = d.CreatedAt.UTC()
+	d.NextAttemptAt, d.DeliveredAt = storedTimePtr(d.NextAttemptAt), storedTimePtr(d.DeliveredAt)
+	return d, nil
+}
+
+func (r *PostgresSubscriptionRepository) queryDeliveries(ctx context.Context, sql string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	rows, err := r.db.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer rows.Close()
+
+	out := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		out = append(out, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return out, nil
+}
+
+// FindAll returns all subscriptions, oldest first.
+func (r *PostgresSubscriptionRepository) FindAll(ctx context.Context) ([]models.Subscription, error) {
+	rows, err := r.db.pool.Query(ctx, "SELECT "+pgSubscriptionColumns+" FROM subscriptions ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer rows.Close()
+
+	subs := make([]models.Subscription, 0)
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		subs = append(subs, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return subs, nil
+}
+
+// FindByID returns the subscription with the given id.
+func (r *PostgresSubscriptionRepository) FindByID(ctx context.Context, id string) (models.Subscription, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.Subscription{}, ErrInvalidID
+	}
+	s, err := scanSubscription(r.db.pool.QueryRow(ctx, "SELECT "+pgSubscriptionColumns+" FROM subscriptions WHERE id = $1", id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Subscription{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Subscription{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return s, nil
+}
+
+// Create stores a subscription, assigning its id and created_at.
+func (r *PostgresSubscriptionRepository) Create(ctx context.Context, sub models.Subscription) (models.Subscription, error) {
+	s, err := scanSubscription(r.db.pool.QueryRow(ctx, `INSERT INTO subscriptions
+		(id, url, secret, service_request_id, service_code, organization_id, bbox, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING `+pgSubscriptionColumns,
+		primitive.NewObjectID().Hex(), sub.URL, sub.Secret, sub.ServiceRequestID, sub.ServiceCode,
+		sub.OrganizationID, sub.BBox, storedTime(time.Now())))
+	if err != nil {
+		return models.Subscription{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return s, nil
+}
+
+// Delete removes a subscription; its deliveries cascade.
+func (r *PostgresSubscriptionRepository) Delete(ctx context.Context, id string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return ErrInvalidID
+	}
+	tag, err := r.db.pool.Exec(ctx, "DELETE FROM subscriptions WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CreateDeliveries queues deliveries in one batch, assigning their ids.
+func (r *PostgresSubscriptionRepository) CreateDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) ([]models.WebhookDelivery, error) {
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+	out := make([]models.WebhookDelivery, 0, len(deliveries))
+	batch := &pgx.Batch{}
+	for _, d := range deliveries {
+		if _, err := primitive.ObjectIDFromHex(d.SubscriptionID); err != nil {
+			return nil, ErrInvalidID
+		}
+		batch.Queue(`INSERT INTO webhook_deliveries (`+pgDeliveryColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING `+pgDeliveryColumns,
+			primitive.NewObjectID().Hex(), d.SubscriptionID, d.Event, d.ServiceRequestID, d.Status, d.Attempts,
+			d.ResponseStatus, d.LastError, storedTime(d.CreatedAt), storedTimePtr(d.NextAttemptAt),
+			storedTimePtr(d.DeliveredAt), d.Payload)
+	}
+	err := pgx.BeginFunc(ctx, r.db.pool, func(tx pgx.Tx) error {
+		br := tx.SendBatch(ctx, batch)
+		for range deliveries {
+			d, err := scanDelivery(br.QueryRow())
+			if err != nil {
+				br.Close()
+				return err
+			}
+			out = append(out, d)
+		}
+		return br.Close()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return out, nil
+}
+
+// ClaimDueDeliveries claims due deliveries in one statement; SKIP LOCKED lets
+// concurrent workers claim disjoint sets.
+func (r *PostgresSubscriptionRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	return r.queryDeliveries(ctx, `WITH due AS (
+			SELECT id, next_attempt_at AS due_at FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $2
+			ORDER BY next_attempt_at, id LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		), claimed AS (
+			UPDATE webhook_deliveries d SET next_attempt_at = $1 FROM due WHERE d.id = due.id
+			RETURNING d.*, due.due_at
+		)
+		SELECT `+pgDeliveryColumns+` FROM claimed ORDER BY due_at, id`,
+		storedTime(now.Add(lease)), now, limit)
+}
+
+// UpdateDelivery records the outcome of an attempt.
+func (r *PostgresSubscriptionRepository) UpdateDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	if _, err := primitive.ObjectIDFromHex(d.ID); err != nil {
+		return ErrInvalidID
+	}
+	tag, err := r.db.pool.Exec(ctx, `UPDATE webhook_deliveries SET status = $2, attempts = $3,
+		response_status = $4, last_error = $5, next_attempt_at = $6, delivered_at = $7 WHERE id = $1`,
+		d.ID, d.Status, d.Attempts, d.ResponseStatus, d.LastError,
+		storedTimePtr(d.NextAttemptAt), storedTimePtr(d.DeliveredAt))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// FindDeliveryByID returns the delivery with the given id.
+func (r *PostgresSubscriptionRepository) FindDeliveryByID(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.WebhookDelivery{}, ErrInvalidID
+	}
+	d, err := scanDelivery(r.db.pool.QueryRow(ctx, "SELECT "+pgDeliveryColumns+" FROM webhook_deliveries WHERE id = $1", id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.WebhookDelivery{}, ErrNotFound
+	}
+	if err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return d, nil
+}
+
+// FindDeliveries returns the newest deliveries of a subscription.
+func (r *PostgresSubscriptionRepository) FindDeliveries(ctx context.Context, subscriptionID, status string, limit int) ([]models.WebhookDelivery, error) {
+	if _, err := primitive.ObjectIDFromHex(subscriptionID); err != nil {
+		return nil, ErrInvalidID
+	}
+	return r.queryDeliveries(ctx, "SELECT "+pgDeliveryColumns+` FROM webhook_deliveries
+		WHERE subscription_id = $1 AND ($2::text = '' OR status = $2) ORDER BY id DESC LIMIT $3`,
+		subscriptionID, status, limit)
+}
+
+// Close is a no-op; the pool is closed with the Storage.
+func (r *PostgresSubscriptionRepository) Close() error {
+	return nil
+}
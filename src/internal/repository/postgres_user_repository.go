@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const pgUserColumns = `id, email, first_name, last_name, phone, organization, org_type, organizations,
+	created_at, updated_at`
+
+// PostgresUserRepository implements UserRepository on PostgreSQL with the same
+// semantics as the MongoDB implementation (hex ids, unique email).
+type PostgresUserRepository struct {
+	db *Postgres
+}
+
+// NewPostgresUserRepository creates a PostgresUserRepository.
+func NewPostgresUserRepository(db *Postgres) UserRepository {
+	return &PostgresUserRepository{db: db}
+}
+
+func scanUser(row pgx.Row) (models.User, error) {
+	var (
+		u    models.User
+		orgs []byte
+	)
+	if err := row.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.Phone, &u.Organization,
+		&u.OrgType, &orgs, &u.CreatedAt, &u.UpdatedAt); err != nil {
+		return models.User{}, err
+	}
+	if len(orgs) > 0 {
+		if err := json.Unmarshal(orgs, &u.Organizations); err != nil {
+			return models.User{}, err
+		}
+	}
+	u.CreatedAt, u.UpdatedAt = u.CreatedAt.UTC(), u.UpdatedAt.UTC()
+	return u, nil
+}
+
+// userError maps a single-row user statement error.
+func userError(err error, email string) error {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return ErrNotFound
+	case isUniqueViolation(err):
+		return fmt.Errorf("%w: duplicate email %q", ErrDatabase, email)
+	default:
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+}
+
+// FindAll returns all users in insertion order.
+func (r *PostgresUserRepository) FindAll(ctx context.Context) ([]models.User, error) {
+	rows, err := r.db.pool.Query(ctx, "SELECT "+pgUserColumns+" FROM users ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return users, nil
+}
+
+// FindByID returns the user with the given id.
+func (r *PostgresUserRepository) FindByID(ctx context.Context, id string) (models.User, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.User{}, ErrInvalidID
+	}
+	u, err := scanUser(r.db.pool.QueryRow(ctx, "SELECT "+pgUserColumns+" FROM users WHERE id = $1", id))
+	if err != nil {
+		return models.User{}, userError(err, "")
+	}
+	return u, nil
+}
+
+// Create adds a user, assigning its id and timestamps.
+func (r *PostgresUserRepository) Create(ctx context.Context, user models.User) (models.User, error) {
+	orgs, err := jsonbValue(user.Organizations, len(user.Organizations) == 0)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	now := storedTime(time.Now())
+	u, err := scanUser(r.db.pool.QueryRow(ctx, `INSERT INTO users
+		(id, email, first_name, last_name, phone, organization, org_type, organizations, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9) RETURNING `+pgUserColumns,
+		primitive.NewObjectID().Hex(), user.Email, user.FirstName, user.LastName, user.Phone,
+		user.Organization, string(user.OrgType), orgs, now))
+	if err != nil {
+		return models.User{}, userError(err, user.Email)
+	}
+	return u, nil
+}
+
+// Update replaces the profile fields of a user; organizations and createdAt
+// are kept, as in the MongoDB implementation.
+func (r *PostgresUserRepository) Update(ctx context.Context, user models.User) (models.User, error) {
+	if _, err := primitive.ObjectIDFromHex(user.ID); err != nil {
+		return models.User{}, ErrInvalidID
+	}
+	u, err := scanUser(r.db.pool.QueryRow(ctx, `UPDATE users SET email = $2, first_name = $3, last_name = $4,
+		phone = $5, organization = $6, org_type = $7, updated_at = $8
+		WHERE id = $1 RETURNING `+pgUserColumns,
+		user.ID, user.Email, user.FirstName, user.LastName, user.Phone, user.Organization,
+		string(user.OrgType), storedTime(time.Now())))
+	if err != nil {
+		return models.User{}, userError(err, user.Email)
+	}
+	return u, nil
+}
+
+// Delete removes a user.
+func (r *PostgresUserRepository) Delete(ctx context.Context, id string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return ErrInvalidID
+	}
+	tag, err := r.db.pool.Exec(ctx, "DELETE FROM users WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Close is a no-op; the pool is closed with the Storage.
+func (r *PostgresUserRepository) Close() error {
+	return nil
+}
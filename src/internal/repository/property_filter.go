@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"cmp"
+	"fmt"
+	"hash/crc32"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// Property filter operators.
+const (
+	PropertyEq  = "eq"
+	PropertyNe  = "ne"
+	PropertyLt  = "lt"
+	PropertyLte = "lte"
+	PropertyGt  = "gt"
+	PropertyGte = "gte"
+	// PropertyExists and PropertyMissing test for the key alone.
+	PropertyExists  = "exists"
+	PropertyMissing = "missing"
+)
+
+// propertyOperators maps the ordered comparison operators to their SQL and
+// MongoDB spelling.
+var propertyOperators = map[string]struct{ sql, mongo string }{
+	PropertyLt:  {"<", "$lt"},
+	PropertyLte: {"<=", "$lte"},
+	PropertyGt:  {">", "$gt"},
+	PropertyGte: {">=", "$gte"},
+}
+
+// ValidPropertyOp reports whether op is a property filter operator.
+func ValidPropertyOp(op string) bool {
+	switch op {
+	case PropertyEq, PropertyNe, PropertyExists, PropertyMissing:
+		return true
+	}
+	_, ok := propertyOperators[op]
+	return ok
+}
+
+// PropertyFilter tests one properties key. Values compare as strings in byte
+// order — right for the canonical dates and datetimes of the properties
+// schema — or, when Numeric, as numbers.
+//
+// PropertyEq matches any of Values and PropertyNe none of them, so requests
+// without the key match PropertyNe. The ordered operators compare with
+// Values[0]; requests without the key, or with a non-numeric value under a
+// Numeric filter, never match them.
+type PropertyFilter struct {
+	Key string
+	// Op is one of the Property* operators.
+	Op      string
+	Values  []string
+	Numeric bool
+}
+
+// numericPattern is the decimal form the backends read as a number; the SQL
+// and MongoDB filters apply the same test before casting.
+const numericPattern = `^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`
+
+var numericValue = regexp.MustCompile(numericPattern)
+
+// propertyNumber parses a stored value as a number.
+func propertyNumber(s string) (float64, bool) {
+	if !numericValue.MatchString(s) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f, err == nil
+}
+
+// numbers returns the Values that parse as numbers.
+func (f PropertyFilter) numbers() []float64 {
+	out := make([]float64, 0, len(f.Values))
+	for _, v := range f.Values {
+		if n, ok := propertyNumber(v); ok {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// value is the operand of the ordered operators.
+func (f PropertyFilter) value() string {
+	if len(f.Values) == 0 {
+		return ""
+	}
+	return f.Values[0]
+}
+
+// matches evaluates the filter in memory.
+func (f PropertyFilter) matches(props models.Properties) bool {
+	v, ok := props[f.Key]
+	switch f.Op {
+	case PropertyExists:
+		return ok
+	case PropertyMissing:
+		return !ok
+	case PropertyEq:
+		return ok && f.equals(v)
+	case PropertyNe:
+		return !ok || !f.equals(v)
+	}
+	if !ok {
+		return false
+	}
+	var c int
+	if f.Numeric {
+		a, ok := propertyNumber(v)
+		b, ok2 := propertyNumber(f.value())
+		if !ok || !ok2 {
+			return false
+		}
+		c = cmp.Compare(a, b)
+	} else {
+		c = strings.Compare(v, f.value())
+	}
+	switch f.Op {
+	case PropertyLt:
+		return c < 0
+	case PropertyLte:
+		return c <= 0
+	case PropertyGt:
+		return c > 0
+	case PropertyGte:
+		return c >= 0
+	}
+	return false
+}
+
+// equals reports whether v is one of Values.
+func (f PropertyFilter) equals(v string) bool {
+	if !f.Numeric {
+		for _, want := range f.Values {
+			if v == want {
+				return true
+			}
+		}
+		return false
+	}
+	a, ok := propertyNumber(v)
+	if !ok {
+		return false
+	}
+	for _, b := range f.numbers() {
+		if a == b {
+			return true
+		}
+	}
+	return false
+}
+
+// sqlPropertyKey quotes a properties key as an SQL string literal. Keys are
+// inlined rather than bound so the filters match the expression indexes of
+// EnsurePropertyIndexes.
+func sqlPropertyKey(key string) string {
+	return "'" + strings.ReplaceAll(key, "'", "''") + "'"
+}
+
+// propertyIndexName names the secondary index on a properties key: the key
+// with anything but letters, digits and '_' replaced, plus a checksum of the
+// key so names stay distinct and within the 63 bytes PostgreSQL allows.
+func propertyIndexName(key string) string {
+	name := []byte(key)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			name[i] = '_'
+		}
+	}
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return fmt.Sprintf("properties_%s_%08x", name, crc32.ChecksumIEEE([]byte(key)))
+}
+
+// validPropertyIndexKeys checks the configured index keys.
+func validPropertyIndexKeys(keys []string) error {
+	for _, k := range keys {
+		if err := ValidatePropertyKey(k); err != nil {
+			return fmt.Errorf("property index: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/pkg/ratelimit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// rateLimitCollection holds one document per token bucket. A TTL index on
+// expireAt (see EnsureIndexes) drops buckets once they would be full again.
+const rateLimitCollection = "rate_limits"
+
+// rateLimitDoc is the persisted token bucket.
+type rateLimitDoc struct {
+	Key       string    `bson:"_id"`
+	Tokens    float64   `bson:"tokens"`
+	UpdatedAt time.Time `bson:"updatedAt"`
+	Allowed   bool      `bson:"allowed"`
+	ExpireAt  time.Time `bson:"expireAt"`
+}
+
+// MongoRateLimitStore implements ratelimit.Store on a MongoDB collection so
+// every API replica shares the same buckets.
+type MongoRateLimitStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRateLimitStore creates a MongoRateLimitStore.
+func NewMongoRateLimitStore(db *MongoDB) *MongoRateLimitStore {
+	return &MongoRateLimitStore{collection: db.GetCollection(rateLimitCollection)}
+}
+
+// Take refills and decrements the bucket atomically on the server with a single
+// pipeline-style findOneAndUpdate (upserting a full bucket on first use), so
+// concurrent replicas never double-spend a token.
+func (s *MongoRateLimitStore) Take(ctx context.Context, key string, p ratelimit.Policy, now time.Time) (ratelimit.Decision, error) {
+	capacity := p.Capacity()
+	rate := p.RatePerSecond()
+	fillTime := time.Duration(capacity / rate * float64(time.Second))
+
+	refilled := bson.M{"$min": bson.A{
+		capacity,
+		bson.M{"$add": bson.A{
+			bson.M{"$ifNull": bson.A{"$tokens", capacity}},
+			bson.M{"$multiply": bson.A{
+				bson.M{"$divide": bson.A{
+					bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updatedAt", now}}}}}},
+					1000,
+				}},
+				rate,
+			}},
+		}},
+	}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": refilled, "updatedAt": now}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":   bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+			"expireAt": now.Add(fillTime),
+		}}},
+	}
+
+	var doc rateLimitDoc
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		return ratelimit.Decision{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return ratelimit.NewDecision(p, doc.Tokens, doc.Allowed), nil
+}
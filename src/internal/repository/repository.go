@@ -15,8 +15,37 @@ var (
 	ErrInvalidID = errors.New("invalid id")
 	// ErrDatabase is returned when a database error occurs
 	ErrDatabase = errors.New("database error")
+	// ErrPreconditionFailed is returned when a conditional write's expected
+	// version does not match the stored one (HTTP If-Match)
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrInvalidPatch is returned when a partial update names an unknown field
+	// or carries a value of the wrong type
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrInvalidCursor is returned when a listing cursor is malformed
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrInvalidProperties is returned when a write's properties do not
+	// conform to the properties schema
+	ErrInvalidProperties = errors.New("invalid properties")
+	// ErrInvalidState is returned when an action does not apply to an
+	// entity's current state (e.g. cancelling a finished import job)
+	ErrInvalidState = errors.New("invalid state")
 )
 
+// Precondition makes a write conditional on the stored state (HTTP If-Match).
+// The zero value is unconditional.
+type Precondition struct {
+	// IfVersions, when non-empty, requires the stored entity to exist at one of
+	// these versions. Version 0 matches documents written before versioning.
+	IfVersions []int64
+	// MustExist requires the entity to exist (If-Match: *).
+	MustExist bool
+}
+
+// Conditional reports whether the precondition constrains the write at all.
+func (p Precondition) Conditional() bool {
+	return p.MustExist || len(p.IfVersions) > 0
+}
+
 // Repository is a generic repository interface
 type Repository interface {
 	Close() error
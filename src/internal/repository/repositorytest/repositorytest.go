@@ -0,0 +1,862 @@
+// Package repositorytest is the conformance suite every storage backend must
+// pass. A backend's test calls Run with a function that opens an empty
+// repository.Storage; each subtest gets a fresh one.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+)
+
+// OpenFunc opens an empty storage backend for one subtest. It should register
+// its own cleanup with t.Cleanup.
+type OpenFunc func(t *testing.T) *repository.Storage
+
+// Run runs the whole suite against the backend opened by open.
+func Run(t *testing.T, open OpenFunc) {
+	t.Run("ServiceRequests", func(t *testing.T) { ServiceRequests(t, open) })
+	t.Run("Services", func(t *testing.T) { Services(t, open) })
+	t.Run("Users", func(t *testing.T) { Users(t, open) })
+	t.Run("Subscriptions", func(t *testing.T) { Subscriptions(t, open) })
+	t.Run("ImportJobs", func(t *testing.T) { ImportJobs(t, open) })
+}
+
+// base is a fixed, millisecond-aligned timestamp the fixtures count from.
+var base = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func strPtr(s string) *string { return &s }
+
+// request returns a minimal valid request requested `age` hours before base.
+func request(id, code string, age int) models.ServiceRequest {
+	return models.ServiceRequest{
+		ServiceRequestID:  id,
+		ServiceCode:       code,
+		ServiceName:       "Service " + code,
+		Status:            "open",
+		RequestedDatetime: base.Add(-time.Duration(age) * time.Hour),
+		UpdatedDatetime:   base.Add(-time.Duration(age) * time.Hour),
+	}
+}
+
+func ids(reqs []models.ServiceRequest) []string {
+	out := make([]string, 0, len(reqs))
+	for _, r := range reqs {
+		out = append(out, r.ServiceRequestID)
+	}
+	return out
+}
+
+func seed(t *testing.T, repo repository.ServiceRequestRepository, reqs ...models.ServiceRequest) {
+	t.Helper()
+	for _, req := range reqs {
+		_, _, err := repo.Upsert(context.Background(), req, repository.Precondition{})
+		require.NoError(t, err)
+	}
+}
+
+// ServiceRequests checks the ServiceRequestRepository contract.
+func ServiceRequests(t *testing.T, open OpenFunc) {
+	ctx := context.Background()
+
+	t.Run("CreateAndFind", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		in := request("", "pothole", 1)
+		in.Status = ""
+		in.FeatureID = strPtr("feature-1")
+		in.Properties = models.Properties{"ward": "3"}
+		in.PropertiesSchemaVersion = 2
+		in.Email = "reporter@example.com"
+
+		created, err := repo.Create(ctx, in)
+		require.NoError(t, err)
+		assert.NotEmpty(t, created.ID)
+		assert.NotEmpty(t, created.ServiceRequestID)
+		assert.Equal(t, "open", created.Status)
+		assert.Equal(t, int64(1), created.Version)
+
+		got, err := repo.FindByServiceRequestID(ctx, created.ServiceRequestID)
+		require.NoError(t, err)
+		assert.Equal(t, created.ID, got.ID)
+		assert.Equal(t, "pothole", got.ServiceCode)
+		assert.True(t, got.RequestedDatetime.Equal(in.RequestedDatetime))
+		require.NotNil(t, got.FeatureID)
+		assert.Equal(t, "feature-1", *got.FeatureID)
+		assert.Equal(t, models.Properties{"ward": "3"}, got.Properties)
+		assert.Equal(t, 2, got.PropertiesSchemaVersion)
+		assert.Equal(t, "reporter@example.com", got.Email)
+		assert.Equal(t, int64(1), got.Version)
+
+		_, err = repo.Create(ctx, request(created.ServiceRequestID, "pothole", 1))
+		assert.ErrorIs(t, err, repository.ErrDatabase, "duplicate service_request_id")
+
+		_, err = repo.FindByServiceRequestID(ctx, "missing")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("FindFilters", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		a := request("a", "pothole", 1)
+		a.Description = "Deep hole near the school"
+		a.OrganizationID = "org-1"
+		b := request("b", "graffiti", 2)
+		b.Status = "closed"
+		b.Address = "1 School Street"
+		b.FeatureID = strPtr("lamp-7")
+		b.FeatureGuid = strPtr("guid-7")
+		c := request("c", "pothole", 3)
+		c.UpdatedDatetime = base
+		seed(t, repo, a, b, c)
+
+		cases := []struct {
+			name  string
+			query repository.ServiceRequestQuery
+			want  []string
+		}{
+			{"all newest first", repository.ServiceRequestQuery{}, []string{"a", "b", "c"}},
+			{"ids", repository.ServiceRequestQuery{ServiceRequestIDs: []string{"c", "a"}}, []string{"a", "c"}},
+			{"service code", repository.ServiceRequestQuery{ServiceCodes: []string{"pothole"}}, []string{"a", "c"}},
+			{"excluded service code", repository.ServiceRequestQuery{ExcludeServiceCodes: []string{"pothole"}}, []string{"b"}},
+			{"included and excluded", repository.ServiceRequestQuery{ServiceCodes: []string{"pothole", "graffiti"}, ExcludeServiceCodes: []string{"graffiti"}}, []string{"a", "c"}},
+			{"status", repository.ServiceRequestQuery{Statuses: []string{"closed"}}, []string{"b"}},
+			{"start date", repository.ServiceRequestQuery{StartDate: timePtr(base.Add(-2 * time.Hour))}, []string{"a", "b"}},
+			{"end date", repository.ServiceRequestQuery{EndDate: timePtr(base.Add(-2 * time.Hour))}, []string{"b", "c"}},
+			{"updated after", repository.ServiceRequestQuery{UpdatedAfter: timePtr(base)}, []string{"c"}},
+			{"updated before", repository.ServiceRequestQuery{UpdatedBefore: timePtr(base.Add(-90 * time.Minute))}, []string{"b"}},
+			{"q case-insensitive", repository.ServiceRequestQuery{Q: "school"}, []string{"a", "b"}},
+			{"q service name", repository.ServiceRequestQuery{Q: "graffiti"}, []string{"b"}},
+			{"feature id", repository.ServiceRequestQuery{FeatureID: "lamp-7"}, []string{"b"}},
+			{"feature guid", repository.ServiceRequestQuery{FeatureGuid: "guid-7"}, []string{"b"}},
+			{"organization", repository.ServiceRequestQuery{OrganizationID: "org-1"}, []string{"a"}},
+			{"combined", repository.ServiceRequestQuery{ServiceCodes: []string{"pothole"}, Q: "deep"}, []string{"a"}},
+		}
+		for _, tc := range cases {
+			got, err := repo.Find(ctx, tc.query)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want, ids(got), tc.name)
+		}
+
+		byFeature, err := repo.FindByFeature(ctx, "lamp-7", "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b"}, ids(byFeature))
+		byOrg, err := repo.FindByOrganization(ctx, "org-1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a"}, ids(byOrg))
+	})
+
+	t.Run("PropertyFilters", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		a := request("a", "x", 1)
+		a.Properties = models.Properties{"psk5970:condition_grade": "9", "psk5970:event_date": "2025-02-10", "ward": "7"}
+		b := request("b", "x", 2)
+		b.Properties = models.Properties{"psk5970:condition_grade": "10", "psk5970:event_date": "2025-01-31", "ward": "07", "it's": "x"}
+		c := request("c", "x", 3)
+		c.Properties = models.Properties{"psk5970:condition_grade": "n/a", "ward": "12", `say "hi"`: "hi"}
+		d := request("d", "x", 4)
+		seed(t, repo, a, b, c, d)
+
+		filter := func(key, op string, numeric bool, values ...string) repository.ServiceRequestQuery {
+			return repository.ServiceRequestQuery{Properties: []repository.PropertyFilter{
+				{Key: key, Op: op, Values: values, Numeric: numeric},
+			}}
+		}
+		grade := func(op, v string, numeric bool) repository.ServiceRequestQuery {
+			return filter("psk5970:condition_grade", op, numeric, v)
+		}
+		cases := []struct {
+			name  string
+			query repository.ServiceRequestQuery
+			want  []string
+		}{
+			{"eq", grade(repository.PropertyEq, "n/a", false), []string{"c"}},
+			{"numeric gt", grade(repository.PropertyGt, "9", true), []string{"b"}},
+			{"numeric gte", grade(repository.PropertyGte, "9.0", true), []string{"a", "b"}},
+			{"numeric eq", grade(repository.PropertyEq, "1e1", true), []string{"b"}},
+			{"string lt is byte order", grade(repository.PropertyLt, "9", false), []string{"b"}},
+			{"date range", repository.ServiceRequestQuery{Properties: []repository.PropertyFilter{
+				{Key: "psk5970:event_date", Op: repository.PropertyGte, Values: []string{"2025-02-01"}},
+				{Key: "psk5970:event_date", Op: repository.PropertyLte, Values: []string{"2025-02-28"}},
+			}}, []string{"a"}},
+			{"eq list", filter("ward", repository.PropertyEq, false, "7", "12"), []string{"a", "c"}},
+			{"numeric eq list", filter("ward", repository.PropertyEq, true, "7", "3"), []string{"a", "b"}},
+			{"ne matches requests without the key", filter("ward", repository.PropertyNe, false, "7", "12"), []string{"b", "d"}},
+			{"numeric ne", filter("psk5970:condition_grade", repository.PropertyNe, true, "9"), []string{"b", "c", "d"}},
+			{"exists", filter("ward", repository.PropertyExists, false), []string{"a", "b", "c"}},
+			{"missing", filter("psk5970:event_date", repository.PropertyMissing, false), []string{"c", "d"}},
+			{"quote in key", filter("it's", repository.PropertyEq, false, "x"), []string{"b"}},
+			{"double quote in key", filter(`say "hi"`, repository.PropertyExists, false), []string{"c"}},
+		}
+		for _, tc := range cases {
+			got, err := repo.Find(ctx, tc.query)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want, ids(got), tc.name)
+			n, err := repo.Count(ctx, tc.query)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, int64(len(tc.want)), n, tc.name)
+		}
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		seed(t, repo, request("p1", "x", 1), request("p2", "x", 2), request("p3", "x", 3),
+			request("p4", "x", 4), request("p5", "x", 5))
+
+		var pages [][]string
+		for page := 1; page <= 4; page++ {
+			got, err := repo.Find(ctx, repository.ServiceRequestQuery{Page: page, PerPage: 2})
+			require.NoError(t, err)
+			pages = append(pages, ids(got))
+		}
+		assert.Equal(t, [][]string{{"p1", "p2"}, {"p3", "p4"}, {"p5"}, {}}, pages)
+	})
+
+	t.Run("TextSearch", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		// Whole words only: MongoDB and PostgreSQL match stemmed words,
+		// the other backends substrings.
+		t1 := request("t1", "graffiti", 3)
+		t1.ServiceName, t1.Description = "Graffiti removal", "Tag on the wall"
+		t2 := request("t2", "light", 2)
+		t2.ServiceName, t2.Description = "Street light", "Graffiti on a light pole near the park"
+		t3 := request("t3", "pothole", 1)
+		t3.ServiceName, t3.Description, t3.Address = "Pothole", "Deep pothole near the park", "10 Park Street"
+		t3.Properties = models.Properties{"neighborhood": "Roxbury"}
+		seed(t, repo, t1, t2, t3)
+
+		cases := []struct {
+			name string
+			q    string
+			want []string
+		}{
+			{"term", "graffiti", []string{"t2", "t1"}},
+			{"any term", "graffiti pothole", []string{"t3", "t2", "t1"}},
+			{"phrase", `"near the park"`, []string{"t3", "t2"}},
+			{"phrase required", `"light pole" park`, []string{"t2"}},
+			{"negation", "park -pothole", []string{"t2"}},
+			{"only negation", "-graffiti", []string{}},
+			{"property", "roxbury", []string{"t3"}},
+			{"short term", "10", []string{"t3"}},
+		}
+		for _, tc := range cases {
+			got, err := repo.Find(ctx, repository.ServiceRequestQuery{Q: tc.q})
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want, ids(got), tc.name)
+		}
+
+		ranked, err := repo.Find(ctx, repository.ServiceRequestQuery{Q: "graffiti", Sort: repository.SortRelevance})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"t1", "t2"}, ids(ranked), "service_name outranks description")
+		ranked, err = repo.Find(ctx, repository.ServiceRequestQuery{Q: "graffiti", Sort: repository.SortRelevance, PerPage: 1, Page: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"t2"}, ids(ranked))
+
+		n, err := repo.Count(ctx, repository.ServiceRequestQuery{Q: "park -pothole"})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		// Edits are searchable at once.
+		t1.Description = "Tag near the park"
+		seed(t, repo, t1)
+		got, err := repo.Find(ctx, repository.ServiceRequestQuery{Q: `"near the park"`})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"t3", "t2", "t1"}, ids(got))
+	})
+
+	t.Run("CursorAndSort", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		// c1..c3 share a requested_datetime, so pages must break ties by id.
+		reqs := []models.ServiceRequest{request("c1", "x", 1), request("c2", "x", 1), request("c3", "x", 1),
+			request("c4", "x", 2), request("c5", "x", 3)}
+		for i := range reqs {
+			reqs[i].UpdatedDatetime = base.Add(time.Duration(len(reqs)-i) * time.Minute)
+		}
+		seed(t, repo, reqs...)
+
+		walk := func(q repository.ServiceRequestQuery) []string {
+			var all []string
+			q.PerPage = 2
+			for i := 0; i < 5; i++ {
+				got, err := repo.Find(ctx, q)
+				require.NoError(t, err)
+				all = append(all, ids(got)...)
+				if len(got) < q.PageSize() {
+					return all
+				}
+				c := q.CursorAfter(got[len(got)-1])
+				decoded, err := repository.DecodeCursor(c.Encode())
+				require.NoError(t, err)
+				q.After = &decoded
+			}
+			t.Fatal("cursor walk did not end")
+			return nil
+		}
+
+		full, err := repo.Find(ctx, repository.ServiceRequestQuery{})
+		require.NoError(t, err)
+		assert.Equal(t, ids(full), walk(repository.ServiceRequestQuery{}), "cursor pages match the full listing")
+		assert.Equal(t, []string{"c4", "c5"}, ids(full[3:]), "newest first")
+
+		assert.Equal(t, []string{"c5", "c4", "c3", "c2", "c1"},
+			walk(repository.ServiceRequestQuery{Sort: repository.SortUpdatedDatetime, Ascending: true}))
+		assert.Equal(t, []string{"c1", "c2", "c3", "c4", "c5"},
+			walk(repository.ServiceRequestQuery{Sort: repository.SortUpdatedDatetime}))
+
+		n, err := repo.Count(ctx, repository.ServiceRequestQuery{PerPage: 1})
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), n)
+		n, err = repo.Count(ctx, repository.ServiceRequestQuery{ServiceRequestIDs: []string{"c1", "c4"}})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		require.NoError(t, repo.Delete(ctx, "c1", repository.Precondition{}))
+		n, err = repo.Count(ctx, repository.ServiceRequestQuery{})
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), n, "tombstones are not counted")
+	})
+
+	t.Run("Each", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		var reqs []models.ServiceRequest
+		for i := 0; i < 120; i++ {
+			req := request(fmt.Sprintf("e%03d", i), "x", 1)
+			req.UpdatedDatetime = base.Add(time.Duration(i%7) * time.Minute)
+			reqs = append(reqs, req)
+		}
+		seed(t, repo, reqs...)
+		require.NoError(t, repo.Delete(ctx, "e000", repository.Precondition{}))
+
+		q := repository.ServiceRequestQuery{Sort: repository.SortUpdatedDatetime, Ascending: true, IncludeDeleted: true, PerPage: 10}
+		full, err := repo.Find(ctx, repository.ServiceRequestQuery{Sort: q.Sort, Ascending: true, IncludeDeleted: true, PerPage: 100})
+		require.NoError(t, err)
+		var got []models.ServiceRequest
+		require.NoError(t, repo.Each(ctx, q, func(req models.ServiceRequest) error {
+			got = append(got, req)
+			return nil
+		}))
+		require.Len(t, got, 120, "not paged, tombstones included")
+		assert.Equal(t, ids(full), ids(got[:100]), "in the order of Find")
+
+		// A cursor continues after a record; an error from fn stops it.
+		after := q.CursorAfter(got[59])
+		q.After = &after
+		stop := errors.New("stop")
+		var rest []string
+		err = repo.Each(ctx, q, func(req models.ServiceRequest) error {
+			if rest = append(rest, req.ServiceRequestID); len(rest) == 3 {
+				return stop
+			}
+			return nil
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, ids(got[60:63]), rest)
+	})
+
+	t.Run("Geo", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		center := request("center", "x", 1)
+		center.Latitude, center.Longitude = 60.1699, 24.9384
+		north := request("north", "x", 2) // ~1 km north of center
+		north.Latitude, north.Longitude = 60.1789, 24.9384
+		far := request("far", "x", 3)
+		far.Latitude, far.Longitude = 60.2500, 25.1000
+		seed(t, repo, center, north, far, request("nowhere", "x", 4))
+
+		cases := []struct {
+			name  string
+			query repository.ServiceRequestQuery
+			want  []string
+		}{
+			{"radius 500 m", repository.ServiceRequestQuery{Near: &repository.GeoRadius{Lat: 60.1699, Long: 24.9384, RadiusMeters: 500}}, []string{"center"}},
+			{"radius 1.5 km", repository.ServiceRequestQuery{Near: &repository.GeoRadius{Lat: 60.1699, Long: 24.9384, RadiusMeters: 1500}}, []string{"center", "north"}},
+			{"bbox", repository.ServiceRequestQuery{Within: &repository.GeoBBox{MinLong: 24.90, MinLat: 60.16, MaxLong: 24.95, MaxLat: 60.175}}, []string{"center"}},
+			{"bbox wide", repository.ServiceRequestQuery{Within: &repository.GeoBBox{MinLong: 24.0, MinLat: 60.0, MaxLong: 26.0, MaxLat: 61.0}}, []string{"center", "north", "far"}},
+			{"radius and bbox", repository.ServiceRequestQuery{
+				Near:   &repository.GeoRadius{Lat: 60.1699, Long: 24.9384, RadiusMeters: 1500},
+				Within: &repository.GeoBBox{MinLong: 24.90, MinLat: 60.175, MaxLong: 24.95, MaxLat: 60.19},
+			}, []string{"north"}},
+		}
+		for _, tc := range cases {
+			got, err := repo.Find(ctx, tc.query)
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.want, ids(got), tc.name)
+		}
+	})
+
+	t.Run("UpsertReplaces", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		in := request("u1", "pothole", 1)
+		in.Properties = models.Properties{"ward": "3"}
+		in.PropertiesSchemaVersion = 1
+		in.OrganizationID = "org-1"
+
+		first, created, err := repo.Upsert(ctx, in, repository.Precondition{})
+		require.NoError(t, err)
+		assert.True(t, created)
+		assert.Equal(t, int64(1), first.Version)
+		assert.True(t, first.UpdatedDatetime.Equal(in.UpdatedDatetime), "supplied updated_datetime is kept")
+
+		replacement := request("u1", "pothole", 1)
+		replacement.Status = "closed"
+		second, created, err := repo.Upsert(ctx, replacement, repository.Precondition{})
+		require.NoError(t, err)
+		assert.False(t, created)
+		assert.Equal(t, first.ID, second.ID)
+		assert.Equal(t, int64(2), second.Version)
+		assert.Equal(t, "closed", second.Status)
+		assert.Empty(t, second.Properties, "absent optional fields are removed")
+		assert.Zero(t, second.PropertiesSchemaVersion)
+		assert.Empty(t, second.OrganizationID)
+
+		_, _, err = repo.Upsert(ctx, models.ServiceRequest{}, repository.Precondition{})
+		assert.ErrorIs(t, err, repository.ErrInvalidID)
+	})
+
+	t.Run("Preconditions", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		seed(t, repo, request("v1", "x", 1))
+		seed(t, repo, request("v1", "x", 1)) // now at version 2
+
+		stale := repository.Precondition{IfVersions: []int64{1}}
+		current := repository.Precondition{IfVersions: []int64{2}}
+
+		_, _, err := repo.Upsert(ctx, request("v1", "x", 1), stale)
+		assert.ErrorIs(t, err, repository.ErrPreconditionFailed)
+		_, _, err = repo.Upsert(ctx, request("absent", "x", 1), repository.Precondition{MustExist: true})
+		assert.ErrorIs(t, err, repository.ErrPreconditionFailed, "a conditional upsert never inserts")
+
+		status := repository.ServiceRequestPatch{Fields: map[string]interface{}{"status": "closed"}}
+		_, err = repo.Patch(ctx, "v1", status, stale)
+		assert.ErrorIs(t, err, repository.ErrPreconditionFailed)
+		assert.ErrorIs(t, repo.Delete(ctx, "v1", stale), repository.ErrPreconditionFailed)
+
+		patched, err := repo.Patch(ctx, "v1", status, current)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), patched.Version)
+		assert.NoError(t, repo.Delete(ctx, "v1", repository.Precondition{IfVersions: []int64{3}}))
+	})
+
+	t.Run("BulkUpsert", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		seed(t, repo, request("b1", "x", 5))
+
+		first := request("b2", "x", 4)
+		last := request("b2", "x", 4)
+		last.Status = "closed"
+		res, err := repo.BulkUpsert(ctx, []models.ServiceRequest{
+			request("b1", "x", 5), first, {ServiceCode: "x"}, last,
+		}, repository.BulkUpsertOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 4, res.Requested)
+		assert.Equal(t, 1, res.Created)
+		assert.Equal(t, 1, res.Updated)
+		assert.Equal(t, 1, res.Failed)
+		require.Len(t, res.Errors, 1)
+		assert.Equal(t, 2, res.Errors[0].Index)
+		assert.Equal(t, []repository.BulkOutcome{repository.BulkUpdated, repository.BulkCreated, repository.BulkFailed, repository.BulkCreated},
+			res.Outcomes, "duplicates share the outcome of the write")
+
+		got, err := repo.FindByServiceRequestID(ctx, "b2")
+		require.NoError(t, err)
+		assert.Equal(t, "closed", got.Status, "the last duplicate wins")
+
+		older := request("b1", "x", 6)
+		older.Status = "closed"
+		newer := request("b2", "x", 1)
+		newer.Status = "reopened"
+		res, err = repo.BulkUpsert(ctx, []models.ServiceRequest{older, newer}, repository.BulkUpsertOptions{OnlyIfNewer: true})
+		require.NoError(t, err)
+		assert.Equal(t, 1, res.Skipped)
+		assert.Equal(t, 1, res.Updated)
+		assert.Zero(t, res.Failed)
+		assert.Equal(t, []repository.BulkOutcome{repository.BulkSkipped, repository.BulkUpdated}, res.Outcomes)
+
+		b1, err := repo.FindByServiceRequestID(ctx, "b1")
+		require.NoError(t, err)
+		assert.Equal(t, "open", b1.Status, "an older record does not overwrite")
+		b2, err := repo.FindByServiceRequestID(ctx, "b2")
+		require.NoError(t, err)
+		assert.Equal(t, "reopened", b2.Status)
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		in := request("pa", "x", 1)
+		in.StatusNotes = "queued"
+		in.Properties = models.Properties{"ward": "3", "district": "B"}
+		seed(t, repo, in)
+
+		ward := "4"
+		got, err := repo.Patch(ctx, "pa", repository.ServiceRequestPatch{
+			Fields: map[string]interface{}{
+				"status": "closed", "status_notes": nil, "lat": 60.1699, "long": 24.9384,
+			},
+			Properties: map[string]*string{"ward": &ward, "district": nil},
+		}, repository.Precondition{})
+		require.NoError(t, err)
+		assert.Equal(t, "closed", got.Status)
+		assert.Empty(t, got.StatusNotes)
+		assert.Equal(t, models.Properties{"ward": "4"}, got.Properties)
+		assert.True(t, got.UpdatedDatetime.After(in.UpdatedDatetime), "updated_datetime is bumped")
+		assert.Equal(t, int64(2), got.Version)
+
+		near, err := repo.Find(ctx, repository.ServiceRequestQuery{
+			Near: &repository.GeoRadius{Lat: 60.1699, Long: 24.9384, RadiusMeters: 100},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"pa"}, ids(near), "the location follows patched coordinates")
+
+		got, err = repo.Patch(ctx, "pa", repository.ServiceRequestPatch{
+			Properties: map[string]*string{"ward": nil},
+		}, repository.Precondition{})
+		require.NoError(t, err)
+		assert.Empty(t, got.Properties)
+
+		_, err = repo.Patch(ctx, "missing", repository.ServiceRequestPatch{
+			Fields: map[string]interface{}{"status": "closed"},
+		}, repository.Precondition{})
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		_, err = repo.Patch(ctx, "pa", repository.ServiceRequestPatch{
+			Fields: map[string]interface{}{"service_request_id": "other"},
+		}, repository.Precondition{})
+		assert.ErrorIs(t, err, repository.ErrInvalidPatch)
+	})
+
+	t.Run("SoftDelete", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		seed(t, repo, request("d1", "x", 1), request("d2", "x", 2))
+
+		require.NoError(t, repo.Delete(ctx, "d1", repository.Precondition{}))
+		_, err := repo.FindByServiceRequestID(ctx, "d1")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		assert.ErrorIs(t, repo.Delete(ctx, "d1", repository.Precondition{}), repository.ErrNotFound)
+		_, err = repo.Patch(ctx, "d1", repository.ServiceRequestPatch{
+			Fields: map[string]interface{}{"status": "closed"},
+		}, repository.Precondition{})
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+
+		live, err := repo.Find(ctx, repository.ServiceRequestQuery{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"d2"}, ids(live))
+
+		all, err := repo.Find(ctx, repository.ServiceRequestQuery{IncludeDeleted: true})
+		require.NoError(t, err)
+		require.Equal(t, []string{"d1", "d2"}, ids(all))
+		require.NotNil(t, all[0].DeletedAt)
+		assert.Equal(t, int64(2), all[0].Version)
+
+		// A replace resurrects the tombstone.
+		back, _, err := repo.Upsert(ctx, request("d1", "x", 1), repository.Precondition{})
+		require.NoError(t, err)
+		assert.Nil(t, back.DeletedAt)
+
+		require.NoError(t, repo.Delete(ctx, "d2", repository.Precondition{}))
+		n, err := repo.PurgeDeleted(ctx, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Zero(t, n, "tombstones within retention are kept")
+		n, err = repo.PurgeDeleted(ctx, time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+
+		all, err = repo.Find(ctx, repository.ServiceRequestQuery{IncludeDeleted: true})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"d1"}, ids(all))
+	})
+
+	t.Run("Erase", func(t *testing.T) {
+		repo := open(t).ServiceRequests
+		in := request("e1", "x", 1)
+		in.Description = "I live at 5 Main St"
+		in.MediaURL = "https://example.com/photo.jpg"
+		in.Email = "reporter@example.com"
+		in.Phone = "+358401234567"
+		in.Properties = models.Properties{"ward": "3"}
+		seed(t, repo, in)
+
+		erased, err := repo.Erase(ctx, "e1")
+		require.NoError(t, err)
+		require.NotNil(t, erased.ErasedAt)
+		assert.Empty(t, erased.Description)
+		assert.Empty(t, erased.MediaURL)
+		assert.Empty(t, erased.Email)
+		assert.Empty(t, erased.Phone)
+		assert.Equal(t, "open", erased.Status, "the statistical record is kept")
+		assert.Equal(t, models.Properties{"ward": "3"}, erased.Properties)
+
+		// Re-running a feed cannot restore erased data.
+		again, _, err := repo.Upsert(ctx, in, repository.Precondition{})
+		require.NoError(t, err)
+		assert.Empty(t, again.Description)
+		assert.Empty(t, again.Email)
+		require.NotNil(t, again.ErasedAt)
+		assert.True(t, again.ErasedAt.Equal(*erased.ErasedAt))
+
+		_, err = repo.Erase(ctx, "missing")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+}
+
+func timePtr(t time.Time) *time.Time { return &t }
+
+// Services checks the ServiceRepository contract.
+func Services(t *testing.T, open OpenFunc) {
+	ctx := context.Background()
+	repo := open(t).Services
+
+	created, err := repo.Create(ctx, models.Service{ServiceCode: "pothole", ServiceName: "Pothole"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.ID)
+	assert.False(t, created.CreatedAt.IsZero())
+
+	_, err = repo.Create(ctx, models.Service{ServiceCode: "pothole"})
+	assert.ErrorIs(t, err, repository.ErrDatabase, "service_code is unique")
+
+	_, err = repo.Create(ctx, models.Service{ServiceCode: "graffiti", ServiceName: "Graffiti"})
+	require.NoError(t, err)
+
+	all, err := repo.FindAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "pothole", all[0].ServiceCode)
+
+	updated, err := repo.Update(ctx, models.Service{ID: created.ID, ServiceCode: "ignored", ServiceName: "Road damage"})
+	require.NoError(t, err)
+	assert.Equal(t, "Road damage", updated.ServiceName)
+	assert.Equal(t, "pothole", updated.ServiceCode, "service_code is immutable")
+
+	got, err := repo.FindByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Road damage", got.ServiceName)
+
+	require.NoError(t, repo.Delete(ctx, created.ID))
+	_, err = repo.FindByID(ctx, created.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	assert.ErrorIs(t, repo.Delete(ctx, created.ID), repository.ErrNotFound)
+	_, err = repo.FindByID(ctx, "not-an-id")
+	assert.ErrorIs(t, err, repository.ErrInvalidID)
+	_, err = repo.Update(ctx, models.Service{ID: "not-an-id"})
+	assert.ErrorIs(t, err, repository.ErrInvalidID)
+}
+
+// Users checks the UserRepository contract.
+func Users(t *testing.T, open OpenFunc) {
+	ctx := context.Background()
+	repo := open(t).Users
+
+	created, err := repo.Create(ctx, models.User{Email: "a@example.com", FirstName: "Ada"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.ID)
+
+	_, err = repo.Create(ctx, models.User{Email: "a@example.com"})
+	assert.ErrorIs(t, err, repository.ErrDatabase, "email is unique")
+
+	_, err = repo.Create(ctx, models.User{Email: "b@example.com", FirstName: "Bo"})
+	require.NoError(t, err)
+
+	all, err := repo.FindAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "a@example.com", all[0].Email)
+
+	updated, err := repo.Update(ctx, models.User{ID: created.ID, Email: "a@example.com", FirstName: "Ada", LastName: "L"})
+	require.NoError(t, err)
+	assert.Equal(t, "L", updated.LastName)
+
+	got, err := repo.FindByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "L", got.LastName)
+
+	require.NoError(t, repo.Delete(ctx, created.ID))
+	_, err = repo.FindByID(ctx, created.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+	_, err = repo.FindByID(ctx, "not-an-id")
+	assert.ErrorIs(t, err, repository.ErrInvalidID)
+}
+
+// Subscriptions checks the SubscriptionRepository contract, including the
+// delivery queue.
+func Subscriptions(t *testing.T, open OpenFunc) {
+	ctx := context.Background()
+	repo := open(t).Subscriptions
+
+	sub, err := repo.Create(ctx, models.Subscription{URL: "https://example.com/hook", Secret: "s3cret", ServiceCode: "pothole"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, sub.ID)
+	assert.False(t, sub.CreatedAt.IsZero())
+	other, err := repo.Create(ctx, models.Subscription{URL: "https://example.org/hook", Secret: "x", BBox: "24,60,25,61"})
+	require.NoError(t, err)
+
+	all, err := repo.FindAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, sub.ID, all[0].ID)
+	got, err := repo.FindByID(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", got.Secret)
+	assert.Equal(t, "pothole", got.ServiceCode)
+	_, err = repo.FindByID(ctx, "not-an-id")
+	assert.ErrorIs(t, err, repository.ErrInvalidID)
+
+	queued := make([]models.WebhookDelivery, 0, 3)
+	for i := 0; i < 3; i++ {
+		queued = append(queued, models.WebhookDelivery{
+			SubscriptionID:   sub.ID,
+			Event:            "service_request.created",
+			ServiceRequestID: "sr-1",
+			Status:           models.DeliveryPending,
+			CreatedAt:        base,
+			NextAttemptAt:    timePtr(base.Add(time.Duration(i) * time.Minute)),
+			Payload:          []byte(`{"n":1}`),
+		})
+	}
+	created, err := repo.CreateDeliveries(ctx, queued)
+	require.NoError(t, err)
+	require.Len(t, created, 3)
+	assert.NotEmpty(t, created[0].ID)
+	_, err = repo.CreateDeliveries(ctx, []models.WebhookDelivery{{SubscriptionID: other.ID, Event: "service_request.created",
+		Status: models.DeliveryPending, CreatedAt: base, NextAttemptAt: timePtr(base), Payload: []byte("{}")}})
+	require.NoError(t, err)
+
+	// Only due deliveries are claimed, earliest first, and a claim leases them.
+	claimed, err := repo.ClaimDueDeliveries(ctx, base.Add(time.Minute), time.Minute, 2)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	assert.Equal(t, created[0].ID, claimed[0].ID, "ties are broken by id")
+	assert.Equal(t, other.ID, claimed[1].SubscriptionID)
+	assert.Equal(t, []byte(`{"n":1}`), claimed[0].Payload)
+	claimed, err = repo.ClaimDueDeliveries(ctx, base.Add(time.Minute), time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1, "leased deliveries are not claimed again")
+	assert.Equal(t, created[1].ID, claimed[0].ID)
+	require.True(t, claimed[0].NextAttemptAt.Equal(base.Add(2*time.Minute)))
+
+	d := claimed[0]
+	d.Status, d.Attempts, d.ResponseStatus, d.LastError = models.DeliveryDead, 8, 500, "HTTP 500"
+	d.NextAttemptAt = nil
+	require.NoError(t, repo.UpdateDelivery(ctx, d))
+	stored, err := repo.FindDeliveryByID(ctx, d.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.DeliveryDead, stored.Status)
+	assert.Equal(t, 8, stored.Attempts)
+	assert.Equal(t, 500, stored.ResponseStatus)
+	assert.Equal(t, "HTTP 500", stored.LastError)
+	assert.Nil(t, stored.NextAttemptAt)
+	assert.True(t, stored.CreatedAt.Equal(base))
+	assert.ErrorIs(t, repo.UpdateDelivery(ctx, models.WebhookDelivery{ID: "not-an-id"}), repository.ErrInvalidID)
+
+	history, err := repo.FindDeliveries(ctx, sub.ID, "", 10)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, created[2].ID, history[0].ID, "newest first")
+	dead, err := repo.FindDeliveries(ctx, sub.ID, models.DeliveryDead, 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, d.ID, dead[0].ID)
+	limited, err := repo.FindDeliveries(ctx, sub.ID, "", 1)
+	require.NoError(t, err)
+	assert.Len(t, limited, 1)
+
+	require.NoError(t, repo.Delete(ctx, sub.ID))
+	assert.ErrorIs(t, repo.Delete(ctx, sub.ID), repository.ErrNotFound)
+	_, err = repo.FindDeliveryByID(ctx, d.ID)
+	assert.ErrorIs(t, err, repository.ErrNotFound, "deliveries go with their subscription")
+	remaining, err := repo.FindDeliveries(ctx, other.ID, "", 10)
+	require.NoError(t, err)
+	assert.Len(t, remaining, 1)
+}
+
+// ImportJobs checks the ImportJobRepository contract: claims, leases, fenced
+// updates, cancel and resume.
+func ImportJobs(t *testing.T, open OpenFunc) {
+	ctx := context.Background()
+	repo := open(t).ImportJobs
+
+	first, err := repo.Create(ctx, models.ImportJob{Status: models.JobQueued, Format: models.ImportFormatCSV,
+		Dictionary: "boston", OnlyIfNewer: true, File: "import-1.csv", Size: 1234})
+	require.NoError(t, err)
+	assert.NotEmpty(t, first.ID)
+	assert.False(t, first.CreatedAt.IsZero())
+	second, err := repo.Create(ctx, models.ImportJob{Status: models.JobQueued, Format: models.ImportFormatNDJSON, File: "import-2.ndjson"})
+	require.NoError(t, err)
+	got, err := repo.FindByID(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "boston", got.Dictionary)
+	assert.True(t, got.OnlyIfNewer)
+	assert.Equal(t, int64(1234), got.Size)
+	_, err = repo.FindByID(ctx, "not-an-id")
+	assert.ErrorIs(t, err, repository.ErrInvalidID)
+
+	// Claims take the oldest queued job and lease it.
+	claimed, err := repo.Claim(ctx, base, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, claimed.ID)
+	assert.Equal(t, models.JobRunning, claimed.Status)
+	assert.Equal(t, 1, claimed.Attempts)
+	require.NotNil(t, claimed.StartedAt)
+	assert.True(t, claimed.StartedAt.Equal(base))
+	require.NotNil(t, claimed.LeaseUntil)
+	assert.True(t, claimed.LeaseUntil.Equal(base.Add(time.Minute)))
+	next, err := repo.Claim(ctx, base, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, next.ID)
+	_, err = repo.Claim(ctx, base.Add(30*time.Second), time.Minute)
+	assert.ErrorIs(t, err, repository.ErrNotFound, "leased jobs are not claimed again")
+
+	// Progress is stored while the claim holds.
+	claimed.Counts = models.ImportCounts{Rows: 500, Created: 490, Skipped: 10}
+	claimed.Samples = []string{"row 7: no service"}
+	claimed.LeaseUntil = timePtr(base.Add(2 * time.Minute))
+	stored, err := repo.Update(ctx, claimed)
+	require.NoError(t, err)
+	assert.Equal(t, 490, stored.Counts.Created)
+	assert.Equal(t, []string{"row 7: no service"}, stored.Samples)
+	assert.False(t, stored.CancelRequested)
+
+	// A lapsed lease is taken over; the old worker can no longer write.
+	takenOver, err := repo.Claim(ctx, base.Add(3*time.Minute), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, takenOver.ID)
+	assert.Equal(t, 2, takenOver.Attempts)
+	assert.Equal(t, 500, takenOver.Counts.Rows, "progress survives the takeover")
+	assert.True(t, takenOver.StartedAt.Equal(base), "started_at is kept")
+	_, err = repo.Update(ctx, claimed)
+	assert.ErrorIs(t, err, repository.ErrInvalidState)
+
+	// Cancelling a running job only asks its worker to stop.
+	cancelling, err := repo.Cancel(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobRunning, cancelling.Status)
+	assert.True(t, cancelling.CancelRequested)
+	takenOver.Status, takenOver.FinishedAt, takenOver.LeaseUntil = models.JobCancelled, timePtr(base.Add(4*time.Minute)), nil
+	stored, err = repo.Update(ctx, takenOver)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobCancelled, stored.Status)
+	assert.Nil(t, stored.LeaseUntil)
+	_, err = repo.Cancel(ctx, first.ID)
+	assert.ErrorIs(t, err, repository.ErrInvalidState, "a finished job cannot be cancelled")
+
+	// Resuming queues it again with its progress.
+	resumed, err := repo.Resume(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobQueued, resumed.Status)
+	assert.False(t, resumed.CancelRequested)
+	assert.Nil(t, resumed.FinishedAt)
+	assert.Equal(t, 490, resumed.Counts.Created)
+	_, err = repo.Resume(ctx, first.ID)
+	assert.ErrorIs(t, err, repository.ErrInvalidState, "only failed or cancelled jobs resume")
+
+	// A queued job is cancelled outright.
+	cancelled, err := repo.Cancel(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobCancelled, cancelled.Status)
+	assert.NotNil(t, cancelled.FinishedAt)
+	_, err = repo.Cancel(ctx, "000000000000000000000000")
+	assert.ErrorIs(t, err, repository.ErrNotFound, "a well-formed id no job has")
+	_, err = repo.Resume(ctx, "not-an-id")
+	assert.ErrorIs(t, err, repository.ErrInvalidID)
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// PropertySchema validates and converts properties (implemented by
+// propschema.Schema). Apply checks props against version (the current one
+// when 0) and returns them in canonical form with the version they conform to.
+type PropertySchema interface {
+	Apply(props models.Properties, version int) (models.Properties, int, error)
+}
+
+var _ ServiceRequestRepository = (*SchemaServiceRequestRepository)(nil)
+
+// SchemaServiceRequestRepository decorates a ServiceRequestRepository so every
+// write's properties are validated against a PropertySchema, converted to
+// their canonical form and stamped with properties_schema_version. Reads pass
+// through unchanged, so it works with any backend.
+type SchemaServiceRequestRepository struct {
+	ServiceRequestRepository
+	schema PropertySchema
+}
+
+// NewSchemaServiceRequestRepository wraps inner with properties schema
+// validation.
+func NewSchemaServiceRequestRepository(inner ServiceRequestRepository, schema PropertySchema) *SchemaServiceRequestRepository {
+	return &SchemaServiceRequestRepository{ServiceRequestRepository: inner, schema: schema}
+}
+
+// apply converts the properties of req in place; failures wrap
+// ErrInvalidProperties.
+func (r *SchemaServiceRequestRepository) apply(req *models.ServiceRequest) error {
+	props, version, err := r.schema.Apply(req.Properties, req.PropertiesSchemaVersion)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProperties, err)
+	}
+	req.Properties, req.PropertiesSchemaVersion = props, version
+	return nil
+}
+
+func (r *SchemaServiceRequestRepository) Create(ctx context.Context, req models.ServiceRequest) (models.ServiceRequest, error) {
+	if err := r.apply(&req); err != nil {
+		return models.ServiceRequest{}, err
+	}
+	return r.ServiceRequestRepository.Create(ctx, req)
+}
+
+func (r *SchemaServiceRequestRepository) Upsert(ctx context.Context, req models.ServiceRequest, pre Precondition) (models.ServiceRequest, bool, error) {
+	if err := r.apply(&req); err != nil {
+		return models.ServiceRequest{}, false, err
+	}
+	return r.ServiceRequestRepository.Upsert(ctx, req, pre)
+}
+
+// BulkUpsert reports records whose properties do not conform as failed and
+// writes the rest; error indexes and outcomes refer to reqs.
+func (r *SchemaServiceRequestRepository) BulkUpsert(ctx context.Context, reqs []models.ServiceRequest, opts BulkUpsertOptions) (BulkUpsertResult, error) {
+	valid := make([]models.ServiceRequest, 0, len(reqs))
+	indexes := make([]int, 0, len(reqs))
+	var rejected []BulkUpsertError
+	for i, req := range reqs {
+		if err := r.apply(&req); err != nil {
+			rejected = append(rejected, BulkUpsertError{Index: i, ServiceRequestID: req.ServiceRequestID, Message: err.Error()})
+			continue
+		}
+		valid = append(valid, req)
+		indexes = append(indexes, i)
+	}
+
+	res, err := r.ServiceRequestRepository.BulkUpsert(ctx, valid, opts)
+	for i, e := range res.Errors {
+		if e.Index >= 0 && e.Index < len(indexes) {
+			res.Errors[i].Index = indexes[e.Index]
+		}
+	}
+	outcomes := make([]BulkOutcome, len(reqs))
+	for _, e := range rejected {
+		outcomes[e.Index] = BulkFailed
+	}
+	for i, o := range res.Outcomes {
+		if i < len(indexes) {
+			outcomes[indexes[i]] = o
+		}
+	}
+	res.Requested = len(reqs)
+	res.Failed += len(rejected)
+	res.Errors = append(rejected, res.Errors...)
+	res.Outcomes = outcomes
+	return res, err
+}
+
+// Patch validates the properties the request will have after the patch, at
+// its stored properties_schema_version (the current one for requests written
+// without a schema), and stores the values the patch sets in canonical form.
+// Patches that leave properties alone are not checked.
+func (r *SchemaServiceRequestRepository) Patch(ctx context.Context, serviceRequestID string, patch ServiceRequestPatch, pre Precondition) (models.ServiceRequest, error) {
+	if len(patch.Properties) == 0 && !patch.ClearProperties {
+		return r.ServiceRequestRepository.Patch(ctx, serviceRequestID, patch, pre)
+	}
+	if serviceRequestID == "" {
+		return models.ServiceRequest{}, ErrInvalidID
+	}
+	stored, err := r.ServiceRequestRepository.FindByServiceRequestID(ctx, serviceRequestID)
+	if err != nil {
+		return models.ServiceRequest{}, err
+	}
+	if err := ApplyServiceRequestPatch(&stored, patch, time.Now().UTC()); err != nil {
+		return models.ServiceRequest{}, err
+	}
+	props, _, err := r.schema.Apply(stored.Properties, stored.PropertiesSchemaVersion)
+	if err != nil {
+		return models.ServiceRequest{}, fmt.Errorf("%w: %v", ErrInvalidProperties, err)
+	}
+
+	converted := make(map[string]*string, len(patch.Properties))
+	for k, v := range patch.Properties {
+		if v != nil {
+			c := props[k]
+			v = &c
+		}
+		converted[k] = v
+	}
+	patch.Properties = converted
+	return r.ServiceRequestRepository.Patch(ctx, serviceRequestID, patch, pre)
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// gradeSchema is a stand-in for propschema.Schema at version 3: "grade" is an
+// integer and required at version 3.
+type gradeSchema struct{}
+
+func (gradeSchema) Apply(props models.Properties, version int) (models.Properties, int, error) {
+	if version == 0 {
+		version = 3
+	}
+	out := models.Properties{}
+	for k, v := range props {
+		out[k] = v
+	}
+	if g, ok := props["grade"]; ok {
+		n, err := strconv.Atoi(g)
+		if err != nil {
+			return nil, 0, errors.New("grade: not an integer")
+		}
+		out["grade"] = strconv.Itoa(n)
+	} else if version == 3 {
+		return nil, 0, errors.New("grade: required")
+	}
+	return out, version, nil
+}
+
+func TestSchemaServiceRequestRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := NewSchemaServiceRequestRepository(NewMemoryServiceRequestRepository(), gradeSchema{})
+
+	created, err := repo.Create(ctx, models.ServiceRequest{ServiceRequestID: "sr-1", ServiceCode: "x",
+		Properties: models.Properties{"grade": "07"}})
+	require.NoError(t, err)
+	assert.Equal(t, "7", created.Properties["grade"], "converted to canonical form")
+	assert.Equal(t, 3, created.PropertiesSchemaVersion, "stamped with the current version")
+
+	_, _, err = repo.Upsert(ctx, models.ServiceRequest{ServiceRequestID: "sr-2", ServiceCode: "x"}, Precondition{})
+	assert.ErrorIs(t, err, ErrInvalidProperties, "required at the current version")
+
+	old, _, err := repo.Upsert(ctx, models.ServiceRequest{ServiceRequestID: "sr-2", ServiceCode: "x", PropertiesSchemaVersion: 2}, Precondition{})
+	require.NoError(t, err, "not required at version 2")
+	assert.Equal(t, 2, old.PropertiesSchemaVersion)
+
+	t.Run("Patch", func(t *testing.T) {
+		bad, good := "high", "+5"
+		_, err := repo.Patch(ctx, "sr-1", ServiceRequestPatch{Properties: map[string]*string{"grade": &bad}}, Precondition{})
+		assert.ErrorIs(t, err, ErrInvalidProperties)
+
+		patched, err := repo.Patch(ctx, "sr-1", ServiceRequestPatch{Properties: map[string]*string{"grade": &good}}, Precondition{})
+		require.NoError(t, err)
+		assert.Equal(t, "5", patched.Properties["grade"])
+		assert.Equal(t, 3, patched.PropertiesSchemaVersion)
+
+		_, err = repo.Patch(ctx, "sr-1", ServiceRequestPatch{Properties: map[string]*string{"grade": nil}}, Precondition{})
+		assert.ErrorIs(t, err, ErrInvalidProperties, "a required key cannot be removed")
+
+		_, err = repo.Patch(ctx, "missing", ServiceRequestPatch{Properties: map[string]*string{"grade": &good}}, Precondition{})
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = repo.Patch(ctx, "sr-2", ServiceRequestPatch{Fields: map[string]interface{}{"status": "closed"}}, Precondition{})
+		assert.NoError(t, err, "patches leaving properties alone are not checked")
+	})
+
+	t.Run("BulkUpsert", func(t *testing.T) {
+		res, err := repo.BulkUpsert(ctx, []models.ServiceRequest{
+			{ServiceRequestID: "b-1", ServiceCode: "x", Properties: models.Properties{"grade": "x"}},
+			{ServiceCode: "x", Properties: models.Properties{"grade": "1"}},
+			{ServiceRequestID: "b-3", ServiceCode: "x", Properties: models.Properties{"grade": "3"}},
+		}, BulkUpsertOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 3, res.Requested)
+		assert.Equal(t, 1, res.Created)
+		assert.Equal(t, 2, res.Failed)
+		require.Len(t, res.Errors, 2)
+		assert.Equal(t, 0, res.Errors[0].Index)
+		assert.Contains(t, res.Errors[0].Message, "grade: not an integer")
+		assert.Equal(t, 1, res.Errors[1].Index, "inner error indexes refer to the caller's batch")
+		assert.Equal(t, []BulkOutcome{BulkFailed, BulkFailed, BulkCreated}, res.Outcomes)
+	})
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// textSearchFields lists what the q filter searches and how much a match in
+// each field counts towards relevance. The MongoDB text index is built from
+// it; the PostgreSQL and SQLite migrations mirror it.
+var textSearchFields = []struct {
+	name   string
+	weight int
+	value  func(req *models.ServiceRequest) string
+}{
+	{"service_name", 10, func(req *models.ServiceRequest) string { return req.ServiceName }},
+	{"description", 5, func(req *models.ServiceRequest) string { return req.Description }},
+	{"address", 2, func(req *models.ServiceRequest) string { return req.Address }},
+	{"properties.neighborhood", 2, func(req *models.ServiceRequest) string { return req.Properties["neighborhood"] }},
+}
+
+// TextSearch is a parsed q filter in MongoDB $text syntax: plain terms,
+// "quoted phrases" and -negated terms. A request matches when it contains
+// every phrase (or, without phrases, any term) and none of the negated terms;
+// a search of negated terms only matches nothing.
+type TextSearch struct {
+	Terms    []string
+	Phrases  []string
+	Excluded []string
+}
+
+// ParseTextSearch splits q into terms, phrases and negated terms. An
+// unterminated quote runs to the end of q; a dash before a phrase is ignored.
+func ParseTextSearch(q string) TextSearch {
+	var s TextSearch
+	for rest := strings.TrimSpace(q); rest != ""; rest = strings.TrimSpace(rest) {
+		negated := false
+		if rest[0] == '-' {
+			negated, rest = true, rest[1:]
+		}
+		if strings.HasPrefix(rest, `"`) {
+			phrase, tail, _ := strings.Cut(rest[1:], `"`)
+			if p := strings.Join(strings.Fields(phrase), " "); p != "" {
+				s.Phrases = append(s.Phrases, p)
+			}
+			rest = tail
+			continue
+		}
+		end := strings.IndexAny(rest, " \t\r\n\"")
+		if end < 0 {
+			end = len(rest)
+		}
+		if term := rest[:end]; term != "" {
+			if negated {
+				s.Excluded = append(s.Excluded, term)
+			} else {
+				s.Terms = append(s.Terms, term)
+			}
+		}
+		rest = rest[end:]
+	}
+	return s
+}
+
+// IsZero reports whether the search has nothing to match (an empty q).
+func (s TextSearch) IsZero() bool {
+	return len(s.Terms) == 0 && len(s.Phrases) == 0 && len(s.Excluded) == 0
+}
+
+// required returns what a match must contain: all of the phrases, or any of
+// the terms when there are no phrases (all reports which).
+func (s TextSearch) required() (tokens []string, all bool) {
+	if len(s.Phrases) > 0 {
+		return s.Phrases, true
+	}
+	return s.Terms, false
+}
+
+// String returns the canonical $search form of the search.
+func (s TextSearch) String() string {
+	parts := make([]string, 0, len(s.Terms)+len(s.Phrases)+len(s.Excluded))
+	parts = append(parts, s.Terms...)
+	for _, p := range s.Phrases {
+		parts = append(parts, `"`+p+`"`)
+	}
+	for _, e := range s.Excluded {
+		parts = append(parts, "-"+e)
+	}
+	return strings.Join(parts, " ")
+}
+
+// textSearch returns the parsed q filter of the query.
+func (q ServiceRequestQuery) textSearch() TextSearch {
+	return ParseTextSearch(q.Q)
+}
+
+// byRelevance reports whether the query is ranked by text relevance.
+func (q ServiceRequestQuery) byRelevance() bool {
+	return q.Sort == SortRelevance && q.Q != ""
+}
+
+// containsText reports whether any searched field of req contains token
+// (case-insensitive substring, as with a regex).
+func containsText(req *models.ServiceRequest, token string) bool {
+	token = strings.ToLower(token)
+	for _, f := range textSearchFields {
+		if strings.Contains(strings.ToLower(f.value(req)), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches is the search without a text index: substring matching of each
+// term, phrase and negated term.
+func (s TextSearch) matches(req *models.ServiceRequest) bool {
+	for _, e := range s.Excluded {
+		if containsText(req, e) {
+			return false
+		}
+	}
+	tokens, all := s.required()
+	if len(tokens) == 0 {
+		return false
+	}
+	for _, t := range tokens {
+		found := containsText(req, t)
+		if all && !found {
+			return false
+		}
+		if !all && found {
+			return true
+		}
+	}
+	return all
+}
+
+// score is the relevance of req without a text index: each occurrence of a
+// term or phrase counts the weight of its field.
+func (s TextSearch) score(req *models.ServiceRequest) int {
+	score := 0
+	for _, f := range textSearchFields {
+		value := strings.ToLower(f.value(req))
+		for _, tokens := range [][]string{s.Terms, s.Phrases} {
+			for _, t := range tokens {
+				score += f.weight * strings.Count(value, strings.ToLower(t))
+			}
+		}
+	}
+	return score
+}
@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// PatchFieldKind is the value type of a patchable service request field.
+type PatchFieldKind int
+
+const (
+	// PatchString is a plain string field; clearing it stores "".
+	PatchString PatchFieldKind = iota
+	// PatchOptionalString is an omitempty string field; clearing removes it.
+	PatchOptionalString
+	// PatchTime is an ISO 8601 timestamp; clearing stores the zero time.
+	PatchTime
+	// PatchFloat is a number (lat/long); clearing stores 0.
+	PatchFloat
+)
+
+// PatchableServiceRequestFields lists the fields a partial update may touch,
+// keyed by their JSON (= BSON) name. service_request_id and id are immutable;
+// properties are patched per key through ServiceRequestPatch.Properties.
+var PatchableServiceRequestFields = map[string]PatchFieldKind{
+	"status":             PatchString,
+	"status_notes":       PatchString,
+	"service_name":       PatchString,
+	"service_code":       PatchString,
+	"description":        PatchString,
+	"agency_responsible": PatchString,
+	"service_notice":     PatchString,
+	"requested_datetime": PatchTime,
+	"updated_datetime":   PatchTime,
+	"expected_datetime":  PatchTime,
+	"address":            PatchString,
+	"address_id":         PatchString,
+	"zipcode":            PatchString,
+	"lat":                PatchFloat,
+	"long":               PatchFloat,
+	"media_url":          PatchString,
+	"featureId":          PatchOptionalString,
+	"featureGuid":        PatchOptionalString,
+	"organizationId":     PatchOptionalString,
+	"email":              PatchOptionalString,
+	"first_name":         PatchOptionalString,
+	"last_name":          PatchOptionalString,
+	"phone":              PatchOptionalString,
+	"device_id":          PatchOptionalString,
+	"account_id":         PatchOptionalString,
+}
+
+// ServiceRequestPatch is a partial update (the storage-side form of an RFC 7386
+// merge patch). Fields maps a PatchableServiceRequestFields name to its new
+// value — string, time.Time or float64 per its kind — or to nil to clear it.
+// Properties sets individual properties keys, or removes them when the value
+// is nil; ClearProperties drops the whole properties object first.
+//
+// updated_datetime is bumped to now unless Fields sets it explicitly, and the
+// GeoJSON location is re-derived whenever lat or long change.
+type ServiceRequestPatch struct {
+	Fields          map[string]interface{}
+	Properties      map[string]*string
+	ClearProperties bool
+}
+
+// Validate checks field names, value types and properties keys. Keys may not
+// contain '.' or start with '$' (they become storage paths).
+func (p ServiceRequestPatch) Validate() error {
+	for name, v := range p.Fields {
+		kind, ok := PatchableServiceRequestFields[name]
+		if !ok {
+			return fmt.Errorf("field %q cannot be patched", name)
+		}
+		if v == nil {
+			if name == "service_code" || name == "status" || name == "requested_datetime" {
+				return fmt.Errorf("field %q cannot be removed", name)
+			}
+			continue
+		}
+		switch kind {
+		case PatchString, PatchOptionalString:
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("field %q must be a string", name)
+			}
+			if s == "" && (name == "service_code" || name == "status") {
+				return fmt.Errorf("field %q cannot be empty", name)
+			}
+		case PatchTime:
+			if _, ok := v.(time.Time); !ok {
+				return fmt.Errorf("field %q must be an ISO 8601 timestamp", name)
+			}
+		case PatchFloat:
+			if _, ok := v.(float64); !ok {
+				return fmt.Errorf("field %q must be a number", name)
+			}
+		}
+	}
+	for k := range p.Properties {
+		if err := ValidatePropertyKey(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidatePropertyKey rejects properties keys that cannot be stored as a field
+// path: empty, containing '.', or starting with '$'.
+func ValidatePropertyKey(k string) error {
+	if k == "" || strings.Contains(k, ".") || strings.HasPrefix(k, "$") {
+		return fmt.Errorf("invalid properties key %q (must be non-empty, without '.' and not starting with '$')", k)
+	}
+	return nil
+}
+
+// Empty reports whether the patch changes nothing.
+func (p ServiceRequestPatch) Empty() bool {
+	return len(p.Fields) == 0 && len(p.Properties) == 0 && !p.ClearProperties
+}
+
+// TouchesLocation reports whether the patch changes lat or long.
+func (p ServiceRequestPatch) TouchesLocation() bool {
+	_, lat := p.Fields["lat"]
+	_, long := p.Fields["long"]
+	return lat || long
+}
+
+// ApplyServiceRequestPatch applies a validated patch to req in memory, with the
+// same semantics the storage backends implement (including bumping
+// updated_datetime to now when the patch does not set it).
+func ApplyServiceRequestPatch(req *models.ServiceRequest, p ServiceRequestPatch, now time.Time) error {
+	if err := p.Validate(); err != nil {
+		return errors.Join(ErrInvalidPatch, err)
+	}
+	for name, v := range p.Fields {
+		s, _ := v.(string)
+		t, _ := v.(time.Time)
+		f, _ := v.(float64)
+		switch name {
+		case "status":
+			req.Status = s
+		case "status_notes":
+			req.StatusNotes = s
+		case "service_name":
+			req.ServiceName = s
+		case "service_code":
+			req.ServiceCode = s
+		case "description":
+			req.Description = s
+		case "agency_responsible":
+			req.AgencyResponsible = s
+		case "service_notice":
+			req.ServiceNotice = s
+		case "requested_datetime":
+			req.RequestedDatetime = t
+		case "updated_datetime":
+			req.UpdatedDatetime = t
+		case "expected_datetime":
+			req.ExpectedDatetime = t
+		case "address":
+			req.Address = s
+		case "address_id":
+			req.AddressID = s
+		case "zipcode":
+			req.Zipcode = s
+		case "lat":
+			req.Latitude = f
+		case "long":
+			req.Longitude = f
+		case "media_url":
+			req.MediaURL = s
+		case "featureId":
+			req.FeatureID = optionalString(v)
+		case "featureGuid":
+			req.FeatureGuid = optionalString(v)
+		case "organizationId":
+			req.OrganizationID = s
+		case "email":
+			req.Email = s
+		case "first_name":
+			req.FirstName = s
+		case "last_name":
+			req.LastName = s
+		case "phone":
+			req.Phone = s
+		case "device_id":
+			req.DeviceID = s
+		case "account_id":
+			req.AccountID = s
+		}
+	}
+	if _, ok := p.Fields["updated_datetime"]; !ok {
+		req.UpdatedDatetime = now
+	}
+
+	if p.ClearProperties {
+		req.Properties = nil
+	}
+	for k, v := range p.Properties {
+		if v == nil {
+			delete(req.Properties, k)
+			continue
+		}
+		if req.Properties == nil {
+			req.Properties = models.Properties{}
+		}
+		req.Properties[k] = *v
+	}
+	if len(req.Properties) == 0 {
+		req.Properties = nil
+	}
+	return nil
+}
+
+func optionalString(v interface{}) *string {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return nil
+	}
+	return &s
+}
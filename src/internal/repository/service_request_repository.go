@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"regexp"
 	"time"
 
 	"github.com/timoruohomaki/open311-to-Go/domain/models"
@@ -21,30 +20,93 @@ import (
 type ServiceRequestQuery struct {
 	ServiceRequestIDs []string
 	ServiceCodes      []string
-	Statuses          []string
-	StartDate         *time.Time
-	EndDate           *time.Time
-	UpdatedAfter      *time.Time
-	UpdatedBefore     *time.Time
-	Q                 string
-	FeatureID         string
-	FeatureGuid       string
-	OrganizationID    string
-	Page              int
-	PerPage           int
+	// ExcludeServiceCodes drops requests with these codes (e.g. sensitive
+	// ones from a public geo query).
+	ExcludeServiceCodes []string
+	Statuses            []string
+	StartDate           *time.Time
+	EndDate             *time.Time
+	UpdatedAfter        *time.Time
+	UpdatedBefore       *time.Time
+	// Q is a text search in MongoDB $text syntax (see TextSearch).
+	Q              string
+	FeatureID      string
+	FeatureGuid    string
+	OrganizationID string
+	// Near and Within restrict results to an area; requests without
+	// coordinates never match a geo filter.
+	Near   *GeoRadius
+	Within *GeoBBox
+	// Properties compare properties keys; all must match.
+	Properties []PropertyFilter
+	// IncludeDeleted also returns soft-deleted tombstones (admin reads and
+	// data-lake sync).
+	IncludeDeleted bool
+	// Sort is the ordering field (SortRequestedDatetime when empty), newest
+	// first unless Ascending. Ties are broken by id in the same direction.
+	// SortRelevance ranks by Q and ignores Ascending.
+	Sort      string
+	Ascending bool
+	// After continues the listing strictly after a cursor (keyset
+	// pagination); Page is then ignored. Its Sort and Ascending must match.
+	After   *Cursor
+	Page    int
+	PerPage int
+}
+
+// window returns the skip/limit for the query's page. PerPage defaults to 100
+// and is capped at 100; Page is 1-based and ignored after a cursor.
+func (q ServiceRequestQuery) window() (skip, limit int) {
+	limit = q.PerPage
+	if limit <= 0 || limit > 100 {
+		limit = 100
+	}
+	page := q.Page
+	if page < 1 || q.After != nil {
+		page = 1
+	}
+	return (page - 1) * limit, limit
+}
+
+// Matches reports whether req passes the query's filters (paging and ordering
+// aside), evaluated in memory as by the memory backend; used to filter live
+// change streams with the listing's parameters.
+func (q ServiceRequestQuery) Matches(req models.ServiceRequest) bool {
+	return matchesServiceRequestQuery(req, q, q.textSearch())
+}
+
+// BulkUpsertOptions tunes a bulk upsert.
+type BulkUpsertOptions struct {
+	// OnlyIfNewer skips records whose updated_datetime is not newer than the
+	// stored one, so re-running an older feed never overwrites fresher edits.
+	OnlyIfNewer bool
 }
 
 type ServiceRequestRepository interface {
 	Find(ctx context.Context, q ServiceRequestQuery) ([]models.ServiceRequest, error)
+	// Count returns how many requests match the filters of q, ignoring its
+	// pagination and cursor.
+	Count(ctx context.Context, q ServiceRequestQuery) (int64, error)
 	FindByServiceRequestID(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error)
 	Create(ctx context.Context, req models.ServiceRequest) (models.ServiceRequest, error)
-	Upsert(ctx context.Context, req models.ServiceRequest) (models.ServiceRequest, bool, error)
-	BulkUpsert(ctx context.Context, reqs []models.ServiceRequest) (BulkUpsertResult, error)
-	Delete(ctx context.Context, serviceRequestID string) error
+	Upsert(ctx context.Context, req models.ServiceRequest, pre Precondition) (models.ServiceRequest, bool, error)
+	BulkUpsert(ctx context.Context, reqs []models.ServiceRequest, opts BulkUpsertOptions) (BulkUpsertResult, error)
+	Patch(ctx context.Context, serviceRequestID string, patch ServiceRequestPatch, pre Precondition) (models.ServiceRequest, error)
+	Delete(ctx context.Context, serviceRequestID string, pre Precondition) error
+	Erase(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error)
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
 	FindByFeature(ctx context.Context, featureID, featureGuid string) ([]models.ServiceRequest, error)
 	FindByOrganization(ctx context.Context, organizationID string) ([]models.ServiceRequest, error)
+	// Each calls fn with every request matching q, in the order of Find,
+	// reading from a database cursor rather than loading the results; Page
+	// and PerPage are ignored. An error from fn stops it and is returned as
+	// is.
+	Each(ctx context.Context, q ServiceRequestQuery, fn func(models.ServiceRequest) error) error
 }
 
+// eachBatchSize is the number of requests Each fetches per round trip.
+const eachBatchSize = 500
+
 // serviceRequestDoc is the persistence representation of a ServiceRequest. BSON
 // tags and the ObjectID `_id` live here; the domain model exposes the id as a
 // hex string. Field names mirror the model's JSON/XML tags.
@@ -71,9 +133,51 @@ type serviceRequestDoc struct {
 	FeatureGuid       *string            `bson:"featureGuid,omitempty"`
 	OrganizationID    string             `bson:"organizationId,omitempty"`
 	Properties        map[string]string  `bson:"properties,omitempty"`
+	// PropertiesSchemaVersion is missing on requests written without a
+	// properties schema.
+	PropertiesSchemaVersion int `bson:"properties_schema_version,omitempty"`
+	// Reporter contact; personal data, possibly encrypted (see
+	// EncryptedServiceRequestRepository).
+	Email     string `bson:"email,omitempty"`
+	FirstName string `bson:"first_name,omitempty"`
+	LastName  string `bson:"last_name,omitempty"`
+	Phone     string `bson:"phone,omitempty"`
+	DeviceID  string `bson:"device_id,omitempty"`
+	AccountID string `bson:"account_id,omitempty"`
 	// Location is a GeoJSON Point [long, lat] derived from lat/long, indexed
 	// with 2dsphere for spatial queries. Omitted when no coordinates are set.
 	Location *geoPoint `bson:"location,omitempty"`
+	// Version is incremented on every write (optimistic concurrency). Missing on
+	// documents imported before versioning, which read as version 0.
+	Version int64 `bson:"version"`
+	// DeletedAt marks a soft-deleted tombstone; normal reads skip it.
+	DeletedAt *time.Time `bson:"deleted_at,omitempty"`
+	// ErasedAt records when personal data was scrubbed (see Erase).
+	ErasedAt *time.Time `bson:"erased_at,omitempty"`
+}
+
+// optionalServiceRequestFields are the omitempty fields of serviceRequestDoc.
+// A full replacement must $unset them when the new document lacks them, which
+// also resurrects a soft-deleted request. erased_at is deliberately absent: an
+// erasure survives replacement.
+var optionalServiceRequestFields = []string{
+	"featureId", "featureGuid", "organizationId", "properties", "properties_schema_version", "location", "deleted_at",
+	"email", "first_name", "last_name", "phone", "device_id", "account_id",
+}
+
+// personalServiceRequestFields are the fields holding personal data, with the
+// pipeline expression Erase scrubs them to (plain fields are emptied, optional
+// ones removed). Once a request is erased, writes can no longer restore them
+// (see scrubErasedStage).
+var personalServiceRequestFields = bson.M{
+	"description": bson.M{"$literal": ""},
+	"media_url":   bson.M{"$literal": ""},
+	"email":       "$$REMOVE",
+	"first_name":  "$$REMOVE",
+	"last_name":   "$$REMOVE",
+	"phone":       "$$REMOVE",
+	"device_id":   "$$REMOVE",
+	"account_id":  "$$REMOVE",
 }
 
 // geoPoint is a GeoJSON Point. Coordinates are [longitude, latitude].
@@ -88,54 +192,73 @@ func (d serviceRequestDoc) toModel() models.ServiceRequest {
 		id = d.ID.Hex()
 	}
 	return models.ServiceRequest{
-		ID:                id,
-		ServiceRequestID:  d.ServiceRequestID,
-		Status:            d.Status,
-		StatusNotes:       d.StatusNotes,
-		ServiceName:       d.ServiceName,
-		ServiceCode:       d.ServiceCode,
-		Description:       d.Description,
-		AgencyResponsible: d.AgencyResponsible,
-		ServiceNotice:     d.ServiceNotice,
-		RequestedDatetime: d.RequestedDatetime,
-		UpdatedDatetime:   d.UpdatedDatetime,
-		ExpectedDatetime:  d.ExpectedDatetime,
-		Address:           d.Address,
-		AddressID:         d.AddressID,
-		Zipcode:           d.Zipcode,
-		Latitude:          d.Latitude,
-		Longitude:         d.Longitude,
-		MediaURL:          d.MediaURL,
-		FeatureID:         d.FeatureID,
-		FeatureGuid:       d.FeatureGuid,
-		OrganizationID:    d.OrganizationID,
-		Properties:        models.Properties(d.Properties),
+		ID:                      id,
+		ServiceRequestID:        d.ServiceRequestID,
+		Status:                  d.Status,
+		StatusNotes:             d.StatusNotes,
+		ServiceName:             d.ServiceName,
+		ServiceCode:             d.ServiceCode,
+		Description:             d.Description,
+		AgencyResponsible:       d.AgencyResponsible,
+		ServiceNotice:           d.ServiceNotice,
+		RequestedDatetime:       d.RequestedDatetime,
+		UpdatedDatetime:         d.UpdatedDatetime,
+		ExpectedDatetime:        d.ExpectedDatetime,
+		Address:                 d.Address,
+		AddressID:               d.AddressID,
+		Zipcode:                 d.Zipcode,
+		Latitude:                d.Latitude,
+		Longitude:               d.Longitude,
+		MediaURL:                d.MediaURL,
+		FeatureID:               d.FeatureID,
+		FeatureGuid:             d.FeatureGuid,
+		OrganizationID:          d.OrganizationID,
+		Properties:              models.Properties(d.Properties),
+		PropertiesSchemaVersion: d.PropertiesSchemaVersion,
+		Email:                   d.Email,
+		FirstName:               d.FirstName,
+		LastName:                d.LastName,
+		Phone:                   d.Phone,
+		DeviceID:                d.DeviceID,
+		AccountID:               d.AccountID,
+		Version:                 d.Version,
+		DeletedAt:               d.DeletedAt,
+		ErasedAt:                d.ErasedAt,
 	}
 }
 
 func serviceRequestDocFromModel(m models.ServiceRequest) serviceRequestDoc {
 	doc := serviceRequestDoc{
-		ServiceRequestID:  m.ServiceRequestID,
-		Status:            m.Status,
-		StatusNotes:       m.StatusNotes,
-		ServiceName:       m.ServiceName,
-		ServiceCode:       m.ServiceCode,
-		Description:       m.Description,
-		AgencyResponsible: m.AgencyResponsible,
-		ServiceNotice:     m.ServiceNotice,
-		RequestedDatetime: m.RequestedDatetime,
-		UpdatedDatetime:   m.UpdatedDatetime,
-		ExpectedDatetime:  m.ExpectedDatetime,
-		Address:           m.Address,
-		AddressID:         m.AddressID,
-		Zipcode:           m.Zipcode,
-		Latitude:          m.Latitude,
-		Longitude:         m.Longitude,
-		MediaURL:          m.MediaURL,
-		FeatureID:         m.FeatureID,
-		FeatureGuid:       m.FeatureGuid,
-		OrganizationID:    m.OrganizationID,
-		Properties:        map[string]string(m.Properties),
+		ServiceRequestID:        m.ServiceRequestID,
+		Status:                  m.Status,
+		StatusNotes:             m.StatusNotes,
+		ServiceName:             m.ServiceName,
+		ServiceCode:             m.ServiceCode,
+		Description:             m.Description,
+		AgencyResponsible:       m.AgencyResponsible,
+		ServiceNotice:           m.ServiceNotice,
+		RequestedDatetime:       m.RequestedDatetime,
+		UpdatedDatetime:         m.UpdatedDatetime,
+		ExpectedDatetime:        m.ExpectedDatetime,
+		Address:                 m.Address,
+		AddressID:               m.AddressID,
+		Zipcode:                 m.Zipcode,
+		Latitude:                m.Latitude,
+		Longitude:               m.Longitude,
+		MediaURL:                m.MediaURL,
+		FeatureID:               m.FeatureID,
+		FeatureGuid:             m.FeatureGuid,
+		OrganizationID:          m.OrganizationID,
+		Properties:              map[string]string(m.Properties),
+		PropertiesSchemaVersion: m.PropertiesSchemaVersion,
+		Email:                   m.Email,
+		FirstName:               m.FirstName,
+		LastName:                m.LastName,
+		Phone:                   m.Phone,
+		DeviceID:                m.DeviceID,
+		AccountID:               m.AccountID,
+		DeletedAt:               m.DeletedAt,
+		ErasedAt:                m.ErasedAt,
 	}
 	if m.ID != "" {
 		if oid, err := primitive.ObjectIDFromHex(m.ID); err == nil {
@@ -143,7 +266,7 @@ func serviceRequestDocFromModel(m models.ServiceRequest) serviceRequestDoc {
 		}
 	}
 	// Derive the GeoJSON location (GeoJSON order is [long, lat]).
-	if m.Latitude != 0 || m.Longitude != 0 {
+	if hasLocation(m.Latitude, m.Longitude) {
 		doc.Location = &geoPoint{Type: "Point", Coordinates: []float64{m.Longitude, m.Latitude}}
 	}
 	return doc
@@ -183,16 +306,115 @@ func (r *MongoServiceRequestRepository) find(ctx context.Context, filter bson.M,
 	return results, nil
 }
 
-// Find lists service requests matching the query, newest first, with pagination
+// notDeleted restricts filter to live (not soft-deleted) requests.
+func notDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$exists": false}
+	return filter
+}
+
+// Find lists service requests matching the query in its sort order (newest
+// requested first by default, ties by _id), paginated by page or by cursor
 // (PerPage defaults to 100 and is capped at 100; Page is 1-based).
+// Soft-deleted requests are skipped unless q.IncludeDeleted is set.
 func (r *MongoServiceRequestRepository) Find(ctx context.Context, q ServiceRequestQuery) ([]models.ServiceRequest, error) {
+	filter, sort, err := listing(q)
+	if err != nil {
+		return nil, err
+	}
+	skip, limit := q.window()
+	opts := options.Find().
+		SetSort(sort).
+		SetLimit(int64(limit)).
+		SetSkip(int64(skip))
+
+	return r.find(ctx, filter, opts)
+}
+
+// Each streams the requests matching q from a cursor, in the order of Find.
+func (r *MongoServiceRequestRepository) Each(ctx context.Context, q ServiceRequestQuery, fn func(models.ServiceRequest) error) error {
+	filter, sort, err := listing(q)
+	if err != nil {
+		return err
+	}
+	cur, err := r.collection.Find(ctx, filter, options.Find().SetSort(sort).SetBatchSize(eachBatchSize))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var doc serviceRequestDoc
+		if err := cur.Decode(&doc); err != nil {
+			return fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		if err := fn(doc.toModel()); err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return nil
+}
+
+// listing returns the filter and sort of a listing of q, including its
+// cursor.
+func listing(q ServiceRequestQuery) (bson.M, bson.D, error) {
+	filter := serviceRequestFilter(q)
+	field, dir := q.sortField(), -1
+	if q.ascending() {
+		dir = 1
+	}
+	if c := q.After; c != nil {
+		oid, err := primitive.ObjectIDFromHex(c.ID)
+		if err != nil {
+			return nil, nil, ErrInvalidCursor
+		}
+		op := "$lt"
+		if q.ascending() {
+			op = "$gt"
+		}
+		after := bson.M{"$or": bson.A{
+			bson.M{field: bson.M{op: c.Value}},
+			bson.M{field: c.Value, "_id": bson.M{op: oid}},
+		}}
+		filter = bson.M{"$and": bson.A{filter, after}}
+	}
+
+	sort := bson.D{{Key: field, Value: dir}, {Key: "_id", Value: dir}}
+	if q.byRelevance() {
+		sort = append(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}}, sort...)
+	}
+	return filter, sort, nil
+}
+
+// Count returns how many requests match the filters of q.
+func (r *MongoServiceRequestRepository) Count(ctx context.Context, q ServiceRequestQuery) (int64, error) {
+	n, err := r.collection.CountDocuments(ctx, serviceRequestFilter(q))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return n, nil
+}
+
+// serviceRequestFilter translates the filters of q (not the pagination).
+func serviceRequestFilter(q ServiceRequestQuery) bson.M {
 	filter := bson.M{}
+	if !q.IncludeDeleted {
+		notDeleted(filter)
+	}
 
 	if len(q.ServiceRequestIDs) > 0 {
 		filter["service_request_id"] = bson.M{"$in": q.ServiceRequestIDs}
 	}
-	if len(q.ServiceCodes) > 0 {
-		filter["service_code"] = bson.M{"$in": q.ServiceCodes}
+	if len(q.ServiceCodes) > 0 || len(q.ExcludeServiceCodes) > 0 {
+		codes := bson.M{}
+		if len(q.ServiceCodes) > 0 {
+			codes["$in"] = q.ServiceCodes
+		}
+		if len(q.ExcludeServiceCodes) > 0 {
+			codes["$nin"] = q.ExcludeServiceCodes
+		}
+		filter["service_code"] = codes
 	}
 	if len(q.Statuses) > 0 {
 		filter["status"] = bson.M{"$in": q.Statuses}
@@ -212,35 +434,88 @@ func (r *MongoServiceRequestRepository) Find(ctx context.Context, q ServiceReque
 	if dr := dateRange(q.UpdatedAfter, q.UpdatedBefore); dr != nil {
 		filter["updated_datetime"] = dr
 	}
-	if q.Q != "" {
-		rx := primitive.Regex{Pattern: regexp.QuoteMeta(q.Q), Options: "i"}
-		filter["$or"] = bson.A{
-			bson.M{"description": rx},
-			bson.M{"service_name": rx},
-			bson.M{"address": rx},
+	if q.Near != nil {
+		filter["location"] = bson.M{"$geoWithin": bson.M{
+			"$centerSphere": bson.A{bson.A{q.Near.Long, q.Near.Lat}, q.Near.RadiusMeters / earthRadiusMeters},
+		}}
+	}
+	if q.Within != nil {
+		b := q.Within
+		within := bson.M{"$geoWithin": bson.M{"$geometry": bson.M{
+			"type": "Polygon",
+			"coordinates": bson.A{bson.A{
+				bson.A{b.MinLong, b.MinLat}, bson.A{b.MaxLong, b.MinLat},
+				bson.A{b.MaxLong, b.MaxLat}, bson.A{b.MinLong, b.MaxLat},
+				bson.A{b.MinLong, b.MinLat},
+			}},
+		}}}
+		if q.Near != nil {
+			// Both filters target location; combine them.
+			filter["$and"] = bson.A{bson.M{"location": filter["location"]}, bson.M{"location": within}}
+			delete(filter, "location")
+		} else {
+			filter["location"] = within
 		}
 	}
-
-	perPage := q.PerPage
-	if perPage <= 0 || perPage > 100 {
-		perPage = 100
+	if s := q.textSearch(); !s.IsZero() {
+		// Served by the text index (see EnsureIndexes), which matches stemmed
+		// words rather than substrings.
+		filter["$text"] = bson.M{"$search": s.String()}
 	}
-	page := q.Page
-	if page < 1 {
-		page = 1
+	if len(q.Properties) > 0 {
+		and, _ := filter["$and"].(bson.A)
+		for _, f := range q.Properties {
+			and = append(and, mongoPropertyFilter(f))
+		}
+		filter["$and"] = and
 	}
+	return filter
+}
 
-	opts := options.Find().
-		SetSort(bson.D{{Key: "requested_datetime", Value: -1}}).
-		SetLimit(int64(perPage)).
-		SetSkip(int64((page - 1) * perPage))
+// mongoPropertyFilter translates one property filter. Numeric comparisons
+// convert the stored string in an $expr, guarded by numericPattern; a Numeric
+// PropertyNe is the negation of the PropertyEq filter.
+func mongoPropertyFilter(f PropertyFilter) bson.M {
+	path := "properties." + f.Key
+	switch f.Op {
+	case PropertyExists, PropertyMissing:
+		return bson.M{path: bson.M{"$exists": f.Op == PropertyExists}}
+	case PropertyNe:
+		if !f.Numeric {
+			return bson.M{path: bson.M{"$nin": f.Values}}
+		}
+		f.Op = PropertyEq
+		return bson.M{"$nor": bson.A{mongoPropertyFilter(f)}}
+	case PropertyEq:
+		if !f.Numeric {
+			return bson.M{path: bson.M{"$in": f.Values}}
+		}
+		return mongoNumericProperty(path, "$in", f.numbers())
+	}
+	op := propertyOperators[f.Op].mongo
+	if !f.Numeric {
+		return bson.M{path: bson.M{op: f.value()}}
+	}
+	value, ok := propertyNumber(f.value())
+	if !ok {
+		return bson.M{"_id": bson.M{"$exists": false}}
+	}
+	return mongoNumericProperty(path, op, value)
+}
 
-	return r.find(ctx, filter, opts)
+// mongoNumericProperty compares the numeric values at path with operand.
+func mongoNumericProperty(path, op string, operand interface{}) bson.M {
+	return bson.M{path: bson.M{"$regex": numericPattern}, "$expr": bson.M{op: bson.A{
+		bson.M{"$convert": bson.M{"input": "$" + path, "to": "double", "onError": nil, "onNull": nil}},
+		operand,
+	}}}
 }
 
+// FindByServiceRequestID returns the live request with the given id; a
+// soft-deleted one is ErrNotFound (use Find with IncludeDeleted to see it).
 func (r *MongoServiceRequestRepository) FindByServiceRequestID(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error) {
 	var doc serviceRequestDoc
-	err := r.collection.FindOne(ctx, bson.M{"service_request_id": serviceRequestID}).Decode(&doc)
+	err := r.collection.FindOne(ctx, notDeleted(bson.M{"service_request_id": serviceRequestID})).Decode(&doc)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return models.ServiceRequest{}, ErrNotFound
@@ -266,9 +541,13 @@ func (r *MongoServiceRequestRepository) Create(ctx context.Context, req models.S
 		req.RequestedDatetime = now
 	}
 	req.UpdatedDatetime = now
+	req.DeletedAt, req.ErasedAt = nil, nil
+
+	req.Version = 1
 
 	doc := serviceRequestDocFromModel(req)
 	doc.ID = oid
+	doc.Version = req.Version
 
 	if _, err := r.collection.InsertOne(ctx, doc); err != nil {
 		return models.ServiceRequest{}, fmt.Errorf("%w: %v", ErrDatabase, err)
@@ -278,14 +557,87 @@ func (r *MongoServiceRequestRepository) Create(ctx context.Context, req models.S
 	return req, nil
 }
 
+// replaceUpdate turns a full document into an update pipeline that replaces
+// every field (plus $unset for absent optional fields) and bumps the version,
+// so a replacement stays atomic with the version increment. _id is left to
+// MongoDB; deleted_at is cleared (a replace resurrects) and erased_at kept, with
+// personal fields re-scrubbed on erased requests. Values are $literal so
+// strings starting with '$' are never read as expressions.
+func replaceUpdate(doc serviceRequestDoc) (mongo.Pipeline, error) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var fields bson.M
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "_id")
+	delete(fields, "version")
+	delete(fields, "deleted_at")
+	delete(fields, "erased_at")
+
+	set := bson.M{"version": nextVersion}
+	for k, v := range fields {
+		set[k] = bson.M{"$literal": v}
+	}
+	pipeline := mongo.Pipeline{{{Key: "$set", Value: set}}}
+
+	var unset bson.A
+	for _, f := range optionalServiceRequestFields {
+		if _, ok := fields[f]; !ok {
+			unset = append(unset, f)
+		}
+	}
+	if len(unset) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$unset", Value: unset}})
+	}
+	return append(pipeline, scrubErasedStage()), nil
+}
+
+// nextVersion is the pipeline expression for version+1 (0 when missing).
+var nextVersion = bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", int64(0)}}, int64(1)}}
+
+// scrubErasedStage keeps personal fields scrubbed on erased requests, so a
+// later replace or patch (e.g. a re-run feed) cannot restore erased data.
+func scrubErasedStage() bson.D {
+	set := bson.M{}
+	for f, scrubbed := range personalServiceRequestFields {
+		set[f] = bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{"$erased_at", nil}},
+			scrubbed,
+			"$" + f,
+		}}
+	}
+	return bson.D{{Key: "$set", Value: set}}
+}
+
+// preconditionFilter adds the If-Match constraints of pre to filter.
+func preconditionFilter(filter bson.M, pre Precondition) bson.M {
+	if len(pre.IfVersions) > 0 {
+		versions := bson.A{}
+		for _, v := range pre.IfVersions {
+			versions = append(versions, v)
+			if v == 0 {
+				// Documents written before versioning have no version field.
+				versions = append(versions, nil)
+			}
+		}
+		filter["version"] = bson.M{"$in": versions}
+	}
+	return filter
+}
+
 // Upsert inserts or fully replaces the service request identified by
 // req.ServiceRequestID (the natural key), keeping the existing MongoDB _id on
-// replace. Unlike Create, it preserves a supplied updated_datetime — defaulting
-// it to now only when absent — so a re-runnable bulk feed can carry the source's
-// own update/close timestamps without losing history. Status defaults to "open"
-// and requested_datetime to now when absent. Returns the stored request and
-// whether it was newly created (true) versus updated (false).
-func (r *MongoServiceRequestRepository) Upsert(ctx context.Context, req models.ServiceRequest) (models.ServiceRequest, bool, error) {
+// replace and incrementing its version. Unlike Create, it preserves a supplied
+// updated_datetime — defaulting it to now only when absent — so a re-runnable
+// bulk feed can carry the source's own update/close timestamps without losing
+// history. Status defaults to "open" and requested_datetime to now when absent.
+// A conditional pre never inserts: it returns ErrPreconditionFailed unless the
+// stored request exists (at one of the expected versions). Returns the stored
+// request and whether it was newly created (true) versus updated (false).
+func (r *MongoServiceRequestRepository) Upsert(ctx context.Context, req models.ServiceRequest, pre Precondition) (models.ServiceRequest, bool, error) {
 	if req.ServiceRequestID == "" {
 		return models.ServiceRequest{}, false, ErrInvalidID
 	}
@@ -301,21 +653,24 @@ func (r *MongoServiceRequestRepository) Upsert(ctx context.Context, req models.S
 		req.UpdatedDatetime = now
 	}
 
-	doc := serviceRequestDocFromModel(req)
-	// Let MongoDB own _id: preserved on replace, generated on insert. The body
-	// carries no ObjectID (the URL key is service_request_id, not _id).
-	doc.ID = primitive.ObjectID{}
+	update, err := replaceUpdate(serviceRequestDocFromModel(req))
+	if err != nil {
+		return models.ServiceRequest{}, false, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
 
-	filter := bson.M{"service_request_id": req.ServiceRequestID}
-	res, err := r.collection.ReplaceOne(ctx, filter, doc, options.Replace().SetUpsert(true))
+	filter := preconditionFilter(bson.M{"service_request_id": req.ServiceRequestID}, pre)
+	res, err := r.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(!pre.Conditional()))
 	if err != nil {
 		return models.ServiceRequest{}, false, fmt.Errorf("%w: %v", ErrDatabase, err)
 	}
+	if pre.Conditional() && res.MatchedCount == 0 {
+		return models.ServiceRequest{}, false, ErrPreconditionFailed
+	}
 
 	created := res.UpsertedCount > 0
 
 	// Read back the canonical stored document so the response carries the real
-	// _id and the timestamps exactly as persisted.
+	// _id, version and the timestamps exactly as persisted.
 	stored, err := r.FindByServiceRequestID(ctx, req.ServiceRequestID)
 	if err != nil {
 		return models.ServiceRequest{}, false, err
@@ -323,6 +678,121 @@ func (r *MongoServiceRequestRepository) Upsert(ctx context.Context, req models.S
 	return stored, created, nil
 }
 
+// Patch applies a partial update to the service request identified by
+// serviceRequestID in a single atomic pipeline update: fields and individual
+// properties keys are set or removed, location is re-derived when lat/long
+// change, updated_datetime is bumped (unless the patch sets it) and the version
+// incremented. Returns the stored request after the update, ErrNotFound when it
+// does not exist and ErrPreconditionFailed when pre does not match.
+func (r *MongoServiceRequestRepository) Patch(ctx context.Context, serviceRequestID string, patch ServiceRequestPatch, pre Precondition) (models.ServiceRequest, error) {
+	if serviceRequestID == "" {
+		return models.ServiceRequest{}, ErrInvalidID
+	}
+	pipeline, err := patchPipeline(patch, time.Now().UTC())
+	if err != nil {
+		return models.ServiceRequest{}, err
+	}
+
+	filter := preconditionFilter(notDeleted(bson.M{"service_request_id": serviceRequestID}), pre)
+	var doc serviceRequestDoc
+	err = r.collection.FindOneAndUpdate(ctx, filter, pipeline,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return models.ServiceRequest{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		if pre.Conditional() {
+			if _, err := r.FindByServiceRequestID(ctx, serviceRequestID); err == nil {
+				return models.ServiceRequest{}, ErrPreconditionFailed
+			}
+		}
+		return models.ServiceRequest{}, ErrNotFound
+	}
+	return doc.toModel(), nil
+}
+
+// patchPipeline builds the update pipeline for a patch. Values are wrapped in
+// $literal so user strings starting with '$' are never read as expressions.
+func patchPipeline(patch ServiceRequestPatch, now time.Time) (mongo.Pipeline, error) {
+	if err := patch.Validate(); err != nil {
+		return nil, errors.Join(ErrInvalidPatch, err)
+	}
+
+	set := bson.M{}
+	var unset bson.A
+	for name, v := range patch.Fields {
+		kind := PatchableServiceRequestFields[name]
+		switch {
+		case v == nil && kind == PatchOptionalString:
+			unset = append(unset, name)
+		case v == nil && kind == PatchString:
+			set[name] = bson.M{"$literal": ""}
+		case v == nil && kind == PatchTime:
+			set[name] = time.Time{}
+		case v == nil && kind == PatchFloat:
+			set[name] = float64(0)
+		case kind == PatchOptionalString && v == "":
+			unset = append(unset, name)
+		default:
+			if t, ok := v.(time.Time); ok {
+				v = t.UTC()
+			}
+			set[name] = bson.M{"$literal": v}
+		}
+	}
+	if _, ok := patch.Fields["updated_datetime"]; !ok {
+		set["updated_datetime"] = now
+	}
+	set["version"] = nextVersion
+
+	var pipeline mongo.Pipeline
+	if patch.ClearProperties {
+		unset = append(unset, "properties")
+	}
+	if len(unset) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$unset", Value: unset}})
+	}
+	var unsetProps bson.A
+	for k, v := range patch.Properties {
+		if v == nil {
+			unsetProps = append(unsetProps, "properties."+k)
+			continue
+		}
+		set["properties."+k] = bson.M{"$literal": *v}
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$set", Value: set}})
+	if len(unsetProps) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$unset", Value: unsetProps}})
+	}
+
+	derived := bson.M{}
+	if len(patch.Properties) > 0 {
+		// Drop the object once its last key is removed (properties is omitempty).
+		derived["properties"] = bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$properties", bson.M{"$literal": bson.M{}}}}, "$$REMOVE", "$properties",
+		}}
+	}
+	if patch.TouchesLocation() {
+		// Same rule as serviceRequestDocFromModel: a point only when lat/long are set.
+		derived["location"] = bson.M{"$cond": bson.A{
+			bson.M{"$or": bson.A{bson.M{"$ne": bson.A{"$lat", 0}}, bson.M{"$ne": bson.A{"$long", 0}}}},
+			bson.M{"type": "Point", "coordinates": bson.A{"$long", "$lat"}},
+			"$$REMOVE",
+		}}
+	}
+	if len(derived) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$set", Value: derived}})
+	}
+	for f := range personalServiceRequestFields {
+		if _, ok := patch.Fields[f]; ok {
+			pipeline = append(pipeline, scrubErasedStage())
+			break
+		}
+	}
+	return pipeline, nil
+}
+
 // BulkUpsertError reports a single record that failed within a bulk upsert.
 type BulkUpsertError struct {
 	Index            int    `json:"index"`
@@ -333,44 +803,57 @@ type BulkUpsertError struct {
 // BulkUpsertResult summarizes a bulk upsert. Created/Updated are exact when the
 // whole batch succeeds; if the driver returns write errors they are listed in
 // Errors and Created/Updated reflect only the counts the driver reported.
+// Skipped counts records left alone because the stored copy was as new or newer
+// (BulkUpsertOptions.OnlyIfNewer).
 type BulkUpsertResult struct {
 	Requested int
 	Created   int
 	Updated   int
+	Skipped   int
 	Failed    int
 	Errors    []BulkUpsertError
+	// Outcomes has one entry per record of the batch, in order. Records
+	// sharing a service_request_id share the outcome of the write that won,
+	// except with OnlyIfNewer, where the others are BulkSkipped.
+	Outcomes []BulkOutcome
 }
 
+// BulkOutcome is what a bulk upsert did with one record.
+type BulkOutcome string
+
+// Bulk upsert outcomes.
+const (
+	BulkCreated BulkOutcome = "created"
+	BulkUpdated BulkOutcome = "updated"
+	BulkSkipped BulkOutcome = "skipped"
+	BulkFailed  BulkOutcome = "failed"
+)
+
+// duplicateKeyCode is MongoDB's E11000 duplicate key error code.
+const duplicateKeyCode = 11000
+
 // BulkUpsert inserts-or-replaces many service requests in a single MongoDB
 // BulkWrite (unordered, so one bad record doesn't abort the rest), keyed on
 // service_request_id. Same per-record defaults as Upsert: status→open and
 // requested_datetime→now when absent, and a supplied updated_datetime is
 // preserved (defaulting to now only when absent). Records sharing a
-// service_request_id within the batch are de-duplicated (last wins) so they
-// don't collide against the unique index. Records with an empty
-// service_request_id are skipped and reported as errors.
-func (r *MongoServiceRequestRepository) BulkUpsert(ctx context.Context, reqs []models.ServiceRequest) (BulkUpsertResult, error) {
+// service_request_id within the batch are de-duplicated (last wins, or newest
+// updated_datetime wins with OnlyIfNewer) so they don't collide against the
+// unique index. Records with an empty service_request_id are skipped and
+// reported as errors.
+//
+// With OnlyIfNewer each write only matches a stored document with an older (or
+// missing) updated_datetime. When the stored copy is as new or newer the upsert
+// falls through to an insert that the unique index rejects; those duplicate-key
+// errors are counted as Skipped rather than Failed.
+func (r *MongoServiceRequestRepository) BulkUpsert(ctx context.Context, reqs []models.ServiceRequest, opts BulkUpsertOptions) (BulkUpsertResult, error) {
 	res := BulkUpsertResult{Requested: len(reqs)}
 	if len(reqs) == 0 {
 		return res, nil
 	}
 
 	now := time.Now().UTC()
-
-	// De-duplicate by service_request_id (last wins), preserving first-seen order.
-	order := make([]string, 0, len(reqs))
-	byID := make(map[string]models.ServiceRequest, len(reqs))
-	for i, req := range reqs {
-		if req.ServiceRequestID == "" {
-			res.Failed++
-			res.Errors = append(res.Errors, BulkUpsertError{Index: i, Message: "service_request_id is required"})
-			continue
-		}
-		if _, seen := byID[req.ServiceRequestID]; !seen {
-			order = append(order, req.ServiceRequestID)
-		}
-		byID[req.ServiceRequestID] = req
-	}
+	order, byID := dedupeBulk(reqs, opts, &res)
 
 	models_ := make([]mongo.WriteModel, 0, len(order))
 	for _, id := range order {
@@ -384,11 +867,20 @@ func (r *MongoServiceRequestRepository) BulkUpsert(ctx context.Context, reqs []m
 		if req.UpdatedDatetime.IsZero() {
 			req.UpdatedDatetime = now
 		}
-		doc := serviceRequestDocFromModel(req)
-		doc.ID = primitive.ObjectID{} // let Mongo own _id (preserve on replace, generate on insert)
-		m := mongo.NewReplaceOneModel().
-			SetFilter(bson.M{"service_request_id": req.ServiceRequestID}).
-			SetReplacement(doc).
+		update, err := replaceUpdate(serviceRequestDocFromModel(req))
+		if err != nil {
+			return res, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		filter := bson.M{"service_request_id": req.ServiceRequestID}
+		if opts.OnlyIfNewer {
+			filter["$or"] = bson.A{
+				bson.M{"updated_datetime": bson.M{"$lt": req.UpdatedDatetime}},
+				bson.M{"updated_datetime": bson.M{"$exists": false}},
+			}
+		}
+		m := mongo.NewUpdateOneModel().
+			SetFilter(filter).
+			SetUpdate(update).
 			SetUpsert(true)
 		models_ = append(models_, m)
 	}
@@ -397,6 +889,7 @@ func (r *MongoServiceRequestRepository) BulkUpsert(ctx context.Context, reqs []m
 		return res, nil
 	}
 
+	outcomes := make(map[string]BulkOutcome, len(order))
 	bw, err := r.collection.BulkWrite(ctx, models_, options.BulkWrite().SetOrdered(false))
 	if err != nil {
 		var bwe mongo.BulkWriteException
@@ -406,13 +899,20 @@ func (r *MongoServiceRequestRepository) BulkUpsert(ctx context.Context, reqs []m
 				if we.Index >= 0 && we.Index < len(order) {
 					srid = order[we.Index]
 				}
-				res.Errors = append(res.Errors, BulkUpsertError{Index: we.Index, ServiceRequestID: srid, Message: we.Message})
+				if opts.OnlyIfNewer && we.Code == duplicateKeyCode {
+					res.Skipped++
+					outcomes[srid] = BulkSkipped
+					continue
+				}
+				res.Failed++
+				outcomes[srid] = BulkFailed
+				res.Errors = append(res.Errors, BulkUpsertError{Index: lastIndex(reqs, srid), ServiceRequestID: srid, Message: we.Message})
 			}
-			res.Failed += len(bwe.WriteErrors)
 			// The driver does not expose partial counts on a bulk exception; the
 			// records not in WriteErrors did succeed. Surface that as a single
 			// "Updated" tally so callers see succeeded vs failed.
 			res.Updated += len(models_) - len(bwe.WriteErrors)
+			res.setOutcomes(reqs, mongoBulkOutcomes(order, bw, outcomes))
 			return res, nil
 		}
 		return res, fmt.Errorf("%w: %v", ErrDatabase, err)
@@ -420,27 +920,174 @@ func (r *MongoServiceRequestRepository) BulkUpsert(ctx context.Context, reqs []m
 
 	res.Created += int(bw.UpsertedCount)
 	res.Updated += int(bw.MatchedCount)
+	res.setOutcomes(reqs, mongoBulkOutcomes(order, bw, outcomes))
 	return res, nil
 }
 
-// Delete removes the service request identified by serviceRequestID (the natural
-// key). Returns ErrNotFound when no matching document exists.
-func (r *MongoServiceRequestRepository) Delete(ctx context.Context, serviceRequestID string) error {
+// mongoBulkOutcomes completes the outcomes of a BulkWrite over order: the
+// operations the driver reports as upserted created a document, the others
+// without a write error updated one.
+func mongoBulkOutcomes(order []string, bw *mongo.BulkWriteResult, outcomes map[string]BulkOutcome) map[string]BulkOutcome {
+	for i, id := range order {
+		if _, done := outcomes[id]; done {
+			continue
+		}
+		outcomes[id] = BulkUpdated
+		if bw != nil {
+			if _, ok := bw.UpsertedIDs[int64(i)]; ok {
+				outcomes[id] = BulkCreated
+			}
+		}
+	}
+	return outcomes
+}
+
+// lastIndex returns the index of the last record of reqs with the given
+// service_request_id — the one a de-duplicated batch writes without
+// OnlyIfNewer — or -1.
+func lastIndex(reqs []models.ServiceRequest, serviceRequestID string) int {
+	for i := len(reqs) - 1; i >= 0; i-- {
+		if reqs[i].ServiceRequestID == serviceRequestID {
+			return i
+		}
+	}
+	return -1
+}
+
+// dedupeBulk validates and de-duplicates a bulk batch by service_request_id,
+// preserving first-seen order. Later records win, except with OnlyIfNewer where
+// the record with the newest updated_datetime wins. Records without an id are
+// recorded as failures on res, and the records that lose with OnlyIfNewer as
+// skipped; setOutcomes fills in the rest once the batch is written.
+func dedupeBulk(reqs []models.ServiceRequest, opts BulkUpsertOptions, res *BulkUpsertResult) ([]string, map[string]models.ServiceRequest) {
+	order := make([]string, 0, len(reqs))
+	byID := make(map[string]models.ServiceRequest, len(reqs))
+	winner := make(map[string]int, len(reqs))
+	res.Outcomes = make([]BulkOutcome, len(reqs))
+	for i, req := range reqs {
+		if req.ServiceRequestID == "" {
+			res.Failed++
+			res.Errors = append(res.Errors, BulkUpsertError{Index: i, Message: "service_request_id is required"})
+			res.Outcomes[i] = BulkFailed
+			continue
+		}
+		prev, seen := byID[req.ServiceRequestID]
+		if !seen {
+			order = append(order, req.ServiceRequestID)
+		} else if opts.OnlyIfNewer && prev.UpdatedDatetime.After(req.UpdatedDatetime) {
+			res.Skipped++
+			res.Outcomes[i] = BulkSkipped
+			continue
+		} else if opts.OnlyIfNewer {
+			res.Skipped++
+			res.Outcomes[winner[req.ServiceRequestID]] = BulkSkipped
+		}
+		byID[req.ServiceRequestID] = req
+		winner[req.ServiceRequestID] = i
+	}
+	return order, byID
+}
+
+// count adds the outcomes of the writes of a batch to its counts.
+func (res *BulkUpsertResult) count(byID map[string]BulkOutcome) {
+	for _, o := range byID {
+		switch o {
+		case BulkCreated:
+			res.Created++
+		case BulkUpdated:
+			res.Updated++
+		case BulkSkipped:
+			res.Skipped++
+		}
+	}
+}
+
+// setOutcomes fills in the outcomes dedupeBulk left open from the outcome of
+// the write of each service_request_id.
+func (res *BulkUpsertResult) setOutcomes(reqs []models.ServiceRequest, byID map[string]BulkOutcome) {
+	for i, o := range res.Outcomes {
+		if o == "" {
+			res.Outcomes[i] = byID[reqs[i].ServiceRequestID]
+		}
+	}
+}
+
+// Delete soft-deletes the service request identified by serviceRequestID (the
+// natural key): it becomes a tombstone with deleted_at set, updated_datetime
+// bumped (so incremental sync by updated_after sees it) and its version
+// incremented. Tombstones are hidden from normal reads and hard-deleted by
+// PurgeDeleted after the retention period. Returns ErrNotFound when no live
+// request exists, and ErrPreconditionFailed when it exists but pre does not
+// match.
+func (r *MongoServiceRequestRepository) Delete(ctx context.Context, serviceRequestID string, pre Precondition) error {
 	if serviceRequestID == "" {
 		return ErrInvalidID
 	}
-	res, err := r.collection.DeleteOne(ctx, bson.M{"service_request_id": serviceRequestID})
+	now := time.Now().UTC()
+	filter := preconditionFilter(notDeleted(bson.M{"service_request_id": serviceRequestID}), pre)
+	res, err := r.collection.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"deleted_at": now, "updated_datetime": now},
+		"$inc": bson.M{"version": int64(1)},
+	})
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrDatabase, err)
 	}
-	if res.DeletedCount == 0 {
+	if res.MatchedCount == 0 {
+		if pre.Conditional() {
+			if _, err := r.FindByServiceRequestID(ctx, serviceRequestID); err == nil {
+				return ErrPreconditionFailed
+			}
+		}
 		return ErrNotFound
 	}
 	return nil
 }
 
+// Erase scrubs the personal data of a service request (see
+// personalServiceRequestFields) while keeping the statistical record — codes,
+// status, timestamps, location, properties. It works on live requests and
+// tombstones alike, sets erased_at (kept from the first erasure), bumps
+// updated_datetime and the version, and returns the stored result.
+func (r *MongoServiceRequestRepository) Erase(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error) {
+	if serviceRequestID == "" {
+		return models.ServiceRequest{}, ErrInvalidID
+	}
+	now := time.Now().UTC()
+	set := bson.M{
+		"erased_at":        bson.M{"$ifNull": bson.A{"$erased_at", now}},
+		"updated_datetime": now,
+		"version":          nextVersion,
+	}
+	for f, scrubbed := range personalServiceRequestFields {
+		set[f] = scrubbed
+	}
+
+	var doc serviceRequestDoc
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"service_request_id": serviceRequestID},
+		mongo.Pipeline{{{Key: "$set", Value: set}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.ServiceRequest{}, ErrNotFound
+		}
+		return models.ServiceRequest{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return doc.toModel(), nil
+}
+
+// PurgeDeleted hard-deletes tombstones soft-deleted before deletedBefore and
+// returns how many were removed.
+func (r *MongoServiceRequestRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	res, err := r.collection.DeleteMany(ctx, bson.M{"deleted_at": bson.M{"$lt": deletedBefore}})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return res.DeletedCount, nil
+}
+
 func (r *MongoServiceRequestRepository) FindByFeature(ctx context.Context, featureID, featureGuid string) ([]models.ServiceRequest, error) {
-	filter := bson.M{}
+	filter := notDeleted(bson.M{})
 	if featureID != "" {
 		filter["featureId"] = featureID
 	}
@@ -451,7 +1098,7 @@ func (r *MongoServiceRequestRepository) FindByFeature(ctx context.Context, featu
 }
 
 func (r *MongoServiceRequestRepository) FindByOrganization(ctx context.Context, organizationID string) ([]models.ServiceRequest, error) {
-	return r.find(ctx, bson.M{"organizationId": organizationID})
+	return r.find(ctx, notDeleted(bson.M{"organizationId": organizationID}))
 }
 
 // dateRange builds a {$gte, $lte} filter fragment, or nil if both bounds are nil.
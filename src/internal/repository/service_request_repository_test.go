@@ -3,9 +3,11 @@ package repository
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 type mockServiceRequestRepo struct {
@@ -102,3 +104,128 @@ func TestFindByOrganization(t *testing.T) {
 		assert.Len(t, results, 0)
 	})
 }
+
+func TestReplaceUpdate(t *testing.T) {
+	now := time.Now()
+	pipeline, err := replaceUpdate(serviceRequestDocFromModel(models.ServiceRequest{
+		ServiceRequestID: "sr-1",
+		Status:           "$open",
+		Latitude:         42.36,
+		Longitude:        -71.05,
+		DeletedAt:        &now,
+		ErasedAt:         &now,
+	}))
+	assert.NoError(t, err)
+	assert.Len(t, pipeline, 3)
+
+	set := pipeline[0][0].Value.(bson.M)
+	assert.Equal(t, bson.M{"$literal": "sr-1"}, set["service_request_id"])
+	assert.Equal(t, bson.M{"$literal": "$open"}, set["status"])
+	assert.NotContains(t, set, "_id")
+	assert.NotContains(t, set, "deleted_at")
+	assert.NotContains(t, set, "erased_at")
+	assert.Contains(t, set, "location")
+	assert.Equal(t, nextVersion, set["version"])
+
+	// Absent optional fields are removed, so the update is a full replacement;
+	// that includes deleted_at (a replace resurrects a tombstone).
+	assert.Equal(t, "$unset", pipeline[1][0].Key)
+	unset := pipeline[1][0].Value.(bson.A)
+	assert.Contains(t, unset, "properties")
+	assert.Contains(t, unset, "featureId")
+	assert.Contains(t, unset, "deleted_at")
+	assert.NotContains(t, unset, "location")
+	assert.NotContains(t, unset, "erased_at")
+
+	// Erased requests keep their personal fields scrubbed.
+	assert.Equal(t, scrubErasedStage(), pipeline[2])
+}
+
+func TestDedupeBulk(t *testing.T) {
+	older := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	reqs := []models.ServiceRequest{
+		{ServiceRequestID: "a", Status: "closed", UpdatedDatetime: newer},
+		{ServiceRequestID: "b"},
+		{ServiceRequestID: "a", Status: "open", UpdatedDatetime: older},
+		{},
+	}
+
+	t.Run("last wins", func(t *testing.T) {
+		var res BulkUpsertResult
+		order, byID := dedupeBulk(reqs, BulkUpsertOptions{}, &res)
+		assert.Equal(t, []string{"a", "b"}, order)
+		assert.Equal(t, "open", byID["a"].Status)
+		assert.Equal(t, 1, res.Failed)
+		assert.Equal(t, 0, res.Skipped)
+	})
+
+	t.Run("newest wins with OnlyIfNewer", func(t *testing.T) {
+		var res BulkUpsertResult
+		_, byID := dedupeBulk(reqs, BulkUpsertOptions{OnlyIfNewer: true}, &res)
+		assert.Equal(t, "closed", byID["a"].Status)
+		assert.Equal(t, 1, res.Skipped)
+	})
+}
+
+func TestPatchPipeline(t *testing.T) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	closed := "Case Resolved"
+
+	t.Run("sets, unsets and re-derives location", func(t *testing.T) {
+		pipeline, err := patchPipeline(ServiceRequestPatch{
+			Fields:     map[string]interface{}{"status": "$closed", "featureId": nil, "lat": 42.36},
+			Properties: map[string]*string{"closure_reason": &closed, "ward": nil},
+		}, now)
+		assert.NoError(t, err)
+		assert.Len(t, pipeline, 4)
+		assert.NotContains(t, pipeline[3][0].Value.(bson.M), "description")
+
+		assert.Equal(t, "$unset", pipeline[0][0].Key)
+		assert.Equal(t, bson.A{"featureId"}, pipeline[0][0].Value)
+
+		set := pipeline[1][0].Value.(bson.M)
+		assert.Equal(t, bson.M{"$literal": "$closed"}, set["status"])
+		assert.Equal(t, bson.M{"$literal": closed}, set["properties.closure_reason"])
+		assert.Equal(t, now, set["updated_datetime"])
+		assert.Contains(t, set, "version")
+
+		assert.Equal(t, bson.A{"properties.ward"}, pipeline[2][0].Value)
+		derived := pipeline[3][0].Value.(bson.M)
+		assert.Contains(t, derived, "location")
+		assert.Contains(t, derived, "properties")
+	})
+
+	t.Run("explicit updated_datetime wins", func(t *testing.T) {
+		at := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+		pipeline, err := patchPipeline(ServiceRequestPatch{Fields: map[string]interface{}{"updated_datetime": at}}, now)
+		assert.NoError(t, err)
+		assert.Len(t, pipeline, 1)
+		assert.Equal(t, bson.M{"$literal": at}, pipeline[0][0].Value.(bson.M)["updated_datetime"])
+	})
+
+	t.Run("invalid patch", func(t *testing.T) {
+		_, err := patchPipeline(ServiceRequestPatch{Fields: map[string]interface{}{"service_request_id": "x"}}, now)
+		assert.ErrorIs(t, err, ErrInvalidPatch)
+		_, err = patchPipeline(ServiceRequestPatch{Fields: map[string]interface{}{"lat": "north"}}, now)
+		assert.ErrorIs(t, err, ErrInvalidPatch)
+	})
+}
+
+func TestPatchPipelineKeepsErasureSticky(t *testing.T) {
+	pipeline, err := patchPipeline(ServiceRequestPatch{Fields: map[string]interface{}{"description": "new text"}}, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, scrubErasedStage(), pipeline[len(pipeline)-1])
+}
+
+func TestParseTextSearch(t *testing.T) {
+	s := ParseTextSearch(`  pothole -graffiti "near  the park" "unterminated  `)
+	assert.Equal(t, []string{"pothole"}, s.Terms)
+	assert.Equal(t, []string{"graffiti"}, s.Excluded)
+	assert.Equal(t, []string{"near the park", "unterminated"}, s.Phrases)
+	assert.Equal(t, `pothole "near the park" "unterminated" -graffiti`, s.String())
+
+	assert.Equal(t, TextSearch{Phrases: []string{"a b"}}, ParseTextSearch(`-"a b"`), "a dash before a phrase is ignored")
+	assert.Equal(t, TextSearch{Terms: []string{"a"}, Phrases: []string{"b"}}, ParseTextSearch(`a"b`))
+	assert.True(t, ParseTextSearch(` "" - `).IsZero())
+}
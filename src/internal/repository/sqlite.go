@@ -0,0 +1,307 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// registerSQLiteFunctions installs the Go functions the SQLite queries use on
+// every connection the driver opens.
+var registerSQLiteFunctions = sync.OnceValue(func() error {
+	// haversine_m(lat1, long1, lat2, long2) is the great-circle distance in
+	// meters, computed exactly like the memory backend's radius filter.
+	err := sqlite.RegisterDeterministicScalarFunction("haversine_m", 4,
+		func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			var v [4]float64
+			for i, a := range args {
+				switch n := a.(type) {
+				case float64:
+					v[i] = n
+				case int64:
+					v[i] = float64(n)
+				default:
+					return nil, fmt.Errorf("haversine_m: argument %d is %T, not a number", i+1, a)
+				}
+			}
+			return haversineMeters(v[0], v[1], v[2], v[3]), nil
+		})
+	if err != nil {
+		return err
+	}
+	// property_number(value) reads a properties value as a number like the
+	// memory backend's property filters: NULL unless it matches
+	// numericPattern.
+	return sqlite.RegisterDeterministicScalarFunction("property_number", 1,
+		func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			s, ok := args[0].(string)
+			if !ok {
+				return nil, nil
+			}
+			if n, ok := propertyNumber(s); ok {
+				return n, nil
+			}
+			return nil, nil
+		})
+})
+
+// SQLite represents an embedded SQLite database file, opened with the pure-Go
+// driver (no cgo), so the API runs as a single binary.
+type SQLite struct {
+	db     *sql.DB
+	config config.SQLiteConfig
+}
+
+// NewSQLiteConnection opens (creating if needed) the database file in WAL mode.
+func NewSQLiteConnection(cfg config.SQLiteConfig) (*SQLite, error) {
+	if err := registerSQLiteFunctions(); err != nil {
+		return nil, fmt.Errorf("registering SQLite functions: %w", err)
+	}
+
+	// Write transactions take the lock up front (BEGIN IMMEDIATE) and wait for
+	// it, so concurrent writers queue instead of failing with SQLITE_BUSY.
+	params := url.Values{}
+	params.Add("_pragma", "busy_timeout(10000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "synchronous(NORMAL)")
+	params.Add("_txlock", "immediate")
+	db, err := sql.Open("sqlite", "file:"+cfg.Path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database %q: %w", cfg.Path, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open SQLite database %q: %w", cfg.Path, err)
+	}
+	return &SQLite{db: db, config: cfg}, nil
+}
+
+// Ping verifies the database file is usable.
+func (db *SQLite) Ping(ctx context.Context) error {
+	return db.db.PingContext(ctx)
+}
+
+// Close closes the database.
+func (db *SQLite) Close() error {
+	return db.db.Close()
+}
+
+// MigrationStatus lists the embedded migrations (migrations/sqlite) and
+// those recorded in schema_migrations.
+func (db *SQLite) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(BackendSQLite)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := sqliteAppliedMigrations(ctx, db.db)
+	if err != nil {
+		return nil, err
+	}
+	known := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		known[i] = m.status()
+	}
+	return mergeMigrationStatus(known, applied), nil
+}
+
+// MigrateUp applies the pending embedded migrations in version order, each in
+// its own transaction, recording them in schema_migrations.
+func (db *SQLite) MigrateUp(ctx context.Context, opts MigrateOptions) ([]MigrationStatus, error) {
+	return db.migrate(ctx, false, opts)
+}
+
+// MigrateDown reverts the latest applied migrations with their down scripts.
+func (db *SQLite) MigrateDown(ctx context.Context, opts MigrateOptions) ([]MigrationStatus, error) {
+	return db.migrate(ctx, true, opts)
+}
+
+func (db *SQLite) migrate(ctx context.Context, down bool, opts MigrateOptions) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(BackendSQLite)
+	if err != nil {
+		return nil, err
+	}
+	versions, byVersion := indexMigrations(migrations)
+
+	if !opts.DryRun {
+		if _, err := db.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`); err != nil {
+			return nil, fmt.Errorf("%w: creating schema_migrations: %v", ErrDatabase, err)
+		}
+	}
+
+	recorded, err := sqliteAppliedMigrations(ctx, db.db)
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int64]bool{}
+	for _, m := range recorded {
+		applied[m.Version] = true
+	}
+	plan, err := planMigrations(versions, applied, down, opts.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []MigrationStatus
+	for _, v := range plan {
+		m := byVersion[v]
+		script, err := m.script(down)
+		if err != nil {
+			return done, err
+		}
+		opts.logf("%s %d_%s", migrationVerb(down, opts.DryRun), m.Version, m.Name)
+		if opts.DryRun {
+			opts.logf("%s", strings.TrimSpace(script))
+			done = append(done, m.status())
+			continue
+		}
+		ran := false
+		err = db.withTx(ctx, func(tx *sql.Tx) error {
+			// Checked again inside the (immediate) transaction so two
+			// processes sharing the file cannot both run a migration.
+			var n int
+			if err := tx.QueryRowContext(ctx, "SELECT count(*) FROM schema_migrations WHERE version = ?", m.Version).Scan(&n); err != nil {
+				return err
+			}
+			if (n > 0) != down {
+				return nil
+			}
+			if _, err := tx.ExecContext(ctx, script); err != nil {
+				return err
+			}
+			ran = true
+			if down {
+				_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", m.Version)
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("%w: migration %d_%s: %v", ErrDatabase, m.Version, m.Name, err)
+		}
+		if ran {
+			done = append(done, m.status())
+		}
+	}
+	return done, nil
+}
+
+// sqliteAppliedMigrations reads schema_migrations; none when it does not exist.
+func sqliteAppliedMigrations(ctx context.Context, q sqlQuerier) ([]MigrationStatus, error) {
+	var n int
+	if err := q.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&n); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	rows, err := q.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer rows.Close()
+
+	var applied []MigrationStatus
+	for rows.Next() {
+		var (
+			m  MigrationStatus
+			at string
+		)
+		if err := rows.Scan(&m.Version, &m.Name, &at); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		// CURRENT_TIMESTAMP is UTC "YYYY-MM-DD HH:MM:SS".
+		if t, err := time.Parse(time.DateTime, at); err == nil {
+			m.AppliedAt = &t
+		} else {
+			m.AppliedAt = &time.Time{}
+		}
+		applied = append(applied, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return applied, nil
+}
+
+// withTx runs fn in a write transaction, committing when it returns nil.
+func (db *SQLite) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlQuerier is satisfied by both *sql.DB and *sql.Tx.
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// isSQLiteUniqueViolation reports a UNIQUE constraint failure.
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// unixMillis is the stored form of a timestamp.
+func unixMillis(t time.Time) int64 {
+	return storedTime(t).UnixMilli()
+}
+
+// nullMillis maps the zero time to SQL NULL.
+func nullMillis(t time.Time) *int64 {
+	if t.IsZero() {
+		return nil
+	}
+	ms := unixMillis(t)
+	return &ms
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
+
+// EnsurePropertyIndexes creates a secondary index on each of the properties
+// keys (PROPERTY_INDEX_KEYS), over the expression the property filters
+// compare. It is idempotent and only ever adds: indexes on keys dropped from
+// the list stay until removed by hand.
+func (db *SQLite) EnsurePropertyIndexes(ctx context.Context, keys []string) error {
+	if err := validPropertyIndexKeys(keys); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if strings.Contains(k, `"`) {
+			return fmt.Errorf("property index: key %q cannot be indexed on SQLite (contains '\"')", k)
+		}
+		sql := "CREATE INDEX IF NOT EXISTS " + propertyIndexName(k) +
+			" ON service_requests ((properties ->> " + sqlPropertyKey(k) + "))"
+		if _, err := db.db.ExecContext(ctx, sql); err != nil {
+			return fmt.Errorf("creating index on properties %q: %w", k, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sqliteImportJobColumns = `id, status, format, dictionary, only_if_newer, file, size, rows_read, created, updated,
+	unchanged, skipped, failed, samples, error, cancel_requested, attempts, created_at, updated_at, started_at,
+	finished_at, lease_until`
+
+// SQLiteImportJobRepository implements ImportJobRepository on SQLite.
+type SQLiteImportJobRepository struct {
+	db *SQLite
+}
+
+// NewSQLiteImportJobRepository creates a SQLiteImportJobRepository.
+func NewSQLiteImportJobRepository(db *SQLite) ImportJobRepository {
+	return &SQLiteImportJobRepository{db: db}
+}
+
+func scanSQLiteImportJob(row interface{ Scan(...interface{}) error }) (models.ImportJob, error) {
+	var (
+		j                              models.ImportJob
+		samples                        string
+		createdAt, updatedAt           int64
+		startedAt, finishedAt, leaseAt *int64
+	)
+	c := &j.Counts
+	if err := row.Scan(&j.ID, &j.Status, &j.Format, &j.Dictionary, &j.OnlyIfNewer, &j.File, &j.Size,
+		&c.Rows, &c.Created, &c.Updated, &c.Unchanged, &c.Skipped, &c.Failed, &samples, &j.Error,
+		&j.CancelRequested, &j.Attempts, &createdAt, &updatedAt, &startedAt, &finishedAt, &leaseAt); err != nil {
+		return models.ImportJob{}, err
+	}
+	var err error
+	if j.Samples, err = parseSamples([]byte(samples)); err != nil {
+		return models.ImportJob{}, err
+	}
+	j.CreatedAt, j.UpdatedAt = fromMillis(createdAt), fromMillis(updatedAt)
+	for _, t := range []struct {
+		ms  *int64
+		dst **time.Time
+	}{{startedAt, &j.StartedAt}, {finishedAt, &j.FinishedAt}, {leaseAt, &j.LeaseUntil}} {
+		if t.ms != nil {
+			v := fromMillis(*t.ms)
+			*t.dst = &v
+		}
+	}
+	return j, nil
+}
+
+// Create stores a job, assigning its id, created_at and updated_at.
+func (r *SQLiteImportJobRepository) Create(ctx context.Context, job models.ImportJob) (models.ImportJob, error) {
+	now := unixMillis(time.Now())
+	c := job.Counts
+	j, err := scanSQLiteImportJob(r.db.db.QueryRowContext(ctx, `INSERT INTO import_jobs (`+sqliteImportJobColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING `+sqliteImportJobColumns,
+		primitive.NewObjectID().Hex(), job.Status, job.Format, job.Dictionary, job.OnlyIfNewer, job.File, job.Size,
+		c.Rows, c.Created, c.Updated, c.Unchanged, c.Skipped, c.Failed, samplesJSON(job.Samples), job.Error,
+		job.CancelRequested, job.Attempts, now, now, nullMillisPtr(job.StartedAt), nullMillisPtr(job.FinishedAt),
+		nullMillisPtr(job.LeaseUntil)))
+	if err != nil {
+		return models.ImportJob{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return j, nil
+}
+
+// FindByID returns the job with the given id.
+func (r *SQLiteImportJobRepository) FindByID(ctx context.Context, id string) (models.ImportJob, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.ImportJob{}, ErrInvalidID
+	}
+	j, err := scanSQLiteImportJob(r.db.db.QueryRowContext(ctx,
+		"SELECT "+sqliteImportJobColumns+" FROM import_jobs WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ImportJob{}, ErrNotFound
+	}
+	if err != nil {
+		return models.ImportJob{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return j, nil
+}
+
+// transition runs a conditional UPDATE ... RETURNING on job id (the last
+// argument). A job that exists but does not match is ErrInvalidState.
+func (r *SQLiteImportJobRepository) transition(ctx context.Context, query string, args ...interface{}) (models.ImportJob, error) {
+	id := args[len(args)-1].(string)
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.ImportJob{}, ErrInvalidID
+	}
+	j, err := scanSQLiteImportJob(r.db.db.QueryRowContext(ctx, query+" RETURNING "+sqliteImportJobColumns, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := r.FindByID(ctx, id); err != nil {
+			return models.ImportJob{}, err
+		}
+		return models.ImportJob{}, ErrInvalidState
+	}
+	if err != nil {
+		return models.ImportJob{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return j, nil
+}
+
+// Claim claims the oldest waiting job in one statement; SQLite serializes
+// writers, so concurrent claims never overlap.
+func (r *SQLiteImportJobRepository) Claim(ctx context.Context, now time.Time, lease time.Duration) (models.ImportJob, error) {
+	at := unixMillis(now)
+	j, err := scanSQLiteImportJob(r.db.db.QueryRowContext(ctx, `UPDATE import_jobs SET status = 'running',
+			attempts = attempts + 1, lease_until = ?, started_at = coalesce(started_at, ?), updated_at = ?
+		WHERE pk = (SELECT pk FROM import_jobs
+			WHERE status = 'queued' OR (status = 'running' AND lease_until < ?)
+			ORDER BY pk LIMIT 1)
+		RETURNING `+sqliteImportJobColumns,
+		unixMillis(now.Add(lease)), at, at, at))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ImportJob{}, ErrNotFound
+	}
+	if err != nil {
+		return models.ImportJob{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return j, nil
+}
+
+// Update records the progress or outcome of a claimed job.
+func (r *SQLiteImportJobRepository) Update(ctx context.Context, job models.ImportJob) (models.ImportJob, error) {
+	c := job.Counts
+	return r.transition(ctx, `UPDATE import_jobs SET status = ?, rows_read = ?, created = ?, updated = ?,
+		unchanged = ?, skipped = ?, failed = ?, samples = ?, error = ?, lease_until = ?, finished_at = ?,
+		updated_at = ?
+		WHERE status = 'running' AND attempts = ? AND id = ?`,
+		job.Status, c.Rows, c.Created, c.Updated, c.Unchanged, c.Skipped, c.Failed, samplesJSON(job.Samples),
+		job.Error, nullMillisPtr(job.LeaseUntil), nullMillisPtr(job.FinishedAt), unixMillis(time.Now()),
+		job.Attempts, job.ID)
+}
+
+// Cancel cancels a queued job or asks a running one to stop, in one
+// statement.
+func (r *SQLiteImportJobRepository) Cancel(ctx context.Context, id string) (models.ImportJob, error) {
+	now := unixMillis(time.Now())
+	return r.transition(ctx, `UPDATE import_jobs SET
+		status = CASE WHEN status = 'queued' THEN 'cancelled' ELSE status END,
+		finished_at = CASE WHEN status = 'queued' THEN ? ELSE finished_at END,
+		cancel_requested = (status = 'running'), updated_at = ?
+		WHERE status IN ('queued', 'running') AND id = ?`,
+		now, now, id)
+}
+
+// Resume queues a failed or cancelled job again.
+func (r *SQLiteImportJobRepository) Resume(ctx context.Context, id string) (models.ImportJob, error) {
+	return r.transition(ctx, `UPDATE import_jobs SET status = 'queued', error = '', cancel_requested = 0,
+		finished_at = NULL, lease_until = NULL, updated_at = ?
+		WHERE status IN ('failed', 'cancelled') AND id = ?`,
+		unixMillis(time.Now()), id)
+}
+
+// Close is a no-op; the database is closed with the Storage.
+func (r *SQLiteImportJobRepository) Close() error {
+	return nil
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sqliteServiceColumns = `id, service_code, service_name, description, metadata, type, keywords,
+	service_group, attributes, created_at, updated_at`
+
+// SQLiteServiceRepository implements ServiceRepository on SQLite with the
+// same semantics as the MongoDB implementation (hex ids, unique service_code).
+type SQLiteServiceRepository struct {
+	db *SQLite
+}
+
+// NewSQLiteServiceRepository creates a SQLiteServiceRepository.
+func NewSQLiteServiceRepository(db *SQLite) ServiceRepository {
+	return &SQLiteServiceRepository{db: db}
+}
+
+func scanSQLiteService(row interface{ Scan(...interface{}) error }) (models.Service, error) {
+	var (
+		s                  models.Service
+		attrs              *string
+		createdAt, updated int64
+	)
+	if err := row.Scan(&s.ID, &s.ServiceCode, &s.ServiceName, &s.Description, &s.Metadata, &s.Type,
+		&s.Keywords, &s.Group, &attrs, &createdAt, &updated); err != nil {
+		return models.Service{}, err
+	}
+	if attrs != nil {
+		if err := json.Unmarshal([]byte(*attrs), &s.Attributes); err != nil {
+			return models.Service{}, err
+		}
+	}
+	s.CreatedAt, s.UpdatedAt = fromMillis(createdAt), fromMillis(updated)
+	return s, nil
+}
+
+// sqliteServiceError maps a single-row service statement error.
+func sqliteServiceError(err error, code string) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case isSQLiteUniqueViolation(err):
+		return fmt.Errorf("%w: duplicate service_code %q", ErrDatabase, code)
+	default:
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+}
+
+// FindAll returns all services in insertion order.
+func (r *SQLiteServiceRepository) FindAll(ctx context.Context) ([]models.Service, error) {
+	rows, err := r.db.db.QueryContext(ctx, "SELECT "+sqliteServiceColumns+" FROM services ORDER BY pk")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer rows.Close()
+
+	services := make([]models.Service, 0)
+	for rows.Next() {
+		s, err := scanSQLiteService(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		services = append(services, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return services, nil
+}
+
+// FindByID returns the service with the given id.
+func (r *SQLiteServiceRepository) FindByID(ctx context.Context, id string) (models.Service, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.Service{}, ErrInvalidID
+	}
+	s, err := scanSQLiteService(r.db.db.QueryRowContext(ctx, "SELECT "+sqliteServiceColumns+" FROM services WHERE id = ?", id))
+	if err != nil {
+		return models.Service{}, sqliteServiceError(err, "")
+	}
+	return s, nil
+}
+
+// Create adds a service, assigning its id and timestamps.
+func (r *SQLiteServiceRepository) Create(ctx context.Context, service models.Service) (models.Service, error) {
+	attrs, err := jsonbValue(service.Attributes, len(service.Attributes) == 0)
+	if err != nil {
+		return models.Service{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	now := unixMillis(time.Now())
+	s, err := scanSQLiteService(r.db.db.QueryRowContext(ctx, `INSERT INTO services
+		(id, service_code, service_name, description, metadata, type, keywords, service_group, attributes, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING `+sqliteServiceColumns,
+		primitive.NewObjectID().Hex(), service.ServiceCode, service.ServiceName, service.Description,
+		service.Metadata, service.Type, service.Keywords, service.Group, attrs, now, now))
+	if err != nil {
+		return models.Service{}, sqliteServiceError(err, service.ServiceCode)
+	}
+	return s, nil
+}
+
+// Update replaces the mutable fields of a service; service_code and createdAt
+// are kept, as in the MongoDB implementation.
+func (r *SQLiteServiceRepository) Update(ctx context.Context, service models.Service) (models.Service, error) {
+	if _, err := primitive.ObjectIDFromHex(service.ID); err != nil {
+		return models.Service{}, ErrInvalidID
+	}
+	attrs, err := jsonbValue(service.Attributes, len(service.Attributes) == 0)
+	if err != nil {
+		return models.Service{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	s, err := scanSQLiteService(r.db.db.QueryRowContext(ctx, `UPDATE services SET service_name = ?, description = ?,
+		metadata = ?, type = ?, keywords = ?, service_group = ?, attributes = ?, updated_at = ?
+		WHERE id = ? RETURNING `+sqliteServiceColumns,
+		service.ServiceName, service.Description, service.Metadata, service.Type,
+		service.Keywords, service.Group, attrs, unixMillis(time.Now()), service.ID))
+	if err != nil {
+		return models.Service{}, sqliteServiceError(err, service.ServiceCode)
+	}
+	return s, nil
+}
+
+// Delete removes a service.
+func (r *SQLiteServiceRepository) Delete(ctx context.Context, id string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return ErrInvalidID
+	}
+	res, err := r.db.db.ExecContext(ctx, "DELETE FROM services WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Close is a no-op; the database is closed with the Storage.
+func (r *SQLiteServiceRepository) Close() error {
+	return nil
+}
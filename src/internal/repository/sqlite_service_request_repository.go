@@ -0,0 +1,713 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sqliteServiceRequestStateColumns follow sqlServiceRequestWriteColumns in a
+// full SQLite write: the state the repository maintains itself.
+var sqliteServiceRequestStateColumns = []string{"id", "version", "deleted_at", "erased_at"}
+
+// sqliteWriteArgs returns the values of sqlServiceRequestWriteColumns and
+// sqliteServiceRequestStateColumns for req.
+func sqliteWriteArgs(req models.ServiceRequest) ([]interface{}, error) {
+	props, err := jsonbValue(req.Properties, len(req.Properties) == 0)
+	if err != nil {
+		return nil, err
+	}
+	var deletedAt, erasedAt *int64
+	if req.DeletedAt != nil {
+		deletedAt = nullMillis(*req.DeletedAt)
+	}
+	if req.ErasedAt != nil {
+		erasedAt = nullMillis(*req.ErasedAt)
+	}
+	return []interface{}{
+		req.ServiceRequestID, req.Status, req.StatusNotes, req.ServiceName, req.ServiceCode,
+		req.Description, req.AgencyResponsible, req.ServiceNotice, unixMillis(req.RequestedDatetime),
+		unixMillis(req.UpdatedDatetime), nullMillis(req.ExpectedDatetime), req.Address, req.AddressID,
+		req.Zipcode, req.Latitude, req.Longitude, req.MediaURL, nullString(derefString(req.FeatureID)),
+		nullString(derefString(req.FeatureGuid)), nullString(req.OrganizationID), nullString(req.Email),
+		nullString(req.FirstName), nullString(req.LastName), nullString(req.Phone),
+		nullString(req.DeviceID), nullString(req.AccountID), props, req.PropertiesSchemaVersion,
+		req.ID, req.Version, deletedAt, erasedAt,
+	}, nil
+}
+
+// scanSQLiteServiceRequest reads one row selected with sqlServiceRequestColumns.
+func scanSQLiteServiceRequest(row interface{ Scan(...interface{}) error }) (models.ServiceRequest, error) {
+	var (
+		req                                                    models.ServiceRequest
+		requested, updated                                     int64
+		expected, deletedAt, erasedAt                          *int64
+		featureID, featureGuid, orgID                          *string
+		email, firstName, lastName, phone, deviceID, accountID *string
+		props                                                  *string
+	)
+	if err := row.Scan(
+		&req.ID, &req.ServiceRequestID, &req.Status, &req.StatusNotes, &req.ServiceName, &req.ServiceCode,
+		&req.Description, &req.AgencyResponsible, &req.ServiceNotice, &requested, &updated,
+		&expected, &req.Address, &req.AddressID, &req.Zipcode, &req.Latitude, &req.Longitude, &req.MediaURL, &featureID,
+		&featureGuid, &orgID, &email, &firstName, &lastName, &phone, &deviceID, &accountID,
+		&props, &req.PropertiesSchemaVersion, &req.Version, &deletedAt, &erasedAt,
+	); err != nil {
+		return models.ServiceRequest{}, err
+	}
+
+	req.RequestedDatetime = fromMillis(requested)
+	req.UpdatedDatetime = fromMillis(updated)
+	if expected != nil {
+		req.ExpectedDatetime = fromMillis(*expected)
+	}
+	if deletedAt != nil {
+		t := fromMillis(*deletedAt)
+		req.DeletedAt = &t
+	}
+	if erasedAt != nil {
+		t := fromMillis(*erasedAt)
+		req.ErasedAt = &t
+	}
+	req.FeatureID, req.FeatureGuid = featureID, featureGuid
+	req.OrganizationID = derefString(orgID)
+	req.Email, req.FirstName, req.LastName = derefString(email), derefString(firstName), derefString(lastName)
+	req.Phone, req.DeviceID, req.AccountID = derefString(phone), derefString(deviceID), derefString(accountID)
+	if props != nil {
+		if err := json.Unmarshal([]byte(*props), &req.Properties); err != nil {
+			return models.ServiceRequest{}, err
+		}
+		if len(req.Properties) == 0 {
+			req.Properties = nil
+		}
+	}
+	return req, nil
+}
+
+// sqliteWhere accumulates a WHERE clause with positional (?) parameters.
+type sqliteWhere struct {
+	clauses []string
+	args    []interface{}
+	// match is the FTS5 expression of the text search, for ranking by
+	// relevance ("" when no required token uses the index).
+	match string
+}
+
+func (w *sqliteWhere) add(clause string, args ...interface{}) {
+	w.clauses = append(w.clauses, clause)
+	w.args = append(w.args, args...)
+}
+
+// in adds "column IN (?, ...)".
+func (w *sqliteWhere) in(column string, values []string) {
+	w.add(column+" IN ("+placeholders(len(values))+")", stringArgs(values)...)
+}
+
+// notIn adds "column NOT IN (?, ...)".
+func (w *sqliteWhere) notIn(column string, values []string) {
+	w.add(column+" NOT IN ("+placeholders(len(values))+")", stringArgs(values)...)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+func (w *sqliteWhere) String() string {
+	if len(w.clauses) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.clauses, " AND ")
+}
+
+// textSearch adds the conditions of s. Tokens of three or more characters
+// use the trigram index, a case-insensitive substring match; shorter ones
+// fall back to LIKE, which folds ASCII case only.
+func (w *sqliteWhere) textSearch(s TextSearch) {
+	tokens, all := s.required()
+	if len(tokens) == 0 {
+		w.add("0")
+		return
+	}
+	op := " OR "
+	if all {
+		op = " AND "
+	}
+	var (
+		conds []string
+		args  []interface{}
+	)
+	w.match = sqliteMatch(tokens, op)
+	if w.match != "" {
+		conds = append(conds, sqliteFTSMatch)
+		args = append(args, w.match)
+	}
+	for _, t := range tokens {
+		if !sqliteIndexable(t) {
+			conds = append(conds, sqliteTextLike)
+			args = append(args, sqliteTextLikeArgs(t)...)
+		}
+	}
+	w.add("("+strings.Join(conds, op)+")", args...)
+
+	if m := sqliteMatch(s.Excluded, " OR "); m != "" {
+		w.add("NOT "+sqliteFTSMatch, m)
+	}
+	for _, e := range s.Excluded {
+		if !sqliteIndexable(e) {
+			w.add("NOT "+sqliteTextLike, sqliteTextLikeArgs(e)...)
+		}
+	}
+}
+
+const (
+	sqliteFTSMatch = "pk IN (SELECT rowid FROM service_requests_fts WHERE service_requests_fts MATCH ?)"
+	sqliteTextLike = `(service_name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\' OR address LIKE ? ESCAPE '\' OR
+		coalesce(json_extract(properties, '$.neighborhood'), '') LIKE ? ESCAPE '\')`
+)
+
+// sqliteRank joins the FTS5 rank of a match expression (lower is better) to
+// service_requests, weighting the columns like textSearchFields.
+var sqliteRank = func() string {
+	weights := make([]string, len(textSearchFields))
+	for i, f := range textSearchFields {
+		weights[i] = strconv.Itoa(f.weight)
+	}
+	return " LEFT JOIN (SELECT rowid AS fts_pk, bm25(service_requests_fts, " + strings.Join(weights, ", ") +
+		") AS fts_rank FROM service_requests_fts WHERE service_requests_fts MATCH ?) ON fts_pk = pk"
+}()
+
+// sqliteIndexable reports whether the trigram index can match token.
+func sqliteIndexable(token string) bool {
+	return utf8.RuneCountInString(token) >= 3
+}
+
+// sqliteMatch joins the indexable tokens into an FTS5 expression of quoted
+// strings (a quoted string of trigrams is a substring match).
+func sqliteMatch(tokens []string, op string) string {
+	var quoted []string
+	for _, t := range tokens {
+		if sqliteIndexable(t) {
+			quoted = append(quoted, `"`+strings.ReplaceAll(t, `"`, `""`)+`"`)
+		}
+	}
+	return strings.Join(quoted, op)
+}
+
+func sqliteTextLikeArgs(token string) []interface{} {
+	p := likePattern(token)
+	return []interface{}{p, p, p, p}
+}
+
+// likePattern escapes s for a substring LIKE match.
+func likePattern(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(s) + "%"
+}
+
+// sqliteInBox restricts to requests whose point lies in b, using the R-tree.
+const sqliteInBox = "pk IN (SELECT pk FROM service_requests_rtree WHERE min_long <= ? AND max_long >= ? AND min_lat <= ? AND max_lat >= ?)"
+
+// sqliteServiceRequestWhere translates the filters of q (not the pagination).
+func sqliteServiceRequestWhere(q ServiceRequestQuery) *sqliteWhere {
+	w := &sqliteWhere{}
+	if !q.IncludeDeleted {
+		w.add("deleted_at IS NULL")
+	}
+	if len(q.ServiceRequestIDs) > 0 {
+		w.in("service_request_id", q.ServiceRequestIDs)
+	}
+	if len(q.ServiceCodes) > 0 {
+		w.in("service_code", q.ServiceCodes)
+	}
+	if len(q.ExcludeServiceCodes) > 0 {
+		w.notIn("service_code", q.ExcludeServiceCodes)
+	}
+	if len(q.Statuses) > 0 {
+		w.in("status", q.Statuses)
+	}
+	if q.FeatureID != "" {
+		w.add("feature_id = ?", q.FeatureID)
+	}
+	if q.FeatureGuid != "" {
+		w.add("feature_guid = ?", q.FeatureGuid)
+	}
+	if q.OrganizationID != "" {
+		w.add("organization_id = ?", q.OrganizationID)
+	}
+	if q.StartDate != nil {
+		w.add("requested_datetime >= ?", q.StartDate.UnixMilli())
+	}
+	if q.EndDate != nil {
+		w.add("requested_datetime <= ?", q.EndDate.UnixMilli())
+	}
+	if q.UpdatedAfter != nil {
+		w.add("updated_datetime >= ?", q.UpdatedAfter.UnixMilli())
+	}
+	if q.UpdatedBefore != nil {
+		w.add("updated_datetime <= ?", q.UpdatedBefore.UnixMilli())
+	}
+	if q.Near != nil {
+		b := q.Near.Bounds()
+		w.add(sqliteInBox, b.MaxLong, b.MinLong, b.MaxLat, b.MinLat)
+		w.add("haversine_m(?, ?, lat, long) <= ?", q.Near.Lat, q.Near.Long, q.Near.RadiusMeters)
+	}
+	if q.Within != nil {
+		b := q.Within
+		// The R-tree stores float32 boxes rounded outwards; the exact check
+		// keeps the edges identical to the other backends.
+		w.add(sqliteInBox, b.MaxLong, b.MinLong, b.MaxLat, b.MinLat)
+		w.add("lat BETWEEN ? AND ? AND long BETWEEN ? AND ?", b.MinLat, b.MaxLat, b.MinLong, b.MaxLong)
+	}
+	if s := q.textSearch(); !s.IsZero() {
+		w.textSearch(s)
+	}
+	for _, f := range q.Properties {
+		sqlitePropertyFilter(w, f)
+	}
+	return w
+}
+
+// sqlitePropertyFilter adds one property filter. Numeric comparisons go
+// through property_number, which is NULL for values not matching
+// numericPattern.
+func sqlitePropertyFilter(w *sqliteWhere, f PropertyFilter) {
+	clause, args := sqlitePropertyClause(f)
+	w.add(clause, args...)
+}
+
+func sqlitePropertyClause(f PropertyFilter) (string, []interface{}) {
+	value := sqlitePropertyValue(f.Key)
+	switch f.Op {
+	case PropertyExists:
+		return value + " IS NOT NULL", nil
+	case PropertyMissing:
+		return value + " IS NULL", nil
+	case PropertyNe:
+		f.Op = PropertyEq
+		clause, args := sqlitePropertyClause(f)
+		return "NOT coalesce(" + clause + ", 0)", args
+	case PropertyEq:
+		var args []interface{}
+		if f.Numeric {
+			value = "property_number(" + value + ")"
+			for _, n := range f.numbers() {
+				args = append(args, n)
+			}
+		} else {
+			for _, v := range f.Values {
+				args = append(args, v)
+			}
+		}
+		return value + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ") + ")", args
+	}
+	op := propertyOperators[f.Op].sql
+	if !f.Numeric {
+		return value + " " + op + " ?", []interface{}{f.value()}
+	}
+	n, ok := propertyNumber(f.value())
+	if !ok {
+		return "0", nil
+	}
+	return "property_number(" + value + ") " + op + " ?", []interface{}{n}
+}
+
+// sqlitePropertyValue is the value of a properties key: the expression
+// EnsurePropertyIndexes indexes, or a json_each lookup for the keys a JSON
+// path cannot name (those containing '"').
+func sqlitePropertyValue(key string) string {
+	if strings.Contains(key, `"`) {
+		return "(SELECT value FROM json_each(service_requests.properties) WHERE key = " + sqlPropertyKey(key) + ")"
+	}
+	return "(service_requests.properties ->> " + sqlPropertyKey(key) + ")"
+}
+
+// SQLiteServiceRequestRepository implements ServiceRequestRepository on an
+// embedded SQLite file with the same semantics as the MongoDB implementation.
+// Writes read, modify and replace the row inside one transaction, sharing
+// the state rules of the memory backend.
+type SQLiteServiceRequestRepository struct {
+	db *SQLite
+}
+
+// NewSQLiteServiceRequestRepository creates a SQLiteServiceRequestRepository.
+func NewSQLiteServiceRequestRepository(db *SQLite) ServiceRequestRepository {
+	return &SQLiteServiceRequestRepository{db: db}
+}
+
+func (r *SQLiteServiceRequestRepository) query(ctx context.Context, query string, args ...interface{}) ([]models.ServiceRequest, error) {
+	rows, err := r.db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer rows.Close()
+
+	results := make([]models.ServiceRequest, 0)
+	for rows.Next() {
+		req, err := scanSQLiteServiceRequest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		results = append(results, req)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return results, nil
+}
+
+// get loads the stored request (live or tombstone).
+func (r *SQLiteServiceRequestRepository) get(ctx context.Context, q sqlQuerier, serviceRequestID string) (models.ServiceRequest, bool, error) {
+	req, err := scanSQLiteServiceRequest(q.QueryRowContext(ctx,
+		"SELECT "+sqlServiceRequestColumns+" FROM service_requests WHERE service_request_id = ?", serviceRequestID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ServiceRequest{}, false, nil
+	}
+	if err != nil {
+		return models.ServiceRequest{}, false, err
+	}
+	return req, true, nil
+}
+
+// save writes req as the full stored state, inserting when it is new.
+func (r *SQLiteServiceRequestRepository) save(ctx context.Context, tx *sql.Tx, req models.ServiceRequest, insert bool) (models.ServiceRequest, error) {
+	req = cloneServiceRequest(req)
+	args, err := sqliteWriteArgs(req)
+	if err != nil {
+		return models.ServiceRequest{}, err
+	}
+	columns := append(append([]string{}, sqlServiceRequestWriteColumns...), sqliteServiceRequestStateColumns...)
+	if insert {
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+		_, err = tx.ExecContext(ctx, "INSERT INTO service_requests ("+strings.Join(columns, ", ")+") VALUES ("+marks+")", args...)
+	} else {
+		_, err = tx.ExecContext(ctx, "UPDATE service_requests SET "+strings.Join(columns, " = ?, ")+" = ? WHERE service_request_id = ?",
+			append(args, req.ServiceRequestID)...)
+	}
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return models.ServiceRequest{}, fmt.Errorf("duplicate service_request_id %q", req.ServiceRequestID)
+		}
+		return models.ServiceRequest{}, err
+	}
+	return req, nil
+}
+
+// update runs fn on the stored request inside a transaction. fn returns the
+// new state to save, or an error (sentinel errors pass through unchanged).
+func (r *SQLiteServiceRequestRepository) update(ctx context.Context, fn func(tx *sql.Tx) (models.ServiceRequest, bool, error)) (models.ServiceRequest, bool, error) {
+	var (
+		stored  models.ServiceRequest
+		created bool
+	)
+	err := r.db.withTx(ctx, func(tx *sql.Tx) error {
+		next, insert, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		stored, err = r.save(ctx, tx, next, insert)
+		created = insert
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrPreconditionFailed) || errors.Is(err, ErrInvalidPatch) {
+			return models.ServiceRequest{}, false, err
+		}
+		return models.ServiceRequest{}, false, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return stored, created, nil
+}
+
+// Find lists service requests matching the query in its sort order, with the
+// same pagination as the MongoDB implementation.
+func (r *SQLiteServiceRequestRepository) Find(ctx context.Context, q ServiceRequestQuery) ([]models.ServiceRequest, error) {
+	query, args := sqliteListing(q)
+	skip, limit := q.window()
+	return r.query(ctx, query+" LIMIT ? OFFSET ?", append(args, limit, skip)...)
+}
+
+// Each streams the requests matching q from one query, in the order of Find.
+func (r *SQLiteServiceRequestRepository) Each(ctx context.Context, q ServiceRequestQuery, fn func(models.ServiceRequest) error) error {
+	query, args := sqliteListing(q)
+	rows, err := r.db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		req, err := scanSQLiteServiceRequest(rows)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		if err := fn(req); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return nil
+}
+
+// sqliteListing builds the ordered listing of q, cursor included, without
+// its page window.
+func sqliteListing(q ServiceRequestQuery) (string, []interface{}) {
+	w := sqliteServiceRequestWhere(q)
+	orderBy, after := q.sqlOrder("id", "?", "?")
+	if q.After != nil {
+		w.add(after, q.After.Value.UnixMilli(), q.After.ID)
+	}
+	from, args := " FROM service_requests", w.args
+	if q.byRelevance() && w.match != "" {
+		from += sqliteRank
+		args = append([]interface{}{w.match}, args...)
+		orderBy = "coalesce(fts_rank, 0), " + orderBy
+	}
+	return "SELECT " + sqlServiceRequestColumns + from + w.String() + " ORDER BY " + orderBy, args
+}
+
+// Count returns how many requests match the filters of q.
+func (r *SQLiteServiceRequestRepository) Count(ctx context.Context, q ServiceRequestQuery) (int64, error) {
+	w := sqliteServiceRequestWhere(q)
+	var n int64
+	if err := r.db.db.QueryRowContext(ctx, "SELECT count(*) FROM service_requests"+w.String(), w.args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return n, nil
+}
+
+// FindByServiceRequestID returns the live request with the given id.
+func (r *SQLiteServiceRequestRepository) FindByServiceRequestID(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error) {
+	req, ok, err := r.get(ctx, r.db.db, serviceRequestID)
+	if err != nil {
+		return models.ServiceRequest{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if !ok || req.DeletedAt != nil {
+		return models.ServiceRequest{}, ErrNotFound
+	}
+	return req, nil
+}
+
+// Create inserts a new service request with the same defaults as the MongoDB
+// implementation; a duplicate service_request_id is ErrDatabase.
+func (r *SQLiteServiceRequestRepository) Create(ctx context.Context, req models.ServiceRequest) (models.ServiceRequest, error) {
+	oid := primitive.NewObjectID().Hex()
+	now := time.Now().UTC()
+	if req.ServiceRequestID == "" {
+		req.ServiceRequestID = oid
+	}
+	if req.Status == "" {
+		req.Status = "open"
+	}
+	if req.RequestedDatetime.IsZero() {
+		req.RequestedDatetime = now
+	}
+	req.UpdatedDatetime = now
+	req.DeletedAt, req.ErasedAt = nil, nil
+	req.ID = oid
+	req.Version = 1
+
+	stored, _, err := r.update(ctx, func(*sql.Tx) (models.ServiceRequest, bool, error) {
+		return req, true, nil
+	})
+	return stored, err
+}
+
+// Upsert inserts or fully replaces the request identified by
+// req.ServiceRequestID. See MongoServiceRequestRepository.Upsert.
+func (r *SQLiteServiceRequestRepository) Upsert(ctx context.Context, req models.ServiceRequest, pre Precondition) (models.ServiceRequest, bool, error) {
+	if req.ServiceRequestID == "" {
+		return models.ServiceRequest{}, false, ErrInvalidID
+	}
+	applyUpsertDefaults(&req, time.Now().UTC())
+	return r.update(ctx, func(tx *sql.Tx) (models.ServiceRequest, bool, error) {
+		existing, exists, err := r.get(ctx, tx, req.ServiceRequestID)
+		if err != nil {
+			return models.ServiceRequest{}, false, err
+		}
+		if pre.Conditional() && (!exists || !pre.satisfiedBy(existing.Version)) {
+			return models.ServiceRequest{}, false, ErrPreconditionFailed
+		}
+		if exists {
+			return replacementOf(&existing, req), false, nil
+		}
+		return replacementOf(nil, req), true, nil
+	})
+}
+
+// BulkUpsert inserts-or-replaces many requests with the same de-duplication,
+// defaults and OnlyIfNewer semantics as the MongoDB implementation. The batch
+// runs in a single transaction: a database error fails it as a whole.
+func (r *SQLiteServiceRequestRepository) BulkUpsert(ctx context.Context, reqs []models.ServiceRequest, opts BulkUpsertOptions) (BulkUpsertResult, error) {
+	res := BulkUpsertResult{Requested: len(reqs)}
+	if len(reqs) == 0 {
+		return res, nil
+	}
+
+	now := time.Now().UTC()
+	order, byID := dedupeBulk(reqs, opts, &res)
+	if len(order) == 0 {
+		return res, nil
+	}
+
+	var outcomes map[string]BulkOutcome
+	err := r.db.withTx(ctx, func(tx *sql.Tx) error {
+		outcomes = make(map[string]BulkOutcome, len(order))
+		for _, id := range order {
+			req := byID[id]
+			applyUpsertDefaults(&req, now)
+			existing, exists, err := r.get(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if exists && opts.OnlyIfNewer && !existing.UpdatedDatetime.Before(storedTime(req.UpdatedDatetime)) {
+				outcomes[id] = BulkSkipped
+				continue
+			}
+			if exists {
+				_, err = r.save(ctx, tx, replacementOf(&existing, req), false)
+				outcomes[id] = BulkUpdated
+			} else {
+				_, err = r.save(ctx, tx, replacementOf(nil, req), true)
+				outcomes[id] = BulkCreated
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return res, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	res.count(outcomes)
+	res.setOutcomes(reqs, outcomes)
+	return res, nil
+}
+
+// Patch applies a partial update to a live request. See
+// MongoServiceRequestRepository.Patch.
+func (r *SQLiteServiceRequestRepository) Patch(ctx context.Context, serviceRequestID string, patch ServiceRequestPatch, pre Precondition) (models.ServiceRequest, error) {
+	if serviceRequestID == "" {
+		return models.ServiceRequest{}, ErrInvalidID
+	}
+	if err := patch.Validate(); err != nil {
+		return models.ServiceRequest{}, errors.Join(ErrInvalidPatch, err)
+	}
+	stored, _, err := r.update(ctx, func(tx *sql.Tx) (models.ServiceRequest, bool, error) {
+		req, ok, err := r.get(ctx, tx, serviceRequestID)
+		if err != nil {
+			return models.ServiceRequest{}, false, err
+		}
+		if !ok || req.DeletedAt != nil {
+			return models.ServiceRequest{}, false, ErrNotFound
+		}
+		if !pre.satisfiedBy(req.Version) {
+			return models.ServiceRequest{}, false, ErrPreconditionFailed
+		}
+		if err := ApplyServiceRequestPatch(&req, patch, time.Now().UTC()); err != nil {
+			return models.ServiceRequest{}, false, err
+		}
+		if req.ErasedAt != nil {
+			scrubPersonal(&req)
+		}
+		req.Version++
+		return req, false, nil
+	})
+	return stored, err
+}
+
+// Delete soft-deletes a live request, leaving a tombstone. See
+// MongoServiceRequestRepository.Delete.
+func (r *SQLiteServiceRequestRepository) Delete(ctx context.Context, serviceRequestID string, pre Precondition) error {
+	if serviceRequestID == "" {
+		return ErrInvalidID
+	}
+	_, _, err := r.update(ctx, func(tx *sql.Tx) (models.ServiceRequest, bool, error) {
+		req, ok, err := r.get(ctx, tx, serviceRequestID)
+		if err != nil {
+			return models.ServiceRequest{}, false, err
+		}
+		if !ok || req.DeletedAt != nil {
+			return models.ServiceRequest{}, false, ErrNotFound
+		}
+		if !pre.satisfiedBy(req.Version) {
+			return models.ServiceRequest{}, false, ErrPreconditionFailed
+		}
+		now := storedTime(time.Now())
+		req.DeletedAt = &now
+		req.UpdatedDatetime = now
+		req.Version++
+		return req, false, nil
+	})
+	return err
+}
+
+// Erase scrubs the personal data of a live request or tombstone. See
+// MongoServiceRequestRepository.Erase.
+func (r *SQLiteServiceRequestRepository) Erase(ctx context.Context, serviceRequestID string) (models.ServiceRequest, error) {
+	if serviceRequestID == "" {
+		return models.ServiceRequest{}, ErrInvalidID
+	}
+	stored, _, err := r.update(ctx, func(tx *sql.Tx) (models.ServiceRequest, bool, error) {
+		req, ok, err := r.get(ctx, tx, serviceRequestID)
+		if err != nil {
+			return models.ServiceRequest{}, false, err
+		}
+		if !ok {
+			return models.ServiceRequest{}, false, ErrNotFound
+		}
+		now := storedTime(time.Now())
+		if req.ErasedAt == nil {
+			req.ErasedAt = &now
+		}
+		scrubPersonal(&req)
+		req.UpdatedDatetime = now
+		req.Version++
+		return req, false, nil
+	})
+	return stored, err
+}
+
+// PurgeDeleted hard-deletes tombstones soft-deleted before deletedBefore.
+func (r *SQLiteServiceRequestRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	res, err := r.db.db.ExecContext(ctx, "DELETE FROM service_requests WHERE deleted_at < ?", deletedBefore.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return n, nil
+}
+
+// FindByFeature returns live requests linked to the feature (unpaginated).
+func (r *SQLiteServiceRequestRepository) FindByFeature(ctx context.Context, featureID, featureGuid string) ([]models.ServiceRequest, error) {
+	w := sqliteServiceRequestWhere(ServiceRequestQuery{FeatureID: featureID, FeatureGuid: featureGuid})
+	return r.query(ctx, "SELECT "+sqlServiceRequestColumns+" FROM service_requests"+w.String()+
+		" ORDER BY requested_datetime DESC, id DESC", w.args...)
+}
+
+// FindByOrganization returns live requests of the organization (unpaginated).
+func (r *SQLiteServiceRequestRepository) FindByOrganization(ctx context.Context, organizationID string) ([]models.ServiceRequest, error) {
+	return r.query(ctx, "SELECT "+sqlServiceRequestColumns+
+		" FROM service_requests WHERE organization_id = ? AND deleted_at IS NULL"+
+		" ORDER BY requested_datetime DESC, id DESC", organizationID)
+}
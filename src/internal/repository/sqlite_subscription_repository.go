@@ -0,0 +1,281 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	sqliteSubscriptionColumns = `id, url, secret, service_request_id, service_code, organization_id, bbox, created_at`
+	sqliteDeliveryColumns     = `id, subscription_id, event, service_request_id, status, attempts, response_status,
+	last_error, created_at, next_attempt_at, delivered_at, payload`
+)
+
+// SQLiteSubscriptionRepository implements SubscriptionRepository on SQLite.
+type SQLiteSubscriptionRepository struct {
+	db *SQLite
+}
+
+// NewSQLiteSubscriptionRepository creates a SQLiteSubscriptionRepository.
+func NewSQLiteSubscriptionRepository(db *SQLite) SubscriptionRepository {
+	return &SQLiteSubscriptionRepository{db: db}
+}
+
+func scanSQLiteSubscription(row interface{ Scan(...interface{}) error }) (models.Subscription, error) {
+	var (
+		s         models.Subscription
+		createdAt int64
+	)
+	if err := row.Scan(&s.ID, &s.URL, &s.Secret, &s.ServiceRequestID, &s.ServiceCode,
+		&s.OrganizationID, &s.BBox, &createdAt); err != nil {
+		return models.Subscription{}, err
+	}
+	s.CreatedAt = fromMillis(createdAt)
+	return s, nil
+}
+
+func scanSQLiteDelivery(row interface{ Scan(...interface{}) error }) (models.WebhookDelivery, error) {
+	var (
+		d                    models.WebhookDelivery
+		createdAt            int64
+		nextAttempt, deliver *int64
+	)
+	if err := row.Scan(&d.ID, &d.SubscriptionID, &d.Event, &d.ServiceRequestID, &d.Status, &d.Attempts,
+		&d.ResponseStatus, &d.LastError, &createdAt, &nextAttempt, &deliver, &d.Payload); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	d.CreatedAt = fromMillis(createdAt)
+	if nextAttempt != nil {
+		t := fromMillis(*nextAttempt)
+		d.NextAttemptAt = &t
+	}
+	if deliver != nil {
+		t := fromMillis(*deliver)
+		d.DeliveredAt = &t
+	}
+	return d, nil
+}
+
+// nullMillisPtr is nullMillis for an optional timestamp.
+func nullMillisPtr(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	return nullMillis(*t)
+}
+
+func querySQLiteDeliveries(ctx context.Context, q sqlQuerier, query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		d, err := scanSQLiteDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// FindAll returns all subscriptions, oldest first.
+func (r *SQLiteSubscriptionRepository) FindAll(ctx context.Context) ([]models.Subscription, error) {
+	rows, err := r.db.db.QueryContext(ctx, "SELECT "+sqliteSubscriptionColumns+" FROM subscriptions ORDER BY pk")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer rows.Close()
+
+	subs := make([]models.Subscription, 0)
+	for rows.Next() {
+		s, err := scanSQLiteSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		subs = append(subs, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return subs, nil
+}
+
+// FindByID returns the subscription with the given id.
+func (r *SQLiteSubscriptionRepository) FindByID(ctx context.Context, id string) (models.Subscription, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.Subscription{}, ErrInvalidID
+	}
+	s, err := scanSQLiteSubscription(r.db.db.QueryRowContext(ctx,
+		"SELECT "+sqliteSubscriptionColumns+" FROM subscriptions WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Subscription{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Subscription{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return s, nil
+}
+
+// Create stores a subscription, assigning its id and created_at.
+func (r *SQLiteSubscriptionRepository) Create(ctx context.Context, sub models.Subscription) (models.Subscription, error) {
+	s, err := scanSQLiteSubscription(r.db.db.QueryRowContext(ctx, `INSERT INTO subscriptions
+		(id, url, secret, service_request_id, service_code, organization_id, bbox, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING `+sqliteSubscriptionColumns,
+		primitive.NewObjectID().Hex(), sub.URL, sub.Secret, sub.ServiceRequestID, sub.ServiceCode,
+		sub.OrganizationID, sub.BBox, unixMillis(time.Now())))
+	if err != nil {
+		return models.Subscription{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return s, nil
+}
+
+// Delete removes a subscription and, in the same transaction, its deliveries.
+func (r *SQLiteSubscriptionRepository) Delete(ctx context.Context, id string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return ErrInvalidID
+	}
+	err := r.db.withTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "DELETE FROM subscriptions WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE subscription_id = ?", id)
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return nil
+}
+
+// CreateDeliveries queues deliveries in one transaction, assigning their ids.
+func (r *SQLiteSubscriptionRepository) CreateDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) ([]models.WebhookDelivery, error) {
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+	for _, d := range deliveries {
+		if _, err := primitive.ObjectIDFromHex(d.SubscriptionID); err != nil {
+			return nil, ErrInvalidID
+		}
+	}
+	out := make([]models.WebhookDelivery, 0, len(deliveries))
+	err := r.db.withTx(ctx, func(tx *sql.Tx) error {
+		for _, d := range deliveries {
+			stored, err := scanSQLiteDelivery(tx.QueryRowContext(ctx, `INSERT INTO webhook_deliveries (`+sqliteDeliveryColumns+`)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING `+sqliteDeliveryColumns,
+				primitive.NewObjectID().Hex(), d.SubscriptionID, d.Event, d.ServiceRequestID, d.Status, d.Attempts,
+				d.ResponseStatus, d.LastError, unixMillis(d.CreatedAt), nullMillisPtr(d.NextAttemptAt),
+				nullMillisPtr(d.DeliveredAt), d.Payload))
+			if err != nil {
+				return err
+			}
+			out = append(out, stored)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return out, nil
+}
+
+// ClaimDueDeliveries selects and leases due deliveries in one transaction;
+// SQLite serializes writers, so concurrent claims never overlap.
+func (r *SQLiteSubscriptionRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	var claimed []models.WebhookDelivery
+	err := r.db.withTx(ctx, func(tx *sql.Tx) error {
+		due, err := querySQLiteDeliveries(ctx, tx, "SELECT "+sqliteDeliveryColumns+` FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`,
+			now.UnixMilli(), limit)
+		if err != nil {
+			return err
+		}
+		until := storedTime(now.Add(lease))
+		for i := range due {
+			if _, err := tx.ExecContext(ctx, "UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ?",
+				until.UnixMilli(), due[i].ID); err != nil {
+				return err
+			}
+			due[i].NextAttemptAt = &until
+		}
+		claimed = due
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return claimed, nil
+}
+
+// UpdateDelivery records the outcome of an attempt.
+func (r *SQLiteSubscriptionRepository) UpdateDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	if _, err := primitive.ObjectIDFromHex(d.ID); err != nil {
+		return ErrInvalidID
+	}
+	res, err := r.db.db.ExecContext(ctx, `UPDATE webhook_deliveries SET status = ?, attempts = ?,
+		response_status = ?, last_error = ?, next_attempt_at = ?, delivered_at = ? WHERE id = ?`,
+		d.Status, d.Attempts, d.ResponseStatus, d.LastError,
+		nullMillisPtr(d.NextAttemptAt), nullMillisPtr(d.DeliveredAt), d.ID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// FindDeliveryByID returns the delivery with the given id.
+func (r *SQLiteSubscriptionRepository) FindDeliveryByID(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.WebhookDelivery{}, ErrInvalidID
+	}
+	d, err := scanSQLiteDelivery(r.db.db.QueryRowContext(ctx,
+		"SELECT "+sqliteDeliveryColumns+" FROM webhook_deliveries WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.WebhookDelivery{}, ErrNotFound
+	}
+	if err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return d, nil
+}
+
+// FindDeliveries returns the newest deliveries of a subscription.
+func (r *SQLiteSubscriptionRepository) FindDeliveries(ctx context.Context, subscriptionID, status string, limit int) ([]models.WebhookDelivery, error) {
+	if _, err := primitive.ObjectIDFromHex(subscriptionID); err != nil {
+		return nil, ErrInvalidID
+	}
+	out, err := querySQLiteDeliveries(ctx, r.db.db, "SELECT "+sqliteDeliveryColumns+` FROM webhook_deliveries
+		WHERE subscription_id = ? AND (? = '' OR status = ?) ORDER BY id DESC LIMIT ?`,
+		subscriptionID, status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return out, nil
+}
+
+// Close is a no-op; the database is closed with the Storage.
+func (r *SQLiteSubscriptionRepository) Close() error {
+	return nil
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sqliteUserColumns = `id, email, first_name, last_name, phone, organization, org_type, organizations,
+	created_at, updated_at`
+
+// SQLiteUserRepository implements UserRepository on SQLite with the same
+// semantics as the MongoDB implementation (hex ids, unique email).
+type SQLiteUserRepository struct {
+	db *SQLite
+}
+
+// NewSQLiteUserRepository creates a SQLiteUserRepository.
+func NewSQLiteUserRepository(db *SQLite) UserRepository {
+	return &SQLiteUserRepository{db: db}
+}
+
+func scanSQLiteUser(row interface{ Scan(...interface{}) error }) (models.User, error) {
+	var (
+		u                  models.User
+		orgs               *string
+		createdAt, updated int64
+	)
+	if err := row.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.Phone, &u.Organization,
+		&u.OrgType, &orgs, &createdAt, &updated); err != nil {
+		return models.User{}, err
+	}
+	if orgs != nil {
+		if err := json.Unmarshal([]byte(*orgs), &u.Organizations); err != nil {
+			return models.User{}, err
+		}
+	}
+	u.CreatedAt, u.UpdatedAt = fromMillis(createdAt), fromMillis(updated)
+	return u, nil
+}
+
+// sqliteUserError maps a single-row user statement error.
+func sqliteUserError(err error, email string) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case isSQLiteUniqueViolation(err):
+		return fmt.Errorf("%w: duplicate email %q", ErrDatabase, email)
+	default:
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+}
+
+// FindAll returns all users in insertion order.
+func (r *SQLiteUserRepository) FindAll(ctx context.Context) ([]models.User, error) {
+	rows, err := r.db.db.QueryContext(ctx, "SELECT "+sqliteUserColumns+" FROM users ORDER BY pk")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		u, err := scanSQLiteUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return users, nil
+}
+
+// FindByID returns the user with the given id.
+func (r *SQLiteUserRepository) FindByID(ctx context.Context, id string) (models.User, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return models.User{}, ErrInvalidID
+	}
+	u, err := scanSQLiteUser(r.db.db.QueryRowContext(ctx, "SELECT "+sqliteUserColumns+" FROM users WHERE id = ?", id))
+	if err != nil {
+		return models.User{}, sqliteUserError(err, "")
+	}
+	return u, nil
+}
+
+// Create adds a user, assigning its id and timestamps.
+func (r *SQLiteUserRepository) Create(ctx context.Context, user models.User) (models.User, error) {
+	orgs, err := jsonbValue(user.Organizations, len(user.Organizations) == 0)
+	if err != nil {
+		return models.User{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	now := unixMillis(time.Now())
+	u, err := scanSQLiteUser(r.db.db.QueryRowContext(ctx, `INSERT INTO users
+		(id, email, first_name, last_name, phone, organization, org_type, organizations, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING `+sqliteUserColumns,
+		primitive.NewObjectID().Hex(), user.Email, user.FirstName, user.LastName, user.Phone,
+		user.Organization, string(user.OrgType), orgs, now, now))
+	if err != nil {
+		return models.User{}, sqliteUserError(err, user.Email)
+	}
+	return u, nil
+}
+
+// Update replaces the profile fields of a user; organizations and createdAt
+// are kept, as in the MongoDB implementation.
+func (r *SQLiteUserRepository) Update(ctx context.Context, user models.User) (models.User, error) {
+	if _, err := primitive.ObjectIDFromHex(user.ID); err != nil {
+		return models.User{}, ErrInvalidID
+	}
+	u, err := scanSQLiteUser(r.db.db.QueryRowContext(ctx, `UPDATE users SET email = ?, first_name = ?, last_name = ?,
+		phone = ?, organization = ?, org_type = ?, updated_at = ?
+		WHERE id = ? RETURNING `+sqliteUserColumns,
+		user.Email, user.FirstName, user.LastName, user.Phone, user.Organization,
+		string(user.OrgType), unixMillis(time.Now()), user.ID))
+	if err != nil {
+		return models.User{}, sqliteUserError(err, user.Email)
+	}
+	return u, nil
+}
+
+// Delete removes a user.
+func (r *SQLiteUserRepository) Delete(ctx context.Context, id string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return ErrInvalidID
+	}
+	res, err := r.db.db.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Close is a no-op; the database is closed with the Storage.
+func (r *SQLiteUserRepository) Close() error {
+	return nil
+}
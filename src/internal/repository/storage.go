@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/timoruohomaki/open311-to-Go/pkg/ratelimit"
+)
+
+// Storage backend names (STORAGE_BACKEND).
+const (
+	BackendMongoDB  = "mongodb"
+	BackendPostgres = "postgres"
+	BackendSQLite   = "sqlite"
+	BackendMemory   = "memory"
+)
+
+// Pinger reports whether a storage backend is reachable (GET /health).
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Storage bundles the repositories of one storage backend, so the API and
+// background jobs never depend on a concrete database.
+type Storage struct {
+	// Backend is the backend name, e.g. BackendMongoDB.
+	Backend         string
+	Users           UserRepository
+	Services        ServiceRepository
+	ServiceRequests ServiceRequestRepository
+	Subscriptions   SubscriptionRepository
+	ImportJobs      ImportJobRepository
+	Pinger          Pinger
+	// RateLimitStore shares rate-limit buckets across replicas; nil when the
+	// backend cannot (RATE_LIMIT_STORE then falls back to memory).
+	RateLimitStore ratelimit.Store
+	// ChangeFeed streams committed writes to service requests, with
+	// ChangeCheckpoints saving how far each consumer got; both are nil when
+	// the backend has no change stream.
+	ChangeFeed        ChangeFeed
+	ChangeCheckpoints CheckpointStore
+
+	close func() error
+}
+
+// Close releases the backend's connections.
+func (s *Storage) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close()
+}
+
+// NewMongoStorage wires the MongoDB repositories on an open connection.
+// Closing the Storage disconnects db.
+func NewMongoStorage(db *MongoDB, serviceRequestsCollection string) *Storage {
+	changeFeed := NewMongoChangeFeed(db, serviceRequestsCollection)
+	return &Storage{
+		Backend:           BackendMongoDB,
+		Users:             NewMongoUserRepository(db),
+		Services:          NewMongoServiceRepository(db),
+		ServiceRequests:   NewMongoServiceRequestRepository(db, serviceRequestsCollection),
+		Subscriptions:     NewMongoSubscriptionRepository(db),
+		ImportJobs:        NewMongoImportJobRepository(db),
+		Pinger:            db,
+		RateLimitStore:    NewMongoRateLimitStore(db),
+		ChangeFeed:        changeFeed,
+		ChangeCheckpoints: changeFeed,
+		close:             db.Disconnect,
+	}
+}
+
+// NewPostgresStorage wires the PostgreSQL repositories on an open, migrated
+// connection. Closing the Storage closes db.
+func NewPostgresStorage(db *Postgres) *Storage {
+	return &Storage{
+		Backend:         BackendPostgres,
+		Users:           NewPostgresUserRepository(db),
+		Services:        NewPostgresServiceRepository(db),
+		ServiceRequests: NewPostgresServiceRequestRepository(db),
+		Subscriptions:   NewPostgresSubscriptionRepository(db),
+		ImportJobs:      NewPostgresImportJobRepository(db),
+		Pinger:          db,
+		close:           db.Close,
+	}
+}
+
+// NewSQLiteStorage wires the SQLite repositories on an open, migrated
+// database. Closing the Storage closes db.
+func NewSQLiteStorage(db *SQLite) *Storage {
+	return &Storage{
+		Backend:         BackendSQLite,
+		Users:           NewSQLiteUserRepository(db),
+		Services:        NewSQLiteServiceRepository(db),
+		ServiceRequests: NewSQLiteServiceRequestRepository(db),
+		Subscriptions:   NewSQLiteSubscriptionRepository(db),
+		ImportJobs:      NewSQLiteImportJobRepository(db),
+		Pinger:          db,
+		close:           db.Close,
+	}
+}
+
+// NewMemoryStorage creates an empty in-memory backend. Nothing is persisted.
+func NewMemoryStorage() *Storage {
+	return &Storage{
+		Backend:         BackendMemory,
+		Users:           NewMemoryUserRepository(),
+		Services:        NewMemoryServiceRepository(),
+		ServiceRequests: NewMemoryServiceRequestRepository(),
+		Subscriptions:   NewMemorySubscriptionRepository(),
+		ImportJobs:      NewMemoryImportJobRepository(),
+		Pinger:          memoryPinger{},
+	}
+}
+
+// memoryPinger is always healthy.
+type memoryPinger struct{}
+
+func (memoryPinger) Ping(context.Context) error { return nil }
@@ -0,0 +1,341 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SubscriptionRepository stores webhook subscriptions and their delivery
+// queue and history.
+type SubscriptionRepository interface {
+	Repository
+	// FindAll returns all subscriptions, oldest first.
+	FindAll(ctx context.Context) ([]models.Subscription, error)
+	FindByID(ctx context.Context, id string) (models.Subscription, error)
+	// Create stores a subscription, assigning its id and created_at.
+	Create(ctx context.Context, sub models.Subscription) (models.Subscription, error)
+	// Delete removes a subscription together with its deliveries.
+	Delete(ctx context.Context, id string) error
+
+	// CreateDeliveries queues deliveries, assigning their ids.
+	CreateDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) ([]models.WebhookDelivery, error)
+	// ClaimDueDeliveries returns up to limit pending deliveries whose
+	// next_attempt_at is not after now, earliest first, and atomically moves
+	// their next_attempt_at to now+lease so no other worker claims them
+	// meanwhile (a delivery whose worker dies is retried once the lease ends).
+	ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	// UpdateDelivery records the outcome of an attempt: it stores the status,
+	// attempts, response_status, last_error, next_attempt_at and delivered_at
+	// of d.
+	UpdateDelivery(ctx context.Context, d models.WebhookDelivery) error
+	FindDeliveryByID(ctx context.Context, id string) (models.WebhookDelivery, error)
+	// FindDeliveries returns the newest deliveries of a subscription, up to
+	// limit, optionally only those in status.
+	FindDeliveries(ctx context.Context, subscriptionID, status string, limit int) ([]models.WebhookDelivery, error)
+}
+
+// Collections of the MongoDB SubscriptionRepository.
+const (
+	subscriptionsCollection     = "subscriptions"
+	webhookDeliveriesCollection = "webhook_deliveries"
+)
+
+// subscriptionDoc is the persistence representation of a Subscription.
+type subscriptionDoc struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty"`
+	URL              string             `bson:"url"`
+	Secret           string             `bson:"secret"`
+	ServiceRequestID string             `bson:"service_request_id,omitempty"`
+	ServiceCode      string             `bson:"service_code,omitempty"`
+	OrganizationID   string             `bson:"organizationId,omitempty"`
+	BBox             string             `bson:"bbox,omitempty"`
+	CreatedAt        time.Time          `bson:"created_at"`
+}
+
+func (d subscriptionDoc) toModel() models.Subscription {
+	return models.Subscription{
+		ID:               d.ID.Hex(),
+		URL:              d.URL,
+		Secret:           d.Secret,
+		ServiceRequestID: d.ServiceRequestID,
+		ServiceCode:      d.ServiceCode,
+		OrganizationID:   d.OrganizationID,
+		BBox:             d.BBox,
+		CreatedAt:        d.CreatedAt,
+	}
+}
+
+// webhookDeliveryDoc is the persistence representation of a WebhookDelivery.
+type webhookDeliveryDoc struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty"`
+	SubscriptionID   primitive.ObjectID `bson:"subscription_id"`
+	Event            string             `bson:"event"`
+	ServiceRequestID string             `bson:"service_request_id"`
+	Status           string             `bson:"status"`
+	Attempts         int                `bson:"attempts"`
+	ResponseStatus   int                `bson:"response_status,omitempty"`
+	LastError        string             `bson:"last_error,omitempty"`
+	CreatedAt        time.Time          `bson:"created_at"`
+	NextAttemptAt    *time.Time         `bson:"next_attempt_at,omitempty"`
+	DeliveredAt      *time.Time         `bson:"delivered_at,omitempty"`
+	Payload          []byte             `bson:"payload"`
+}
+
+func (d webhookDeliveryDoc) toModel() models.WebhookDelivery {
+	return models.WebhookDelivery{
+		ID:               d.ID.Hex(),
+		SubscriptionID:   d.SubscriptionID.Hex(),
+		Event:            d.Event,
+		ServiceRequestID: d.ServiceRequestID,
+		Status:           d.Status,
+		Attempts:         d.Attempts,
+		ResponseStatus:   d.ResponseStatus,
+		LastError:        d.LastError,
+		CreatedAt:        d.CreatedAt.UTC(),
+		NextAttemptAt:    storedTimePtr(d.NextAttemptAt),
+		DeliveredAt:      storedTimePtr(d.DeliveredAt),
+		Payload:          d.Payload,
+	}
+}
+
+// MongoSubscriptionRepository implements SubscriptionRepository on MongoDB.
+type MongoSubscriptionRepository struct {
+	subscriptions *mongo.Collection
+	deliveries    *mongo.Collection
+}
+
+// NewMongoSubscriptionRepository creates a MongoSubscriptionRepository.
+func NewMongoSubscriptionRepository(db *MongoDB) SubscriptionRepository {
+	return &MongoSubscriptionRepository{
+		subscriptions: db.GetCollection(subscriptionsCollection),
+		deliveries:    db.GetCollection(webhookDeliveriesCollection),
+	}
+}
+
+// FindAll returns all subscriptions, oldest first.
+func (r *MongoSubscriptionRepository) FindAll(ctx context.Context) ([]models.Subscription, error) {
+	cursor, err := r.subscriptions.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	var docs []subscriptionDoc
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	subs := make([]models.Subscription, 0, len(docs))
+	for _, d := range docs {
+		subs = append(subs, d.toModel())
+	}
+	return subs, nil
+}
+
+// FindByID returns the subscription with the given id.
+func (r *MongoSubscriptionRepository) FindByID(ctx context.Context, id string) (models.Subscription, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Subscription{}, ErrInvalidID
+	}
+	var doc subscriptionDoc
+	if err := r.subscriptions.FindOne(ctx, bson.M{"_id": oid}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Subscription{}, ErrNotFound
+		}
+		return models.Subscription{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return doc.toModel(), nil
+}
+
+// Create stores a subscription, assigning its id and created_at.
+func (r *MongoSubscriptionRepository) Create(ctx context.Context, sub models.Subscription) (models.Subscription, error) {
+	doc := subscriptionDoc{
+		ID:               primitive.NewObjectID(),
+		URL:              sub.URL,
+		Secret:           sub.Secret,
+		ServiceRequestID: sub.ServiceRequestID,
+		ServiceCode:      sub.ServiceCode,
+		OrganizationID:   sub.OrganizationID,
+		BBox:             sub.BBox,
+		CreatedAt:        storedTime(time.Now()),
+	}
+	if _, err := r.subscriptions.InsertOne(ctx, doc); err != nil {
+		return models.Subscription{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return doc.toModel(), nil
+}
+
+// Delete removes a subscription and its deliveries.
+func (r *MongoSubscriptionRepository) Delete(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrInvalidID
+	}
+	res, err := r.subscriptions.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	if _, err := r.deliveries.DeleteMany(ctx, bson.M{"subscription_id": oid}); err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return nil
+}
+
+// CreateDeliveries queues deliveries, assigning their ids.
+func (r *MongoSubscriptionRepository) CreateDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) ([]models.WebhookDelivery, error) {
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+	docs := make([]interface{}, 0, len(deliveries))
+	out := make([]models.WebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		subID, err := primitive.ObjectIDFromHex(d.SubscriptionID)
+		if err != nil {
+			return nil, ErrInvalidID
+		}
+		doc := webhookDeliveryDoc{
+			ID:               primitive.NewObjectID(),
+			SubscriptionID:   subID,
+			Event:            d.Event,
+			ServiceRequestID: d.ServiceRequestID,
+			Status:           d.Status,
+			Attempts:         d.Attempts,
+			ResponseStatus:   d.ResponseStatus,
+			LastError:        d.LastError,
+			CreatedAt:        storedTime(d.CreatedAt),
+			NextAttemptAt:    storedTimePtr(d.NextAttemptAt),
+			DeliveredAt:      storedTimePtr(d.DeliveredAt),
+			Payload:          d.Payload,
+		}
+		docs = append(docs, doc)
+		out = append(out, doc.toModel())
+	}
+	if _, err := r.deliveries.InsertMany(ctx, docs); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return out, nil
+}
+
+// storedTimePtr is storedTime for an optional timestamp.
+func storedTimePtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := storedTime(*t)
+	return &u
+}
+
+// ClaimDueDeliveries claims due deliveries one findOneAndUpdate at a time, so
+// concurrent workers never claim the same one.
+func (r *MongoSubscriptionRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	until := storedTime(now.Add(lease))
+	claimed := make([]models.WebhookDelivery, 0)
+	for len(claimed) < limit {
+		var doc webhookDeliveryDoc
+		err := r.deliveries.FindOneAndUpdate(ctx,
+			bson.M{"status": models.DeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"next_attempt_at": until}},
+			options.FindOneAndUpdate().
+				SetSort(bson.D{{Key: "next_attempt_at", Value: 1}, {Key: "_id", Value: 1}}).
+				SetReturnDocument(options.After),
+		).Decode(&doc)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+		}
+		claimed = append(claimed, doc.toModel())
+	}
+	return claimed, nil
+}
+
+// UpdateDelivery records the outcome of an attempt.
+func (r *MongoSubscriptionRepository) UpdateDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	oid, err := primitive.ObjectIDFromHex(d.ID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	set := bson.M{
+		"status":          d.Status,
+		"attempts":        d.Attempts,
+		"response_status": d.ResponseStatus,
+		"last_error":      d.LastError,
+	}
+	unset := bson.M{}
+	for field, t := range map[string]*time.Time{"next_attempt_at": d.NextAttemptAt, "delivered_at": d.DeliveredAt} {
+		if t != nil {
+			set[field] = storedTime(*t)
+		} else {
+			unset[field] = ""
+		}
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	res, err := r.deliveries.UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// FindDeliveryByID returns the delivery with the given id.
+func (r *MongoSubscriptionRepository) FindDeliveryByID(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.WebhookDelivery{}, ErrInvalidID
+	}
+	var doc webhookDeliveryDoc
+	if err := r.deliveries.FindOne(ctx, bson.M{"_id": oid}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.WebhookDelivery{}, ErrNotFound
+		}
+		return models.WebhookDelivery{}, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	return doc.toModel(), nil
+}
+
+// FindDeliveries returns the newest deliveries of a subscription.
+func (r *MongoSubscriptionRepository) FindDeliveries(ctx context.Context, subscriptionID, status string, limit int) ([]models.WebhookDelivery, error) {
+	oid, err := primitive.ObjectIDFromHex(subscriptionID)
+	if err != nil {
+		return nil, ErrInvalidID
+	}
+	filter := bson.M{"subscription_id": oid}
+	if status != "" {
+		filter["status"] = status
+	}
+	cursor, err := r.deliveries.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	var docs []webhookDeliveryDoc
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
+	}
+	out := make([]models.WebhookDelivery, 0, len(docs))
+	for _, d := range docs {
+		out = append(out, d.toModel())
+	}
+	return out, nil
+}
+
+// Close is a no-op; the connection is closed with the Storage.
+func (r *MongoSubscriptionRepository) Close() error {
+	return nil
+}
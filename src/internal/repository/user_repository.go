@@ -48,6 +48,9 @@ func (d userDoc) toModel() models.User {
 	}
 }
 
+// usersCollection holds the users (named "Users" before migration 1).
+const usersCollection = "users"
+
 // MongoUserRepository implements UserRepository interface using MongoDB
 type MongoUserRepository struct {
 	db         *MongoDB
@@ -58,7 +61,7 @@ type MongoUserRepository struct {
 func NewMongoUserRepository(db *MongoDB) UserRepository {
 	return &MongoUserRepository{
 		db:         db,
-		collection: db.GetCollection("Users"),
+		collection: db.GetCollection(usersCollection),
 	}
 }
 
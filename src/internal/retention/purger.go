@@ -0,0 +1,54 @@
+// Package retention runs the background housekeeping that enforces data
+// retention on stored service requests.
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+// Purger hard-deletes soft-deleted service requests once they are older than
+// the retention period.
+type Purger struct {
+	repo      repository.ServiceRequestRepository
+	retention time.Duration
+	interval  time.Duration
+	log       logger.Logger
+	now       func() time.Time
+}
+
+// NewPurger creates a Purger that removes tombstones deleted more than
+// retention ago, checking every interval.
+func NewPurger(repo repository.ServiceRequestRepository, retention, interval time.Duration, log logger.Logger) *Purger {
+	return &Purger{repo: repo, retention: retention, interval: interval, log: log, now: time.Now}
+}
+
+// RunOnce purges the expired tombstones and returns how many were removed.
+func (p *Purger) RunOnce(ctx context.Context) (int64, error) {
+	return p.repo.PurgeDeleted(ctx, p.now().UTC().Add(-p.retention))
+}
+
+// Run purges immediately and then every interval until ctx is cancelled.
+// Failures are logged and retried on the next tick.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		n, err := p.RunOnce(ctx)
+		switch {
+		case err != nil:
+			p.log.Errorf("Failed to purge soft-deleted service requests: %v", err)
+		case n > 0:
+			p.log.Infof("Purged %d soft-deleted service requests older than %s", n, p.retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+)
+
+type purgeRepo struct {
+	repository.ServiceRequestRepository
+	deletedBefore time.Time
+}
+
+func (r *purgeRepo) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	r.deletedBefore = deletedBefore
+	return 3, nil
+}
+
+func TestPurgerRunOnce(t *testing.T) {
+	repo := &purgeRepo{}
+	p := NewPurger(repo, 30*24*time.Hour, time.Hour, nil)
+	p.now = func() time.Time { return time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC) }
+
+	n, err := p.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, time.Date(2026, 5, 31, 0, 0, 0, 0, time.UTC), repo.deletedBefore)
+}
@@ -0,0 +1,172 @@
+// Package stream fans service request changes out to live subscribers (the
+// Server-Sent Events feed). The hub never blocks the writer that reports a
+// change: a subscriber that cannot keep up is dropped and resumes from the
+// hub's history when it reconnects.
+package stream
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+)
+
+// Errors returned by Subscribe.
+var (
+	ErrTooManySubscribers = errors.New("too many stream subscribers")
+	ErrClosed             = errors.New("stream hub closed")
+)
+
+// Event is one change as streamed.
+type Event struct {
+	// ID is "<epoch>-<sequence>": increasing within a hub, with an epoch that
+	// changes when the process restarts, so a stale Last-Event-ID is detected.
+	ID string
+	// Operation is repository.ChangeCreate, ChangeUpdate or ChangeDelete.
+	Operation string
+	Request   models.ServiceRequest
+	seq       uint64
+}
+
+// Subscription receives the events published after it was made.
+type Subscription struct {
+	hub    *Hub
+	events chan Event
+}
+
+// Events delivers the events; it is closed when the subscriber fell behind
+// (or was closed), after which it should reconnect with the last ID it saw.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close unsubscribes.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.drop(s)
+}
+
+// Hub is a bounded fan-out of service request changes: it keeps the last
+// `history` events for resuming, buffers `buffer` events per subscriber and
+// admits at most `maxSubscribers`.
+type Hub struct {
+	mu             sync.Mutex
+	epoch          string
+	seq            uint64
+	history        []Event // ring, oldest first once full
+	next           int     // ring position of the next event
+	size           int
+	buffer         int
+	maxSubscribers int
+	subs           map[*Subscription]struct{}
+	closed         bool
+}
+
+// NewHub creates an empty hub.
+func NewHub(history, buffer, maxSubscribers int) *Hub {
+	return &Hub{
+		epoch:          strconv.FormatInt(time.Now().UnixMilli(), 36),
+		history:        make([]Event, max(history, 1)),
+		buffer:         max(buffer, 1),
+		maxSubscribers: maxSubscribers,
+		subs:           make(map[*Subscription]struct{}),
+	}
+}
+
+// Observe publishes changes; it is a repository.ChangeObserver. It only takes
+// the hub's lock and never waits for a subscriber.
+func (h *Hub) Observe(ctx context.Context, changes []repository.ServiceRequestChange) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range changes {
+		h.seq++
+		e := Event{
+			ID:        h.epoch + "-" + strconv.FormatUint(h.seq, 10),
+			Operation: c.Operation,
+			Request:   c.Request,
+			seq:       h.seq,
+		}
+		h.history[h.next] = e
+		h.next = (h.next + 1) % len(h.history)
+		h.size = min(h.size+1, len(h.history))
+
+		for s := range h.subs {
+			select {
+			case s.events <- e:
+			default:
+				h.drop(s) // lagging: it resumes from history on reconnect
+			}
+		}
+	}
+}
+
+// drop removes and closes a subscription. Callers hold the lock.
+func (h *Hub) drop(s *Subscription) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.events)
+	}
+}
+
+// Close disconnects every subscriber and refuses new ones, so open streams
+// do not hold up a server shutdown (register it with
+// http.Server.RegisterOnShutdown). Clients reconnect to another replica.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for s := range h.subs {
+		h.drop(s)
+	}
+}
+
+// Subscribe registers a subscriber. With a lastEventID it also returns the
+// events after it still in the history; resumed is false when they are not
+// (the ID predates the history or this process), and the subscriber must
+// reload its state instead.
+func (h *Hub) Subscribe(lastEventID string) (sub *Subscription, replay []Event, resumed bool, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, nil, false, ErrClosed
+	}
+	if h.maxSubscribers > 0 && len(h.subs) >= h.maxSubscribers {
+		return nil, nil, false, ErrTooManySubscribers
+	}
+
+	resumed = true
+	if lastEventID != "" {
+		replay, resumed = h.since(lastEventID)
+	}
+	sub = &Subscription{hub: h, events: make(chan Event, h.buffer)}
+	h.subs[sub] = struct{}{}
+	return sub, replay, resumed, nil
+}
+
+// since returns the history after id, or ok=false when it is incomplete.
+// Callers hold the lock.
+func (h *Hub) since(id string) ([]Event, bool) {
+	epoch, rawSeq, found := strings.Cut(id, "-")
+	seq, err := strconv.ParseUint(rawSeq, 10, 64)
+	if !found || err != nil || epoch != h.epoch || seq > h.seq {
+		return nil, false
+	}
+	oldest := h.seq - uint64(h.size) + 1
+	if seq+1 < oldest {
+		return nil, false
+	}
+	out := make([]Event, 0, h.seq-seq)
+	for i := 0; i < h.size; i++ {
+		e := h.history[(h.next-h.size+i+len(h.history))%len(h.history)]
+		if e.seq > seq {
+			out = append(out, e)
+		}
+	}
+	return out, true
+}
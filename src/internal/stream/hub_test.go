@@ -0,0 +1,124 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+)
+
+func publish(h *Hub, ids ...string) {
+	changes := make([]repository.ServiceRequestChange, len(ids))
+	for i, id := range ids {
+		changes[i] = repository.ServiceRequestChange{
+			Operation:        repository.ChangeCreate,
+			ServiceRequestID: id,
+			Request:          models.ServiceRequest{ServiceRequestID: id},
+		}
+	}
+	h.Observe(context.Background(), changes)
+}
+
+func requestIDs(events []Event) []string {
+	out := make([]string, len(events))
+	for i, e := range events {
+		out[i] = e.Request.ServiceRequestID
+	}
+	return out
+}
+
+func TestHubFanOut(t *testing.T) {
+	h := NewHub(10, 4, 0)
+	a, _, resumed, err := h.Subscribe("")
+	require.NoError(t, err)
+	assert.True(t, resumed)
+	b, _, _, err := h.Subscribe("")
+	require.NoError(t, err)
+
+	publish(h, "sr-1", "sr-2")
+	for _, sub := range []*Subscription{a, b} {
+		first, second := <-sub.Events(), <-sub.Events()
+		assert.Equal(t, []string{"sr-1", "sr-2"}, requestIDs([]Event{first, second}))
+		assert.NotEqual(t, first.ID, second.ID)
+	}
+
+	b.Close()
+	_, open := <-b.Events()
+	assert.False(t, open)
+	publish(h, "sr-3") // no send to the closed subscription
+	assert.Equal(t, "sr-3", (<-a.Events()).Request.ServiceRequestID)
+}
+
+func TestHubDropsLaggingSubscriber(t *testing.T) {
+	h := NewHub(10, 2, 0)
+	slow, _, _, err := h.Subscribe("")
+	require.NoError(t, err)
+
+	// Publishing never blocks: the third event overflows the buffer.
+	publish(h, "sr-1", "sr-2", "sr-3")
+	var got []Event
+	for e := range slow.Events() {
+		got = append(got, e)
+	}
+	assert.Equal(t, []string{"sr-1", "sr-2"}, requestIDs(got), "the channel closes after the buffered events")
+
+	// Reconnecting with the last ID seen replays the rest.
+	_, replay, resumed, err := h.Subscribe(got[len(got)-1].ID)
+	require.NoError(t, err)
+	assert.True(t, resumed)
+	assert.Equal(t, []string{"sr-3"}, requestIDs(replay))
+}
+
+func TestHubResume(t *testing.T) {
+	h := NewHub(3, 1, 0)
+	publish(h, "sr-1", "sr-2", "sr-3")
+	_, replay, resumed, err := h.Subscribe("")
+	require.NoError(t, err)
+	assert.True(t, resumed)
+	assert.Empty(t, replay, "no Last-Event-ID: only new events")
+
+	// The history holds sr-1..sr-3; after sr-1 both later events replay.
+	ids := map[string]string{}
+	for _, e := range h.history {
+		ids[e.Request.ServiceRequestID] = e.ID
+	}
+	_, replay, resumed, err = h.Subscribe(ids["sr-1"])
+	require.NoError(t, err)
+	assert.True(t, resumed)
+	assert.Equal(t, []string{"sr-2", "sr-3"}, requestIDs(replay))
+
+	_, replay, resumed, err = h.Subscribe(ids["sr-3"])
+	require.NoError(t, err)
+	assert.True(t, resumed)
+	assert.Empty(t, replay)
+
+	// Once sr-2 is evicted, resuming after sr-1 would miss it.
+	publish(h, "sr-4", "sr-5")
+	_, _, resumed, err = h.Subscribe(ids["sr-1"])
+	require.NoError(t, err)
+	assert.False(t, resumed, "events after sr-1 were evicted")
+
+	for _, id := range []string{"garbage", "0-1", "other-1"} {
+		_, replay, resumed, err = h.Subscribe(id)
+		require.NoError(t, err)
+		assert.False(t, resumed, id)
+		assert.Empty(t, replay)
+	}
+}
+
+func TestHubLimits(t *testing.T) {
+	h := NewHub(10, 1, 1)
+	sub, _, _, err := h.Subscribe("")
+	require.NoError(t, err)
+	_, _, _, err = h.Subscribe("")
+	assert.ErrorIs(t, err, ErrTooManySubscribers)
+
+	h.Close()
+	_, open := <-sub.Events()
+	assert.False(t, open, "closing the hub ends open streams")
+	_, _, _, err = h.Subscribe("")
+	assert.ErrorIs(t, err, ErrClosed)
+}
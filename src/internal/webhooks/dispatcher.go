@@ -0,0 +1,412 @@
+// Package webhooks delivers service request events to webhook subscriptions:
+// matching writes are queued as deliveries, POSTed with an HMAC signature and
+// retried with exponential backoff until they succeed or are dead-lettered.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/privacy"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+// Events delivered to subscriptions.
+const (
+	EventCreated       = "service_request.created"
+	EventStatusChanged = "service_request.status_changed"
+)
+
+// Headers of a delivery POST.
+const (
+	HeaderEvent     = "X-Open311-Event"
+	HeaderDelivery  = "X-Open311-Delivery"
+	HeaderTimestamp = "X-Open311-Timestamp"
+	HeaderSignature = "X-Open311-Signature"
+)
+
+// Tuning of the delivery worker.
+const (
+	pollInterval = 5 * time.Second
+	batchSize    = 20
+	// maxRetryDelay caps the exponential backoff.
+	maxRetryDelay = 24 * time.Hour
+	// subscriptionTTL bounds how long Observe uses its cached subscriptions;
+	// changes made on other replicas are seen after at most this long.
+	subscriptionTTL = 30 * time.Second
+)
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	Event          string    `json:"event"`
+	SubscriptionID string    `json:"subscription_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	// PreviousStatus is the status before a status change.
+	PreviousStatus string `json:"previous_status,omitempty"`
+	// ServiceRequest is the public view of the request: no reporter contact
+	// fields, and coordinates blurred as in unauthenticated responses.
+	ServiceRequest models.ServiceRequest `json:"service_request"`
+}
+
+// Sign returns the X-Open311-Signature value of a delivery:
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), where
+// timestamp is the X-Open311-Timestamp header (Unix seconds). Receivers
+// recompute it to authenticate the POST, and reject stale timestamps to
+// prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret returns a random signing secret, for subscriptions created
+// without one.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Dispatcher queues and delivers webhook events. Observe is registered as a
+// repository.ChangeObserver; Run delivers the queue in the background.
+// Delivery is at least once: a receiver may see a delivery again (same
+// X-Open311-Delivery) when a worker dies mid-POST.
+type Dispatcher struct {
+	repo     repository.SubscriptionRepository
+	policy   *privacy.Policy
+	log      logger.Logger
+	client   *http.Client
+	resolver *net.Resolver
+	// allowPrivate permits targets on private and reserved addresses
+	// (WEBHOOK_ALLOW_PRIVATE_TARGETS).
+	allowPrivate bool
+	maxAttempts  int
+	retryBase    time.Duration
+	// lease is how long a claimed delivery is hidden from other workers; it
+	// outlasts the POST timeout.
+	lease time.Duration
+	poll  time.Duration
+	now   func() time.Time
+	wake  chan struct{}
+
+	// The subscriptions Observe matches against, loaded at subsLoaded.
+	subsMu     sync.Mutex
+	subs       []models.Subscription
+	subsLoaded time.Time
+}
+
+// NewDispatcher creates a Dispatcher. policy shapes the request in payloads.
+func NewDispatcher(repo repository.SubscriptionRepository, policy *privacy.Policy, cfg config.WebhooksConfig, log logger.Logger) *Dispatcher {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	return &Dispatcher{
+		repo:         repo,
+		policy:       policy,
+		log:          log,
+		client:       newClient(timeout, cfg.AllowPrivateTargets),
+		resolver:     net.DefaultResolver,
+		allowPrivate: cfg.AllowPrivateTargets,
+		maxAttempts:  cfg.MaxAttempts,
+		retryBase:    time.Duration(cfg.RetryBaseSeconds) * time.Second,
+		lease:        timeout + time.Minute,
+		poll:         pollInterval,
+		now:          time.Now,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// notify wakes Run without blocking.
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// event returns the webhook event of a change, or "" when it is not one.
+func event(c repository.ServiceRequestChange) string {
+	switch {
+	case c.Operation == repository.ChangeCreate:
+		return EventCreated
+	case c.Operation == repository.ChangeUpdate && c.PreviousStatus != "" && c.PreviousStatus != c.Request.Status:
+		return EventStatusChanged
+	}
+	return ""
+}
+
+// matches reports whether req passes every filter of sub. The bbox is
+// matched against the public (possibly blurred) coordinates, so a narrow box
+// cannot locate a sensitive request more precisely than GET /requests would.
+func matches(sub models.Subscription, req models.ServiceRequest) bool {
+	if sub.ServiceRequestID != "" && sub.ServiceRequestID != req.ServiceRequestID {
+		return false
+	}
+	if sub.ServiceCode != "" && sub.ServiceCode != req.ServiceCode {
+		return false
+	}
+	if sub.OrganizationID != "" && sub.OrganizationID != req.OrganizationID {
+		return false
+	}
+	if sub.BBox != "" {
+		box, err := repository.ParseGeoBBox(sub.BBox)
+		if err != nil || (req.Latitude == 0 && req.Longitude == 0) || !box.Contains(req.Latitude, req.Longitude) {
+			return false
+		}
+	}
+	return true
+}
+
+// SubscriptionsChanged drops the cached subscriptions, so the next Observe
+// loads them again; call it after creating or deleting one.
+func (d *Dispatcher) SubscriptionsChanged() {
+	d.subsMu.Lock()
+	d.subs, d.subsLoaded = nil, time.Time{}
+	d.subsMu.Unlock()
+}
+
+// subscriptions returns the subscriptions, from the cache while it is fresh.
+// Writers thus only touch the subscription store once per subscriptionTTL.
+func (d *Dispatcher) subscriptions(ctx context.Context) ([]models.Subscription, error) {
+	d.subsMu.Lock()
+	defer d.subsMu.Unlock()
+	now := d.now()
+	if !d.subsLoaded.IsZero() && now.Sub(d.subsLoaded) < subscriptionTTL {
+		return d.subs, nil
+	}
+	subs, err := d.repo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.subs, d.subsLoaded = subs, now
+	return subs, nil
+}
+
+// Observe queues a delivery for every subscription matching a created request
+// or a status change. Subscriptions are cached (see subscriptions), so writes
+// matching none do not reach the store. Failures are logged: the write has
+// already happened.
+func (d *Dispatcher) Observe(ctx context.Context, changes []repository.ServiceRequestChange) {
+	var subs []models.Subscription
+	loaded := false
+	var deliveries []models.WebhookDelivery
+	for _, c := range changes {
+		ev := event(c)
+		if ev == "" {
+			continue
+		}
+		if !loaded {
+			var err error
+			if subs, err = d.subscriptions(ctx); err != nil {
+				d.log.Errorf("Webhooks: failed to load subscriptions: %v", err)
+				return
+			}
+			loaded = true
+		}
+		if len(subs) == 0 {
+			return
+		}
+		req := d.policy.Public(c.Request)
+		now := d.now().UTC()
+		for _, sub := range subs {
+			if !matches(sub, req) {
+				continue
+			}
+			body, err := json.Marshal(Payload{
+				Event:          ev,
+				SubscriptionID: sub.ID,
+				CreatedAt:      now,
+				PreviousStatus: c.PreviousStatus,
+				ServiceRequest: req,
+			})
+			if err != nil {
+				d.log.Errorf("Webhooks: failed to encode %s for %s: %v", ev, c.ServiceRequestID, err)
+				continue
+			}
+			deliveries = append(deliveries, models.WebhookDelivery{
+				SubscriptionID:   sub.ID,
+				Event:            ev,
+				ServiceRequestID: c.ServiceRequestID,
+				Status:           models.DeliveryPending,
+				CreatedAt:        now,
+				NextAttemptAt:    &now,
+				Payload:          body,
+			})
+		}
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+	if _, err := d.repo.CreateDeliveries(ctx, deliveries); err != nil {
+		d.log.Errorf("Webhooks: failed to queue %d deliveries: %v", len(deliveries), err)
+		return
+	}
+	d.notify()
+}
+
+// Redeliver puts a delivery (typically a dead one) back in the queue with a
+// fresh set of attempts.
+func (d *Dispatcher) Redeliver(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	delivery, err := d.repo.FindDeliveryByID(ctx, id)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	now := d.now().UTC()
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	delivery.DeliveredAt = nil
+	if err := d.repo.UpdateDelivery(ctx, delivery); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	d.notify()
+	return delivery, nil
+}
+
+// RunOnce claims the due deliveries, batch by batch, and attempts each. It
+// returns how many attempts were made.
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	attempted := 0
+	for ctx.Err() == nil {
+		claimed, err := d.repo.ClaimDueDeliveries(ctx, d.now(), d.lease, batchSize)
+		if err != nil {
+			return attempted, err
+		}
+		if len(claimed) == 0 {
+			break
+		}
+		subs := make(map[string]models.Subscription)
+		for _, delivery := range claimed {
+			if _, ok := subs[delivery.SubscriptionID]; ok {
+				continue
+			}
+			sub, err := d.repo.FindByID(ctx, delivery.SubscriptionID)
+			if errors.Is(err, repository.ErrNotFound) {
+				continue // deleted meanwhile, with its deliveries
+			}
+			if err != nil {
+				return attempted, err
+			}
+			subs[sub.ID] = sub
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range claimed {
+			sub, ok := subs[delivery.SubscriptionID]
+			if !ok {
+				continue
+			}
+			attempted++
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.attempt(ctx, sub, delivery)
+			}()
+		}
+		wg.Wait()
+	}
+	return attempted, ctx.Err()
+}
+
+// attempt POSTs one delivery and records the outcome.
+func (d *Dispatcher) attempt(ctx context.Context, sub models.Subscription, delivery models.WebhookDelivery) {
+	status, err := d.post(ctx, sub, delivery)
+	if ctx.Err() != nil {
+		return // shutting down; the lease expires and the delivery is retried
+	}
+	now := d.now().UTC()
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= d.maxAttempts:
+		delivery.Status = models.DeliveryDead
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = nil
+		d.log.Warnf("Webhooks: delivery %s to %s dead after %d attempts: %v", delivery.ID, sub.URL, delivery.Attempts, err)
+	default:
+		next := now.Add(d.retryDelay(delivery.Attempts))
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = &next
+	}
+	if err := d.repo.UpdateDelivery(context.WithoutCancel(ctx), delivery); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		d.log.Errorf("Webhooks: failed to record delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// retryDelay is the backoff after the given number of failed attempts:
+// retryBase, doubling each time, capped at maxRetryDelay.
+func (d *Dispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.retryBase
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// post sends a delivery, returning the response status (0 without a
+// response). Anything but a 2xx is a failure.
+func (d *Dispatcher) post(ctx context.Context, sub models.Subscription, delivery models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	ts := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "open311-to-Go-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, ts, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Run delivers the queue until ctx is cancelled: right after new events are
+// queued, and every few seconds for retries.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.poll)
+	defer ticker.Stop()
+	for {
+		if _, err := d.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			d.log.Errorf("Webhooks: delivery run failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
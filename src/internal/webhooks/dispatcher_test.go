@@ -0,0 +1,235 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/privacy"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+// receiver records the deliveries POSTed to it and answers with status.
+type receiver struct {
+	mu     sync.Mutex
+	status int
+	got    []*http.Request
+	bodies [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.got = append(rc.got, r)
+	rc.bodies = append(rc.bodies, body)
+	w.WriteHeader(rc.status)
+}
+
+func newTestDispatcher(t *testing.T) (*Dispatcher, repository.SubscriptionRepository, *time.Time) {
+	t.Helper()
+	log, err := logger.New(logger.Config{Level: "fatal", Format: "text"})
+	require.NoError(t, err)
+	repo := repository.NewMemorySubscriptionRepository()
+	d := NewDispatcher(repo, privacy.NewPolicy([]string{"abuse"}, "round", 2, 0, nil),
+		config.WebhooksConfig{MaxAttempts: 3, RetryBaseSeconds: 30, TimeoutSeconds: 5, AllowPrivateTargets: true}, log)
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	return d, repo, &now
+}
+
+func request(id, code, status string) models.ServiceRequest {
+	return models.ServiceRequest{
+		ServiceRequestID: id,
+		ServiceCode:      code,
+		Status:           status,
+		Latitude:         60.1699,
+		Longitude:        24.9384,
+		Email:            "reporter@example.com",
+	}
+}
+
+func TestSign(t *testing.T) {
+	// printf '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163",
+		Sign("secret", 1700000000, []byte("{}")))
+	assert.NotEqual(t, Sign("secret", 1700000000, []byte("{}")), Sign("other", 1700000000, []byte("{}")))
+	assert.NotEqual(t, Sign("secret", 1700000000, []byte("{}")), Sign("secret", 1700000001, []byte("{}")))
+}
+
+func TestMatches(t *testing.T) {
+	req := request("sr-1", "pothole", "open")
+	req.OrganizationID = "org-1"
+	assert.True(t, matches(models.Subscription{}, req))
+	assert.True(t, matches(models.Subscription{ServiceCode: "pothole", OrganizationID: "org-1", BBox: "24,60,25,61"}, req))
+	assert.False(t, matches(models.Subscription{ServiceRequestID: "sr-2"}, req))
+	assert.False(t, matches(models.Subscription{ServiceCode: "graffiti"}, req))
+	assert.False(t, matches(models.Subscription{OrganizationID: "org-2"}, req))
+	assert.False(t, matches(models.Subscription{BBox: "25,60,26,61"}, req))
+	req.Latitude, req.Longitude = 0, 0
+	assert.False(t, matches(models.Subscription{BBox: "-1,-1,1,1"}, req), "requests without a location never match a bbox")
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	ctx := context.Background()
+	d, repo, _ := newTestDispatcher(t)
+	rc := &receiver{status: http.StatusNoContent}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	sub, err := repo.Create(ctx, models.Subscription{URL: srv.URL, Secret: "s3cret", ServiceCode: "pothole"})
+	require.NoError(t, err)
+
+	d.Observe(ctx, []repository.ServiceRequestChange{
+		{Operation: repository.ChangeCreate, ServiceRequestID: "sr-1", Request: request("sr-1", "pothole", "open")},
+		{Operation: repository.ChangeCreate, ServiceRequestID: "sr-2", Request: request("sr-2", "graffiti", "open")},
+		// Not a status change: no event.
+		{Operation: repository.ChangeUpdate, ServiceRequestID: "sr-1", Request: request("sr-1", "pothole", "open"), PreviousStatus: "open"},
+		{Operation: repository.ChangeUpdate, ServiceRequestID: "sr-1", Request: request("sr-1", "pothole", "closed"), PreviousStatus: "open"},
+	})
+
+	n, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.Len(t, rc.got, 2)
+
+	events := map[string]Payload{}
+	for i, r := range rc.got {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+		assert.Equal(t, Sign("s3cret", ts, rc.bodies[i]), r.Header.Get(HeaderSignature))
+		assert.NotEmpty(t, r.Header.Get(HeaderDelivery))
+
+		var p Payload
+		require.NoError(t, json.Unmarshal(rc.bodies[i], &p))
+		assert.Equal(t, r.Header.Get(HeaderEvent), p.Event)
+		assert.Equal(t, sub.ID, p.SubscriptionID)
+		assert.Empty(t, p.ServiceRequest.Email, "contact fields are never sent")
+		events[p.Event] = p
+	}
+	require.Contains(t, events, EventStatusChanged)
+	assert.Equal(t, "open", events[EventStatusChanged].PreviousStatus)
+	assert.Equal(t, "closed", events[EventStatusChanged].ServiceRequest.Status)
+	assert.Contains(t, events, EventCreated)
+
+	history, err := repo.FindDeliveries(ctx, sub.ID, models.DeliveryDelivered, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, 1, history[0].Attempts)
+	assert.Equal(t, http.StatusNoContent, history[0].ResponseStatus)
+	assert.NotNil(t, history[0].DeliveredAt)
+
+	n, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n, "delivered events are not sent again")
+}
+
+func TestDispatcherRetriesAndDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	d, repo, now := newTestDispatcher(t)
+	rc := &receiver{status: http.StatusInternalServerError}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	sub, err := repo.Create(ctx, models.Subscription{URL: srv.URL, Secret: "s3cret"})
+	require.NoError(t, err)
+	d.Observe(ctx, []repository.ServiceRequestChange{
+		{Operation: repository.ChangeCreate, ServiceRequestID: "sr-1", Request: request("sr-1", "pothole", "open")},
+	})
+
+	// Attempts at 0s, +30s, +60s (doubling backoff); the third failure is final.
+	for i, wait := range []time.Duration{0, 30 * time.Second, time.Minute} {
+		*now = now.Add(wait - time.Second)
+		n, err := d.RunOnce(ctx)
+		require.NoError(t, err)
+		if i > 0 {
+			assert.Zero(t, n, "not due before the backoff ends")
+		}
+		*now = now.Add(time.Second)
+		n, err = d.RunOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n, "attempt %d", i+1)
+	}
+	assert.Len(t, rc.got, 3)
+
+	dead, err := repo.FindDeliveries(ctx, sub.ID, models.DeliveryDead, 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, dead[0].ResponseStatus)
+	assert.Equal(t, "HTTP 500", dead[0].LastError)
+
+	// A redelivered dead letter is attempted again.
+	rc.mu.Lock()
+	rc.status = http.StatusOK
+	rc.mu.Unlock()
+	_, err = d.Redeliver(ctx, dead[0].ID)
+	require.NoError(t, err)
+	n, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	delivered, err := repo.FindDeliveryByID(ctx, dead[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.DeliveryDelivered, delivered.Status)
+	assert.Empty(t, delivered.LastError)
+}
+
+func TestRetryDelay(t *testing.T) {
+	d, _, _ := newTestDispatcher(t)
+	assert.Equal(t, 30*time.Second, d.retryDelay(1))
+	assert.Equal(t, time.Minute, d.retryDelay(2))
+	assert.Equal(t, 4*time.Minute, d.retryDelay(4))
+	assert.Equal(t, maxRetryDelay, d.retryDelay(40))
+}
+
+// countingSubscriptions counts FindAll calls.
+type countingSubscriptions struct {
+	repository.SubscriptionRepository
+	findAll int
+}
+
+func (c *countingSubscriptions) FindAll(ctx context.Context) ([]models.Subscription, error) {
+	c.findAll++
+	return c.SubscriptionRepository.FindAll(ctx)
+}
+
+func TestObserveCachesSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	d, repo, now := newTestDispatcher(t)
+	counting := &countingSubscriptions{SubscriptionRepository: repo}
+	d.repo = counting
+	created := []repository.ServiceRequestChange{
+		{Operation: repository.ChangeCreate, ServiceRequestID: "sr-1", Request: request("sr-1", "pothole", "open")},
+	}
+
+	d.Observe(ctx, created)
+	d.Observe(ctx, created)
+	assert.Equal(t, 1, counting.findAll, "loaded once")
+
+	sub, err := repo.Create(ctx, models.Subscription{URL: "https://example.com/hook", Secret: "s3cret"})
+	require.NoError(t, err)
+	d.SubscriptionsChanged()
+	d.Observe(ctx, created)
+	assert.Equal(t, 2, counting.findAll)
+	pending, err := repo.FindDeliveries(ctx, sub.ID, models.DeliveryPending, 10)
+	require.NoError(t, err)
+	assert.Len(t, pending, 1, "a new subscription is matched right after SubscriptionsChanged")
+
+	d.Observe(ctx, created)
+	assert.Equal(t, 2, counting.findAll)
+	*now = now.Add(subscriptionTTL)
+	d.Observe(ctx, created)
+	assert.Equal(t, 3, counting.findAll, "reloaded after the TTL")
+}
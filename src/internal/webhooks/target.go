@@ -0,0 +1,109 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget is a subscription URL that resolves to a private or
+// reserved address; delivering there would let API clients probe the
+// server's network (loopback, RFC 1918, link-local cloud metadata, ...).
+var ErrForbiddenTarget = errors.New("url must not point to a private or reserved address")
+
+// reservedPrefixes are the special-purpose ranges not covered by the netip
+// predicates in forbiddenAddr.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, may map to private IPv4
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// forbiddenAddr reports whether deliveries to addr are refused.
+func forbiddenAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return true
+	}
+	for _, p := range reservedPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTarget validates the URL of a new subscription: an absolute http(s)
+// URL whose host does not resolve to a private or reserved address (unless
+// WEBHOOK_ALLOW_PRIVATE_TARGETS is set). The address is checked again when
+// connecting, since DNS may change in between.
+func (d *Dispatcher) CheckTarget(ctx context.Context, rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if d.allowPrivate {
+		return nil
+	}
+	host := target.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if forbiddenAddr(addr) {
+			return ErrForbiddenTarget
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := d.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("url host %q does not resolve", host)
+	}
+	for _, addr := range addrs {
+		if forbiddenAddr(addr) {
+			return ErrForbiddenTarget
+		}
+	}
+	return nil
+}
+
+// newClient returns the HTTP client of deliveries. Unless allowPrivate, its
+// dialer refuses private and reserved addresses after DNS resolution (and no
+// proxy is used, which would dial in its place). It never follows redirects:
+// a 3xx is a failed delivery.
+func newClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil || forbiddenAddr(ap.Addr()) {
+				return ErrForbiddenTarget
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,97 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+)
+
+func TestCheckTarget(t *testing.T) {
+	ctx := context.Background()
+	d, _, _ := newTestDispatcher(t)
+	d.allowPrivate = false
+
+	for _, u := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://[::1]/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[fe80::1]/hook",
+		"https://10.0.0.5/hook",
+		"https://172.16.3.4/hook",
+		"https://192.168.1.1/hook",
+		"https://100.64.0.1/hook",
+		"http://0.0.0.0/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://[fd00::1]/hook",
+	} {
+		assert.ErrorIs(t, d.CheckTarget(ctx, u), ErrForbiddenTarget, u)
+	}
+	for _, u := range []string{"ftp://example.com", "/relative", "http://"} {
+		assert.EqualError(t, d.CheckTarget(ctx, u), "url must be an absolute http or https URL", u)
+	}
+	assert.NoError(t, d.CheckTarget(ctx, "https://93.184.215.14/hook"))
+	assert.NoError(t, d.CheckTarget(ctx, "https://[2606:4700::1111]/hook"))
+
+	d.allowPrivate = true
+	assert.NoError(t, d.CheckTarget(ctx, "http://127.0.0.1:8080/hook"))
+}
+
+func TestDispatcherRefusesPrivateAddressesWhenDialing(t *testing.T) {
+	ctx := context.Background()
+	d, repo, _ := newTestDispatcher(t)
+	d.allowPrivate = false
+	d.client = newClient(5*time.Second, false)
+	rc := &receiver{status: http.StatusOK}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	// Stored without CheckTarget, e.g. before a DNS change.
+	sub, err := repo.Create(ctx, models.Subscription{URL: srv.URL, Secret: "s3cret"})
+	require.NoError(t, err)
+	d.Observe(ctx, []repository.ServiceRequestChange{
+		{Operation: repository.ChangeCreate, ServiceRequestID: "sr-1", Request: request("sr-1", "pothole", "open")},
+	})
+	n, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Empty(t, rc.got)
+
+	pending, err := repo.FindDeliveries(ctx, sub.ID, models.DeliveryPending, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Contains(t, pending[0].LastError, ErrForbiddenTarget.Error())
+	assert.Zero(t, pending[0].ResponseStatus)
+}
+
+func TestDispatcherDoesNotFollowRedirects(t *testing.T) {
+	ctx := context.Background()
+	d, repo, _ := newTestDispatcher(t)
+	rc := &receiver{status: http.StatusOK}
+	target := httptest.NewServer(rc)
+	defer target.Close()
+	redirector := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer redirector.Close()
+
+	sub, err := repo.Create(ctx, models.Subscription{URL: redirector.URL, Secret: "s3cret"})
+	require.NoError(t, err)
+	d.Observe(ctx, []repository.ServiceRequestChange{
+		{Operation: repository.ChangeCreate, ServiceRequestID: "sr-1", Request: request("sr-1", "pothole", "open")},
+	})
+	_, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, rc.got, "the redirect is not followed")
+
+	pending, err := repo.FindDeliveries(ctx, sub.ID, models.DeliveryPending, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, http.StatusTemporaryRedirect, pending[0].ResponseStatus)
+	assert.Equal(t, "HTTP 307", pending[0].LastError)
+}
@@ -14,7 +14,8 @@ import (
 	sentryhttp "github.com/getsentry/sentry-go/http"
 	"github.com/timoruohomaki/open311-to-Go/config"
 	"github.com/timoruohomaki/open311-to-Go/internal/api"
-	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/internal/changefeed"
+	"github.com/timoruohomaki/open311-to-Go/internal/retention"
 	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
 )
 
@@ -36,6 +37,24 @@ func main() {
 		os.Exit(1)
 	}
 
+	// `open311api migrate ...` manages the storage schema and exits.
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(cfg, flag.Args()[1:], os.Stdout); err != nil {
+			fmt.Printf("migrate: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// `open311api import ...` loads a bulk source file into storage and exits.
+	if flag.Arg(0) == "import" {
+		if err := runImport(cfg, flag.Args()[1:], os.Stdout); err != nil {
+			fmt.Printf("import: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize loggers
 	log, err := logger.New(cfg.Logger)
 	if err != nil {
@@ -54,26 +73,14 @@ func main() {
 
 	defer apachelog.Close()
 
-	// Initialize MongoDB connection
-	db, err := repository.NewMongoDBConnection(cfg.MongoDB)
-
+	// Open the storage backend (STORAGE_BACKEND)
+	store, err := openStorage(cfg, log)
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		log.Fatalf("Failed to open %s storage: %v", cfg.Storage.Backend, err)
 		os.Exit(1)
 	}
 
-	log.Infof("Connected MongoDB database %s", cfg.MongoDB.Database)
-
-	defer db.Disconnect()
-
-	// Ensure indexes (idempotent). Non-fatal: log and continue if it fails.
-	idxCtx, idxCancel := context.WithTimeout(context.Background(), 30*time.Second)
-	if err := repository.EnsureIndexes(idxCtx, db, cfg.MongoDB.Collection); err != nil {
-		log.Warnf("Failed to ensure MongoDB indexes: %v", err)
-	} else {
-		log.Info("MongoDB indexes ensured")
-	}
-	idxCancel()
+	defer store.Close()
 
 	// Initialize Sentry
 	err = sentry.Init(sentry.ClientOptions{
@@ -92,7 +99,51 @@ func main() {
 	sentryHandler := sentryhttp.New(sentryhttp.Options{})
 
 	// Initialize API
-	api := api.New(cfg, log, apachelog, db)
+	api := api.New(cfg, log, apachelog, store)
+
+	// Background jobs stop when the server shuts down.
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// Purge soft-deleted tombstones after the retention period.
+	if cfg.Retention.SoftDeleteDays > 0 {
+		purger := retention.NewPurger(
+			store.ServiceRequests,
+			time.Duration(cfg.Retention.SoftDeleteDays)*24*time.Hour,
+			time.Duration(cfg.Retention.PurgeIntervalMinutes)*time.Minute,
+			log,
+		)
+		go purger.Run(jobsCtx)
+		log.Infof("Purging soft-deleted service requests after %d days", cfg.Retention.SoftDeleteDays)
+	}
+
+	// Deliver queued webhook events to subscribers.
+	go api.Webhooks().Run(jobsCtx)
+
+	// Process uploaded import jobs.
+	go api.Jobs().Run(jobsCtx)
+
+	// Harvest the configured remote Open311 endpoints.
+	if h := api.Harvester(); h != nil {
+		go h.Run(jobsCtx)
+		log.Infof("Harvesting %d remote Open311 sources", len(h.Sources()))
+	}
+
+	// Publish request changes to the configured sink.
+	if cfg.ChangeFeed.Sink != "" {
+		if store.ChangeFeed == nil {
+			log.Warnf("CHANGEFEED_SINK is set but the %s backend has no change stream; change feed disabled", store.Backend)
+		} else {
+			sink, err := changefeed.NewSink(cfg.ChangeFeed)
+			if err != nil {
+				log.Fatalf("Failed to create change feed sink: %v", err)
+			}
+			defer sink.Close()
+			consumer := changefeed.NewConsumer(cfg.ChangeFeed.Consumer, store.ChangeFeed, store.ChangeCheckpoints, sink, log)
+			go consumer.Run(jobsCtx)
+			log.Infof("Publishing service request changes to the %s sink", cfg.ChangeFeed.Sink)
+		}
+	}
 
 	// Create server
 	srv := &http.Server{
@@ -102,6 +153,8 @@ func main() {
 		WriteTimeout: time.Duration(cfg.Server.WriteTimeoutSeconds) * time.Second,
 		IdleTimeout:  time.Duration(cfg.Server.IdleTimeoutSeconds) * time.Second,
 	}
+	// Live streams never go idle; end them so Shutdown does not wait on them.
+	srv.RegisterOnShutdown(api.Stream().Close)
 
 	// Start server in a goroutine
 	go func() {
@@ -117,6 +170,7 @@ func main() {
 	<-quit
 
 	log.Info("Shutting down server...")
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeoutSeconds)*time.Second)
 	defer cancel()
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+)
+
+const migrateUsage = `usage: open311api [-env FILE] migrate up|down|status [-dry-run] [-steps N]
+
+  up      apply pending migrations (all, or the next N)
+  down    revert the latest applied migration (or the latest N)
+  status  list migrations and when each was applied
+
+The backend is the one STORAGE_BACKEND selects.`
+
+// runMigrate implements the migrate subcommand: it manages the schema of the
+// configured backend without starting the server (which applies pending
+// migrations itself on startup).
+func runMigrate(cfg *config.Config, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.Usage = func() { fmt.Fprintln(out, migrateUsage) }
+	dryRun := fs.Bool("dry-run", false, "print what would run without changing anything")
+	steps := fs.Int("steps", 0, "number of migrations to apply or revert")
+	// Flags may come before or after the command.
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing command")
+	}
+	command := fs.Arg(0)
+	if err := fs.Parse(fs.Args()[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if *steps < 0 {
+		return fmt.Errorf("-steps must not be negative")
+	}
+
+	migrator, closeFn, err := openMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	opts := repository.MigrateOptions{
+		Steps:  *steps,
+		DryRun: *dryRun,
+		Logf:   func(format string, args ...interface{}) { fmt.Fprintf(out, format+"\n", args...) },
+	}
+	var done []repository.MigrationStatus
+	switch command {
+	case "status":
+		return printMigrationStatus(ctx, migrator, out)
+	case "up":
+		done, err = migrator.MigrateUp(ctx, opts)
+	case "down":
+		done, err = migrator.MigrateDown(ctx, opts)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+	if err != nil {
+		return err
+	}
+
+	verb := map[string]string{"up": "applied", "down": "reverted"}[command]
+	if *dryRun {
+		verb = "would be " + verb
+	}
+	fmt.Fprintf(out, "%d migration(s) %s\n", len(done), verb)
+	return nil
+}
+
+// openMigrator connects to the configured backend.
+func openMigrator(cfg *config.Config) (repository.Migrator, func(), error) {
+	switch cfg.Storage.Backend {
+	case repository.BackendMemory:
+		return nil, nil, fmt.Errorf("the memory backend has no schema to migrate")
+	case repository.BackendPostgres:
+		db, err := repository.NewPostgresConnection(cfg.Postgres)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, func() { _ = db.Close() }, nil
+	case repository.BackendSQLite:
+		db, err := repository.NewSQLiteConnection(cfg.SQLite)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, func() { _ = db.Close() }, nil
+	default:
+		db, err := repository.NewMongoDBConnection(cfg.MongoDB)
+		if err != nil {
+			return nil, nil, err
+		}
+		return repository.NewMongoMigrator(db, cfg.MongoDB.Collection), func() { _ = db.Disconnect() }, nil
+	}
+}
+
+func printMigrationStatus(ctx context.Context, migrator repository.Migrator, out io.Writer) error {
+	all, err := migrator.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, m := range all {
+		applied := "pending"
+		if m.AppliedAt != nil {
+			applied = m.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", m.Version, m.Name, applied)
+	}
+	return w.Flush()
+}
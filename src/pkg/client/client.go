@@ -0,0 +1,273 @@
+// Package client is a Go client of the open311-to-Go API for feeders, jobs
+// and integration tests: typed methods for services and service requests
+// (listing with every filter, automatic pagination, get, create, upsert,
+// bulk upsert, delete) on the models types. It sends the API key, retries
+// rate-limited calls after their Retry-After, and speaks JSON or, with
+// WithXML, XML.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
+)
+
+// DefaultBasePath is the API prefix used when the base URL has no path.
+const DefaultBasePath = "/open311/v2"
+
+// Retry defaults (see WithRetries).
+const (
+	defaultMaxRetries = 3
+	defaultMaxWait    = time.Minute
+)
+
+// Errors an *Error matches with errors.Is, by status code.
+var (
+	// ErrNotFound is a 404.
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized is a 401 (no or an unknown API key) or 403 (a key
+	// without the needed scope).
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrPreconditionFailed is a 412.
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrRateLimited is a 429 that was not retried, or still limited after
+	// the retries.
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// Error is a non-2xx response.
+type Error struct {
+	StatusCode int
+	// Errors is the Open311 errors document of the response, when it had one.
+	Errors []httputil.APIError
+	// RetryAfter is the response's Retry-After, or 0.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, d := range e.Errors {
+		msgs = append(msgs, d.Description)
+	}
+	if len(msgs) == 0 {
+		return fmt.Sprintf("open311: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("open311: %d: %s", e.StatusCode, strings.Join(msgs, "; "))
+}
+
+// Is matches the sentinel errors of the status code.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrPreconditionFailed:
+		return e.StatusCode == http.StatusPreconditionFailed
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// Client calls one open311-to-Go deployment. It is safe for concurrent use.
+type Client struct {
+	base       *url.URL
+	http       *http.Client
+	apiKey     string
+	xml        bool
+	userAgent  string
+	maxRetries int
+	maxWait    time.Duration
+	now        func() time.Time
+	wait       func(ctx context.Context, d time.Duration) error
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithAPIKey sends key as X-API-Key on every call.
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithHTTPClient sets the HTTP client (timeouts, transport).
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) { c.http = h }
+}
+
+// WithXML makes the client send and accept XML instead of JSON.
+func WithXML() Option {
+	return func(c *Client) { c.xml = true }
+}
+
+// WithUserAgent sets the User-Agent header.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// WithRetries sets how often a 429 (or a 503 with Retry-After) is retried,
+// and the longest Retry-After waited for; a longer one is returned as the
+// error. Without a Retry-After the delay doubles from one second. The
+// default is 3 retries waiting up to a minute; 0 retries disables retrying.
+func WithRetries(n int, maxWait time.Duration) Option {
+	return func(c *Client) { c.maxRetries, c.maxWait = n, maxWait }
+}
+
+// New creates a Client of the API at baseURL, e.g.
+// "https://api.example.org/open311/v2"; a URL without a path gets
+// DefaultBasePath.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("client: base URL must be an http(s) URL, got %q", baseURL)
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		u.Path, u.RawPath = DefaultBasePath, ""
+	}
+	u.Path, u.RawPath = strings.TrimSuffix(u.Path, "/"), strings.TrimSuffix(u.RawPath, "/")
+	u.RawQuery, u.Fragment = "", ""
+	c := &Client{
+		base:       u,
+		http:       http.DefaultClient,
+		userAgent:  "open311-to-Go client",
+		maxRetries: defaultMaxRetries,
+		maxWait:    defaultMaxWait,
+		now:        time.Now,
+		wait:       httputil.Sleep,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// endpoint returns the URL of the path segments (escaped) under the base
+// URL, with query.
+func (c *Client) endpoint(query url.Values, segments ...string) *url.URL {
+	u := *c.base
+	escaped := c.base.EscapedPath()
+	for _, s := range segments {
+		u.Path += "/" + s
+		escaped += "/" + url.PathEscape(s)
+	}
+	u.RawPath = escaped
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+// encode marshals v as the body of a call; root names the XML element.
+func (c *Client) encode(v any, root string) ([]byte, error) {
+	if !c.xml {
+		return json.Marshal(v)
+	}
+	var buf bytes.Buffer
+	if err := xml.NewEncoder(&buf).EncodeElement(v, xml.StartElement{Name: xml.Name{Local: root}}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// do sends a call and returns its 2xx response, whose body the caller
+// closes. Rate-limited calls are retried; other non-2xx responses are an
+// *Error.
+func (c *Client) do(ctx context.Context, method string, u *url.URL, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		var rd io.Reader
+		if body != nil {
+			rd = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), rd)
+		if err != nil {
+			return nil, err
+		}
+		mediaType := "application/json"
+		if c.xml {
+			mediaType = "application/xml"
+		}
+		req.Header.Set("Accept", mediaType)
+		if body != nil {
+			req.Header.Set("Content-Type", mediaType)
+		}
+		if c.apiKey != "" {
+			req.Header.Set("X-API-Key", c.apiKey)
+		}
+		req.Header.Set("User-Agent", c.userAgent)
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+		apiErr := c.responseError(resp)
+		retryAfter, ok := httputil.ParseRetryAfter(resp.Header.Get("Retry-After"), c.now())
+		limited := resp.StatusCode == http.StatusTooManyRequests || (resp.StatusCode == http.StatusServiceUnavailable && ok)
+		if !limited || attempt >= c.maxRetries {
+			return nil, apiErr
+		}
+		if !ok {
+			retryAfter = time.Second << attempt
+		}
+		if retryAfter > c.maxWait {
+			return nil, apiErr
+		}
+		if err := c.wait(ctx, retryAfter); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// responseError reads a non-2xx response into an *Error and closes it.
+func (c *Client) responseError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+	e := &Error{StatusCode: resp.StatusCode}
+	e.RetryAfter, _ = httputil.ParseRetryAfter(resp.Header.Get("Retry-After"), c.now())
+	var doc httputil.APIErrors
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if isXML(resp) {
+		if xml.Unmarshal(data, &doc) == nil {
+			e.Errors = doc.Errors
+		}
+	} else if json.Unmarshal(data, &doc) == nil {
+		e.Errors = doc.Errors
+	}
+	return e
+}
+
+// isXML reports whether a response body is XML; the API answers JSON unless
+// XML was asked for.
+func isXML(resp *http.Response) bool {
+	ct := resp.Header.Get("Content-Type")
+	return strings.Contains(ct, "/xml") || strings.Contains(ct, "+xml")
+}
+
+// decode reads a response body into out (the XML form into xmlOut when the
+// response is XML, e.g. a collection wrapper) and closes it.
+func decode(resp *http.Response, out, xmlOut any) error {
+	defer resp.Body.Close()
+	var err error
+	if isXML(resp) {
+		if xmlOut == nil {
+			xmlOut = out
+		}
+		err = xml.NewDecoder(resp.Body).Decode(xmlOut)
+	} else {
+		err = json.NewDecoder(resp.Body).Decode(out)
+	}
+	if err != nil {
+		return fmt.Errorf("open311: invalid response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+	"github.com/timoruohomaki/open311-to-Go/internal/api"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+const testKey = "client-test-key"
+
+// newTestServer serves the full API on the in-memory backend, with one
+// service and testKey as its API key.
+func newTestServer(t *testing.T) (*httptest.Server, models.Service) {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Storage.Backend = repository.BackendMemory
+	cfg.Privacy.CoordinateMode = "off"
+	cfg.Auth.APIKeys = []string{testKey}
+	log, err := logger.New(logger.Config{Level: "error", Format: "text"})
+	require.NoError(t, err)
+	store := repository.NewMemoryStorage()
+	svc, err := store.Services.Create(context.Background(), models.Service{ServiceCode: "pothole", ServiceName: "Pothole"})
+	require.NoError(t, err)
+	srv := httptest.NewServer(api.New(cfg, log, log, store).Handler())
+	t.Cleanup(srv.Close)
+	return srv, svc
+}
+
+func newTestClient(t *testing.T, baseURL string, opts ...Option) *Client {
+	t.Helper()
+	c, err := New(baseURL, opts...)
+	require.NoError(t, err)
+	return c
+}
+
+func testRequest(id string, updated time.Time) models.ServiceRequest {
+	return models.ServiceRequest{
+		ServiceRequestID: id,
+		ServiceCode:      "pothole",
+		Status:           "open",
+		Description:      "Hole in the road",
+		Latitude:         60.1699,
+		Longitude:        24.9384,
+		UpdatedDatetime:  updated,
+		Properties:       models.Properties{"ward": "7"},
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	srv, svc := newTestServer(t)
+	c := newTestClient(t, srv.URL, WithAPIKey(testKey))
+
+	services, err := c.Services(ctx)
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, "pothole", services[0].ServiceCode)
+	got, err := c.Service(ctx, svc.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Pothole", got.ServiceName)
+
+	created, err := c.CreateRequest(ctx, testRequest("", time.Time{}))
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.ServiceRequestID)
+	fetched, err := c.GetRequest(ctx, created.ServiceRequestID)
+	require.NoError(t, err)
+	assert.Equal(t, "Hole in the road", fetched.Description)
+
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	stored, isNew, err := c.UpsertRequest(ctx, testRequest("feed:1 a", t0))
+	require.NoError(t, err)
+	assert.True(t, isNew)
+	assert.Equal(t, "feed:1 a", stored.ServiceRequestID, "ids are escaped in the path")
+	req := testRequest("feed:1 a", t0.Add(time.Hour))
+	req.Status = "closed"
+	stored, isNew, err = c.UpsertRequest(ctx, req)
+	require.NoError(t, err)
+	assert.False(t, isNew)
+	assert.Equal(t, "closed", stored.Status)
+
+	require.NoError(t, c.DeleteRequest(ctx, created.ServiceRequestID))
+	_, err = c.GetRequest(ctx, created.ServiceRequestID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	require.Len(t, apiErr.Errors, 1)
+	assert.Equal(t, "Service request not found", apiErr.Errors[0].Description)
+
+	anonymous := newTestClient(t, srv.URL)
+	_, _, err = anonymous.UpsertRequest(ctx, testRequest("feed:2", t0))
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestClientBulkAndPaging(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := newTestServer(t)
+	c := newTestClient(t, srv.URL+"/open311/v2/", WithAPIKey(testKey))
+
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var reqs []models.ServiceRequest
+	for i := range MaxBulkRequests + 5 {
+		reqs = append(reqs, testRequest("bulk:"+strconv.Itoa(i), t0.Add(time.Duration(i)*time.Minute)))
+	}
+	reqs[MaxBulkRequests+1].ServiceCode = ""
+	res, err := c.BulkUpsert(ctx, reqs, BulkOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, MaxBulkRequests+5, res.Requested)
+	assert.Equal(t, MaxBulkRequests+4, res.Created)
+	assert.Equal(t, 1, res.Failed)
+	require.Len(t, res.Errors, 1)
+	assert.Equal(t, MaxBulkRequests+1, res.Errors[0].Index, "indexes are of the whole slice")
+
+	res, err = c.BulkUpsert(ctx, reqs[:3], BulkOptions{OnlyIfNewer: true})
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.Skipped)
+
+	page, err := c.ListRequests(ctx, RequestQuery{
+		ServiceCodes: []string{"pothole"},
+		UpdatedAfter: t0.Add(99 * time.Minute),
+		Sort:         SortUpdatedDatetime,
+		Ascending:    true,
+		PerPage:      3,
+		Count:        true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(MaxBulkRequests+4-99), page.Total)
+	require.Len(t, page.Requests, 3)
+	assert.Equal(t, "bulk:99", page.Requests[0].ServiceRequestID)
+	assert.NotEmpty(t, page.NextCursor)
+	page, err = c.NextPage(ctx, page)
+	require.NoError(t, err)
+	assert.Equal(t, "bulk:102", page.Requests[0].ServiceRequestID)
+
+	var ids []string
+	for req, err := range c.Requests(ctx, RequestQuery{UpdatedBefore: t0.Add(7 * time.Minute), Ascending: true, Sort: SortUpdatedDatetime, PerPage: 2}) {
+		require.NoError(t, err)
+		ids = append(ids, req.ServiceRequestID)
+	}
+	assert.Equal(t, []string{"bulk:0", "bulk:1", "bulk:2", "bulk:3", "bulk:4", "bulk:5", "bulk:6", "bulk:7"}, ids, "bounds are inclusive")
+
+	n := 0
+	for _, err := range c.Requests(ctx, RequestQuery{
+		Near:       &GeoRadius{Lat: 60.17, Long: 24.938, RadiusMeters: 200},
+		Within:     &GeoBBox{MinLong: 24.9, MinLat: 60.1, MaxLong: 25, MaxLat: 60.2},
+		Properties: []PropertyFilter{{Key: "ward", Values: []string{"7", "a,b"}}},
+	}) {
+		require.NoError(t, err)
+		if n++; n == 150 {
+			break
+		}
+	}
+	assert.Equal(t, 150, n, "the iterator follows the pages and stops when asked")
+
+	for _, err := range c.Requests(ctx, RequestQuery{Sort: "nonsense"}) {
+		assert.ErrorContains(t, err, "400: sort must be")
+	}
+}
+
+func TestClientXML(t *testing.T) {
+	ctx := context.Background()
+	srv, _ := newTestServer(t)
+	c := newTestClient(t, srv.URL, WithAPIKey(testKey), WithXML())
+
+	services, err := c.Services(ctx)
+	require.NoError(t, err)
+	assert.Len(t, services, 1)
+
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	stored, isNew, err := c.UpsertRequest(ctx, testRequest("xml:1", t0))
+	require.NoError(t, err)
+	assert.True(t, isNew)
+	assert.Equal(t, models.Properties{"ward": "7"}, stored.Properties)
+
+	res, err := c.BulkUpsert(ctx, []models.ServiceRequest{testRequest("xml:2", t0), {ServiceRequestID: "xml:3"}}, BulkOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Created)
+	require.Len(t, res.Errors, 1)
+	assert.Equal(t, "service_code is required", res.Errors[0].Message)
+
+	page, err := c.ListRequests(ctx, RequestQuery{ServiceRequestIDs: []string{"xml:1", "xml:2"}})
+	require.NoError(t, err)
+	assert.Len(t, page.Requests, 2)
+
+	_, err = c.GetRequest(ctx, "xml:404")
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Len(t, apiErr.Errors, 1)
+	assert.Equal(t, "Service request not found", apiErr.Errors[0].Description)
+}
+
+func TestClientRetries(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	var responses []func(w http.ResponseWriter)
+	var headers []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		headers = append(headers, r.Header.Clone())
+		if len(responses) > 0 {
+			respond := responses[0]
+			responses = responses[1:]
+			respond(w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(srv.Close)
+	limited := func(retryAfter string) func(w http.ResponseWriter) {
+		return func(w http.ResponseWriter) {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"errors":[{"code":429,"description":"Rate limit exceeded"}]}`))
+		}
+	}
+
+	c := newTestClient(t, srv.URL, WithAPIKey(testKey), WithRetries(2, time.Minute))
+	var waits []time.Duration
+	c.wait = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	responses = []func(w http.ResponseWriter){limited("3"), limited(now.Add(20 * time.Second).Format(http.TimeFormat))}
+	_, err := c.Services(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{3 * time.Second, 20 * time.Second}, waits)
+	require.Len(t, headers, 3)
+	assert.Equal(t, testKey, headers[2].Get("X-API-Key"))
+
+	// Out of retries, or asked to wait too long: the 429 is returned.
+	waits = nil
+	responses = []func(w http.ResponseWriter){limited(""), limited(""), limited("")}
+	_, err = c.Services(ctx)
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, waits)
+
+	waits = nil
+	responses = []func(w http.ResponseWriter){limited("600")}
+	_, err = c.Services(ctx)
+	var apiErr *Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 10*time.Minute, apiErr.RetryAfter)
+	assert.Equal(t, "open311: 429: Rate limit exceeded", apiErr.Error())
+	assert.Empty(t, waits)
+}
+
+func TestRequestQueryValues(t *testing.T) {
+	v := RequestQuery{
+		ServiceCodes: []string{"pothole", "graffiti"},
+		StartDate:    time.Date(2026, 1, 1, 2, 0, 0, 0, time.FixedZone("EET", 2*3600)),
+		Properties: []PropertyFilter{
+			{Key: "ward", Values: []string{`a,b`, `c\d`}},
+			{Key: "ward", Op: PropertyNe, Values: []string{"9"}},
+			{Key: "depth_cm", Op: PropertyGte, Values: []string{"10"}},
+			{Key: "photo", Op: PropertyMissing},
+		},
+		Page:  2,
+		Count: true,
+	}.Values()
+	assert.Equal(t, url.Values{
+		"service_code":             {"pothole,graffiti"},
+		"start_date":               {"2026-01-01T00:00:00Z"},
+		"properties.ward":          {`a\,b,c\\d`},
+		"properties.ward[ne]":      {"9"},
+		"properties.depth_cm[gte]": {"10"},
+		"properties.photo[exists]": {"false"},
+		"page":                     {"2"},
+		"count":                    {"true"},
+	}, v)
+
+	for _, base := range []string{"ftp://x", "/open311/v2", "http://"} {
+		_, err := New(base)
+		assert.Error(t, err, base)
+	}
+	c := newTestClient(t, "https://api.example.org")
+	assert.Equal(t, "https://api.example.org/open311/v2/requests/a%2Fb", c.endpoint(nil, "requests", "a/b").String())
+}
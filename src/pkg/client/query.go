@@ -0,0 +1,169 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Listing orders (RequestQuery.Sort).
+const (
+	SortRequestedDatetime = "requested_datetime"
+	SortUpdatedDatetime   = "updated_datetime"
+	// SortRelevance ranks a Q search best first; it pages by page number.
+	SortRelevance = "relevance"
+)
+
+// Property filter operators (PropertyFilter.Op).
+const (
+	PropertyEq  = "eq"
+	PropertyNe  = "ne"
+	PropertyLt  = "lt"
+	PropertyLte = "lte"
+	PropertyGt  = "gt"
+	PropertyGte = "gte"
+	// PropertyExists matches requests that have the key.
+	PropertyExists = "exists"
+	// PropertyMissing matches requests that do not have the key.
+	PropertyMissing = "missing"
+)
+
+// GeoRadius selects requests within RadiusMeters of a WGS84 point.
+type GeoRadius struct {
+	Lat          float64
+	Long         float64
+	RadiusMeters float64
+}
+
+// GeoBBox selects requests inside a WGS84 bounding box.
+type GeoBBox struct {
+	MinLong float64
+	MinLat  float64
+	MaxLong float64
+	MaxLat  float64
+}
+
+// PropertyFilter filters on an extension property. Eq and Ne match any or
+// none of Values; the comparisons take one value; Exists and Missing none.
+type PropertyFilter struct {
+	Key    string
+	Op     string
+	Values []string
+}
+
+// RequestQuery holds the filters of GET /requests; zero values are left out.
+type RequestQuery struct {
+	ServiceRequestIDs []string
+	ServiceCodes      []string
+	Statuses          []string
+	StartDate         time.Time
+	EndDate           time.Time
+	UpdatedAfter      time.Time
+	UpdatedBefore     time.Time
+	// Q is a full-text search.
+	Q              string
+	FeatureID      string
+	FeatureGuid    string
+	OrganizationID string
+	Near           *GeoRadius
+	Within         *GeoBBox
+	Properties     []PropertyFilter
+	// IncludeDeleted also returns soft-deleted tombstones (needs an API key).
+	IncludeDeleted bool
+	Sort           string
+	// Ascending orders oldest first; the default is newest first.
+	Ascending bool
+	// Cursor continues after a previous page (RequestPage.NextCursor).
+	Cursor string
+	// Page is 1-based; prefer Cursor, or Requests, which follows the pages.
+	Page    int
+	PerPage int
+	// Count asks for the total number of matches (RequestPage.Total).
+	Count bool
+}
+
+// Values encodes q as query parameters.
+func (q RequestQuery) Values() url.Values {
+	v := url.Values{}
+	setList := func(name string, values []string) {
+		if len(values) > 0 {
+			v.Set(name, strings.Join(values, ","))
+		}
+	}
+	setTime := func(name string, t time.Time) {
+		if !t.IsZero() {
+			v.Set(name, t.UTC().Format(time.RFC3339Nano))
+		}
+	}
+	setString := func(name, s string) {
+		if s != "" {
+			v.Set(name, s)
+		}
+	}
+	setList("service_request_id", q.ServiceRequestIDs)
+	setList("service_code", q.ServiceCodes)
+	setList("status", q.Statuses)
+	setTime("start_date", q.StartDate)
+	setTime("end_date", q.EndDate)
+	setTime("updated_after", q.UpdatedAfter)
+	setTime("updated_before", q.UpdatedBefore)
+	setString("q", q.Q)
+	setString("featureId", q.FeatureID)
+	setString("featureGuid", q.FeatureGuid)
+	setString("organizationId", q.OrganizationID)
+	if n := q.Near; n != nil {
+		v.Set("lat", formatFloat(n.Lat))
+		v.Set("long", formatFloat(n.Long))
+		v.Set("radius", formatFloat(n.RadiusMeters))
+	}
+	if b := q.Within; b != nil {
+		v.Set("bbox", strings.Join([]string{formatFloat(b.MinLong), formatFloat(b.MinLat), formatFloat(b.MaxLong), formatFloat(b.MaxLat)}, ","))
+	}
+	for _, f := range q.Properties {
+		name := "properties." + f.Key
+		switch f.Op {
+		case "", PropertyEq:
+			v.Add(name, joinPropertyValues(f.Values))
+		case PropertyExists:
+			v.Add(name+"[exists]", "true")
+		case PropertyMissing:
+			v.Add(name+"[exists]", "false")
+		default:
+			v.Add(name+"["+f.Op+"]", joinPropertyValues(f.Values))
+		}
+	}
+	if q.IncludeDeleted {
+		v.Set("include_deleted", "true")
+	}
+	setString("sort", q.Sort)
+	if q.Ascending {
+		v.Set("order", "asc")
+	}
+	setString("cursor", q.Cursor)
+	if q.Page > 0 {
+		v.Set("page", strconv.Itoa(q.Page))
+	}
+	if q.PerPage > 0 {
+		v.Set("per_page", strconv.Itoa(q.PerPage))
+	}
+	if q.Count {
+		v.Set("count", "true")
+	}
+	return v
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// joinPropertyValues joins property filter values with ',', escaping ',' and
+// '\' in them with '\'.
+func joinPropertyValues(values []string) string {
+	escaped := make([]string, len(values))
+	for i, s := range values {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+		escaped[i] = strings.ReplaceAll(s, ",", `\,`)
+	}
+	return strings.Join(escaped, ",")
+}
@@ -0,0 +1,268 @@
+package client
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// MaxBulkRequests is the most requests the API takes in one bulk call;
+// BulkUpsert sends larger slices in several calls.
+const MaxBulkRequests = 1000
+
+// RequestPage is one page of a listing.
+type RequestPage struct {
+	Requests []models.ServiceRequest
+	// NextCursor continues after this page (RequestQuery.Cursor); it is ""
+	// on the last page and when sorted by relevance.
+	NextCursor string
+	// Total is the number of matches when RequestQuery.Count was set, else -1.
+	Total int64
+
+	next *url.URL
+}
+
+// HasNext reports whether a next page may follow. The final page of an
+// exact multiple of the page size is empty.
+func (p *RequestPage) HasNext() bool {
+	return p.next != nil
+}
+
+// ListRequests fetches one page of service requests.
+func (c *Client) ListRequests(ctx context.Context, q RequestQuery) (*RequestPage, error) {
+	return c.listPage(ctx, c.endpoint(q.Values(), "requests"))
+}
+
+// NextPage fetches the page after p; it returns nil without a next page.
+func (c *Client) NextPage(ctx context.Context, p *RequestPage) (*RequestPage, error) {
+	if p.next == nil {
+		return nil, nil
+	}
+	return c.listPage(ctx, p.next)
+}
+
+// Requests iterates over every request matching q, following the pages. An
+// error is yielded once and ends the iteration.
+func (c *Client) Requests(ctx context.Context, q RequestQuery) iter.Seq2[models.ServiceRequest, error] {
+	return func(yield func(models.ServiceRequest, error) bool) {
+		page, err := c.ListRequests(ctx, q)
+		for {
+			if err != nil {
+				yield(models.ServiceRequest{}, err)
+				return
+			}
+			for _, req := range page.Requests {
+				if !yield(req, nil) {
+					return
+				}
+			}
+			if !page.HasNext() {
+				return
+			}
+			page, err = c.NextPage(ctx, page)
+		}
+	}
+}
+
+func (c *Client) listPage(ctx context.Context, u *url.URL) (*RequestPage, error) {
+	resp, err := c.do(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	page := &RequestPage{Total: -1, NextCursor: resp.Header.Get("X-Next-Cursor")}
+	if s := resp.Header.Get("X-Total-Count"); s != "" {
+		if page.Total, err = strconv.ParseInt(s, 10, 64); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("open311: invalid X-Total-Count %q", s)
+		}
+	}
+	if next := nextLink(resp.Header.Values("Link")); next != "" {
+		ref, err := url.Parse(next)
+		if err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("open311: invalid next link %q", next)
+		}
+		page.next = u.ResolveReference(ref)
+	}
+	if page.Requests, err = decodeRequests(resp); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// nextLink returns the target of the rel="next" link of Link headers.
+func nextLink(headers []string) string {
+	for _, h := range headers {
+		for _, link := range strings.Split(h, ",") {
+			target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+			if !ok || !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, p := range strings.Split(params, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+				if strings.EqualFold(name, "rel") && strings.Trim(value, `"`) == "next" {
+					return target[1 : len(target)-1]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// decodeRequests reads a collection of service requests: a JSON array, or a
+// <requests> document.
+func decodeRequests(resp *http.Response) ([]models.ServiceRequest, error) {
+	var list []models.ServiceRequest
+	var wrapper models.ServiceRequests
+	if err := decode(resp, &list, &wrapper); err != nil {
+		return nil, err
+	}
+	if isXML(resp) {
+		return wrapper.Items, nil
+	}
+	return list, nil
+}
+
+// single returns the one request of a collection response.
+func single(resp *http.Response) (models.ServiceRequest, error) {
+	list, err := decodeRequests(resp)
+	if err != nil {
+		return models.ServiceRequest{}, err
+	}
+	if len(list) != 1 {
+		return models.ServiceRequest{}, fmt.Errorf("open311: invalid response: %d requests, expected one", len(list))
+	}
+	return list[0], nil
+}
+
+// GetRequest fetches a service request by service_request_id.
+func (c *Client) GetRequest(ctx context.Context, id string) (models.ServiceRequest, error) {
+	resp, err := c.do(ctx, http.MethodGet, c.endpoint(nil, "requests", id), nil)
+	if err != nil {
+		return models.ServiceRequest{}, err
+	}
+	return single(resp)
+}
+
+// CreateRequest creates a service request; the server assigns its id and
+// timestamps.
+func (c *Client) CreateRequest(ctx context.Context, req models.ServiceRequest) (models.ServiceRequest, error) {
+	body, err := c.encode(req, "request")
+	if err != nil {
+		return models.ServiceRequest{}, err
+	}
+	resp, err := c.do(ctx, http.MethodPost, c.endpoint(nil, "requests"), body)
+	if err != nil {
+		return models.ServiceRequest{}, err
+	}
+	return single(resp)
+}
+
+// UpsertRequest creates or replaces the request with req's
+// service_request_id, keeping its updated_datetime. created reports whether
+// it was new.
+func (c *Client) UpsertRequest(ctx context.Context, req models.ServiceRequest) (stored models.ServiceRequest, created bool, err error) {
+	if req.ServiceRequestID == "" {
+		return stored, false, errors.New("client: upsert needs a service_request_id")
+	}
+	body, err := c.encode(req, "request")
+	if err != nil {
+		return stored, false, err
+	}
+	resp, err := c.do(ctx, http.MethodPut, c.endpoint(nil, "requests", req.ServiceRequestID), body)
+	if err != nil {
+		return stored, false, err
+	}
+	created = resp.StatusCode == http.StatusCreated
+	stored, err = single(resp)
+	return stored, created, err
+}
+
+// DeleteRequest deletes a service request.
+func (c *Client) DeleteRequest(ctx context.Context, id string) error {
+	resp, err := c.do(ctx, http.MethodDelete, c.endpoint(nil, "requests", id), nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// BulkOptions tunes BulkUpsert.
+type BulkOptions struct {
+	// OnlyIfNewer skips records whose updated_datetime is not newer than the
+	// stored copy.
+	OnlyIfNewer bool
+}
+
+// BulkResult summarizes a bulk upsert, as POST /requests/bulk returns it.
+type BulkResult struct {
+	XMLName   xml.Name    `json:"-" xml:"bulk_result"`
+	Requested int         `json:"requested" xml:"requested"`
+	Created   int         `json:"created" xml:"created"`
+	Updated   int         `json:"updated" xml:"updated"`
+	Skipped   int         `json:"skipped" xml:"skipped"`
+	Failed    int         `json:"failed" xml:"failed"`
+	Errors    []BulkError `json:"errors,omitempty" xml:"errors>error,omitempty"`
+}
+
+// BulkError reports a rejected record, or with Warning one written with a
+// value-set warning.
+type BulkError struct {
+	// Index is the record's position in the slice given to BulkUpsert.
+	Index            int    `json:"index" xml:"index"`
+	ServiceRequestID string `json:"service_request_id" xml:"service_request_id"`
+	Message          string `json:"message" xml:"message"`
+	Warning          bool   `json:"warning,omitempty" xml:"warning,omitempty"`
+}
+
+// BulkUpsert creates or replaces requests by service_request_id, in calls of
+// up to MaxBulkRequests. Invalid records are reported in the result rather
+// than failing the call. On an error the result covers the calls that
+// succeeded.
+func (c *Client) BulkUpsert(ctx context.Context, reqs []models.ServiceRequest, opts BulkOptions) (BulkResult, error) {
+	var total BulkResult
+	q := url.Values{}
+	if opts.OnlyIfNewer {
+		q.Set("only_if_newer", "true")
+	}
+	u := c.endpoint(q, "requests", "bulk")
+	for offset := 0; offset < len(reqs); offset += MaxBulkRequests {
+		chunk := reqs[offset:min(offset+MaxBulkRequests, len(reqs))]
+		var body []byte
+		var err error
+		if c.xml {
+			body, err = xml.Marshal(models.ServiceRequests{Items: chunk})
+		} else {
+			body, err = c.encode(chunk, "")
+		}
+		if err != nil {
+			return total, err
+		}
+		resp, err := c.do(ctx, http.MethodPost, u, body)
+		if err != nil {
+			return total, err
+		}
+		var res BulkResult
+		if err := decode(resp, &res, nil); err != nil {
+			return total, err
+		}
+		total.Requested += res.Requested
+		total.Created += res.Created
+		total.Updated += res.Updated
+		total.Skipped += res.Skipped
+		total.Failed += res.Failed
+		for _, e := range res.Errors {
+			e.Index += offset
+			total.Errors = append(total.Errors, e)
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/timoruohomaki/open311-to-Go/domain/models"
+)
+
+// Services lists the services requests can be made for.
+func (c *Client) Services(ctx context.Context) ([]models.Service, error) {
+	resp, err := c.do(ctx, http.MethodGet, c.endpoint(nil, "services"), nil)
+	if err != nil {
+		return nil, err
+	}
+	var list []models.Service
+	var wrapper models.Services
+	if err := decode(resp, &list, &wrapper); err != nil {
+		return nil, err
+	}
+	if isXML(resp) {
+		return wrapper.Items, nil
+	}
+	return list, nil
+}
+
+// Service fetches a service by id.
+func (c *Client) Service(ctx context.Context, id string) (models.Service, error) {
+	var svc models.Service
+	resp, err := c.do(ctx, http.MethodGet, c.endpoint(nil, "services", id), nil)
+	if err != nil {
+		return svc, err
+	}
+	err = decode(resp, &svc, nil)
+	return svc, err
+}
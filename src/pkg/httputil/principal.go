@@ -0,0 +1,60 @@
+package httputil
+
+import (
+	"context"
+	"net/http"
+)
+
+// Principal identifies an authenticated API client. It is attached to the
+// request context by the API-key middleware whenever a valid X-API-Key is
+// presented, on reads as well as writes.
+type Principal struct {
+	// KeyID is a stable, non-secret identifier of the API key (a hash prefix),
+	// safe to log.
+	KeyID string
+	// Scopes are the extra permissions of the key (e.g. ScopeExport).
+	Scopes []string
+}
+
+// Scopes of API keys.
+const (
+	// ScopeExport allows bulk exports (GET /export).
+	ScopeExport = "export"
+	// ScopeContact reveals reporter contact fields and exact locations in
+	// request responses.
+	ScopeContact = "contact"
+)
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromRequest returns the authenticated principal of r, if any.
+func PrincipalFromRequest(r *http.Request) (Principal, bool) {
+	p, ok := r.Context().Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticated reports whether r carries a valid API key. Admin-only read
+// options (e.g. include_deleted) require it.
+func Authenticated(r *http.Request) bool {
+	_, ok := PrincipalFromRequest(r)
+	return ok
+}
+
+// HasScope reports whether r carries a valid API key with scope.
+func HasScope(r *http.Request, scope string) bool {
+	p, ok := PrincipalFromRequest(r)
+	if !ok {
+		return false
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -11,28 +11,49 @@ import (
 // (POST/PUT/PATCH/DELETE). Read requests (GET/HEAD/OPTIONS) are always public,
 // matching the Open311 model where service/request reads are open.
 //
-// If allowedKeys is empty, authentication is disabled and all requests pass —
-// the caller should warn when starting in that mode.
-func APIKeyMiddleware(allowedKeys []string) func(http.Handler) http.Handler {
-	keySet := make(map[string]struct{}, len(allowedKeys))
+// A valid key on any request attaches an httputil.Principal to the request
+// context, so handlers can unlock admin-only read options. Invalid keys on
+// reads are ignored (the read stays public, just unauthenticated).
+//
+// scoped maps keys to the scopes their principal carries (e.g.
+// httputil.ScopeExport). A key only in scoped is a read-only principal: it is
+// rejected on writes like an invalid key. A key in both lists has both.
+//
+// If allowedKeys is empty, write authentication is disabled and all writes
+// pass — the caller should warn when starting in that mode. Only scoped keys
+// attach a principal then, so admin-only reads stay locked without them.
+func APIKeyMiddleware(allowedKeys []string, scoped map[string][]string) func(http.Handler) http.Handler {
+	type keyInfo struct {
+		scopes []string
+		write  bool
+	}
+	keySet := make(map[string]keyInfo, len(allowedKeys)+len(scoped))
 	for _, k := range allowedKeys {
 		if k = strings.TrimSpace(k); k != "" {
-			keySet[k] = struct{}{}
+			keySet[k] = keyInfo{write: true}
+		}
+	}
+	writeAuth := len(keySet) > 0
+	for k, scopes := range scoped {
+		if k = strings.TrimSpace(k); k != "" {
+			info := keySet[k]
+			info.scopes = append(info.scopes, scopes...)
+			keySet[k] = info
 		}
 	}
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if len(keySet) == 0 || !isWriteMethod(r.Method) {
-				next.ServeHTTP(w, r)
-				return
-			}
-
 			key := r.Header.Get("X-API-Key")
-			if _, ok := keySet[key]; key == "" || !ok {
+			info, valid := keySet[key]
+			valid = valid && key != ""
+			if writeAuth && isWriteMethod(r.Method) && !info.write {
 				_ = httputil.SendError(w, r, http.StatusUnauthorized, "missing or invalid API key")
 				return
 			}
+			if valid {
+				r = r.WithContext(httputil.WithPrincipal(r.Context(), httputil.Principal{KeyID: hashKey(key), Scopes: info.scopes}))
+			}
 
 			next.ServeHTTP(w, r)
 		})
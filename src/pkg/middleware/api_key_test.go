@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
 )
 
 func okHandler() http.Handler {
@@ -15,7 +16,7 @@ func okHandler() http.Handler {
 }
 
 func TestAPIKeyMiddleware(t *testing.T) {
-	handler := APIKeyMiddleware([]string{"secret1", "secret2"})(okHandler())
+	handler := APIKeyMiddleware([]string{"secret1", "secret2"}, nil)(okHandler())
 
 	cases := []struct {
 		name   string
@@ -47,7 +48,7 @@ func TestAPIKeyMiddleware(t *testing.T) {
 }
 
 func TestAPIKeyMiddlewareDisabledWhenNoKeys(t *testing.T) {
-	handler := APIKeyMiddleware(nil)(okHandler())
+	handler := APIKeyMiddleware(nil, nil)(okHandler())
 
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/services", nil)
 	rec := httptest.NewRecorder()
@@ -56,3 +57,92 @@ func TestAPIKeyMiddlewareDisabledWhenNoKeys(t *testing.T) {
 	// With no configured keys, write auth is disabled and the request passes.
 	assert.Equal(t, http.StatusOK, rec.Code)
 }
+
+func TestAPIKeyMiddlewareAttachesPrincipal(t *testing.T) {
+	var authenticated bool
+	handler := APIKeyMiddleware([]string{"secret1"}, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authenticated = httputil.Authenticated(r)
+	}))
+
+	cases := []struct {
+		key  string
+		want bool
+	}{
+		{"secret1", true},
+		{"nope", false},
+		{"", false},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/open311/v2/requests", nil)
+		if tc.key != "" {
+			req.Header.Set("X-API-Key", tc.key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		// Reads stay public either way; only the principal differs.
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, tc.want, authenticated, tc.key)
+	}
+}
+
+func TestAPIKeyMiddlewareScopes(t *testing.T) {
+	var exporter, authenticated bool
+	handler := APIKeyMiddleware([]string{"secret1"}, map[string][]string{"lake": {httputil.ScopeExport}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			exporter, authenticated = httputil.HasScope(r, httputil.ScopeExport), httputil.Authenticated(r)
+		}))
+
+	cases := []struct {
+		key                     string
+		authenticated, exporter bool
+	}{
+		{"lake", true, true},
+		{"secret1", true, false},
+		{"", false, false},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/open311/v2/export", nil)
+		if tc.key != "" {
+			req.Header.Set("X-API-Key", tc.key)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, tc.authenticated, authenticated, tc.key)
+		assert.Equal(t, tc.exporter, exporter, tc.key)
+	}
+
+	// A key with only a scope is read-only.
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		req := httptest.NewRequest(method, "/open311/v2/requests", nil)
+		req.Header.Set("X-API-Key", "lake")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, method)
+	}
+
+	// Listed as a write key too, it may write.
+	handler = APIKeyMiddleware([]string{"lake"}, map[string][]string{"lake": {httputil.ScopeExport}})(okHandler())
+	req := httptest.NewRequest(http.MethodPost, "/open311/v2/requests", nil)
+	req.Header.Set("X-API-Key", "lake")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAPIKeyMiddlewareScopedKeysOnly(t *testing.T) {
+	var exporter bool
+	handler := APIKeyMiddleware(nil, map[string][]string{"lake": {httputil.ScopeExport}})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			exporter = httputil.HasScope(r, httputil.ScopeExport)
+		}))
+
+	// Scoped keys alone do not turn on write authentication...
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/open311/v2/requests", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// ...but still identify their principal.
+	req := httptest.NewRequest(http.MethodGet, "/open311/v2/export", nil)
+	req.Header.Set("X-API-Key", "lake")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.True(t, exporter)
+}
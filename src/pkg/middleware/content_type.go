@@ -21,16 +21,17 @@ func ContentTypeMiddleware(next http.Handler) http.Handler {
 			r.Header.Set("Accept", "application/json")
 		}
 
-		// Check and parse Content-Type for requests with body
+		// Check and parse Content-Type for requests with body. A write that
+		// declares an empty body (e.g. POST .../erasure) needs none.
 		contentType := r.Header.Get("Content-Type")
-		if r.Method == "POST" || r.Method == "PUT" {
+		if (r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH") && r.ContentLength != 0 {
 			if contentType == "" {
 				_ = httputil.SendError(w, r, http.StatusBadRequest, "Content-Type header is required")
 				return
 			}
 
-			if !strings.Contains(contentType, "application/json") && !strings.Contains(contentType, "application/xml") {
-				_ = httputil.SendError(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json or application/xml")
+			if !isAcceptedBody(contentType) {
+				_ = httputil.SendError(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json, application/xml, application/x-ndjson or text/csv")
 				return
 			}
 		}
@@ -38,3 +39,14 @@ func ContentTypeMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// isAcceptedBody accepts application/json and application/xml plus their
+// structured-syntax variants (e.g. application/merge-patch+json for PATCH),
+// application/x-ndjson (streamed bulk upserts) and text/csv (source rows for a
+// dictionary bulk upsert).
+func isAcceptedBody(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	return strings.Contains(ct, "application/json") || strings.Contains(ct, "application/xml") ||
+		strings.Contains(ct, "+json") || strings.Contains(ct, "+xml") || strings.Contains(ct, "ndjson") ||
+		strings.Contains(ct, "text/csv")
+}
@@ -54,3 +54,9 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	rw.size += n
 	return n, err
 }
+
+// Unwrap exposes the underlying writer to http.ResponseController, so
+// streaming handlers can flush and extend deadlines through the wrapper.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -61,3 +61,15 @@ func TestLoggingMiddleware_ApacheFormat(t *testing.T) {
 	assert.Contains(t, logLine, "TestAgent/1.0")       // User-Agent
 	assert.Contains(t, logLine, "http://example.com/") // Referer
 }
+
+func TestLoggingMiddleware_Flushes(t *testing.T) {
+	mw := LoggingMiddleware(&mockLogger{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: 1\n\n"))
+		assert.NoError(t, http.NewResponseController(w).Flush())
+	})
+
+	rec := httptest.NewRecorder()
+	mw(h).ServeHTTP(rec, httptest.NewRequest("GET", "/stream", nil))
+	assert.True(t, rec.Flushed)
+}
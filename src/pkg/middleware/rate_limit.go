@@ -1,25 +1,85 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/timoruohomaki/open311-to-Go/pkg/httputil"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+	"github.com/timoruohomaki/open311-to-Go/pkg/ratelimit"
 )
 
-// RateLimitMiddleware limits each client to requestsPerMinute requests using a
-// fixed window. A non-positive limit disables rate limiting. /health is exempt.
-// On exceed it responds 429 with a Retry-After header.
-func RateLimitMiddleware(requestsPerMinute int) func(http.Handler) http.Handler {
-	if requestsPerMinute <= 0 {
+// Route classes used to pick a rate-limit policy.
+const (
+	RouteClassRead  = "read"
+	RouteClassWrite = "write"
+	RouteClassBulk  = "bulk"
+)
+
+// RateLimitOptions configures RateLimitMiddleware.
+type RateLimitOptions struct {
+	// Policies holds the default token-bucket policy per route class
+	// (RouteClassRead/Write/Bulk). A class with no enabled policy is unlimited.
+	Policies map[string]ratelimit.Policy
+	// KeyPolicies overrides Policies for clients presenting a valid API key:
+	// API key -> route class -> policy.
+	KeyPolicies map[string]map[string]ratelimit.Policy
+	// APIKeys is the allowlist used to decide whether a presented X-API-Key may
+	// be used as the client identity. Unknown keys fall back to the client IP,
+	// so inventing keys does not buy a fresh bucket.
+	APIKeys []string
+	// TrustedProxies lists the proxy networks whose X-Forwarded-For entries are
+	// believed. Requests from anywhere else are identified by RemoteAddr.
+	TrustedProxies []*net.IPNet
+	// Store holds the buckets. Defaults to a ratelimit.MemoryStore.
+	Store ratelimit.Store
+	// Logger, if set, receives store errors (the middleware fails open).
+	Logger logger.Logger
+}
+
+// Enabled reports whether any route class or key policy limits anything.
+func (o RateLimitOptions) Enabled() bool {
+	for _, p := range o.Policies {
+		if p.Enabled() {
+			return true
+		}
+	}
+	for _, classes := range o.KeyPolicies {
+		for _, p := range classes {
+			if p.Enabled() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RateLimitMiddleware applies token-bucket limits per client and route class.
+// The client is the API key when a valid X-API-Key is presented, otherwise the
+// client IP (see ClientIP). /health is exempt. Every limited response carries
+// RateLimit-Limit / RateLimit-Remaining / RateLimit-Reset / RateLimit-Policy
+// headers; on exceed it responds 429 with Retry-After. With no enabled policy
+// the middleware is a no-op.
+func RateLimitMiddleware(opts RateLimitOptions) func(http.Handler) http.Handler {
+	if !opts.Enabled() {
 		return func(next http.Handler) http.Handler { return next }
 	}
 
-	limiter := newFixedWindowLimiter(requestsPerMinute, time.Minute)
+	store := opts.Store
+	if store == nil {
+		store = ratelimit.NewMemoryStore()
+	}
+	keySet := make(map[string]struct{}, len(opts.APIKeys))
+	for _, k := range opts.APIKeys {
+		if k = strings.TrimSpace(k); k != "" {
+			keySet[k] = struct{}{}
+		}
+	}
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -28,13 +88,43 @@ func RateLimitMiddleware(requestsPerMinute int) func(http.Handler) http.Handler
 				return
 			}
 
-			allowed, retryAfter := limiter.allow(clientIP(r), time.Now())
-			if !allowed {
-				secs := int(retryAfter.Seconds())
+			class := RouteClass(r)
+			identity := "ip:" + ClientIP(r, opts.TrustedProxies)
+			policy := opts.Policies[class]
+			if key := r.Header.Get("X-API-Key"); key != "" {
+				if _, ok := keySet[key]; ok {
+					identity = "key:" + hashKey(key)
+					if p, ok := opts.KeyPolicies[key][class]; ok {
+						policy = p
+					}
+				}
+			}
+			if !policy.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			d, err := store.Take(r.Context(), class+"|"+identity, policy, time.Now())
+			if err != nil {
+				if opts.Logger != nil {
+					opts.Logger.Errorf("rate limit store: %v", err)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+			h.Set("RateLimit-Policy", policy.String())
+
+			if !d.Allowed {
+				secs := ceilSeconds(d.RetryAfter)
 				if secs < 1 {
 					secs = 1
 				}
-				w.Header().Set("Retry-After", strconv.Itoa(secs))
+				h.Set("Retry-After", strconv.Itoa(secs))
 				_ = httputil.SendError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
 				return
 			}
@@ -44,71 +134,102 @@ func RateLimitMiddleware(requestsPerMinute int) func(http.Handler) http.Handler
 	}
 }
 
-// clientIP extracts the client address, preferring the first X-Forwarded-For
-// hop (set by the fronting proxy/Nginx) and falling back to RemoteAddr.
-func clientIP(r *http.Request) string {
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		if i := strings.IndexByte(xff, ','); i >= 0 {
-			return strings.TrimSpace(xff[:i])
+// RouteClass classifies a request for rate limiting: bulk endpoints (and
+// import job uploads and exports), other writes, and reads.
+func RouteClass(r *http.Request) string {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	if !isWriteMethod(r.Method) {
+		if strings.HasSuffix(path, "/export") {
+			return RouteClassBulk
 		}
-		return strings.TrimSpace(xff)
+		return RouteClassRead
 	}
-	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
-		return host
+	if strings.HasSuffix(path, "/bulk") || strings.HasSuffix(path, "/jobs/imports") {
+		return RouteClassBulk
 	}
-	return r.RemoteAddr
+	return RouteClassWrite
 }
 
-type windowCounter struct {
-	count   int
-	resetAt time.Time
-}
+// ClientIP extracts the client address. X-Forwarded-For is honoured only when
+// the direct peer is a trusted proxy; the list is then walked right to left,
+// skipping trusted hops, and the first untrusted address is the client. This
+// stops clients from choosing their own identity by sending the header.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !isTrusted(remote, trusted) {
+		return remote
+	}
 
-type fixedWindowLimiter struct {
-	mu        sync.Mutex
-	limit     int
-	window    time.Duration
-	clients   map[string]*windowCounter
-	lastSweep time.Time
+	xff := r.Header.Values("X-Forwarded-For")
+	hops := make([]string, 0, len(xff))
+	for _, v := range xff {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				hops = append(hops, h)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !isTrusted(hops[i], trusted) {
+			return hops[i]
+		}
+	}
+	if len(hops) > 0 {
+		return hops[0]
+	}
+	return remote
 }
 
-func newFixedWindowLimiter(limit int, window time.Duration) *fixedWindowLimiter {
-	return &fixedWindowLimiter{
-		limit:   limit,
-		window:  window,
-		clients: make(map[string]*windowCounter),
+// ParseCIDRs parses a list of CIDRs or bare IPs (treated as /32 or /128).
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	out := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: v}
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			v += "/" + strconv.Itoa(bits)
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
 	}
+	return out, nil
 }
 
-// allow reports whether a request from key is permitted at time now, and if not,
-// how long until the current window resets.
-func (l *fixedWindowLimiter) allow(key string, now time.Time) (bool, time.Duration) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-
-	l.sweep(now)
-
-	c, ok := l.clients[key]
-	if !ok || now.After(c.resetAt) {
-		l.clients[key] = &windowCounter{count: 1, resetAt: now.Add(l.window)}
-		return true, 0
+func isTrusted(addr string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
 	}
-	if c.count >= l.limit {
-		return false, c.resetAt.Sub(now)
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
 	}
-	c.count++
-	return true, 0
+	return false
 }
 
-// sweep evicts expired client entries at most once per window to bound memory.
-func (l *fixedWindowLimiter) sweep(now time.Time) {
-	if now.Sub(l.lastSweep) < l.window {
-		return
-	}
-	l.lastSweep = now
-	for k, c := range l.clients {
-		if now.After(c.resetAt) {
-			delete(l.clients, k)
-		}
+// hashKey keeps raw API keys out of bucket ids (which a shared store persists).
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func ceilSeconds(d time.Duration) int {
+	secs := int(d / time.Second)
+	if d%time.Second != 0 {
+		secs++
 	}
+	return secs
 }
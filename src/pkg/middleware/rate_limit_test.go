@@ -1,32 +1,130 @@
 package middleware
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/timoruohomaki/open311-to-Go/pkg/ratelimit"
 )
 
-func TestFixedWindowLimiter(t *testing.T) {
-	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
-	limiter := newFixedWindowLimiter(2, time.Minute)
+func TestRateLimitMiddleware(t *testing.T) {
+	handler := RateLimitMiddleware(RateLimitOptions{
+		Policies: map[string]ratelimit.Policy{
+			RouteClassRead:  ratelimit.PerMinute(2),
+			RouteClassWrite: ratelimit.PerMinute(1),
+		},
+	})(okHandler())
 
-	// First two requests in the window are allowed.
-	ok, _ := limiter.allow("a", base)
-	assert.True(t, ok)
-	ok, _ = limiter.allow("a", base.Add(time.Second))
-	assert.True(t, ok)
+	get := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/open311/v2/requests", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
 
-	// Third is denied with a positive retry-after.
-	ok, retry := limiter.allow("a", base.Add(2*time.Second))
-	assert.False(t, ok)
-	assert.Greater(t, retry, time.Duration(0))
+	rec := get("10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=60", rec.Header().Get("RateLimit-Policy"))
 
-	// A different client is independent.
-	ok, _ = limiter.allow("b", base.Add(2*time.Second))
-	assert.True(t, ok)
+	assert.Equal(t, http.StatusOK, get("10.0.0.1:1234").Code)
+	rec = get("10.0.0.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
 
-	// After the window resets, the original client is allowed again.
-	ok, _ = limiter.allow("a", base.Add(time.Minute+time.Second))
-	assert.True(t, ok)
+	// Writes use their own bucket.
+	req := httptest.NewRequest(http.MethodPost, "/open311/v2/requests", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Health is exempt.
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitMiddlewarePerKey(t *testing.T) {
+	handler := RateLimitMiddleware(RateLimitOptions{
+		Policies: map[string]ratelimit.Policy{RouteClassBulk: ratelimit.PerMinute(1)},
+		KeyPolicies: map[string]map[string]ratelimit.Policy{
+			"feeder": {RouteClassBulk: ratelimit.PerMinute(100)},
+		},
+		APIKeys: []string{"feeder", "other"},
+	})(okHandler())
+
+	bulk := func(key string) int {
+		req := httptest.NewRequest(http.MethodPost, "/open311/v2/requests/bulk", nil)
+		req.RemoteAddr = "10.0.0.9:1"
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// The feeder key has a larger bulk allowance.
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, bulk("feeder"))
+	}
+	// A valid key without an override gets the class default, in its own bucket.
+	assert.Equal(t, http.StatusOK, bulk("other"))
+	assert.Equal(t, http.StatusTooManyRequests, bulk("other"))
+	// Unknown keys fall back to the IP bucket rather than a fresh one.
+	assert.Equal(t, http.StatusOK, bulk("made-up-1"))
+	assert.Equal(t, http.StatusTooManyRequests, bulk("made-up-2"))
+}
+
+func TestRateLimitMiddlewareDisabled(t *testing.T) {
+	handler := RateLimitMiddleware(RateLimitOptions{})(okHandler())
+	req := httptest.NewRequest(http.MethodGet, "/open311/v2/requests", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("RateLimit-Limit"))
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseCIDRs([]string{"127.0.0.1", "10.1.0.0/16"})
+	assert.NoError(t, err)
+
+	cases := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"untrusted peer ignores XFF", "203.0.113.5:4000", "1.2.3.4", "203.0.113.5"},
+		{"trusted peer uses XFF", "127.0.0.1:4000", "198.51.100.7", "198.51.100.7"},
+		{"spoofed leftmost hop is skipped", "127.0.0.1:4000", "6.6.6.6, 198.51.100.7, 10.1.2.3", "198.51.100.7"},
+		{"trusted peer without XFF", "127.0.0.1:4000", "", "127.0.0.1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remote
+			if tc.xff != "" {
+				req.Header.Set("X-Forwarded-For", tc.xff)
+			}
+			assert.Equal(t, tc.want, ClientIP(req, trusted))
+		})
+	}
+}
+
+func TestRouteClass(t *testing.T) {
+	assert.Equal(t, RouteClassRead, RouteClass(httptest.NewRequest(http.MethodGet, "/open311/v2/requests/bulk", nil)))
+	assert.Equal(t, RouteClassBulk, RouteClass(httptest.NewRequest(http.MethodPost, "/open311/v2/requests/bulk", nil)))
+	assert.Equal(t, RouteClassWrite, RouteClass(httptest.NewRequest(http.MethodPut, "/open311/v2/requests/x", nil)))
+	assert.Equal(t, RouteClassBulk, RouteClass(httptest.NewRequest(http.MethodPost, "/open311/v2/jobs/imports", nil)))
+	assert.Equal(t, RouteClassWrite, RouteClass(httptest.NewRequest(http.MethodPost, "/open311/v2/jobs/x/cancel", nil)))
+	assert.Equal(t, RouteClassBulk, RouteClass(httptest.NewRequest(http.MethodGet, "/open311/v2/export", nil)))
 }
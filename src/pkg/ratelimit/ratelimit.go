@@ -0,0 +1,170 @@
+// Package ratelimit implements token-bucket rate limiting with a pluggable
+// Store, so several API replicas can share counters (see
+// repository.MongoRateLimitStore) or a single process can keep them in memory.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Policy is a token bucket: Limit tokens are refilled evenly over Period, and
+// the bucket holds at most Burst tokens. Each request takes one token. A
+// non-positive Limit means "no limit".
+type Policy struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// PerMinute returns a policy allowing rpm requests per minute with a burst of
+// rpm (so an idle client may spend a full minute's allowance at once, matching
+// the old fixed-window behaviour). rpm <= 0 yields a disabled policy.
+func PerMinute(rpm int) Policy {
+	return Policy{Limit: rpm, Period: time.Minute, Burst: rpm}
+}
+
+// Enabled reports whether the policy limits anything.
+func (p Policy) Enabled() bool {
+	return p.Limit > 0 && p.Period > 0
+}
+
+// Capacity is the bucket size: Burst, or Limit when Burst is unset.
+func (p Policy) Capacity() float64 {
+	if p.Burst > 0 {
+		return float64(p.Burst)
+	}
+	return float64(p.Limit)
+}
+
+// RatePerSecond is the refill rate in tokens per second.
+func (p Policy) RatePerSecond() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// String renders the policy in the RateLimit-Policy header form, e.g. "10;w=60".
+func (p Policy) String() string {
+	s := strconv.Itoa(p.Limit) + ";w=" + strconv.Itoa(int(p.Period.Seconds()))
+	if p.Burst > 0 && p.Burst != p.Limit {
+		s += ";burst=" + strconv.Itoa(p.Burst)
+	}
+	return s
+}
+
+// Decision is the outcome of taking a token.
+type Decision struct {
+	Allowed bool
+	// Limit is the bucket capacity, for the RateLimit-Limit header.
+	Limit int
+	// Remaining is the whole number of tokens left after this request.
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next token is available (zero when
+	// Allowed).
+	RetryAfter time.Duration
+}
+
+// Store takes one token from the bucket identified by key under policy p at
+// time now. Implementations must be safe for concurrent use and atomic per key.
+type Store interface {
+	Take(ctx context.Context, key string, p Policy, now time.Time) (Decision, error)
+}
+
+// Refill returns the token count of a bucket that held tokens at last, refilled
+// up to capacity by time now.
+func Refill(tokens float64, last time.Time, p Policy, now time.Time) float64 {
+	elapsed := now.Sub(last).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(p.Capacity(), tokens+elapsed*p.RatePerSecond())
+}
+
+// NewDecision builds a Decision from a bucket's token count after the take
+// attempt (tokens has already been decremented when allowed).
+func NewDecision(p Policy, tokens float64, allowed bool) Decision {
+	rate := p.RatePerSecond()
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     int(p.Capacity()),
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     secondsToDuration((p.Capacity() - tokens) / rate),
+	}
+	if !allowed {
+		d.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+	return d
+}
+
+func secondsToDuration(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	policy Policy
+}
+
+// MemoryStore keeps buckets in process memory. Counters are per replica; use a
+// shared store when running more than one instance.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	// sweepEvery bounds how often idle buckets are evicted.
+	sweepEvery time.Duration
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:    make(map[string]*bucket),
+		sweepEvery: time.Minute,
+	}
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(_ context.Context, key string, p Policy, now time.Time) (Decision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: p.Capacity(), last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = Refill(b.tokens, b.last, p, now)
+	b.last = now
+	b.policy = p
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return NewDecision(p, b.tokens, allowed), nil
+}
+
+// sweep evicts buckets that have refilled completely (they are
+// indistinguishable from a fresh bucket), at most once per sweepEvery, to bound
+// memory.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.sweepEvery {
+		return
+	}
+	s.lastSweep = now
+	for k, b := range s.buckets {
+		if Refill(b.tokens, b.last, b.policy, now) >= b.policy.Capacity() {
+			delete(s.buckets, k)
+		}
+	}
+}
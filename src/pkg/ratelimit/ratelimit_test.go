@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	ctx := context.Background()
+	// 2 tokens, refilled at 2 per minute (one every 30s).
+	p := PerMinute(2)
+
+	// A fresh bucket allows a full burst.
+	d, err := store.Take(ctx, "a", p, base)
+	assert.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 1, d.Remaining)
+	d, _ = store.Take(ctx, "a", p, base.Add(time.Second))
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+
+	// Third is denied with a positive retry-after.
+	d, _ = store.Take(ctx, "a", p, base.Add(2*time.Second))
+	assert.False(t, d.Allowed)
+	assert.Greater(t, d.RetryAfter, time.Duration(0))
+	assert.LessOrEqual(t, d.RetryAfter, 30*time.Second)
+
+	// A different key is independent.
+	d, _ = store.Take(ctx, "b", p, base.Add(2*time.Second))
+	assert.True(t, d.Allowed)
+
+	// Tokens refill continuously: after ~30s one more request fits.
+	d, _ = store.Take(ctx, "a", p, base.Add(33*time.Second))
+	assert.True(t, d.Allowed)
+	d, _ = store.Take(ctx, "a", p, base.Add(34*time.Second))
+	assert.False(t, d.Allowed)
+}
+
+func TestPolicyBurst(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	p := Policy{Limit: 60, Period: time.Minute, Burst: 5}
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if d, _ := store.Take(context.Background(), "k", p, base); d.Allowed {
+			allowed++
+		}
+	}
+	assert.Equal(t, 5, allowed)
+	assert.Equal(t, "60;w=60;burst=5", p.String())
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/timoruohomaki/open311-to-Go/config"
+	"github.com/timoruohomaki/open311-to-Go/internal/repository"
+	"github.com/timoruohomaki/open311-to-Go/pkg/logger"
+)
+
+// openStorage opens the backend selected by STORAGE_BACKEND.
+func openStorage(cfg *config.Config, log logger.Logger) (*repository.Storage, error) {
+	switch cfg.Storage.Backend {
+	case repository.BackendMemory:
+		log.Warnf("Using the in-memory storage backend; data is lost on restart")
+		return repository.NewMemoryStorage(), nil
+	case repository.BackendPostgres:
+		return openPostgresStorage(cfg, log)
+	case repository.BackendSQLite:
+		return openSQLiteStorage(cfg, log)
+	default:
+		return openMongoStorage(cfg, log)
+	}
+}
+
+func openMongoStorage(cfg *config.Config, log logger.Logger) (*repository.Storage, error) {
+	db, err := repository.NewMongoDBConnection(cfg.MongoDB)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Connected MongoDB database %s", cfg.MongoDB.Database)
+
+	// Apply pending migrations, then ensure indexes (idempotent). Non-fatal:
+	// log and continue if either fails (`open311api migrate status` shows
+	// what is pending).
+	migrateCtx, migrateCancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer migrateCancel()
+	applied, err := repository.NewMongoMigrator(db, cfg.MongoDB.Collection).MigrateUp(migrateCtx, repository.MigrateOptions{})
+	if err != nil {
+		log.Warnf("Failed to apply MongoDB migrations: %v", err)
+	}
+	for _, m := range applied {
+		log.Infof("Applied MongoDB migration %d_%s", m.Version, m.Name)
+	}
+
+	idxCtx, idxCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer idxCancel()
+	if err := repository.EnsureIndexes(idxCtx, db, cfg.MongoDB.Collection, cfg.PropertyIndexKeys); err != nil {
+		log.Warnf("Failed to ensure MongoDB indexes: %v", err)
+	} else {
+		log.Info("MongoDB indexes ensured")
+	}
+
+	return repository.NewMongoStorage(db, cfg.MongoDB.Collection), nil
+}
+
+func openPostgresStorage(cfg *config.Config, log logger.Logger) (*repository.Storage, error) {
+	db, err := repository.NewPostgresConnection(cfg.Postgres)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Connected PostgreSQL database")
+
+	// Unlike MongoDB indexes, the schema is required: a failed migration is fatal.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	applied, err := db.MigrateUp(ctx, repository.MigrateOptions{})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	for _, m := range applied {
+		log.Infof("Applied PostgreSQL migration %d_%s", m.Version, m.Name)
+	}
+	if err := db.EnsurePropertyIndexes(ctx, cfg.PropertyIndexKeys); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return repository.NewPostgresStorage(db), nil
+}
+
+func openSQLiteStorage(cfg *config.Config, log logger.Logger) (*repository.Storage, error) {
+	db, err := repository.NewSQLiteConnection(cfg.SQLite)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Opened SQLite database %s", cfg.SQLite.Path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	applied, err := db.MigrateUp(ctx, repository.MigrateOptions{})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	for _, m := range applied {
+		log.Infof("Applied SQLite migration %d_%s", m.Version, m.Name)
+	}
+	if err := db.EnsurePropertyIndexes(ctx, cfg.PropertyIndexKeys); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return repository.NewSQLiteStorage(db), nil
+}